@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// command is one "group command" pair. setup defines its flags on fs and
+// returns what runs once they are parsed.
+type command struct {
+	help  string
+	setup func(fs *flag.FlagSet) func(c *client) error
+}
+
+var commandOrder = []string{
+	"tasks list", "tasks create", "tasks archive",
+	"points adjust",
+	"users show", "users ban", "users unban",
+	"seasons list", "seasons create", "seasons archive",
+	"webhooks list", "webhooks replay",
+	"tokens revoke",
+}
+
+var commands = map[string]command{
+	"tasks list": {"list all tasks, archived included", func(fs *flag.FlagSet) func(*client) error {
+		return func(c *client) error { return get(c, "/admin/tasks") }
+	}},
+	"tasks create": {"create a task from flags or a JSON file", func(fs *flag.FlagSet) func(*client) error {
+		file := fs.String("f", "", "JSON file with the whole task, as POST /admin/tasks takes it")
+		code := fs.String("code", "", "task code")
+		title := fs.String("title", "", "title")
+		points := fs.Int64("points", 0, "points awarded")
+		desc := fs.String("description", "", "description")
+		category := fs.String("category", "", "category code")
+		review := fs.Bool("review", false, "completions need an admin's approval")
+		return func(c *client) error {
+			task := map[string]any{
+				"code": *code, "title": *title, "points": *points, "description": *desc,
+				"category": *category, "requires_review": *review,
+			}
+			if *file != "" {
+				b, err := os.ReadFile(*file)
+				if err != nil {
+					return err
+				}
+				task = nil
+				if err := json.Unmarshal(b, &task); err != nil {
+					return fmt.Errorf("%s: %w", *file, err)
+				}
+			}
+			return send(c, http.MethodPost, "/admin/tasks", task)
+		}
+	}},
+	"tasks archive": {"archive a task so it can't be completed", func(fs *flag.FlagSet) func(*client) error {
+		code := fs.String("code", "", "task code")
+		return func(c *client) error {
+			if *code == "" {
+				return errors.New("-code is required")
+			}
+			return send(c, http.MethodDelete, "/admin/tasks/"+url.PathEscape(*code), nil)
+		}
+	}},
+	"points adjust": {"credit or debit a user's balance", func(fs *flag.FlagSet) func(*client) error {
+		user := fs.Int64("user", 0, "user id")
+		delta := fs.Int64("delta", 0, "points to add; negative to take away")
+		reason := fs.String("reason", "", "why, for the audit log")
+		return func(c *client) error {
+			return send(c, http.MethodPost, userPath(*user, "/points"), map[string]any{"delta": *delta, "reason": *reason})
+		}
+	}},
+	"users show": {"show a user with their status and roles", func(fs *flag.FlagSet) func(*client) error {
+		user := fs.Int64("user", 0, "user id")
+		return func(c *client) error { return get(c, userPath(*user, "")) }
+	}},
+	"users ban": {"ban a user", func(fs *flag.FlagSet) func(*client) error {
+		user := fs.Int64("user", 0, "user id")
+		reason := fs.String("reason", "", "why, shown to the user")
+		return func(c *client) error {
+			return send(c, http.MethodPost, userPath(*user, "/ban"), map[string]any{"reason": *reason})
+		}
+	}},
+	"users unban": {"lift a ban or suspension", func(fs *flag.FlagSet) func(*client) error {
+		user := fs.Int64("user", 0, "user id")
+		return func(c *client) error { return send(c, http.MethodPost, userPath(*user, "/unban"), nil) }
+	}},
+	"seasons list": {"list seasons", func(fs *flag.FlagSet) func(*client) error {
+		return func(c *client) error { return get(c, "/seasons") }
+	}},
+	"seasons create": {"schedule the next season", func(fs *flag.FlagSet) func(*client) error {
+		name := fs.String("name", "", "season name")
+		starts := fs.String("starts", "", "start, RFC 3339 (default now)")
+		ends := fs.String("ends", "", "end, RFC 3339")
+		return func(c *client) error {
+			in := map[string]any{"name": *name, "ends_at": *ends}
+			if *starts != "" {
+				in["starts_at"] = *starts
+			}
+			return send(c, http.MethodPost, "/admin/seasons", in)
+		}
+	}},
+	"seasons archive": {"archive seasons that are over now, to roll over without waiting for the job", func(fs *flag.FlagSet) func(*client) error {
+		return func(c *client) error { return send(c, http.MethodPost, "/admin/seasons/archive", nil) }
+	}},
+	"webhooks list": {"list webhook endpoints", func(fs *flag.FlagSet) func(*client) error {
+		return func(c *client) error { return get(c, "/admin/webhooks") }
+	}},
+	"webhooks replay": {"queue failed deliveries for another attempt", func(fs *flag.FlagSet) func(*client) error {
+		hook := fs.Int64("webhook", 0, "only this endpoint's deliveries (default all endpoints)")
+		dryRun := fs.Bool("dry-run", false, "list what would be retried")
+		return func(c *client) error { return replayWebhooks(c, *hook, *dryRun) }
+	}},
+	"tokens revoke": {"revoke a user's tokens, or one token by jti", func(fs *flag.FlagSet) func(*client) error {
+		user := fs.Int64("user", 0, "revoke all of this user's access and refresh tokens")
+		jti := fs.String("jti", "", "revoke the token with this jti")
+		return func(c *client) error {
+			in := map[string]any{}
+			if *user != 0 {
+				in["user_id"] = *user
+			}
+			if *jti != "" {
+				in["jti"] = *jti
+			}
+			return send(c, http.MethodPost, "/admin/tokens/revoke", in)
+		}
+	}},
+}
+
+func userPath(id int64, suffix string) string {
+	return fmt.Sprintf("/admin/users/%d%s", id, suffix)
+}
+
+func get(c *client, path string) error {
+	var out any
+	if err := c.do(http.MethodGet, path, nil, &out); err != nil {
+		return err
+	}
+	return print(out)
+}
+
+// send prints the response body, or "ok" for an empty one.
+func send(c *client, method, path string, body any) error {
+	var out any
+	if err := c.do(method, path, body, &out); err != nil {
+		return err
+	}
+	if out == nil {
+		fmt.Println("ok")
+		return nil
+	}
+	return print(out)
+}
+
+// replayWebhooks retries every failed delivery of hookID, or of every
+// endpoint when it is 0, and prints one line per delivery.
+func replayWebhooks(c *client, hookID int64, dryRun bool) error {
+	hooks := []int64{hookID}
+	if hookID == 0 {
+		var list struct {
+			Webhooks []struct {
+				ID int64 `json:"id"`
+			} `json:"webhooks"`
+		}
+		if err := c.do(http.MethodGet, "/admin/webhooks", nil, &list); err != nil {
+			return err
+		}
+		hooks = hooks[:0]
+		for _, h := range list.Webhooks {
+			hooks = append(hooks, h.ID)
+		}
+	}
+
+	type delivery struct {
+		ID    int64  `json:"id"`
+		Event string `json:"event"`
+	}
+	var failed []delivery
+	for _, id := range hooks {
+		before := ""
+		for {
+			var page struct {
+				Deliveries []delivery `json:"deliveries"`
+				NextBefore *int64     `json:"next_before"`
+			}
+			path := fmt.Sprintf("/admin/webhooks/%d/deliveries?status=failed&limit=200%s", id, before)
+			if err := c.do(http.MethodGet, path, nil, &page); err != nil {
+				return err
+			}
+			failed = append(failed, page.Deliveries...)
+			if page.NextBefore == nil {
+				break
+			}
+			before = fmt.Sprintf("&before=%d", *page.NextBefore)
+		}
+	}
+
+	retried := 0
+	for _, d := range failed {
+		if dryRun {
+			fmt.Printf("would retry delivery %d (%s)\n", d.ID, d.Event)
+			continue
+		}
+		err := c.do(http.MethodPost, fmt.Sprintf("/admin/webhooks/deliveries/%d/retry", d.ID), nil, nil)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict {
+			// retried by someone else, or delivered, since the listing
+			fmt.Printf("skipped delivery %d: %s\n", d.ID, apiErr.Message)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("delivery %d: %w", d.ID, err)
+		}
+		retried++
+		fmt.Printf("retrying delivery %d (%s)\n", d.ID, d.Event)
+	}
+	if !dryRun {
+		fmt.Printf("%d of %d failed deliveries queued\n", retried, len(failed))
+	}
+	return nil
+}
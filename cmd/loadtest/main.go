@@ -0,0 +1,296 @@
+// Command loadtest drives task completions and leaderboard reads against a
+// running server from many users at once, and reports throughput and
+// latency percentiles per operation:
+//
+//	go run ./tools/jwtgen -ids 1-1000 -format csv > tokens.csv
+//	go run ./cmd/loadtest -tokens tokens.csv -concurrency 64 -duration 1m
+//	go run ./cmd/loadtest -register 200 -mix complete=1,leaderboard=9 -json
+//
+// Every worker loops until -duration is up or -requests have been sent,
+// picking an operation by the -mix weights and a user at random. It exits
+// 1 when more than -max-error-rate of the requests failed. The server's rate
+// limits apply to it like to any client, so turn them off on the server
+// under test unless they are what is being measured.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type user struct {
+	ID    int64
+	Token string
+}
+
+// op is one kind of request. do returns the response status.
+type op struct {
+	name   string
+	weight int
+	do     func(c *client, u user, rng *rand.Rand) (int, error)
+}
+
+func main() {
+	base := flag.String("url", "http://localhost:8080", "server base URL")
+	tokensFile := flag.String("tokens", "", "users to act as: jwtgen's csv (id,token) or json output")
+	register := flag.Int("register", 0, "register this many fresh users to act as, instead of -tokens")
+	concurrency := flag.Int("concurrency", 16, "concurrent workers")
+	duration := flag.Duration("duration", 30*time.Second, "how long to run")
+	requests := flag.Int64("requests", 0, "stop after this many requests (default: run for -duration)")
+	mix := flag.String("mix", "complete=1,leaderboard=4", "operations and their relative weights")
+	tasks := flag.String("tasks", "daily_checkin", "task codes to complete, picked at random")
+	period := flag.String("period", "all", "leaderboard period")
+	limit := flag.Int("limit", 50, "leaderboard page size")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout per request")
+	maxErrorRate := flag.Float64("max-error-rate", 0.01, "fail if more than this share of requests get an error or a non-2xx status")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	codes := strings.Split(*tasks, ",")
+	leaderboardPath := "/users/leaderboard?" + url.Values{"period": {*period}, "limit": {strconv.Itoa(*limit)}}.Encode()
+	known := map[string]func(c *client, u user, rng *rand.Rand) (int, error){
+		"complete": func(c *client, u user, rng *rand.Rand) (int, error) {
+			code := codes[rng.IntN(len(codes))]
+			return c.do("POST", fmt.Sprintf("/users/%d/task/complete", u.ID), u.Token, map[string]string{"task": code})
+		},
+		"leaderboard": func(c *client, u user, rng *rand.Rand) (int, error) {
+			return c.do("GET", leaderboardPath, u.Token, nil)
+		},
+		"status": func(c *client, u user, rng *rand.Rand) (int, error) {
+			return c.do("GET", fmt.Sprintf("/users/%d/status", u.ID), u.Token, nil)
+		},
+	}
+	ops, err := parseMix(*mix, known)
+	if err != nil {
+		fail("-mix: %v", err)
+	}
+	if *concurrency < 1 {
+		fail("-concurrency: must be at least 1")
+	}
+
+	// keep a connection per worker rather than the default two per host
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = *concurrency
+	c := &client{base: strings.TrimRight(*base, "/"), http: &http.Client{Timeout: *timeout, Transport: transport}}
+
+	var users []user
+	switch {
+	case *tokensFile != "" && *register > 0:
+		fail("give -tokens or -register, not both")
+	case *tokensFile != "":
+		if users, err = loadTokens(*tokensFile); err != nil {
+			fail("-tokens: %v", err)
+		}
+	case *register > 0:
+		if users, err = c.registerUsers(*register); err != nil {
+			fail("-register: %v", err)
+		}
+	default:
+		fail("give -tokens or -register")
+	}
+	if len(users) == 0 {
+		fail("no users to act as")
+	}
+
+	stats := make([]*opStats, *concurrency)
+	var sent atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(*duration)
+	for w := range stats {
+		st := newOpStats(len(ops))
+		stats[w] = st
+		wg.Add(1)
+		go func(seed uint64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(seed, uint64(time.Now().UnixNano())))
+			for time.Now().Before(deadline) {
+				if *requests > 0 && sent.Add(1) > *requests {
+					return
+				}
+				i := pick(ops, rng)
+				t := time.Now()
+				status, err := ops[i].do(c, users[rng.IntN(len(users))], rng)
+				st.record(i, status, err, time.Since(t))
+			}
+		}(uint64(w))
+	}
+	wg.Wait()
+
+	r := report(ops, stats, time.Since(start))
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+	} else {
+		r.print(os.Stdout)
+	}
+	if r.ErrorRate > *maxErrorRate {
+		fmt.Fprintf(os.Stderr, "loadtest: error rate %.2f%% is over %.2f%%\n", 100*r.ErrorRate, 100**maxErrorRate)
+		os.Exit(1)
+	}
+}
+
+// parseMix parses "complete=1,leaderboard=4" into the named operations
+// with those weights.
+func parseMix(s string, known map[string]func(*client, user, *rand.Rand) (int, error)) ([]op, error) {
+	var ops []op
+	for _, part := range strings.Split(s, ",") {
+		name, w, _ := strings.Cut(strings.TrimSpace(part), "=")
+		do, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown operation %q; want complete, leaderboard or status", name)
+		}
+		weight, err := strconv.Atoi(w)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%s: bad weight %q", name, w)
+		}
+		if weight > 0 {
+			ops = append(ops, op{name: name, weight: weight, do: do})
+		}
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("no operation has a weight")
+	}
+	return ops, nil
+}
+
+func pick(ops []op, rng *rand.Rand) int {
+	total := 0
+	for _, o := range ops {
+		total += o.weight
+	}
+	n := rng.IntN(total)
+	for i, o := range ops {
+		if n < o.weight {
+			return i
+		}
+		n -= o.weight
+	}
+	return len(ops) - 1
+}
+
+// loadTokens reads jwtgen's csv or json output.
+func loadTokens(path string) ([]user, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var users []user
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []struct {
+			ID    int64  `json:"id"`
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			users = append(users, user{ID: e.ID, Token: e.Token})
+		}
+		return users, nil
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		if i == 0 && row[0] == "id" {
+			continue
+		}
+		if len(row) != 2 {
+			return nil, fmt.Errorf("line %d: want id,token", i+1)
+		}
+		id, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad id %q", i+1, row[0])
+		}
+		users = append(users, user{ID: id, Token: row[1]})
+	}
+	return users, nil
+}
+
+// api is the prefix of the API version loadtest speaks.
+const api = "/v1"
+
+type client struct {
+	base string
+	http *http.Client
+}
+
+// do sends a request and drains the response, returning its status.
+func (c *client) do(method, path, token string, body any) (int, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.base+api+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// reading to the end lets the connection be reused
+	_, err = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, err
+}
+
+// registerUsers registers n users named after this run. Their access
+// tokens last as long as the server's access token TTL.
+func (c *client) registerUsers(n int) ([]user, error) {
+	run := strconv.FormatInt(time.Now().Unix(), 36)
+	users := make([]user, 0, n)
+	for i := 0; i < n; i++ {
+		body, _ := json.Marshal(map[string]string{"username": fmt.Sprintf("lt%s_%d", run, i), "password": "loadtest-password"})
+		resp, err := c.http.Post(c.base+api+"/auth/register", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			User  struct{ ID int64 }
+			Token string `json:"token"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			return nil, fmt.Errorf("register: %s", resp.Status)
+		}
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user{ID: out.User.ID, Token: out.Token})
+	}
+	return users, nil
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "loadtest: "+format+"\n", args...)
+	os.Exit(2)
+}
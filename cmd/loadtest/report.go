@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// opStats is what one worker saw, per operation. Workers don't share them,
+// so recording needs no lock.
+type opStats struct {
+	latencies [][]time.Duration
+	statuses  []map[int]int
+	// failed counts non-2xx responses and transport errors
+	failed    []int
+	transport []int
+}
+
+func newOpStats(n int) *opStats {
+	st := &opStats{
+		latencies: make([][]time.Duration, n), statuses: make([]map[int]int, n),
+		failed: make([]int, n), transport: make([]int, n),
+	}
+	for i := range st.statuses {
+		st.statuses[i] = map[int]int{}
+	}
+	return st
+}
+
+// record counts a request. Transport errors have status 0 and are left out
+// of the latencies.
+func (st *opStats) record(op, status int, err error, d time.Duration) {
+	if err != nil || status/100 != 2 {
+		st.failed[op]++
+	}
+	if status == 0 {
+		st.transport[op]++
+		return
+	}
+	st.latencies[op] = append(st.latencies[op], d)
+	st.statuses[op][status]++
+}
+
+type Report struct {
+	Elapsed   string     `json:"elapsed"`
+	Requests  int        `json:"requests"`
+	RPS       float64    `json:"rps"`
+	ErrorRate float64    `json:"error_rate"`
+	Ops       []OpReport `json:"ops"`
+}
+
+// OpReport is one operation's results. Latencies are in milliseconds and
+// count only requests that got a response.
+type OpReport struct {
+	Op       string         `json:"op"`
+	Requests int            `json:"requests"`
+	Errors   int            `json:"errors"`
+	RPS      float64        `json:"rps"`
+	Statuses map[string]int `json:"statuses"`
+	Mean     float64        `json:"mean_ms"`
+	P50      float64        `json:"p50_ms"`
+	P90      float64        `json:"p90_ms"`
+	P99      float64        `json:"p99_ms"`
+	Max      float64        `json:"max_ms"`
+}
+
+func report(ops []op, stats []*opStats, elapsed time.Duration) Report {
+	r := Report{Elapsed: elapsed.Round(time.Millisecond).String()}
+	errors := 0
+	for i, o := range ops {
+		or := OpReport{Op: o.name, Statuses: map[string]int{}}
+		var lat []time.Duration
+		for _, st := range stats {
+			lat = append(lat, st.latencies[i]...)
+			or.Errors += st.failed[i]
+			or.Requests += st.transport[i]
+			if st.transport[i] > 0 {
+				or.Statuses["transport_error"] += st.transport[i]
+			}
+			for status, n := range st.statuses[i] {
+				or.Statuses[strconv.Itoa(status)] += n
+			}
+		}
+		or.Requests += len(lat)
+		or.RPS = float64(or.Requests) / elapsed.Seconds()
+		if len(lat) > 0 {
+			sort.Slice(lat, func(a, b int) bool { return lat[a] < lat[b] })
+			var sum time.Duration
+			for _, d := range lat {
+				sum += d
+			}
+			or.Mean = ms(sum / time.Duration(len(lat)))
+			or.P50, or.P90, or.P99 = ms(percentile(lat, 50)), ms(percentile(lat, 90)), ms(percentile(lat, 99))
+			or.Max = ms(lat[len(lat)-1])
+		}
+		r.Requests += or.Requests
+		errors += or.Errors
+		r.Ops = append(r.Ops, or)
+	}
+	r.RPS = float64(r.Requests) / elapsed.Seconds()
+	if r.Requests > 0 {
+		r.ErrorRate = float64(errors) / float64(r.Requests)
+	}
+	return r
+}
+
+// percentile is the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r Report) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\trequests\treq/s\terrors\tmean\tp50\tp90\tp99\tmax\t")
+	for _, o := range r.Ops {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%.2fms\t%.2fms\t%.2fms\t%.2fms\t%.2fms\t\n",
+			o.Op, o.Requests, o.RPS, o.Errors, o.Mean, o.P50, o.P90, o.P99, o.Max)
+	}
+	tw.Flush()
+	for _, o := range r.Ops {
+		codes := make([]string, 0, len(o.Statuses))
+		for s := range o.Statuses {
+			codes = append(codes, s)
+		}
+		sort.Strings(codes)
+		fmt.Fprintf(w, "%s statuses:", o.Op)
+		for _, s := range codes {
+			fmt.Fprintf(w, " %s=%d", s, o.Statuses[s])
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d requests in %s, %.1f req/s, %.2f%% errors\n", r.Requests, r.Elapsed, r.RPS, 100*r.ErrorRate)
+}
@@ -7,4 +7,16 @@ require (
 	github.com/jackc/pgx/v5 v5.6.0
 	github.com/jackc/pgx/v5/stdlib v5.6.0
 	github.com/go-chi/chi/v5 v5.1.0
+	github.com/redis/go-redis/v9 v9.7.3
+	github.com/XSAM/otelsql v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
+	github.com/segmentio/kafka-go v0.4.47
+	github.com/nats-io/nats.go v1.37.0
+	modernc.org/sqlite v1.33.1
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.53.0
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+	golang.org/x/crypto v0.17.0
 )
@@ -0,0 +1,168 @@
+// Package app turns a config.Config into the service and HTTP API settings,
+// so cmd/server and the e2e tests wire them the same way.
+package app
+
+import (
+	"github.com/example/go-user-tasks/internal/breaker"
+	"github.com/example/go-user-tasks/internal/config"
+	"github.com/example/go-user-tasks/internal/health"
+	"github.com/example/go-user-tasks/internal/httpapi"
+	"github.com/example/go-user-tasks/internal/ratelimit"
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// ServiceDeps are what service.Config needs beyond the settings: clients
+// and connections the caller has built from them. Any may be left out.
+type ServiceDeps struct {
+	JWKS           service.KeySource
+	OAuthProviders map[string]service.OAuthProvider
+	Verifiers      map[string]service.Verifier
+	Channels       map[string]service.NotificationChannel
+	Cache          service.LeaderboardCache
+	Replica        repository.Queries
+}
+
+// ServiceConfig is the service.Config for cfg.
+func ServiceConfig(cfg config.Config, d ServiceDeps) service.Config {
+	jwtKeys := map[string][]byte{}
+	for kid, secret := range cfg.JWT.Keys {
+		jwtKeys[kid] = []byte(secret)
+	}
+	var partners []string
+	for name := range cfg.Callbacks.Partners {
+		partners = append(partners, name)
+	}
+	return service.Config{
+		JWTSecret:            []byte(cfg.JWT.Secret),
+		JWTKeys:              jwtKeys,
+		JWTKeyID:             cfg.JWT.KeyID,
+		JWTAcceptUnkeyed:     cfg.JWT.AcceptUnkeyed,
+		JWTAlgorithms:        cfg.JWT.Algorithms,
+		JWKS:                 d.JWKS,
+		JWTIssuer:            cfg.JWT.Issuer,
+		JWTAudience:          cfg.JWT.Audience,
+		JWTProvider:          cfg.JWT.Provider,
+		JWTRoleMap:           cfg.JWT.RoleMap,
+		AccessTokenTTL:       cfg.JWT.AccessTokenTTL,
+		RefreshTokenTTL:      cfg.JWT.RefreshTokenTTL,
+		OAuthProviders:       d.OAuthProviders,
+		OAuthRedirectBaseURL: cfg.OAuth.RedirectBaseURL,
+		ReceiptSecret:        []byte(cfg.Receipts.Secret),
+		Region:               cfg.Region.Name,
+		RefBonusToReferrer:   cfg.Referral.BonusReferrer,
+		RefBonusToReferred:   cfg.Referral.BonusReferred,
+		RefPayout: repository.ReferralMilestone{
+			Tasks:  cfg.Referral.PayoutTasks,
+			Points: cfg.Referral.PayoutPoints,
+		},
+		RefPayoutExpiry: cfg.Referral.PayoutExpiry,
+		RefCaps: service.ReferralCaps{
+			Daily:    cfg.Referral.CapDaily,
+			Monthly:  cfg.Referral.CapMonthly,
+			Lifetime: cfg.Referral.CapLifetime,
+		},
+		RefLandingURL:           cfg.Referral.LandingURL,
+		RefLinkBaseURL:          cfg.Referral.LinkBaseURL,
+		RefAttribution:          cfg.Referral.AttributionWindow,
+		TransferDailyCap:        cfg.Transfers.DailyCap,
+		IdempotencyTTL:          cfg.Idempotency.TTL,
+		IdempotencyLease:        2 * cfg.MaxDeadline(),
+		Cache:                   d.Cache,
+		StreakMultipliers:       cfg.Streak.Multipliers,
+		StreakMax:               cfg.Streak.Max,
+		LevelThresholds:         cfg.Levels.Thresholds,
+		LevelBonuses:            cfg.Levels.Bonuses,
+		LevelsEnabled:           cfg.Levels.Enabled,
+		CheckinRewards:          cfg.Checkin.Rewards,
+		PasswordResetTTL:        cfg.PasswordReset.TTL,
+		PasswordResetMaxPerHour: cfg.PasswordReset.MaxPerHour,
+		PasswordResetURL:        cfg.PasswordReset.URL,
+		Partners:                partners,
+		Verifiers:               d.Verifiers,
+		DeletionGrace:           cfg.Users.DeletionGrace,
+		StatusRecentTasks:       cfg.Users.StatusRecentTasks,
+		ExportAsyncThreshold:    cfg.Exports.AsyncThreshold,
+		ExportTTL:               cfg.Exports.TTL,
+		ExportCSVMaxRows:        cfg.Exports.CSVMaxRows,
+		TeamMaxMembers:          cfg.Teams.MaxMembers,
+		DefaultLocale:           cfg.Tasks.DefaultLocale,
+		Channels:                d.Channels,
+		NotifyRankTop:           cfg.Notifications.RankTop,
+		PrecomputedLeaderboards: cfg.Leaderboard.Precomputed,
+		DistributionRefresh:     cfg.Leaderboard.DistributionRefresh,
+		Replica:                 d.Replica,
+		ReplicaRetry:            cfg.DB.ReadRetry,
+		FlagDefaults:            cfg.Flags.Defaults,
+		FlagsRefresh:            cfg.Flags.Refresh,
+		Maintenance: service.Maintenance{
+			Enabled:    cfg.Maintenance.Enabled,
+			Message:    cfg.Maintenance.Message,
+			RetryAfter: int(cfg.Maintenance.RetryAfter.Seconds()),
+		},
+	}
+}
+
+// HTTPDeps are what httpapi.Config needs beyond the settings. Any may be
+// left out; without a Limiter there are no rate limits.
+type HTTPDeps struct {
+	Limiter     ratelimit.Limiter
+	Leaderboard *service.LeaderboardHub
+	Health      *health.Checker
+	Breakers    *breaker.Registry
+}
+
+// HTTPConfig is the httpapi.Config for cfg.
+func HTTPConfig(cfg config.Config, d HTTPDeps) httpapi.Config {
+	var compression httpapi.Compression
+	if cfg.Compression.Enabled {
+		compression = httpapi.Compression{MinSize: cfg.Compression.MinSize, ContentTypes: cfg.Compression.ContentTypes}
+	}
+	return httpapi.Config{
+		ReadDeadline:      cfg.HTTP.ReadDeadline,
+		WriteDeadline:     cfg.HTTP.WriteDeadline,
+		RouteDeadlines:    cfg.HTTP.RouteDeadlines,
+		MaxBodyBytes:      cfg.HTTP.MaxBodyBytes,
+		MaxJSONDepth:      cfg.HTTP.MaxJSONDepth,
+		LeaderboardMaxAge: cfg.HTTP.LeaderboardMaxAge,
+		StatusMaxAge:      cfg.HTTP.StatusMaxAge,
+		LegacyRoutes:      cfg.HTTP.LegacyRoutes,
+		AdminUI:           cfg.HTTP.AdminUI,
+		UserSearch:        cfg.Users.Search,
+		PublicRoutes:      cfg.HTTP.PublicRoutes,
+		LegacySunset:      cfg.LegacySunset(),
+		RegionURLs:        cfg.Region.URLs,
+		Limiter:           d.Limiter,
+		Leaderboard:       d.Leaderboard,
+		Health:            d.Health,
+		Breakers:          d.Breakers,
+		MaxRequests:       cfg.Breakers.MaxRequests,
+		CORS: httpapi.CORS{
+			AllowedOrigins:   cfg.CORS.AllowedOrigins,
+			AllowedMethods:   cfg.CORS.AllowedMethods,
+			AllowedHeaders:   cfg.CORS.AllowedHeaders,
+			ExposedHeaders:   cfg.CORS.ExposedHeaders,
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           cfg.CORS.MaxAge,
+		},
+		Compression:          compression,
+		TrustedProxies:       cfg.TrustedProxies(),
+		AdminAllowedNetworks: cfg.AdminAllowedNetworks(),
+		WidgetFrameAncestors: cfg.HTTP.WidgetFrameAncestors,
+		CallbackPartners:     cfg.Callbacks.Partners,
+		CallbackReplayWindow: cfg.Callbacks.ReplayWindow,
+		RateLimits: map[string]ratelimit.Policy{
+			"auth":   policy(cfg.RateLimit.Auth),
+			"read":   policy(cfg.RateLimit.Read),
+			"write":  policy(cfg.RateLimit.Write),
+			"public": policy(cfg.RateLimit.Public),
+		},
+	}
+}
+
+func policy(p config.RatePolicy) ratelimit.Policy {
+	return ratelimit.Policy{
+		User: ratelimit.Rule{Rate: p.User.PerSecond, Burst: p.User.Burst},
+		IP:   ratelimit.Rule{Rate: p.IP.PerSecond, Burst: p.IP.Burst},
+	}
+}
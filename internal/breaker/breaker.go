@@ -0,0 +1,207 @@
+// Package breaker guards calls to a dependency with a circuit breaker and a
+// cap on calls in flight, so a degraded database or endpoint gets fast
+// failures instead of a pile of requests waiting on it.
+package breaker
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOpen is returned instead of calling a dependency whose breaker is
+	// open.
+	ErrOpen = errors.New("circuit open")
+	// ErrFull is returned when MaxConcurrent calls are already in flight.
+	ErrFull = errors.New("too many calls in flight")
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Settings configure a Breaker. It opens after Failures failed calls in a
+// row and stays open for Cooldown, then lets one probe through: the
+// breaker closes if it succeeds and opens again if it fails. With
+// Failures 0 it never opens and only caps the calls in flight.
+type Settings struct {
+	Failures int
+	Cooldown time.Duration
+	// MaxConcurrent caps the calls in flight; 0 means no cap.
+	MaxConcurrent int
+	// IsFailure decides which errors count against the dependency, so a
+	// missing row or a rejected payload doesn't open it. Nil counts every
+	// error.
+	IsFailure func(error) bool
+}
+
+// Stats are a breaker's state and what it has counted since start.
+type Stats struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	InFlight int    `json:"in_flight"`
+	Calls    int64  `json:"calls"`
+	Failures int64  `json:"failures"`
+	// Rejected calls were refused while the breaker was open, Shed ones
+	// at MaxConcurrent.
+	Rejected int64 `json:"rejected"`
+	Shed     int64 `json:"shed"`
+	// Opened counts the times the breaker opened.
+	Opened    int64     `json:"opened"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type Breaker struct {
+	s   Settings
+	now func() time.Time
+
+	mu       sync.Mutex
+	stats    Stats
+	failRun  int  // failures in a row while closed
+	probing  bool // the half-open probe is in flight
+	openedAt time.Time
+}
+
+func New(name string, s Settings) *Breaker {
+	b := &Breaker{s: s, now: time.Now}
+	b.stats = Stats{Name: name, State: StateClosed, ChangedAt: b.now()}
+	return b
+}
+
+// Allow reserves a call, returning ErrOpen or ErrFull if it may not be
+// made. Otherwise done must be called with the call's error once it
+// returns.
+func (b *Breaker) Allow() (done func(error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.s.MaxConcurrent > 0 && b.stats.InFlight >= b.s.MaxConcurrent {
+		b.stats.Shed++
+		return nil, ErrFull
+	}
+	probe := false
+	switch b.stats.State {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.s.Cooldown {
+			b.stats.Rejected++
+			return nil, ErrOpen
+		}
+		b.setState(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probing {
+			b.stats.Rejected++
+			return nil, ErrOpen
+		}
+		b.probing, probe = true, true
+	}
+	b.stats.Calls++
+	b.stats.InFlight++
+	return func(err error) { b.done(probe, err) }, nil
+}
+
+// Do calls fn if the breaker allows it.
+func (b *Breaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+func (b *Breaker) done(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.InFlight--
+	failed := err != nil && (b.s.IsFailure == nil || b.s.IsFailure(err))
+	if failed {
+		b.stats.Failures++
+	}
+	switch {
+	case probe:
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.failRun = 0
+			b.setState(StateClosed)
+		}
+	case b.stats.State != StateClosed:
+		// admitted before the breaker opened; the probe decides
+	case failed:
+		b.failRun++
+		if b.s.Failures > 0 && b.failRun >= b.s.Failures {
+			b.open()
+		}
+	default:
+		b.failRun = 0
+	}
+}
+
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.stats.Opened++
+	b.setState(StateOpen)
+}
+
+func (b *Breaker) setState(state string) {
+	if b.stats.State == state {
+		return
+	}
+	log.Printf("breaker %s: %s", b.stats.Name, state)
+	b.stats.State, b.stats.ChangedAt = state, b.now()
+}
+
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// Registry holds breakers by name, so they can be listed together and
+// those for outbound hosts made as hosts are first called.
+type Registry struct {
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewRegistry() *Registry {
+	return &Registry{breakers: map[string]*Breaker{}}
+}
+
+// Get returns the breaker named name, making it with s if there is none.
+func (r *Registry) Get(name string, s Settings) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[name]
+	if !ok {
+		b = New(name, s)
+		r.breakers[name] = b
+	}
+	return b
+}
+
+// Stats lists every breaker's stats by name. A nil Registry has none.
+func (r *Registry) Stats() []Stats {
+	out := []Stats{}
+	if r == nil {
+		return out
+	}
+	r.mu.Lock()
+	list := make([]*Breaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		list = append(list, b)
+	}
+	r.mu.Unlock()
+	for _, b := range list {
+		out = append(out, b.Stats())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,47 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// errServerError counts a 5xx response against its host.
+var errServerError = errors.New("server error")
+
+// Transport sends requests through next with a breaker per host, named
+// "<prefix>:<host>" in reg, so one failing endpoint doesn't hold up
+// calls to the others. Errors and 5xx responses count as failures;
+// requests the caller cancelled don't.
+type Transport struct {
+	next     http.RoundTripper
+	reg      *Registry
+	prefix   string
+	settings Settings
+}
+
+func NewTransport(next http.RoundTripper, reg *Registry, prefix string, s Settings) *Transport {
+	if s.IsFailure == nil {
+		s.IsFailure = func(err error) bool { return !errors.Is(err, context.Canceled) }
+	}
+	return &Transport{next: next, reg: reg, prefix: prefix, settings: s}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.reg.Get(t.prefix+":"+req.URL.Host, t.settings)
+	done, err := b.Allow()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", req.URL.Host, err)
+	}
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		done(err)
+	case resp.StatusCode >= 500:
+		done(errServerError)
+	default:
+		done(nil)
+	}
+	return resp, err
+}
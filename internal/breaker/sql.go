@@ -0,0 +1,141 @@
+package breaker
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// Connector wraps c so that opening a connection, and every statement,
+// transaction and ping a pooled connection runs, goes through b. Commits,
+// rollbacks and reading rows are left alone: they finish work b already
+// let through.
+func Connector(c driver.Connector, b *Breaker) driver.Connector {
+	return &connector{c: c, b: b}
+}
+
+// DSNConnector is a driver.Connector for a driver that only opens DSNs, as
+// sql.Open would use it.
+func DSNConnector(d driver.Driver, dsn string) driver.Connector {
+	return dsnConnector{d: d, dsn: dsn}
+}
+
+type dsnConnector struct {
+	d   driver.Driver
+	dsn string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.d }
+
+type connector struct {
+	c driver.Connector
+	b *Breaker
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var dc driver.Conn
+	err := c.b.Do(func() error {
+		var err error
+		dc, err = c.c.Connect(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: dc, b: c.b}, nil
+}
+
+func (c *connector) Driver() driver.Driver { return c.c.Driver() }
+
+// conn passes the optional driver interfaces through to the wrapped
+// connection, reporting driver.ErrSkip where database/sql has a fallback.
+type conn struct {
+	driver.Conn
+	b *Breaker
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var st driver.Stmt
+	err := c.b.Do(func() error {
+		var err error
+		if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+			st, err = p.PrepareContext(ctx, query)
+		} else {
+			st, err = c.Conn.Prepare(query)
+		}
+		return err
+	})
+	return st, err
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	err := c.b.Do(func() error {
+		var err error
+		if bt, ok := c.Conn.(driver.ConnBeginTx); ok {
+			tx, err = bt.BeginTx(ctx, opts)
+		} else {
+			// drivers without BeginTx
+			tx, err = c.Conn.Begin()
+		}
+		return err
+	})
+	return tx, err
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	var res driver.Result
+	err := c.b.Do(func() error {
+		var err error
+		res, err = e.ExecContext(ctx, query, args)
+		return err
+	})
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	var rows driver.Rows
+	err := c.b.Do(func() error {
+		var err error
+		rows, err = q.QueryContext(ctx, query, args)
+		return err
+	})
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	p, ok := c.Conn.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+	return c.b.Do(func() error { return p.Ping(ctx) })
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,63 @@
+// Package broker publishes outbox events to a message broker (Kafka or
+// NATS) for downstream consumers.
+package broker
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// Kafka writes every event to one topic as JSON, keyed by event id, with
+// the type in an "event-type" header so consumers can filter without
+// decoding.
+type Kafka struct {
+	w       *kafka.Writer
+	brokers []string
+	topic   string
+}
+
+func NewKafka(brokers []string, topic string) *Kafka {
+	return &Kafka{brokers: brokers, topic: topic, w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+// Ping succeeds when one of the brokers answers and knows the topic.
+func (k *Kafka) Ping(ctx context.Context) error {
+	var err error
+	for _, addr := range k.brokers {
+		var conn *kafka.Conn
+		if conn, err = kafka.DialContext(ctx, "tcp", addr); err != nil {
+			continue
+		}
+		if d, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(d)
+		}
+		_, err = conn.ReadPartitions(k.topic)
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (k *Kafka) Publish(ctx context.Context, ev service.Event) error {
+	payload, err := ev.JSON()
+	if err != nil {
+		return err
+	}
+	return k.w.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(ev.ID),
+		Value:   payload,
+		Headers: []kafka.Header{{Key: "event-type", Value: []byte(ev.Type)}},
+	})
+}
+
+func (k *Kafka) Close() error { return k.w.Close() }
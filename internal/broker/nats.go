@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// NATS publishes each event on "<prefix>.<type>", e.g.
+// "user-tasks.task.completed". The Nats-Msg-Id header carries the event id
+// so a JetStream stream on those subjects drops republished duplicates.
+type NATS struct {
+	nc     *nats.Conn
+	prefix string
+}
+
+func NewNATS(url, prefix string) (*NATS, error) {
+	nc, err := nats.Connect(url, nats.Name("go-user-tasks"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATS{nc: nc, prefix: prefix}, nil
+}
+
+// Ping makes a round trip to the server.
+func (n *NATS) Ping(ctx context.Context) error {
+	return n.nc.FlushWithContext(ctx)
+}
+
+func (n *NATS) Publish(ctx context.Context, ev service.Event) error {
+	payload, err := ev.JSON()
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(n.prefix + "." + ev.Type)
+	msg.Header.Set(nats.MsgIdHdr, ev.ID)
+	msg.Data = payload
+	if err := n.nc.PublishMsg(msg); err != nil {
+		return err
+	}
+	// core NATS doesn't ack; a flush at least confirms the server got it
+	return n.nc.FlushWithContext(ctx)
+}
+
+// Subscribe hands p every event of the given type published by any
+// instance. Delivery is at most once: events sent while disconnected are
+// missed.
+func (n *NATS) Subscribe(eventType string, p service.Publisher) error {
+	_, err := n.nc.Subscribe(n.prefix+"."+eventType, func(m *nats.Msg) {
+		var ev service.Event
+		if err := json.Unmarshal(m.Data, &ev); err != nil {
+			log.Printf("nats: bad event on %s: %v", m.Subject, err)
+			return
+		}
+		if err := p.Publish(context.Background(), ev); err != nil {
+			log.Printf("nats: handle %s: %v", ev.ID, err)
+		}
+	})
+	return err
+}
+
+func (n *NATS) Close() error {
+	n.nc.Close()
+	return nil
+}
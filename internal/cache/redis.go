@@ -0,0 +1,200 @@
+// Package cache mirrors the lifetime leaderboard into a Redis sorted set so
+// top-N reads don't hit Postgres. Postgres stays the source of truth: entries
+// are written through after each award and the whole set is rebuilt
+// periodically.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+const (
+	boardKey   = "leaderboard:all"
+	rebuildKey = "leaderboard:all:rebuild"
+	namesKey   = "leaderboard:names"
+	// anonKey holds the ids of users listed as anonymous.
+	anonKey        = "leaderboard:anonymous"
+	anonRebuildKey = "leaderboard:anonymous:rebuild"
+	// readyKey is set once a full rebuild has landed; until then the sorted
+	// set may only hold written-through entries and is not served.
+	readyKey = "leaderboard:ready"
+
+	writeChunk = 1000
+)
+
+type RedisLeaderboard struct {
+	rdb *redis.Client
+}
+
+func NewRedisLeaderboard(rdb *redis.Client) *RedisLeaderboard {
+	return &RedisLeaderboard{rdb: rdb}
+}
+
+// member orders ties by id ascending: ZREVRANGE sorts equal scores by member
+// descending, so ids are stored inverted and zero-padded.
+func member(id int64) string {
+	return fmt.Sprintf("%019d", math.MaxInt64-id)
+}
+
+func memberID(m string) (int64, error) {
+	inv, err := strconv.ParseInt(m, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return math.MaxInt64 - inv, nil
+}
+
+// Top returns the first limit entries and the number of ranked users. ok is
+// false until the cache has been rebuilt from Postgres at least once.
+func (c *RedisLeaderboard) Top(ctx context.Context, limit int) ([]repository.LeaderboardEntry, int64, bool, error) {
+	var (
+		ready *redis.IntCmd
+		total *redis.IntCmd
+		top   *redis.ZSliceCmd
+	)
+	_, err := c.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		ready = p.Exists(ctx, readyKey)
+		total = p.ZCard(ctx, boardKey)
+		top = p.ZRevRangeWithScores(ctx, boardKey, 0, int64(limit-1))
+		return nil
+	})
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if ready.Val() == 0 {
+		return nil, 0, false, nil
+	}
+
+	zs := top.Val()
+	items := make([]repository.LeaderboardEntry, len(zs))
+	ids := make([]string, len(zs))
+	for i, z := range zs {
+		id, err := memberID(z.Member.(string))
+		if err != nil {
+			return nil, 0, false, err
+		}
+		items[i] = repository.LeaderboardEntry{ID: id, Points: int64(z.Score), Rank: i + 1}
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	if len(ids) > 0 {
+		var (
+			names *redis.SliceCmd
+			anon  *redis.BoolSliceCmd
+		)
+		_, err := c.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			names = p.HMGet(ctx, namesKey, ids...)
+			members := make([]any, len(ids))
+			for i, id := range ids {
+				members[i] = id
+			}
+			anon = p.SMIsMember(ctx, anonKey, members...)
+			return nil
+		})
+		if err != nil {
+			return nil, 0, false, err
+		}
+		for i, a := range anon.Val() {
+			items[i].Anonymous = a
+		}
+		for i, n := range names.Val() {
+			s, ok := n.(string)
+			if !ok {
+				// written-through score without a name; let Postgres answer
+				return nil, 0, false, nil
+			}
+			items[i].Username = s
+		}
+	}
+	return items, total.Val(), true, nil
+}
+
+// Set upserts entries with their current lifetime points.
+func (c *RedisLeaderboard) Set(ctx context.Context, entries ...repository.LeaderboardEntry) error {
+	_, err := c.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, e := range entries {
+			id := strconv.FormatInt(e.ID, 10)
+			p.ZAdd(ctx, boardKey, redis.Z{Score: float64(e.Points), Member: member(e.ID)})
+			p.HSet(ctx, namesKey, id, e.Username)
+			if e.Anonymous {
+				p.SAdd(ctx, anonKey, id)
+			} else {
+				p.SRem(ctx, anonKey, id)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Remove drops users from the ranking.
+func (c *RedisLeaderboard) Remove(ctx context.Context, userIDs ...int64) error {
+	_, err := c.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, id := range userIDs {
+			p.ZRem(ctx, boardKey, member(id))
+			p.HDel(ctx, namesKey, strconv.FormatInt(id, 10))
+			p.SRem(ctx, anonKey, strconv.FormatInt(id, 10))
+		}
+		return nil
+	})
+	return err
+}
+
+// Replace swaps in a full ranking read from Postgres and marks the cache
+// ready.
+func (c *RedisLeaderboard) Replace(ctx context.Context, entries []repository.LeaderboardEntry) error {
+	if err := c.rdb.Del(ctx, rebuildKey, anonRebuildKey).Err(); err != nil {
+		return err
+	}
+	empty := len(entries) == 0
+	anyAnon := false
+	for len(entries) > 0 {
+		n := min(len(entries), writeChunk)
+		chunk := entries[:n]
+		entries = entries[n:]
+		_, err := c.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			zs := make([]redis.Z, len(chunk))
+			names := make([]any, 0, 2*len(chunk))
+			var anon []any
+			for i, e := range chunk {
+				zs[i] = redis.Z{Score: float64(e.Points), Member: member(e.ID)}
+				names = append(names, strconv.FormatInt(e.ID, 10), e.Username)
+				if e.Anonymous {
+					anon = append(anon, strconv.FormatInt(e.ID, 10))
+				}
+			}
+			p.ZAdd(ctx, rebuildKey, zs...)
+			p.HSet(ctx, namesKey, names...)
+			if len(anon) > 0 {
+				anyAnon = true
+				p.SAdd(ctx, anonRebuildKey, anon...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := c.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if empty {
+			p.Del(ctx, boardKey)
+		} else {
+			p.Rename(ctx, rebuildKey, boardKey)
+		}
+		if anyAnon {
+			p.Rename(ctx, anonRebuildKey, anonKey)
+		} else {
+			p.Del(ctx, anonKey)
+		}
+		p.Set(ctx, readyKey, 1, 0)
+		return nil
+	})
+	return err
+}
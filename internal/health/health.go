@@ -0,0 +1,80 @@
+// Package health runs the dependency checks behind the readiness probe.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Check reports whether one dependency is usable.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is StatusOK when every check passed.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// New returns a Checker that gives every check up to timeout.
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+func (c *Checker) Add(name string, run func(ctx context.Context) error) {
+	c.checks = append(c.checks, Check{Name: name, Run: run})
+}
+
+// Check runs the checks concurrently. A nil Checker has none and is always
+// ready.
+func (c *Checker) Check(ctx context.Context) Report {
+	rep := Report{Status: StatusOK, Checks: map[string]CheckResult{}}
+	if c == nil {
+		return rep
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func(ch Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := ch.Run(ctx)
+			res := CheckResult{Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				res.Status, res.Error = StatusError, err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			rep.Checks[ch.Name] = res
+			if err != nil {
+				rep.Status = StatusError
+			}
+		}(ch)
+	}
+	wg.Wait()
+	return rep
+}
@@ -0,0 +1,200 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+type BanReq struct {
+	Reason string `json:"reason"`
+}
+
+type MergeUsersReq struct {
+	DuplicateID int64 `json:"duplicate_id"`
+}
+
+// AdminSearchUsers lists users newest first, filtered by username_prefix,
+// min_points, an RFC 3339 created_after and status. Page with
+// ?before=<next_before>.
+func (h *Handler) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := repository.UserFilter{UsernamePrefix: q.Get("username_prefix"), Limit: 50}
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			f.Limit = n
+		}
+	}
+	if v := q.Get("min_points"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "invalid min_points")
+			return
+		}
+		f.MinPoints = &n
+	}
+	if v := q.Get("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "invalid created_after")
+			return
+		}
+		f.CreatedAfter = &t
+	}
+	switch v := q.Get("status"); v {
+	case "", repository.UserActive, repository.UserSuspended, repository.UserBanned:
+		f.Status = v
+	default:
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid status")
+		return
+	}
+	if v := q.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad before cursor")
+			return
+		}
+		f.Before = n
+	}
+
+	users, err := h.svc.SearchUsers(r.Context(), f)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"users": users, "next_before": nil}
+	if len(users) == f.Limit {
+		resp["next_before"] = users[len(users)-1].ID
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func (h *Handler) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	d, err := h.svc.UserDetails(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, d, http.StatusOK)
+}
+
+func (h *Handler) AdminUserLedger(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	h.writePointsHistory(w, r, id)
+}
+
+func (h *Handler) AdminSetUserStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var in service.StatusInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	h.setUserStatus(w, r, id, in)
+}
+
+// AdminBanUser and AdminUnbanUser are shorthands for setting the status to
+// banned and active.
+func (h *Handler) AdminBanUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req BanReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	h.setUserStatus(w, r, id, service.StatusInput{Status: repository.UserBanned, Reason: req.Reason})
+}
+
+func (h *Handler) AdminUnbanUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	h.setUserStatus(w, r, id, service.StatusInput{Status: repository.UserActive})
+}
+
+func (h *Handler) setUserStatus(w http.ResponseWriter, r *http.Request, id int64, in service.StatusInput) {
+	u, err := h.svc.SetUserStatus(r.Context(), id, in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"user": u}, http.StatusOK)
+}
+
+func (h *Handler) AdminResetReferrer(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	u, err := h.svc.ResetReferrer(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"user": u}, http.StatusOK)
+}
+
+func (h *Handler) AdminRevokeTask(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	rev, err := h.svc.RevokeTask(r.Context(), id, chi.URLParam(r, "code"), r.URL.Query().Get("reason"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rev, http.StatusOK)
+}
+
+func (h *Handler) AdminUserDuplicates(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	dups, err := h.svc.DuplicateUsers(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"duplicates": dups}, http.StatusOK)
+}
+
+// AdminMergeUsers merges the user duplicate_id into {id}, which is kept.
+func (h *Handler) AdminMergeUsers(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req MergeUsersReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.DuplicateID <= 0 {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "duplicate_id is required")
+		return
+	}
+	m, err := h.svc.MergeUsers(r.Context(), id, req.DuplicateID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, m, http.StatusOK)
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// AdminAuditEvents lists audit events newest first, filtered by actor_id,
+// action, target_type, target_id and an RFC 3339 since/until range. Page
+// with ?before=<next_before>.
+func (h *Handler) AdminAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := repository.AuditFilter{
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Limit:      50,
+	}
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			f.Limit = n
+		}
+	}
+	if v := q.Get("actor_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "invalid actor_id")
+			return
+		}
+		f.ActorID = &n
+	}
+	if v := q.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad before cursor")
+			return
+		}
+		f.Before = n
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "invalid "+p.name)
+			return
+		}
+		*p.dst = &t
+	}
+
+	events, err := h.svc.AuditEvents(r.Context(), f)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"events": events, "next_before": nil}
+	if len(events) == f.Limit {
+		resp["next_before"] = events[len(events)-1].ID
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
@@ -0,0 +1,148 @@
+package httpapi
+
+import (
+	"net/http"
+)
+
+type CredentialsReq struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RegisterReq is CredentialsReq with the token a referral link handed out,
+// for clients that can't rely on its cookie.
+type RegisterReq struct {
+	CredentialsReq
+	ReferralToken string `json:"referral_token,omitempty"`
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ForgotPasswordReq struct {
+	Username string `json:"username"`
+}
+
+// ResetPasswordReq sets a new password with the token emailed by
+// /auth/forgot-password.
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var req RegisterReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	u, pair, err := h.svc.Register(r.Context(), req.Username, req.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if id := h.svc.AttributeSignup(r.Context(), u.ID, referralToken(w, r, req.ReferralToken)); id != 0 {
+		u.ReferrerID = &id
+	}
+	jsonWrite(w, map[string]any{
+		"user":          u,
+		"token":         pair.Token,
+		"refresh_token": pair.RefreshToken,
+		"expires_in":    pair.ExpiresIn,
+	}, http.StatusCreated)
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req CredentialsReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+
+	id, pair, err := h.svc.Login(r.Context(), req.Username, req.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{
+		"user_id":       id,
+		"token":         pair.Token,
+		"refresh_token": pair.RefreshToken,
+		"expires_in":    pair.ExpiresIn,
+	}, http.StatusOK)
+}
+
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+
+	pair, err := h.svc.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{
+		"token":         pair.Token,
+		"refresh_token": pair.RefreshToken,
+		"expires_in":    pair.ExpiresIn,
+	}, http.StatusOK)
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+	if err := h.svc.Logout(r.Context(), req.RefreshToken); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Username == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+	if err := h.svc.ForgotPassword(r.Context(), req.Username); err != nil {
+		writeError(w, err)
+		return
+	}
+	// the same whether or not anything was sent
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Token == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+	if err := h.svc.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+func (h *Handler) AdminListAwardRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.svc.AwardRules(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"rules": rules}, http.StatusOK)
+}
+
+func (h *Handler) AdminGetAwardRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "rule_id")
+	if !ok {
+		return
+	}
+	rule, err := h.svc.AwardRule(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rule, http.StatusOK)
+}
+
+func (h *Handler) AdminCreateAwardRule(w http.ResponseWriter, r *http.Request) {
+	var in service.AwardRuleInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	rule, err := h.svc.CreateAwardRule(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rule, http.StatusCreated)
+}
+
+func (h *Handler) AdminUpdateAwardRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "rule_id")
+	if !ok {
+		return
+	}
+	var in service.AwardRuleInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	rule, err := h.svc.UpdateAwardRule(r.Context(), id, in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rule, http.StatusOK)
+}
+
+func (h *Handler) AdminDeleteAwardRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "rule_id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteAwardRule(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
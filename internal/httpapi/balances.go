@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) AdminDiscrepancies(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+	var after int64
+	if v := q.Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad after cursor")
+			return
+		}
+		after = n
+	}
+	items, err := h.svc.Discrepancies(r.Context(), after, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"discrepancies": items, "next_after": nil}
+	if len(items) == limit {
+		resp["next_after"] = items[len(items)-1].UserID
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func (h *Handler) AdminFixBalance(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "user_id")
+	if !ok {
+		return
+	}
+	fix, err := h.svc.FixBalance(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, fix, http.StatusOK)
+}
+
+type AdjustPointsReq struct {
+	// Delta is added to the balance; negative debits it.
+	Delta  int64  `json:"delta"`
+	Reason string `json:"reason"`
+	// Version, if set, is the user's version from GET /admin/users/{id};
+	// 409 if they have changed since.
+	Version *int64 `json:"version"`
+}
+
+func (h *Handler) AdminAdjustPoints(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req AdjustPointsReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	adj, err := h.svc.AdjustPoints(r.Context(), id, req.Delta, req.Reason, req.Version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, adj, http.StatusOK)
+}
@@ -0,0 +1,18 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/example/go-user-tasks/internal/breaker"
+)
+
+type BreakersResp struct {
+	Breakers []breaker.Stats `json:"breakers"`
+}
+
+// AdminBreakers lists this instance's circuit breakers. It takes no
+// in-flight slot and makes no database call, so it answers while they are
+// shedding.
+func (h *Handler) AdminBreakers(w http.ResponseWriter, r *http.Request) {
+	jsonWrite(w, BreakersResp{Breakers: h.cfg.Breakers.Stats()}, http.StatusOK)
+}
@@ -0,0 +1,157 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+type PartnerCompleteReq struct {
+	// ExternalUserID is the user's account id at the partner.
+	ExternalUserID string `json:"external_user_id"`
+	Task           string `json:"task"`
+	// Reference is the partner's id for the completion; retries reuse it.
+	Reference string `json:"reference"`
+}
+
+type ctxKeyPartner struct{}
+
+// partnerFrom returns the partner verifyPartner admitted the request from.
+func partnerFrom(ctx context.Context) string {
+	p, _ := ctx.Value(ctxKeyPartner{}).(string)
+	return p
+}
+
+// verifyPartner admits /callbacks requests from the partners in
+// CallbackPartners, signed the way our own webhooks are:
+//
+//	X-Callback-Partner: <name>
+//	X-Callback-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of "t.body">
+//
+// with the partner's secret. The timestamp must be within
+// CallbackReplayWindow of now, and a signature is accepted once, so a
+// captured request can't be sent again.
+func (h *Handler) verifyPartner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		partner := r.Header.Get("X-Callback-Partner")
+		secret, ok := h.cfg.CallbackPartners[partner]
+		if partner == "" || !ok {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "unknown partner")
+			return
+		}
+		ts, sig, ok := parseSignature(r.Header.Get("X-Callback-Signature"))
+		if !ok {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "missing or malformed signature")
+			return
+		}
+		at := time.Unix(ts, 0)
+		if d := time.Since(at); d > h.cfg.CallbackReplayWindow || -d > h.cfg.CallbackReplayWindow {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "signature timestamp outside the replay window")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			readError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+		mac.Write(body)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "bad signature")
+			return
+		}
+		fresh, err := h.svc.ClaimCallbackSignature(r.Context(), partner, hex.EncodeToString(sig), at.Add(h.cfg.CallbackReplayWindow))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !fresh {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "signature already used")
+			return
+		}
+		ctx := context.WithValue(r.Context(), ctxKeyPartner{}, partner)
+		ctx = service.WithActor(ctx, service.Actor{IP: clientIP(r), RequestID: middleware.GetReqID(ctx)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// PartnerCompleteTask completes a task for the user linked to the
+// partner's account, forwarding to the user's home region like
+// RouteToHomeRegion does; the body is restored for that. A forwarded request
+// names the user by X-Forwarded-User, as the link was resolved in the region
+// that forwarded it.
+func (h *Handler) PartnerCompleteTask(w http.ResponseWriter, r *http.Request) {
+	var req PartnerCompleteReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.ExternalUserID == "" || req.Task == "" || req.Reference == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+	partner := partnerFrom(r.Context())
+	var id int64
+	var err error
+	if fwd := r.Header.Get("X-Forwarded-User"); fwd != "" {
+		if id, err = h.svc.ParseForwardToken(fwd); err != nil {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "invalid X-Forwarded-User")
+			return
+		}
+	} else if id, err = h.svc.PartnerUser(r.Context(), partner, req.ExternalUserID); err != nil {
+		writeError(w, err)
+		return
+	}
+	r.Body, _ = r.GetBody()
+	if h.forwardToHome(w, r, id) {
+		return
+	}
+	if err := h.svc.CheckActive(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	res, err := h.svc.CompletePartnerTask(r.Context(), partner, req.Reference, id, req.Task)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, status := completionResp(res)
+	resp["user_id"] = id
+	jsonWrite(w, resp, status)
+}
+
+// parseSignature splits "t=<unix seconds>,v1=<hex>" into its parts.
+func parseSignature(header string) (ts int64, sig []byte, ok bool) {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			v1 = v
+		}
+	}
+	ts, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+	sig, err = hex.DecodeString(v1)
+	if err != nil || len(sig) != sha256.Size {
+		return 0, nil, false
+	}
+	return ts, sig, true
+}
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// sign is the X-Callback-Signature a partner sends for body at ts.
+func sign(secret string, ts time.Time, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10) + "." + body))
+	return fmt.Sprintf("t=%d,v1=%s", ts.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifyPartner(t *testing.T) {
+	svc := service.New(repository.NewMemory("local"), service.Config{Region: "local"})
+	h, err := New(svc, Config{
+		CallbackPartners:     map[string]string{"acme": "acme-secret"},
+		CallbackReplayWindow: 5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var admitted string
+	handler := h.verifyPartner(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admitted = partnerFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	const body = `{"external_user_id":"u1","task":"subscribe_telegram","reference":"r1"}`
+	now := time.Now()
+	replayed := sign("acme-secret", now.Add(-time.Second), body)
+	for _, c := range []struct {
+		name      string
+		partner   string
+		signature string
+		body      string
+		want      int
+	}{
+		{"valid", "acme", sign("acme-secret", now, body), body, http.StatusNoContent},
+		{"unknown partner", "other", sign("acme-secret", now, body), body, http.StatusUnauthorized},
+		{"bad signature", "acme", sign("wrong-secret", now, body), body, http.StatusUnauthorized},
+		{"body changed", "acme", sign("acme-secret", now, body), strings.Replace(body, "u1", "u2", 1), http.StatusUnauthorized},
+		{"malformed", "acme", "v1=abc", body, http.StatusUnauthorized},
+		{"stale timestamp", "acme", sign("acme-secret", now.Add(-10*time.Minute), body), body, http.StatusUnauthorized},
+		{"future timestamp", "acme", sign("acme-secret", now.Add(10*time.Minute), body), body, http.StatusUnauthorized},
+		{"first use", "acme", replayed, body, http.StatusNoContent},
+		{"replayed", "acme", replayed, body, http.StatusUnauthorized},
+	} {
+		admitted = ""
+		r := httptest.NewRequest(http.MethodPost, "/callbacks/tasks/complete", strings.NewReader(c.body))
+		r.Header.Set("X-Callback-Partner", c.partner)
+		r.Header.Set("X-Callback-Signature", c.signature)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("%s: status %d, want %d: %s", c.name, w.Code, c.want, w.Body)
+		}
+		if ok := c.want == http.StatusNoContent; ok != (admitted == "acme") {
+			t.Errorf("%s: admitted partner %q", c.name, admitted)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// ListCampaigns lists the campaigns running or yet to start.
+func (h *Handler) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.svc.CurrentCampaigns(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"campaigns": campaigns}, http.StatusOK)
+}
+
+func (h *Handler) AdminListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.svc.Campaigns(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"campaigns": campaigns}, http.StatusOK)
+}
+
+func (h *Handler) AdminGetCampaign(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "campaign_id")
+	if !ok {
+		return
+	}
+	c, err := h.svc.Campaign(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, c, http.StatusOK)
+}
+
+func (h *Handler) AdminCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var in service.CampaignInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	c, err := h.svc.CreateCampaign(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, c, http.StatusCreated)
+}
+
+func (h *Handler) AdminUpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "campaign_id")
+	if !ok {
+		return
+	}
+	var in service.CampaignInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	c, err := h.svc.UpdateCampaign(r.Context(), id, in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, c, http.StatusOK)
+}
+
+func (h *Handler) AdminDeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "campaign_id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteCampaign(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminCampaignReport reports what a campaign has added so far, overall
+// and per task.
+func (h *Handler) AdminCampaignReport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "campaign_id")
+	if !ok {
+		return
+	}
+	rep, err := h.svc.CampaignReport(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rep, http.StatusOK)
+}
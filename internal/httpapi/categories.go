@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+func (h *Handler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	cats, err := h.svc.Categories(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"categories": cats}, http.StatusOK)
+}
+
+func (h *Handler) AdminCreateCategory(w http.ResponseWriter, r *http.Request) {
+	var in service.CategoryInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	c, err := h.svc.CreateCategory(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, c, http.StatusCreated)
+}
+
+func (h *Handler) AdminUpdateCategory(w http.ResponseWriter, r *http.Request) {
+	var in service.CategoryInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	c, err := h.svc.UpdateCategory(r.Context(), chi.URLParam(r, "code"), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, c, http.StatusOK)
+}
+
+func (h *Handler) AdminDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteCategory(r.Context(), chi.URLParam(r, "code")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,233 @@
+package httpapi
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compression gzips or deflates responses of ContentTypes for clients that
+// accept it, once the body reaches MinSize bytes; smaller bodies aren't
+// worth it. A content type is exact ("application/json") or a wildcard
+// subtype ("text/*"). No ContentTypes turns compression off.
+type Compression struct {
+	MinSize      int
+	ContentTypes []string
+}
+
+func (c Compression) compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range c.ContentTypes {
+		t = strings.ToLower(t)
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	gzipWriters  = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	}}
+)
+
+// compressWriter is what both encoders have in common.
+type compressWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+	Flush() error
+}
+
+// compress picks gzip or deflate from Accept-Encoding and holds back the
+// first MinSize bytes of the body to decide whether to use it. A response
+// that already has a Content-Encoding, like one proxied from another
+// region, is left alone. Compressing weakens an ETag, since the bytes on
+// the wire are no longer the ones it was computed from.
+func (h *Handler) compress(next http.Handler) http.Handler {
+	c := h.cfg.Compression
+	if len(c.ContentTypes) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressingWriter{ResponseWriter: w, cfg: c, encoding: encoding, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding is "gzip", "deflate" or "" for header, preferring gzip
+// when the client takes both. q=0 refuses an encoding; "*" stands for any
+// not listed.
+func acceptedEncoding(header string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range []string{"gzip", "deflate"} {
+		weight, ok := q[enc]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+// compressingWriter buffers the body until it has MinSize bytes, the
+// handler flushes or the handler returns, then either starts encoding or
+// writes the body as it is.
+type compressingWriter struct {
+	http.ResponseWriter
+	cfg      Compression
+	encoding string
+	status   int
+
+	wroteHeader bool // WriteHeader was called
+	decided     bool // the header has gone out
+	buf         []byte
+	enc         compressWriter
+}
+
+func (cw *compressingWriter) WriteHeader(status int) {
+	if cw.wroteHeader || cw.decided {
+		return
+	}
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.start(false)
+	}
+}
+
+func (cw *compressingWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.cfg.MinSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start sends the header, encoded when the buffered body is big enough
+// and of a listed type, and then the buffered body.
+func (cw *compressingWriter) start(bigEnough bool) error {
+	cw.decided = true
+	hdr := cw.Header()
+	if hdr.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		// sniff now; net/http would otherwise sniff the encoded bytes
+		hdr.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if hdr.Get("Content-Encoding") == "" && cw.cfg.compressible(hdr.Get("Content-Type")) {
+		hdr.Add("Vary", "Accept-Encoding")
+		if bigEnough && len(cw.buf) > 0 {
+			hdr.Set("Content-Encoding", cw.encoding)
+			hdr.Del("Content-Length")
+			if etag := hdr.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				hdr.Set("ETag", "W/"+etag)
+			}
+			if cw.encoding == "gzip" {
+				cw.enc = gzipWriters.Get().(*gzip.Writer)
+			} else {
+				cw.enc = flateWriters.Get().(*flate.Writer)
+			}
+			cw.enc.Reset(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush lets streaming handlers push what they have: anything buffered
+// goes out, encoded if it is already big enough.
+func (cw *compressingWriter) Flush() {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			cw.WriteHeader(http.StatusOK)
+		}
+		cw.start(len(cw.buf) >= cw.cfg.MinSize)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close sends whatever is still buffered once the handler returns and
+// ends the encoded stream.
+func (cw *compressingWriter) close() {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			// the handler wrote nothing; leave the default response alone
+			return
+		}
+		cw.start(false)
+	}
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	switch enc := cw.enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	case *flate.Writer:
+		flateWriters.Put(enc)
+	}
+	cw.enc = nil
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS lets browser apps on AllowedOrigins call the API. An origin is
+// exact ("https://app.example.com"), a subdomain wildcard
+// ("https://*.example.com") or "*". A "*" in AllowedHeaders allows whatever
+// a preflight asks for. No AllowedOrigins turns CORS off.
+type CORS struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer.
+	MaxAge time.Duration
+}
+
+func (c CORS) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, o := range c.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" || o == origin {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(o, "*"); ok &&
+			len(origin) > len(scheme)+len(domain) &&
+			strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// cors answers preflight requests itself, before routing, authentication
+// and rate limits; other requests from allowed origins get the headers
+// browsers need to hand the response to the page. Requests from other
+// origins pass through without them, so browsers block the response.
+func (h *Handler) cors(next http.Handler) http.Handler {
+	c := h.cfg.CORS
+	if len(c.AllowedOrigins) == 0 {
+		return next
+	}
+	anyOrigin := slices.Contains(c.AllowedOrigins, "*") && !c.AllowCredentials
+	anyHeader := slices.Contains(c.AllowedHeaders, "*")
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(c.ExposedHeaders, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		hdr := w.Header()
+		hdr.Add("Vary", "Origin")
+		if preflight {
+			hdr.Add("Vary", "Access-Control-Request-Method")
+			hdr.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" || !c.allowOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if anyOrigin {
+			hdr.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			hdr.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			hdr.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposed != "" {
+				hdr.Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !slices.Contains(c.AllowedMethods, strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))) {
+			// without the allow headers the browser refuses the request
+			hdr.Del("Access-Control-Allow-Origin")
+			hdr.Del("Access-Control-Allow-Credentials")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		hdr.Set("Access-Control-Allow-Methods", methods)
+		// "*" in Access-Control-Allow-Headers never covers Authorization,
+		// so a wildcard echoes the requested headers instead
+		if anyHeader {
+			if req := r.Header.Get("Access-Control-Request-Headers"); req != "" {
+				hdr.Set("Access-Control-Allow-Headers", req)
+			}
+		} else if headers != "" {
+			hdr.Set("Access-Control-Allow-Headers", headers)
+		}
+		if c.MaxAge > 0 {
+			hdr.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
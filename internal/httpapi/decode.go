@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// limitBody caps request bodies at Config.MaxBodyBytes: one declared
+// larger is refused up front, and reading past the cap fails with an
+// *http.MaxBytesError that readError turns into a 413.
+func (h *Handler) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.cfg.MaxBodyBytes <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > h.cfg.MaxBodyBytes {
+			tooLarge(w, h.cfg.MaxBodyBytes)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooLarge(w http.ResponseWriter, limit int64) {
+	httpError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("request body is larger than %d bytes", limit))
+}
+
+// readError answers a failed read of the request body.
+func readError(w http.ResponseWriter, err error) {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		tooLarge(w, mbe.Limit)
+		return
+	}
+	httpError(w, http.StatusBadRequest, codeBadRequest, "bad body")
+}
+
+// decodeJSON decodes the request body into v, answering the request and
+// returning false if it can't: the body must be a single JSON value with
+// no fields v doesn't have, nested at most Config.MaxJSONDepth deep.
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		readError(w, err)
+		return false
+	}
+	if h.cfg.MaxJSONDepth > 0 && tooDeep(body, h.cfg.MaxJSONDepth) {
+		httpError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid body: nested more than %d deep", h.cfg.MaxJSONDepth))
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		httpError(w, http.StatusBadRequest, codeBadRequest, decodeMessage(err))
+		return false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body: data after the JSON value")
+		return false
+	}
+	return true
+}
+
+// decodeMessage says what was wrong with a body where that is safe to
+// echo: a field v doesn't have or one of the wrong type.
+func decodeMessage(err error) string {
+	var te *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &te) && te.Field != "":
+		return fmt.Sprintf("invalid body: %s must be %s", te.Field, jsonKind(te.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "invalid body: " + strings.TrimPrefix(err.Error(), "json: ")
+	}
+	return "invalid body"
+}
+
+// jsonKind names the JSON value that decodes into t.
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a " + t.String()
+}
+
+// tooDeep reports whether b's arrays and objects nest more than max deep,
+// without decoding it. Brackets inside strings don't count.
+func tooDeep(b []byte, max int) bool {
+	depth, inString, escaped := 0, false, false
+	for _, c := range b {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '[' || c == '{':
+			if depth++; depth > max {
+				return true
+			}
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return false
+}
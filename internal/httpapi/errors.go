@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/example/go-user-tasks/internal/breaker"
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// Codes for errors raised by the transport itself rather than the service.
+const (
+	codeBadRequest         = "BAD_REQUEST"
+	codeUnsupportedVersion = "UNSUPPORTED_API_VERSION"
+	codeUnauthorized       = "UNAUTHORIZED"
+	codeForbidden          = "FORBIDDEN"
+	codeNotFound           = "NOT_FOUND"
+	codeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	codeWrongRegion        = "WRONG_REGION"
+	codeRateLimited        = "RATE_LIMITED"
+	codeTimeout            = "TIMEOUT"
+	codeConcurrentUpdate   = "CONCURRENT_UPDATE"
+	codeUnavailable        = "UNAVAILABLE"
+	codeOverloaded         = "OVERLOADED"
+	codeMaintenance        = "MAINTENANCE"
+	codePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	codeInternal           = "INTERNAL"
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	// Code is stable; Message is for humans and may change.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// httpError is http.Error with the JSON envelope.
+func httpError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	jsonWrite(w, ErrorResponse{Error: ErrorDetail{Code: code, Message: msg}}, status)
+}
+
+// errorStatus maps service errors to HTTP statuses; the body carries the
+// error's code and text.
+var errorStatus = map[error]int{
+	service.ErrUserNotFound:             http.StatusNotFound,
+	service.ErrUnknownTask:              http.StatusBadRequest,
+	service.ErrTaskUnavailable:          http.StatusBadRequest,
+	service.ErrTaskExpired:              http.StatusGone,
+	service.ErrTaskExhausted:            http.StatusGone,
+	service.ErrVerifierUnavailable:      http.StatusServiceUnavailable,
+	service.ErrTaskLocked:               http.StatusConflict,
+	service.ErrTaskNotFound:             http.StatusNotFound,
+	service.ErrTaskExists:               http.StatusConflict,
+	service.ErrCategoryNotFound:         http.StatusNotFound,
+	service.ErrCategoryExists:           http.StatusConflict,
+	service.ErrTranslationNotFound:      http.StatusNotFound,
+	service.ErrSubmissionNotFound:       http.StatusNotFound,
+	service.ErrSubmissionReviewed:       http.StatusConflict,
+	service.ErrAlreadyCompleted:         http.StatusConflict,
+	service.ErrAlreadyCheckedIn:         http.StatusConflict,
+	service.ErrCompletionNotFound:       http.StatusNotFound,
+	service.ErrChannelNotFound:          http.StatusNotFound,
+	service.ErrProviderNotFound:         http.StatusNotFound,
+	service.ErrOAuthState:               http.StatusBadRequest,
+	service.ErrOAuthFailed:              http.StatusUnauthorized,
+	service.ErrIdentityTaken:            http.StatusConflict,
+	service.ErrProviderLinked:           http.StatusConflict,
+	service.ErrIdentityNotFound:         http.StatusNotFound,
+	service.ErrLastSignIn:               http.StatusConflict,
+	service.ErrTelegramUnavailable:      http.StatusServiceUnavailable,
+	service.ErrSelfReferral:             http.StatusBadRequest,
+	service.ErrReferrerAlreadySet:       http.StatusConflict,
+	service.ErrReferrerNotFound:         http.StatusBadRequest,
+	service.ErrSelfTransfer:             http.StatusBadRequest,
+	service.ErrRecipientNotFound:        http.StatusBadRequest,
+	service.ErrInsufficientPoints:       http.StatusConflict,
+	service.ErrTransferCapExceeded:      http.StatusUnprocessableEntity,
+	service.ErrFeatureDisabled:          http.StatusForbidden,
+	service.ErrFlagNotFound:             http.StatusNotFound,
+	service.ErrUsernameTaken:            http.StatusConflict,
+	service.ErrInvalidCredentials:       http.StatusUnauthorized,
+	service.ErrInvalidRefreshToken:      http.StatusUnauthorized,
+	service.ErrInvalidResetToken:        http.StatusBadRequest,
+	service.ErrPasswordResetUnavailable: http.StatusNotFound,
+	service.ErrUnknownPartnerUser:       http.StatusNotFound,
+	service.ErrNoRegionID:               http.StatusMisdirectedRequest,
+	service.ErrRefreshTokenExpired:      http.StatusUnauthorized,
+	service.ErrWebhookNotFound:          http.StatusNotFound,
+	service.ErrDeliveryNotFound:         http.StatusNotFound,
+	service.ErrRoleNotFound:             http.StatusNotFound,
+	service.ErrDeletedUserNotFound:      http.StatusNotFound,
+	service.ErrExportNotFound:           http.StatusNotFound,
+	service.ErrExportNotReady:           http.StatusConflict,
+	service.ErrReportExportNotFound:     http.StatusNotFound,
+	service.ErrNegativeBalance:          http.StatusConflict,
+	service.ErrVersionConflict:          http.StatusConflict,
+	service.ErrTeamNotFound:             http.StatusNotFound,
+	service.ErrTeamNameTaken:            http.StatusConflict,
+	service.ErrTeamFull:                 http.StatusConflict,
+	service.ErrAlreadyInTeam:            http.StatusConflict,
+	service.ErrNotTeamMember:            http.StatusNotFound,
+	service.ErrSeasonNotFound:           http.StatusNotFound,
+	service.ErrSeasonOverlap:            http.StatusConflict,
+	service.ErrSeasonLocked:             http.StatusConflict,
+	service.ErrCampaignNotFound:         http.StatusNotFound,
+	service.ErrCampaignLocked:           http.StatusConflict,
+	service.ErrAwardRuleNotFound:        http.StatusNotFound,
+	service.ErrIdempotencyKeyReused:     http.StatusUnprocessableEntity,
+	service.ErrIdempotencyKeyInProgress: http.StatusConflict,
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var se *service.Error
+	if errors.As(err, &se) {
+		if status, ok := errorStatus[se]; ok {
+			httpError(w, status, se.Code, se.Msg)
+			return
+		}
+	}
+	var ve *service.ValidationError
+	if errors.As(err, &ve) {
+		httpError(w, http.StatusBadRequest, service.CodeValidation, ve.Msg)
+		return
+	}
+	var ase *service.AccountStatusError
+	if errors.As(err, &ase) {
+		httpError(w, http.StatusForbidden, ase.Code(), ase.Error())
+		return
+	}
+	var vfe *service.VerificationError
+	if errors.As(err, &vfe) {
+		httpError(w, http.StatusUnprocessableEntity, service.CodeVerification, vfe.Error())
+		return
+	}
+	if errors.Is(err, breaker.ErrOpen) {
+		// the breaker lets a probe through after its cooldown
+		httpError(w, http.StatusServiceUnavailable, codeUnavailable, "a dependency is unavailable, retry later")
+		return
+	}
+	if errors.Is(err, breaker.ErrFull) {
+		w.Header().Set("Retry-After", "1")
+		httpError(w, http.StatusServiceUnavailable, codeOverloaded, "too many requests in flight, retry")
+		return
+	}
+	if repository.IsTimeout(err) {
+		httpError(w, http.StatusServiceUnavailable, codeTimeout, "request timed out")
+		return
+	}
+	if repository.IsConflict(err) {
+		// still losing to concurrent writes after InTx's retries
+		w.Header().Set("Retry-After", "1")
+		httpError(w, http.StatusServiceUnavailable, codeConcurrentUpdate, "too many concurrent updates, retry")
+		return
+	}
+	httpError(w, http.StatusInternalServerError, codeInternal, "server error")
+}
@@ -0,0 +1,84 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// conditional tags 200 JSON responses with an ETag and a Cache-Control
+// max-age of maxAge, and answers a request whose If-None-Match names the
+// ETag with 304 and no body. Responses are private: they need a token.
+// Other responses, like errors and CSVs, pass through untouched.
+func conditional(maxAge time.Duration) func(http.Handler) http.Handler {
+	cacheControl := "private, no-cache"
+	if maxAge > 0 {
+		cacheControl = "private, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ew := &etagWriter{ResponseWriter: w}
+			next.ServeHTTP(ew, r)
+			if ew.passed || !ew.wroteHeader {
+				return
+			}
+			sum := sha256.Sum256(ew.body.Bytes())
+			etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", cacheControl)
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.Header().Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write(ew.body.Bytes())
+		})
+	}
+}
+
+// etagWriter holds back a 200 JSON body until its ETag is known, and
+// passes anything else straight through.
+type etagWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	passed      bool
+	body        bytes.Buffer
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	if status != http.StatusOK || !strings.HasPrefix(ew.Header().Get("Content-Type"), "application/json") {
+		ew.passed = true
+		ew.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.passed {
+		return ew.ResponseWriter.Write(b)
+	}
+	return ew.body.Write(b)
+}
+
+// etagMatches is If-None-Match's weak comparison: header is "*" or a list
+// of ETags, one of which is etag, W/ or not.
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// ExportResp is a queued export; DownloadURL is set once it is ready.
+type ExportResp struct {
+	repository.DataExport
+	DownloadURL *string `json:"download_url"`
+}
+
+func exportResp(r *http.Request, e repository.DataExport) ExportResp {
+	resp := ExportResp{DataExport: e}
+	if e.Status == "ready" {
+		u := apiPath(r, fmt.Sprintf("/users/%d/exports/%d/download", e.UserID, e.ID))
+		resp.DownloadURL = &u
+	}
+	return resp
+}
+
+// ExportUser writes the user's data, or queues it and answers 202 with where
+// to check on it; see service.ExportUser.
+func (h *Handler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	exp, job, err := h.svc.ExportUser(r.Context(), id, q.Get("format"), q.Get("async") == "true")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if job != nil {
+		w.Header().Set("Location", apiPath(r, fmt.Sprintf("/users/%d/exports/%d", id, job.ID)))
+		jsonWrite(w, exportResp(r, *job), http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", exp.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exp.Filename()))
+	if err := exp.Write(r.Context(), w); err != nil {
+		// the status is long sent; cut the connection so the client sees
+		// a failed download rather than a truncated file
+		log.Printf("export user %d: %v", id, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (h *Handler) GetExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	exportID, ok := pathID(w, r, "export_id")
+	if !ok {
+		return
+	}
+	e, err := h.svc.DataExport(r.Context(), id, exportID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, exportResp(r, e), http.StatusOK)
+}
+
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	exportID, ok := pathID(w, r, "export_id")
+	if !ok {
+		return
+	}
+	e, content, err := h.svc.ExportArchive(r.Context(), id, exportID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", service.ExportContentType(e.Format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", service.ExportFilename(id, e.Format)))
+	w.Write(content)
+}
@@ -0,0 +1,53 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+func (h *Handler) GetFeatures(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	features, err := h.svc.Features(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"features": features}, http.StatusOK)
+}
+
+func (h *Handler) AdminListFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := h.svc.Flags(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"flags": flags}, http.StatusOK)
+}
+
+func (h *Handler) AdminSetFlag(w http.ResponseWriter, r *http.Request) {
+	var in service.FlagInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	f, err := h.svc.SetFlag(r.Context(), chi.URLParam(r, "name"), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, f, http.StatusOK)
+}
+
+func (h *Handler) AdminClearFlag(w http.ResponseWriter, r *http.Request) {
+	f, err := h.svc.ClearFlag(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, f, http.StatusOK)
+}
@@ -0,0 +1,23 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/example/go-user-tasks/internal/health"
+)
+
+// Healthz is the liveness probe: the process is up and serving.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	jsonWrite(w, map[string]string{"status": health.StatusOK}, http.StatusOK)
+}
+
+// Readyz is the readiness probe: 503 while any dependency check fails,
+// with every check's result in the body either way.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	rep := h.cfg.Health.Check(r.Context())
+	status := http.StatusOK
+	if rep.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	jsonWrite(w, rep, status)
+}
@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Idempotent makes a mutating route safe to retry: a request carrying an
+// Idempotency-Key header runs once per user and key, and repeats get the
+// recorded response back with Idempotent-Replayed: true. Server errors are
+// not recorded, so those requests can be retried for real.
+func (h *Handler) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, err := subjectUserID(r)
+		if err != nil {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "invalid token")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			readError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.New()
+		io.WriteString(sum, r.Method+" "+r.URL.Path+"\n")
+		sum.Write(body)
+		prev, err := h.svc.BeginIdempotent(r.Context(), userID, key, hex.EncodeToString(sum.Sum(nil)))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if prev != nil {
+			if prev.ContentType != "" {
+				w.Header().Set("Content-Type", prev.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(prev.Status)
+			w.Write(prev.Body)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// the request deadline may have passed; the outcome must still be kept
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), h.cfg.WriteDeadline)
+		defer cancel()
+		if rec.status >= http.StatusInternalServerError {
+			err = h.svc.ReleaseIdempotent(ctx, userID, key)
+		} else {
+			err = h.svc.FinishIdempotent(ctx, userID, key, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("idempotency key %q for user %d: %v", key, userID, err)
+		}
+	})
+}
+
+// recorder passes the response through while keeping a copy.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+type LinkIdentityReq struct {
+	// Provider is telegram, a partner's name or the identity provider
+	// whose tokens are accepted.
+	Provider   string `json:"provider"`
+	ExternalID string `json:"external_id,omitempty"`
+	// Proof is required for telegram: the Telegram Login Widget's data for
+	// the account, which external_id may then be left out of.
+	Proof json.RawMessage `json:"proof,omitempty"`
+}
+
+func (h *Handler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	ids, err := h.svc.ListIdentities(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"identities": ids}, http.StatusOK)
+}
+
+// LinkIdentity links a Telegram account, with a signed login for it, a
+// partner account or an identity provider account. Partner accounts need
+// users:manage even for one's own user, as partners pay out to whoever
+// holds the account id, and so do identity provider accounts, as their
+// tokens act as the user.
+func (h *Handler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req LinkIdentityReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if h.svc.IsPartner(req.Provider) || h.svc.IsTokenProvider(req.Provider) {
+		allowed, err := can(r, service.PermUsersManage)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !allowed {
+			httpError(w, http.StatusForbidden, codeForbidden, "linking "+req.Provider+" accounts needs "+service.PermUsersManage)
+			return
+		}
+	}
+	ident, err := h.svc.LinkIdentity(r.Context(), id, req.Provider, req.ExternalID, req.Proof)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, ident, http.StatusCreated)
+}
+
+func (h *Handler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.UnlinkIdentity(r.Context(), id, chi.URLParam(r, "provider")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
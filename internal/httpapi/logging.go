@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logFields carries values discovered deeper in the middleware chain (the
+// authenticated user) back out to requestLogger.
+type logFields struct {
+	userID int64
+}
+
+type ctxKeyLogFields struct{}
+
+// setLogUser records the authenticated user for the request's log line.
+func setLogUser(r *http.Request, userID int64) {
+	if f, ok := r.Context().Value(ctxKeyLogFields{}).(*logFields); ok {
+		f.userID = userID
+	}
+}
+
+// requestLogger writes one JSON line per request with the request id, user,
+// matched route, status and latency. It replaces chi's text logger and must
+// run after middleware.RequestID.
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		fields := &logFields{}
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyLogFields{}, fields))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remote_ip", r.RemoteAddr),
+		}
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			attrs = append(attrs, slog.String("route", rc.RoutePattern()))
+		}
+		if fields.userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", fields.userID))
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// refuseInMaintenance answers mutating requests with a 503 while
+// maintenance mode is on, with its message and Retry-After. It sits in
+// front of the write routes; reads, sign-in and /admin/maintenance itself
+// keep working.
+func (h *Handler) refuseInMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := h.svc.MaintenanceMode(r.Context())
+		if !m.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if m.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+		}
+		httpError(w, http.StatusServiceUnavailable, codeMaintenance, m.Message)
+	})
+}
+
+func (h *Handler) AdminGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	m, err := h.svc.GetMaintenance(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, m, http.StatusOK)
+}
+
+func (h *Handler) AdminSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var in service.MaintenanceInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	m, err := h.svc.SetMaintenance(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, m, http.StatusOK)
+}
+
+func (h *Handler) AdminClearMaintenance(w http.ResponseWriter, r *http.Request) {
+	m, err := h.svc.ClearMaintenance(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, m, http.StatusOK)
+}
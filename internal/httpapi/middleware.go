@@ -0,0 +1,296 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Expect Bearer token
+		auth := r.Header.Get("Authorization")
+		const prefix = "Bearer "
+		if len(auth) <= len(prefix) || auth[:len(prefix)] != prefix {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "missing bearer token")
+			return
+		}
+
+		claims, err := h.svc.ParseAccessToken(auth[len(prefix):])
+		if errors.Is(err, service.ErrTokenRevoked) {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "token revoked")
+			return
+		}
+		if err != nil {
+			httpError(w, http.StatusUnauthorized, codeUnauthorized, "invalid token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxKeyClaims{}, claims)
+		id, err := subjectUserID(r.WithContext(ctx))
+		if err == nil {
+			setLogUser(r, id)
+		}
+		ctx = service.WithActor(ctx, service.Actor{
+			UserID:    id,
+			IP:        clientIP(r),
+			RequestID: middleware.GetReqID(ctx),
+		})
+		role, _ := claims["role"].(string)
+		ctx = context.WithValue(ctx, ctxKeyAuthz{}, &authz{load: func(ctx context.Context) (map[string]bool, error) {
+			return h.svc.Permissions(ctx, id, role)
+		}})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type ctxKeyClaims struct{}
+
+func getClaims(r *http.Request) jwt.MapClaims {
+	v := r.Context().Value(ctxKeyClaims{})
+	if v == nil {
+		return jwt.MapClaims{}
+	}
+	return v.(jwt.MapClaims)
+}
+
+func subjectUserID(r *http.Request) (int64, error) {
+	claims := getClaims(r)
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		// maybe numeric
+		if f, ok := claims["sub"].(float64); ok {
+			return int64(f), nil
+		}
+		return 0, errors.New("no sub in token")
+	}
+	id, err := strconv.ParseInt(sub, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// authz holds the caller's permissions, loaded on first use so requests that
+// only touch the caller's own data never query roles.
+type authz struct {
+	load  func(ctx context.Context) (map[string]bool, error)
+	once  sync.Once
+	perms map[string]bool
+	err   error
+}
+
+type ctxKeyAuthz struct{}
+
+// can reports whether the caller holds perm (see the service.Perm* constants).
+func can(r *http.Request, perm string) (bool, error) {
+	a, ok := r.Context().Value(ctxKeyAuthz{}).(*authz)
+	if !ok {
+		return false, nil
+	}
+	a.once.Do(func() { a.perms, a.err = a.load(r.Context()) })
+	return a.perms[perm], a.err
+}
+
+// Require rejects callers without perm with 403.
+func Require(perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, err := can(r, perm)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			if !ok {
+				httpError(w, http.StatusForbidden, codeForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// pathUserID parses {id} and checks the caller may act on that user: anyone
+// on themselves, others only with users:read (GET) or users:write. It writes
+// the error response and returns false when not.
+func pathUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "bad user id")
+		return 0, false
+	}
+	if sub, err := subjectUserID(r); err == nil && sub == id {
+		return id, true
+	}
+	perm := service.PermUsersWrite
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		perm = service.PermUsersRead
+	}
+	ok, err := can(r, perm)
+	if err != nil {
+		writeError(w, err)
+		return 0, false
+	}
+	if !ok {
+		httpError(w, http.StatusForbidden, codeForbidden, "forbidden")
+		return 0, false
+	}
+	return id, true
+}
+
+// RequireActive rejects requests on behalf of a user in {id} who is
+// suspended or banned, with a 403 giving the status and its reason. Callers
+// not allowed to act for the user get the usual 403 first, so it doesn't
+// tell them the user's status.
+func (h *Handler) RequireActive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathUserID(w, r)
+		if !ok {
+			return
+		}
+		if err := h.svc.CheckActive(r.Context(), id); err != nil {
+			writeError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitInFlight sheds requests beyond Config.MaxRequests in flight with a
+// 503, so a slow database turns into fast refusals rather than a queue.
+func (h *Handler) limitInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.inFlight == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		done, err := h.inFlight.Allow()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer done(nil)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withDeadline bounds the request context so every DB call made with it is
+// cancelled once d, or the route's entry in Config.RouteDeadlines, elapses.
+// A query cut short that way is answered 503 TIMEOUT.
+func (h *Handler) withDeadline(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := d
+			if rd, ok := h.cfg.RouteDeadlines[routeKey(r)]; ok {
+				d = rd
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RouteToHomeRegion forwards mutating requests for a user homed elsewhere to
+// that region, so one-time awards (task completions, referrals) are decided by
+// a single writer and can't be claimed twice. Reads are always served locally.
+func (h *Handler) RouteToHomeRegion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || !h.forwardToHome(w, r, id) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// forwardToHome answers r from the region user id is homed in, or with an
+// error, and returns true; it returns false when r is this region's to
+// serve.
+//
+// Regions number their users on their own, so the request is rewritten to
+// name the user by their id in the home region: the {id} in its path, the
+// subject of its bearer token, and X-Forwarded-User, a token for the user
+// for routes that find them some other way.
+func (h *Handler) forwardToHome(w http.ResponseWriter, r *http.Request, id int64) bool {
+	home, err := h.svc.HomeRegion(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return true
+	}
+	if home == "" || home == h.svc.Region() {
+		return false
+	}
+	proxy, ok := h.proxies[home]
+	if !ok {
+		httpError(w, http.StatusMisdirectedRequest, codeWrongRegion, "user is homed in region "+home)
+		return true
+	}
+	if err := h.rewriteForRegion(r, id, home); err != nil {
+		writeError(w, err)
+		return true
+	}
+	r.Header.Set("X-Forwarded-Region", h.svc.Region())
+	proxy.ServeHTTP(w, r)
+	return true
+}
+
+// rewriteForRegion renames user id, and the caller, by their ids in region.
+func (h *Handler) rewriteForRegion(r *http.Request, id int64, region string) error {
+	ctx := r.Context()
+	homeID, err := h.svc.UserIDIn(ctx, id, region)
+	if err != nil {
+		return err
+	}
+	if chi.URLParam(r, "id") != "" {
+		r.URL.Path = replaceSegment(r.URL.Path, strconv.FormatInt(id, 10), strconv.FormatInt(homeID, 10))
+		r.URL.RawPath = ""
+	}
+	if claims := getClaims(r); len(claims) > 0 {
+		sub, err := subjectUserID(r)
+		if err != nil {
+			return err
+		}
+		callerID, err := h.svc.UserIDIn(ctx, sub, region)
+		if err != nil {
+			return err
+		}
+		exp, _ := claims.GetExpirationTime()
+		var expires time.Time
+		if exp != nil {
+			expires = exp.Time
+		}
+		token, err := h.svc.ForwardToken(callerID, expires)
+		if err != nil {
+			return err
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	user, err := h.svc.ForwardToken(homeID, time.Time{})
+	if err != nil {
+		return err
+	}
+	r.Header.Set("X-Forwarded-User", user)
+	return nil
+}
+
+// replaceSegment replaces the first path segment that is from with to.
+func replaceSegment(path, from, to string) string {
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if s == from {
+			segs[i] = to
+			break
+		}
+	}
+	return strings.Join(segs, "/")
+}
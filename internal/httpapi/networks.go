@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type ctxKeyPeer struct{}
+
+// inNetworks reports whether addr is in one of nets.
+func inNetworks(addr netip.Addr, nets []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, n := range nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP sets r.RemoteAddr to the client's address, keeping the
+// connection's own peer address for peerAddr. With no TrustedProxies,
+// X-Forwarded-For and X-Real-IP are believed from anyone, as chi's RealIP
+// does. With them, only a trusted peer's headers count, and the client is
+// the last X-Forwarded-For hop that isn't a trusted proxy itself.
+func (h *Handler) realIP(next http.Handler) http.Handler {
+	legacy := middleware.RealIP(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, _ := netip.ParseAddrPort(r.RemoteAddr)
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyPeer{}, peer.Addr()))
+		if len(h.cfg.TrustedProxies) == 0 {
+			legacy.ServeHTTP(w, r)
+			return
+		}
+		if inNetworks(peer.Addr(), h.cfg.TrustedProxies) {
+			if client, ok := h.forwardedFor(r); ok {
+				r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor walks X-Forwarded-For from the nearest hop back past the
+// trusted proxies, falling back to X-Real-IP. A hop that isn't an address
+// stops the walk: nothing before it can be believed.
+func (h *Handler) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = a.Unmap()
+		if !inNetworks(client, h.cfg.TrustedProxies) {
+			break
+		}
+	}
+	if client.IsValid() {
+		return client, true
+	}
+	a, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	return a.Unmap(), err == nil
+}
+
+// peerAddr is the address the connection came from, before realIP.
+func peerAddr(r *http.Request) netip.Addr {
+	a, _ := r.Context().Value(ctxKeyPeer{}).(netip.Addr)
+	return a
+}
+
+// restrictAdmin answers 403 to /admin requests, the dashboard included,
+// from outside AdminAllowedNetworks. The client is as realIP found it
+// when there are trusted proxies; otherwise forwarding headers could name
+// any address, so the connection's peer is checked.
+func (h *Handler) restrictAdmin(next http.Handler) http.Handler {
+	if len(h.cfg.AdminAllowedNetworks) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1")
+		if path != "/admin" && !strings.HasPrefix(path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := peerAddr(r)
+		if len(h.cfg.TrustedProxies) > 0 {
+			client, _ = netip.ParseAddr(clientIP(r))
+		}
+		if !inNetworks(client, h.cfg.AdminAllowedNetworks) {
+			httpError(w, http.StatusForbidden, codeForbidden, "admin access is not allowed from this network")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+type MarkNotificationsReadReq struct {
+	// IDs are the notifications to mark read; omitted means all of them.
+	IDs []int64 `json:"ids"`
+}
+
+func (h *Handler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+	var before int64
+	if v := q.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad before cursor")
+			return
+		}
+		before = n
+	}
+	unreadOnly, _ := strconv.ParseBool(q.Get("unread"))
+
+	page, err := h.svc.Notifications(r.Context(), id, unreadOnly, before, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"notifications": page.Notifications, "unread": page.Unread, "next_before": nil}
+	if len(page.Notifications) == limit {
+		resp["next_before"] = page.Notifications[len(page.Notifications)-1].ID
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func (h *Handler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req MarkNotificationsReadReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	n, err := h.svc.MarkNotificationsRead(r.Context(), id, req.IDs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"marked": n}, http.StatusOK)
+}
+
+func (h *Handler) GetNotificationChannels(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	settings, err := h.svc.ChannelSettings(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, settings, http.StatusOK)
+}
+
+func (h *Handler) SetNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var in service.ChannelInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	c, err := h.svc.SetChannelSetting(r.Context(), id, chi.URLParam(r, "channel"), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, c, http.StatusOK)
+}
+
+func (h *Handler) DeleteNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteChannelSetting(r.Context(), id, chi.URLParam(r, "channel")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
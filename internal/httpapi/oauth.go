@@ -0,0 +1,93 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// oauthNonceCookie carries the nonce StartOAuth returns from the start of a
+// login to its callback, tying both to the same browser.
+const oauthNonceCookie = "oauth_nonce"
+
+func setOAuthNonce(w http.ResponseWriter, r *http.Request, provider, nonce string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthNonceCookie,
+		Value:    nonce,
+		Path:     "/auth/" + provider,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Lax: the provider's redirect back is a top-level GET
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OAuthLogin sends the browser to the provider's consent page.
+func (h *Handler) OAuthLogin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	url, nonce, err := h.svc.StartOAuth(provider, 0)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setOAuthNonce(w, r, provider, nonce)
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// OAuthCallback finishes a login or link the provider redirected back from.
+func (h *Handler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	q := r.URL.Query()
+	var nonce string
+	if c, err := r.Cookie(oauthNonceCookie); err == nil {
+		nonce = c.Value
+	}
+	// the nonce is single use whatever the outcome
+	http.SetCookie(w, &http.Cookie{Name: oauthNonceCookie, Path: "/auth/" + provider, MaxAge: -1})
+
+	res, err := h.svc.FinishOAuth(r.Context(), provider, q.Get("code"), q.Get("state"), nonce)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if res.Linked {
+		jsonWrite(w, map[string]any{"user_id": res.UserID, "provider": provider, "linked": true}, http.StatusOK)
+		return
+	}
+	status := http.StatusOK
+	if res.Created {
+		status = http.StatusCreated
+		h.svc.AttributeSignup(r.Context(), res.UserID, referralToken(w, r, ""))
+	}
+	jsonWrite(w, map[string]any{
+		"user_id":       res.UserID,
+		"created":       res.Created,
+		"token":         res.Tokens.Token,
+		"refresh_token": res.Tokens.RefreshToken,
+		"expires_in":    res.Tokens.ExpiresIn,
+	}, status)
+}
+
+// LinkOAuth starts linking a provider account to the caller. It answers with
+// the consent URL rather than redirecting, since the caller authenticates
+// with a bearer token a plain browser navigation wouldn't carry.
+func (h *Handler) LinkOAuth(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	// admins may act on other users, but not sign in as them
+	if sub, err := subjectUserID(r); err != nil || sub != id {
+		httpError(w, http.StatusForbidden, codeForbidden, "forbidden")
+		return
+	}
+	provider := chi.URLParam(r, "provider")
+	url, nonce, err := h.svc.StartOAuth(provider, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setOAuthNonce(w, r, provider, nonce)
+	jsonWrite(w, map[string]any{"url": url}, http.StatusOK)
+}
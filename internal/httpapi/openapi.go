@@ -0,0 +1,351 @@
+package httpapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:generate go run ../../tools/openapigen -o openapi.json
+
+// openAPISpec is generated from operations by tools/openapigen; run
+// go generate ./internal/httpapi after changing routes or their types.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// op documents one route. Body and Resp are values whose types are reflected
+// into JSON schemas; nil means no body.
+type op struct {
+	Method, Path string
+	Tag, Summary string
+	// Perm is the permission required beyond a valid token; Public routes
+	// need no token at all.
+	Perm   string
+	Public bool
+	// Signed routes take a partner's signature instead of a token.
+	Signed bool
+	Query  []param
+	Body   any
+	Status int // success status, 200 when zero
+	Resp   any
+	Media  string // success content type, application/json when empty
+	Errors []int
+	// Conditional responses carry an ETag and are 304 for If-None-Match.
+	Conditional bool
+}
+
+type param struct {
+	Name, Type, Desc string
+}
+
+// undocumented routes are served but left out of the spec.
+var undocumented = []string{"GET /openapi.json", "GET /docs", "GET /admin/ui", "GET /admin/ui/*"}
+
+// unversioned paths are served as they are rather than under /v1.
+var unversioned = []string{"/healthz", "/readyz", "/auth/{provider}/callback", "/r/{code}", "/widgets/leaderboard", "/callbacks/tasks/complete"}
+
+// documented reports whether key, a method and path such as
+// "GET /users/{id}", is in the spec.
+func documented(key string) bool {
+	for _, o := range operations {
+		if o.Method+" "+o.Path == key {
+			return true
+		}
+	}
+	return false
+}
+
+// routeKey is the method and documented path of the route r was matched
+// to, whether it was served under /v1 or at its legacy path.
+func routeKey(r *http.Request) string {
+	pattern := chi.RouteContext(r.Context()).RoutePattern()
+	return r.Method + " " + strings.TrimPrefix(pattern, "/v"+apiVersion)
+}
+
+// route is the path o is served at.
+func (o op) route() string {
+	if slices.Contains(unversioned, o.Path) {
+		return o.Path
+	}
+	return "/v" + apiVersion + o.Path
+}
+
+// OpenAPI builds the OpenAPI 3 document from operations, failing if the
+// router serves a route that isn't documented or documents one it doesn't
+// serve.
+func OpenAPI() ([]byte, error) {
+	served := map[string]bool{}
+	err := chi.Walk((&Handler{}).Routes().(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		key := method + " " + strings.TrimSuffix(route, "/")
+		if !slices.Contains(undocumented, key) {
+			served[key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, o := range operations {
+		key := o.Method + " " + o.route()
+		if !served[key] {
+			problems = append(problems, "documented but not routed: "+key)
+		}
+		delete(served, key)
+	}
+	for key := range served {
+		problems = append(problems, "routed but not documented: "+key)
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return nil, fmt.Errorf("openapi: %s", strings.Join(problems, "; "))
+	}
+
+	g := &schemaGen{components: map[string]any{}}
+	paths := map[string]map[string]any{}
+	for _, o := range operations {
+		if paths[o.route()] == nil {
+			paths[o.route()] = map[string]any{}
+		}
+		paths[o.route()][strings.ToLower(o.Method)] = g.operation(o)
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Go User Tasks API",
+			"version": apiVersion + ".0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"partner": map[string]any{"type": "apiKey", "in": "header", "name": "X-Callback-Signature",
+					"description": "t=<unix seconds>,v1=<hex HMAC-SHA256 of \"t.body\"> with the secret of the partner named in X-Callback-Partner"},
+			},
+		},
+		"security": []any{map[string]any{"bearer": []string{}}},
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	return append(out, '\n'), err
+}
+
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+func (g *schemaGen) operation(o op) map[string]any {
+	out := map[string]any{
+		"tags":        []string{o.Tag},
+		"summary":     o.Summary,
+		"operationId": operationID(o),
+	}
+	if o.Public {
+		out["security"] = []any{}
+	} else if o.Signed {
+		out["security"] = []any{map[string]any{"partner": []string{}}}
+	} else if o.Perm != "" {
+		out["description"] = "Requires the `" + o.Perm + "` permission."
+	}
+
+	var params []any
+	for _, m := range pathParamRe.FindAllStringSubmatch(o.Path, -1) {
+		typ := "string"
+		if m[1] == "id" {
+			typ = "integer"
+		}
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": typ},
+		})
+	}
+	for _, p := range o.Query {
+		params = append(params, map[string]any{
+			"name": p.Name, "in": "query", "description": p.Desc, "schema": map[string]any{"type": p.Type},
+		})
+	}
+	if o.Method != http.MethodGet && !o.Public && !o.Signed {
+		params = append(params, map[string]any{
+			"name": "Idempotency-Key", "in": "header", "schema": map[string]any{"type": "string"},
+			"description": "Replays the recorded response for retries with the same key and body.",
+		})
+	}
+	if o.Conditional {
+		params = append(params, map[string]any{
+			"name": "If-None-Match", "in": "header", "schema": map[string]any{"type": "string"},
+			"description": "ETag of a response already held; 304 if it is still current.",
+		})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	if o.Body != nil {
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(o.Body))}},
+		}
+	}
+
+	status := o.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	media := o.Media
+	if media == "" {
+		media = "application/json"
+	}
+	if o.Resp != nil {
+		ok["content"] = map[string]any{media: map[string]any{"schema": g.schema(reflect.TypeOf(o.Resp))}}
+	} else if o.Media != "" {
+		ok["content"] = map[string]any{media: map[string]any{"schema": map[string]any{"type": "string"}}}
+	}
+	responses := map[string]any{fmt.Sprint(status): ok}
+	if o.Conditional {
+		responses["304"] = map[string]any{"description": http.StatusText(http.StatusNotModified)}
+	}
+	errs := o.Errors
+	if !o.Public {
+		errs = append([]int{http.StatusUnauthorized}, errs...)
+	}
+	if o.Perm != "" {
+		errs = append(errs, http.StatusForbidden)
+	}
+	if o.Body != nil {
+		errs = append(errs, http.StatusRequestEntityTooLarge)
+	}
+	errs = append(errs, http.StatusTooManyRequests)
+	errSchema := g.schema(reflect.TypeOf(ErrorResponse{}))
+	for _, code := range errs {
+		responses[fmt.Sprint(code)] = map[string]any{
+			"description": http.StatusText(code),
+			"content":     map[string]any{"application/json": map[string]any{"schema": errSchema}},
+		}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// operationID is method + path in camel case, e.g. postUsersIdTaskComplete.
+func operationID(o op) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(o.Method))
+	for _, part := range strings.FieldsFunc(o.Path, func(r rune) bool { return strings.ContainsRune("/{}_", r) }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// schemaGen reflects Go types into JSON schemas following encoding/json's
+// rules. Named structs become shared components.
+type schemaGen struct {
+	components map[string]any
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if _, ref := s["$ref"]; ref {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.Name()
+		if _, done := g.components[name]; !done {
+			g.components[name] = nil // break recursion
+			g.components[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	g.fields(t, props)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// fields adds t's JSON fields to props, flattening embedded structs.
+func (g *schemaGen) fields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, props)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+func (h *Handler) OpenAPIJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// Docs serves Swagger UI for /openapi.json, loaded from a CDN.
+func (h *Handler) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Go User Tasks API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,546 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/health"
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// Response shapes that handlers write as maps, spelled out for the spec.
+type (
+	healthzResp struct {
+		Status string `json:"status"`
+	}
+	tokenResp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	registerResp struct {
+		User repository.User `json:"user"`
+		tokenResp
+	}
+	userResp struct {
+		User repository.User `json:"user"`
+	}
+	loginResp struct {
+		UserID int64 `json:"user_id"`
+		tokenResp
+	}
+	oauthCallbackResp struct {
+		UserID int64 `json:"user_id"`
+		// Created is set, with status 201, when the sign-in made a new user.
+		Created bool `json:"created"`
+		tokenResp
+		// Provider and Linked replace the rest when the flow was a link.
+		Provider string `json:"provider,omitempty"`
+		Linked   bool   `json:"linked,omitempty"`
+	}
+	identitiesResp struct {
+		Identities []repository.ExternalIdentity `json:"identities"`
+	}
+	urlResp struct {
+		URL string `json:"url"`
+	}
+	userSearchResp struct {
+		Users      []service.FoundUser `json:"users"`
+		NextCursor *string             `json:"next_cursor"`
+	}
+	statusResp struct {
+		User           repository.User `json:"user"`
+		CompletedCount int64           `json:"completed_count"`
+		// CompletedTasks are the latest completions; GET
+		// /users/{id}/tasks pages all of them.
+		CompletedTasks []repository.CompletedTask `json:"completed_tasks"`
+		Streak         service.StreakStatus       `json:"streak"`
+		// Level is null with levels off.
+		Level *service.LevelStatus `json:"level"`
+		// TopPercent places the user's lifetime points among all users',
+		// as of the last points distribution count.
+		TopPercent float64 `json:"top_percent"`
+	}
+	completedTasksResp struct {
+		CompletedTasks []repository.CompletedTask `json:"completed_tasks"`
+		NextCursor     *string                    `json:"next_cursor"`
+	}
+	leaderboardResp struct {
+		Period      string                        `json:"period"`
+		Leaderboard []repository.LeaderboardEntry `json:"leaderboard"`
+		Total       int64                         `json:"total"`
+		NextCursor  *string                       `json:"next_cursor"`
+		// AsOf is set on pages served from the precomputed leaderboard.
+		AsOf *time.Time `json:"as_of,omitempty"`
+	}
+	seasonsResp struct {
+		Seasons []repository.Season `json:"seasons"`
+	}
+	campaignsResp struct {
+		Campaigns []repository.Campaign `json:"campaigns"`
+	}
+	awardRulesResp struct {
+		Rules []repository.AwardRule `json:"rules"`
+	}
+	seasonLeaderboardResp struct {
+		SeasonID    int64                         `json:"season_id"`
+		Leaderboard []repository.LeaderboardEntry `json:"leaderboard"`
+		Total       int64                         `json:"total"`
+		NextCursor  *string                       `json:"next_cursor"`
+	}
+	teamLeaderboardResp struct {
+		Teams      []repository.TeamEntry `json:"teams"`
+		Total      int64                  `json:"total"`
+		NextCursor *string                `json:"next_cursor"`
+	}
+	historyResp struct {
+		Transactions []repository.LedgerEntry `json:"transactions"`
+		NextBefore   *int64                   `json:"next_before"`
+	}
+	partnerCompleteResp struct {
+		UserID int64 `json:"user_id"`
+		completeResp
+	}
+	completeResp struct {
+		// Status is "ok", "already_completed" with no other fields, or
+		// "pending_review" (with 202) with only Submission.
+		Status     string                     `json:"status"`
+		Awarded    int64                      `json:"awarded"`
+		Streak     int                        `json:"streak"`
+		Multiplier float64                    `json:"multiplier"`
+		Receipt    string                     `json:"receipt,omitempty"`
+		Submission *repository.TaskSubmission `json:"submission,omitempty"`
+		// Campaigns are the running campaigns that added to Awarded.
+		Campaigns []service.AppliedCampaign `json:"campaigns,omitempty"`
+		// Explain lists the modifiers that took the task's points to
+		// Awarded.
+		Explain *service.Explain `json:"explain,omitempty"`
+	}
+	referrerResp struct {
+		Status          string `json:"status"`
+		BonusReferred   int64  `json:"bonus_referred"`
+		BonusToReferrer int64  `json:"bonus_to_referrer"`
+		// BonusPending is set when both bonuses wait for the referred user
+		// to reach the payout milestone.
+		BonusPending bool `json:"bonus_pending"`
+		// ReferrerCapped names the cap, daily, monthly or lifetime, that
+		// left the referrer without a bonus; empty if none did.
+		ReferrerCapped string `json:"referrer_capped"`
+	}
+	transferResp struct {
+		Status   string              `json:"status"`
+		Transfer repository.Transfer `json:"transfer"`
+	}
+	userTasksResp struct {
+		Tasks []service.UserTask `json:"tasks"`
+	}
+	translationsResp struct {
+		Translations []repository.TaskTranslation `json:"translations"`
+	}
+	categoriesResp struct {
+		Categories []repository.Category `json:"categories"`
+	}
+	tasksResp struct {
+		Tasks []repository.Task `json:"tasks"`
+	}
+	receiptResp struct {
+		Valid       bool      `json:"valid"`
+		UserID      int64     `json:"user_id,omitempty"`
+		Task        string    `json:"task,omitempty"`
+		Amount      int64     `json:"amount,omitempty"`
+		CompletedAt time.Time `json:"completed_at,omitempty"`
+	}
+	rolesResp struct {
+		Roles []repository.Role `json:"roles"`
+	}
+	userRolesResp struct {
+		UserID int64    `json:"user_id"`
+		Roles  []string `json:"roles"`
+	}
+	usersResp struct {
+		Users      []repository.User `json:"users"`
+		NextBefore *int64            `json:"next_before"`
+	}
+	duplicatesResp struct {
+		Duplicates []service.DuplicateUser `json:"duplicates"`
+	}
+	auditResp struct {
+		Events     []repository.AuditEvent `json:"events"`
+		NextBefore *int64                  `json:"next_before"`
+	}
+	webhooksResp struct {
+		Webhooks []repository.WebhookEndpoint `json:"webhooks"`
+	}
+	flagsResp struct {
+		Flags []service.Flag `json:"flags"`
+	}
+	featuresResp struct {
+		Features map[string]bool `json:"features"`
+	}
+	webhookCreatedResp struct {
+		Webhook repository.WebhookEndpoint `json:"webhook"`
+		Secret  string                     `json:"secret"`
+	}
+	discrepanciesResp struct {
+		Discrepancies []repository.Discrepancy `json:"discrepancies"`
+		NextAfter     *int64                   `json:"next_after"`
+	}
+	submissionsResp struct {
+		Submissions []repository.TaskSubmission `json:"submissions"`
+		NextAfter   *int64                      `json:"next_after"`
+	}
+	notificationsResp struct {
+		Notifications []repository.Notification `json:"notifications"`
+		Unread        int64                     `json:"unread"`
+		NextBefore    *int64                    `json:"next_before"`
+	}
+	archivedSeasonsResp struct {
+		Archived []repository.Season `json:"archived"`
+	}
+	markedResp struct {
+		Marked int64 `json:"marked"`
+	}
+	deliveriesResp struct {
+		Deliveries []repository.WebhookDelivery `json:"deliveries"`
+		NextBefore *int64                       `json:"next_before"`
+	}
+)
+
+var (
+	limitParam  = param{"limit", "integer", "page size"}
+	beforeParam = param{"before", "integer", "next_before from the previous page"}
+	afterParam  = param{"after", "integer", "next_after from the previous page"}
+
+	submissionStatusParam = param{"status", "string", "pending, approved or rejected"}
+	periodParam           = param{"period", "string", "all (default), daily, weekly or monthly"}
+	formatParam           = param{"format", "string", "json (default) or csv, sent as an attachment"}
+)
+
+// operations documents every route in Routes; OpenAPI fails when the two
+// disagree.
+var operations = []op{
+	{Method: "POST", Path: "/auth/register", Tag: "auth", Summary: "Create an account and sign in; a referral token from /r/{code}, in the body or its cookie, sets the referrer", Public: true,
+		Body: RegisterReq{}, Status: http.StatusCreated, Resp: registerResp{}, Errors: []int{400, 409}},
+	{Method: "POST", Path: "/auth/login", Tag: "auth", Summary: "Sign in with username and password", Public: true,
+		Body: CredentialsReq{}, Resp: loginResp{}, Errors: []int{400, 401, 403}},
+	{Method: "POST", Path: "/auth/refresh", Tag: "auth", Summary: "Rotate a refresh token for a new token pair", Public: true,
+		Body: RefreshReq{}, Resp: tokenResp{}, Errors: []int{400, 401}},
+	{Method: "POST", Path: "/auth/logout", Tag: "auth", Summary: "Revoke a refresh token and its family", Public: true,
+		Body: RefreshReq{}, Status: http.StatusNoContent, Errors: []int{400}},
+	{Method: "POST", Path: "/auth/forgot-password", Tag: "auth", Summary: "Email a one-time password reset token, if the user has a password and an email address; 202 either way", Public: true,
+		Body: ForgotPasswordReq{}, Status: http.StatusAccepted, Errors: []int{400, 404}},
+	{Method: "POST", Path: "/auth/reset-password", Tag: "auth", Summary: "Set a new password with a reset token, ending every session of the user", Public: true,
+		Body: ResetPasswordReq{}, Status: http.StatusNoContent, Errors: []int{400}},
+	{Method: "GET", Path: "/auth/{provider}/login", Tag: "auth", Summary: "Redirect to sign in with google or github", Public: true,
+		Status: http.StatusFound, Errors: []int{404}},
+	{Method: "GET", Path: "/auth/{provider}/callback", Tag: "auth", Summary: "Where the provider redirects back; signs in, signs up (201) or finishes a link", Public: true,
+		Query: []param{{"code", "string", "authorization code from the provider"}, {"state", "string", "state from the login redirect"}},
+		Resp:  oauthCallbackResp{}, Errors: []int{400, 401, 403, 404, 409}},
+	{Method: "GET", Path: "/r/{code}", Tag: "auth", Summary: "Referral link: records the click and redirects to the landing page with a referral token", Public: true,
+		Status: http.StatusFound, Errors: []int{404}},
+
+	{Method: "POST", Path: "/callbacks/tasks/complete", Tag: "callbacks", Summary: "A partner reports a task completed by the user linked to its account; a reference already reported is already_completed", Signed: true,
+		Body: PartnerCompleteReq{}, Resp: partnerCompleteResp{}, Errors: []int{400, 403, 404, 409, 410, 422, 503}},
+
+	{Method: "GET", Path: "/health", Tag: "meta", Summary: "Liveness check"},
+	{Method: "GET", Path: "/healthz", Tag: "meta", Summary: "Liveness probe", Public: true,
+		Resp: healthzResp{}},
+	{Method: "GET", Path: "/readyz", Tag: "meta", Summary: "Readiness probe with per-dependency checks; 503 with the same body when one fails", Public: true,
+		Resp: health.Report{}},
+
+	{Method: "GET", Path: "/users/search", Tag: "users", Summary: "Find users by username prefix or a similar name, best match first; needs users:read unless USER_SEARCH is on",
+		Query: []param{{"q", "string", "the username, or the start of it, to look for"}, limitParam, {"cursor", "string", "next_cursor from the previous page"}},
+		Resp:  userSearchResp{}, Errors: []int{400, 403}},
+	{Method: "GET", Path: "/users/{id}/status", Tag: "users", Summary: "User info, completion count, latest completed tasks and streak",
+		Resp: statusResp{}, Errors: []int{403, 404}, Conditional: true},
+	{Method: "GET", Path: "/users/{id}/tasks", Tag: "users", Summary: "The user's completed tasks, newest first",
+		Query: []param{limitParam, {"cursor", "string", "next_cursor from the previous page"}}, Resp: completedTasksResp{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/profile", Tag: "users", Summary: "Display name, avatar, time zone and locale",
+		Resp: repository.Profile{}, Errors: []int{403, 404}},
+	{Method: "PATCH", Path: "/users/{id}/profile", Tag: "users", Summary: "Change profile fields; omitted fields are kept",
+		Body: service.ProfileInput{}, Resp: repository.Profile{}, Errors: []int{400, 403, 404, 409}},
+	{Method: "GET", Path: "/users/{id}/settings", Tag: "users", Summary: "Privacy settings",
+		Resp: repository.Settings{}, Errors: []int{403, 404}},
+	{Method: "PATCH", Path: "/users/{id}/settings", Tag: "users", Summary: "Change settings, e.g. hide from leaderboards; omitted fields are kept",
+		Body: service.SettingsInput{}, Resp: repository.Settings{}, Errors: []int{400, 403, 404}},
+	{Method: "DELETE", Path: "/users/{id}", Tag: "users", Summary: "Delete the account and scrub its personal data",
+		Status: http.StatusNoContent, Errors: []int{400, 403, 404}},
+	{Method: "POST", Path: "/users/{id}/oauth/{provider}/link", Tag: "users", Summary: "Start linking a google or github account; open the returned url in the same browser",
+		Resp: urlResp{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/identities", Tag: "users", Summary: "The outside accounts linked to the user: login providers, telegram and partners",
+		Resp: identitiesResp{}, Errors: []int{400, 403, 404}},
+	{Method: "POST", Path: "/users/{id}/identities", Tag: "users", Summary: "Link a telegram account with a signed login for it, or a partner account (needs users:manage)",
+		Body: LinkIdentityReq{}, Status: http.StatusCreated, Resp: repository.ExternalIdentity{}, Errors: []int{400, 403, 404, 409, 503}},
+	{Method: "DELETE", Path: "/users/{id}/identities/{provider}", Tag: "users", Summary: "Unlink the user's account from a provider; the last way to sign in without a password stays",
+		Status: http.StatusNoContent, Errors: []int{400, 403, 404, 409}},
+	{Method: "GET", Path: "/users/leaderboard", Tag: "users", Summary: "Users ranked by points",
+		Query: []param{limitParam, periodParam, formatParam,
+			{"cursor", "string", "next_cursor from the previous page"},
+			{"after_points", "integer", "start after this position (with after_id)"},
+			{"after_id", "integer", "start after this position (with after_points)"}},
+		Resp: leaderboardResp{}, Errors: []int{400}, Conditional: true},
+	{Method: "GET", Path: "/users/leaderboard/stream", Tag: "users", Media: "text/event-stream",
+		Summary: "Server-sent events: a snapshot, then leaderboard deltas and rank-up notifications"},
+	{Method: "GET", Path: "/users/{id}/percentile", Tag: "users", Summary: "Share of users outranked",
+		Resp: service.Percentile{}, Errors: []int{403, 404}},
+	{Method: "GET", Path: "/users/{id}/rank", Tag: "users", Summary: "Leaderboard position and the gap to the next place",
+		Query: []param{periodParam}, Resp: service.Rank{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/leaderboard/friends", Tag: "users", Summary: "The user ranked among their referrer and the users they referred",
+		Query: []param{limitParam, periodParam}, Resp: service.FriendsBoard{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/points/history", Tag: "users", Summary: "Points ledger, newest first",
+		Query: []param{limitParam, beforeParam}, Resp: historyResp{}, Errors: []int{400, 403}},
+	{Method: "GET", Path: "/users/{id}/points/balance", Tag: "users", Summary: "Balance as of a point in time, from the points stream",
+		Query: []param{{"at", "string", "RFC 3339 time, now by default"}}, Resp: service.PointsBalance{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/export", Tag: "users", Summary: "Export the user's data; large accounts get 202 and a queued export",
+		Query: []param{{"format", "string", "json (default) or csv, a zip of CSV files"}, {"async", "boolean", "queue the export even for small accounts"}},
+		Resp:  service.ExportDocument{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/exports/{export_id}", Tag: "users", Summary: "A queued export and, once ready, its download_url",
+		Resp: ExportResp{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/exports/{export_id}/download", Tag: "users", Summary: "Download a ready export",
+		Media: "application/octet-stream", Errors: []int{400, 403, 404, 409}},
+	{Method: "POST", Path: "/users/{id}/task/complete", Tag: "users", Summary: "Complete a task and collect its points",
+		Body: CompleteTaskReq{Proof: json.RawMessage("{}")}, Resp: completeResp{}, Errors: []int{400, 403, 409, 410, 422, 503}},
+	{Method: "POST", Path: "/users/{id}/checkin", Tag: "users", Summary: "Check in for the day and collect the reward for the run of days",
+		Resp: service.Checkin{}, Errors: []int{403, 404, 409}},
+	{Method: "GET", Path: "/users/{id}/submissions", Tag: "users", Summary: "The user's proof submissions for tasks that require review, oldest first",
+		Query: []param{submissionStatusParam, limitParam, afterParam}, Resp: submissionsResp{}, Errors: []int{400, 403}},
+	{Method: "GET", Path: "/users/{id}/notifications", Tag: "notifications", Summary: "The user's notifications, newest first, and how many are unread",
+		Query: []param{{"unread", "boolean", "only unread notifications"}, limitParam, beforeParam}, Resp: notificationsResp{}, Errors: []int{400, 403, 404}},
+	{Method: "POST", Path: "/users/{id}/notifications/read", Tag: "notifications", Summary: "Mark the listed notifications read, or all of them",
+		Body: MarkNotificationsReadReq{}, Resp: markedResp{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/notifications/channels", Tag: "notifications", Summary: "Where the user has notifications sent, and the channels available",
+		Resp: service.ChannelSettings{}, Errors: []int{403, 404}},
+	{Method: "PUT", Path: "/users/{id}/notifications/channels/{channel}", Tag: "notifications", Summary: "Send the user's notifications on a channel (email, push) to an address",
+		Body: service.ChannelInput{}, Resp: repository.ChannelSetting{}, Errors: []int{400, 403, 404}},
+	{Method: "DELETE", Path: "/users/{id}/notifications/channels/{channel}", Tag: "notifications", Summary: "Stop sending the user's notifications on a channel",
+		Status: http.StatusNoContent, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/users/{id}/features", Tag: "users", Summary: "Which feature flags are on for the user",
+		Resp: featuresResp{}, Errors: []int{400, 403, 404}},
+	{Method: "POST", Path: "/users/{id}/referrer", Tag: "users", Summary: "Set the user's referrer and pay referral bonuses, or leave them pending until the payout milestone",
+		Body: ReferrerReq{}, Resp: referrerResp{}, Errors: []int{400, 403, 404, 409}},
+	{Method: "GET", Path: "/users/{id}/referrals", Tag: "users", Summary: "Referrals the user made, the one that brought them and what is left of the referrer bonus caps",
+		Resp: service.UserReferrals{}, Errors: []int{403, 404}},
+	{Method: "GET", Path: "/users/{id}/referral-link", Tag: "users", Summary: "The user's referral link code and URL; the code is made on first request",
+		Resp: service.ReferralLink{}, Errors: []int{403, 404}},
+	{Method: "POST", Path: "/users/{id}/transfer", Tag: "users", Summary: "Gift points to another user",
+		Body: TransferReq{}, Resp: transferResp{}, Errors: []int{400, 403, 404, 409, 422}},
+	{Method: "GET", Path: "/users/{id}/team", Tag: "teams", Summary: "The user's team and its members",
+		Resp: service.TeamDetails{}, Errors: []int{403, 404}},
+	{Method: "POST", Path: "/users/{id}/team", Tag: "teams", Summary: "Create a team with the user as its first member",
+		Body: CreateTeamReq{}, Status: http.StatusCreated, Resp: service.TeamDetails{}, Errors: []int{400, 403, 404, 409}},
+	{Method: "PUT", Path: "/users/{id}/team", Tag: "teams", Summary: "Join a team",
+		Body: JoinTeamReq{}, Resp: service.TeamDetails{}, Errors: []int{400, 403, 404, 409}},
+	{Method: "DELETE", Path: "/users/{id}/team", Tag: "teams", Summary: "Leave the user's team; the last member out disbands it",
+		Status: http.StatusNoContent, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/widgets/leaderboard", Tag: "public", Summary: "The top of the leaderboard as an HTML page to embed in an iframe, for PUBLIC_ROUTES including widget", Public: true, Media: "text/html",
+		Query: []param{{"top", "integer", "entries, 10 by default and at most 50"}, periodParam,
+			{"theme", "string", "light (default) or dark"}, {"size", "string", "small, medium (default) or large"}},
+		Errors: []int{400}},
+	{Method: "GET", Path: "/public/leaderboard", Tag: "public", Summary: "The top of the leaderboard with display names only, for PUBLIC_ROUTES including leaderboard", Public: true,
+		Query: []param{{"limit", "integer", "page size, 10 by default and at most 50"}, periodParam}, Resp: service.PublicBoard{}, Errors: []int{400}},
+	{Method: "GET", Path: "/public/stats/points-distribution", Tag: "public", Summary: "GET /stats/points-distribution without a token, for PUBLIC_ROUTES including stats", Public: true,
+		Query: []param{periodParam, {"buckets", "integer", "histogram buckets, 10 by default and at most 50"}}, Resp: service.PointsDistribution{}, Errors: []int{400}},
+	{Method: "GET", Path: "/stats/points-distribution", Tag: "stats", Summary: "Percentiles and a histogram of users' points, recounted periodically",
+		Query: []param{periodParam, {"buckets", "integer", "histogram buckets, 10 by default and at most 50"}}, Resp: service.PointsDistribution{}, Errors: []int{400}},
+	{Method: "GET", Path: "/teams/leaderboard", Tag: "teams", Summary: "Teams ranked by points earned by their members",
+		Query: []param{limitParam,
+			{"cursor", "string", "next_cursor from the previous page"},
+			{"after_points", "integer", "start after this position (with after_id)"},
+			{"after_id", "integer", "start after this position (with after_points)"}},
+		Resp: teamLeaderboardResp{}, Errors: []int{400}},
+	{Method: "GET", Path: "/teams/{team_id}", Tag: "teams", Summary: "A team and its members",
+		Resp: service.TeamDetails{}, Errors: []int{400, 404}},
+	{Method: "GET", Path: "/seasons", Tag: "seasons", Summary: "Every season, latest first",
+		Resp: seasonsResp{}},
+	{Method: "GET", Path: "/seasons/{season_id}", Tag: "seasons", Summary: "A season and its status",
+		Resp: repository.Season{}, Errors: []int{400, 404}},
+	{Method: "GET", Path: "/seasons/{season_id}/leaderboard", Tag: "seasons", Summary: "Users ranked by points earned in the season; final standings once it is over",
+		Query: []param{limitParam,
+			{"cursor", "string", "next_cursor from the previous page"},
+			{"after_points", "integer", "start after this position (with after_id)"},
+			{"after_id", "integer", "start after this position (with after_points)"}},
+		Resp: seasonLeaderboardResp{}, Errors: []int{400, 404}},
+
+	{Method: "GET", Path: "/campaigns", Tag: "campaigns", Summary: "Campaigns running or yet to start, soonest to end first",
+		Resp: campaignsResp{}},
+
+	{Method: "POST", Path: "/receipts/verify", Tag: "tasks", Summary: "Check a task completion receipt",
+		Body: VerifyReceiptReq{}, Resp: receiptResp{}, Errors: []int{400}},
+	{Method: "GET", Path: "/tasks", Tag: "tasks", Summary: "Tasks the caller can complete now, with progress",
+		Query: []param{{"preview", "string", "upcoming: also list scheduled tasks (needs tasks:manage)"},
+			{"category", "string", "only tasks in this category"},
+			{"tag", "string", "only tasks with this tag"},
+			{"status", "string", "available, locked, completed or upcoming"}},
+		Resp: userTasksResp{}, Errors: []int{400, 403, 404}},
+	{Method: "GET", Path: "/categories", Tag: "tasks", Summary: "Task categories in display order",
+		Resp: categoriesResp{}},
+
+	{Method: "GET", Path: "/admin/tasks", Tag: "admin", Summary: "All tasks, including archived and scheduled ones",
+		Perm: service.PermTasksManage, Resp: tasksResp{}},
+	{Method: "POST", Path: "/admin/tasks", Tag: "admin", Summary: "Create a task",
+		Perm: service.PermTasksManage, Body: service.TaskInput{}, Status: http.StatusCreated, Resp: repository.Task{}, Errors: []int{400, 409}},
+	{Method: "PUT", Path: "/admin/tasks/{code}", Tag: "admin", Summary: "Replace a task's fields",
+		Perm: service.PermTasksManage, Body: service.TaskInput{}, Resp: repository.Task{}, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/tasks/{code}", Tag: "admin", Summary: "Archive a task",
+		Perm: service.PermTasksManage, Status: http.StatusNoContent, Errors: []int{404}},
+	{Method: "GET", Path: "/admin/tasks/{code}/translations", Tag: "admin", Summary: "A task's translations, by locale",
+		Perm: service.PermTasksManage, Resp: translationsResp{}, Errors: []int{404}},
+	{Method: "PUT", Path: "/admin/tasks/{code}/translations/{locale}", Tag: "admin", Summary: "Add or replace a task's title and description in a locale",
+		Perm: service.PermTasksManage, Body: service.TranslationInput{}, Resp: repository.TaskTranslation{}, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/tasks/{code}/translations/{locale}", Tag: "admin", Summary: "Delete a translation",
+		Perm: service.PermTasksManage, Status: http.StatusNoContent, Errors: []int{404}},
+	{Method: "GET", Path: "/admin/categories", Tag: "admin", Summary: "Task categories in display order",
+		Perm: service.PermTasksManage, Resp: categoriesResp{}},
+	{Method: "POST", Path: "/admin/categories", Tag: "admin", Summary: "Create a task category",
+		Perm: service.PermTasksManage, Body: service.CategoryInput{}, Status: http.StatusCreated, Resp: repository.Category{}, Errors: []int{400, 409}},
+	{Method: "PUT", Path: "/admin/categories/{code}", Tag: "admin", Summary: "Replace a category's name, description and position",
+		Perm: service.PermTasksManage, Body: service.CategoryInput{}, Resp: repository.Category{}, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/categories/{code}", Tag: "admin", Summary: "Delete a category; its tasks are left without one",
+		Perm: service.PermTasksManage, Status: http.StatusNoContent, Errors: []int{404}},
+	{Method: "GET", Path: "/admin/submissions", Tag: "admin", Summary: "Proof submissions, oldest first",
+		Perm:  service.PermTasksManage,
+		Query: []param{submissionStatusParam, {"task", "string", "task code"}, {"user_id", "integer", "submitting user"}, limitParam, afterParam},
+		Resp:  submissionsResp{}, Errors: []int{400}},
+	{Method: "POST", Path: "/admin/submissions/{submission_id}/approve", Tag: "admin", Summary: "Approve a pending submission and award the task's points",
+		Perm: service.PermTasksManage, Resp: repository.TaskSubmission{}, Errors: []int{400, 404, 409, 410}},
+	{Method: "POST", Path: "/admin/submissions/{submission_id}/reject", Tag: "admin", Summary: "Reject a pending submission",
+		Perm: service.PermTasksManage, Body: RejectSubmissionReq{}, Resp: repository.TaskSubmission{}, Errors: []int{400, 404, 409}},
+
+	{Method: "GET", Path: "/admin/roles", Tag: "admin", Summary: "Roles and the permissions they grant",
+		Perm: service.PermRolesManage, Resp: rolesResp{}},
+	{Method: "GET", Path: "/admin/users/{id}/roles", Tag: "admin", Summary: "Roles held by a user",
+		Perm: service.PermRolesManage, Resp: userRolesResp{}, Errors: []int{400, 404}},
+	{Method: "PUT", Path: "/admin/users/{id}/roles/{role}", Tag: "admin", Summary: "Grant a role",
+		Perm: service.PermRolesManage, Status: http.StatusNoContent, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/users/{id}/roles/{role}", Tag: "admin", Summary: "Revoke a role",
+		Perm: service.PermRolesManage, Status: http.StatusNoContent, Errors: []int{400, 404}},
+
+	{Method: "GET", Path: "/admin/audit", Tag: "admin", Summary: "Audit events, newest first",
+		Perm: service.PermAuditRead,
+		Query: []param{limitParam, beforeParam,
+			{"actor_id", "integer", ""}, {"action", "string", ""}, {"target_type", "string", ""}, {"target_id", "string", ""},
+			{"since", "string", "RFC 3339"}, {"until", "string", "RFC 3339"}},
+		Resp: auditResp{}, Errors: []int{400}},
+	{Method: "GET", Path: "/admin/reports", Tag: "admin", Summary: "Activity, points and referral stats per UTC day",
+		Perm:  service.PermReportsRead,
+		Query: []param{{"from", "string", "YYYY-MM-DD, defaults to 29 days before to"}, {"to", "string", "YYYY-MM-DD, inclusive, defaults to today"}, formatParam},
+		Resp:  service.ActivityReport{}, Errors: []int{400}},
+	{Method: "GET", Path: "/admin/reports/referrals", Tag: "admin", Summary: "Referral link clicks, the signups they led to and first tasks, per referrer",
+		Perm:  service.PermReportsRead,
+		Query: []param{{"from", "string", "YYYY-MM-DD, defaults to 29 days before to"}, {"to", "string", "YYYY-MM-DD, inclusive, defaults to today"}, limitParam},
+		Resp:  service.ReferralReport{}, Errors: []int{400}},
+	{Method: "GET", Path: "/admin/breakers", Tag: "admin", Summary: "This instance's circuit breakers: state, calls in flight and counters",
+		Perm: service.PermReportsRead, Resp: BreakersResp{}},
+	{Method: "GET", Path: "/admin/points/discrepancies", Tag: "admin", Summary: "Balances that differed from the ledger at the last reconciliation, by user id",
+		Perm: service.PermPointsManage, Query: []param{limitParam, afterParam},
+		Resp: discrepanciesResp{}, Errors: []int{400}},
+	{Method: "POST", Path: "/admin/points/discrepancies/{user_id}/fix", Tag: "admin", Summary: "Reset a balance to the sum of the user's ledger",
+		Perm: service.PermPointsManage, Resp: service.BalanceFix{}, Errors: []int{400, 404, 409}},
+	{Method: "POST", Path: "/admin/users/{id}/points", Tag: "admin", Summary: "Credit or debit a balance by hand, with a reason for the audit log",
+		Perm: service.PermPointsManage, Body: AdjustPointsReq{}, Resp: service.PointsAdjustment{}, Errors: []int{400, 404, 409}},
+	{Method: "POST", Path: "/admin/exports", Tag: "admin", Summary: "Queue a CSV of a whole report",
+		Perm: service.PermReportsRead, Body: service.ReportExportInput{}, Status: http.StatusAccepted, Resp: ReportExportResp{}, Errors: []int{400}},
+	{Method: "GET", Path: "/admin/exports/{id}", Tag: "admin", Summary: "A queued report export and, once ready, its download_url",
+		Perm: service.PermReportsRead, Resp: ReportExportResp{}, Errors: []int{400, 404}},
+	{Method: "GET", Path: "/admin/exports/{id}/download", Tag: "admin", Summary: "Download a ready report export",
+		Perm: service.PermReportsRead, Media: "text/csv", Errors: []int{400, 404, 409}},
+	{Method: "POST", Path: "/admin/users/{id}/restore", Tag: "admin", Summary: "Restore a deleted user within the grace period",
+		Perm: service.PermUsersWrite, Resp: userResp{}, Errors: []int{400, 404, 409}},
+	{Method: "GET", Path: "/admin/users", Tag: "admin", Summary: "Search users, newest first",
+		Perm: service.PermUsersManage,
+		Query: []param{limitParam, beforeParam,
+			{"username_prefix", "string", ""}, {"min_points", "integer", ""},
+			{"created_after", "string", "RFC 3339"}, {"status", "string", "active, suspended or banned"}},
+		Resp: usersResp{}, Errors: []int{400}},
+	{Method: "GET", Path: "/admin/users/{id}", Tag: "admin", Summary: "A user with their profile, completed tasks, streak and roles",
+		Perm: service.PermUsersManage, Resp: service.UserDetails{}, Errors: []int{400, 404}},
+	{Method: "GET", Path: "/admin/users/{id}/ledger", Tag: "admin", Summary: "A user's points ledger, newest first",
+		Perm: service.PermUsersManage, Query: []param{limitParam, beforeParam}, Resp: historyResp{}, Errors: []int{400}},
+	{Method: "PUT", Path: "/admin/users/{id}/status", Tag: "admin", Summary: "Activate, suspend or ban a user",
+		Perm: service.PermUsersManage, Body: service.StatusInput{}, Resp: userResp{}, Errors: []int{400, 404}},
+	{Method: "POST", Path: "/admin/users/{id}/ban", Tag: "admin", Summary: "Ban a user or change the ban reason",
+		Perm: service.PermUsersManage, Body: BanReq{}, Resp: userResp{}, Errors: []int{400, 404}},
+	{Method: "POST", Path: "/admin/users/{id}/unban", Tag: "admin", Summary: "Lift a user's ban",
+		Perm: service.PermUsersManage, Resp: userResp{}, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/users/{id}/referrer", Tag: "admin", Summary: "Unset a user's referrer so another can be set",
+		Perm: service.PermUsersManage, Resp: userResp{}, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/users/{id}/tasks/{code}", Tag: "admin", Summary: "Revoke the user's latest completion of a task and debit what it awarded",
+		Perm: service.PermUsersManage, Query: []param{{"reason", "string", "why, recorded in the audit log and event"}},
+		Resp: service.Revocation{}, Errors: []int{400, 404, 409}},
+	{Method: "GET", Path: "/admin/users/{id}/duplicates", Tag: "admin", Summary: "Other users sharing an email address with a user",
+		Perm: service.PermUsersManage, Resp: duplicatesResp{}, Errors: []int{400, 404}},
+	{Method: "POST", Path: "/admin/users/{id}/merge", Tag: "admin", Summary: "Merge a duplicate account into this user and delete it",
+		Perm: service.PermUsersManage, Body: MergeUsersReq{}, Resp: service.Merge{}, Errors: []int{400, 404, 409}},
+	{Method: "POST", Path: "/admin/tokens/revoke", Tag: "admin", Summary: "Reject an access token, by itself or its jti, or all of a user's tokens before they expire",
+		Perm: service.PermUsersManage, Body: service.RevokeTokenInput{}, Resp: service.TokenRevocation{}, Errors: []int{400, 404}},
+	{Method: "POST", Path: "/admin/tokens/introspect", Tag: "admin", Summary: "Whether an access token would be accepted, and its claims",
+		Perm: service.PermUsersManage, Body: IntrospectReq{}, Resp: service.TokenInfo{}, Errors: []int{400}},
+
+	{Method: "POST", Path: "/admin/seasons", Tag: "admin", Summary: "Schedule a season",
+		Perm: service.PermSeasonsManage, Body: service.SeasonInput{}, Status: http.StatusCreated, Resp: repository.Season{}, Errors: []int{400, 409}},
+	{Method: "POST", Path: "/admin/seasons/archive", Tag: "admin", Summary: "Archive seasons that are over now, instead of at the next archive_seasons run",
+		Perm: service.PermSeasonsManage, Resp: archivedSeasonsResp{}},
+	{Method: "PUT", Path: "/admin/seasons/{season_id}", Tag: "admin", Summary: "Change a season's name or window; started seasons only their name and end",
+		Perm: service.PermSeasonsManage, Body: service.SeasonInput{}, Resp: repository.Season{}, Errors: []int{400, 404, 409}},
+	{Method: "DELETE", Path: "/admin/seasons/{season_id}", Tag: "admin", Summary: "Delete a season that hasn't started",
+		Perm: service.PermSeasonsManage, Status: http.StatusNoContent, Errors: []int{400, 404, 409}},
+
+	{Method: "GET", Path: "/admin/campaigns", Tag: "admin", Summary: "Every campaign, latest first",
+		Perm: service.PermCampaignsManage, Resp: campaignsResp{}},
+	{Method: "POST", Path: "/admin/campaigns", Tag: "admin", Summary: "Schedule a campaign",
+		Perm: service.PermCampaignsManage, Body: service.CampaignInput{}, Status: http.StatusCreated, Resp: repository.Campaign{}, Errors: []int{400}},
+	{Method: "GET", Path: "/admin/campaigns/{campaign_id}", Tag: "admin", Summary: "A campaign and its status",
+		Perm: service.PermCampaignsManage, Resp: repository.Campaign{}, Errors: []int{400, 404}},
+	{Method: "PUT", Path: "/admin/campaigns/{campaign_id}", Tag: "admin", Summary: "Change a campaign; started campaigns only their name and end",
+		Perm: service.PermCampaignsManage, Body: service.CampaignInput{}, Resp: repository.Campaign{}, Errors: []int{400, 404, 409}},
+	{Method: "DELETE", Path: "/admin/campaigns/{campaign_id}", Tag: "admin", Summary: "Delete a campaign that hasn't started",
+		Perm: service.PermCampaignsManage, Status: http.StatusNoContent, Errors: []int{400, 404, 409}},
+	{Method: "GET", Path: "/admin/campaigns/{campaign_id}/report", Tag: "admin", Summary: "Completions, users and points a campaign added, overall and per task",
+		Perm: service.PermCampaignsManage, Resp: service.CampaignReport{}, Errors: []int{400, 404}},
+
+	{Method: "GET", Path: "/admin/award-rules", Tag: "admin", Summary: "Every award rule, in the order they apply",
+		Perm: service.PermRulesManage, Resp: awardRulesResp{}},
+	{Method: "POST", Path: "/admin/award-rules", Tag: "admin", Summary: "Define an award rule",
+		Perm: service.PermRulesManage, Body: service.AwardRuleInput{}, Status: http.StatusCreated, Resp: repository.AwardRule{}, Errors: []int{400}},
+	{Method: "GET", Path: "/admin/award-rules/{rule_id}", Tag: "admin", Summary: "An award rule",
+		Perm: service.PermRulesManage, Resp: repository.AwardRule{}, Errors: []int{400, 404}},
+	{Method: "PUT", Path: "/admin/award-rules/{rule_id}", Tag: "admin", Summary: "Replace an award rule",
+		Perm: service.PermRulesManage, Body: service.AwardRuleInput{}, Resp: repository.AwardRule{}, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/award-rules/{rule_id}", Tag: "admin", Summary: "Delete an award rule",
+		Perm: service.PermRulesManage, Status: http.StatusNoContent, Errors: []int{400, 404}},
+
+	{Method: "PATCH", Path: "/admin/teams/{team_id}", Tag: "admin", Summary: "Rename a team",
+		Perm: service.PermTeamsManage, Body: CreateTeamReq{}, Resp: service.TeamDetails{}, Errors: []int{400, 404, 409}},
+	{Method: "DELETE", Path: "/admin/teams/{team_id}", Tag: "admin", Summary: "Disband a team",
+		Perm: service.PermTeamsManage, Status: http.StatusNoContent, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/teams/{team_id}/members/{user_id}", Tag: "admin", Summary: "Remove a member from a team",
+		Perm: service.PermTeamsManage, Status: http.StatusNoContent, Errors: []int{400, 404}},
+
+	{Method: "GET", Path: "/admin/webhooks", Tag: "admin", Summary: "Registered webhook endpoints",
+		Perm: service.PermWebhooksManage, Resp: webhooksResp{}},
+	{Method: "POST", Path: "/admin/webhooks", Tag: "admin", Summary: "Register a webhook endpoint",
+		Perm: service.PermWebhooksManage, Body: service.WebhookInput{}, Status: http.StatusCreated, Resp: webhookCreatedResp{}, Errors: []int{400}},
+	{Method: "DELETE", Path: "/admin/webhooks/{id}", Tag: "admin", Summary: "Disable a webhook endpoint",
+		Perm: service.PermWebhooksManage, Status: http.StatusNoContent, Errors: []int{400, 404}},
+	{Method: "GET", Path: "/admin/webhooks/{id}/deliveries", Tag: "admin", Summary: "An endpoint's delivery log",
+		Perm:  service.PermWebhooksManage,
+		Query: []param{limitParam, beforeParam, {"status", "string", "pending, delivered or failed"}},
+		Resp:  deliveriesResp{}, Errors: []int{400, 404}},
+	{Method: "POST", Path: "/admin/webhooks/deliveries/{id}/retry", Tag: "admin", Summary: "Requeue a delivery",
+		Perm: service.PermWebhooksManage, Status: http.StatusAccepted, Errors: []int{400, 404}},
+
+	{Method: "GET", Path: "/admin/flags", Tag: "admin", Summary: "Feature flags and their current rollout",
+		Perm: service.PermFlagsManage, Resp: flagsResp{}},
+	{Method: "PUT", Path: "/admin/flags/{name}", Tag: "admin", Summary: "Turn a feature flag on or off, or roll it out to a percentage of users",
+		Perm: service.PermFlagsManage, Body: service.FlagInput{}, Resp: service.Flag{}, Errors: []int{400, 404}},
+	{Method: "DELETE", Path: "/admin/flags/{name}", Tag: "admin", Summary: "Put a feature flag back to its configured rollout",
+		Perm: service.PermFlagsManage, Resp: service.Flag{}, Errors: []int{404}},
+	{Method: "GET", Path: "/admin/maintenance", Tag: "admin", Summary: "Maintenance mode as it applies now",
+		Perm: service.PermMaintenanceManage, Resp: service.Maintenance{}},
+	{Method: "PUT", Path: "/admin/maintenance", Tag: "admin", Summary: "Turn maintenance mode on or off, refusing writes with a 503 while it is on",
+		Perm: service.PermMaintenanceManage, Body: service.MaintenanceInput{}, Resp: service.Maintenance{}, Errors: []int{400}},
+	{Method: "DELETE", Path: "/admin/maintenance", Tag: "admin", Summary: "Put maintenance mode back to its configured setting",
+		Perm: service.PermMaintenanceManage, Resp: service.Maintenance{}},
+}
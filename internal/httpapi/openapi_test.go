@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// The embedded spec is what OpenAPI builds from the route table; go generate
+// rewrites it.
+func TestOpenAPISpecIsCurrent(t *testing.T) {
+	spec, err := OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(spec, openAPISpec) {
+		t.Error("openapi.json is stale; run go generate ./internal/httpapi")
+	}
+}
+
+// Every route the router serves with every optional route group on, the
+// legacy unversioned aliases included, has an entry in operations.
+func TestEveryRouteIsDocumented(t *testing.T) {
+	svc := service.New(repository.NewMemory("local"), service.Config{Region: "local"})
+	h, err := New(svc, Config{AdminUI: true, LegacyRoutes: true, PublicRoutes: []string{"leaderboard", "stats", "widget"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	routed := map[string]bool{}
+	err = chi.Walk(h.Routes().(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		key := method + " " + strings.TrimSuffix(route, "/")
+		if slices.Contains(undocumented, key) {
+			return nil
+		}
+		routed[key] = true
+		if !documented(method + " " + strings.TrimPrefix(strings.TrimSuffix(route, "/"), "/v"+apiVersion)) {
+			t.Errorf("%s is routed but not in openapi_routes.go", key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range operations {
+		if !routed[o.Method+" "+o.route()] {
+			t.Errorf("%s %s is documented but not routed", o.Method, o.route())
+		}
+		if !slices.Contains(unversioned, o.Path) && !routed[o.Method+" "+o.Path] {
+			t.Errorf("%s %s has no legacy alias", o.Method, o.Path)
+		}
+	}
+}
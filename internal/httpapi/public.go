@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// publicRoute answers 404, as for a route that doesn't exist, unless
+// Config.PublicRoutes names the route.
+func (h *Handler) publicRoute(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !slices.Contains(h.cfg.PublicRoutes, name) {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				httpError(w, http.StatusNotFound, codeNotFound, "not found")
+			})
+		}
+		return next
+	}
+}
+
+// GetPublicLeaderboard serves the top ?limit= (10 by default, at most 50)
+// of the ?period= leaderboard without a token, with display names only.
+func (h *Handler) GetPublicLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 50 {
+			limit = n
+		}
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "all"
+	}
+	board, err := h.svc.PublicLeaderboard(r.Context(), period, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, board, http.StatusOK)
+}
@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/ratelimit"
+)
+
+// rateLimit applies the group's policy (see Config.RateLimits) per client IP
+// and, for authenticated requests, per user. Over the limit it answers 429
+// with Retry-After. Limiter errors let the request through: losing rate
+// limiting beats losing the API.
+func (h *Handler) rateLimit(group string) func(http.Handler) http.Handler {
+	policy, ok := h.cfg.RateLimits[group]
+	if !ok || h.cfg.Limiter == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			checks := []limitCheck{{group + ":ip:" + clientIP(r), policy.IP}}
+			if id, err := subjectUserID(r); err == nil {
+				checks = append(checks, limitCheck{group + ":user:" + strconv.FormatInt(id, 10), policy.User})
+			}
+
+			for _, c := range checks {
+				allowed, wait, err := h.cfg.Limiter.Allow(r.Context(), c.key, c.rule)
+				if err != nil {
+					log.Printf("rate limit %s: %v", c.key, err)
+					continue
+				}
+				if !allowed {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(wait, time.Second).Seconds()))))
+					httpError(w, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type limitCheck struct {
+	key  string
+	rule ratelimit.Rule
+}
+
+// clientIP is the address set by realIP, without a port.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// chain composes middlewares, outermost first.
+func chain(mws ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
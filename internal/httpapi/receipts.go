@@ -0,0 +1,34 @@
+package httpapi
+
+import (
+	"net/http"
+)
+
+type VerifyReceiptReq struct {
+	Receipt string `json:"receipt"`
+}
+
+func (h *Handler) VerifyReceipt(w http.ResponseWriter, r *http.Request) {
+	var req VerifyReceiptReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Receipt == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+
+	claims, err := h.svc.VerifyReceipt(req.Receipt)
+	if err != nil {
+		jsonWrite(w, map[string]any{"valid": false}, http.StatusOK)
+		return
+	}
+
+	jsonWrite(w, map[string]any{
+		"valid":        true,
+		"user_id":      claims.UserID,
+		"task":         claims.Task,
+		"amount":       claims.Amount,
+		"completed_at": claims.IssuedAt.Time,
+	}, http.StatusOK)
+}
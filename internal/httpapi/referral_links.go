@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// referralCookie holds the token /r/{code} hands out until the visitor
+// signs up.
+const referralCookie = "ref"
+
+// ReferralRedirect records a click on a referral link and sends the visitor
+// to the landing page with the token as ?ref= and in a cookie. Whatever
+// goes wrong, they still land; in maintenance mode the click isn't
+// recorded.
+func (h *Handler) ReferralRedirect(w http.ResponseWriter, r *http.Request) {
+	if !h.svc.ReferralLinksEnabled() {
+		httpError(w, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if h.svc.MaintenanceMode(r.Context()).Enabled {
+		http.Redirect(w, r, h.svc.ReferralLanding(), http.StatusFound)
+		return
+	}
+	var prev string
+	if c, err := r.Cookie(referralCookie); err == nil {
+		prev = c.Value
+	}
+	visit, err := h.svc.VisitReferralLink(r.Context(), chi.URLParam(r, "code"), prev)
+	if err != nil {
+		log.Printf("referral link: %v", err)
+		http.Redirect(w, r, h.svc.ReferralLanding(), http.StatusFound)
+		return
+	}
+	if visit.Token != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     referralCookie,
+			Value:    visit.Token,
+			Path:     "/",
+			Expires:  visit.Expires,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	http.Redirect(w, r, visit.Redirect, http.StatusFound)
+}
+
+// referralToken is the referral token a signup carries: the one in the
+// body, else the cookie's. The cookie is dropped either way.
+func referralToken(w http.ResponseWriter, r *http.Request, body string) string {
+	c, err := r.Cookie(referralCookie)
+	if err != nil {
+		return body
+	}
+	http.SetCookie(w, &http.Cookie{Name: referralCookie, Path: "/", MaxAge: -1})
+	if body != "" {
+		return body
+	}
+	return c.Value
+}
+
+func (h *Handler) GetReferralLink(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	link, err := h.svc.ReferralLink(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, link, http.StatusOK)
+}
+
+// AdminReferralReport is the referral link funnel per referrer.
+func (h *Handler) AdminReferralReport(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportDates(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+	rep, err := h.svc.ReferralReport(r.Context(), from, to, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rep, http.StatusOK)
+}
@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// responseFormat reads ?format=, "json" (the default) or "csv".
+func responseFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch f := r.URL.Query().Get("format"); f {
+	case "", "json":
+		return "json", true
+	case "csv":
+		return f, true
+	}
+	httpError(w, http.StatusBadRequest, codeBadRequest, "format must be json or csv")
+	return "", false
+}
+
+// writeCSV streams rep as an attachment.
+func writeCSV(w http.ResponseWriter, r *http.Request, rep *service.CSVReport) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", rep.Filename))
+	if err := rep.Write(r.Context(), w); err != nil {
+		// as for ExportUser: a failed download beats a truncated file
+		log.Printf("write %s: %v", rep.Filename, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// reportDates reads a report's ?from= and ?to= days, nil when left out.
+func reportDates(w http.ResponseWriter, r *http.Request) (from, to *time.Time, ok bool) {
+	q := r.URL.Query()
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "invalid "+p.name+", want YYYY-MM-DD")
+			return nil, nil, false
+		}
+		*p.dst = &t
+	}
+	return from, to, true
+}
+
+func (h *Handler) AdminReports(w http.ResponseWriter, r *http.Request) {
+	format, ok := responseFormat(w, r)
+	if !ok {
+		return
+	}
+	from, to, ok := reportDates(w, r)
+	if !ok {
+		return
+	}
+
+	if format == "csv" {
+		rep, err := h.svc.ActivityReportCSV(r.Context(), from, to)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeCSV(w, r, rep)
+		return
+	}
+	rep, err := h.svc.ActivityReport(r.Context(), from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rep, http.StatusOK)
+}
+
+// ReportExportResp is a queued report export; DownloadURL is set once it
+// is ready.
+type ReportExportResp struct {
+	repository.ReportExport
+	DownloadURL *string `json:"download_url"`
+}
+
+func reportExportResp(r *http.Request, e repository.ReportExport) ReportExportResp {
+	resp := ReportExportResp{ReportExport: e}
+	if e.Status == "ready" {
+		u := apiPath(r, fmt.Sprintf("/admin/exports/%d/download", e.ID))
+		resp.DownloadURL = &u
+	}
+	return resp
+}
+
+func (h *Handler) AdminCreateReportExport(w http.ResponseWriter, r *http.Request) {
+	var in service.ReportExportInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	e, err := h.svc.QueueReportExport(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", apiPath(r, fmt.Sprintf("/admin/exports/%d", e.ID)))
+	jsonWrite(w, reportExportResp(r, e), http.StatusAccepted)
+}
+
+func (h *Handler) AdminGetReportExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	e, err := h.svc.ReportExport(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, reportExportResp(r, e), http.StatusOK)
+}
+
+func (h *Handler) AdminDownloadReportExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	_, filename, content, err := h.svc.ReportExportCSV(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(content)
+}
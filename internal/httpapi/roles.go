@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) AdminListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.svc.ListRoles(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"roles": roles}, http.StatusOK)
+}
+
+func (h *Handler) AdminUserRoles(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+	roles, err := h.svc.UserRoles(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"user_id": id, "roles": roles}, http.StatusOK)
+}
+
+func (h *Handler) AdminAssignRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.AssignRole(r.Context(), id, chi.URLParam(r, "role")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminRevokeRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.RevokeRole(r.Context(), id, chi.URLParam(r, "role")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminUserID parses {id} on routes already guarded by a permission.
+func adminUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "bad user id")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// SearchUsers finds users by ?q=, a username prefix or a misspelling of
+// one, paged with ?limit= and the next_cursor of the previous page.
+// Callers with users:read find everyone; with Config.UserSearch anyone
+// else finds the users listed on leaderboards by name, and without it gets
+// 403.
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	everyone, err := can(r, service.PermUsersRead)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !everyone && !h.cfg.UserSearch {
+		httpError(w, http.StatusForbidden, codeForbidden, "forbidden")
+		return
+	}
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	var after *repository.UserMatchCursor
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		c, err := decodeUserMatchCursor(v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad cursor")
+			return
+		}
+		after = &c
+	}
+	page, err := h.svc.FindUsers(r.Context(), r.URL.Query().Get("q"), !everyone, limit, after)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"users": page.Items, "next_cursor": nil}
+	if page.Next != nil {
+		resp["next_cursor"] = base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", page.Next.Score, page.Next.ID)))
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func decodeUserMatchCursor(v string) (repository.UserMatchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return repository.UserMatchCursor{}, err
+	}
+	score, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return repository.UserMatchCursor{}, errors.New("malformed cursor")
+	}
+	var c repository.UserMatchCursor
+	if c.Score, err = strconv.Atoi(score); err != nil {
+		return c, err
+	}
+	c.ID, err = strconv.ParseInt(id, 10, 64)
+	return c, err
+}
@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+func (h *Handler) ListSeasons(w http.ResponseWriter, r *http.Request) {
+	seasons, err := h.svc.Seasons(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"seasons": seasons}, http.StatusOK)
+}
+
+func (h *Handler) GetSeason(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "season_id")
+	if !ok {
+		return
+	}
+	se, err := h.svc.Season(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, se, http.StatusOK)
+}
+
+// GetSeasonLeaderboard pages a season's leaderboard like GetLeaderboard,
+// with the same cursors.
+func (h *Handler) GetSeasonLeaderboard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "season_id")
+	if !ok {
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	after, err := leaderboardCursor(r)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "bad cursor")
+		return
+	}
+	page, err := h.svc.SeasonLeaderboard(r.Context(), id, limit, after)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"season_id": id, "leaderboard": page.Items, "total": page.Total, "next_cursor": nil}
+	if page.Next != nil {
+		resp["next_cursor"] = encodeLeaderboardCursor(*page.Next)
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func (h *Handler) AdminCreateSeason(w http.ResponseWriter, r *http.Request) {
+	var in service.SeasonInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	se, err := h.svc.CreateSeason(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, se, http.StatusCreated)
+}
+
+func (h *Handler) AdminArchiveSeasons(w http.ResponseWriter, r *http.Request) {
+	archived, err := h.svc.ArchiveEndedSeasons(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"archived": archived}, http.StatusOK)
+}
+
+func (h *Handler) AdminUpdateSeason(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "season_id")
+	if !ok {
+		return
+	}
+	var in service.SeasonInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	se, err := h.svc.UpdateSeason(r.Context(), id, in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, se, http.StatusOK)
+}
+
+func (h *Handler) AdminDeleteSeason(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "season_id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteSeason(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
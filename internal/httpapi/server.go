@@ -0,0 +1,386 @@
+// Package httpapi is the HTTP transport: routing, middleware, request
+// decoding and mapping service errors to JSON error responses.
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/example/go-user-tasks/internal/breaker"
+	"github.com/example/go-user-tasks/internal/health"
+	"github.com/example/go-user-tasks/internal/ratelimit"
+	"github.com/example/go-user-tasks/internal/service"
+	"github.com/example/go-user-tasks/internal/telemetry"
+)
+
+type Config struct {
+	ReadDeadline  time.Duration
+	WriteDeadline time.Duration
+	// RouteDeadlines overrides those for single routes, keyed by method and
+	// path as the API spec has them, e.g. "GET /users/{id}/export".
+	RouteDeadlines map[string]time.Duration
+	// MaxBodyBytes caps request bodies, answering 413 past it, and
+	// MaxJSONDepth how deeply a JSON body may nest.
+	MaxBodyBytes int64
+	MaxJSONDepth int
+	// LeaderboardMaxAge and StatusMaxAge are the Cache-Control max-age of
+	// GET /users/leaderboard and /users/{id}/status, which carry ETags.
+	LeaderboardMaxAge time.Duration
+	StatusMaxAge      time.Duration
+	// RegionURLs maps region names to base URLs that writes for users homed
+	// there are forwarded to.
+	RegionURLs map[string]string
+	// Limiter enforces RateLimits, keyed by route group: "auth" for /auth/*,
+	// "public" for /public/*, "read" and "write" for the rest. Nil disables
+	// rate limiting.
+	Limiter    ratelimit.Limiter
+	RateLimits map[string]ratelimit.Policy
+	// Leaderboard feeds GET /users/leaderboard/stream.
+	Leaderboard *service.LeaderboardHub
+	// Health runs the checks behind GET /readyz; nil means always ready.
+	Health *health.Checker
+	// LegacyRoutes serves the /v1 routes at their unversioned paths too,
+	// marked deprecated and, when LegacySunset is set, with the date they
+	// go away.
+	LegacyRoutes bool
+	LegacySunset time.Time
+	CORS         CORS
+	Compression  Compression
+	// AdminUI serves the admin dashboard at /admin/ui/.
+	AdminUI bool
+	// UserSearch opens GET /users/search to every user, not only those
+	// with users:read.
+	UserSearch bool
+	// PublicRoutes are the routes served without a token: "leaderboard"
+	// and "stats" under /public, and "widget" for /widgets/leaderboard,
+	// which the sites WidgetFrameAncestors lists may frame, or any when
+	// it is empty.
+	PublicRoutes         []string
+	WidgetFrameAncestors []string
+	// Breakers are listed at /admin/breakers; nil means there are none.
+	// With MaxRequests set, API requests beyond that many in flight are
+	// shed with a 503, counted by the "api" breaker.
+	Breakers    *breaker.Registry
+	MaxRequests int
+	// TrustedProxies are the peers whose X-Forwarded-For is believed, or
+	// every peer when empty. AdminAllowedNetworks, when set, are the only
+	// networks /admin answers.
+	TrustedProxies       []netip.Prefix
+	AdminAllowedNetworks []netip.Prefix
+	// CallbackPartners maps partner names to the secrets their /callbacks
+	// requests are signed with; signatures are good for
+	// CallbackReplayWindow either side of their timestamp.
+	CallbackPartners     map[string]string
+	CallbackReplayWindow time.Duration
+}
+
+type Handler struct {
+	svc      *service.Service
+	cfg      Config
+	proxies  map[string]*httputil.ReverseProxy
+	inFlight *breaker.Breaker
+}
+
+func New(svc *service.Service, cfg Config) (*Handler, error) {
+	h := &Handler{svc: svc, cfg: cfg, proxies: map[string]*httputil.ReverseProxy{}}
+	if cfg.Breakers != nil && cfg.MaxRequests > 0 {
+		h.inFlight = cfg.Breakers.Get("api", breaker.Settings{MaxConcurrent: cfg.MaxRequests})
+	}
+	for key := range cfg.RouteDeadlines {
+		if !documented(key) {
+			return nil, fmt.Errorf("deadline for unknown route %q", key)
+		}
+	}
+	for name, raw := range cfg.RegionURLs {
+		if name == svc.Region() {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("bad url for region %s: %q", name, raw)
+		}
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		proxy.Transport = otelhttp.NewTransport(http.DefaultTransport)
+		h.proxies[name] = proxy
+	}
+	return h, nil
+}
+
+func (h *Handler) Routes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(h.realIP)
+	r.Use(h.restrictAdmin)
+	r.Use(requestLogger)
+	r.Use(middleware.Recoverer)
+	r.Use(telemetry.NameSpan)
+	r.Use(h.cors)
+	r.Use(h.compress)
+	r.Use(h.limitBody)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		httpError(w, http.StatusNotFound, codeNotFound, "not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		httpError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+	})
+
+	r.Get("/openapi.json", h.OpenAPIJSON)
+	r.Get("/docs", h.Docs)
+	if h.cfg.AdminUI {
+		r.Get("/admin/ui", http.RedirectHandler("/admin/ui/", http.StatusMovedPermanently).ServeHTTP)
+		r.Get("/admin/ui/*", adminUI().ServeHTTP)
+	}
+
+	// probes: no auth or rate limits
+	r.Get("/healthz", h.Healthz)
+	r.Get("/readyz", h.Readyz)
+
+	// OAuth providers send users back to the URL registered with them,
+	// so it stays put across API versions.
+	auth := chain(h.withDeadline(h.cfg.WriteDeadline), h.rateLimit("auth"))
+	r.With(auth).Get("/auth/{provider}/callback", h.OAuthCallback)
+	// referral links are shared, so they stay put too
+	r.With(h.limitInFlight, h.withDeadline(h.cfg.WriteDeadline), h.rateLimit("read")).Get("/r/{code}", h.ReferralRedirect)
+	// other sites frame widgets, so they stay put as well, and take no
+	// token like the /public routes
+	r.With(h.publicRoute("widget"), h.limitInFlight, h.withDeadline(h.cfg.ReadDeadline), h.rateLimit("public")).
+		Get("/widgets/leaderboard", h.LeaderboardWidget)
+	// partners are set up with our callback URLs and sign their requests
+	// instead of holding tokens
+	r.Route("/callbacks", func(r chi.Router) {
+		r.Use(h.limitInFlight, h.withDeadline(h.cfg.WriteDeadline), h.rateLimit("write"), h.refuseInMaintenance, h.verifyPartner)
+		r.Post("/tasks/complete", h.PartnerCompleteTask)
+	})
+
+	r.Route("/v1", func(r chi.Router) {
+		r.Use(negotiateVersion)
+		h.api(r)
+	})
+	if h.cfg.LegacyRoutes {
+		r.Group(func(r chi.Router) {
+			r.Use(negotiateVersion, h.deprecated)
+			h.api(r)
+		})
+	}
+	return r
+}
+
+// api registers the versioned routes on r.
+func (h *Handler) api(r chi.Router) {
+	reads := chain(h.limitInFlight, h.withDeadline(h.cfg.ReadDeadline), h.rateLimit("read"))
+	// alwaysWrites are the write routes that stay open in maintenance mode
+	alwaysWrites := chain(h.limitInFlight, h.withDeadline(h.cfg.WriteDeadline), h.rateLimit("write"))
+	writes := chain(alwaysWrites, h.refuseInMaintenance)
+
+	// public: these hand out tokens
+	r.Route("/auth", func(r chi.Router) {
+		auth := chain(h.limitInFlight, h.withDeadline(h.cfg.WriteDeadline), h.rateLimit("auth"))
+		r.With(auth, h.refuseInMaintenance).Post("/register", h.Register)
+		r.With(auth).Post("/login", h.Login)
+		r.With(auth).Post("/refresh", h.Refresh)
+		r.With(auth).Post("/logout", h.Logout)
+		r.With(auth, h.refuseInMaintenance).Post("/forgot-password", h.ForgotPassword)
+		r.With(auth, h.refuseInMaintenance).Post("/reset-password", h.ResetPassword)
+		r.With(auth).Get("/{provider}/login", h.OAuthLogin)
+	})
+
+	// public: for embedding on sites anyone can visit, so no token, no
+	// personal data beyond display names, and a rate limit of their own
+	public := chain(h.limitInFlight, h.withDeadline(h.cfg.ReadDeadline), h.rateLimit("public"))
+	r.With(h.publicRoute("leaderboard"), public).Get("/public/leaderboard", h.GetPublicLeaderboard)
+	r.With(h.publicRoute("stats"), public).Get("/public/stats/points-distribution", h.GetPointsDistribution)
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+
+		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("ok"))
+		})
+
+		r.Route("/users", func(r chi.Router) {
+			r.With(reads).Get("/search", h.SearchUsers)
+			r.With(reads, conditional(h.cfg.StatusMaxAge)).Get("/{id}/status", h.GetUserStatus)
+			r.With(reads).Get("/{id}/tasks", h.GetCompletedTasks)
+			r.With(reads).Get("/{id}/profile", h.GetProfile)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Patch("/{id}/profile", h.UpdateProfile)
+			r.With(reads).Get("/{id}/settings", h.GetSettings)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Patch("/{id}/settings", h.UpdateSettings)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Delete("/{id}", h.DeleteUser)
+			r.With(writes, h.RouteToHomeRegion).Post("/{id}/oauth/{provider}/link", h.LinkOAuth)
+			r.With(reads).Get("/{id}/identities", h.GetIdentities)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Post("/{id}/identities", h.LinkIdentity)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Delete("/{id}/identities/{provider}", h.UnlinkIdentity)
+			r.With(reads, conditional(h.cfg.LeaderboardMaxAge)).Get("/leaderboard", h.GetLeaderboard)
+			// no deadline: the stream stays open
+			r.With(h.rateLimit("read")).Get("/leaderboard/stream", h.LeaderboardStream)
+			r.With(reads).Get("/{id}/percentile", h.GetUserPercentile)
+			r.With(reads).Get("/{id}/rank", h.GetUserRank)
+			r.With(reads).Get("/{id}/leaderboard/friends", h.GetFriendsLeaderboard)
+			r.With(reads).Get("/{id}/points/history", h.GetPointsHistory)
+			r.With(reads).Get("/{id}/points/balance", h.GetPointsBalance)
+			r.With(reads).Get("/{id}/export", h.ExportUser)
+			r.With(reads).Get("/{id}/exports/{export_id}", h.GetExport)
+			r.With(reads).Get("/{id}/exports/{export_id}/download", h.DownloadExport)
+			r.With(writes, h.RouteToHomeRegion, h.RequireActive, h.Idempotent).Post("/{id}/task/complete", h.CompleteTask)
+			r.With(writes, h.RouteToHomeRegion, h.RequireActive, h.Idempotent).Post("/{id}/checkin", h.CheckIn)
+			r.With(reads).Get("/{id}/submissions", h.GetUserSubmissions)
+			r.With(reads).Get("/{id}/notifications", h.GetNotifications)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Post("/{id}/notifications/read", h.MarkNotificationsRead)
+			r.With(reads).Get("/{id}/notifications/channels", h.GetNotificationChannels)
+			r.With(reads).Get("/{id}/features", h.GetFeatures)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Put("/{id}/notifications/channels/{channel}", h.SetNotificationChannel)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Delete("/{id}/notifications/channels/{channel}", h.DeleteNotificationChannel)
+			r.With(writes, h.RouteToHomeRegion, h.RequireActive, h.Idempotent).Post("/{id}/referrer", h.SetReferrer)
+			r.With(reads).Get("/{id}/referrals", h.GetUserReferrals)
+			r.With(reads).Get("/{id}/referral-link", h.GetReferralLink)
+			r.With(writes, h.RouteToHomeRegion, h.RequireActive, h.Idempotent).Post("/{id}/transfer", h.Transfer)
+			r.With(reads).Get("/{id}/team", h.GetUserTeam)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Post("/{id}/team", h.CreateTeam)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Put("/{id}/team", h.JoinTeam)
+			r.With(writes, h.RouteToHomeRegion, h.Idempotent).Delete("/{id}/team", h.LeaveTeam)
+		})
+
+		r.With(reads).Get("/stats/points-distribution", h.GetPointsDistribution)
+
+		r.With(reads).Get("/teams/leaderboard", h.GetTeamLeaderboard)
+		r.With(reads).Get("/teams/{team_id}", h.GetTeam)
+
+		r.With(reads).Get("/seasons", h.ListSeasons)
+		r.With(reads).Get("/seasons/{season_id}", h.GetSeason)
+		r.With(reads).Get("/seasons/{season_id}/leaderboard", h.GetSeasonLeaderboard)
+
+		r.With(reads).Get("/campaigns", h.ListCampaigns)
+
+		r.Post("/receipts/verify", h.VerifyReceipt)
+
+		r.With(reads).Get("/tasks", h.ListAvailableTasks)
+		r.With(reads).Get("/categories", h.ListCategories)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermTasksManage))
+				r.With(reads).Get("/tasks", h.AdminListTasks)
+				r.With(writes, h.Idempotent).Post("/tasks", h.AdminCreateTask)
+				r.With(writes, h.Idempotent).Put("/tasks/{code}", h.AdminUpdateTask)
+				r.With(writes, h.Idempotent).Delete("/tasks/{code}", h.AdminDeleteTask)
+				r.With(reads).Get("/tasks/{code}/translations", h.AdminListTranslations)
+				r.With(writes, h.Idempotent).Put("/tasks/{code}/translations/{locale}", h.AdminSetTranslation)
+				r.With(writes, h.Idempotent).Delete("/tasks/{code}/translations/{locale}", h.AdminDeleteTranslation)
+				r.With(reads).Get("/categories", h.ListCategories)
+				r.With(writes, h.Idempotent).Post("/categories", h.AdminCreateCategory)
+				r.With(writes, h.Idempotent).Put("/categories/{code}", h.AdminUpdateCategory)
+				r.With(writes, h.Idempotent).Delete("/categories/{code}", h.AdminDeleteCategory)
+				r.With(reads).Get("/submissions", h.AdminListSubmissions)
+				r.With(writes, h.Idempotent).Post("/submissions/{submission_id}/approve", h.AdminApproveSubmission)
+				r.With(writes, h.Idempotent).Post("/submissions/{submission_id}/reject", h.AdminRejectSubmission)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermRolesManage))
+				r.With(reads).Get("/roles", h.AdminListRoles)
+				r.With(reads).Get("/users/{id}/roles", h.AdminUserRoles)
+				r.With(writes, h.Idempotent).Put("/users/{id}/roles/{role}", h.AdminAssignRole)
+				r.With(writes, h.Idempotent).Delete("/users/{id}/roles/{role}", h.AdminRevokeRole)
+			})
+			r.With(Require(service.PermAuditRead), reads).Get("/audit", h.AdminAuditEvents)
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermPointsManage))
+				r.With(reads).Get("/points/discrepancies", h.AdminDiscrepancies)
+				r.With(writes, h.Idempotent).Post("/points/discrepancies/{user_id}/fix", h.AdminFixBalance)
+				r.With(writes, h.Idempotent).Post("/users/{id}/points", h.AdminAdjustPoints)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermReportsRead))
+				r.With(reads).Get("/reports", h.AdminReports)
+				r.With(reads).Get("/reports/referrals", h.AdminReferralReport)
+				r.Get("/breakers", h.AdminBreakers)
+				r.With(writes, h.Idempotent).Post("/exports", h.AdminCreateReportExport)
+				r.With(reads).Get("/exports/{id}", h.AdminGetReportExport)
+				r.With(reads).Get("/exports/{id}/download", h.AdminDownloadReportExport)
+			})
+			r.With(Require(service.PermUsersWrite), writes, h.Idempotent).Post("/users/{id}/restore", h.AdminRestoreUser)
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermUsersManage))
+				r.With(reads).Get("/users", h.AdminSearchUsers)
+				r.With(reads).Get("/users/{id}", h.AdminGetUser)
+				r.With(reads).Get("/users/{id}/ledger", h.AdminUserLedger)
+				r.With(writes, h.Idempotent).Put("/users/{id}/status", h.AdminSetUserStatus)
+				r.With(writes, h.Idempotent).Post("/users/{id}/ban", h.AdminBanUser)
+				r.With(writes, h.Idempotent).Post("/users/{id}/unban", h.AdminUnbanUser)
+				r.With(writes, h.Idempotent).Delete("/users/{id}/referrer", h.AdminResetReferrer)
+				r.With(writes, h.Idempotent).Delete("/users/{id}/tasks/{code}", h.AdminRevokeTask)
+				r.With(reads).Get("/users/{id}/duplicates", h.AdminUserDuplicates)
+				r.With(writes, h.Idempotent).Post("/users/{id}/merge", h.AdminMergeUsers)
+				r.With(writes, h.Idempotent).Post("/tokens/revoke", h.AdminRevokeToken)
+				r.With(reads).Post("/tokens/introspect", h.AdminIntrospectToken)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermTeamsManage))
+				r.With(writes, h.Idempotent).Patch("/teams/{team_id}", h.AdminRenameTeam)
+				r.With(writes, h.Idempotent).Delete("/teams/{team_id}", h.AdminDeleteTeam)
+				r.With(writes, h.Idempotent).Delete("/teams/{team_id}/members/{user_id}", h.AdminRemoveTeamMember)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermSeasonsManage))
+				r.With(writes, h.Idempotent).Post("/seasons", h.AdminCreateSeason)
+				r.With(writes, h.Idempotent).Post("/seasons/archive", h.AdminArchiveSeasons)
+				r.With(writes, h.Idempotent).Put("/seasons/{season_id}", h.AdminUpdateSeason)
+				r.With(writes, h.Idempotent).Delete("/seasons/{season_id}", h.AdminDeleteSeason)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermCampaignsManage))
+				r.With(reads).Get("/campaigns", h.AdminListCampaigns)
+				r.With(writes, h.Idempotent).Post("/campaigns", h.AdminCreateCampaign)
+				r.With(reads).Get("/campaigns/{campaign_id}", h.AdminGetCampaign)
+				r.With(writes, h.Idempotent).Put("/campaigns/{campaign_id}", h.AdminUpdateCampaign)
+				r.With(writes, h.Idempotent).Delete("/campaigns/{campaign_id}", h.AdminDeleteCampaign)
+				r.With(reads).Get("/campaigns/{campaign_id}/report", h.AdminCampaignReport)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermRulesManage))
+				r.With(reads).Get("/award-rules", h.AdminListAwardRules)
+				r.With(writes, h.Idempotent).Post("/award-rules", h.AdminCreateAwardRule)
+				r.With(reads).Get("/award-rules/{rule_id}", h.AdminGetAwardRule)
+				r.With(writes, h.Idempotent).Put("/award-rules/{rule_id}", h.AdminUpdateAwardRule)
+				r.With(writes, h.Idempotent).Delete("/award-rules/{rule_id}", h.AdminDeleteAwardRule)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermWebhooksManage))
+				r.With(reads).Get("/webhooks", h.AdminListWebhooks)
+				r.With(writes, h.Idempotent).Post("/webhooks", h.AdminCreateWebhook)
+				r.With(writes, h.Idempotent).Delete("/webhooks/{id}", h.AdminDisableWebhook)
+				r.With(reads).Get("/webhooks/{id}/deliveries", h.AdminWebhookDeliveries)
+				r.With(writes, h.Idempotent).Post("/webhooks/deliveries/{id}/retry", h.AdminRetryWebhookDelivery)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermFlagsManage))
+				r.With(reads).Get("/flags", h.AdminListFlags)
+				r.With(writes, h.Idempotent).Put("/flags/{name}", h.AdminSetFlag)
+				r.With(writes, h.Idempotent).Delete("/flags/{name}", h.AdminClearFlag)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(Require(service.PermMaintenanceManage))
+				r.With(reads).Get("/maintenance", h.AdminGetMaintenance)
+				r.With(alwaysWrites, h.Idempotent).Put("/maintenance", h.AdminSetMaintenance)
+				r.With(alwaysWrites, h.Idempotent).Delete("/maintenance", h.AdminClearMaintenance)
+			})
+		})
+	})
+}
+
+func jsonWrite(w http.ResponseWriter, v any, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,27 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// GetPointsDistribution reports percentiles and a histogram of users'
+// points for ?period=, split into ?buckets= (10 by default, at most 50).
+func (h *Handler) GetPointsDistribution(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "all"
+	}
+	buckets := 10
+	if v := r.URL.Query().Get("buckets"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 50 {
+			buckets = n
+		}
+	}
+	d, err := h.svc.PointsDistribution(r.Context(), period, buckets)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, d, http.StatusOK)
+}
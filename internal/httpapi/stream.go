@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// streamKeepAlive keeps idle streams from being cut by proxies.
+const streamKeepAlive = 15 * time.Second
+
+// LeaderboardStream is a server-sent event stream for the caller: a
+// snapshot first, then leaderboard deltas and "moved up" notifications as
+// points change. It ends when the client goes away, falls too far behind or
+// the server shuts down; clients reconnect and get a fresh snapshot.
+func (h *Handler) LeaderboardStream(w http.ResponseWriter, r *http.Request) {
+	userID, err := subjectUserID(r)
+	if err != nil {
+		httpError(w, http.StatusUnauthorized, codeUnauthorized, "invalid token")
+		return
+	}
+	sub, snap, err := h.cfg.Leaderboard.Subscribe(r.Context(), userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer h.cfg.Leaderboard.Unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	// the stream outlives the server's write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if writeSSE(w, snap) != nil || rc.Flush() != nil {
+		return
+	}
+
+	ping := time.NewTicker(streamKeepAlive)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case msg, ok := <-sub.C:
+			if !ok || writeSSE(w, msg) != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, msg service.LiveMessage) error {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+	return err
+}
@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+type RejectSubmissionReq struct {
+	// Reason is shown to the user.
+	Reason string `json:"reason"`
+}
+
+// submissionFilter reads status, limit and the after cursor shared by the
+// submission listings.
+func submissionFilter(w http.ResponseWriter, r *http.Request) (repository.SubmissionFilter, bool) {
+	q := r.URL.Query()
+	f := repository.SubmissionFilter{Status: q.Get("status"), Limit: 50}
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			f.Limit = n
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad after cursor")
+			return f, false
+		}
+		f.AfterID = n
+	}
+	return f, true
+}
+
+func (h *Handler) writeSubmissions(w http.ResponseWriter, r *http.Request, f repository.SubmissionFilter) {
+	items, err := h.svc.Submissions(r.Context(), f)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"submissions": items, "next_after": nil}
+	if len(items) == f.Limit {
+		resp["next_after"] = items[len(items)-1].ID
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func (h *Handler) GetUserSubmissions(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	f, ok := submissionFilter(w, r)
+	if !ok {
+		return
+	}
+	f.UserID = id
+	h.writeSubmissions(w, r, f)
+}
+
+func (h *Handler) AdminListSubmissions(w http.ResponseWriter, r *http.Request) {
+	f, ok := submissionFilter(w, r)
+	if !ok {
+		return
+	}
+	f.TaskCode = r.URL.Query().Get("task")
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "invalid user_id")
+			return
+		}
+		f.UserID = n
+	}
+	h.writeSubmissions(w, r, f)
+}
+
+func (h *Handler) AdminApproveSubmission(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "submission_id")
+	if !ok {
+		return
+	}
+	sub, err := h.svc.ApproveSubmission(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, sub, http.StatusOK)
+}
+
+func (h *Handler) AdminRejectSubmission(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "submission_id")
+	if !ok {
+		return
+	}
+	var req RejectSubmissionReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	sub, err := h.svc.RejectSubmission(r.Context(), id, req.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, sub, http.StatusOK)
+}
@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+func (h *Handler) listTasks(w http.ResponseWriter, r *http.Request, availableOnly bool) {
+	tasks, err := h.svc.ListTasks(r.Context(), availableOnly)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"tasks": tasks}, http.StatusOK)
+}
+
+// ListAvailableTasks lists tasks that can currently be completed, marking
+// which ones are still locked behind prerequisites for the caller.
+// ?preview=upcoming adds scheduled tasks for callers with tasks:manage;
+// ?category=, ?tag= and ?status= filter the list, and titles follow
+// Accept-Language.
+func (h *Handler) ListAvailableTasks(w http.ResponseWriter, r *http.Request) {
+	userID, err := subjectUserID(r)
+	if err != nil {
+		httpError(w, http.StatusUnauthorized, codeUnauthorized, "invalid token")
+		return
+	}
+	preview := false
+	switch r.URL.Query().Get("preview") {
+	case "":
+	case "upcoming":
+		ok, err := can(r, service.PermTasksManage)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !ok {
+			httpError(w, http.StatusForbidden, codeForbidden, "forbidden")
+			return
+		}
+		preview = true
+	default:
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid preview")
+		return
+	}
+	q := r.URL.Query()
+	filter := service.TaskFilter{Category: q.Get("category"), Tag: q.Get("tag"), Status: q.Get("status")}
+	w.Header().Add("Vary", "Accept-Language")
+	ctx := service.WithLocales(r.Context(), acceptLanguages(r))
+	tasks, err := h.svc.TasksForUser(ctx, userID, preview, filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"tasks": tasks}, http.StatusOK)
+}
+
+func (h *Handler) AdminListTasks(w http.ResponseWriter, r *http.Request) {
+	h.listTasks(w, r, false)
+}
+
+func (h *Handler) AdminCreateTask(w http.ResponseWriter, r *http.Request) {
+	var in service.TaskInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	t, err := h.svc.CreateTask(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, t, http.StatusCreated)
+}
+
+func (h *Handler) AdminUpdateTask(w http.ResponseWriter, r *http.Request) {
+	var in service.TaskInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	t, err := h.svc.UpdateTask(r.Context(), chi.URLParam(r, "code"), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, t, http.StatusOK)
+}
+
+func (h *Handler) AdminDeleteTask(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.ArchiveTask(r.Context(), chi.URLParam(r, "code")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
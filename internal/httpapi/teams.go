@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+)
+
+type CreateTeamReq struct {
+	Name string `json:"name"`
+}
+
+type JoinTeamReq struct {
+	TeamID int64 `json:"team_id"`
+}
+
+// GetTeamLeaderboard pages teams by points like GetLeaderboard pages users,
+// with the same cursors.
+func (h *Handler) GetTeamLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	after, err := leaderboardCursor(r)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "bad cursor")
+		return
+	}
+	page, err := h.svc.TeamLeaderboard(r.Context(), limit, after)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"teams": page.Items, "total": page.Total, "next_cursor": nil}
+	if page.Next != nil {
+		resp["next_cursor"] = encodeLeaderboardCursor(*page.Next)
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "team_id")
+	if !ok {
+		return
+	}
+	d, err := h.svc.Team(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, d, http.StatusOK)
+}
+
+func (h *Handler) GetUserTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	d, err := h.svc.UserTeam(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, d, http.StatusOK)
+}
+
+// CreateTeam creates a team with the user as its first member.
+func (h *Handler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req CreateTeamReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	d, err := h.svc.CreateTeam(r.Context(), id, req.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, d, http.StatusCreated)
+}
+
+func (h *Handler) JoinTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req JoinTeamReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.TeamID <= 0 {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+	d, err := h.svc.JoinTeam(r.Context(), id, req.TeamID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, d, http.StatusOK)
+}
+
+func (h *Handler) LeaveTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.LeaveTeam(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminRenameTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "team_id")
+	if !ok {
+		return
+	}
+	var req CreateTeamReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	d, err := h.svc.RenameTeam(r.Context(), id, req.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, d, http.StatusOK)
+}
+
+func (h *Handler) AdminDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "team_id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteTeam(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminRemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	teamID, ok := pathID(w, r, "team_id")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(w, r, "user_id")
+	if !ok {
+		return
+	}
+	if err := h.svc.RemoveTeamMember(r.Context(), teamID, userID); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
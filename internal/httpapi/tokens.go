@@ -0,0 +1,36 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+type IntrospectReq struct {
+	Token string `json:"token"`
+}
+
+func (h *Handler) AdminRevokeToken(w http.ResponseWriter, r *http.Request) {
+	var in service.RevokeTokenInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	rev, err := h.svc.RevokeToken(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rev, http.StatusOK)
+}
+
+func (h *Handler) AdminIntrospectToken(w http.ResponseWriter, r *http.Request) {
+	var req IntrospectReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Token == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+	jsonWrite(w, h.svc.IntrospectToken(req.Token), http.StatusOK)
+}
@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// acceptLanguages lists the Accept-Language tags, most preferred first.
+// "*" and tags with q=0 are dropped; so are malformed weights.
+func acceptLanguages(r *http.Request) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var langs []lang
+	for _, h := range r.Header.Values("Accept-Language") {
+		for _, part := range strings.Split(h, ",") {
+			tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			tag = strings.TrimSpace(tag)
+			if tag == "" || tag == "*" {
+				continue
+			}
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil || f < 0 || f > 1 {
+					continue
+				}
+				q = f
+			}
+			if q > 0 {
+				langs = append(langs, lang{tag, q})
+			}
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+func (h *Handler) AdminListTranslations(w http.ResponseWriter, r *http.Request) {
+	ts, err := h.svc.TaskTranslations(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"translations": ts}, http.StatusOK)
+}
+
+func (h *Handler) AdminSetTranslation(w http.ResponseWriter, r *http.Request) {
+	var in service.TranslationInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	t, err := h.svc.SetTaskTranslation(r.Context(), chi.URLParam(r, "code"), chi.URLParam(r, "locale"), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, t, http.StatusOK)
+}
+
+func (h *Handler) AdminDeleteTranslation(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteTaskTranslation(r.Context(), chi.URLParam(r, "code"), chi.URLParam(r, "locale")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,291 @@
+// The dashboard is a client of the /v1 API like any other: it keeps the
+// access token in sessionStorage and sends it as a bearer token, so what it
+// shows and does is limited by the signed-in user's permissions.
+"use strict";
+
+const api = "/v1";
+const $ = (sel) => document.querySelector(sel);
+
+let token = sessionStorage.getItem("token");
+
+async function call(method, path, body) {
+  const opts = { method, headers: { Authorization: "Bearer " + token } };
+  if (body !== undefined) {
+    opts.headers["Content-Type"] = "application/json";
+    opts.body = typeof body === "string" ? body : JSON.stringify(body);
+  }
+  if (method !== "GET") {
+    opts.headers["Idempotency-Key"] = crypto.randomUUID();
+  }
+  const res = await fetch(api + path, opts);
+  const text = await res.text();
+  let data = null;
+  try { data = text ? JSON.parse(text) : null; } catch { data = text; }
+  if (res.status === 401) {
+    signOut("Your session has expired; sign in again.");
+  }
+  if (!res.ok) {
+    const msg = data && data.error ? data.error.code + ": " + data.error.message : res.status + " " + res.statusText;
+    throw Object.assign(new Error(msg), { status: res.status, data });
+  }
+  return data;
+}
+
+function cell(row, value, cls) {
+  const td = row.insertCell();
+  td.textContent = value ?? "";
+  if (cls) td.className = cls;
+  return td;
+}
+
+function fill(table, items, render) {
+  const body = $(table + " tbody");
+  body.replaceChildren();
+  for (const item of items) render(body.insertRow(), item);
+}
+
+function failed(table, err) {
+  const body = $(table + " tbody");
+  body.replaceChildren();
+  const td = cell(body.insertRow(), err.status === 403 ? "You don't have permission to see this." : err.message, "error");
+  td.colSpan = 9;
+}
+
+async function loadLeaderboard() {
+  try {
+    const data = await call("GET", "/users/leaderboard?limit=20&period=" + $("#period").value);
+    fill("#leaderboard", data.leaderboard, (row, e) => {
+      cell(row, e.rank, "num");
+      cell(row, e.anonymous ? "(anonymous)" : e.display_name || e.username);
+      cell(row, e.points, "num");
+    });
+  } catch (err) { failed("#leaderboard", err); }
+}
+
+async function loadTotals() {
+  const dl = $("#totals");
+  dl.replaceChildren();
+  try {
+    const report = await call("GET", "/admin/reports");
+    for (const [name, value] of Object.entries(report.totals)) {
+      if (typeof value !== "number") continue;
+      const dt = document.createElement("dt");
+      dt.textContent = name.replaceAll("_", " ");
+      const dd = document.createElement("dd");
+      dd.textContent = Number.isInteger(value) ? value : value.toFixed(2);
+      dl.append(dt, dd);
+    }
+  } catch (err) {
+    dl.textContent = err.status === 403 ? "You don't have permission to see this." : err.message;
+  }
+}
+
+async function loadTasks() {
+  try {
+    const data = await call("GET", "/admin/tasks");
+    fill("#tasks", data.tasks, (row, t) => {
+      cell(row, t.code);
+      cell(row, t.title);
+      cell(row, t.points, "num");
+      cell(row, t.completions || 0, "num");
+      cell(row, t.active ? "yes" : "no");
+    });
+  } catch (err) { failed("#tasks", err); }
+}
+
+async function loadCompletions() {
+  try {
+    const data = await call("GET", "/admin/audit?action=task.completed&limit=20");
+    fill("#completions", data.events, (row, e) => {
+      const before = e.before || {}, after = e.after || {};
+      cell(row, new Date(e.at).toLocaleString());
+      cell(row, e.target_id);
+      cell(row, after.task);
+      cell(row, (after.points || 0) - (before.points || 0), "num");
+    });
+  } catch (err) { failed("#completions", err); }
+}
+
+async function loadFlags() {
+  try {
+    const data = await call("GET", "/admin/flags");
+    fill("#flags", data.flags, (row, f) => {
+      cell(row, f.name).title = f.description;
+      const enabled = document.createElement("input");
+      enabled.type = "checkbox";
+      enabled.checked = f.enabled;
+      row.insertCell().append(enabled);
+      const percent = document.createElement("input");
+      percent.type = "number";
+      percent.min = 0;
+      percent.max = 100;
+      percent.value = f.percent;
+      percent.size = 4;
+      row.insertCell().append(percent);
+      cell(row, f.source);
+      const save = document.createElement("button");
+      save.textContent = "Save";
+      save.onclick = () => setFlag("PUT", f.name, { enabled: enabled.checked, percent: Number(percent.value) });
+      const reset = document.createElement("button");
+      reset.textContent = "Reset";
+      reset.disabled = f.source !== "override";
+      reset.onclick = () => setFlag("DELETE", f.name);
+      row.insertCell().append(save, " ", reset);
+    });
+  } catch (err) { failed("#flags", err); }
+}
+
+async function setFlag(method, name, body) {
+  try {
+    await call(method, "/admin/flags/" + encodeURIComponent(name), body);
+  } catch (err) {
+    alert(err.message);
+  }
+  loadFlags();
+}
+
+// The admin API form lists every admin operation in /openapi.json, with
+// fields for its path and query parameters and a body skeleton.
+let ops = [];
+
+function skeleton(schema, spec, depth = 0) {
+  if (!schema || depth > 4) return null;
+  if (schema.$ref) {
+    return skeleton(spec.components.schemas[schema.$ref.split("/").pop()], spec, depth + 1);
+  }
+  switch (schema.type) {
+    case "object": {
+      const out = {};
+      for (const [name, prop] of Object.entries(schema.properties || {})) {
+        out[name] = skeleton(prop, spec, depth + 1);
+      }
+      return out;
+    }
+    case "array": return [];
+    case "integer": case "number": return 0;
+    case "boolean": return false;
+    case "string": return "";
+  }
+  return null;
+}
+
+async function loadOps() {
+  const spec = await (await fetch("/openapi.json")).json();
+  for (const [path, methods] of Object.entries(spec.paths)) {
+    if (!path.startsWith(api + "/admin/")) continue;
+    for (const [method, op] of Object.entries(methods)) {
+      const params = (op.parameters || []).filter((p) => p.in === "path" || p.in === "query");
+      const schema = op.requestBody && op.requestBody.content["application/json"];
+      ops.push({
+        method: method.toUpperCase(), path: path.slice(api.length), summary: op.summary, params,
+        body: schema ? JSON.stringify(skeleton(schema.schema, spec), null, 2) : null,
+      });
+    }
+  }
+  ops.sort((a, b) => a.path.localeCompare(b.path) || a.method.localeCompare(b.method));
+  const select = $("#call select");
+  select.replaceChildren(...ops.map((op, i) => new Option(op.method + " " + op.path, i)));
+  showOp();
+}
+
+function showOp() {
+  const op = ops[$("#call select").value];
+  $("#op-summary").textContent = op.summary;
+  $("#op-params").replaceChildren(...op.params.map((p) => {
+    const label = document.createElement("label");
+    const input = document.createElement("input");
+    input.name = p.in + ":" + p.name;
+    input.required = p.in === "path";
+    if (p.description) input.placeholder = p.description;
+    label.append(p.name + " ", input);
+    return label;
+  }));
+  $("#op-body-label").hidden = op.body === null;
+  $("#call textarea").value = op.body || "";
+}
+
+async function send(event) {
+  event.preventDefault();
+  const op = ops[$("#call select").value];
+  const query = new URLSearchParams();
+  let path = op.path;
+  for (const input of $("#op-params").querySelectorAll("input")) {
+    const [where, name] = input.name.split(":");
+    if (where === "path") {
+      path = path.replace("{" + name + "}", encodeURIComponent(input.value));
+    } else if (input.value !== "") {
+      query.set(name, input.value);
+    }
+  }
+  if (query.size) path += "?" + query;
+  const out = $("#call-result");
+  out.className = "";
+  try {
+    const data = await call(op.method, path, op.body === null ? undefined : $("#call textarea").value);
+    out.textContent = data === null ? "done" : typeof data === "string" ? data : JSON.stringify(data, null, 2);
+  } catch (err) {
+    out.className = "error";
+    out.textContent = err.message;
+  }
+}
+
+function refresh() {
+  loadLeaderboard();
+  loadTotals();
+  loadTasks();
+  loadCompletions();
+  loadFlags();
+}
+
+function signedIn(user) {
+  $("#signin").hidden = true;
+  $("#dashboard").hidden = false;
+  $("#signout").hidden = false;
+  $("#who").textContent = user ? "signed in as " + user : "";
+  refresh();
+  if (!ops.length) loadOps();
+}
+
+function signOut(msg) {
+  token = null;
+  sessionStorage.removeItem("token");
+  $("#dashboard").hidden = true;
+  $("#signout").hidden = true;
+  $("#signin").hidden = false;
+  $("#who").textContent = "";
+  $("#signin-error").textContent = msg || "";
+}
+
+$("#login").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  const res = await fetch(api + "/auth/login", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ username: form.get("username"), password: form.get("password") }),
+  });
+  const data = await res.json();
+  if (!res.ok) {
+    $("#signin-error").textContent = data.error ? data.error.message : res.statusText;
+    return;
+  }
+  token = data.token;
+  sessionStorage.setItem("token", token);
+  event.target.reset();
+  signedIn(form.get("username"));
+});
+
+$("#paste").addEventListener("submit", (event) => {
+  event.preventDefault();
+  token = new FormData(event.target).get("token").trim();
+  sessionStorage.setItem("token", token);
+  event.target.reset();
+  signedIn();
+});
+
+$("#signout").addEventListener("click", () => signOut());
+$("#period").addEventListener("change", loadLeaderboard);
+$("#call select").addEventListener("change", showOp);
+$("#call").addEventListener("submit", send);
+
+if (token) signedIn();
@@ -0,0 +1,545 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+type CompleteTaskReq struct {
+	Task string `json:"task"`
+	// Proof is passed to the task's verifier, if it has one, and kept for
+	// review on tasks that require it.
+	Proof json.RawMessage `json:"proof"`
+}
+
+type ReferrerReq struct {
+	ReferrerID int64 `json:"referrer_id"`
+}
+
+func (h *Handler) GetUserStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	st, err := h.svc.UserStatus(service.WithLocales(r.Context(), acceptLanguages(r)), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	streak, err := h.svc.Streak(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if st.Recent == nil {
+		st.Recent = []repository.CompletedTask{}
+	}
+	jsonWrite(w, map[string]any{
+		"user":            st.User,
+		"completed_count": st.CompletedCount,
+		"completed_tasks": st.Recent,
+		"streak":          streak,
+		"level":           st.Level,
+		"top_percent":     st.TopPercent,
+	}, http.StatusOK)
+}
+
+// GetCompletedTasks pages the user's completed tasks newest first with
+// ?limit= and the next_cursor of the previous page.
+func (h *Handler) GetCompletedTasks(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	var after *repository.CompletedTaskCursor
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		c, err := decodeCompletedCursor(v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad cursor")
+			return
+		}
+		after = &c
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	page, err := h.svc.CompletedTasks(service.WithLocales(r.Context(), acceptLanguages(r)), id, limit, after)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if page.Items == nil {
+		page.Items = []repository.CompletedTask{}
+	}
+	resp := map[string]any{"completed_tasks": page.Items, "next_cursor": nil}
+	if page.Next != nil {
+		resp["next_cursor"] = encodeCompletedCursor(*page.Next)
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+// A completed tasks cursor is "<completed_at unix nanos>:<n>:<code>",
+// base64url encoded; the code goes last since it may hold colons.
+func encodeCompletedCursor(c repository.CompletedTaskCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%s", c.CompletedAt.UnixNano(), c.N, c.Code)))
+}
+
+func decodeCompletedCursor(v string) (repository.CompletedTaskCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return repository.CompletedTaskCursor{}, err
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 {
+		return repository.CompletedTaskCursor{}, errors.New("malformed cursor")
+	}
+	at, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return repository.CompletedTaskCursor{}, err
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return repository.CompletedTaskCursor{}, err
+	}
+	return repository.CompletedTaskCursor{CompletedAt: time.Unix(0, at).UTC(), Code: parts[2], N: n}, nil
+}
+
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	p, err := h.svc.Profile(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, p, http.StatusOK)
+}
+
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var in service.ProfileInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	p, err := h.svc.UpdateProfile(r.Context(), id, in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, p, http.StatusOK)
+}
+
+func (h *Handler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	st, err := h.svc.Settings(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, st, http.StatusOK)
+}
+
+func (h *Handler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var in service.SettingsInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	st, err := h.svc.UpdateSettings(r.Context(), id, in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, st, http.StatusOK)
+}
+
+// DeleteUser soft-deletes the account; see service.DeleteUser.
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteUser(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminRestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	u, err := h.svc.RestoreUser(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"user": u}, http.StatusOK)
+}
+
+func (h *Handler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	format, ok := responseFormat(w, r)
+	if !ok {
+		return
+	}
+	limit, maxLimit := 10, 100
+	if format == "csv" {
+		// LeaderboardCSV defaults and caps it
+		limit, maxLimit = 0, math.MaxInt
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= maxLimit {
+			limit = n
+		}
+	}
+	after, err := leaderboardCursor(r)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "bad cursor")
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "all"
+	}
+	if format == "csv" {
+		rep, err := h.svc.LeaderboardCSV(r.Context(), period, limit, after)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeCSV(w, r, rep)
+		return
+	}
+
+	page, err := h.svc.Leaderboard(r.Context(), period, limit, after)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"period": period, "leaderboard": page.Items, "total": page.Total, "next_cursor": nil}
+	if page.Next != nil {
+		resp["next_cursor"] = encodeLeaderboardCursor(*page.Next)
+	}
+	if page.AsOf != nil {
+		resp["as_of"] = page.AsOf
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+// leaderboardCursor reads either an opaque ?cursor= from a previous page or
+// an explicit ?after_points=&after_id= position. It returns nil for the first
+// page.
+func leaderboardCursor(r *http.Request) (*repository.LeaderboardCursor, error) {
+	q := r.URL.Query()
+	if v := q.Get("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		pts, id, ok := strings.Cut(string(raw), ":")
+		if !ok {
+			return nil, errors.New("malformed cursor")
+		}
+		return parseLeaderboardCursor(pts, id)
+	}
+	if q.Get("after_points") != "" || q.Get("after_id") != "" {
+		return parseLeaderboardCursor(q.Get("after_points"), q.Get("after_id"))
+	}
+	return nil, nil
+}
+
+func parseLeaderboardCursor(points, id string) (*repository.LeaderboardCursor, error) {
+	p, err := strconv.ParseInt(points, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &repository.LeaderboardCursor{Points: p, ID: i}, nil
+}
+
+func encodeLeaderboardCursor(c repository.LeaderboardCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.Points, c.ID)))
+}
+
+func (h *Handler) GetUserPercentile(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	p, err := h.svc.Percentile(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, p, http.StatusOK)
+}
+
+func (h *Handler) GetUserRank(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "all"
+	}
+	rank, err := h.svc.UserRank(r.Context(), id, period)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, rank, http.StatusOK)
+}
+
+// GetFriendsLeaderboard ranks the user among their referrer and referrals,
+// taking ?period= and ?limit= as GetLeaderboard does.
+func (h *Handler) GetFriendsLeaderboard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "all"
+	}
+	b, err := h.svc.FriendsLeaderboard(r.Context(), id, period, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, b, http.StatusOK)
+}
+
+func (h *Handler) GetPointsHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	h.writePointsHistory(w, r, id)
+}
+
+// writePointsHistory writes a page of the user's ledger as ?limit= and
+// ?before= ask for.
+func (h *Handler) writePointsHistory(w http.ResponseWriter, r *http.Request, id int64) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	// keyset paging: ?before=<id of the last entry on the previous page>
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad before cursor")
+			return
+		}
+		before = n
+	}
+
+	items, err := h.svc.PointsHistory(r.Context(), id, before, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"transactions": items, "next_before": nil}
+	if len(items) == limit {
+		resp["next_before"] = items[len(items)-1].ID
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+// GetPointsBalance reports the user's balance as of ?at=, now by default.
+func (h *Handler) GetPointsBalance(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	at := time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "invalid at")
+			return
+		}
+		at = t
+	}
+	bal, err := h.svc.BalanceAt(r.Context(), id, at)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, bal, http.StatusOK)
+}
+
+func (h *Handler) CompleteTask(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req CompleteTaskReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Task == "" {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+
+	res, err := h.svc.CompleteTask(r.Context(), id, req.Task, req.Proof)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, status := completionResp(res)
+	jsonWrite(w, resp, status)
+}
+
+// completionResp is the completeResp body for res and its status.
+func completionResp(res service.Completion) (map[string]any, int) {
+	if res.AlreadyCompleted {
+		return map[string]any{"status": "already_completed"}, http.StatusOK
+	}
+	if res.Submission != nil {
+		return map[string]any{"status": "pending_review", "submission": res.Submission}, http.StatusAccepted
+	}
+	resp := map[string]any{
+		"status":     "ok",
+		"awarded":    res.Awarded,
+		"streak":     res.Streak,
+		"multiplier": res.Multiplier,
+	}
+	if res.Receipt != "" {
+		resp["receipt"] = res.Receipt
+	}
+	if len(res.Campaigns) > 0 {
+		resp["campaigns"] = res.Campaigns
+	}
+	resp["explain"] = res.Explain
+	return resp, http.StatusOK
+}
+
+func (h *Handler) CheckIn(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	res, err := h.svc.CheckIn(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, res, http.StatusOK)
+}
+
+func (h *Handler) SetReferrer(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReferrerReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.ReferrerID == 0 {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+
+	bonus, err := h.svc.SetReferrer(r.Context(), id, req.ReferrerID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{
+		"status":            "ok",
+		"bonus_referred":    bonus.Referred,
+		"bonus_to_referrer": bonus.Referrer,
+		"bonus_pending":     bonus.Pending,
+		"referrer_capped":   bonus.Capped,
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetUserReferrals(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	refs, err := h.svc.UserReferrals(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, refs, http.StatusOK)
+}
+
+type TransferReq struct {
+	RecipientID int64 `json:"recipient_id"`
+	Amount      int64 `json:"amount"`
+}
+
+func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req TransferReq
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.RecipientID == 0 {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid body")
+		return
+	}
+
+	t, err := h.svc.Transfer(r.Context(), id, req.RecipientID, req.Amount)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"status": "ok", "transfer": t}, http.StatusOK)
+}
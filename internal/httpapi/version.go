@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiVersion is the version served under /v1 and, while LegacyRoutes is
+// set, at the unversioned paths too.
+const apiVersion = "1"
+
+// negotiateVersion tags responses with the API-Version they follow. A
+// request may name the version it expects in an API-Version header; one
+// this server doesn't speak is refused rather than answered in a shape the
+// client can't read.
+func negotiateVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", apiVersion)
+		if v := r.Header.Get("API-Version"); v != "" && strings.TrimPrefix(v, "v") != apiVersion {
+			httpError(w, http.StatusBadRequest, codeUnsupportedVersion, "unsupported API version "+v+"; this server speaks "+apiVersion)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecated marks responses on unversioned paths as deprecated, with the
+// Sunset date after which they may go away and a Link to the same route
+// under /v1.
+func (h *Handler) deprecated(next http.Handler) http.Handler {
+	sunset := ""
+	if !h.cfg.LegacySunset.IsZero() {
+		sunset = h.cfg.LegacySunset.UTC().Format(http.TimeFormat)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if sunset != "" {
+			w.Header().Set("Sunset", sunset)
+		}
+		w.Header().Add("Link", `</v`+apiVersion+r.URL.EscapedPath()+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiPath is path under the version r came in on, so links in a response
+// keep a client on the paths it uses.
+func apiPath(r *http.Request, path string) string {
+	if prefix := "/v" + apiVersion; strings.HasPrefix(r.URL.Path, prefix+"/") {
+		return prefix + path
+	}
+	return path
+}
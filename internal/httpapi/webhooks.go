@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+func (h *Handler) AdminListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.svc.ListWebhooks(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"webhooks": hooks}, http.StatusOK)
+}
+
+// AdminCreateWebhook responds with the endpoint and its secret; the secret
+// is not returned anywhere else.
+func (h *Handler) AdminCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var in service.WebhookInput
+	if !h.decodeJSON(w, r, &in) {
+		return
+	}
+	hook, secret, err := h.svc.CreateWebhook(r.Context(), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonWrite(w, map[string]any{"webhook": hook, "secret": secret}, http.StatusCreated)
+}
+
+func (h *Handler) AdminDisableWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DisableWebhook(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminWebhookDeliveries is an endpoint's delivery log, newest first,
+// optionally filtered by ?status=pending|delivered|failed.
+func (h *Handler) AdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			httpError(w, http.StatusBadRequest, codeBadRequest, "bad before cursor")
+			return
+		}
+		before = n
+	}
+
+	items, err := h.svc.WebhookDeliveries(r.Context(), id, r.URL.Query().Get("status"), before, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := map[string]any{"deliveries": items, "next_before": nil}
+	if len(items) == limit {
+		resp["next_before"] = items[len(items)-1].ID
+	}
+	jsonWrite(w, resp, http.StatusOK)
+}
+
+func (h *Handler) AdminRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.RetryWebhookDelivery(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// pathID parses a positive numeric URL parameter, writing 400 if it isn't
+// one.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id <= 0 {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
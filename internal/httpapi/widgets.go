@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"bytes"
+	"cmp"
+	"embed"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+//go:embed widgets
+var widgetFiles embed.FS
+
+var widgetTemplates = template.Must(template.ParseFS(widgetFiles, "widgets/*.html"))
+
+// widgetTheme colors a widget; ?theme= picks one by name.
+type widgetTheme struct {
+	Background, Text, Muted, Accent, Border string
+}
+
+var widgetThemes = map[string]widgetTheme{
+	"light": {Background: "#ffffff", Text: "#1f2328", Muted: "#656d76", Accent: "#0969da", Border: "#d0d7de"},
+	"dark":  {Background: "#0d1117", Text: "#e6edf3", Muted: "#8d96a0", Accent: "#4493f8", Border: "#30363d"},
+}
+
+// widgetSizes are the font sizes, in pixels, ?size= picks from; the rest of
+// the widget scales with it.
+var widgetSizes = map[string]int{"small": 12, "medium": 14, "large": 16}
+
+var widgetTitles = map[string]string{
+	"all":     "Leaderboard",
+	"daily":   "Today's leaderboard",
+	"weekly":  "This week's leaderboard",
+	"monthly": "This month's leaderboard",
+}
+
+// LeaderboardWidget renders the top ?top= (10 by default, at most 50) of
+// the ?period= leaderboard as a small HTML page for other sites to frame,
+// in ?theme= light or dark and ?size= small, medium or large. Entries are
+// PublicLeaderboard's, so the widget shows no more than /public/leaderboard.
+func (h *Handler) LeaderboardWidget(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	top := 10
+	if v := q.Get("top"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 50 {
+			top = n
+		}
+	}
+	theme, ok := widgetThemes[cmp.Or(q.Get("theme"), "light")]
+	if !ok {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "theme must be light or dark")
+		return
+	}
+	size, ok := widgetSizes[cmp.Or(q.Get("size"), "medium")]
+	if !ok {
+		httpError(w, http.StatusBadRequest, codeBadRequest, "size must be small, medium or large")
+		return
+	}
+	period := cmp.Or(q.Get("period"), "all")
+	board, err := h.svc.PublicLeaderboard(r.Context(), period, top)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var page bytes.Buffer
+	err = widgetTemplates.ExecuteTemplate(&page, "leaderboard.html", struct {
+		Title    string
+		Theme    widgetTheme
+		FontSize int
+		Board    service.PublicBoard
+	}{widgetTitles[period], theme, size, board})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ancestors := "*"
+	if len(h.cfg.WidgetFrameAncestors) > 0 {
+		ancestors = strings.Join(h.cfg.WidgetFrameAncestors, " ")
+	}
+	// no scripts at all, and framing only by the sites allowed to
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors "+ancestors)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	// the same for every visitor, so shared caches may keep it
+	cacheControl := "public, no-cache"
+	if h.cfg.LeaderboardMaxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(h.cfg.LeaderboardMaxAge.Seconds()))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page.Bytes())
+}
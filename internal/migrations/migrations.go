@@ -0,0 +1,227 @@
+// Package migrations embeds the versioned schema and applies it: sql/ for
+// Postgres, sqlite/ for SQLite. Files are named NNNN_description.sql and run
+// in version order, each in its own transaction, recorded in
+// schema_versions.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed sql/*.sql sqlite/*.sql
+var files embed.FS
+
+var fileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.sql$`)
+
+// lockKey is the pg_advisory_lock key serializing concurrent migrators.
+const lockKey = 7_261_001
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Load returns the embedded Postgres migrations sorted by version.
+func Load() ([]Migration, error) {
+	return load("sql")
+}
+
+// LoadSQLite returns the embedded SQLite migrations sorted by version.
+func LoadSQLite() ([]Migration, error) {
+	return load("sqlite")
+}
+
+func load(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	seen := map[int]string{}
+	for _, e := range entries {
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %q: name must be NNNN_description.sql", e.Name())
+		}
+		v, _ := strconv.Atoi(m[1])
+		if prev, ok := seen[v]; ok {
+			return nil, fmt.Errorf("migration version %d used by %s and %s", v, prev, e.Name())
+		}
+		seen[v] = e.Name()
+		body, err := fs.ReadFile(files, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Migration{Version: v, Name: m[2], SQL: string(body)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Apply runs every migration not yet recorded in schema_versions and returns
+// the ones it applied. Concurrent callers (several instances starting at
+// once) are serialized with an advisory lock.
+func Apply(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	all, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Migrations may run long; lift the per-request timeouts set on pooled
+	// connections and restore them before handing the connection back.
+	if _, err := conn.ExecContext(ctx, `SET statement_timeout = 0; SET lock_timeout = 0`); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), `RESET statement_timeout; RESET lock_timeout`)
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_versions (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return nil, err
+	}
+
+	return applyPending(ctx, conn, all, `INSERT INTO schema_versions (version, name) VALUES ($1, $2)`)
+}
+
+// ApplySQLite is Apply for SQLite. No lock is needed: the first migration
+// to write takes the database's write lock and others wait on busy_timeout.
+func ApplySQLite(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	all, err := LoadSQLite()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_versions (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return nil, err
+	}
+	return applyPending(ctx, conn, all, `INSERT INTO schema_versions (version, name) VALUES (?, ?)`)
+}
+
+// Pending returns the Postgres migrations not yet recorded in
+// schema_versions, for the readiness probe.
+func Pending(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	all, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return pending(ctx, db, all)
+}
+
+// PendingSQLite is Pending for SQLite.
+func PendingSQLite(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	all, err := LoadSQLite()
+	if err != nil {
+		return nil, err
+	}
+	return pending(ctx, db, all)
+}
+
+func pending(ctx context.Context, db *sql.DB, all []Migration) ([]Migration, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, m := range all {
+		if !done[m.Version] {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// applyPending applies the migrations not yet in schema_versions, recording
+// each with record.
+func applyPending(ctx context.Context, conn *sql.Conn, all []Migration, record string) ([]Migration, error) {
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range all {
+		if done[m.Version] {
+			continue
+		}
+		if err := applyOne(ctx, conn, m, record); err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_versions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := map[int]bool{}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		done[v] = true
+	}
+	return done, rows.Err()
+}
+
+func applyOne(ctx context.Context, conn *sql.Conn, m Migration, record string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// no args: pgx sends this over the simple protocol, which allows
+	// multi-statement files (the SQLite driver runs them in turn)
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+-- 0002_points_distribution.sql
+-- Pre-aggregated points distribution so percentile lookups sum over distinct
+-- point values instead of scanning users. Maintained by a trigger on users.
+
+-- period is one of 'all', 'day', 'week', 'month'; period_start is 'epoch' for 'all'
+CREATE TABLE IF NOT EXISTS points_distribution (
+    period TEXT NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    points BIGINT NOT NULL,
+    users BIGINT NOT NULL,
+    PRIMARY KEY (period, period_start, points)
+);
+
+-- points earned by a user inside a period window
+CREATE TABLE IF NOT EXISTS user_period_points (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    period TEXT NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    points BIGINT NOT NULL,
+    PRIMARY KEY (user_id, period, period_start)
+);
+
+CREATE OR REPLACE FUNCTION points_distribution_move(p_period TEXT, p_start TIMESTAMPTZ, p_from BIGINT, p_to BIGINT)
+RETURNS void AS $$
+BEGIN
+    IF p_from IS NOT NULL THEN
+        UPDATE points_distribution SET users = users - 1
+        WHERE period = p_period AND period_start = p_start AND points = p_from;
+        DELETE FROM points_distribution
+        WHERE period = p_period AND period_start = p_start AND points = p_from AND users <= 0;
+    END IF;
+    IF p_to IS NOT NULL THEN
+        INSERT INTO points_distribution (period, period_start, points, users)
+        VALUES (p_period, p_start, p_to, 1)
+        ON CONFLICT (period, period_start, points) DO UPDATE SET users = points_distribution.users + 1;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION users_points_distribution()
+RETURNS trigger AS $$
+DECLARE
+    p TEXT;
+    p_start TIMESTAMPTZ;
+    old_pts BIGINT;
+    new_pts BIGINT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM points_distribution_move('all', 'epoch', NULL, NEW.points);
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        PERFORM points_distribution_move('all', 'epoch', OLD.points, NULL);
+        FOR p, p_start, old_pts IN
+            SELECT period, period_start, points FROM user_period_points WHERE user_id = OLD.id
+        LOOP
+            PERFORM points_distribution_move(p, p_start, old_pts, NULL);
+        END LOOP;
+        RETURN OLD;
+    END IF;
+
+    IF NEW.points = OLD.points THEN
+        RETURN NEW;
+    END IF;
+
+    PERFORM points_distribution_move('all', 'epoch', OLD.points, NEW.points);
+    FOREACH p IN ARRAY ARRAY['day', 'week', 'month'] LOOP
+        p_start := date_trunc(p, now());
+        old_pts := NULL;
+        SELECT points INTO old_pts FROM user_period_points
+        WHERE user_id = NEW.id AND period = p AND period_start = p_start;
+        new_pts := COALESCE(old_pts, 0) + (NEW.points - OLD.points);
+
+        INSERT INTO user_period_points (user_id, period, period_start, points)
+        VALUES (NEW.id, p, p_start, new_pts)
+        ON CONFLICT (user_id, period, period_start) DO UPDATE SET points = EXCLUDED.points;
+        PERFORM points_distribution_move(p, p_start, old_pts, new_pts);
+    END LOOP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_points_distribution ON users;
+CREATE TRIGGER users_points_distribution
+    AFTER INSERT OR UPDATE OF points ON users
+    FOR EACH ROW EXECUTE FUNCTION users_points_distribution();
+
+DROP TRIGGER IF EXISTS users_points_distribution_delete ON users;
+CREATE TRIGGER users_points_distribution_delete
+    BEFORE DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION users_points_distribution();
+
+-- backfill lifetime distribution for existing users
+INSERT INTO points_distribution (period, period_start, points, users)
+SELECT 'all', 'epoch', points, COUNT(*) FROM users GROUP BY points
+ON CONFLICT (period, period_start, points) DO NOTHING;
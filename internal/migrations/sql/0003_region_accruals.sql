@@ -0,0 +1,30 @@
+-- 0003_region_accruals.sql
+-- Append-only, region-tagged record of every point accrual. Accruals only ever
+-- add to a balance, so applying them in any order on any region converges to
+-- the same users.points (commutative merge).
+
+-- region whose instance owns writes for this user; NULL means any region
+ALTER TABLE users ADD COLUMN IF NOT EXISTS home_region TEXT;
+
+CREATE SEQUENCE IF NOT EXISTS point_accruals_local_seq;
+
+CREATE TABLE IF NOT EXISTS point_accruals (
+    origin_region TEXT NOT NULL,
+    origin_seq BIGINT NOT NULL DEFAULT nextval('point_accruals_local_seq'),
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL,
+    reason TEXT NOT NULL,
+    -- clock_timestamp() tracks sequence allocation order, unlike now()
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (origin_region, origin_seq)
+);
+
+CREATE INDEX IF NOT EXISTS point_accruals_user_idx ON point_accruals (user_id);
+
+-- last origin_seq merged from each peer region
+CREATE TABLE IF NOT EXISTS replication_cursors (
+    peer_region TEXT PRIMARY KEY,
+    last_seq BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
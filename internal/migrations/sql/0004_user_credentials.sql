@@ -0,0 +1,4 @@
+-- 0004_user_credentials.sql
+-- bcrypt hash for users created via /auth/register; NULL for users created
+-- by hand, who can't log in with a password.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
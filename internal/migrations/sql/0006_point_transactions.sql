@@ -0,0 +1,18 @@
+-- 0006_point_transactions.sql
+-- The region-tagged accrual log becomes the general points ledger: signed
+-- amounts (credits > 0, debits < 0), with a local id for stable paging.
+ALTER TABLE IF EXISTS point_accruals RENAME TO point_transactions;
+ALTER SEQUENCE IF EXISTS point_accruals_local_seq RENAME TO point_transactions_local_seq;
+DROP INDEX IF EXISTS point_accruals_user_idx;
+
+ALTER TABLE point_transactions ADD COLUMN IF NOT EXISTS id BIGSERIAL UNIQUE;
+CREATE INDEX IF NOT EXISTS point_transactions_user_idx ON point_transactions (user_id, id DESC);
+
+-- Opening balance for points awarded before the ledger existed. Tagged with a
+-- non-region origin so peers never replicate it.
+INSERT INTO point_transactions (origin_region, user_id, amount, reason)
+SELECT 'opening', u.id, u.points - COALESCE(SUM(pt.amount), 0), 'opening_balance'
+FROM users u
+LEFT JOIN point_transactions pt ON pt.user_id = u.id
+GROUP BY u.id, u.points
+HAVING u.points - COALESCE(SUM(pt.amount), 0) <> 0;
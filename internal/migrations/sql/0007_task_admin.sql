@@ -0,0 +1,12 @@
+-- 0007_task_admin.sql
+-- Task metadata managed through /admin/tasks. Inactive tasks are archived:
+-- they keep their completions but can no longer be completed.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS ends_at TIMESTAMPTZ;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_window_check;
+ALTER TABLE tasks ADD CONSTRAINT tasks_window_check
+    CHECK (starts_at IS NULL OR ends_at IS NULL OR ends_at > starts_at);
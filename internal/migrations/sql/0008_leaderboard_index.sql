@@ -0,0 +1,3 @@
+-- 0008_leaderboard_index.sql
+-- Serves leaderboard pages and rank counts in (points DESC, id ASC) order.
+CREATE INDEX IF NOT EXISTS users_leaderboard_idx ON users (points DESC, id ASC);
@@ -0,0 +1,5 @@
+-- 0009_period_leaderboard_index.sql
+-- Serves daily/weekly/monthly leaderboards straight from user_period_points in
+-- (points DESC, user_id ASC) order within the current window.
+CREATE INDEX IF NOT EXISTS user_period_points_leaderboard_idx
+    ON user_period_points (period, period_start, points DESC, user_id ASC);
@@ -0,0 +1,17 @@
+-- 0010_idempotency_keys.sql
+-- Responses to mutating requests sent with an Idempotency-Key header, scoped
+-- to the calling user. status is NULL while the first request is in flight;
+-- locked_until lets a retry take over a claim whose holder died.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id BIGINT NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status INT,
+    content_type TEXT,
+    body BYTEA,
+    locked_until TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
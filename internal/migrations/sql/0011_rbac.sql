@@ -0,0 +1,36 @@
+-- 0011_rbac.sql
+-- Roles grant permissions; users hold roles. The seeded roles can be edited
+-- in place, the application only reads role_permissions.
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access'),
+    ('moderator', 'Manages tasks and can view any user'),
+    ('support', 'Can view any user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('admin', 'tasks:manage'),
+    ('admin', 'roles:manage'),
+    ('moderator', 'users:read'),
+    ('moderator', 'tasks:manage'),
+    ('support', 'users:read')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,11 @@
+-- 0012_task_dependencies.sql
+-- A task stays locked for a user until they have completed every task it
+-- requires. Cycles are rejected by the application.
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    requires_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    PRIMARY KEY (task_code, requires_code),
+    CHECK (task_code <> requires_code)
+);
+
+CREATE INDEX IF NOT EXISTS task_dependencies_requires_idx ON task_dependencies (requires_code);
@@ -0,0 +1,7 @@
+-- 0013_task_verifiers.sql
+-- Tasks that can't be self-reported name a verifier ("webhook", "telegram",
+-- ...) that must confirm a completion before points are awarded.
+-- verifier_config is verifier-specific: the URL for webhooks, the chat for
+-- telegram. An empty verifier means the task is self-reported.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS verifier TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS verifier_config TEXT NOT NULL DEFAULT '';
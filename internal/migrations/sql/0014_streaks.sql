@@ -0,0 +1,10 @@
+-- 0014_streaks.sql
+-- A streak counts consecutive days (in the database time zone) with at least
+-- one task completion; it grows the multiplier applied to task points.
+-- current is only meaningful while last_day is today or yesterday.
+CREATE TABLE IF NOT EXISTS user_streaks (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    current INT NOT NULL,
+    longest INT NOT NULL,
+    last_day DATE NOT NULL
+);
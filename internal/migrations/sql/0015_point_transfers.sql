@@ -0,0 +1,14 @@
+-- 0015_point_transfers.sql
+-- Points gifted between users. Each transfer also writes a debit and a
+-- credit to point_transactions; this table backs the daily cap and the
+-- sender/recipient link the ledger lacks.
+CREATE TABLE IF NOT EXISTS point_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    from_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS point_transfers_from_idx ON point_transfers (from_user_id, created_at);
@@ -0,0 +1,98 @@
+-- 0020_user_deletion.sql
+-- DELETE /users/{id} keeps the row, so the ledger, transfers and referrals
+-- still point at it, but sets deleted_at and scrubs the personal fields. What
+-- was scrubbed waits in deleted_users until an admin restores the account or
+-- the grace period ends and it is purged.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS deleted_users (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    password_hash TEXT,
+    display_name TEXT NOT NULL,
+    avatar_url TEXT NOT NULL,
+    timezone TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS deleted_users_deleted_at_idx ON deleted_users (deleted_at);
+
+-- Deleted users leave every distribution and come back on restore. Their
+-- user_period_points rows stay current meanwhile (replicated accruals can
+-- still move their balance), so a restore puts back what they hold now.
+CREATE OR REPLACE FUNCTION users_points_distribution()
+RETURNS trigger AS $$
+DECLARE
+    p TEXT;
+    p_start TIMESTAMPTZ;
+    old_pts BIGINT;
+    new_pts BIGINT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM points_distribution_move('all', 'epoch', NULL, NEW.points);
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.deleted_at IS NOT NULL THEN
+            RETURN OLD;
+        END IF;
+        PERFORM points_distribution_move('all', 'epoch', OLD.points, NULL);
+        FOR p, p_start, old_pts IN
+            SELECT period, period_start, points FROM user_period_points WHERE user_id = OLD.id
+        LOOP
+            PERFORM points_distribution_move(p, p_start, old_pts, NULL);
+        END LOOP;
+        RETURN OLD;
+    END IF;
+
+    -- soft delete and restore never change points in the same statement
+    IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        PERFORM points_distribution_move('all', 'epoch', OLD.points, NULL);
+        FOR p, p_start, old_pts IN
+            SELECT period, period_start, points FROM user_period_points WHERE user_id = OLD.id
+        LOOP
+            PERFORM points_distribution_move(p, p_start, old_pts, NULL);
+        END LOOP;
+        RETURN NEW;
+    END IF;
+    IF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        PERFORM points_distribution_move('all', 'epoch', NULL, NEW.points);
+        FOR p, p_start, new_pts IN
+            SELECT period, period_start, points FROM user_period_points WHERE user_id = NEW.id
+        LOOP
+            PERFORM points_distribution_move(p, p_start, NULL, new_pts);
+        END LOOP;
+        RETURN NEW;
+    END IF;
+
+    IF NEW.points = OLD.points THEN
+        RETURN NEW;
+    END IF;
+
+    IF NEW.deleted_at IS NULL THEN
+        PERFORM points_distribution_move('all', 'epoch', OLD.points, NEW.points);
+    END IF;
+    FOREACH p IN ARRAY ARRAY['day', 'week', 'month'] LOOP
+        p_start := date_trunc(p, now());
+        old_pts := NULL;
+        SELECT points INTO old_pts FROM user_period_points
+        WHERE user_id = NEW.id AND period = p AND period_start = p_start;
+        new_pts := COALESCE(old_pts, 0) + (NEW.points - OLD.points);
+
+        INSERT INTO user_period_points (user_id, period, period_start, points)
+        VALUES (NEW.id, p, p_start, new_pts)
+        ON CONFLICT (user_id, period, period_start) DO UPDATE SET points = EXCLUDED.points;
+        IF NEW.deleted_at IS NULL THEN
+            PERFORM points_distribution_move(p, p_start, old_pts, new_pts);
+        END IF;
+    END LOOP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_points_distribution ON users;
+CREATE TRIGGER users_points_distribution
+    AFTER INSERT OR UPDATE OF points, deleted_at ON users
+    FOR EACH ROW EXECUTE FUNCTION users_points_distribution();
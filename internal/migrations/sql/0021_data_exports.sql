@@ -0,0 +1,19 @@
+-- 0021_data_exports.sql
+-- Copies of a user's data requested through GET /users/{id}/export that were
+-- too large to stream, built by a worker and kept until expires_at.
+CREATE TABLE IF NOT EXISTS data_exports (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    format TEXT NOT NULL CHECK (format IN ('json', 'csv')),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    content BYTEA,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS data_exports_pending_idx ON data_exports (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS data_exports_user_idx ON data_exports (user_id);
+CREATE INDEX IF NOT EXISTS data_exports_expires_idx ON data_exports (expires_at);
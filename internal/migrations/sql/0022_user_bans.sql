@@ -0,0 +1,9 @@
+-- 0022_user_bans.sql
+-- Banned users can't sign in; banned_at is NULL for everyone else.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS banned_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS ban_reason TEXT NOT NULL DEFAULT '';
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:manage')
+ON CONFLICT (role, permission) DO NOTHING;
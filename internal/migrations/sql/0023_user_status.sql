@@ -0,0 +1,15 @@
+-- 0023_user_status.sql
+-- Replaces banned_at with a status: suspended users can sign in but not earn
+-- or move points, banned users can't sign in. A suspension with
+-- status_until set ends then; the application reads it as active afterwards.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'suspended', 'banned')),
+    ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status_until TIMESTAMPTZ;
+
+UPDATE users SET status = 'banned', status_reason = ban_reason WHERE banned_at IS NOT NULL;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS banned_at,
+    DROP COLUMN IF EXISTS ban_reason;
@@ -0,0 +1,6 @@
+-- 0024_user_settings.sql
+-- How the user appears on leaderboards: under their name, as "Anonymous",
+-- or not at all. Hidden users still earn points and count in percentiles.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS leaderboard_visibility TEXT NOT NULL DEFAULT 'public'
+        CHECK (leaderboard_visibility IN ('public', 'anonymous', 'hidden'));
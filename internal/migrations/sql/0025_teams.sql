@@ -0,0 +1,42 @@
+-- 0025_teams.sql
+-- Teams and their members; a user is in at most one team. teams.points is
+-- what members earned (or spent) while in the team, kept by a trigger on
+-- users.points like user_period_points, and stays with the team when they
+-- leave.
+CREATE TABLE IF NOT EXISTS teams (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    points BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS teams_name_idx ON teams (lower(name));
+CREATE INDEX IF NOT EXISTS teams_leaderboard_idx ON teams (points DESC, id ASC);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    team_id BIGINT NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS team_members_team_idx ON team_members (team_id, joined_at);
+
+CREATE OR REPLACE FUNCTION users_team_points()
+RETURNS trigger AS $$
+BEGIN
+    IF NEW.points <> OLD.points THEN
+        UPDATE teams SET points = points + (NEW.points - OLD.points)
+        WHERE id = (SELECT team_id FROM team_members WHERE user_id = NEW.id);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_team_points ON users;
+CREATE TRIGGER users_team_points
+    AFTER UPDATE OF points ON users
+    FOR EACH ROW EXECUTE FUNCTION users_team_points();
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'teams:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,57 @@
+-- 0026_seasons.sql
+-- Seasons are admin-defined [starts_at, ends_at) windows that don't
+-- overlap. season_points is what users earned in a season while it runs,
+-- kept by a trigger on users.points like teams.points. When a season is
+-- over its final standings are copied to season_results, its season_points
+-- rows are dropped and archived_at is set.
+CREATE TABLE IF NOT EXISTS seasons (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL CHECK (ends_at > starts_at),
+    archived_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS seasons_window_idx ON seasons (starts_at, ends_at);
+
+CREATE TABLE IF NOT EXISTS season_points (
+    season_id BIGINT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    points BIGINT NOT NULL,
+    PRIMARY KEY (season_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS season_points_leaderboard_idx ON season_points (season_id, points DESC, user_id ASC);
+
+CREATE TABLE IF NOT EXISTS season_results (
+    season_id BIGINT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rank INT NOT NULL,
+    points BIGINT NOT NULL,
+    PRIMARY KEY (season_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS season_results_rank_idx ON season_results (season_id, rank);
+
+CREATE OR REPLACE FUNCTION users_season_points()
+RETURNS trigger AS $$
+BEGIN
+    IF NEW.points <> OLD.points THEN
+        INSERT INTO season_points (season_id, user_id, points)
+        SELECT id, NEW.id, NEW.points - OLD.points FROM seasons
+        WHERE starts_at <= now() AND ends_at > now() AND archived_at IS NULL
+        ON CONFLICT (season_id, user_id) DO UPDATE SET points = season_points.points + EXCLUDED.points;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_season_points ON users;
+CREATE TRIGGER users_season_points
+    AFTER UPDATE OF points ON users
+    FOR EACH ROW EXECUTE FUNCTION users_season_points();
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'seasons:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,14 @@
+-- 0027_scheduled_jobs.sql
+-- The slot each scheduled job last ran for. A run first moves slot forward,
+-- which only one instance can do for a given slot, and records how it
+-- ended when it is over. The index is for the job dropping expired refresh
+-- tokens.
+CREATE TABLE IF NOT EXISTS job_runs (
+    name TEXT PRIMARY KEY,
+    slot TIMESTAMPTZ NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_idx ON refresh_tokens (expires_at);
@@ -0,0 +1,12 @@
+-- 0028_reports.sql
+-- /admin/reports groups these tables by day over a date range; the indexes
+-- keep that to the rows in range.
+CREATE INDEX IF NOT EXISTS user_tasks_completed_idx ON user_tasks (completed_at);
+CREATE INDEX IF NOT EXISTS users_created_idx ON users (created_at);
+CREATE INDEX IF NOT EXISTS referrals_created_idx ON referrals (created_at);
+CREATE INDEX IF NOT EXISTS point_transactions_recorded_idx ON point_transactions (recorded_at);
+CREATE INDEX IF NOT EXISTS point_transfers_created_idx ON point_transfers (created_at);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'reports:read')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,21 @@
+-- 0029_report_exports.sql
+-- CSVs of reports requested through POST /admin/exports, built by the
+-- same workers as data_exports and kept until expires_at. requested_by
+-- has no foreign key: the audit log already says who asked, and an admin
+-- token's subject needn't be a user.
+CREATE TABLE IF NOT EXISTS report_exports (
+    id BIGSERIAL PRIMARY KEY,
+    report TEXT NOT NULL CHECK (report IN ('leaderboard', 'activity')),
+    params JSONB NOT NULL DEFAULT '{}',
+    requested_by BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    content BYTEA,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS report_exports_pending_idx ON report_exports (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS report_exports_expires_idx ON report_exports (expires_at);
@@ -0,0 +1,35 @@
+-- 0030_balance_invariants.sql
+-- Balances can't be debited below zero. This is a trigger rather than a
+-- CHECK so that merging another region's ledger can still apply a debit
+-- before the credits it relied on arrive: MergeAccrual sets
+-- app.merging_accruals for its transaction. Balances already negative are
+-- left alone, and can still be credited.
+CREATE OR REPLACE FUNCTION users_points_nonnegative()
+RETURNS trigger AS $$
+BEGIN
+    IF NEW.points < 0 AND NEW.points < OLD.points
+       AND current_setting('app.merging_accruals', true) IS DISTINCT FROM 'on' THEN
+        RAISE EXCEPTION 'balance of user % would go below zero', NEW.id
+            USING ERRCODE = 'check_violation', CONSTRAINT = 'users_points_nonnegative';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_points_nonnegative ON users;
+CREATE TRIGGER users_points_nonnegative
+    BEFORE UPDATE OF points ON users
+    FOR EACH ROW EXECUTE FUNCTION users_points_nonnegative();
+
+-- Users whose balance differed from their ledger sum at the last
+-- reconciliation run, replaced on every run.
+CREATE TABLE IF NOT EXISTS point_discrepancies (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    points BIGINT NOT NULL,
+    ledger_points BIGINT NOT NULL,
+    found_at TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'points:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,30 @@
+-- 0031_task_categories.sql
+-- Categories group tasks for display; a task is in at most one. Deleting a
+-- category leaves its tasks without one. Tags are free-form labels.
+CREATE TABLE IF NOT EXISTS task_categories (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    position INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS category TEXT REFERENCES task_categories(code) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS tasks_category_idx ON tasks (category);
+
+CREATE TABLE IF NOT EXISTS task_tags (
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (task_code, tag)
+);
+
+INSERT INTO task_categories (code, name, position) VALUES
+    ('onboarding', 'Onboarding', 10),
+    ('social', 'Social', 20),
+    ('daily', 'Daily', 30),
+    ('purchase', 'Purchases', 40)
+ON CONFLICT (code) DO NOTHING;
+
+UPDATE tasks SET category = 'social' WHERE code IN ('subscribe_telegram', 'subscribe_twitter') AND category IS NULL;
+UPDATE tasks SET category = 'onboarding' WHERE code IN ('enter_referral_code', 'complete_profile') AND category IS NULL;
+UPDATE tasks SET category = 'daily' WHERE code = 'daily_checkin' AND category IS NULL;
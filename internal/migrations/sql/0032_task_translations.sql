@@ -0,0 +1,13 @@
+-- 0032_task_translations.sql
+-- Task titles and descriptions in other locales than the default one,
+-- which is what tasks.title and tasks.description are written in.
+CREATE TABLE IF NOT EXISTS task_translations (
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (task_code, locale)
+);
+
+CREATE INDEX IF NOT EXISTS task_translations_locale_idx ON task_translations (locale);
@@ -0,0 +1,15 @@
+-- 0033_task_completion_limits.sql
+-- Tasks can be completed max_completions_per_user times by each user and
+-- max_completions times in all (NULL for no cap). user_tasks numbers a
+-- user's completions of a task from 1 in n, so racing completions collide
+-- on the key; tasks.completions counts them toward the cap.
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS max_completions BIGINT CHECK (max_completions > 0),
+    ADD COLUMN IF NOT EXISTS max_completions_per_user INT NOT NULL DEFAULT 1 CHECK (max_completions_per_user > 0),
+    ADD COLUMN IF NOT EXISTS completions BIGINT NOT NULL DEFAULT 0;
+
+UPDATE tasks t SET completions = (SELECT COUNT(*) FROM user_tasks ut WHERE ut.task_code = t.code);
+
+ALTER TABLE user_tasks ADD COLUMN IF NOT EXISTS n INT NOT NULL DEFAULT 1;
+ALTER TABLE user_tasks DROP CONSTRAINT IF EXISTS user_tasks_pkey;
+ALTER TABLE user_tasks ADD PRIMARY KEY (user_id, task_code, n);
@@ -0,0 +1,21 @@
+-- 0034_task_submissions.sql
+-- Tasks with requires_review are completed by submitting proof, which an
+-- admin approves or rejects. Approval records the completion in user_tasks
+-- and awards the points; a user has at most one pending submission per task.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS requires_review BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS task_submissions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    proof JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reason TEXT NOT NULL DEFAULT '',
+    awarded BIGINT NOT NULL DEFAULT 0,
+    reviewed_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    reviewed_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS task_submissions_pending_idx ON task_submissions (user_id, task_code) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS task_submissions_status_idx ON task_submissions (status, id);
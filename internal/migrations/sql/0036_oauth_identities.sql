@@ -0,0 +1,14 @@
+-- 0036_oauth_identities.sql
+-- Accounts at OAuth providers (Google, GitHub) users sign in with, by the
+-- provider's stable subject id. A user has at most one per provider.
+-- Users created through a provider have an empty password hash, which
+-- password login never matches.
+CREATE TABLE IF NOT EXISTS oauth_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, subject),
+    UNIQUE (user_id, provider)
+);
@@ -0,0 +1,22 @@
+-- 0038_leaderboard_ranks.sql
+-- Precomputed leaderboard positions, rebuilt by the refresh_leaderboards
+-- job so leaderboard pages and ranks don't count rows on every read.
+-- leaderboard_ranks holds every visible user of a period's board with their
+-- rank and points as of the last refresh; leaderboard_refreshes records
+-- which window that was and when.
+CREATE TABLE IF NOT EXISTS leaderboard_ranks (
+    period TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rank BIGINT NOT NULL,
+    points BIGINT NOT NULL,
+    PRIMARY KEY (period, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS leaderboard_ranks_order_idx
+    ON leaderboard_ranks (period, points DESC, user_id ASC);
+
+CREATE TABLE IF NOT EXISTS leaderboard_refreshes (
+    period TEXT PRIMARY KEY,
+    period_start TIMESTAMPTZ NOT NULL,
+    refreshed_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+-- 0039_user_tasks_recent.sql
+-- GET /users/{id}/tasks pages a user's completions newest first.
+CREATE INDEX IF NOT EXISTS user_tasks_user_recent_idx ON user_tasks (user_id, completed_at DESC, task_code DESC, n DESC);
@@ -0,0 +1,13 @@
+-- 0040_feature_flags.sql
+-- Feature rollouts set at runtime through /admin/flags. A row overrides the
+-- flag's configured rollout until it is deleted.
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    percent INT NOT NULL CHECK (percent BETWEEN 0 AND 100),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'flags:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,29 @@
+-- 0041_points_stream.sql
+-- The ledger becomes each user's points stream, which balances are built
+-- from: user_seq numbers a user's entries from 1 without gaps, and balance
+-- is what their balance came to once the entry was applied.
+-- users.points_seq is the last entry users.points includes. Existing
+-- entries are numbered in id order.
+ALTER TABLE point_transactions ADD COLUMN IF NOT EXISTS user_seq BIGINT;
+ALTER TABLE point_transactions ADD COLUMN IF NOT EXISTS balance BIGINT;
+
+UPDATE point_transactions pt SET user_seq = s.user_seq, balance = s.balance
+FROM (
+    SELECT id,
+           row_number() OVER (PARTITION BY user_id ORDER BY id) AS user_seq,
+           SUM(amount) OVER (PARTITION BY user_id ORDER BY id) AS balance
+    FROM point_transactions
+) s
+WHERE pt.id = s.id AND pt.user_seq IS NULL;
+
+ALTER TABLE point_transactions ALTER COLUMN user_seq SET NOT NULL;
+ALTER TABLE point_transactions ALTER COLUMN balance SET NOT NULL;
+
+-- two writers can't take the same place in a stream
+CREATE UNIQUE INDEX IF NOT EXISTS point_transactions_user_seq_idx ON point_transactions (user_id, user_seq);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS points_seq BIGINT NOT NULL DEFAULT 0;
+
+UPDATE users u SET points_seq = s.user_seq
+FROM (SELECT user_id, MAX(user_seq) AS user_seq FROM point_transactions GROUP BY user_id) s
+WHERE u.id = s.user_id;
@@ -0,0 +1,4 @@
+-- 0042_user_version.sql
+-- users.version goes up with every change to a user's profile or balance,
+-- so a writer can tell whether the row is still the one it read.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
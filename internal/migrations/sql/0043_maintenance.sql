@@ -0,0 +1,14 @@
+-- 0043_maintenance.sql
+-- Maintenance mode set at runtime through /admin/maintenance. The single
+-- row overrides the configured mode until it is deleted.
+CREATE TABLE IF NOT EXISTS maintenance (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    enabled BOOLEAN NOT NULL,
+    message TEXT NOT NULL,
+    retry_after INT NOT NULL CHECK (retry_after >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'maintenance:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,11 @@
+-- 0044_referral_payouts.sql
+-- Referral bonuses can wait until the referred user reaches a milestone.
+-- A pending referral is paid by the pay_referrals job, or expires; the
+-- ones made before this were paid when they were made.
+ALTER TABLE referrals
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'paid' CHECK (status IN ('pending', 'paid', 'expired')),
+    ADD COLUMN IF NOT EXISTS paid_at TIMESTAMPTZ;
+
+UPDATE referrals SET paid_at = created_at WHERE status = 'paid' AND paid_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS referrals_pending_idx ON referrals (id) WHERE status = 'pending';
@@ -0,0 +1,21 @@
+-- 0045_referral_links.sql
+-- Referral links: a user's code opens /r/{code}, which records a click and
+-- hands the visitor a token; signing up with it sets the referrer and
+-- marks the click converted. Codes are made the first time a user asks for
+-- their link.
+CREATE TABLE IF NOT EXISTS referral_codes (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    code TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS referral_clicks (
+    id BIGSERIAL PRIMARY KEY,
+    referrer_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    referred_id BIGINT UNIQUE REFERENCES users(id) ON DELETE SET NULL,
+    signed_up_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS referral_clicks_created_idx ON referral_clicks (created_at);
@@ -0,0 +1,42 @@
+-- 0046_campaigns.sql
+-- Time-boxed promotions: while a campaign runs, completions of the tasks
+-- it covers are scaled by its multiplier and get its bonus points. A
+-- campaign covers the tasks in campaign_tasks and those in its category,
+-- or every task with neither; neither is a foreign key, so deleting a task
+-- or category can't widen a campaign. campaign_awards records what each
+-- campaign added to each completion, for its report.
+CREATE TABLE IF NOT EXISTS campaigns (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    multiplier DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (multiplier > 0),
+    bonus_points BIGINT NOT NULL DEFAULT 0 CHECK (bonus_points >= 0),
+    category TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS campaigns_ends_at_idx ON campaigns (ends_at);
+
+CREATE TABLE IF NOT EXISTS campaign_tasks (
+    campaign_id BIGINT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL,
+    PRIMARY KEY (campaign_id, task_code)
+);
+
+CREATE TABLE IF NOT EXISTS campaign_awards (
+    id BIGSERIAL PRIMARY KEY,
+    campaign_id BIGINT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL,
+    awarded BIGINT NOT NULL,
+    extra BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS campaign_awards_campaign_idx ON campaign_awards (campaign_id, task_code);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'campaigns:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,19 @@
+-- 0047_award_rules.sql
+-- Award modifiers: enabled rules whose conditions match a completion scale
+-- its points by multiplier and add bonus_points, in position order. The
+-- conditions are a JSON object the service parses and validates.
+CREATE TABLE IF NOT EXISTS award_rules (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    conditions JSONB NOT NULL DEFAULT '{}',
+    multiplier DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (multiplier > 0),
+    bonus_points BIGINT NOT NULL DEFAULT 0 CHECK (bonus_points >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'rules:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,10 @@
+-- 0048_user_levels.sql
+-- The highest level each user has reached. Levels follow from points and
+-- the configured thresholds; this only remembers which level-ups have
+-- already been announced and paid, so spending points and earning them
+-- back doesn't repeat them.
+CREATE TABLE IF NOT EXISTS user_levels (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL CHECK (level > 0),
+    reached_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+-- 0049_checkins.sql
+-- Daily check-ins, counted like user_streaks but over days in the user's
+-- own time zone: last_day is the local date of the latest check-in, so a
+-- second check-in is refused until the user's calendar moves past it.
+CREATE TABLE IF NOT EXISTS user_checkins (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    current INT NOT NULL,
+    longest INT NOT NULL,
+    last_day DATE NOT NULL
+);
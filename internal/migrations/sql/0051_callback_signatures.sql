@@ -0,0 +1,10 @@
+-- 0051_callback_signatures.sql
+-- Signatures of partner callbacks already accepted, kept until their
+-- timestamp leaves the replay window so each is accepted once.
+CREATE TABLE IF NOT EXISTS callback_signatures (
+    partner TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (partner, signature)
+);
+CREATE INDEX IF NOT EXISTS callback_signatures_expires_idx ON callback_signatures (expires_at);
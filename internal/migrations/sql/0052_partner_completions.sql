@@ -0,0 +1,14 @@
+-- 0052_partner_completions.sql
+-- Task completions partners reported through /callbacks, by the partner's
+-- own reference for the event, which is recorded once so retries don't
+-- award twice.
+CREATE TABLE IF NOT EXISTS partner_completions (
+    partner TEXT NOT NULL,
+    reference TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL,
+    awarded BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (partner, reference)
+);
+CREATE INDEX IF NOT EXISTS partner_completions_user_idx ON partner_completions (user_id);
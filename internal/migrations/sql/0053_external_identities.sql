@@ -0,0 +1,6 @@
+-- 0053_external_identities.sql
+-- oauth_identities becomes the table of every outside account a user is
+-- known by: OAuth subjects, Telegram ids and partner account ids, each
+-- linked to one user. A user still has at most one per provider.
+ALTER TABLE oauth_identities RENAME TO external_identities;
+ALTER TABLE external_identities RENAME COLUMN subject TO external_id;
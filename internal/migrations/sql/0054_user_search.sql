@@ -0,0 +1,9 @@
+-- 0054_user_search.sql
+-- Trigram index behind GET /users/search: it serves both the fuzzy match
+-- (username % query) and the case-insensitive prefix match (username ILIKE
+-- 'query%'). pg_trgm ships with PostgreSQL, but creating an extension
+-- needs the CREATE privilege on the database.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS users_username_trgm ON users USING gin (username gin_trgm_ops)
+    WHERE deleted_at IS NULL;
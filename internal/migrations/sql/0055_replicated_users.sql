@@ -0,0 +1,25 @@
+-- 0055_replicated_users.sql
+-- Ids are assigned by each region's own sequence, so a user is known across
+-- regions by the region that created them and their id there. Users created
+-- locally leave origin_region and origin_id NULL; copies of users created
+-- elsewhere, made when their first ledger entry is merged, carry both.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS origin_region TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS origin_id BIGINT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_origin_idx ON users (origin_region, origin_id)
+    WHERE origin_region IS NOT NULL;
+
+-- peer ledger entries for users that couldn't be copied here, such as a
+-- username already taken locally, kept for an operator instead of holding
+-- up replication
+CREATE TABLE IF NOT EXISTS parked_accruals (
+    peer_region TEXT NOT NULL,
+    origin_seq BIGINT NOT NULL,
+    user_region TEXT NOT NULL,
+    user_id BIGINT NOT NULL,
+    amount BIGINT NOT NULL,
+    reason TEXT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    parked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (peer_region, origin_seq)
+);
@@ -0,0 +1,252 @@
+-- 0001_init.sql
+-- The schema of sql/0001-0018 for SQLite. Times are written by the store
+-- (repository.SQLite) in UTC and one text format so they compare as text,
+-- which is why columns it filters on have no now() default. The store keeps
+-- user_period_points up to date itself instead of a trigger, and counts
+-- distributions directly rather than pre-aggregating them.
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT,
+    points INTEGER NOT NULL DEFAULT 0,
+    referrer_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    -- region whose instance owns writes for this user; NULL means any region
+    home_region TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS users_leaderboard_idx ON users (points DESC, id ASC);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    code TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    points INTEGER NOT NULL CHECK (points >= 0),
+    description TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT 1,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    verifier TEXT NOT NULL DEFAULT '',
+    verifier_config TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (starts_at IS NULL OR ends_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE TABLE IF NOT EXISTS user_tasks (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    completed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, task_code)
+);
+
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    requires_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    PRIMARY KEY (task_code, requires_code),
+    CHECK (task_code <> requires_code)
+);
+
+CREATE INDEX IF NOT EXISTS task_dependencies_requires_idx ON task_dependencies (requires_code);
+
+CREATE TABLE IF NOT EXISTS referrals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    referrer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    referred_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    bonus_referrer INTEGER NOT NULL,
+    bonus_referred INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (referrer_id, referred_id)
+);
+
+-- the points ledger; origin_seq numbers each region's rows for replication
+CREATE TABLE IF NOT EXISTS point_transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    origin_region TEXT NOT NULL,
+    origin_seq INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    recorded_at TIMESTAMP NOT NULL,
+    applied_at TIMESTAMP NOT NULL,
+    UNIQUE (origin_region, origin_seq)
+);
+
+CREATE INDEX IF NOT EXISTS point_transactions_user_idx ON point_transactions (user_id, id DESC);
+
+-- points earned by a user inside a period window
+CREATE TABLE IF NOT EXISTS user_period_points (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    period TEXT NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    points INTEGER NOT NULL,
+    PRIMARY KEY (user_id, period, period_start)
+);
+
+CREATE INDEX IF NOT EXISTS user_period_points_leaderboard_idx
+    ON user_period_points (period, period_start, points DESC, user_id ASC);
+
+CREATE TABLE IF NOT EXISTS point_transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP NOT NULL,
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS point_transfers_from_idx ON point_transfers (from_user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS user_streaks (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    current INTEGER NOT NULL,
+    longest INTEGER NOT NULL,
+    last_day DATE NOT NULL
+);
+
+-- last origin_seq merged from each peer region
+CREATE TABLE IF NOT EXISTS replication_cursors (
+    peer_region TEXT PRIMARY KEY,
+    last_seq INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    replaced_by INTEGER REFERENCES refresh_tokens(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status INTEGER,
+    content_type TEXT,
+    body BLOB,
+    locked_until TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    at TIMESTAMP NOT NULL,
+    actor_id INTEGER,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    before TEXT,
+    after TEXT,
+    ip TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, id);
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    -- pending, delivered or failed (gave up after the last attempt)
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INTEGER,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP,
+    UNIQUE (endpoint_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_endpoint_idx ON webhook_deliveries (endpoint_id, id);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id TEXT NOT NULL UNIQUE,
+    type TEXT NOT NULL,
+    data TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_due_idx ON outbox_events (next_attempt_at) WHERE published_at IS NULL;
+
+-- seed some tasks
+INSERT INTO tasks (code, title, points) VALUES
+    ('subscribe_telegram', 'Subscribe to Telegram channel', 20),
+    ('subscribe_twitter', 'Follow on Twitter/X', 20),
+    ('enter_referral_code', 'Enter referral code', 10),
+    ('complete_profile', 'Complete profile info', 15),
+    ('daily_checkin', 'Daily check-in', 5)
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access'),
+    ('moderator', 'Manages tasks and can view any user'),
+    ('support', 'Can view any user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('admin', 'tasks:manage'),
+    ('admin', 'roles:manage'),
+    ('admin', 'audit:read'),
+    ('admin', 'webhooks:manage'),
+    ('moderator', 'users:read'),
+    ('moderator', 'tasks:manage'),
+    ('support', 'users:read')
+ON CONFLICT (role, permission) DO NOTHING;
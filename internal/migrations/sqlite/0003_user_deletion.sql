@@ -0,0 +1,17 @@
+-- 0003_user_deletion.sql
+-- sql/0020 for SQLite. Distributions are counted from users directly, so
+-- there is no trigger to teach about deleted_at.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS deleted_users (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    password_hash TEXT,
+    display_name TEXT NOT NULL,
+    avatar_url TEXT NOT NULL,
+    timezone TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    deleted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS deleted_users_deleted_at_idx ON deleted_users (deleted_at);
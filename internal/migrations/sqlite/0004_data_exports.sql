@@ -0,0 +1,18 @@
+-- 0004_data_exports.sql
+-- sql/0021 for SQLite.
+CREATE TABLE IF NOT EXISTS data_exports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    format TEXT NOT NULL CHECK (format IN ('json', 'csv')),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    content BLOB,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS data_exports_pending_idx ON data_exports (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS data_exports_user_idx ON data_exports (user_id);
+CREATE INDEX IF NOT EXISTS data_exports_expires_idx ON data_exports (expires_at);
@@ -0,0 +1,8 @@
+-- 0005_user_bans.sql
+-- sql/0022 for SQLite.
+ALTER TABLE users ADD COLUMN banned_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN ban_reason TEXT NOT NULL DEFAULT '';
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:manage')
+ON CONFLICT (role, permission) DO NOTHING;
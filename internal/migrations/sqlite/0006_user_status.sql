@@ -0,0 +1,11 @@
+-- 0006_user_status.sql
+-- sql/0023 for SQLite.
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'suspended', 'banned'));
+ALTER TABLE users ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_until TIMESTAMP;
+
+UPDATE users SET status = 'banned', status_reason = ban_reason WHERE banned_at IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN banned_at;
+ALTER TABLE users DROP COLUMN ban_reason;
@@ -0,0 +1,4 @@
+-- 0007_user_settings.sql
+-- sql/0024 for SQLite.
+ALTER TABLE users ADD COLUMN leaderboard_visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (leaderboard_visibility IN ('public', 'anonymous', 'hidden'));
@@ -0,0 +1,24 @@
+-- 0008_teams.sql
+-- sql/0025 for SQLite. The store moves teams.points itself along with
+-- user_period_points instead of a trigger.
+CREATE TABLE IF NOT EXISTS teams (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    points INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS teams_name_idx ON teams (lower(name));
+CREATE INDEX IF NOT EXISTS teams_leaderboard_idx ON teams (points DESC, id ASC);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    joined_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS team_members_team_idx ON team_members (team_id, joined_at);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'teams:manage')
+ON CONFLICT (role, permission) DO NOTHING;
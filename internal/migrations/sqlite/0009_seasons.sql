@@ -0,0 +1,36 @@
+-- 0009_seasons.sql
+-- sql/0026 for SQLite. The store moves season_points itself along with
+-- teams.points instead of a trigger.
+CREATE TABLE IF NOT EXISTS seasons (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL CHECK (ends_at > starts_at),
+    archived_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS seasons_window_idx ON seasons (starts_at, ends_at);
+
+CREATE TABLE IF NOT EXISTS season_points (
+    season_id INTEGER NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    points INTEGER NOT NULL,
+    PRIMARY KEY (season_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS season_points_leaderboard_idx ON season_points (season_id, points DESC, user_id ASC);
+
+CREATE TABLE IF NOT EXISTS season_results (
+    season_id INTEGER NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rank INTEGER NOT NULL,
+    points INTEGER NOT NULL,
+    PRIMARY KEY (season_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS season_results_rank_idx ON season_results (season_id, rank);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'seasons:manage')
+ON CONFLICT (role, permission) DO NOTHING;
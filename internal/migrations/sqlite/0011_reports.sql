@@ -0,0 +1,11 @@
+-- 0011_reports.sql
+-- sql/0028 for SQLite.
+CREATE INDEX IF NOT EXISTS user_tasks_completed_idx ON user_tasks (completed_at);
+CREATE INDEX IF NOT EXISTS users_created_idx ON users (created_at);
+CREATE INDEX IF NOT EXISTS referrals_created_idx ON referrals (created_at);
+CREATE INDEX IF NOT EXISTS point_transactions_recorded_idx ON point_transactions (recorded_at);
+CREATE INDEX IF NOT EXISTS point_transfers_created_idx ON point_transfers (created_at);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'reports:read')
+ON CONFLICT (role, permission) DO NOTHING;
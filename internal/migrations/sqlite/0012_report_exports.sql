@@ -0,0 +1,18 @@
+-- 0012_report_exports.sql
+-- sql/0029 for SQLite.
+CREATE TABLE IF NOT EXISTS report_exports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    report TEXT NOT NULL CHECK (report IN ('leaderboard', 'activity')),
+    params TEXT NOT NULL DEFAULT '{}',
+    requested_by INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    content BLOB,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS report_exports_pending_idx ON report_exports (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS report_exports_expires_idx ON report_exports (expires_at);
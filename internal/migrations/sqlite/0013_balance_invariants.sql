@@ -0,0 +1,23 @@
+-- 0013_balance_invariants.sql
+-- sql/0030 for SQLite. MergeAccrual holds a row in merging_accruals for
+-- the length of a merge instead of setting app.merging_accruals.
+CREATE TABLE IF NOT EXISTS merging_accruals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT
+);
+
+CREATE TRIGGER IF NOT EXISTS users_points_nonnegative BEFORE UPDATE OF points ON users
+WHEN NEW.points < 0 AND NEW.points < OLD.points AND NOT EXISTS (SELECT 1 FROM merging_accruals)
+BEGIN
+    SELECT RAISE(ABORT, 'users_points_nonnegative: balance would go below zero');
+END;
+
+CREATE TABLE IF NOT EXISTS point_discrepancies (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    points INTEGER NOT NULL,
+    ledger_points INTEGER NOT NULL,
+    found_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'points:manage')
+ON CONFLICT (role, permission) DO NOTHING;
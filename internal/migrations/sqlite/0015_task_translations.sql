@@ -0,0 +1,12 @@
+-- 0015_task_translations.sql
+-- sql/0032 for SQLite.
+CREATE TABLE IF NOT EXISTS task_translations (
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (task_code, locale)
+);
+
+CREATE INDEX IF NOT EXISTS task_translations_locale_idx ON task_translations (locale);
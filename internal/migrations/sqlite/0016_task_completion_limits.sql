@@ -0,0 +1,22 @@
+-- 0016_task_completion_limits.sql
+-- sql/0033 for SQLite, which can't change a primary key in place, so
+-- user_tasks is rebuilt.
+ALTER TABLE tasks ADD COLUMN max_completions INTEGER CHECK (max_completions > 0);
+ALTER TABLE tasks ADD COLUMN max_completions_per_user INTEGER NOT NULL DEFAULT 1 CHECK (max_completions_per_user > 0);
+ALTER TABLE tasks ADD COLUMN completions INTEGER NOT NULL DEFAULT 0;
+
+UPDATE tasks SET completions = (SELECT COUNT(*) FROM user_tasks ut WHERE ut.task_code = tasks.code);
+
+CREATE TABLE user_tasks_new (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    n INTEGER NOT NULL DEFAULT 1,
+    completed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, task_code, n)
+);
+INSERT INTO user_tasks_new (user_id, task_code, n, completed_at)
+    SELECT user_id, task_code, 1, completed_at FROM user_tasks;
+DROP TABLE user_tasks;
+ALTER TABLE user_tasks_new RENAME TO user_tasks;
+
+CREATE INDEX IF NOT EXISTS user_tasks_completed_idx ON user_tasks (completed_at);
@@ -0,0 +1,19 @@
+-- 0017_task_submissions.sql
+-- sql/0034 for SQLite.
+ALTER TABLE tasks ADD COLUMN requires_review BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS task_submissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL REFERENCES tasks(code) ON DELETE CASCADE,
+    proof TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reason TEXT NOT NULL DEFAULT '',
+    awarded INTEGER NOT NULL DEFAULT 0,
+    reviewed_by INTEGER,
+    created_at TIMESTAMP NOT NULL,
+    reviewed_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS task_submissions_pending_idx ON task_submissions (user_id, task_code) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS task_submissions_status_idx ON task_submissions (status, id);
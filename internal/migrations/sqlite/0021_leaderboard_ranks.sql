@@ -0,0 +1,18 @@
+-- 0021_leaderboard_ranks.sql
+-- sql/0038 for SQLite.
+CREATE TABLE IF NOT EXISTS leaderboard_ranks (
+    period TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rank INTEGER NOT NULL,
+    points INTEGER NOT NULL,
+    PRIMARY KEY (period, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS leaderboard_ranks_order_idx
+    ON leaderboard_ranks (period, points DESC, user_id ASC);
+
+CREATE TABLE IF NOT EXISTS leaderboard_refreshes (
+    period TEXT PRIMARY KEY,
+    period_start TIMESTAMP NOT NULL,
+    refreshed_at TIMESTAMP NOT NULL
+);
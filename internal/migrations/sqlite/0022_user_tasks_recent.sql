@@ -0,0 +1,3 @@
+-- 0022_user_tasks_recent.sql
+-- sql/0039 for SQLite.
+CREATE INDEX IF NOT EXISTS user_tasks_user_recent_idx ON user_tasks (user_id, completed_at DESC, task_code DESC, n DESC);
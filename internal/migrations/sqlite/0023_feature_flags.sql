@@ -0,0 +1,12 @@
+-- 0023_feature_flags.sql
+-- sql/0040 for SQLite.
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    percent INTEGER NOT NULL CHECK (percent BETWEEN 0 AND 100),
+    updated_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'flags:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,19 @@
+-- 0024_points_stream.sql
+-- sql/0041 for SQLite.
+ALTER TABLE point_transactions ADD COLUMN user_seq INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE point_transactions ADD COLUMN balance INTEGER NOT NULL DEFAULT 0;
+
+UPDATE point_transactions SET user_seq = s.user_seq, balance = s.balance
+FROM (
+    SELECT id,
+           row_number() OVER (PARTITION BY user_id ORDER BY id) AS user_seq,
+           SUM(amount) OVER (PARTITION BY user_id ORDER BY id) AS balance
+    FROM point_transactions
+) AS s
+WHERE point_transactions.id = s.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS point_transactions_user_seq_idx ON point_transactions (user_id, user_seq);
+
+ALTER TABLE users ADD COLUMN points_seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE users SET points_seq = (SELECT COALESCE(MAX(user_seq), 0) FROM point_transactions WHERE user_id = users.id);
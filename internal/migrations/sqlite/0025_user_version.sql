@@ -0,0 +1,3 @@
+-- 0025_user_version.sql
+-- sql/0042 for SQLite.
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,13 @@
+-- 0026_maintenance.sql
+-- sql/0043 for SQLite.
+CREATE TABLE IF NOT EXISTS maintenance (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled BOOLEAN NOT NULL,
+    message TEXT NOT NULL,
+    retry_after INTEGER NOT NULL CHECK (retry_after >= 0),
+    updated_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'maintenance:manage')
+ON CONFLICT (role, permission) DO NOTHING;
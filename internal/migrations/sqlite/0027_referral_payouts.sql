@@ -0,0 +1,8 @@
+-- 0027_referral_payouts.sql
+-- sql/0044 for SQLite.
+ALTER TABLE referrals ADD COLUMN status TEXT NOT NULL DEFAULT 'paid' CHECK (status IN ('pending', 'paid', 'expired'));
+ALTER TABLE referrals ADD COLUMN paid_at TIMESTAMP;
+
+UPDATE referrals SET paid_at = created_at WHERE status = 'paid' AND paid_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS referrals_pending_idx ON referrals (id) WHERE status = 'pending';
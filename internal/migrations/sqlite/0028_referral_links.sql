@@ -0,0 +1,18 @@
+-- 0028_referral_links.sql
+-- sql/0045 for SQLite.
+CREATE TABLE IF NOT EXISTS referral_codes (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    code TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS referral_clicks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    referrer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    referred_id INTEGER UNIQUE REFERENCES users(id) ON DELETE SET NULL,
+    signed_up_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS referral_clicks_created_idx ON referral_clicks (created_at);
@@ -0,0 +1,37 @@
+-- 0029_campaigns.sql
+-- sql/0046 for SQLite.
+CREATE TABLE IF NOT EXISTS campaigns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    multiplier REAL NOT NULL DEFAULT 1 CHECK (multiplier > 0),
+    bonus_points INTEGER NOT NULL DEFAULT 0 CHECK (bonus_points >= 0),
+    category TEXT,
+    created_at TIMESTAMP NOT NULL,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS campaigns_ends_at_idx ON campaigns (ends_at);
+
+CREATE TABLE IF NOT EXISTS campaign_tasks (
+    campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL,
+    PRIMARY KEY (campaign_id, task_code)
+);
+
+CREATE TABLE IF NOT EXISTS campaign_awards (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL,
+    awarded INTEGER NOT NULL,
+    extra INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS campaign_awards_campaign_idx ON campaign_awards (campaign_id, task_code);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'campaigns:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,17 @@
+-- 0030_award_rules.sql
+-- sql/0047 for SQLite.
+CREATE TABLE IF NOT EXISTS award_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    conditions TEXT NOT NULL DEFAULT '{}',
+    multiplier REAL NOT NULL DEFAULT 1 CHECK (multiplier > 0),
+    bonus_points INTEGER NOT NULL DEFAULT 0 CHECK (bonus_points >= 0),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'rules:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,7 @@
+-- 0031_user_levels.sql
+-- sql/0048 for SQLite.
+CREATE TABLE IF NOT EXISTS user_levels (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL CHECK (level > 0),
+    reached_at TIMESTAMP NOT NULL
+);
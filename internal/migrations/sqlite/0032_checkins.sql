@@ -0,0 +1,8 @@
+-- 0032_checkins.sql
+-- sql/0049 for SQLite.
+CREATE TABLE IF NOT EXISTS user_checkins (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    current INTEGER NOT NULL,
+    longest INTEGER NOT NULL,
+    last_day DATE NOT NULL
+);
@@ -0,0 +1,9 @@
+-- 0034_callback_signatures.sql
+-- sql/0051 for SQLite.
+CREATE TABLE IF NOT EXISTS callback_signatures (
+    partner TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (partner, signature)
+);
+CREATE INDEX IF NOT EXISTS callback_signatures_expires_idx ON callback_signatures (expires_at);
@@ -0,0 +1,12 @@
+-- 0035_partner_completions.sql
+-- sql/0052 for SQLite.
+CREATE TABLE IF NOT EXISTS partner_completions (
+    partner TEXT NOT NULL,
+    reference TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_code TEXT NOT NULL,
+    awarded INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (partner, reference)
+);
+CREATE INDEX IF NOT EXISTS partner_completions_user_idx ON partner_completions (user_id);
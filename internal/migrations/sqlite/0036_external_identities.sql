@@ -0,0 +1,4 @@
+-- 0036_external_identities.sql
+-- sql/0053 for SQLite.
+ALTER TABLE oauth_identities RENAME TO external_identities;
+ALTER TABLE external_identities RENAME COLUMN subject TO external_id;
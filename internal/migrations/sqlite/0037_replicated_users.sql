@@ -0,0 +1,19 @@
+-- 0037_replicated_users.sql
+-- sql/0055 for SQLite.
+ALTER TABLE users ADD COLUMN origin_region TEXT;
+ALTER TABLE users ADD COLUMN origin_id INTEGER;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_origin_idx ON users (origin_region, origin_id)
+    WHERE origin_region IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS parked_accruals (
+    peer_region TEXT NOT NULL,
+    origin_seq INTEGER NOT NULL,
+    user_region TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    recorded_at TIMESTAMP NOT NULL,
+    parked_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (peer_region, origin_seq)
+);
@@ -0,0 +1,49 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// GitHub signs users in with their GitHub account. New users are named
+// after their login; the email is the public one, if any.
+type GitHub struct {
+	client
+	userURL string
+}
+
+func NewGitHub(hc *http.Client, clientID, clientSecret string) *GitHub {
+	return &GitHub{
+		client: client{
+			http:     hc,
+			id:       clientID,
+			secret:   clientSecret,
+			scope:    "read:user",
+			authURL:  "https://github.com/login/oauth/authorize",
+			tokenURL: "https://github.com/login/oauth/access_token",
+		},
+		userURL: "https://api.github.com/user",
+	}
+}
+
+func (g *GitHub) Exchange(ctx context.Context, code, redirectURI string) (service.OAuthIdentity, error) {
+	token, err := g.token(ctx, code, redirectURI)
+	if err != nil {
+		return service.OAuthIdentity{}, err
+	}
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Email string `json:"email"`
+	}
+	if err := g.get(ctx, token, g.userURL, &user); err != nil {
+		return service.OAuthIdentity{}, err
+	}
+	if user.ID == 0 {
+		return service.OAuthIdentity{}, service.ErrOAuthFailed
+	}
+	return service.OAuthIdentity{Subject: strconv.FormatInt(user.ID, 10), Email: user.Email, Username: user.Login}, nil
+}
@@ -0,0 +1,53 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// Google signs users in with their Google account, reading the OpenID
+// Connect userinfo. New users are named after their email address when
+// Google has verified it.
+type Google struct {
+	client
+	userURL string
+}
+
+func NewGoogle(hc *http.Client, clientID, clientSecret string) *Google {
+	return &Google{
+		client: client{
+			http:     hc,
+			id:       clientID,
+			secret:   clientSecret,
+			scope:    "openid email profile",
+			authURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+			tokenURL: "https://oauth2.googleapis.com/token",
+		},
+		userURL: "https://openidconnect.googleapis.com/v1/userinfo",
+	}
+}
+
+func (g *Google) Exchange(ctx context.Context, code, redirectURI string) (service.OAuthIdentity, error) {
+	token, err := g.token(ctx, code, redirectURI)
+	if err != nil {
+		return service.OAuthIdentity{}, err
+	}
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+	}
+	if err := g.get(ctx, token, g.userURL, &info); err != nil {
+		return service.OAuthIdentity{}, err
+	}
+	who := service.OAuthIdentity{Subject: info.Sub, Username: info.GivenName}
+	if info.EmailVerified {
+		who.Email = info.Email
+		who.Username, _, _ = strings.Cut(info.Email, "@")
+	}
+	return who, nil
+}
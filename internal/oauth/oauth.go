@@ -0,0 +1,88 @@
+// Package oauth holds the providers users can sign in with. Each runs the
+// authorization code flow against its provider's endpoints.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+type client struct {
+	http     *http.Client
+	id       string
+	secret   string
+	scope    string
+	authURL  string
+	tokenURL string
+}
+
+func (c *client) AuthURL(state, redirectURI string) string {
+	v := url.Values{
+		"client_id":     {c.id},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {c.scope},
+		"state":         {state},
+	}
+	return c.authURL + "?" + v.Encode()
+}
+
+// token trades code for an access token. A code the provider turns down
+// is service.ErrOAuthFailed; anything else is an error to retry.
+func (c *client) token(ctx context.Context, code, redirectURI string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {c.id},
+		"client_secret": {c.secret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	// errors come back as 400s, or as 200s without a token from GitHub
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil || out.AccessToken == "" {
+		return "", service.ErrOAuthFailed
+	}
+	return out.AccessToken, nil
+}
+
+// get reads the JSON at endpoint as the token's owner.
+func (c *client) get(ctx context.Context, token, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(v)
+}
@@ -0,0 +1,92 @@
+// Package ratelimit implements token buckets keyed by caller, held in memory
+// or, to share limits across instances, in Redis.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rule allows Burst requests at once, refilled at Rate per second. A zero
+// Rate means unlimited.
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+func (r Rule) Unlimited() bool { return r.Rate <= 0 }
+
+// Policy is the limit for one route group, applied per user and per client
+// IP independently.
+type Policy struct {
+	User Rule
+	IP   Rule
+}
+
+type Limiter interface {
+	// Allow takes a token from key's bucket. When none is left it returns
+	// false and how long until one is.
+	Allow(ctx context.Context, key string, rule Rule) (bool, time.Duration, error)
+}
+
+// sweepEvery bounds how often Memory drops idle buckets.
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Duration // time to refill from empty; idle longer than this = full
+}
+
+// Memory keeps buckets in process; limits are per instance.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Allow(_ context.Context, key string, rule Rule) (bool, time.Duration, error) {
+	if rule.Unlimited() {
+		return true, 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.full = time.Duration(float64(rule.Burst) / rule.Rate * float64(time.Second))
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.last).Seconds()*rule.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep drops buckets that have refilled completely; a new bucket starts
+// full, so forgetting them changes nothing.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if now.Sub(b.last) > b.full {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+const awardRuleColumns = `id, name, position, enabled, conditions, multiplier, bonus_points, created_at, updated_at`
+
+func scanAwardRule(sc interface{ Scan(...any) error }) (AwardRule, error) {
+	var (
+		r          AwardRule
+		conditions []byte
+	)
+	err := sc.Scan(&r.ID, &r.Name, &r.Position, &r.Enabled, &conditions, &r.Multiplier, &r.BonusPoints, &r.CreatedAt, &r.UpdatedAt)
+	r.Conditions = json.RawMessage(conditions)
+	return r, err
+}
+
+func scanAwardRules(rows *sql.Rows, err error) ([]AwardRule, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AwardRule{}
+	for rows.Next() {
+		r, err := scanAwardRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) CreateAwardRule(ctx context.Context, r AwardRule) (AwardRule, error) {
+	return scanAwardRule(p.q.QueryRowContext(ctx, `
+		INSERT INTO award_rules (name, position, enabled, conditions, multiplier, bonus_points)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $6)
+		RETURNING `+awardRuleColumns,
+		r.Name, r.Position, r.Enabled, string(r.Conditions), r.Multiplier, r.BonusPoints))
+}
+
+func (p *Postgres) GetAwardRule(ctx context.Context, id int64) (AwardRule, error) {
+	r, err := scanAwardRule(p.q.QueryRowContext(ctx, `SELECT `+awardRuleColumns+` FROM award_rules WHERE id=$1`, id))
+	return r, notFound(err)
+}
+
+func (p *Postgres) ListAwardRules(ctx context.Context, enabledOnly bool) ([]AwardRule, error) {
+	return scanAwardRules(p.q.QueryContext(ctx, `
+		SELECT `+awardRuleColumns+` FROM award_rules
+		WHERE enabled OR NOT $1
+		ORDER BY position, id
+	`, enabledOnly))
+}
+
+func (p *Postgres) UpdateAwardRule(ctx context.Context, r AwardRule) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE award_rules
+		SET name=$2, position=$3, enabled=$4, conditions=$5::jsonb, multiplier=$6, bonus_points=$7, updated_at=now()
+		WHERE id=$1
+	`, r.ID, r.Name, r.Position, r.Enabled, string(r.Conditions), r.Multiplier, r.BonusPoints)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteAwardRule(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM award_rules WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (p *Postgres) RecordDiscrepancies(ctx context.Context, at time.Time) (int64, error) {
+	if _, err := p.q.ExecContext(ctx, `DELETE FROM point_discrepancies`); err != nil {
+		return 0, err
+	}
+	res, err := p.q.ExecContext(ctx, `
+		INSERT INTO point_discrepancies (user_id, points, ledger_points, found_at)
+		SELECT u.id, u.points, COALESCE(l.points, 0), $1
+		FROM users u
+		LEFT JOIN (
+			SELECT user_id, SUM(amount) AS points FROM point_transactions GROUP BY user_id
+		) l ON l.user_id = u.id
+		WHERE u.deleted_at IS NULL AND u.points <> COALESCE(l.points, 0)
+	`, at)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanDiscrepancies(rows *sql.Rows) ([]Discrepancy, error) {
+	defer rows.Close()
+	out := []Discrepancy{}
+	for rows.Next() {
+		var d Discrepancy
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Points, &d.LedgerPoints, &d.FoundAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) ListDiscrepancies(ctx context.Context, afterUserID int64, limit int) ([]Discrepancy, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT d.user_id, u.username, d.points, d.ledger_points, d.found_at
+		FROM point_discrepancies d JOIN users u ON u.id = d.user_id
+		WHERE d.user_id > $1
+		ORDER BY d.user_id
+		LIMIT $2
+	`, afterUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDiscrepancies(rows)
+}
+
+func (p *Postgres) DeleteDiscrepancy(ctx context.Context, userID int64) error {
+	_, err := p.q.ExecContext(ctx, `DELETE FROM point_discrepancies WHERE user_id=$1`, userID)
+	return err
+}
+
+func (p *Postgres) ReplayPoints(ctx context.Context, userID int64) (before, after int64, err error) {
+	err = p.q.QueryRowContext(ctx, `SELECT points FROM users WHERE id=$1 AND deleted_at IS NULL FOR UPDATE`, userID).Scan(&before)
+	if err != nil {
+		return 0, 0, notFound(err)
+	}
+	if _, err := p.q.ExecContext(ctx, `
+		UPDATE point_transactions pt SET balance = s.balance
+		FROM (
+			SELECT id, SUM(amount) OVER (ORDER BY user_seq) AS balance
+			FROM point_transactions WHERE user_id=$1
+		) s
+		WHERE pt.id = s.id AND pt.balance <> s.balance
+	`, userID); err != nil {
+		return 0, 0, err
+	}
+	// the stream is the record: where it adds up to less than zero, so
+	// does the balance, as with merged debits
+	if _, err := p.q.ExecContext(ctx, `SELECT set_config('app.merging_accruals', 'on', true)`); err != nil {
+		return 0, 0, err
+	}
+	err = p.q.QueryRowContext(ctx, `
+		UPDATE users SET points = s.points, points_seq = s.seq,
+			version = users.version + CASE WHEN users.points <> s.points THEN 1 ELSE 0 END
+		FROM (
+			SELECT CAST(COALESCE(SUM(amount), 0) AS BIGINT) AS points, COALESCE(MAX(user_seq), 0) AS seq
+			FROM point_transactions WHERE user_id=$1
+		) s
+		WHERE id=$1
+		RETURNING users.points
+	`, userID).Scan(&after)
+	return before, after, err
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// campaignColumns is shared by Postgres and SQLite, whose string_agg is
+// called group_concat; see campaignQuery.
+const campaignColumns = `id, name, starts_at, ends_at, multiplier, bonus_points, COALESCE(category, ''),
+	COALESCE((SELECT AGG(t.task_code, ',' ORDER BY t.task_code) FROM campaign_tasks t WHERE t.campaign_id = campaigns.id), ''),
+	created_at`
+
+func campaignQuery(agg, q string) string {
+	return strings.ReplaceAll(strings.Replace(q, "COLUMNS", campaignColumns, 1), "AGG", agg)
+}
+
+func scanCampaign(sc interface{ Scan(...any) error }) (Campaign, error) {
+	var (
+		c     Campaign
+		tasks string
+	)
+	err := sc.Scan(&c.ID, &c.Name, &c.StartsAt, &c.EndsAt, &c.Multiplier, &c.BonusPoints, &c.Category, &tasks, &c.CreatedAt)
+	c.Tasks = []string{}
+	if tasks != "" {
+		c.Tasks = strings.Split(tasks, ",")
+	}
+	c.setStatus(time.Now())
+	return c, err
+}
+
+func scanCampaigns(rows *sql.Rows, err error) ([]Campaign, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Campaign{}
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// scanCampaignStats reads the per-task rows of a campaign's awards and
+// sums them; Users is counted separately.
+func scanCampaignStats(rows *sql.Rows, err error) (CampaignStats, error) {
+	st := CampaignStats{Tasks: []CampaignTaskStats{}}
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t CampaignTaskStats
+		if err := rows.Scan(&t.Task, &t.Completions, &t.Awarded, &t.Extra); err != nil {
+			return st, err
+		}
+		st.Completions += t.Completions
+		st.Awarded += t.Awarded
+		st.Extra += t.Extra
+		st.Tasks = append(st.Tasks, t)
+	}
+	return st, rows.Err()
+}
+
+const campaignTaskStats = `
+	SELECT task_code, COUNT(*), SUM(awarded), SUM(extra) FROM campaign_awards
+	WHERE campaign_id = ID GROUP BY task_code ORDER BY task_code`
+
+func (p *Postgres) setCampaignTasks(ctx context.Context, id int64, tasks []string) error {
+	if _, err := p.q.ExecContext(ctx, `DELETE FROM campaign_tasks WHERE campaign_id=$1`, id); err != nil {
+		return err
+	}
+	for _, code := range tasks {
+		_, err := p.q.ExecContext(ctx, `
+			INSERT INTO campaign_tasks (campaign_id, task_code) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, id, code)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) CreateCampaign(ctx context.Context, c Campaign) (Campaign, error) {
+	var id int64
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO campaigns (name, starts_at, ends_at, multiplier, bonus_points, category)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING id
+	`, c.Name, c.StartsAt, c.EndsAt, c.Multiplier, c.BonusPoints, c.Category).Scan(&id)
+	if err != nil {
+		return Campaign{}, err
+	}
+	if err := p.setCampaignTasks(ctx, id, c.Tasks); err != nil {
+		return Campaign{}, err
+	}
+	return p.GetCampaign(ctx, id)
+}
+
+func (p *Postgres) GetCampaign(ctx context.Context, id int64) (Campaign, error) {
+	c, err := scanCampaign(p.q.QueryRowContext(ctx, campaignQuery("string_agg", `SELECT COLUMNS FROM campaigns WHERE id=$1`), id))
+	return c, notFound(err)
+}
+
+func (p *Postgres) ListCampaigns(ctx context.Context) ([]Campaign, error) {
+	return scanCampaigns(p.q.QueryContext(ctx, campaignQuery("string_agg", `SELECT COLUMNS FROM campaigns ORDER BY starts_at DESC, id DESC`)))
+}
+
+func (p *Postgres) RunningCampaigns(ctx context.Context) ([]Campaign, error) {
+	return scanCampaigns(p.q.QueryContext(ctx, campaignQuery("string_agg", `
+		SELECT COLUMNS FROM campaigns
+		WHERE starts_at <= now() AND ends_at > now()
+		ORDER BY id
+	`)))
+}
+
+func (p *Postgres) UpdateCampaign(ctx context.Context, c Campaign) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE campaigns SET name=$2, starts_at=$3, ends_at=$4, multiplier=$5, bonus_points=$6, category=NULLIF($7, '')
+		WHERE id=$1
+	`, c.ID, c.Name, c.StartsAt, c.EndsAt, c.Multiplier, c.BonusPoints, c.Category)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return p.setCampaignTasks(ctx, c.ID, c.Tasks)
+}
+
+func (p *Postgres) DeleteCampaign(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM campaigns WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) AddCampaignAward(ctx context.Context, a CampaignAward) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO campaign_awards (campaign_id, user_id, task_code, awarded, extra)
+		VALUES ($1, $2, $3, $4, $5)
+	`, a.CampaignID, a.UserID, a.TaskCode, a.Awarded, a.Extra)
+	return err
+}
+
+func (p *Postgres) CampaignStats(ctx context.Context, id int64) (CampaignStats, error) {
+	st, err := scanCampaignStats(p.q.QueryContext(ctx, strings.Replace(campaignTaskStats, "ID", "$1", 1), id))
+	if err != nil {
+		return st, err
+	}
+	err = p.q.QueryRowContext(ctx, `SELECT COUNT(DISTINCT user_id) FROM campaign_awards WHERE campaign_id=$1`, id).Scan(&st.Users)
+	return st, err
+}
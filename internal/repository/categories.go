@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+const categoryColumns = `code, name, description, position`
+
+func scanCategories(rows *sql.Rows, err error) ([]Category, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Category{}
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.Code, &c.Name, &c.Description, &c.Position); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) ListCategories(ctx context.Context) ([]Category, error) {
+	return scanCategories(p.q.QueryContext(ctx, `SELECT `+categoryColumns+` FROM task_categories ORDER BY position, code`))
+}
+
+func (p *Postgres) GetCategory(ctx context.Context, code string) (Category, error) {
+	var c Category
+	err := p.q.QueryRowContext(ctx, `SELECT `+categoryColumns+` FROM task_categories WHERE code=$1`, code).
+		Scan(&c.Code, &c.Name, &c.Description, &c.Position)
+	return c, notFound(err)
+}
+
+func (p *Postgres) CreateCategory(ctx context.Context, c Category) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO task_categories (code, name, description, position) VALUES ($1, $2, $3, $4)
+	`, c.Code, c.Name, c.Description, c.Position)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (p *Postgres) UpdateCategory(ctx context.Context, c Category) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE task_categories SET name=$2, description=$3, position=$4 WHERE code=$1
+	`, c.Code, c.Name, c.Description, c.Position)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteCategory(ctx context.Context, code string) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM task_categories WHERE code=$1`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const dataExportColumns = `id, user_id, format, status, error, created_at, completed_at, expires_at`
+
+func scanDataExport(sc interface{ Scan(...any) error }) (DataExport, error) {
+	var e DataExport
+	err := sc.Scan(&e.ID, &e.UserID, &e.Format, &e.Status, &e.Error, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	return e, err
+}
+
+func scanDataExports(rows *sql.Rows) ([]DataExport, error) {
+	defer rows.Close()
+	out := []DataExport{}
+	for rows.Next() {
+		e, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) CreateExport(ctx context.Context, userID int64, format string) (DataExport, error) {
+	return scanDataExport(p.q.QueryRowContext(ctx, `
+		INSERT INTO data_exports (user_id, format) VALUES ($1, $2)
+		RETURNING `+dataExportColumns,
+		userID, format))
+}
+
+func (p *Postgres) GetExport(ctx context.Context, userID, id int64) (DataExport, error) {
+	e, err := scanDataExport(p.q.QueryRowContext(ctx, `
+		SELECT `+dataExportColumns+` FROM data_exports
+		WHERE id=$1 AND user_id=$2 AND (expires_at IS NULL OR expires_at > now())
+	`, id, userID))
+	return e, notFound(err)
+}
+
+func (p *Postgres) ExportContent(ctx context.Context, userID, id int64) ([]byte, error) {
+	var content []byte
+	err := p.q.QueryRowContext(ctx, `
+		SELECT content FROM data_exports
+		WHERE id=$1 AND user_id=$2 AND status='ready' AND expires_at > now()
+	`, id, userID).Scan(&content)
+	return content, notFound(err)
+}
+
+func (p *Postgres) ClaimExports(ctx context.Context, limit int, lease time.Duration) ([]DataExport, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		UPDATE data_exports
+		SET next_attempt_at = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+dataExportColumns,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	return scanDataExports(rows)
+}
+
+func (p *Postgres) CompleteExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE data_exports SET status='ready', content=$2, completed_at=now(), expires_at=$3
+		WHERE id=$1 AND status='pending'
+	`, id, content, expiresAt)
+	return err
+}
+
+func (p *Postgres) FailExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE data_exports SET status='failed', error=$2, completed_at=now(), expires_at=$3
+		WHERE id=$1 AND status='pending'
+	`, id, errMsg, expiresAt)
+	return err
+}
+
+func (p *Postgres) DeleteUserExports(ctx context.Context, userID int64) error {
+	_, err := p.q.ExecContext(ctx, `DELETE FROM data_exports WHERE user_id=$1`, userID)
+	return err
+}
+
+func (p *Postgres) PurgeExports(ctx context.Context, now time.Time) (int64, error) {
+	var total int64
+	for _, table := range []string{"data_exports", "report_exports"} {
+		res, err := p.q.ExecContext(ctx, `DELETE FROM `+table+` WHERE expires_at < $1`, now)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+const reportExportColumns = `id, report, params, requested_by, status, error, created_at, completed_at, expires_at`
+
+func scanReportExport(sc interface{ Scan(...any) error }) (ReportExport, error) {
+	var (
+		e      ReportExport
+		params []byte
+	)
+	err := sc.Scan(&e.ID, &e.Report, &params, &e.RequestedBy, &e.Status, &e.Error, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	e.Params = json.RawMessage(params)
+	return e, err
+}
+
+func scanReportExports(rows *sql.Rows) ([]ReportExport, error) {
+	defer rows.Close()
+	out := []ReportExport{}
+	for rows.Next() {
+		e, err := scanReportExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) CreateReportExport(ctx context.Context, report string, params json.RawMessage, requestedBy int64) (ReportExport, error) {
+	return scanReportExport(p.q.QueryRowContext(ctx, `
+		INSERT INTO report_exports (report, params, requested_by) VALUES ($1, $2::jsonb, $3)
+		RETURNING `+reportExportColumns,
+		report, string(params), requestedBy))
+}
+
+func (p *Postgres) GetReportExport(ctx context.Context, id int64) (ReportExport, error) {
+	e, err := scanReportExport(p.q.QueryRowContext(ctx, `
+		SELECT `+reportExportColumns+` FROM report_exports
+		WHERE id=$1 AND (expires_at IS NULL OR expires_at > now())
+	`, id))
+	return e, notFound(err)
+}
+
+func (p *Postgres) ReportExportContent(ctx context.Context, id int64) ([]byte, error) {
+	var content []byte
+	err := p.q.QueryRowContext(ctx, `
+		SELECT content FROM report_exports
+		WHERE id=$1 AND status='ready' AND expires_at > now()
+	`, id).Scan(&content)
+	return content, notFound(err)
+}
+
+func (p *Postgres) ClaimReportExports(ctx context.Context, limit int, lease time.Duration) ([]ReportExport, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		UPDATE report_exports
+		SET next_attempt_at = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM report_exports
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+reportExportColumns,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	return scanReportExports(rows)
+}
+
+func (p *Postgres) CompleteReportExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE report_exports SET status='ready', content=$2, completed_at=now(), expires_at=$3
+		WHERE id=$1 AND status='pending'
+	`, id, content, expiresAt)
+	return err
+}
+
+func (p *Postgres) FailReportExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE report_exports SET status='failed', error=$2, completed_at=now(), expires_at=$3
+		WHERE id=$1 AND status='pending'
+	`, id, errMsg, expiresAt)
+	return err
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+func scanFlags(rows *sql.Rows, err error) ([]FeatureFlag, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []FeatureFlag{}
+	for rows.Next() {
+		var f FeatureFlag
+		if err := rows.Scan(&f.Name, &f.Enabled, &f.Percent, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) FeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	return scanFlags(p.q.QueryContext(ctx, `SELECT name, enabled, percent, updated_at FROM feature_flags ORDER BY name`))
+}
+
+func (p *Postgres) SetFeatureFlag(ctx context.Context, f FeatureFlag) (FeatureFlag, error) {
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO feature_flags (name, enabled, percent, updated_at) VALUES ($1, $2, $3, now())
+		ON CONFLICT (name) DO UPDATE SET enabled = EXCLUDED.enabled, percent = EXCLUDED.percent, updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, f.Name, f.Enabled, f.Percent).Scan(&f.UpdatedAt)
+	return f, err
+}
+
+func (p *Postgres) DeleteFeatureFlag(ctx context.Context, name string) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM feature_flags WHERE name=$1`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (p *Postgres) ClaimIdempotencyKey(ctx context.Context, userID int64, key, requestHash string, lease, ttl time.Duration) (*IdempotentResponse, error) {
+	var claimed bool
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, locked_until)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, locked_until = EXCLUDED.locked_until,
+		    created_at = now(), status = NULL, content_type = NULL, body = NULL
+		WHERE idempotency_keys.created_at < now() - $5 * interval '1 millisecond'
+		   OR (idempotency_keys.status IS NULL AND idempotency_keys.locked_until < now())
+		RETURNING true
+	`, userID, key, requestHash, lease.Milliseconds(), ttl.Milliseconds()).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var (
+		res         IdempotentResponse
+		status      sql.NullInt64
+		contentType sql.NullString
+	)
+	err = p.q.QueryRowContext(ctx, `
+		SELECT request_hash, status, content_type, body FROM idempotency_keys
+		WHERE user_id=$1 AND key=$2
+	`, userID, key).Scan(&res.RequestHash, &status, &contentType, &res.Body)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	res.Done = status.Valid
+	res.Status = int(status.Int64)
+	res.ContentType = contentType.String
+	return &res, nil
+}
+
+func (p *Postgres) SaveIdempotentResponse(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status=$3, content_type=$4, body=$5
+		WHERE user_id=$1 AND key=$2
+	`, userID, key, status, contentType, body)
+	return err
+}
+
+func (p *Postgres) ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error {
+	_, err := p.q.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE user_id=$1 AND key=$2 AND status IS NULL
+	`, userID, key)
+	return err
+}
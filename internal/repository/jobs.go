@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// jobLockClass is the first key of the two-key pg_try_advisory_lock job
+// locks are taken with, the second being hashtext(name). Two-key locks
+// never collide with the migrations' single-key one.
+const jobLockClass int32 = 7_261_002
+
+func (p *Postgres) TryLockJob(ctx context.Context, name string) (func(), bool, error) {
+	// session locks belong to a connection, so the lock is taken and
+	// released on one kept out of the pool for the run
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var ok bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1, hashtext($2))`, jobLockClass, name).Scan(&ok)
+	if err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		// a closed connection drops its locks anyway
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, hashtext($2))`, jobLockClass, name)
+		conn.Close()
+	}, true, nil
+}
+
+func (p *Postgres) ClaimJobRun(ctx context.Context, name string, slot time.Time) (bool, error) {
+	res, err := p.q.ExecContext(ctx, `
+		INSERT INTO job_runs (name, slot, started_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE
+		SET slot = EXCLUDED.slot, started_at = EXCLUDED.started_at, finished_at = NULL, last_error = NULL
+		WHERE job_runs.slot < EXCLUDED.slot
+	`, name, slot)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (p *Postgres) FinishJobRun(ctx context.Context, name string, slot time.Time, errMsg string) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE job_runs SET finished_at = now(), last_error = NULLIF($3, '')
+		WHERE name = $1 AND slot = $2
+	`, name, slot, errMsg)
+	return err
+}
+
+// localLocks are job locks for stores only one process uses.
+type localLocks struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (l *localLocks) tryLock(name string) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[name] {
+		return nil, false
+	}
+	if l.held == nil {
+		l.held = map[string]bool{}
+	}
+	l.held[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, name)
+	}, true
+}
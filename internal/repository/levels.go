@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+func scanUserLevels(rows *sql.Rows, err error) (map[int64]UserLevel, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]UserLevel{}
+	for rows.Next() {
+		var (
+			id int64
+			l  UserLevel
+		)
+		if err := rows.Scan(&id, &l.Level, &l.Points); err != nil {
+			return nil, err
+		}
+		out[id] = l
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) UserLevels(ctx context.Context, ids []int64) (map[int64]UserLevel, error) {
+	return scanUserLevels(p.q.QueryContext(ctx, `
+		SELECT u.id, COALESCE(l.level, 0), u.points
+		FROM users u LEFT JOIN user_levels l ON l.user_id = u.id
+		WHERE u.id = ANY($1)
+	`, ids))
+}
+
+func (p *Postgres) RaiseUserLevel(ctx context.Context, userID int64, level int) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO user_levels (user_id, level) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET level = excluded.level, reached_at = now()
+		WHERE user_levels.level < excluded.level
+	`, userID, level)
+	return err
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+func scanMaintenance(row *sql.Row) (Maintenance, error) {
+	var m Maintenance
+	err := row.Scan(&m.Enabled, &m.Message, &m.RetryAfter, &m.UpdatedAt)
+	return m, notFound(err)
+}
+
+func (p *Postgres) Maintenance(ctx context.Context) (Maintenance, error) {
+	return scanMaintenance(p.q.QueryRowContext(ctx, `SELECT enabled, message, retry_after, updated_at FROM maintenance`))
+}
+
+func (p *Postgres) SetMaintenance(ctx context.Context, m Maintenance) (Maintenance, error) {
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO maintenance (id, enabled, message, retry_after, updated_at) VALUES (true, $1, $2, $3, now())
+		ON CONFLICT (id) DO UPDATE SET enabled = EXCLUDED.enabled, message = EXCLUDED.message,
+			retry_after = EXCLUDED.retry_after, updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, m.Enabled, m.Message, m.RetryAfter).Scan(&m.UpdatedAt)
+	return m, err
+}
+
+func (p *Postgres) ClearMaintenance(ctx context.Context) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM maintenance`)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
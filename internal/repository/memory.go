@@ -0,0 +1,1558 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory implements Store in process memory, seeded like a freshly
+// migrated database. It is for demos and tests: nothing survives a
+// restart, and one lock serializes every call, so transactions simply run
+// one at a time and never conflict.
+type Memory struct {
+	// mu is nil on the view handed to an InTx callback, which already
+	// holds the lock.
+	mu     *sync.Mutex
+	s      *memState
+	region string
+	jobs   *localLocks
+}
+
+func NewMemory(region string) *Memory {
+	m := &Memory{mu: &sync.Mutex{}, s: newMemState(), region: region, jobs: &localLocks{}}
+	m.seed()
+	return m
+}
+
+func (m *Memory) lock() func() {
+	if m.mu == nil {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// InTx runs fn with the store locked and puts everything back if fn fails.
+func (m *Memory) InTx(ctx context.Context, fn func(q Queries) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer m.lock()()
+	saved := m.s.clone()
+	if err := fn(&Memory{s: m.s, region: m.region}); err != nil {
+		*m.s = *saved
+		return err
+	}
+	return nil
+}
+
+type memUser struct {
+	User
+	passwordHash string
+	homeRegion   string
+	// originRegion and originID are set on copies of users created in
+	// another region
+	originRegion string
+	originID     int64
+	profile      Profile
+	settings     Settings
+	deleted      bool
+	// pointsSeq is the Seq of the last entry in the user's points stream
+	pointsSeq int64
+}
+
+// memDeletedUser is a deleted_users row.
+type memDeletedUser struct {
+	username     string
+	passwordHash string
+	profile      Profile
+	deletedAt    time.Time
+}
+
+type memLedgerEntry struct {
+	LedgerEntry
+	userID     int64
+	originSeq  int64
+	recordedAt time.Time
+}
+
+type memToken struct {
+	RefreshToken
+	hash string
+}
+
+type memIdempotency struct {
+	IdempotentResponse
+	createdAt   time.Time
+	lockedUntil time.Time
+}
+
+type memStreak struct {
+	current, longest int
+	lastDay          time.Time
+}
+
+// bump is st after an entry on day: unchanged for a second entry on the
+// same day, +1 after the day before, otherwise a fresh start, capped by a
+// positive maxStreak.
+func (st memStreak) bump(day time.Time, maxStreak int) memStreak {
+	next := 1
+	switch {
+	case st.lastDay.Equal(day):
+		next = st.current
+	case st.lastDay.Equal(day.AddDate(0, 0, -1)):
+		next = st.current + 1
+	}
+	if maxStreak > 0 {
+		next = min(next, maxStreak)
+	}
+	return memStreak{current: next, longest: max(st.longest, next), lastDay: day}
+}
+
+type memOutboxEvent struct {
+	OutboxEvent
+	nextAttemptAt time.Time
+	published     bool
+}
+
+type (
+	userTaskKey struct {
+		userID int64
+		code   string
+	}
+	periodKey struct {
+		userID int64
+		period string
+		start  time.Time
+	}
+	originKey struct {
+		region string
+		seq    int64
+	}
+	idemKey struct {
+		userID int64
+		key    string
+	}
+	userRoleKey struct {
+		userID int64
+		role   string
+	}
+	// callbackKey is a partner and one of its signatures or references
+	callbackKey struct {
+		partner string
+		value   string
+	}
+	deliveryKey struct {
+		endpointID int64
+		eventID    string
+	}
+	channelKey struct {
+		userID  int64
+		channel string
+	}
+)
+
+// memState is the data. Maps are copied on clone and slices are only ever
+// appended to or replaced, so a shallow copy of each is a full snapshot.
+type memState struct {
+	seq       map[string]int64
+	users     map[int64]memUser
+	usernames map[string]int64
+	referrals map[[2]int64]Referral
+	// referralCodes are keyed by user id, referralClicks by token
+	referralCodes  map[int64]string
+	referralClicks map[string]ReferralClick
+	// identities are keyed by provider and external id
+	identities   map[[2]string]ExternalIdentity
+	tasks        map[string]Task
+	deps         map[string][]string
+	tags         map[string][]string
+	categories   map[string]Category
+	flags        map[string]FeatureFlag
+	maintenance  *Maintenance
+	translations map[translationKey]TaskTranslation
+	submissions  map[int64]TaskSubmission
+	// userTasks holds each user's completions of a task in order
+	userTasks map[userTaskKey][]time.Time
+	ledger    []memLedgerEntry
+	origins   map[originKey]bool
+	parked    map[originKey]Accrual
+	periodPts map[periodKey]int64
+	transfers []Transfer
+	tokens    map[string]memToken
+	// passwordResets are keyed by token hash
+	passwordResets map[string]memPasswordReset
+	revokedTokens  map[string]RevokedToken
+	tokenCutoffs   map[int64]time.Time
+	cursors        map[string]int64
+	idem           map[idemKey]memIdempotency
+	roles          map[string]Role
+	userRoles      map[userRoleKey]bool
+	streaks        map[int64]memStreak
+	checkins       map[int64]memStreak
+	audit          []AuditEvent
+	outbox         map[int64]memOutboxEvent
+	endpoints      map[int64]WebhookEndpoint
+	deliveries     map[int64]WebhookDelivery
+	delivered      map[deliveryKey]bool
+	deleted        map[int64]memDeletedUser
+	exports        map[int64]memExport
+	// reportExports are queued report CSVs
+	reportExports map[int64]memReportExport
+	// callbackSigs hold when each accepted signature may be forgotten
+	callbackSigs map[callbackKey]time.Time
+	// partnerRefs are the partner completions, by partner and reference
+	partnerRefs map[callbackKey]PartnerCompletion
+	teams       map[int64]Team
+	// teamMembers is keyed by user id
+	teamMembers map[int64]memTeamMember
+	seasons     map[int64]Season
+	seasonPts   map[seasonKey]int64
+	// standings are archived seasons' results in rank order
+	standings map[int64][]LeaderboardEntry
+	campaigns map[int64]Campaign
+	// campaignAwards are keyed by id
+	campaignAwards map[int64]CampaignAward
+	awardRules     map[int64]AwardRule
+	// levels are the highest level each user has reached
+	levels map[int64]int
+	// jobRuns is the slot each job last ran for
+	jobRuns          map[string]time.Time
+	discrepancies    map[int64]Discrepancy
+	notifications    map[int64]Notification
+	channels         map[channelKey]ChannelSetting
+	notifyDeliveries map[int64]memNotifyDelivery
+	// rankings are the precomputed leaderboards by period
+	rankings map[string]memRanks
+}
+
+func newMemState() *memState {
+	return &memState{
+		seq:              map[string]int64{},
+		users:            map[int64]memUser{},
+		usernames:        map[string]int64{},
+		referrals:        map[[2]int64]Referral{},
+		referralCodes:    map[int64]string{},
+		referralClicks:   map[string]ReferralClick{},
+		identities:       map[[2]string]ExternalIdentity{},
+		tasks:            map[string]Task{},
+		deps:             map[string][]string{},
+		tags:             map[string][]string{},
+		categories:       map[string]Category{},
+		flags:            map[string]FeatureFlag{},
+		translations:     map[translationKey]TaskTranslation{},
+		submissions:      map[int64]TaskSubmission{},
+		userTasks:        map[userTaskKey][]time.Time{},
+		origins:          map[originKey]bool{},
+		parked:           map[originKey]Accrual{},
+		periodPts:        map[periodKey]int64{},
+		tokens:           map[string]memToken{},
+		passwordResets:   map[string]memPasswordReset{},
+		callbackSigs:     map[callbackKey]time.Time{},
+		partnerRefs:      map[callbackKey]PartnerCompletion{},
+		revokedTokens:    map[string]RevokedToken{},
+		tokenCutoffs:     map[int64]time.Time{},
+		cursors:          map[string]int64{},
+		idem:             map[idemKey]memIdempotency{},
+		roles:            map[string]Role{},
+		userRoles:        map[userRoleKey]bool{},
+		streaks:          map[int64]memStreak{},
+		checkins:         map[int64]memStreak{},
+		outbox:           map[int64]memOutboxEvent{},
+		endpoints:        map[int64]WebhookEndpoint{},
+		deliveries:       map[int64]WebhookDelivery{},
+		delivered:        map[deliveryKey]bool{},
+		deleted:          map[int64]memDeletedUser{},
+		exports:          map[int64]memExport{},
+		reportExports:    map[int64]memReportExport{},
+		teams:            map[int64]Team{},
+		teamMembers:      map[int64]memTeamMember{},
+		seasons:          map[int64]Season{},
+		seasonPts:        map[seasonKey]int64{},
+		standings:        map[int64][]LeaderboardEntry{},
+		campaigns:        map[int64]Campaign{},
+		campaignAwards:   map[int64]CampaignAward{},
+		awardRules:       map[int64]AwardRule{},
+		levels:           map[int64]int{},
+		jobRuns:          map[string]time.Time{},
+		discrepancies:    map[int64]Discrepancy{},
+		notifications:    map[int64]Notification{},
+		channels:         map[channelKey]ChannelSetting{},
+		notifyDeliveries: map[int64]memNotifyDelivery{},
+		rankings:         map[string]memRanks{},
+	}
+}
+
+func (s *memState) clone() *memState {
+	c := *s
+	c.seq = maps.Clone(s.seq)
+	c.users = maps.Clone(s.users)
+	c.usernames = maps.Clone(s.usernames)
+	c.referrals = maps.Clone(s.referrals)
+	c.referralCodes = maps.Clone(s.referralCodes)
+	c.referralClicks = maps.Clone(s.referralClicks)
+	c.identities = maps.Clone(s.identities)
+	c.tasks = maps.Clone(s.tasks)
+	c.deps = maps.Clone(s.deps)
+	c.tags = maps.Clone(s.tags)
+	c.categories = maps.Clone(s.categories)
+	c.flags = maps.Clone(s.flags)
+	c.translations = maps.Clone(s.translations)
+	c.submissions = maps.Clone(s.submissions)
+	c.userTasks = maps.Clone(s.userTasks)
+	c.origins = maps.Clone(s.origins)
+	c.parked = maps.Clone(s.parked)
+	c.periodPts = maps.Clone(s.periodPts)
+	c.tokens = maps.Clone(s.tokens)
+	c.passwordResets = maps.Clone(s.passwordResets)
+	c.callbackSigs = maps.Clone(s.callbackSigs)
+	c.partnerRefs = maps.Clone(s.partnerRefs)
+	c.revokedTokens = maps.Clone(s.revokedTokens)
+	c.tokenCutoffs = maps.Clone(s.tokenCutoffs)
+	c.cursors = maps.Clone(s.cursors)
+	c.idem = maps.Clone(s.idem)
+	c.roles = maps.Clone(s.roles)
+	c.userRoles = maps.Clone(s.userRoles)
+	c.streaks = maps.Clone(s.streaks)
+	c.checkins = maps.Clone(s.checkins)
+	c.outbox = maps.Clone(s.outbox)
+	c.endpoints = maps.Clone(s.endpoints)
+	c.deliveries = maps.Clone(s.deliveries)
+	c.delivered = maps.Clone(s.delivered)
+	c.deleted = maps.Clone(s.deleted)
+	c.exports = maps.Clone(s.exports)
+	c.reportExports = maps.Clone(s.reportExports)
+	c.teams = maps.Clone(s.teams)
+	c.teamMembers = maps.Clone(s.teamMembers)
+	c.seasons = maps.Clone(s.seasons)
+	c.seasonPts = maps.Clone(s.seasonPts)
+	c.standings = maps.Clone(s.standings)
+	c.campaigns = maps.Clone(s.campaigns)
+	c.campaignAwards = maps.Clone(s.campaignAwards)
+	c.awardRules = maps.Clone(s.awardRules)
+	c.levels = maps.Clone(s.levels)
+	c.jobRuns = maps.Clone(s.jobRuns)
+	c.discrepancies = maps.Clone(s.discrepancies)
+	c.notifications = maps.Clone(s.notifications)
+	c.channels = maps.Clone(s.channels)
+	c.notifyDeliveries = maps.Clone(s.notifyDeliveries)
+	c.rankings = maps.Clone(s.rankings)
+	return &c
+}
+
+func (s *memState) next(table string) int64 {
+	s.seq[table]++
+	return s.seq[table]
+}
+
+// seed mirrors the rows the migrations insert.
+func (m *Memory) seed() {
+	for _, t := range []Task{
+		{Code: "subscribe_telegram", Title: "Subscribe to Telegram channel", Points: 20, Category: "social"},
+		{Code: "subscribe_twitter", Title: "Follow on Twitter/X", Points: 20, Category: "social"},
+		{Code: "enter_referral_code", Title: "Enter referral code", Points: 10, Category: "onboarding"},
+		{Code: "complete_profile", Title: "Complete profile info", Points: 15, Category: "onboarding"},
+		{Code: "daily_checkin", Title: "Daily check-in", Points: 5, Category: "daily"},
+	} {
+		t.Active, t.MaxCompletionsPerUser = true, 1
+		m.s.tasks[t.Code] = t
+	}
+	for _, c := range []Category{
+		{Code: "onboarding", Name: "Onboarding", Position: 10},
+		{Code: "social", Name: "Social", Position: 20},
+		{Code: "daily", Name: "Daily", Position: 30},
+		{Code: "purchase", Name: "Purchases", Position: 40},
+	} {
+		m.s.categories[c.Code] = c
+	}
+	for _, r := range []Role{
+		{Name: "admin", Description: "Full access", Permissions: []string{
+			"audit:read", "campaigns:manage", "flags:manage", "maintenance:manage", "points:manage", "reports:read", "roles:manage", "rules:manage", "seasons:manage", "tasks:manage", "teams:manage", "users:manage", "users:read", "users:write", "webhooks:manage"}},
+		{Name: "moderator", Description: "Manages tasks and can view any user", Permissions: []string{
+			"tasks:manage", "users:read"}},
+		{Name: "support", Description: "Can view any user", Permissions: []string{"users:read"}},
+	} {
+		m.s.roles[r.Name] = r
+	}
+}
+
+// periodStart is date_trunc(period, t) in the local time zone.
+func periodStart(period string, t time.Time) time.Time {
+	t = t.Local()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	switch period {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// today is current_date, as a DATE column scans.
+func today() time.Time {
+	t := time.Now()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (m *Memory) GetUser(ctx context.Context, id int64) (User, error) {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return User{}, ErrNotFound
+	}
+	u.liftExpired(time.Now())
+	return u.User, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, username, passwordHash, homeRegion string) (User, error) {
+	defer m.lock()()
+	if _, ok := m.s.usernames[username]; ok {
+		return User{}, ErrConflict
+	}
+	u := memUser{
+		User:         User{ID: m.s.next("users"), Username: username, CreatedAt: time.Now(), Status: UserActive, Version: 1},
+		passwordHash: passwordHash,
+		homeRegion:   homeRegion,
+		settings:     Settings{LeaderboardVisibility: VisibilityPublic},
+	}
+	m.s.users[u.ID] = u
+	m.s.usernames[username] = u.ID
+	return u.User, nil
+}
+
+func (m *Memory) GetPasswordHash(ctx context.Context, username string) (int64, string, error) {
+	defer m.lock()()
+	id, ok := m.s.usernames[username]
+	if !ok {
+		return 0, "", ErrNotFound
+	}
+	return id, m.s.users[id].passwordHash, nil
+}
+
+func (m *Memory) GetHomeRegion(ctx context.Context, id int64) (string, error) {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return u.homeRegion, nil
+}
+
+func (m *Memory) SetReferrer(ctx context.Context, userID, referrerID int64) error {
+	defer m.lock()()
+	if u, ok := m.s.users[userID]; ok {
+		u.ReferrerID = &referrerID
+		m.s.users[userID] = u
+	}
+	return nil
+}
+
+func (m *Memory) CreateReferral(ctx context.Context, r Referral) error {
+	defer m.lock()()
+	key := [2]int64{r.ReferrerID, r.ReferredID}
+	if _, ok := m.s.referrals[key]; ok {
+		return ErrConflict
+	}
+	r.CreatedAt, r.PaidAt = time.Now(), nil
+	if r.Status == ReferralPaid {
+		at := r.CreatedAt
+		r.PaidAt = &at
+	}
+	m.s.referrals[key] = r
+	return nil
+}
+
+func (m *Memory) DueReferrals(ctx context.Context, ms ReferralMilestone, limit int) ([]Referral, error) {
+	defer m.lock()()
+	tasks := map[int64]int{}
+	for k, times := range m.s.userTasks {
+		tasks[k.userID] += len(times)
+	}
+	points := map[int64]int64{}
+	for _, e := range m.s.ledger {
+		if strings.HasPrefix(e.Reason, "task:") || strings.HasPrefix(e.Reason, "task_revoked:") {
+			points[e.userID] += e.Amount
+		}
+	}
+	out := []Referral{}
+	for _, r := range m.s.referrals {
+		u, ok := m.s.users[r.ReferredID]
+		if r.Status != ReferralPending || !ok || u.deleted || u.Status == UserBanned {
+			continue
+		}
+		if tasks[r.ReferredID] >= ms.Tasks && points[r.ReferredID] >= ms.Points {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *Memory) PayReferral(ctx context.Context, referrerID, referredID int64) error {
+	defer m.lock()()
+	key := [2]int64{referrerID, referredID}
+	r, ok := m.s.referrals[key]
+	if !ok || r.Status != ReferralPending {
+		return ErrNotFound
+	}
+	now := time.Now()
+	r.Status, r.PaidAt = ReferralPaid, &now
+	m.s.referrals[key] = r
+	return nil
+}
+
+func (m *Memory) ExpireReferrals(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for k, r := range m.s.referrals {
+		if r.Status == ReferralPending && r.CreatedAt.Before(cutoff) {
+			r.Status = ReferralExpired
+			m.s.referrals[k] = r
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) ListReferrals(ctx context.Context, userID int64) ([]Referral, error) {
+	defer m.lock()()
+	out := []Referral{}
+	for _, r := range m.s.referrals {
+		if r.ReferrerID == userID || r.ReferredID == userID {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *Memory) ReferrerBonuses(ctx context.Context, referrerID int64, day, month time.Time) (ReferrerBonusCounts, error) {
+	defer m.lock()()
+	var c ReferrerBonusCounts
+	for _, r := range m.s.referrals {
+		if r.ReferrerID != referrerID || r.BonusReferrer <= 0 || r.Status == ReferralExpired {
+			continue
+		}
+		c.Total++
+		if !r.CreatedAt.Before(month) {
+			c.Month++
+		}
+		if !r.CreatedAt.Before(day) {
+			c.Day++
+		}
+	}
+	return c, nil
+}
+
+func (m *Memory) GetProfile(ctx context.Context, id int64) (Profile, error) {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return Profile{}, ErrNotFound
+	}
+	p := u.profile
+	p.Version = u.Version
+	return p, nil
+}
+
+func (m *Memory) UpdateProfile(ctx context.Context, id int64, p Profile) error {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return ErrNotFound
+	}
+	if u.Version != p.Version {
+		return ErrVersionConflict
+	}
+	p.Version = 0
+	u.profile = p
+	u.Version++
+	m.s.users[id] = u
+	return nil
+}
+
+func (m *Memory) CheckUserVersion(ctx context.Context, id, version int64) error {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return ErrNotFound
+	}
+	if u.Version != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (m *Memory) Profiles(ctx context.Context, ids []int64) (map[int64]Profile, error) {
+	defer m.lock()()
+	out := make(map[int64]Profile, len(ids))
+	for _, id := range ids {
+		if u, ok := m.s.users[id]; ok {
+			out[id] = u.profile
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) GetSettings(ctx context.Context, id int64) (Settings, error) {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return Settings{}, ErrNotFound
+	}
+	return u.settings, nil
+}
+
+func (m *Memory) UpdateSettings(ctx context.Context, id int64, st Settings) error {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return ErrNotFound
+	}
+	u.settings = st
+	m.s.users[id] = u
+	return nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, id int64) error {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return ErrNotFound
+	}
+	now := time.Now()
+	m.s.deleted[id] = memDeletedUser{username: u.Username, passwordHash: u.passwordHash, profile: u.profile, deletedAt: now}
+	delete(m.s.usernames, u.Username)
+	u.Username = fmt.Sprintf("deleted:%d", id)
+	u.passwordHash, u.profile, u.deleted = "", Profile{}, true
+	m.s.users[id] = u
+	for hash, t := range m.s.tokens {
+		if t.UserID == id && t.RevokedAt == nil {
+			t.RevokedAt = &now
+			m.s.tokens[hash] = t
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SearchUsers(ctx context.Context, f UserFilter) ([]User, error) {
+	defer m.lock()()
+	out := []User{}
+	now := time.Now()
+	for _, u := range m.s.users {
+		u.liftExpired(now)
+		switch {
+		case u.deleted,
+			!strings.HasPrefix(u.Username, f.UsernamePrefix),
+			f.MinPoints != nil && u.Points < *f.MinPoints,
+			f.CreatedAfter != nil && !u.CreatedAt.After(*f.CreatedAfter),
+			f.Status != "" && u.Status != f.Status,
+			f.Before > 0 && u.ID >= f.Before:
+			continue
+		}
+		out = append(out, u.User)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out[:min(len(out), f.Limit)], nil
+}
+
+func (m *Memory) SetUserStatus(ctx context.Context, id int64, status, reason string, until *time.Time) error {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return ErrNotFound
+	}
+	u.Status, u.StatusReason, u.StatusUntil = status, reason, until
+	m.s.users[id] = u
+	if status != UserBanned {
+		return nil
+	}
+	now := time.Now()
+	for hash, t := range m.s.tokens {
+		if t.UserID == id && t.RevokedAt == nil {
+			t.RevokedAt = &now
+			m.s.tokens[hash] = t
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ClearReferrer(ctx context.Context, id int64) error {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok || u.deleted {
+		return ErrNotFound
+	}
+	if u.ReferrerID != nil {
+		delete(m.s.referrals, [2]int64{*u.ReferrerID, id})
+	}
+	u.ReferrerID = nil
+	m.s.users[id] = u
+	return nil
+}
+
+func (m *Memory) RestoreUser(ctx context.Context, id int64, since time.Time) error {
+	defer m.lock()()
+	d, ok := m.s.deleted[id]
+	if !ok || d.deletedAt.Before(since) {
+		return ErrNotFound
+	}
+	if _, taken := m.s.usernames[d.username]; taken {
+		return ErrConflict
+	}
+	u := m.s.users[id]
+	u.Username, u.passwordHash, u.profile, u.deleted = d.username, d.passwordHash, d.profile, false
+	m.s.users[id] = u
+	m.s.usernames[u.Username] = id
+	delete(m.s.deleted, id)
+	return nil
+}
+
+func (m *Memory) PurgeDeletedUsers(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for id, d := range m.s.deleted {
+		if d.deletedAt.Before(cutoff) {
+			delete(m.s.deleted, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// task fills in Requires and Tags, which live in deps and tags.
+func (s *memState) task(t Task) Task {
+	t.Requires = slices.Clone(s.deps[t.Code])
+	if t.Requires == nil {
+		t.Requires = []string{}
+	}
+	t.Tags = slices.Clone(s.tags[t.Code])
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	t.setRemaining()
+	return t
+}
+
+func (m *Memory) GetTask(ctx context.Context, code string) (Task, error) {
+	defer m.lock()()
+	t, ok := m.s.tasks[code]
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	return m.s.task(t), nil
+}
+
+func (m *Memory) ListTasks(ctx context.Context, availableOnly bool) ([]Task, error) {
+	defer m.lock()()
+	now := time.Now()
+	tasks := []Task{}
+	for _, t := range m.s.tasks {
+		if !availableOnly || t.AvailableAt(now) {
+			tasks = append(tasks, m.s.task(t))
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Code < tasks[j].Code })
+	return tasks, nil
+}
+
+func (m *Memory) CreateTask(ctx context.Context, t Task) (Task, error) {
+	defer m.lock()()
+	if _, ok := m.s.tasks[t.Code]; ok {
+		return Task{}, ErrConflict
+	}
+	t.Requires, t.Tags = nil, nil
+	t.Completions = 0
+	m.s.tasks[t.Code] = t
+	return m.s.task(t), nil
+}
+
+func (m *Memory) UpdateTask(ctx context.Context, t Task) (Task, error) {
+	defer m.lock()()
+	old, ok := m.s.tasks[t.Code]
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	t.Completions = old.Completions
+	t.Requires, t.Tags = nil, nil
+	m.s.tasks[t.Code] = t
+	return m.s.task(t), nil
+}
+
+func (m *Memory) ArchiveTask(ctx context.Context, code string) error {
+	defer m.lock()()
+	t, ok := m.s.tasks[code]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Active = false
+	m.s.tasks[code] = t
+	return nil
+}
+
+func (m *Memory) AddUserTask(ctx context.Context, userID int64, code string, perUser int) (bool, error) {
+	defer m.lock()()
+	key := userTaskKey{userID, code}
+	if len(m.s.userTasks[key]) >= perUser {
+		return false, nil
+	}
+	m.s.userTasks[key] = append(m.s.userTasks[key], time.Now())
+	return true, nil
+}
+
+func (m *Memory) ClaimTaskCompletion(ctx context.Context, code string) (bool, error) {
+	defer m.lock()()
+	t, ok := m.s.tasks[code]
+	if !ok || t.MaxCompletions != nil && t.Completions >= *t.MaxCompletions {
+		return false, nil
+	}
+	t.Completions++
+	m.s.tasks[code] = t
+	return true, nil
+}
+
+func (m *Memory) RevokeUserTask(ctx context.Context, userID int64, code string) error {
+	defer m.lock()()
+	key := userTaskKey{userID, code}
+	times := m.s.userTasks[key]
+	if len(times) == 0 {
+		return ErrNotFound
+	}
+	if len(times) == 1 {
+		delete(m.s.userTasks, key)
+	} else {
+		m.s.userTasks[key] = times[:len(times)-1]
+	}
+	if t, ok := m.s.tasks[code]; ok && t.Completions > 0 {
+		t.Completions--
+		m.s.tasks[code] = t
+	}
+	return nil
+}
+
+func (m *Memory) CountUserTask(ctx context.Context, userID int64, code string) (int, error) {
+	defer m.lock()()
+	return len(m.s.userTasks[userTaskKey{userID, code}]), nil
+}
+
+func (m *Memory) ListCompletedTasks(ctx context.Context, userID int64) ([]CompletedTask, error) {
+	defer m.lock()()
+	var completed []CompletedTask
+	for key, times := range m.s.userTasks {
+		if key.userID != userID {
+			continue
+		}
+		t := m.s.tasks[key.code]
+		for _, at := range times {
+			completed = append(completed, CompletedTask{Code: t.Code, Title: t.Title, Points: t.Points, CompletedAt: at})
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool { return completed[i].CompletedAt.After(completed[j].CompletedAt) })
+	return completed, nil
+}
+
+func (m *Memory) CompletedTasksPage(ctx context.Context, userID int64, limit int, after *CompletedTaskCursor) ([]CompletedTask, error) {
+	defer m.lock()()
+	var completed []CompletedTask
+	for key, times := range m.s.userTasks {
+		if key.userID != userID {
+			continue
+		}
+		t := m.s.tasks[key.code]
+		for i, at := range times {
+			c := CompletedTask{Code: t.Code, Title: t.Title, Points: t.Points, CompletedAt: at, N: i + 1}
+			if after == nil || completedBefore(c, *after) {
+				completed = append(completed, c)
+			}
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return completedBefore(completed[j], CompletedTaskCursor{completed[i].CompletedAt, completed[i].Code, completed[i].N})
+	})
+	if len(completed) > limit {
+		completed = completed[:limit]
+	}
+	return completed, nil
+}
+
+// completedBefore reports whether c comes after the cursor in
+// (completed_at, code, n) DESC order.
+func completedBefore(c CompletedTask, after CompletedTaskCursor) bool {
+	if !c.CompletedAt.Equal(after.CompletedAt) {
+		return c.CompletedAt.Before(after.CompletedAt)
+	}
+	if c.Code != after.Code {
+		return c.Code < after.Code
+	}
+	return c.N < after.N
+}
+
+func (m *Memory) CountCompletedTasks(ctx context.Context, userID int64) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for key, times := range m.s.userTasks {
+		if key.userID == userID {
+			n += int64(len(times))
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) SetTaskPrerequisites(ctx context.Context, code string, requires []string) error {
+	defer m.lock()()
+	delete(m.s.deps, code)
+	var reqs []string
+	for _, req := range requires {
+		if _, ok := m.s.tasks[req]; !ok {
+			return ErrNotFound
+		}
+		if !slices.Contains(reqs, req) {
+			reqs = append(reqs, req)
+		}
+	}
+	if len(reqs) > 0 {
+		slices.Sort(reqs)
+		m.s.deps[code] = reqs
+	}
+	return nil
+}
+
+func (m *Memory) TaskDependsOn(ctx context.Context, from, to string) (bool, error) {
+	defer m.lock()()
+	seen := map[string]bool{}
+	stack := slices.Clone(m.s.deps[from])
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c == to {
+			return true, nil
+		}
+		if !seen[c] {
+			seen[c] = true
+			stack = append(stack, m.s.deps[c]...)
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) MissingPrerequisites(ctx context.Context, userID int64, code string) ([]string, error) {
+	defer m.lock()()
+	missing := []string{}
+	for _, req := range m.s.deps[code] {
+		if len(m.s.userTasks[userTaskKey{userID, req}]) == 0 {
+			missing = append(missing, req)
+		}
+	}
+	return missing, nil
+}
+
+func (m *Memory) SetTaskTags(ctx context.Context, code string, tags []string) error {
+	defer m.lock()()
+	delete(m.s.tags, code)
+	var out []string
+	for _, tag := range tags {
+		if !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	if len(out) > 0 {
+		slices.Sort(out)
+		m.s.tags[code] = out
+	}
+	return nil
+}
+
+// addPoints changes a balance the way the users triggers do, keeping the
+// current day, week and month windows, the running season and the user's
+// team in step.
+func (s *memState) addPoints(userID, amount int64) {
+	u := s.users[userID]
+	u.Points += amount
+	u.Version++
+	s.users[userID] = u
+	if amount == 0 {
+		return
+	}
+	if tm, ok := s.teamMembers[userID]; ok {
+		t := s.teams[tm.teamID]
+		t.Points += amount
+		s.teams[tm.teamID] = t
+	}
+	now := time.Now()
+	if se, ok := s.runningSeason(now); ok {
+		s.seasonPts[seasonKey{se.ID, userID}] += amount
+	}
+	for _, p := range []string{"day", "week", "month"} {
+		s.periodPts[periodKey{userID, p, periodStart(p, now)}] += amount
+	}
+}
+
+// appendLedger adds e to the end of its user's stream and to their
+// balance.
+func (s *memState) appendLedger(e memLedgerEntry) {
+	s.addPoints(e.userID, e.Amount)
+	u := s.users[e.userID]
+	u.pointsSeq++
+	s.users[e.userID] = u
+	e.Seq, e.Balance = u.pointsSeq, u.Points
+	s.ledger = append(s.ledger, e)
+}
+
+func (m *Memory) Accrue(ctx context.Context, userID, amount int64, reason string) error {
+	defer m.lock()()
+	u, ok := m.s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if amount < 0 && u.Points+amount < 0 {
+		return ErrNegativeBalance
+	}
+	now := time.Now()
+	id := m.s.next("point_transactions")
+	m.s.appendLedger(memLedgerEntry{
+		LedgerEntry: LedgerEntry{ID: id, Amount: amount, Reason: reason, Region: m.region, CreatedAt: now},
+		userID:      userID,
+		originSeq:   id,
+		recordedAt:  now,
+	})
+	m.s.origins[originKey{m.region, id}] = true
+	return nil
+}
+
+func (m *Memory) BalanceAt(ctx context.Context, userID int64, at time.Time) (LedgerEntry, error) {
+	defer m.lock()()
+	for i := len(m.s.ledger) - 1; i >= 0; i-- {
+		if e := m.s.ledger[i]; e.userID == userID && !e.CreatedAt.After(at) {
+			return e.LedgerEntry, nil
+		}
+	}
+	return LedgerEntry{}, ErrNotFound
+}
+
+func (m *Memory) CountTransactions(ctx context.Context, userID int64) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for _, e := range m.s.ledger {
+		if e.userID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) ListTransactions(ctx context.Context, userID, before int64, limit int) ([]LedgerEntry, error) {
+	defer m.lock()()
+	items := []LedgerEntry{}
+	for i := len(m.s.ledger) - 1; i >= 0 && len(items) < limit; i-- {
+		if e := m.s.ledger[i]; e.userID == userID && e.ID < before {
+			items = append(items, e.LedgerEntry)
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) LedgerByReason(ctx context.Context, userID int64, reasons []string) ([]LedgerEntry, error) {
+	defer m.lock()()
+	items := []LedgerEntry{}
+	for _, e := range m.s.ledger {
+		if e.userID == userID && slices.Contains(reasons, e.Reason) {
+			items = append(items, e.LedgerEntry)
+		}
+	}
+	return items, nil
+}
+
+// board is the period's leaderboard source rows in (points DESC, id ASC)
+// order, without ranks.
+func (s *memState) board(period string) []LeaderboardEntry {
+	var rows []LeaderboardEntry
+	if period == "all" {
+		for _, u := range s.users {
+			if !u.deleted {
+				rows = append(rows, LeaderboardEntry{ID: u.ID, Username: u.Username, Points: u.Points})
+			}
+		}
+	} else {
+		start := periodStart(period, time.Now())
+		for k, pts := range s.periodPts {
+			if k.period == period && k.start.Equal(start) && !s.users[k.userID].deleted {
+				rows = append(rows, LeaderboardEntry{ID: k.userID, Username: s.users[k.userID].Username, Points: pts})
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return ranksAbove(rows[i], rows[j].Points, rows[j].ID) })
+	return rows
+}
+
+// visibleBoard is board without hidden users and with anonymous ones
+// marked.
+func (s *memState) visibleBoard(period string) []LeaderboardEntry {
+	var rows []LeaderboardEntry
+	for _, e := range s.board(period) {
+		switch s.users[e.ID].settings.LeaderboardVisibility {
+		case VisibilityHidden:
+			continue
+		case VisibilityAnonymous:
+			e.Anonymous = true
+		}
+		rows = append(rows, e)
+	}
+	return rows
+}
+
+// ranksAbove reports whether e is ahead of a user with points and id.
+func ranksAbove(e LeaderboardEntry, points, id int64) bool {
+	return e.Points > points || e.Points == points && e.ID < id
+}
+
+func (m *Memory) Leaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	defer m.lock()()
+	rows := m.s.visibleBoard(period)
+	start := 0
+	if after != nil {
+		for start < len(rows) && (ranksAbove(rows[start], after.Points, after.ID) || rows[start].ID == after.ID && rows[start].Points == after.Points) {
+			start++
+		}
+	}
+	var items []LeaderboardEntry
+	for i := start; i < len(rows) && len(items) < limit; i++ {
+		it := rows[i]
+		it.Rank = i + 1
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+func (m *Memory) FriendsLeaderboard(ctx context.Context, userID int64, period string) ([]LeaderboardEntry, error) {
+	defer m.lock()()
+	me := m.s.users[userID]
+	start := periodStart(period, time.Now())
+	var items []LeaderboardEntry
+	for id, u := range m.s.users {
+		friend := id == userID || u.ReferrerID != nil && *u.ReferrerID == userID ||
+			me.ReferrerID != nil && *me.ReferrerID == id
+		if !friend || u.deleted || id != userID && u.settings.LeaderboardVisibility == VisibilityHidden {
+			continue
+		}
+		e := LeaderboardEntry{ID: id, Username: u.Username, Points: u.Points, Anonymous: u.settings.LeaderboardVisibility == VisibilityAnonymous}
+		if period != "all" {
+			e.Points = m.s.periodPts[periodKey{id, period, start}]
+		}
+		items = append(items, e)
+	}
+	sort.Slice(items, func(i, j int) bool { return ranksAbove(items[i], items[j].Points, items[j].ID) })
+	for i := range items {
+		items[i].Rank = i + 1
+	}
+	return items, nil
+}
+
+func (m *Memory) Rank(ctx context.Context, period string, userID, points int64) (int, *LeaderboardEntry, error) {
+	defer m.lock()()
+	var above []LeaderboardEntry
+	for _, e := range m.s.visibleBoard(period) {
+		if ranksAbove(e, points, userID) {
+			above = append(above, e)
+		}
+	}
+	if len(above) == 0 {
+		return 1, nil, nil
+	}
+	next := above[len(above)-1]
+	next.Rank = len(above)
+	return len(above) + 1, &next, nil
+}
+
+func (m *Memory) TotalUsers(ctx context.Context) (int64, error) {
+	defer m.lock()()
+	return int64(len(m.s.board("all"))), nil
+}
+
+func (m *Memory) PeriodUsers(ctx context.Context, period string) (int64, error) {
+	defer m.lock()()
+	return int64(len(m.s.board(period))), nil
+}
+
+func (m *Memory) PeriodPoints(ctx context.Context, userID int64, period string) (int64, error) {
+	defer m.lock()()
+	return m.s.periodPts[periodKey{userID, period, periodStart(period, time.Now())}], nil
+}
+
+func (m *Memory) Distribution(ctx context.Context, period string, points int64) (Distribution, error) {
+	defer m.lock()()
+	var d Distribution
+	for _, e := range m.s.board(period) {
+		switch {
+		case e.Points < points:
+			d.Below++
+		case e.Points > points:
+			d.Above++
+		}
+		d.Present++
+	}
+	return d, nil
+}
+
+func (m *Memory) PointsHistogram(ctx context.Context, period string) ([]PointsCount, error) {
+	defer m.lock()()
+	var out []PointsCount
+	rows := m.s.board(period)
+	// board is highest first
+	for i := len(rows) - 1; i >= 0; i-- {
+		if n := len(out); n > 0 && out[n-1].Points == rows[i].Points {
+			out[n-1].Users++
+			continue
+		}
+		out = append(out, PointsCount{Points: rows[i].Points, Users: 1})
+	}
+	return out, nil
+}
+
+func (m *Memory) CreateTransfer(ctx context.Context, fromID, toID, amount int64) (Transfer, error) {
+	defer m.lock()()
+	t := Transfer{ID: m.s.next("point_transfers"), FromUserID: fromID, ToUserID: toID, Amount: amount, CreatedAt: time.Now()}
+	m.s.transfers = append(m.s.transfers, t)
+	return t, nil
+}
+
+func (m *Memory) TransferredToday(ctx context.Context, userID int64) (int64, error) {
+	defer m.lock()()
+	since := periodStart("day", time.Now())
+	var sum int64
+	for _, t := range m.s.transfers {
+		if t.FromUserID == userID && !t.CreatedAt.Before(since) {
+			sum += t.Amount
+		}
+	}
+	return sum, nil
+}
+
+func (m *Memory) BumpStreak(ctx context.Context, userID int64, maxStreak int) (Streak, error) {
+	defer m.lock()()
+	day := today()
+	st := m.s.streaks[userID].bump(day, maxStreak)
+	m.s.streaks[userID] = st
+	return Streak{Current: st.current, Longest: st.longest, LastDay: &day, CompletedToday: true}, nil
+}
+
+func (m *Memory) GetStreak(ctx context.Context, userID int64) (Streak, error) {
+	defer m.lock()()
+	st, ok := m.s.streaks[userID]
+	if !ok {
+		return Streak{}, nil
+	}
+	day := today()
+	out := Streak{Longest: st.longest, LastDay: &st.lastDay, CompletedToday: st.lastDay.Equal(day)}
+	if !st.lastDay.Before(day.AddDate(0, 0, -1)) {
+		out.Current = st.current
+	}
+	return out, nil
+}
+
+func (m *Memory) CheckIn(ctx context.Context, userID int64, day time.Time) (Streak, bool, error) {
+	defer m.lock()()
+	st, ok := m.s.checkins[userID]
+	if ok && !st.lastDay.Before(day) {
+		return Streak{}, false, nil
+	}
+	st = st.bump(day, 0)
+	m.s.checkins[userID] = st
+	return Streak{Current: st.current, Longest: st.longest, LastDay: &day, CompletedToday: true}, true, nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, userID int64, familyID, tokenHash string, ttl time.Duration) (int64, error) {
+	defer m.lock()()
+	if familyID == "" {
+		familyID = newUUID()
+	}
+	t := memToken{
+		RefreshToken: RefreshToken{ID: m.s.next("refresh_tokens"), UserID: userID, FamilyID: familyID, ExpiresAt: time.Now().Add(ttl)},
+		hash:         tokenHash,
+	}
+	m.s.tokens[tokenHash] = t
+	return t.ID, nil
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	defer m.lock()()
+	t, ok := m.s.tokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	return t.RefreshToken, nil
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, id, replacedBy int64) error {
+	defer m.lock()()
+	now := time.Now()
+	for hash, t := range m.s.tokens {
+		if t.ID == id {
+			t.RevokedAt = &now
+			m.s.tokens[hash] = t
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	defer m.lock()()
+	m.s.revokeFamily(familyID)
+	return nil
+}
+
+func (s *memState) revokeFamily(familyID string) {
+	now := time.Now()
+	for hash, t := range s.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+			s.tokens[hash] = t
+		}
+	}
+}
+
+func (m *Memory) RevokeRefreshFamilyOf(ctx context.Context, tokenHash string) error {
+	defer m.lock()()
+	if t, ok := m.s.tokens[tokenHash]; ok {
+		m.s.revokeFamily(t.FamilyID)
+	}
+	return nil
+}
+
+func (m *Memory) PurgeRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for hash, t := range m.s.tokens {
+		if t.ExpiresAt.Before(now) {
+			delete(m.s.tokens, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) LocalAccruals(ctx context.Context, after int64, lag time.Duration, limit int) ([]Accrual, error) {
+	defer m.lock()()
+	cutoff := time.Now().Add(-lag)
+	var batch []Accrual
+	for _, e := range m.s.ledger {
+		if len(batch) == limit {
+			break
+		}
+		if e.Region == m.region && e.originSeq > after && e.recordedAt.Before(cutoff) {
+			region, id := m.origin(m.s.users[e.userID])
+			batch = append(batch, Accrual{Seq: e.originSeq, UserRegion: region, UserID: id, Amount: e.Amount, Reason: e.Reason, RecordedAt: e.recordedAt})
+		}
+	}
+	return batch, nil
+}
+
+func (m *Memory) ReplicationCursor(ctx context.Context, peer string) (int64, error) {
+	defer m.lock()()
+	return m.s.cursors[peer], nil
+}
+
+// origin is the region that created u and their id there.
+func (m *Memory) origin(u memUser) (string, int64) {
+	if u.originRegion != "" {
+		return u.originRegion, u.originID
+	}
+	return m.region, u.ID
+}
+
+// byOrigin finds the user created in region with id there.
+func (m *Memory) byOrigin(region string, id int64) (memUser, bool) {
+	if region == m.region {
+		u, ok := m.s.users[id]
+		return u, ok && u.originRegion == ""
+	}
+	for _, u := range m.s.users {
+		if u.originRegion == region && u.originID == id {
+			return u, true
+		}
+	}
+	return memUser{}, false
+}
+
+func (m *Memory) MergeAccrual(ctx context.Context, peer string, a Accrual) (int64, error) {
+	defer m.lock()()
+	u, ok := m.byOrigin(a.UserRegion, a.UserID)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	key := originKey{peer, a.Seq}
+	if m.s.origins[key] {
+		return 0, nil
+	}
+	m.s.origins[key] = true
+	m.s.appendLedger(memLedgerEntry{
+		LedgerEntry: LedgerEntry{ID: m.s.next("point_transactions"), Amount: a.Amount, Reason: a.Reason, Region: peer, CreatedAt: time.Now()},
+		userID:      u.ID,
+		originSeq:   a.Seq,
+		recordedAt:  a.RecordedAt,
+	})
+	return u.ID, nil
+}
+
+func (m *Memory) UserReplica(ctx context.Context, region string, id int64) (UserReplica, error) {
+	defer m.lock()()
+	u, ok := m.byOrigin(region, id)
+	if !ok {
+		return UserReplica{}, ErrNotFound
+	}
+	return UserReplica{Region: region, ID: id, Username: u.Username, HomeRegion: cmp.Or(u.homeRegion, region), CreatedAt: u.CreatedAt}, nil
+}
+
+func (m *Memory) UserOrigin(ctx context.Context, id int64) (string, int64, error) {
+	defer m.lock()()
+	u, ok := m.s.users[id]
+	if !ok {
+		return "", 0, ErrNotFound
+	}
+	region, originID := m.origin(u)
+	return region, originID, nil
+}
+
+func (m *Memory) AddUserReplica(ctx context.Context, r UserReplica) (int64, error) {
+	defer m.lock()()
+	if _, ok := m.s.usernames[r.Username]; ok {
+		return 0, ErrConflict
+	}
+	if _, ok := m.byOrigin(r.Region, r.ID); ok {
+		return 0, ErrConflict
+	}
+	u := memUser{
+		User:         User{ID: m.s.next("users"), Username: r.Username, CreatedAt: r.CreatedAt, Status: UserActive, Version: 1},
+		homeRegion:   r.HomeRegion,
+		originRegion: r.Region,
+		originID:     r.ID,
+		settings:     Settings{LeaderboardVisibility: VisibilityPublic},
+	}
+	m.s.users[u.ID] = u
+	m.s.usernames[u.Username] = u.ID
+	return u.ID, nil
+}
+
+func (m *Memory) ParkAccrual(ctx context.Context, peer string, a Accrual) error {
+	defer m.lock()()
+	key := originKey{peer, a.Seq}
+	if _, ok := m.s.parked[key]; !ok {
+		m.s.parked[key] = a
+	}
+	return nil
+}
+
+func (m *Memory) SetReplicationCursor(ctx context.Context, peer string, seq int64) error {
+	defer m.lock()()
+	m.s.cursors[peer] = seq
+	return nil
+}
+
+func (m *Memory) ClaimIdempotencyKey(ctx context.Context, userID int64, key, requestHash string, lease, ttl time.Duration) (*IdempotentResponse, error) {
+	defer m.lock()()
+	now := time.Now()
+	k := idemKey{userID, key}
+	if rec, ok := m.s.idem[k]; ok && rec.createdAt.After(now.Add(-ttl)) && (rec.Done || rec.lockedUntil.After(now)) {
+		res := rec.IdempotentResponse
+		return &res, nil
+	}
+	m.s.idem[k] = memIdempotency{
+		IdempotentResponse: IdempotentResponse{RequestHash: requestHash},
+		createdAt:          now,
+		lockedUntil:        now.Add(lease),
+	}
+	return nil, nil
+}
+
+func (m *Memory) SaveIdempotentResponse(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error {
+	defer m.lock()()
+	k := idemKey{userID, key}
+	if rec, ok := m.s.idem[k]; ok {
+		rec.Done, rec.Status, rec.ContentType, rec.Body = true, status, contentType, slices.Clone(body)
+		m.s.idem[k] = rec
+	}
+	return nil
+}
+
+func (m *Memory) ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error {
+	defer m.lock()()
+	k := idemKey{userID, key}
+	if rec, ok := m.s.idem[k]; ok && !rec.Done {
+		delete(m.s.idem, k)
+	}
+	return nil
+}
+
+func (m *Memory) Permissions(ctx context.Context, userID int64, extraRoles []string) ([]string, error) {
+	defer m.lock()()
+	var perms []string
+	for name, r := range m.s.roles {
+		if m.s.userRoles[userRoleKey{userID, name}] || slices.Contains(extraRoles, name) {
+			perms = append(perms, r.Permissions...)
+		}
+	}
+	slices.Sort(perms)
+	return slices.Compact(perms), nil
+}
+
+func (m *Memory) ListRoles(ctx context.Context) ([]Role, error) {
+	defer m.lock()()
+	roles := []Role{}
+	for _, r := range m.s.roles {
+		r.Permissions = slices.Clone(r.Permissions)
+		roles = append(roles, r)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (m *Memory) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	defer m.lock()()
+	roles := []string{}
+	for k := range m.s.userRoles {
+		if k.userID == userID {
+			roles = append(roles, k.role)
+		}
+	}
+	slices.Sort(roles)
+	return roles, nil
+}
+
+func (m *Memory) AssignRole(ctx context.Context, userID int64, role string) error {
+	defer m.lock()()
+	if _, ok := m.s.roles[role]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrNotFound
+	}
+	m.s.userRoles[userRoleKey{userID, role}] = true
+	return nil
+}
+
+func (m *Memory) RevokeRole(ctx context.Context, userID int64, role string) error {
+	defer m.lock()()
+	delete(m.s.userRoles, userRoleKey{userID, role})
+	return nil
+}
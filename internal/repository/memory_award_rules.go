@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+func (m *Memory) CreateAwardRule(ctx context.Context, r AwardRule) (AwardRule, error) {
+	defer m.lock()()
+	r.ID = m.s.next("award_rules")
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	r.Conditions = slices.Clone(r.Conditions)
+	m.s.awardRules[r.ID] = r
+	return r, nil
+}
+
+func (m *Memory) GetAwardRule(ctx context.Context, id int64) (AwardRule, error) {
+	defer m.lock()()
+	r, ok := m.s.awardRules[id]
+	if !ok {
+		return AwardRule{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (m *Memory) ListAwardRules(ctx context.Context, enabledOnly bool) ([]AwardRule, error) {
+	defer m.lock()()
+	out := []AwardRule{}
+	for _, r := range m.s.awardRules {
+		if r.Enabled || !enabledOnly {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Position != out[j].Position {
+			return out[i].Position < out[j].Position
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (m *Memory) UpdateAwardRule(ctx context.Context, r AwardRule) error {
+	defer m.lock()()
+	old, ok := m.s.awardRules[r.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	r.CreatedAt, r.UpdatedAt = old.CreatedAt, time.Now()
+	r.Conditions = slices.Clone(r.Conditions)
+	m.s.awardRules[r.ID] = r
+	return nil
+}
+
+func (m *Memory) DeleteAwardRule(ctx context.Context, id int64) error {
+	defer m.lock()()
+	if _, ok := m.s.awardRules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.awardRules, id)
+	return nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+func (m *Memory) RecordDiscrepancies(ctx context.Context, at time.Time) (int64, error) {
+	defer m.lock()()
+	sums := map[int64]int64{}
+	for _, e := range m.s.ledger {
+		sums[e.userID] += e.Amount
+	}
+	m.s.discrepancies = map[int64]Discrepancy{}
+	for id, u := range m.s.users {
+		if !u.deleted && u.Points != sums[id] {
+			m.s.discrepancies[id] = Discrepancy{UserID: id, Points: u.Points, LedgerPoints: sums[id], FoundAt: at}
+		}
+	}
+	return int64(len(m.s.discrepancies)), nil
+}
+
+func (m *Memory) ListDiscrepancies(ctx context.Context, afterUserID int64, limit int) ([]Discrepancy, error) {
+	defer m.lock()()
+	out := []Discrepancy{}
+	for id, d := range m.s.discrepancies {
+		if id > afterUserID {
+			d.Username = m.s.users[id].Username
+			out = append(out, d)
+		}
+	}
+	slices.SortFunc(out, func(a, b Discrepancy) int { return int(a.UserID - b.UserID) })
+	return out[:min(len(out), limit)], nil
+}
+
+func (m *Memory) DeleteDiscrepancy(ctx context.Context, userID int64) error {
+	defer m.lock()()
+	delete(m.s.discrepancies, userID)
+	return nil
+}
+
+func (m *Memory) ReplayPoints(ctx context.Context, userID int64) (before, after int64, err error) {
+	defer m.lock()()
+	u, ok := m.s.users[userID]
+	if !ok || u.deleted {
+		return 0, 0, ErrNotFound
+	}
+	// entries are shared with the state InTx saved; rewrite a copy
+	m.s.ledger = slices.Clone(m.s.ledger)
+	var balance, seq int64
+	for i, e := range m.s.ledger {
+		if e.userID == userID {
+			balance += e.Amount
+			seq = e.Seq
+			m.s.ledger[i].Balance = balance
+		}
+	}
+	before = u.Points
+	if balance != before {
+		u.Version++
+	}
+	u.Points, u.pointsSeq = balance, seq
+	m.s.users[userID] = u
+	return before, balance, nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (m *Memory) ClaimCallbackSignature(ctx context.Context, partner, signature string, expiresAt, now time.Time) (bool, error) {
+	defer m.lock()()
+	for key, exp := range m.s.callbackSigs {
+		if exp.Before(now) {
+			delete(m.s.callbackSigs, key)
+		}
+	}
+	key := callbackKey{partner, signature}
+	if _, ok := m.s.callbackSigs[key]; ok {
+		return false, nil
+	}
+	m.s.callbackSigs[key] = expiresAt
+	return true, nil
+}
+
+func (m *Memory) AddPartnerCompletion(ctx context.Context, c PartnerCompletion) (bool, error) {
+	defer m.lock()()
+	key := callbackKey{c.Partner, c.Reference}
+	if _, ok := m.s.partnerRefs[key]; ok {
+		return false, nil
+	}
+	c.CreatedAt = time.Now()
+	m.s.partnerRefs[key] = c
+	return true, nil
+}
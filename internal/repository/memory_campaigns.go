@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+func (s *memState) campaign(id int64) (Campaign, bool) {
+	c, ok := s.campaigns[id]
+	c.Tasks = slices.Clone(c.Tasks)
+	c.setStatus(time.Now())
+	return c, ok
+}
+
+// campaignTasks is the deduplicated, sorted task list the SQL stores
+// return.
+func campaignTasks(tasks []string) []string {
+	out := slices.Clone(tasks)
+	if out == nil {
+		out = []string{}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func (m *Memory) CreateCampaign(ctx context.Context, c Campaign) (Campaign, error) {
+	defer m.lock()()
+	c.ID, c.CreatedAt = m.s.next("campaigns"), time.Now()
+	c.Tasks = campaignTasks(c.Tasks)
+	m.s.campaigns[c.ID] = c
+	c, _ = m.s.campaign(c.ID)
+	return c, nil
+}
+
+func (m *Memory) GetCampaign(ctx context.Context, id int64) (Campaign, error) {
+	defer m.lock()()
+	c, ok := m.s.campaign(id)
+	if !ok {
+		return Campaign{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (m *Memory) ListCampaigns(ctx context.Context) ([]Campaign, error) {
+	defer m.lock()()
+	out := []Campaign{}
+	for id := range m.s.campaigns {
+		c, _ := m.s.campaign(id)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartsAt.Equal(out[j].StartsAt) {
+			return out[i].StartsAt.After(out[j].StartsAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (m *Memory) RunningCampaigns(ctx context.Context) ([]Campaign, error) {
+	defer m.lock()()
+	out := []Campaign{}
+	for id := range m.s.campaigns {
+		if c, _ := m.s.campaign(id); c.Status == CampaignActive {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (m *Memory) UpdateCampaign(ctx context.Context, c Campaign) error {
+	defer m.lock()()
+	old, ok := m.s.campaigns[c.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	c.CreatedAt = old.CreatedAt
+	c.Tasks = campaignTasks(c.Tasks)
+	m.s.campaigns[c.ID] = c
+	return nil
+}
+
+func (m *Memory) DeleteCampaign(ctx context.Context, id int64) error {
+	defer m.lock()()
+	if _, ok := m.s.campaigns[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.campaigns, id)
+	for aid, a := range m.s.campaignAwards {
+		if a.CampaignID == id {
+			delete(m.s.campaignAwards, aid)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) AddCampaignAward(ctx context.Context, a CampaignAward) error {
+	defer m.lock()()
+	m.s.campaignAwards[m.s.next("campaign_awards")] = a
+	return nil
+}
+
+func (m *Memory) CampaignStats(ctx context.Context, id int64) (CampaignStats, error) {
+	defer m.lock()()
+	st := CampaignStats{Tasks: []CampaignTaskStats{}}
+	byTask := map[string]*CampaignTaskStats{}
+	users := map[int64]bool{}
+	for _, a := range m.s.campaignAwards {
+		if a.CampaignID != id {
+			continue
+		}
+		t := byTask[a.TaskCode]
+		if t == nil {
+			t = &CampaignTaskStats{Task: a.TaskCode}
+			byTask[a.TaskCode] = t
+		}
+		t.Completions++
+		t.Awarded += a.Awarded
+		t.Extra += a.Extra
+		users[a.UserID] = true
+	}
+	for _, t := range byTask {
+		st.Completions += t.Completions
+		st.Awarded += t.Awarded
+		st.Extra += t.Extra
+		st.Tasks = append(st.Tasks, *t)
+	}
+	sort.Slice(st.Tasks, func(i, j int) bool { return st.Tasks[i].Task < st.Tasks[j].Task })
+	st.Users = int64(len(users))
+	return st, nil
+}
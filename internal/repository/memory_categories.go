@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+func (m *Memory) ListCategories(ctx context.Context) ([]Category, error) {
+	defer m.lock()()
+	out := []Category{}
+	for _, c := range m.s.categories {
+		out = append(out, c)
+	}
+	slices.SortFunc(out, func(a, b Category) int {
+		if a.Position != b.Position {
+			return a.Position - b.Position
+		}
+		return strings.Compare(a.Code, b.Code)
+	})
+	return out, nil
+}
+
+func (m *Memory) GetCategory(ctx context.Context, code string) (Category, error) {
+	defer m.lock()()
+	c, ok := m.s.categories[code]
+	if !ok {
+		return Category{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (m *Memory) CreateCategory(ctx context.Context, c Category) error {
+	defer m.lock()()
+	if _, ok := m.s.categories[c.Code]; ok {
+		return ErrConflict
+	}
+	m.s.categories[c.Code] = c
+	return nil
+}
+
+func (m *Memory) UpdateCategory(ctx context.Context, c Category) error {
+	defer m.lock()()
+	if _, ok := m.s.categories[c.Code]; !ok {
+		return ErrNotFound
+	}
+	m.s.categories[c.Code] = c
+	return nil
+}
+
+func (m *Memory) DeleteCategory(ctx context.Context, code string) error {
+	defer m.lock()()
+	if _, ok := m.s.categories[code]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.categories, code)
+	for k, t := range m.s.tasks {
+		if t.Category == code {
+			t.Category = ""
+			m.s.tasks[k] = t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+)
+
+func (m *Memory) AddAuditEvent(ctx context.Context, e AuditEvent) error {
+	defer m.lock()()
+	e.ID = m.s.next("audit_events")
+	e.At = time.Now()
+	m.s.audit = append(m.s.audit, e)
+	return nil
+}
+
+func (m *Memory) ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	defer m.lock()()
+	events := []AuditEvent{}
+	for i := len(m.s.audit) - 1; i >= 0 && len(events) < f.Limit; i-- {
+		e := m.s.audit[i]
+		switch {
+		case f.ActorID != nil && (e.ActorID == nil || *e.ActorID != *f.ActorID),
+			f.Action != "" && e.Action != f.Action,
+			f.TargetType != "" && e.TargetType != f.TargetType,
+			f.TargetID != "" && e.TargetID != f.TargetID,
+			f.Since != nil && e.At.Before(*f.Since),
+			f.Until != nil && !e.At.Before(*f.Until),
+			f.Before > 0 && e.ID >= f.Before:
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (m *Memory) AddOutboxEvent(ctx context.Context, e OutboxEvent) error {
+	defer m.lock()()
+	e.ID = m.s.next("outbox_events")
+	m.s.outbox[e.ID] = memOutboxEvent{OutboxEvent: e, nextAttemptAt: time.Now()}
+	return nil
+}
+
+func (m *Memory) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	defer m.lock()()
+	now := time.Now()
+	ids := make([]int64, 0, len(m.s.outbox))
+	for id, e := range m.s.outbox {
+		if !e.published && !e.nextAttemptAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	out := []OutboxEvent{}
+	for _, id := range ids[:min(len(ids), limit)] {
+		e := m.s.outbox[id]
+		e.nextAttemptAt = now.Add(lease)
+		m.s.outbox[id] = e
+		out = append(out, e.OutboxEvent)
+	}
+	return out, nil
+}
+
+func (m *Memory) MarkOutboxPublished(ctx context.Context, id int64) error {
+	defer m.lock()()
+	if e, ok := m.s.outbox[id]; ok {
+		e.published = true
+		m.s.outbox[id] = e
+	}
+	return nil
+}
+
+func (m *Memory) MarkOutboxFailed(ctx context.Context, id int64, errMsg string, retryIn time.Duration) error {
+	defer m.lock()()
+	if e, ok := m.s.outbox[id]; ok {
+		e.Attempts++
+		e.nextAttemptAt = time.Now().Add(retryIn)
+		m.s.outbox[id] = e
+	}
+	return nil
+}
+
+func (m *Memory) CreateWebhookEndpoint(ctx context.Context, e WebhookEndpoint) (WebhookEndpoint, error) {
+	defer m.lock()()
+	e.ID = m.s.next("webhook_endpoints")
+	e.Events = slices.Clone(e.Events)
+	e.Active = true
+	e.CreatedAt = time.Now()
+	m.s.endpoints[e.ID] = e
+	return e, nil
+}
+
+func (m *Memory) GetWebhookEndpoint(ctx context.Context, id int64) (WebhookEndpoint, error) {
+	defer m.lock()()
+	e, ok := m.s.endpoints[id]
+	if !ok {
+		return WebhookEndpoint{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func (m *Memory) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	defer m.lock()()
+	out := []WebhookEndpoint{}
+	for _, e := range m.s.endpoints {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (m *Memory) DisableWebhookEndpoint(ctx context.Context, id int64) error {
+	defer m.lock()()
+	e, ok := m.s.endpoints[id]
+	if !ok {
+		return ErrNotFound
+	}
+	e.Active = false
+	m.s.endpoints[id] = e
+	for did, d := range m.s.deliveries {
+		if d.EndpointID == id && d.Status == "pending" {
+			d.Status, d.LastError = "failed", "endpoint disabled"
+			m.s.deliveries[did] = d
+		}
+	}
+	return nil
+}
+
+func (m *Memory) EnqueueWebhookEvent(ctx context.Context, eventID, event string, payload json.RawMessage) error {
+	defer m.lock()()
+	now := time.Now()
+	for _, e := range m.s.endpoints {
+		if !e.Active || !slices.Contains(e.Events, "*") && !slices.Contains(e.Events, event) {
+			continue
+		}
+		key := deliveryKey{e.ID, eventID}
+		if m.s.delivered[key] {
+			continue
+		}
+		m.s.delivered[key] = true
+		d := WebhookDelivery{
+			ID:            m.s.next("webhook_deliveries"),
+			EndpointID:    e.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       slices.Clone(payload),
+			Status:        "pending",
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		m.s.deliveries[d.ID] = d
+	}
+	return nil
+}
+
+func (m *Memory) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingDelivery, error) {
+	defer m.lock()()
+	now := time.Now()
+	var due []WebhookDelivery
+	for _, d := range m.s.deliveries {
+		if d.Status == "pending" && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	out := []PendingDelivery{}
+	for _, d := range due[:min(len(due), limit)] {
+		d.NextAttemptAt = now.Add(lease)
+		m.s.deliveries[d.ID] = d
+		e := m.s.endpoints[d.EndpointID]
+		out = append(out, PendingDelivery{
+			ID: d.ID, EventID: d.EventID, Event: d.Event, Payload: d.Payload,
+			Attempts: d.Attempts, URL: e.URL, Secret: e.Secret,
+		})
+	}
+	return out, nil
+}
+
+func (m *Memory) RecordWebhookAttempt(ctx context.Context, id int64, a WebhookAttempt) error {
+	defer m.lock()()
+	d, ok := m.s.deliveries[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	d.Status = "pending"
+	d.DeliveredAt = nil
+	switch {
+	case a.Delivered:
+		d.Status = "delivered"
+		d.DeliveredAt = &now
+	case a.RetryIn <= 0:
+		d.Status = "failed"
+	}
+	d.Attempts++
+	d.LastStatusCode = a.StatusCode
+	d.LastError = a.Error
+	d.NextAttemptAt = now.Add(a.RetryIn)
+	m.s.deliveries[id] = d
+	return nil
+}
+
+func (m *Memory) ListWebhookDeliveries(ctx context.Context, endpointID int64, status string, before int64, limit int) ([]WebhookDelivery, error) {
+	defer m.lock()()
+	var match []WebhookDelivery
+	for _, d := range m.s.deliveries {
+		if d.EndpointID == endpointID && (status == "" || d.Status == status) && (before == 0 || d.ID < before) {
+			match = append(match, d)
+		}
+	}
+	sort.Slice(match, func(i, j int) bool { return match[i].ID > match[j].ID })
+	return append([]WebhookDelivery{}, match[:min(len(match), limit)]...), nil
+}
+
+func (m *Memory) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	defer m.lock()()
+	d, ok := m.s.deliveries[id]
+	if !ok || d.Status == "pending" || !m.s.endpoints[d.EndpointID].Active {
+		return ErrNotFound
+	}
+	d.Status, d.Attempts, d.NextAttemptAt = "pending", 0, time.Now()
+	m.s.deliveries[id] = d
+	return nil
+}
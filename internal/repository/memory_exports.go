@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+type memExport struct {
+	DataExport
+	content       []byte
+	nextAttemptAt time.Time
+}
+
+func (e memExport) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+}
+
+func (m *Memory) CreateExport(ctx context.Context, userID int64, format string) (DataExport, error) {
+	defer m.lock()()
+	now := time.Now()
+	e := memExport{
+		DataExport:    DataExport{ID: m.s.next("data_exports"), UserID: userID, Format: format, Status: "pending", CreatedAt: now},
+		nextAttemptAt: now,
+	}
+	m.s.exports[e.ID] = e
+	return e.DataExport, nil
+}
+
+func (m *Memory) GetExport(ctx context.Context, userID, id int64) (DataExport, error) {
+	defer m.lock()()
+	e, ok := m.s.exports[id]
+	if !ok || e.UserID != userID || e.expired(time.Now()) {
+		return DataExport{}, ErrNotFound
+	}
+	return e.DataExport, nil
+}
+
+func (m *Memory) ExportContent(ctx context.Context, userID, id int64) ([]byte, error) {
+	defer m.lock()()
+	e, ok := m.s.exports[id]
+	if !ok || e.UserID != userID || e.Status != "ready" || e.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return e.content, nil
+}
+
+func (m *Memory) ClaimExports(ctx context.Context, limit int, lease time.Duration) ([]DataExport, error) {
+	defer m.lock()()
+	now := time.Now()
+	ids := []int64{}
+	for id, e := range m.s.exports {
+		if e.Status == "pending" && !e.nextAttemptAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	out := []DataExport{}
+	for _, id := range ids[:min(len(ids), limit)] {
+		e := m.s.exports[id]
+		e.nextAttemptAt = now.Add(lease)
+		m.s.exports[id] = e
+		out = append(out, e.DataExport)
+	}
+	return out, nil
+}
+
+func (m *Memory) CompleteExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error {
+	defer m.lock()()
+	if e, ok := m.s.exports[id]; ok && e.Status == "pending" {
+		now := time.Now()
+		e.Status, e.content, e.CompletedAt, e.ExpiresAt = "ready", content, &now, &expiresAt
+		m.s.exports[id] = e
+	}
+	return nil
+}
+
+func (m *Memory) FailExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error {
+	defer m.lock()()
+	if e, ok := m.s.exports[id]; ok && e.Status == "pending" {
+		now := time.Now()
+		e.Status, e.Error, e.CompletedAt, e.ExpiresAt = "failed", errMsg, &now, &expiresAt
+		m.s.exports[id] = e
+	}
+	return nil
+}
+
+func (m *Memory) DeleteUserExports(ctx context.Context, userID int64) error {
+	defer m.lock()()
+	for id, e := range m.s.exports {
+		if e.UserID == userID {
+			delete(m.s.exports, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) PurgeExports(ctx context.Context, now time.Time) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for id, e := range m.s.exports {
+		if e.ExpiresAt != nil && e.ExpiresAt.Before(now) {
+			delete(m.s.exports, id)
+			n++
+		}
+	}
+	for id, e := range m.s.reportExports {
+		if e.ExpiresAt != nil && e.ExpiresAt.Before(now) {
+			delete(m.s.reportExports, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memReportExport struct {
+	ReportExport
+	content       []byte
+	nextAttemptAt time.Time
+}
+
+func (e memReportExport) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+}
+
+func (m *Memory) CreateReportExport(ctx context.Context, report string, params json.RawMessage, requestedBy int64) (ReportExport, error) {
+	defer m.lock()()
+	now := time.Now()
+	e := memReportExport{
+		ReportExport: ReportExport{ID: m.s.next("report_exports"), Report: report, Params: params,
+			RequestedBy: requestedBy, Status: "pending", CreatedAt: now},
+		nextAttemptAt: now,
+	}
+	m.s.reportExports[e.ID] = e
+	return e.ReportExport, nil
+}
+
+func (m *Memory) GetReportExport(ctx context.Context, id int64) (ReportExport, error) {
+	defer m.lock()()
+	e, ok := m.s.reportExports[id]
+	if !ok || e.expired(time.Now()) {
+		return ReportExport{}, ErrNotFound
+	}
+	return e.ReportExport, nil
+}
+
+func (m *Memory) ReportExportContent(ctx context.Context, id int64) ([]byte, error) {
+	defer m.lock()()
+	e, ok := m.s.reportExports[id]
+	if !ok || e.Status != "ready" || e.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return e.content, nil
+}
+
+func (m *Memory) ClaimReportExports(ctx context.Context, limit int, lease time.Duration) ([]ReportExport, error) {
+	defer m.lock()()
+	now := time.Now()
+	ids := []int64{}
+	for id, e := range m.s.reportExports {
+		if e.Status == "pending" && !e.nextAttemptAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	out := []ReportExport{}
+	for _, id := range ids[:min(len(ids), limit)] {
+		e := m.s.reportExports[id]
+		e.nextAttemptAt = now.Add(lease)
+		m.s.reportExports[id] = e
+		out = append(out, e.ReportExport)
+	}
+	return out, nil
+}
+
+func (m *Memory) CompleteReportExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error {
+	defer m.lock()()
+	if e, ok := m.s.reportExports[id]; ok && e.Status == "pending" {
+		now := time.Now()
+		e.Status, e.content, e.CompletedAt, e.ExpiresAt = "ready", content, &now, &expiresAt
+		m.s.reportExports[id] = e
+	}
+	return nil
+}
+
+func (m *Memory) FailReportExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error {
+	defer m.lock()()
+	if e, ok := m.s.reportExports[id]; ok && e.Status == "pending" {
+		now := time.Now()
+		e.Status, e.Error, e.CompletedAt, e.ExpiresAt = "failed", errMsg, &now, &expiresAt
+		m.s.reportExports[id] = e
+	}
+	return nil
+}
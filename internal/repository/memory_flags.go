@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+func (m *Memory) FeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	defer m.lock()()
+	out := []FeatureFlag{}
+	for _, f := range m.s.flags {
+		out = append(out, f)
+	}
+	slices.SortFunc(out, func(a, b FeatureFlag) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+func (m *Memory) SetFeatureFlag(ctx context.Context, f FeatureFlag) (FeatureFlag, error) {
+	defer m.lock()()
+	f.UpdatedAt = time.Now()
+	m.s.flags[f.Name] = f
+	return f, nil
+}
+
+func (m *Memory) DeleteFeatureFlag(ctx context.Context, name string) error {
+	defer m.lock()()
+	if _, ok := m.s.flags[name]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.flags, name)
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+func (m *Memory) GetIdentity(ctx context.Context, provider, externalID string) (ExternalIdentity, error) {
+	defer m.lock()()
+	id, ok := m.s.identities[[2]string{provider, externalID}]
+	if !ok {
+		return ExternalIdentity{Provider: provider, ExternalID: externalID}, ErrNotFound
+	}
+	return id, nil
+}
+
+func (m *Memory) ListIdentities(ctx context.Context, userID int64) ([]ExternalIdentity, error) {
+	defer m.lock()()
+	out := []ExternalIdentity{}
+	for _, id := range m.s.identities {
+		if id.UserID == userID {
+			out = append(out, id)
+		}
+	}
+	slices.SortFunc(out, func(a, b ExternalIdentity) int { return cmp.Compare(a.Provider, b.Provider) })
+	return out, nil
+}
+
+func (m *Memory) AddIdentity(ctx context.Context, id ExternalIdentity) error {
+	defer m.lock()()
+	if _, ok := m.s.users[id.UserID]; !ok {
+		return ErrNotFound
+	}
+	key := [2]string{id.Provider, id.ExternalID}
+	if _, ok := m.s.identities[key]; ok {
+		return ErrConflict
+	}
+	for _, other := range m.s.identities {
+		if other.UserID == id.UserID && other.Provider == id.Provider {
+			return ErrConflict
+		}
+	}
+	id.CreatedAt = time.Now()
+	m.s.identities[key] = id
+	return nil
+}
+
+func (m *Memory) DeleteIdentity(ctx context.Context, userID int64, provider string) (ExternalIdentity, error) {
+	defer m.lock()()
+	for key, id := range m.s.identities {
+		if id.UserID == userID && id.Provider == provider {
+			delete(m.s.identities, key)
+			return id, nil
+		}
+	}
+	return ExternalIdentity{Provider: provider, UserID: userID}, ErrNotFound
+}
+
+func (m *Memory) DeleteIdentities(ctx context.Context, userID int64) error {
+	defer m.lock()()
+	for key, id := range m.s.identities {
+		if id.UserID == userID {
+			delete(m.s.identities, key)
+		}
+	}
+	return nil
+}
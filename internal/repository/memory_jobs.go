@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (m *Memory) TryLockJob(ctx context.Context, name string) (func(), bool, error) {
+	unlock, ok := m.jobs.tryLock(name)
+	return unlock, ok, nil
+}
+
+func (m *Memory) ClaimJobRun(ctx context.Context, name string, slot time.Time) (bool, error) {
+	defer m.lock()()
+	if last, ok := m.s.jobRuns[name]; ok && !last.Before(slot) {
+		return false, nil
+	}
+	m.s.jobRuns[name] = slot
+	return true, nil
+}
+
+func (m *Memory) FinishJobRun(ctx context.Context, name string, slot time.Time, errMsg string) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+package repository
+
+import "context"
+
+func (m *Memory) UserLevels(ctx context.Context, ids []int64) (map[int64]UserLevel, error) {
+	defer m.lock()()
+	out := make(map[int64]UserLevel, len(ids))
+	for _, id := range ids {
+		if u, ok := m.s.users[id]; ok {
+			out[id] = UserLevel{Level: m.s.levels[id], Points: u.Points}
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) RaiseUserLevel(ctx context.Context, userID int64, level int) error {
+	defer m.lock()()
+	if level > m.s.levels[userID] {
+		m.s.levels[userID] = level
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (m *Memory) Maintenance(ctx context.Context) (Maintenance, error) {
+	defer m.lock()()
+	if m.s.maintenance == nil {
+		return Maintenance{}, ErrNotFound
+	}
+	return *m.s.maintenance, nil
+}
+
+func (m *Memory) SetMaintenance(ctx context.Context, mt Maintenance) (Maintenance, error) {
+	defer m.lock()()
+	mt.UpdatedAt = time.Now()
+	m.s.maintenance = &mt
+	return mt, nil
+}
+
+func (m *Memory) ClearMaintenance(ctx context.Context) error {
+	defer m.lock()()
+	if m.s.maintenance == nil {
+		return ErrNotFound
+	}
+	m.s.maintenance = nil
+	return nil
+}
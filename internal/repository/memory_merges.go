@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+)
+
+func (m *Memory) MergeUsers(ctx context.Context, from, into int64) (MergeCounts, error) {
+	defer m.lock()()
+	var c MergeCounts
+	src, ok := m.s.users[from]
+	if !ok {
+		return c, ErrNotFound
+	}
+	dst, ok := m.s.users[into]
+	if !ok {
+		return c, ErrNotFound
+	}
+	if dst.Points+src.Points < 0 && src.Points < 0 {
+		return c, ErrNegativeBalance
+	}
+
+	for k, times := range m.s.userTasks {
+		if k.userID != from {
+			continue
+		}
+		to := userTaskKey{into, k.code}
+		m.s.userTasks[to] = append(slices.Clip(m.s.userTasks[to]), times...)
+		delete(m.s.userTasks, k)
+		c.Completions += int64(len(times))
+	}
+
+	// from's stream goes on where into's ends, so seqs into's readers hold
+	// stay valid; the ledger is replaced, not changed in place, as clones
+	// share it
+	ledger := slices.Clone(m.s.ledger)
+	for i, e := range ledger {
+		if e.userID == from {
+			e.userID = into
+			e.Seq += dst.pointsSeq
+			e.Balance += dst.Points
+			ledger[i] = e
+			c.LedgerEntries++
+		}
+	}
+	m.s.ledger = ledger
+	c.Points = src.Points
+	m.s.addPoints(from, -c.Points)
+	m.s.addPoints(into, c.Points)
+	src, dst = m.s.users[from], m.s.users[into]
+	dst.pointsSeq += src.pointsSeq
+	src.pointsSeq = 0
+
+	// neither may end up having referred themselves
+	delete(m.s.referrals, [2]int64{from, into})
+	delete(m.s.referrals, [2]int64{into, from})
+	if dst.ReferrerID != nil && *dst.ReferrerID == from {
+		dst.ReferrerID = nil
+	}
+	for id, u := range m.s.users {
+		if id != into && id != from && u.ReferrerID != nil && *u.ReferrerID == from {
+			u.ReferrerID = &into
+			m.s.users[id] = u
+		}
+	}
+	if dst.ReferrerID == nil && src.ReferrerID != nil && *src.ReferrerID != into {
+		dst.ReferrerID = src.ReferrerID
+	}
+	m.s.users[from], m.s.users[into] = src, dst
+	hasReferral := false
+	for k := range m.s.referrals {
+		hasReferral = hasReferral || k[1] == into
+	}
+	for k, r := range m.s.referrals {
+		switch {
+		case k[0] == from:
+			r.ReferrerID = into
+		case k[1] == from && !hasReferral && dst.ReferrerID != nil && k[0] == *dst.ReferrerID:
+			r.ReferredID = into
+		default:
+			continue
+		}
+		delete(m.s.referrals, k)
+		m.s.referrals[[2]int64{r.ReferrerID, r.ReferredID}] = r
+		c.Referrals++
+	}
+	for token, click := range m.s.referralClicks {
+		if click.ReferrerID == from {
+			click.ReferrerID = into
+			m.s.referralClicks[token] = click
+		}
+	}
+	if code, ok := m.s.referralCodes[from]; ok {
+		if _, taken := m.s.referralCodes[into]; !taken {
+			m.s.referralCodes[into] = code
+			delete(m.s.referralCodes, from)
+		}
+	}
+
+	linked := map[string]bool{}
+	for _, id := range m.s.identities {
+		if id.UserID == into {
+			linked[id.Provider] = true
+		}
+	}
+	for k, id := range m.s.identities {
+		if id.UserID == from && !linked[id.Provider] {
+			id.UserID = into
+			m.s.identities[k] = id
+			c.Identities++
+		}
+	}
+
+	pending := map[string]bool{}
+	for _, sub := range m.s.submissions {
+		if sub.UserID == into && sub.Status == SubmissionPending {
+			pending[sub.TaskCode] = true
+		}
+	}
+	for id, sub := range m.s.submissions {
+		switch {
+		case sub.UserID != from:
+		case sub.Status == SubmissionPending && pending[sub.TaskCode]:
+			delete(m.s.submissions, id)
+		default:
+			sub.UserID = into
+			m.s.submissions[id] = sub
+			c.Submissions++
+		}
+	}
+	for k, pc := range m.s.partnerRefs {
+		if pc.UserID == from {
+			pc.UserID = into
+			m.s.partnerRefs[k] = pc
+		}
+	}
+	for id, a := range m.s.campaignAwards {
+		if a.UserID == from {
+			a.UserID = into
+			m.s.campaignAwards[id] = a
+		}
+	}
+	return c, nil
+}
+
+func (m *Memory) DuplicateMatches(ctx context.Context, id int64) ([]DuplicateMatch, error) {
+	defer m.lock()()
+	emails := map[int64]map[string]bool{}
+	add := func(userID int64, email string) {
+		if email == "" {
+			return
+		}
+		if emails[userID] == nil {
+			emails[userID] = map[string]bool{}
+		}
+		emails[userID][strings.ToLower(email)] = true
+	}
+	for _, ident := range m.s.identities {
+		add(ident.UserID, ident.Email)
+	}
+	for k, ch := range m.s.channels {
+		if k.channel == "email" {
+			add(k.userID, ch.Address)
+		}
+	}
+	out := []DuplicateMatch{}
+	for userID, theirs := range emails {
+		if u, ok := m.s.users[userID]; userID == id || !ok || u.deleted {
+			continue
+		}
+		for email := range theirs {
+			if emails[id][email] {
+				out = append(out, DuplicateMatch{UserID: userID, Email: email})
+			}
+		}
+	}
+	slices.SortFunc(out, func(a, b DuplicateMatch) int {
+		return cmp.Or(cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.Email, b.Email))
+	})
+	return out, nil
+}
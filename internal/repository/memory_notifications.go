@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+type memNotifyDelivery struct {
+	notificationID int64
+	channel        string
+	address        string
+	status         string
+	attempts       int
+	lastError      string
+	nextAttemptAt  time.Time
+	sentAt         *time.Time
+}
+
+func (m *Memory) AddNotification(ctx context.Context, n Notification) (bool, error) {
+	defer m.lock()()
+	if _, ok := m.s.users[n.UserID]; !ok {
+		return false, nil
+	}
+	for _, other := range m.s.notifications {
+		if other.UserID == n.UserID && other.EventID == n.EventID && other.Kind == n.Kind {
+			return false, nil
+		}
+	}
+	now := time.Now()
+	n.ID = m.s.next("notifications")
+	n.Data = slices.Clone(n.Data)
+	if len(n.Data) == 0 {
+		n.Data = []byte("{}")
+	}
+	n.CreatedAt, n.ReadAt = now, nil
+	m.s.notifications[n.ID] = n
+	for k, c := range m.s.channels {
+		if k.userID == n.UserID && c.Enabled {
+			m.s.notifyDeliveries[m.s.next("notification_deliveries")] = memNotifyDelivery{
+				notificationID: n.ID,
+				channel:        c.Channel,
+				address:        c.Address,
+				status:         "pending",
+				nextAttemptAt:  now,
+			}
+		}
+	}
+	return true, nil
+}
+
+func (m *Memory) ListNotifications(ctx context.Context, userID int64, unreadOnly bool, before int64, limit int) ([]Notification, error) {
+	defer m.lock()()
+	out := []Notification{}
+	for _, n := range m.s.notifications {
+		if n.UserID == userID && (!unreadOnly || n.ReadAt == nil) && (before == 0 || n.ID < before) {
+			out = append(out, n)
+		}
+	}
+	slices.SortFunc(out, func(a, b Notification) int { return int(b.ID - a.ID) })
+	return out[:min(len(out), limit)], nil
+}
+
+func (m *Memory) CountUnreadNotifications(ctx context.Context, userID int64) (int64, error) {
+	defer m.lock()()
+	var count int64
+	for _, n := range m.s.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) MarkNotificationsRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	defer m.lock()()
+	now := time.Now()
+	var count int64
+	for id, n := range m.s.notifications {
+		if n.UserID != userID || n.ReadAt != nil || ids != nil && !slices.Contains(ids, id) {
+			continue
+		}
+		n.ReadAt = &now
+		m.s.notifications[id] = n
+		count++
+	}
+	return count, nil
+}
+
+func (m *Memory) ListChannelSettings(ctx context.Context, userID int64) ([]ChannelSetting, error) {
+	defer m.lock()()
+	out := []ChannelSetting{}
+	for k, c := range m.s.channels {
+		if k.userID == userID {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Channel < out[j].Channel })
+	return out, nil
+}
+
+func (m *Memory) SetChannelSetting(ctx context.Context, userID int64, c ChannelSetting) (ChannelSetting, error) {
+	defer m.lock()()
+	c.UpdatedAt = time.Now()
+	m.s.channels[channelKey{userID, c.Channel}] = c
+	return c, nil
+}
+
+func (m *Memory) DeleteChannelSetting(ctx context.Context, userID int64, channel string) error {
+	defer m.lock()()
+	found := false
+	for k := range m.s.channels {
+		if k.userID == userID && (channel == "" || k.channel == channel) {
+			delete(m.s.channels, k)
+			found = true
+		}
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Memory) ClaimNotificationDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingNotification, error) {
+	defer m.lock()()
+	now := time.Now()
+	var due []int64
+	for id, d := range m.s.notifyDeliveries {
+		if d.status == "pending" && !d.nextAttemptAt.After(now) {
+			due = append(due, id)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return m.s.notifyDeliveries[due[i]].nextAttemptAt.Before(m.s.notifyDeliveries[due[j]].nextAttemptAt)
+	})
+	out := []PendingNotification{}
+	for _, id := range due[:min(len(due), limit)] {
+		d := m.s.notifyDeliveries[id]
+		d.nextAttemptAt = now.Add(lease)
+		m.s.notifyDeliveries[id] = d
+		out = append(out, PendingNotification{
+			ID: id, Channel: d.channel, Address: d.address, Attempts: d.attempts,
+			Notification: m.s.notifications[d.notificationID],
+		})
+	}
+	return out, nil
+}
+
+func (m *Memory) RecordNotificationAttempt(ctx context.Context, id int64, a NotificationAttempt) error {
+	defer m.lock()()
+	d, ok := m.s.notifyDeliveries[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	d.status = deliveryStatus(a)
+	d.sentAt = nil
+	if a.Sent {
+		d.sentAt = &now
+	}
+	d.attempts++
+	d.lastError = a.Error
+	d.nextAttemptAt = now.Add(a.RetryIn)
+	m.s.notifyDeliveries[id] = d
+	return nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+type memPasswordReset struct {
+	userID    int64
+	expiresAt time.Time
+	usedAt    *time.Time
+	createdAt time.Time
+}
+
+func (m *Memory) CreatePasswordReset(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	defer m.lock()()
+	if _, ok := m.s.passwordResets[tokenHash]; ok {
+		return ErrConflict
+	}
+	m.s.passwordResets[tokenHash] = memPasswordReset{userID: userID, expiresAt: expiresAt, createdAt: time.Now()}
+	return nil
+}
+
+func (m *Memory) CountPasswordResets(ctx context.Context, userID int64, since time.Time) (int, error) {
+	defer m.lock()()
+	n := 0
+	for _, r := range m.s.passwordResets {
+		if r.userID == userID && !r.createdAt.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) UsePasswordReset(ctx context.Context, tokenHash string, now time.Time) (int64, error) {
+	defer m.lock()()
+	r, ok := m.s.passwordResets[tokenHash]
+	if !ok || r.usedAt != nil || !r.expiresAt.After(now) {
+		return 0, ErrNotFound
+	}
+	for hash, other := range m.s.passwordResets {
+		if other.userID == r.userID && other.usedAt == nil {
+			other.usedAt = &now
+			m.s.passwordResets[hash] = other
+		}
+	}
+	return r.userID, nil
+}
+
+func (m *Memory) SetPasswordHash(ctx context.Context, userID int64, hash string) error {
+	defer m.lock()()
+	u, ok := m.s.users[userID]
+	if !ok || u.deleted {
+		return ErrNotFound
+	}
+	u.passwordHash = hash
+	m.s.users[userID] = u
+	return nil
+}
+
+func (m *Memory) PurgePasswordResets(ctx context.Context, now time.Time) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for hash, r := range m.s.passwordResets {
+		if r.expiresAt.Before(now) {
+			delete(m.s.passwordResets, hash)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// memRanks is one period's leaderboard_ranks and leaderboard_refreshes row.
+// entries is replaced, never changed, on refresh.
+type memRanks struct {
+	start       time.Time
+	refreshedAt time.Time
+	entries     map[int64]LeaderboardEntry
+}
+
+func memRankStart(period string) time.Time {
+	if period == "all" {
+		return time.Unix(0, 0)
+	}
+	return periodStart(period, time.Now())
+}
+
+func (m *Memory) RefreshRanks(ctx context.Context, period string) (int64, error) {
+	defer m.lock()()
+	old := m.s.rankings[period].entries
+	entries := map[int64]LeaderboardEntry{}
+	var changed int64
+	for i, e := range m.s.visibleBoard(period) {
+		e.Rank, e.Anonymous = i+1, false
+		if prev, ok := old[e.ID]; !ok || prev.Rank != e.Rank || prev.Points != e.Points {
+			changed++
+		}
+		entries[e.ID] = e
+	}
+	for id := range old {
+		if _, ok := entries[id]; !ok {
+			changed++
+		}
+	}
+	m.s.rankings[period] = memRanks{start: memRankStart(period), refreshedAt: time.Now(), entries: entries}
+	return changed, nil
+}
+
+func (m *Memory) RankSnapshot(ctx context.Context, period string) (RankSnapshot, error) {
+	defer m.lock()()
+	r, ok := m.s.rankings[period]
+	if !ok || !r.start.Equal(memRankStart(period)) {
+		return RankSnapshot{}, ErrNotFound
+	}
+	return RankSnapshot{Period: period, PeriodStart: r.start, RefreshedAt: r.refreshedAt}, nil
+}
+
+// ranked is the period's ranked entries of users still on the board, in
+// rank order, with their current name and visibility.
+func (s *memState) ranked(period string) []LeaderboardEntry {
+	var rows []LeaderboardEntry
+	for id, e := range s.rankings[period].entries {
+		u, ok := s.users[id]
+		if !ok || u.deleted || u.settings.LeaderboardVisibility == VisibilityHidden {
+			continue
+		}
+		e.Username, e.Anonymous = u.Username, u.settings.LeaderboardVisibility == VisibilityAnonymous
+		rows = append(rows, e)
+	}
+	sort.Slice(rows, func(i, j int) bool { return ranksAbove(rows[i], rows[j].Points, rows[j].ID) })
+	return rows
+}
+
+func (m *Memory) RankedLeaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	defer m.lock()()
+	var items []LeaderboardEntry
+	for _, e := range m.s.ranked(period) {
+		if len(items) == limit {
+			break
+		}
+		if after == nil || !ranksAbove(e, after.Points, after.ID) && e.ID != after.ID {
+			items = append(items, e)
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) RankedPosition(ctx context.Context, period string, userID int64) (LeaderboardEntry, *LeaderboardEntry, error) {
+	defer m.lock()()
+	rows := m.s.ranked(period)
+	for i, e := range rows {
+		if e.ID != userID {
+			continue
+		}
+		if i == 0 {
+			return e, nil, nil
+		}
+		above := rows[i-1]
+		return e, &above, nil
+	}
+	return LeaderboardEntry{}, nil, ErrNotFound
+}
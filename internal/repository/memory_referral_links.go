@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+func (m *Memory) ReferralCode(ctx context.Context, userID int64) (string, error) {
+	defer m.lock()()
+	code, ok := m.s.referralCodes[userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return code, nil
+}
+
+func (m *Memory) CreateReferralCode(ctx context.Context, userID int64, code string) error {
+	defer m.lock()()
+	if _, ok := m.s.referralCodes[userID]; ok {
+		return ErrConflict
+	}
+	for _, c := range m.s.referralCodes {
+		if c == code {
+			return ErrConflict
+		}
+	}
+	m.s.referralCodes[userID] = code
+	return nil
+}
+
+func (m *Memory) ReferrerByCode(ctx context.Context, code string) (int64, error) {
+	defer m.lock()()
+	for id, c := range m.s.referralCodes {
+		if c == code {
+			if u, ok := m.s.users[id]; ok && !u.deleted {
+				return id, nil
+			}
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (m *Memory) CreateReferralClick(ctx context.Context, referrerID int64, token string) error {
+	defer m.lock()()
+	m.s.referralClicks[token] = ReferralClick{
+		ID: m.s.next("referral_clicks"), ReferrerID: referrerID, Token: token, CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (m *Memory) GetReferralClick(ctx context.Context, token string) (ReferralClick, error) {
+	defer m.lock()()
+	c, ok := m.s.referralClicks[token]
+	if !ok {
+		return ReferralClick{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (m *Memory) ClaimReferralClick(ctx context.Context, token string, referredID int64, since time.Time) (ReferralClick, error) {
+	defer m.lock()()
+	c, ok := m.s.referralClicks[token]
+	if !ok || c.SignedUpAt != nil || c.CreatedAt.Before(since) {
+		return ReferralClick{}, ErrNotFound
+	}
+	now := time.Now()
+	c.ReferredID, c.SignedUpAt = &referredID, &now
+	m.s.referralClicks[token] = c
+	return c, nil
+}
+
+func (m *Memory) ReferralFunnels(ctx context.Context, from, to time.Time, limit int) ([]ReferralFunnel, error) {
+	defer m.lock()()
+	byReferrer := map[int64]*ReferralFunnel{}
+	m.s.referralFunnels(from, to, func(c ReferralClick) *ReferralFunnel {
+		f := byReferrer[c.ReferrerID]
+		if f == nil {
+			f = &ReferralFunnel{ReferrerID: c.ReferrerID, Username: m.s.users[c.ReferrerID].Username}
+			byReferrer[c.ReferrerID] = f
+		}
+		return f
+	})
+	out := make([]ReferralFunnel, 0, len(byReferrer))
+	for _, f := range byReferrer {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Signups != b.Signups {
+			return a.Signups > b.Signups
+		}
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		return a.ReferrerID < b.ReferrerID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *Memory) ReferralFunnelTotals(ctx context.Context, from, to time.Time) (ReferralFunnel, error) {
+	defer m.lock()()
+	var total ReferralFunnel
+	m.s.referralFunnels(from, to, func(ReferralClick) *ReferralFunnel { return &total })
+	return total, nil
+}
+
+// referralFunnels counts each click made in [from, to) into the funnel
+// into returns for it.
+func (s *memState) referralFunnels(from, to time.Time, into func(ReferralClick) *ReferralFunnel) {
+	completed := map[int64]bool{}
+	for k, times := range s.userTasks {
+		if len(times) > 0 {
+			completed[k.userID] = true
+		}
+	}
+	for _, c := range s.referralClicks {
+		if c.CreatedAt.Before(from) || !c.CreatedAt.Before(to) {
+			continue
+		}
+		f := into(c)
+		f.Clicks++
+		if c.ReferredID != nil {
+			f.Signups++
+			if completed[*c.ReferredID] {
+				f.FirstTasks++
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+func (m *Memory) ReportDays(ctx context.Context, from, to time.Time) ([]ReportDay, error) {
+	defer m.lock()()
+	return m.s.report(from, to, func(t time.Time) string { return t.UTC().Format(time.DateOnly) }).sorted(), nil
+}
+
+func (m *Memory) ReportTotals(ctx context.Context, from, to time.Time) (ReportCounts, error) {
+	defer m.lock()()
+	return m.s.report(from, to, func(time.Time) string { return "" }).total(), nil
+}
+
+// report is reportSQL over the maps; day buckets times.
+func (s *memState) report(from, to time.Time, day func(time.Time) string) reportDays {
+	days := reportDays{}
+	in := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+	active := map[string]map[int64]bool{}
+	activeAt := func(t time.Time, userID int64) {
+		d := day(t)
+		if active[d] == nil {
+			active[d] = map[int64]bool{}
+		}
+		active[d][userID] = true
+	}
+	for k, times := range s.userTasks {
+		for _, at := range times {
+			if in(at) {
+				days.add(day(at), "tasks_completed", 1)
+				activeAt(at, k.userID)
+			}
+		}
+	}
+	for _, t := range s.transfers {
+		if in(t.CreatedAt) {
+			activeAt(t.CreatedAt, t.FromUserID)
+		}
+	}
+	for _, r := range s.referrals {
+		if in(r.CreatedAt) {
+			days.add(day(r.CreatedAt), "referrals", 1)
+			activeAt(r.CreatedAt, r.ReferredID)
+		}
+	}
+	for d, users := range active {
+		days.add(d, "active_users", int64(len(users)))
+	}
+	for _, u := range s.users {
+		if in(u.CreatedAt) {
+			days.add(day(u.CreatedAt), "new_users", 1)
+			if u.ReferrerID != nil {
+				days.add(day(u.CreatedAt), "referred_new_users", 1)
+			}
+		}
+	}
+	for _, e := range s.ledger {
+		if !in(e.recordedAt) || strings.HasPrefix(e.Reason, "transfer:") || e.Reason == "opening_balance" {
+			continue
+		}
+		if e.Amount > 0 {
+			days.add(day(e.recordedAt), "points_issued", e.Amount)
+		} else if e.Amount < 0 {
+			days.add(day(e.recordedAt), "points_revoked", -e.Amount)
+		}
+	}
+	return days
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+func (m *Memory) RevokeAccessToken(ctx context.Context, t RevokedToken) error {
+	defer m.lock()()
+	if _, ok := m.s.revokedTokens[t.JTI]; !ok {
+		t.RevokedAt = time.Now()
+		m.s.revokedTokens[t.JTI] = t
+	}
+	return nil
+}
+
+func (m *Memory) RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error {
+	defer m.lock()()
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrNotFound
+	}
+	if before.After(m.s.tokenCutoffs[userID]) {
+		m.s.tokenCutoffs[userID] = before
+	}
+	now := time.Now()
+	for hash, t := range m.s.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+			m.s.tokens[hash] = t
+		}
+	}
+	return nil
+}
+
+func (m *Memory) TokenRevocations(ctx context.Context, now time.Time) (TokenRevocations, error) {
+	defer m.lock()()
+	out := TokenRevocations{JTIs: map[string]time.Time{}, Users: maps.Clone(m.s.tokenCutoffs)}
+	for jti, t := range m.s.revokedTokens {
+		if !t.ExpiresAt.Before(now) {
+			out.JTIs[jti] = t.ExpiresAt
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) PurgeRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	defer m.lock()()
+	var n int64
+	for jti, t := range m.s.revokedTokens {
+		if t.ExpiresAt.Before(now) {
+			delete(m.s.revokedTokens, jti)
+			n++
+		}
+	}
+	return n, nil
+}
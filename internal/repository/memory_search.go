@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+)
+
+func (m *Memory) FindUsers(ctx context.Context, q UserQuery) ([]UserMatch, error) {
+	defer m.lock()()
+	var candidates []UserMatch
+	for _, u := range m.s.users {
+		if u.deleted || q.PublicOnly && u.settings.LeaderboardVisibility != VisibilityPublic {
+			continue
+		}
+		candidates = append(candidates, UserMatch{ID: u.ID, Username: u.Username})
+	}
+	return matchUsers(q, candidates), nil
+}
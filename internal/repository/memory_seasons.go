@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type seasonKey struct{ seasonID, userID int64 }
+
+// runningSeason is the unarchived season whose window holds now.
+func (s *memState) runningSeason(now time.Time) (Season, bool) {
+	for _, se := range s.seasons {
+		if se.ArchivedAt == nil && !now.Before(se.StartsAt) && now.Before(se.EndsAt) {
+			return se, true
+		}
+	}
+	return Season{}, false
+}
+
+func (s *memState) seasonOverlaps(startsAt, endsAt time.Time, except int64) bool {
+	for id, se := range s.seasons {
+		if id != except && se.StartsAt.Before(endsAt) && se.EndsAt.After(startsAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memState) season(id int64) (Season, bool) {
+	se, ok := s.seasons[id]
+	se.setStatus(time.Now())
+	return se, ok
+}
+
+func (m *Memory) CreateSeason(ctx context.Context, name string, startsAt, endsAt time.Time) (Season, error) {
+	defer m.lock()()
+	if m.s.seasonOverlaps(startsAt, endsAt, 0) {
+		return Season{}, ErrConflict
+	}
+	se := Season{ID: m.s.next("seasons"), Name: name, StartsAt: startsAt, EndsAt: endsAt, CreatedAt: time.Now()}
+	m.s.seasons[se.ID] = se
+	se, _ = m.s.season(se.ID)
+	return se, nil
+}
+
+func (m *Memory) GetSeason(ctx context.Context, id int64) (Season, error) {
+	defer m.lock()()
+	se, ok := m.s.season(id)
+	if !ok {
+		return Season{}, ErrNotFound
+	}
+	return se, nil
+}
+
+func (m *Memory) ListSeasons(ctx context.Context) ([]Season, error) {
+	defer m.lock()()
+	out := []Season{}
+	for id := range m.s.seasons {
+		se, _ := m.s.season(id)
+		out = append(out, se)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartsAt.Equal(out[j].StartsAt) {
+			return out[i].StartsAt.After(out[j].StartsAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (m *Memory) UpdateSeason(ctx context.Context, id int64, name string, startsAt, endsAt time.Time) error {
+	defer m.lock()()
+	se, ok := m.s.seasons[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if m.s.seasonOverlaps(startsAt, endsAt, id) {
+		return ErrConflict
+	}
+	se.Name, se.StartsAt, se.EndsAt = name, startsAt, endsAt
+	m.s.seasons[id] = se
+	return nil
+}
+
+func (m *Memory) DeleteSeason(ctx context.Context, id int64) error {
+	defer m.lock()()
+	if _, ok := m.s.seasons[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.seasons, id)
+	delete(m.s.standings, id)
+	for k := range m.s.seasonPts {
+		if k.seasonID == id {
+			delete(m.s.seasonPts, k)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) EndedSeasons(ctx context.Context) ([]Season, error) {
+	defer m.lock()()
+	var out []Season
+	for id := range m.s.seasons {
+		if se, _ := m.s.season(id); se.Status == SeasonEnded {
+			out = append(out, se)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].EndsAt.Before(out[j].EndsAt) })
+	return out, nil
+}
+
+// seasonBoard is the running leaderboard of a season, like visibleBoard.
+func (s *memState) seasonBoard(id int64) []LeaderboardEntry {
+	var rows []LeaderboardEntry
+	for k, pts := range s.seasonPts {
+		u := s.users[k.userID]
+		if k.seasonID != id || u.deleted || u.settings.LeaderboardVisibility == VisibilityHidden {
+			continue
+		}
+		rows = append(rows, LeaderboardEntry{ID: k.userID, Username: u.Username, Points: pts,
+			Anonymous: u.settings.LeaderboardVisibility == VisibilityAnonymous})
+	}
+	sort.Slice(rows, func(i, j int) bool { return ranksAbove(rows[i], rows[j].Points, rows[j].ID) })
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+	return rows
+}
+
+func (m *Memory) ArchiveSeason(ctx context.Context, id int64) error {
+	defer m.lock()()
+	se, ok := m.s.seasons[id]
+	if !ok || se.ArchivedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	se.ArchivedAt = &now
+	m.s.seasons[id] = se
+	var results []LeaderboardEntry
+	for _, e := range m.s.seasonBoard(id) {
+		results = append(results, LeaderboardEntry{ID: e.ID, Points: e.Points, Rank: e.Rank})
+	}
+	m.s.standings[id] = results
+	for k := range m.s.seasonPts {
+		if k.seasonID == id {
+			delete(m.s.seasonPts, k)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SeasonLeaderboard(ctx context.Context, id int64, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	defer m.lock()()
+	se, ok := m.s.seasons[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var rows []LeaderboardEntry
+	if se.ArchivedAt == nil {
+		rows = m.s.seasonBoard(id)
+	} else {
+		for _, r := range m.s.standings[id] {
+			u := m.s.users[r.ID]
+			r.Username = u.Username
+			r.Anonymous = u.deleted || u.settings.LeaderboardVisibility != VisibilityPublic
+			rows = append(rows, r)
+		}
+	}
+	start := 0
+	if after != nil {
+		for start < len(rows) && (ranksAbove(rows[start], after.Points, after.ID) || rows[start].ID == after.ID && rows[start].Points == after.Points) {
+			start++
+		}
+	}
+	var items []LeaderboardEntry
+	for i := start; i < len(rows) && len(items) < limit; i++ {
+		items = append(items, rows[i])
+	}
+	return items, nil
+}
+
+func (m *Memory) SeasonUsers(ctx context.Context, id int64) (int64, error) {
+	defer m.lock()()
+	n := int64(len(m.s.standings[id]))
+	for k := range m.s.seasonPts {
+		if k.seasonID == id && !m.s.users[k.userID].deleted {
+			n++
+		}
+	}
+	return n, nil
+}
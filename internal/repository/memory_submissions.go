@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+func (m *Memory) CreateSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error) {
+	defer m.lock()()
+	for _, other := range m.s.submissions {
+		if other.UserID == sub.UserID && other.TaskCode == sub.TaskCode && other.Status == SubmissionPending {
+			return TaskSubmission{}, ErrConflict
+		}
+	}
+	sub = TaskSubmission{
+		ID:        m.s.next("task_submissions"),
+		UserID:    sub.UserID,
+		TaskCode:  sub.TaskCode,
+		Proof:     sub.Proof,
+		Status:    SubmissionPending,
+		CreatedAt: time.Now(),
+	}
+	m.s.submissions[sub.ID] = sub
+	return sub, nil
+}
+
+func (m *Memory) GetSubmission(ctx context.Context, id int64) (TaskSubmission, error) {
+	defer m.lock()()
+	sub, ok := m.s.submissions[id]
+	if !ok {
+		return TaskSubmission{}, ErrNotFound
+	}
+	return sub, nil
+}
+
+func (m *Memory) ListSubmissions(ctx context.Context, f SubmissionFilter) ([]TaskSubmission, error) {
+	defer m.lock()()
+	out := []TaskSubmission{}
+	for _, sub := range m.s.submissions {
+		if (f.UserID == 0 || sub.UserID == f.UserID) && (f.TaskCode == "" || sub.TaskCode == f.TaskCode) &&
+			(f.Status == "" || sub.Status == f.Status) && sub.ID > f.AfterID {
+			out = append(out, sub)
+		}
+	}
+	slices.SortFunc(out, func(a, b TaskSubmission) int { return int(a.ID - b.ID) })
+	return out[:min(len(out), f.Limit)], nil
+}
+
+func (m *Memory) ReviewSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error) {
+	defer m.lock()()
+	cur, ok := m.s.submissions[sub.ID]
+	if !ok || cur.Status != SubmissionPending {
+		return TaskSubmission{}, ErrConflict
+	}
+	now := time.Now()
+	cur.Status, cur.Reason, cur.Awarded, cur.ReviewedBy, cur.ReviewedAt = sub.Status, sub.Reason, sub.Awarded, sub.ReviewedBy, &now
+	m.s.submissions[sub.ID] = cur
+	return cur, nil
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+type memTeamMember struct {
+	teamID   int64
+	joinedAt time.Time
+}
+
+func (s *memState) team(id int64) Team {
+	t := s.teams[id]
+	for _, m := range s.teamMembers {
+		if m.teamID == id {
+			t.Members++
+		}
+	}
+	return t
+}
+
+func (s *memState) teamNameTaken(name string, except int64) bool {
+	for id, t := range s.teams {
+		if id != except && strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateTeam(ctx context.Context, name string) (Team, error) {
+	defer m.lock()()
+	if m.s.teamNameTaken(name, 0) {
+		return Team{}, ErrConflict
+	}
+	t := Team{ID: m.s.next("teams"), Name: name, CreatedAt: time.Now()}
+	m.s.teams[t.ID] = t
+	return t, nil
+}
+
+func (m *Memory) GetTeam(ctx context.Context, id int64) (Team, error) {
+	defer m.lock()()
+	if _, ok := m.s.teams[id]; !ok {
+		return Team{}, ErrNotFound
+	}
+	return m.s.team(id), nil
+}
+
+func (m *Memory) RenameTeam(ctx context.Context, id int64, name string) error {
+	defer m.lock()()
+	t, ok := m.s.teams[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if m.s.teamNameTaken(name, id) {
+		return ErrConflict
+	}
+	t.Name = name
+	m.s.teams[id] = t
+	return nil
+}
+
+func (m *Memory) DeleteTeam(ctx context.Context, id int64) error {
+	defer m.lock()()
+	if _, ok := m.s.teams[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.teams, id)
+	for userID, tm := range m.s.teamMembers {
+		if tm.teamID == id {
+			delete(m.s.teamMembers, userID)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) TeamMembers(ctx context.Context, id int64) ([]TeamMember, error) {
+	defer m.lock()()
+	out := []TeamMember{}
+	for userID, tm := range m.s.teamMembers {
+		if tm.teamID != id {
+			continue
+		}
+		u := m.s.users[userID]
+		out = append(out, TeamMember{UserID: userID, Username: u.Username, JoinedAt: tm.joinedAt,
+			Anonymous: u.settings.LeaderboardVisibility != VisibilityPublic})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].JoinedAt.Equal(out[j].JoinedAt) {
+			return out[i].JoinedAt.Before(out[j].JoinedAt)
+		}
+		return out[i].UserID < out[j].UserID
+	})
+	return out, nil
+}
+
+func (m *Memory) UserTeam(ctx context.Context, userID int64) (int64, error) {
+	defer m.lock()()
+	tm, ok := m.s.teamMembers[userID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return tm.teamID, nil
+}
+
+func (m *Memory) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	defer m.lock()()
+	if _, ok := m.s.teams[teamID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := m.s.teamMembers[userID]; ok {
+		return ErrConflict
+	}
+	m.s.teamMembers[userID] = memTeamMember{teamID: teamID, joinedAt: time.Now()}
+	return nil
+}
+
+func (m *Memory) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	defer m.lock()()
+	tm, ok := m.s.teamMembers[userID]
+	if !ok || tm.teamID != teamID {
+		return ErrNotFound
+	}
+	delete(m.s.teamMembers, userID)
+	return nil
+}
+
+func (m *Memory) TeamLeaderboard(ctx context.Context, limit int, after *LeaderboardCursor) ([]TeamEntry, error) {
+	defer m.lock()()
+	rows := make([]TeamEntry, 0, len(m.s.teams))
+	for id := range m.s.teams {
+		t := m.s.team(id)
+		rows = append(rows, TeamEntry{ID: t.ID, Name: t.Name, Points: t.Points, Members: t.Members})
+	}
+	above := func(e TeamEntry, points, id int64) bool {
+		return e.Points > points || e.Points == points && e.ID < id
+	}
+	sort.Slice(rows, func(i, j int) bool { return above(rows[i], rows[j].Points, rows[j].ID) })
+	start := 0
+	if after != nil {
+		for start < len(rows) && (above(rows[start], after.Points, after.ID) || rows[start].ID == after.ID && rows[start].Points == after.Points) {
+			start++
+		}
+	}
+	var items []TeamEntry
+	for i := start; i < len(rows) && len(items) < limit; i++ {
+		e := rows[i]
+		e.Rank = i + 1
+		items = append(items, e)
+	}
+	return items, nil
+}
+
+func (m *Memory) CountTeams(ctx context.Context) (int64, error) {
+	defer m.lock()()
+	return int64(len(m.s.teams)), nil
+}
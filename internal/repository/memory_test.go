@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryInTxRollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("local")
+	fail := errors.New("fail")
+	var id int64
+	err := m.InTx(ctx, func(q Queries) error {
+		u, err := q.CreateUser(ctx, "alice", "", "")
+		if err != nil {
+			return err
+		}
+		id = u.ID
+		if err := q.Accrue(ctx, u.ID, 10, "test"); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Fatalf("InTx = %v, want fn's error", err)
+	}
+	if _, err := m.GetUser(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("user survived the rollback: %v", err)
+	}
+	// the username is free again
+	if _, err := m.CreateUser(ctx, "alice", "", ""); err != nil {
+		t.Errorf("create after rollback: %v", err)
+	}
+}
+
+func TestMemoryInTxCommits(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("local")
+	var id int64
+	err := m.InTx(ctx, func(q Queries) error {
+		u, err := q.CreateUser(ctx, "alice", "", "")
+		id = u.ID
+		if err != nil {
+			return err
+		}
+		return q.Accrue(ctx, u.ID, 10, "test")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := m.GetUser(ctx, id)
+	if err != nil || u.Points != 10 {
+		t.Errorf("user = %+v, %v; want 10 points", u, err)
+	}
+}
+
+func TestMemoryCreateUserConflict(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("local")
+	if _, err := m.CreateUser(ctx, "alice", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateUser(ctx, "alice", "", ""); !errors.Is(err, ErrConflict) {
+		t.Errorf("second create = %v, want ErrConflict", err)
+	}
+}
+
+func TestMemoryAccrueRefusesNegativeBalance(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("local")
+	u, err := m.CreateUser(ctx, "alice", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Accrue(ctx, u.ID, 5, "credit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Accrue(ctx, u.ID, -6, "debit"); !errors.Is(err, ErrNegativeBalance) {
+		t.Fatalf("overdraw = %v, want ErrNegativeBalance", err)
+	}
+	if err := m.Accrue(ctx, 999, 5, "credit"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown user = %v, want ErrNotFound", err)
+	}
+	entries, err := m.ListTransactions(ctx, u.ID, 1<<62, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Amount != 5 {
+		t.Errorf("ledger = %+v, want the credit only", entries)
+	}
+}
+
+func TestMemoryAddUserTaskPerUserLimit(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("local")
+	u, err := m.CreateUser(ctx, "alice", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, true, false} {
+		ok, err := m.AddUserTask(ctx, u.ID, "daily_checkin", 2)
+		if err != nil || ok != want {
+			t.Errorf("completion %d = %v, %v; want %v", i+1, ok, err, want)
+		}
+	}
+	if n, err := m.CountUserTask(ctx, u.ID, "daily_checkin"); err != nil || n != 2 {
+		t.Errorf("count = %d, %v; want 2", n, err)
+	}
+}
+
+func TestMemoryOutboxClaimsUntilPublished(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("local")
+	if err := m.AddOutboxEvent(ctx, OutboxEvent{EventID: "e1", Type: "test", Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := m.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].EventID != "e1" {
+		t.Fatalf("claim = %+v, %v; want e1", claimed, err)
+	}
+	// leased to the first claimer
+	if again, _ := m.ClaimOutboxEvents(ctx, 10, time.Minute); len(again) != 0 {
+		t.Errorf("claimed again within the lease: %+v", again)
+	}
+	if err := m.MarkOutboxPublished(ctx, claimed[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := m.ClaimOutboxEvents(ctx, 10, 0); len(again) != 0 {
+		t.Errorf("claimed after publishing: %+v", again)
+	}
+}
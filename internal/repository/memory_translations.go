@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+type translationKey struct {
+	code   string
+	locale string
+}
+
+func (m *Memory) TaskTranslations(ctx context.Context, code string) ([]TaskTranslation, error) {
+	defer m.lock()()
+	out := []TaskTranslation{}
+	for k, t := range m.s.translations {
+		if k.code == code {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Locale < out[j].Locale })
+	return out, nil
+}
+
+func (m *Memory) TranslationsIn(ctx context.Context, locales []string) ([]TaskTranslation, error) {
+	defer m.lock()()
+	out := []TaskTranslation{}
+	for k, t := range m.s.translations {
+		if slices.Contains(locales, k.locale) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) SetTaskTranslation(ctx context.Context, t TaskTranslation) (TaskTranslation, error) {
+	defer m.lock()()
+	if _, ok := m.s.tasks[t.TaskCode]; !ok {
+		return TaskTranslation{}, ErrNotFound
+	}
+	t.UpdatedAt = time.Now()
+	m.s.translations[translationKey{t.TaskCode, t.Locale}] = t
+	return t, nil
+}
+
+func (m *Memory) DeleteTaskTranslation(ctx context.Context, code, locale string) error {
+	defer m.lock()()
+	k := translationKey{code, locale}
+	if _, ok := m.s.translations[k]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.translations, k)
+	return nil
+}
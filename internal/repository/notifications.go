@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const notificationColumns = `id, user_id, event_id, kind, title, body, data, created_at, read_at`
+
+func scanNotification(sc interface{ Scan(...any) error }) (Notification, error) {
+	var (
+		n    Notification
+		data []byte
+	)
+	err := sc.Scan(&n.ID, &n.UserID, &n.EventID, &n.Kind, &n.Title, &n.Body, &data, &n.CreatedAt, &n.ReadAt)
+	n.Data = json.RawMessage(data)
+	return n, err
+}
+
+func scanNotifications(rows *sql.Rows, err error) ([]Notification, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func scanChannelSettings(rows *sql.Rows, err error) ([]ChannelSetting, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ChannelSetting{}
+	for rows.Next() {
+		var c ChannelSetting
+		if err := rows.Scan(&c.Channel, &c.Address, &c.Enabled, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func scanPendingNotifications(rows *sql.Rows, err error) ([]PendingNotification, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []PendingNotification{}
+	for rows.Next() {
+		var (
+			p    PendingNotification
+			n    = &p.Notification
+			data []byte
+		)
+		if err := rows.Scan(&p.ID, &p.Channel, &p.Address, &p.Attempts,
+			&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &data, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Data = json.RawMessage(data)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func deliveryStatus(a NotificationAttempt) string {
+	switch {
+	case a.Sent:
+		return "sent"
+	case a.RetryIn <= 0:
+		return "failed"
+	}
+	return "pending"
+}
+
+func (p *Postgres) AddNotification(ctx context.Context, n Notification) (bool, error) {
+	var id int64
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO notifications (user_id, event_id, kind, title, body, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, event_id, kind) DO NOTHING
+		RETURNING id
+	`, n.UserID, n.EventID, n.Kind, n.Title, n.Body, []byte(n.Data)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if isForeignKeyViolation(err) {
+		// the user is gone
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = p.q.ExecContext(ctx, `
+		INSERT INTO notification_deliveries (notification_id, channel, address)
+		SELECT $1, channel, address FROM notification_channels WHERE user_id=$2 AND enabled
+	`, id, n.UserID)
+	return err == nil, err
+}
+
+func (p *Postgres) ListNotifications(ctx context.Context, userID int64, unreadOnly bool, before int64, limit int) ([]Notification, error) {
+	return scanNotifications(p.q.QueryContext(ctx, `
+		SELECT `+notificationColumns+` FROM notifications
+		WHERE user_id=$1 AND (NOT $2 OR read_at IS NULL) AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4
+	`, userID, unreadOnly, before, limit))
+}
+
+func (p *Postgres) CountUnreadNotifications(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT count(*) FROM notifications WHERE user_id=$1 AND read_at IS NULL
+	`, userID).Scan(&n)
+	return n, err
+}
+
+func (p *Postgres) MarkNotificationsRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE notifications SET read_at=now()
+		WHERE user_id=$1 AND read_at IS NULL AND ($2::bigint[] IS NULL OR id = ANY($2))
+	`, userID, ids)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *Postgres) ListChannelSettings(ctx context.Context, userID int64) ([]ChannelSetting, error) {
+	return scanChannelSettings(p.q.QueryContext(ctx, `
+		SELECT channel, address, enabled, updated_at FROM notification_channels WHERE user_id=$1 ORDER BY channel
+	`, userID))
+}
+
+func (p *Postgres) SetChannelSetting(ctx context.Context, userID int64, c ChannelSetting) (ChannelSetting, error) {
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO notification_channels (user_id, channel, address, enabled, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (user_id, channel) DO UPDATE
+		SET address = EXCLUDED.address, enabled = EXCLUDED.enabled, updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, userID, c.Channel, c.Address, c.Enabled).Scan(&c.UpdatedAt)
+	return c, err
+}
+
+func (p *Postgres) DeleteChannelSetting(ctx context.Context, userID int64, channel string) error {
+	res, err := p.q.ExecContext(ctx, `
+		DELETE FROM notification_channels WHERE user_id=$1 AND ($2 = '' OR channel = $2)
+	`, userID, channel)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) ClaimNotificationDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingNotification, error) {
+	return scanPendingNotifications(p.q.QueryContext(ctx, `
+		UPDATE notification_deliveries d
+		SET next_attempt_at = now() + $2 * interval '1 millisecond'
+		FROM notifications n
+		WHERE n.id = d.notification_id AND d.id IN (
+			SELECT id FROM notification_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.channel, d.address, d.attempts, n.id, n.user_id, n.kind, n.title, n.body, n.data, n.created_at
+	`, limit, lease.Milliseconds()))
+}
+
+func (p *Postgres) RecordNotificationAttempt(ctx context.Context, id int64, a NotificationAttempt) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE notification_deliveries
+		SET status = $2, attempts = attempts + 1, last_error = $3,
+		    next_attempt_at = now() + $4 * interval '1 millisecond',
+		    sent_at = CASE WHEN $2 = 'sent' THEN now() END
+		WHERE id = $1
+	`, id, deliveryStatus(a), a.Error, a.RetryIn.Milliseconds())
+	return err
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (p *Postgres) AddOutboxEvent(ctx context.Context, e OutboxEvent) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO outbox_events (event_id, type, data, created_at) VALUES ($1, $2, $3::jsonb, $4)
+	`, e.EventID, e.Type, string(e.Data), e.CreatedAt)
+	return err
+}
+
+func (p *Postgres) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		UPDATE outbox_events
+		SET next_attempt_at = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE published_at IS NULL AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_id, type, data, created_at, attempts
+	`, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []OutboxEvent{}
+	for rows.Next() {
+		var (
+			e    OutboxEvent
+			data []byte
+		)
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Type, &data, &e.CreatedAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Data = data
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) MarkOutboxPublished(ctx context.Context, id int64) error {
+	_, err := p.q.ExecContext(ctx, `UPDATE outbox_events SET published_at = now() WHERE id = $1`, id)
+	return err
+}
+
+func (p *Postgres) MarkOutboxFailed(ctx context.Context, id int64, errMsg string, retryIn time.Duration) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $2, next_attempt_at = now() + $3 * interval '1 millisecond'
+		WHERE id = $1
+	`, id, errMsg, retryIn.Milliseconds())
+	return err
+}
@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (p *Postgres) Accrue(ctx context.Context, userID, amount int64, reason string) error {
+	// the update locks the user's row until the transaction ends, so the
+	// next writer sees this entry's seq
+	var balance, seq int64
+	err := p.q.QueryRowContext(ctx, `
+		UPDATE users SET points = points + $1, points_seq = points_seq + 1, version = version + 1 WHERE id=$2
+		RETURNING points, points_seq
+	`, amount, userID).Scan(&balance, &seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return negativeBalance(err)
+	}
+	_, err = p.q.ExecContext(ctx, `
+		INSERT INTO point_transactions (origin_region, user_id, amount, reason, user_seq, balance, applied_at)
+		VALUES ($1, $2, $3, $4, $5, $6, clock_timestamp())
+	`, p.region, userID, amount, reason, seq, balance)
+	return err
+}
+
+func (p *Postgres) BalanceAt(ctx context.Context, userID int64, at time.Time) (LedgerEntry, error) {
+	var e LedgerEntry
+	err := p.q.QueryRowContext(ctx, `
+		SELECT id, user_seq, amount, balance, reason, origin_region, applied_at
+		FROM point_transactions
+		WHERE user_id=$1 AND applied_at <= $2
+		ORDER BY user_seq DESC
+		LIMIT 1
+	`, userID, at).Scan(&e.ID, &e.Seq, &e.Amount, &e.Balance, &e.Reason, &e.Region, &e.CreatedAt)
+	return e, notFound(err)
+}
+
+func (p *Postgres) ListTransactions(ctx context.Context, userID, before int64, limit int) ([]LedgerEntry, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT id, user_seq, amount, balance, reason, origin_region, applied_at
+		FROM point_transactions
+		WHERE user_id=$1 AND id < $2
+		ORDER BY id DESC
+		LIMIT $3
+	`, userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.Seq, &e.Amount, &e.Balance, &e.Reason, &e.Region, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) LedgerByReason(ctx context.Context, userID int64, reasons []string) ([]LedgerEntry, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT id, user_seq, amount, balance, reason, origin_region, applied_at
+		FROM point_transactions
+		WHERE user_id=$1 AND reason = ANY($2)
+		ORDER BY user_seq
+	`, userID, reasons)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.Seq, &e.Amount, &e.Balance, &e.Reason, &e.Region, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) CountTransactions(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := p.q.QueryRowContext(ctx, `SELECT count(*) FROM point_transactions WHERE user_id=$1`, userID).Scan(&n)
+	return n, err
+}
+
+// leaderboardRows selects the (id, username, points, visibility) set for a
+// period, hidden users included. $1 is always the period so callers can
+// number the rest from $2.
+func leaderboardRows(period string) string {
+	if period == "all" {
+		return `SELECT id, username, points, leaderboard_visibility AS visibility
+			FROM users WHERE $1::text = 'all' AND deleted_at IS NULL`
+	}
+	return `
+		SELECT u.id, u.username, pp.points, u.leaderboard_visibility AS visibility
+		FROM user_period_points pp JOIN users u ON u.id = pp.user_id
+		WHERE pp.period = $1 AND pp.period_start = date_trunc($1, now()) AND u.deleted_at IS NULL`
+}
+
+func (p *Postgres) Leaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	return p.leaderboard(ctx, leaderboardRows(period), period, limit, after)
+}
+
+// leaderboard pages src, a query for id, username, points and visibility
+// that takes key as $1, leaving out hidden users.
+func (p *Postgres) leaderboard(ctx context.Context, src string, key any, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	var (
+		rows *sql.Rows
+		err  error
+		rank int
+	)
+	if after == nil {
+		rows, err = p.q.QueryContext(ctx, `
+			SELECT id, username, points, visibility = 'anonymous' FROM (`+src+`) b
+			WHERE visibility <> 'hidden'
+			ORDER BY points DESC, id ASC
+			LIMIT $2
+		`, key, limit)
+	} else {
+		// everyone up to and including the cursor row ranks above this page
+		if err := p.q.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM (`+src+`) b
+			WHERE visibility <> 'hidden' AND (points > $2 OR (points = $2 AND id <= $3))
+		`, key, after.Points, after.ID).Scan(&rank); err != nil {
+			return nil, err
+		}
+		rows, err = p.q.QueryContext(ctx, `
+			SELECT id, username, points, visibility = 'anonymous' FROM (`+src+`) b
+			WHERE visibility <> 'hidden' AND (points < $2 OR (points = $2 AND id > $3))
+			ORDER BY points DESC, id ASC
+			LIMIT $4
+		`, key, after.Points, after.ID, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LeaderboardEntry
+	for rows.Next() {
+		var it LeaderboardEntry
+		if err := rows.Scan(&it.ID, &it.Username, &it.Points, &it.Anonymous); err != nil {
+			return nil, err
+		}
+		rank++
+		it.Rank = rank
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) FriendsLeaderboard(ctx context.Context, userID int64, period string) ([]LeaderboardEntry, error) {
+	points, window, cond := "u.points", "", "AND $2::text = 'all'"
+	if period != "all" {
+		points, cond = "COALESCE(pp.points, 0)", ""
+		window = `LEFT JOIN user_period_points pp
+			ON pp.user_id = u.id AND pp.period = $2 AND pp.period_start = date_trunc($2, now())`
+	}
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT u.id, u.username, `+points+` AS points, u.leaderboard_visibility = 'anonymous'
+		FROM users u `+window+`
+		WHERE u.deleted_at IS NULL `+cond+`
+		  AND (u.id = $1 OR u.referrer_id = $1 OR u.id = (SELECT referrer_id FROM users WHERE id = $1))
+		  AND (u.leaderboard_visibility <> 'hidden' OR u.id = $1)
+		ORDER BY points DESC, u.id ASC
+	`, userID, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LeaderboardEntry
+	for rows.Next() {
+		it := LeaderboardEntry{Rank: len(items) + 1}
+		if err := rows.Scan(&it.ID, &it.Username, &it.Points, &it.Anonymous); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) Rank(ctx context.Context, period string, userID, points int64) (int, *LeaderboardEntry, error) {
+	src := leaderboardRows(period)
+	var above int
+	if err := p.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM (`+src+`) b
+		WHERE visibility <> 'hidden' AND (points > $2 OR (points = $2 AND id < $3))
+	`, period, points, userID).Scan(&above); err != nil {
+		return 0, nil, err
+	}
+	if above == 0 {
+		return 1, nil, nil
+	}
+
+	next := LeaderboardEntry{Rank: above}
+	err := p.q.QueryRowContext(ctx, `
+		SELECT id, username, points, visibility = 'anonymous' FROM (`+src+`) b
+		WHERE visibility <> 'hidden' AND (points > $2 OR (points = $2 AND id < $3))
+		ORDER BY points ASC, id DESC
+		LIMIT 1
+	`, period, points, userID).Scan(&next.ID, &next.Username, &next.Points, &next.Anonymous)
+	if err != nil {
+		return 0, nil, err
+	}
+	return above + 1, &next, nil
+}
+
+func (p *Postgres) TotalUsers(ctx context.Context) (int64, error) {
+	var total int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(users), 0) FROM points_distribution WHERE period='all'
+	`).Scan(&total)
+	return total, err
+}
+
+func (p *Postgres) PeriodUsers(ctx context.Context, period string) (int64, error) {
+	var total int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(users), 0) FROM points_distribution
+		WHERE period=$1 AND period_start=date_trunc($1, now())
+	`, period).Scan(&total)
+	return total, err
+}
+
+// PeriodPoints returns what the user earned in the current period window, 0
+// if nothing.
+func (p *Postgres) PeriodPoints(ctx context.Context, userID int64, period string) (int64, error) {
+	var pts int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT points FROM user_period_points
+		WHERE user_id=$1 AND period=$2 AND period_start=date_trunc($2, now())
+	`, userID, period).Scan(&pts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return pts, err
+}
+
+func (p *Postgres) Distribution(ctx context.Context, period string, points int64) (Distribution, error) {
+	window := `period_start = date_trunc($1, now())`
+	if period == "all" {
+		window = `period_start = 'epoch'`
+	}
+	var d Distribution
+	err := p.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(users) FILTER (WHERE points < $2), 0),
+		       COALESCE(SUM(users) FILTER (WHERE points > $2), 0),
+		       COALESCE(SUM(users), 0)
+		FROM points_distribution
+		WHERE period=$1 AND `+window, period, points).Scan(&d.Below, &d.Above, &d.Present)
+	return d, err
+}
+
+func (p *Postgres) PointsHistogram(ctx context.Context, period string) ([]PointsCount, error) {
+	window := `period_start = date_trunc($1, now())`
+	if period == "all" {
+		window = `period_start = 'epoch'`
+	}
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT points, users FROM points_distribution
+		WHERE period=$1 AND `+window+`
+		ORDER BY points
+	`, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PointsCount
+	for rows.Next() {
+		var c PointsCount
+		if err := rows.Scan(&c.Points, &c.Users); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Postgres implements Store on top of database/sql with the pgx driver.
+// Its queries run as prepared statements (see stmts).
+type Postgres struct {
+	db          *sql.DB
+	q           dbtx
+	stmts       stmts
+	region      string
+	lockTimeout time.Duration
+}
+
+// NewPostgres returns a store that tags ledger writes with region and caps
+// lock waits inside transactions at lockTimeout.
+func NewPostgres(db *sql.DB, region string, lockTimeout time.Duration) *Postgres {
+	st := newStmts(db)
+	return &Postgres{db: db, q: st, stmts: st, region: region, lockTimeout: lockTimeout}
+}
+
+// Serializable transactions that lose a conflict are rerun this many times
+// in total, sleeping a jittered, doubling delay from txRetryBase between
+// attempts.
+const (
+	txAttempts  = 5
+	txRetryBase = 10 * time.Millisecond
+)
+
+// InTx runs fn in a serializable transaction, retrying the whole of it when
+// Postgres aborts it with a serialization failure or deadlock, so fn must
+// not keep state from an earlier attempt. The error from the last attempt
+// is returned; IsConflict reports whether contention was the cause.
+func (p *Postgres) InTx(ctx context.Context, fn func(q Queries) error) error {
+	for attempt := 1; ; attempt++ {
+		err := p.tx(ctx, fn)
+		if err == nil || !IsConflict(err) || attempt == txAttempts {
+			return err
+		}
+		wait := txRetryBase << (attempt - 1)
+		wait = wait/2 + rand.N(wait)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tx is one attempt of InTx. statement_timeout and lock_timeout never
+// outlive the context deadline, so a stuck transaction is aborted
+// server-side instead of holding a pooled connection.
+func (p *Postgres) tx(ctx context.Context, fn func(q Queries) error) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if dl, ok := ctx.Deadline(); ok {
+		remaining := time.Until(dl)
+		if remaining <= 0 {
+			return context.DeadlineExceeded
+		}
+		lock := p.lockTimeout
+		if lock <= 0 || lock > remaining {
+			lock = remaining
+		}
+		if _, err := tx.ExecContext(ctx, `
+			SELECT set_config('statement_timeout', $1, true), set_config('lock_timeout', $2, true)
+		`, strconv.FormatInt(remaining.Milliseconds(), 10), strconv.FormatInt(lock.Milliseconds(), 10)); err != nil {
+			return err
+		}
+	}
+
+	st := p.stmts.inTx(tx)
+	if err := fn(&Postgres{db: p.db, q: st, stmts: st, region: p.region, lockTimeout: p.lockTimeout}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsTimeout reports whether err comes from a context deadline, a
+// statement/lock timeout raised by Postgres or a SQLite statement
+// interrupted because its context ended.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || isSQLiteInterrupt(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 57014 query_canceled (statement_timeout), 55P03 lock_not_available (lock_timeout)
+		return pgErr.Code == "57014" || pgErr.Code == "55P03"
+	}
+	return false
+}
+
+// IsUnavailable reports whether err says the database is down or
+// struggling rather than that the statement was wrong: a statement that
+// ran out of time, a lost or refused connection, or Postgres shutting
+// down or out of resources. Lock waits are contention, not this.
+func IsUnavailable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || isSQLiteUnavailable(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 57014 query_canceled, class 08 connection_exception, class 53
+		// insufficient_resources, 57P01-57P03 shutdown and cannot_connect_now
+		c := pgErr.Code
+		return c == "57014" || strings.HasPrefix(c, "08") || strings.HasPrefix(c, "53") || strings.HasPrefix(c, "57P")
+	}
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connErr) || errors.As(err, &netErr)
+}
+
+// IsConflict reports whether err is a serialization failure or deadlock:
+// the transaction lost to a concurrent one and may succeed if rerun.
+func IsConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	// 40001 serialization_failure, 40P01 deadlock_detected
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+// negativeBalance maps the users_points_nonnegative trigger's error to
+// ErrNegativeBalance.
+func negativeBalance(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23514" && pgErr.ConstraintName == "users_points_nonnegative" {
+		return ErrNegativeBalance
+	}
+	return err
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// rankWindow is the start of the period's current window as kept in
+// leaderboard_refreshes; $1 is the period.
+func rankWindow(period string) string {
+	if period == "all" {
+		return `'epoch'::timestamptz`
+	}
+	return `date_trunc($1, now())`
+}
+
+// rankedRows selects leaderboard_ranks rows of period $1 whose users are
+// still on the board, with their current name and visibility.
+const rankedRows = `
+	SELECT r.user_id, u.username, r.points, u.leaderboard_visibility = 'anonymous', r.rank
+	FROM leaderboard_ranks r JOIN users u ON u.id = r.user_id
+	WHERE r.period = $1 AND u.deleted_at IS NULL AND u.leaderboard_visibility <> 'hidden'`
+
+func (p *Postgres) RefreshRanks(ctx context.Context, period string) (int64, error) {
+	src := leaderboardRows(period)
+	res, err := p.q.ExecContext(ctx, `
+		INSERT INTO leaderboard_ranks (period, user_id, rank, points)
+		SELECT $1, id, row_number() OVER (ORDER BY points DESC, id ASC), points
+		FROM (`+src+`) b
+		WHERE visibility <> 'hidden'
+		ON CONFLICT (period, user_id) DO UPDATE SET rank = EXCLUDED.rank, points = EXCLUDED.points
+		WHERE leaderboard_ranks.rank <> EXCLUDED.rank OR leaderboard_ranks.points <> EXCLUDED.points
+	`, period)
+	if err != nil {
+		return 0, err
+	}
+	written, _ := res.RowsAffected()
+	res, err = p.q.ExecContext(ctx, `
+		DELETE FROM leaderboard_ranks r
+		WHERE r.period = $1 AND NOT EXISTS (
+			SELECT 1 FROM (`+src+`) b WHERE b.id = r.user_id AND b.visibility <> 'hidden'
+		)
+	`, period)
+	if err != nil {
+		return 0, err
+	}
+	dropped, _ := res.RowsAffected()
+	_, err = p.q.ExecContext(ctx, `
+		INSERT INTO leaderboard_refreshes (period, period_start, refreshed_at)
+		VALUES ($1, `+rankWindow(period)+`, now())
+		ON CONFLICT (period) DO UPDATE
+		SET period_start = EXCLUDED.period_start, refreshed_at = EXCLUDED.refreshed_at
+	`, period)
+	return written + dropped, err
+}
+
+func (p *Postgres) RankSnapshot(ctx context.Context, period string) (RankSnapshot, error) {
+	snap := RankSnapshot{Period: period}
+	err := p.q.QueryRowContext(ctx, `
+		SELECT period_start, refreshed_at FROM leaderboard_refreshes
+		WHERE period = $1 AND period_start = `+rankWindow(period),
+		period).Scan(&snap.PeriodStart, &snap.RefreshedAt)
+	return snap, notFound(err)
+}
+
+func (p *Postgres) RankedLeaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	q, args := rankedRows, []any{period, limit}
+	if after != nil {
+		q += ` AND (r.points < $3 OR (r.points = $3 AND r.user_id > $4))`
+		args = append(args, after.Points, after.ID)
+	}
+	rows, err := p.q.QueryContext(ctx, q+` ORDER BY r.points DESC, r.user_id ASC LIMIT $2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LeaderboardEntry
+	for rows.Next() {
+		var it LeaderboardEntry
+		if err := rows.Scan(&it.ID, &it.Username, &it.Points, &it.Anonymous, &it.Rank); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) RankedPosition(ctx context.Context, period string, userID int64) (LeaderboardEntry, *LeaderboardEntry, error) {
+	var me LeaderboardEntry
+	err := p.q.QueryRowContext(ctx, rankedRows+` AND r.user_id = $2`, period, userID).
+		Scan(&me.ID, &me.Username, &me.Points, &me.Anonymous, &me.Rank)
+	if err != nil {
+		return me, nil, notFound(err)
+	}
+	var above LeaderboardEntry
+	err = p.q.QueryRowContext(ctx, rankedRows+`
+		AND (r.points > $2 OR (r.points = $2 AND r.user_id < $3))
+		ORDER BY r.points ASC, r.user_id DESC
+		LIMIT 1
+	`, period, me.Points, me.ID).Scan(&above.ID, &above.Username, &above.Points, &above.Anonymous, &above.Rank)
+	if errors.Is(err, sql.ErrNoRows) {
+		return me, nil, nil
+	}
+	if err != nil {
+		return me, nil, err
+	}
+	return me, &above, nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const referralClickColumns = `id, referrer_id, token, created_at, referred_id, signed_up_at`
+
+func scanReferralClick(row *sql.Row) (ReferralClick, error) {
+	var c ReferralClick
+	err := row.Scan(&c.ID, &c.ReferrerID, &c.Token, &c.CreatedAt, &c.ReferredID, &c.SignedUpAt)
+	return c, notFound(err)
+}
+
+// referralFunnelSQL counts clicks made in [{from}, {to}) per referrer; a
+// click's signup made a first task if its user has any completion.
+const referralFunnelSQL = `
+	SELECT c.referrer_id, u.username, COUNT(*), COUNT(c.referred_id),
+		SUM(CASE WHEN EXISTS (SELECT 1 FROM user_tasks t WHERE t.user_id = c.referred_id) THEN 1 ELSE 0 END)
+	FROM referral_clicks c
+	JOIN users u ON u.id = c.referrer_id
+	WHERE c.created_at >= {from} AND c.created_at < {to}
+	GROUP BY c.referrer_id, u.username
+	ORDER BY COUNT(c.referred_id) DESC, COUNT(*) DESC, c.referrer_id
+	LIMIT {limit}
+`
+
+const referralFunnelTotalsSQL = `
+	SELECT COUNT(*), COUNT(c.referred_id),
+		COALESCE(SUM(CASE WHEN EXISTS (SELECT 1 FROM user_tasks t WHERE t.user_id = c.referred_id) THEN 1 ELSE 0 END), 0)
+	FROM referral_clicks c
+	WHERE c.created_at >= {from} AND c.created_at < {to}
+`
+
+// referralFunnelQuery fills in the bind parameters of a funnel query.
+func referralFunnelQuery(query, from, to, limit string) string {
+	return strings.NewReplacer("{from}", from, "{to}", to, "{limit}", limit).Replace(query)
+}
+
+func scanReferralFunnels(rows *sql.Rows) ([]ReferralFunnel, error) {
+	defer rows.Close()
+	var out []ReferralFunnel
+	for rows.Next() {
+		var f ReferralFunnel
+		if err := rows.Scan(&f.ReferrerID, &f.Username, &f.Clicks, &f.Signups, &f.FirstTasks); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) ReferralCode(ctx context.Context, userID int64) (string, error) {
+	var code string
+	err := p.q.QueryRowContext(ctx, `SELECT code FROM referral_codes WHERE user_id=$1`, userID).Scan(&code)
+	return code, notFound(err)
+}
+
+func (p *Postgres) CreateReferralCode(ctx context.Context, userID int64, code string) error {
+	_, err := p.q.ExecContext(ctx, `INSERT INTO referral_codes (user_id, code) VALUES ($1, $2)`, userID, code)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (p *Postgres) ReferrerByCode(ctx context.Context, code string) (int64, error) {
+	var id int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT c.user_id FROM referral_codes c JOIN users u ON u.id = c.user_id
+		WHERE c.code=$1 AND u.deleted_at IS NULL
+	`, code).Scan(&id)
+	return id, notFound(err)
+}
+
+func (p *Postgres) CreateReferralClick(ctx context.Context, referrerID int64, token string) error {
+	_, err := p.q.ExecContext(ctx, `INSERT INTO referral_clicks (referrer_id, token) VALUES ($1, $2)`, referrerID, token)
+	return err
+}
+
+func (p *Postgres) GetReferralClick(ctx context.Context, token string) (ReferralClick, error) {
+	return scanReferralClick(p.q.QueryRowContext(ctx, `
+		SELECT `+referralClickColumns+` FROM referral_clicks WHERE token=$1
+	`, token))
+}
+
+func (p *Postgres) ClaimReferralClick(ctx context.Context, token string, referredID int64, since time.Time) (ReferralClick, error) {
+	return scanReferralClick(p.q.QueryRowContext(ctx, `
+		UPDATE referral_clicks SET referred_id=$2, signed_up_at=now()
+		WHERE token=$1 AND signed_up_at IS NULL AND created_at >= $3
+		RETURNING `+referralClickColumns,
+		token, referredID, since))
+}
+
+func (p *Postgres) ReferralFunnels(ctx context.Context, from, to time.Time, limit int) ([]ReferralFunnel, error) {
+	rows, err := p.q.QueryContext(ctx, referralFunnelQuery(referralFunnelSQL, "$1", "$2", "$3"), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanReferralFunnels(rows)
+}
+
+func (p *Postgres) ReferralFunnelTotals(ctx context.Context, from, to time.Time) (ReferralFunnel, error) {
+	var f ReferralFunnel
+	err := p.q.QueryRowContext(ctx, referralFunnelQuery(referralFunnelTotalsSQL, "$1", "$2", ""), from, to).
+		Scan(&f.Clicks, &f.Signups, &f.FirstTasks)
+	return f, err
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// byOrigin matches the user created in region $1 with id $2 there, in a
+// store whose own region is $3.
+const byOrigin = `((origin_region = $1 AND origin_id = $2) OR ($1 = $3 AND origin_region IS NULL AND id = $2))`
+
+func (p *Postgres) LocalAccruals(ctx context.Context, after int64, lag time.Duration, limit int) ([]Accrual, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT t.origin_seq, COALESCE(u.origin_region, $1), COALESCE(u.origin_id, u.id), t.amount, t.reason, t.recorded_at
+		FROM point_transactions t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.origin_region=$1 AND t.origin_seq > $2
+		  AND t.recorded_at < now() - make_interval(secs => $3)
+		ORDER BY t.origin_seq
+		LIMIT $4
+	`, p.region, after, lag.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var batch []Accrual
+	for rows.Next() {
+		var a Accrual
+		if err := rows.Scan(&a.Seq, &a.UserRegion, &a.UserID, &a.Amount, &a.Reason, &a.RecordedAt); err != nil {
+			return nil, err
+		}
+		batch = append(batch, a)
+	}
+	return batch, rows.Err()
+}
+
+func (p *Postgres) ReplicationCursor(ctx context.Context, peer string) (int64, error) {
+	var cursor int64
+	err := p.q.QueryRowContext(ctx, `SELECT last_seq FROM replication_cursors WHERE peer_region=$1`, peer).Scan(&cursor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return cursor, err
+}
+
+func (p *Postgres) MergeAccrual(ctx context.Context, peer string, a Accrual) (int64, error) {
+	// lock the user's row, as Accrue does, before taking the next place in
+	// their stream
+	var id, balance, seq int64
+	err := p.q.QueryRowContext(ctx, `SELECT id, points, points_seq FROM users WHERE `+byOrigin+` FOR UPDATE`,
+		a.UserRegion, a.UserID, p.region).Scan(&id, &balance, &seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	res, err := p.q.ExecContext(ctx, `
+		INSERT INTO point_transactions (origin_region, origin_seq, user_id, amount, reason, recorded_at, user_seq, balance, applied_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, clock_timestamp())
+		ON CONFLICT (origin_region, origin_seq) DO NOTHING
+	`, peer, a.Seq, id, a.Amount, a.Reason, a.RecordedAt, seq+1, balance+a.Amount)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+	// a debit made at home can arrive before credits it relied on that
+	// came from a third region; the balance catches up once they do
+	if _, err := p.q.ExecContext(ctx, `SELECT set_config('app.merging_accruals', 'on', true)`); err != nil {
+		return 0, err
+	}
+	_, err = p.q.ExecContext(ctx, `
+		UPDATE users SET points = points + $1, points_seq = points_seq + 1, version = version + 1 WHERE id=$2
+	`, a.Amount, id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (p *Postgres) UserReplica(ctx context.Context, region string, id int64) (UserReplica, error) {
+	u := UserReplica{Region: region, ID: id}
+	err := p.q.QueryRowContext(ctx, `
+		SELECT username, COALESCE(home_region, $1), created_at FROM users WHERE `+byOrigin,
+		region, id, p.region).Scan(&u.Username, &u.HomeRegion, &u.CreatedAt)
+	return u, notFound(err)
+}
+
+func (p *Postgres) UserOrigin(ctx context.Context, id int64) (string, int64, error) {
+	var region string
+	var originID int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT COALESCE(origin_region, $2), COALESCE(origin_id, id) FROM users WHERE id=$1
+	`, id, p.region).Scan(&region, &originID)
+	return region, originID, notFound(err)
+}
+
+func (p *Postgres) AddUserReplica(ctx context.Context, u UserReplica) (int64, error) {
+	var id int64
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO users (username, home_region, created_at, origin_region, origin_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, u.Username, u.HomeRegion, u.CreatedAt, u.Region, u.ID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrConflict
+	}
+	return id, err
+}
+
+func (p *Postgres) ParkAccrual(ctx context.Context, peer string, a Accrual) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO parked_accruals (peer_region, origin_seq, user_region, user_id, amount, reason, recorded_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (peer_region, origin_seq) DO NOTHING
+	`, peer, a.Seq, a.UserRegion, a.UserID, a.Amount, a.Reason, a.RecordedAt)
+	return err
+}
+
+func (p *Postgres) SetReplicationCursor(ctx context.Context, peer string, seq int64) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO replication_cursors (peer_region, last_seq, updated_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (peer_region) DO UPDATE SET last_seq = EXCLUDED.last_seq, updated_at = now()
+	`, peer, seq)
+	return err
+}
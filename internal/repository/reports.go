@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportSQL yields (metric, day, n) rows for [{from}, {to}), one GROUP BY
+// per metric over an index on the time column. {day:col} renders col as
+// its UTC day, or as one constant for totals.
+const reportSQL = `
+	SELECT 'active_users', d, COUNT(DISTINCT user_id) FROM (
+		SELECT user_id, {day:completed_at} AS d FROM user_tasks
+		WHERE completed_at >= {from} AND completed_at < {to}
+		UNION ALL
+		SELECT from_user_id, {day:created_at} FROM point_transfers
+		WHERE created_at >= {from} AND created_at < {to}
+		UNION ALL
+		SELECT referred_id, {day:created_at} FROM referrals
+		WHERE created_at >= {from} AND created_at < {to}
+	) a GROUP BY d
+	UNION ALL
+	SELECT 'new_users', {day:created_at} AS d, COUNT(*) FROM users
+	WHERE created_at >= {from} AND created_at < {to} GROUP BY d
+	UNION ALL
+	SELECT 'referred_new_users', {day:created_at} AS d, COUNT(*) FROM users
+	WHERE created_at >= {from} AND created_at < {to} AND referrer_id IS NOT NULL GROUP BY d
+	UNION ALL
+	SELECT 'tasks_completed', {day:completed_at} AS d, COUNT(*) FROM user_tasks
+	WHERE completed_at >= {from} AND completed_at < {to} GROUP BY d
+	UNION ALL
+	SELECT 'points_issued', {day:recorded_at} AS d, CAST(SUM(amount) AS BIGINT) FROM point_transactions
+	WHERE recorded_at >= {from} AND recorded_at < {to} AND amount > 0
+	  AND reason NOT LIKE 'transfer:%' AND reason <> 'opening_balance' GROUP BY d
+	UNION ALL
+	SELECT 'points_revoked', {day:recorded_at} AS d, CAST(-SUM(amount) AS BIGINT) FROM point_transactions
+	WHERE recorded_at >= {from} AND recorded_at < {to} AND amount < 0
+	  AND reason NOT LIKE 'transfer:%' AND reason <> 'opening_balance' GROUP BY d
+	UNION ALL
+	SELECT 'referrals', {day:created_at} AS d, COUNT(*) FROM referrals
+	WHERE created_at >= {from} AND created_at < {to} GROUP BY d
+`
+
+// reportQuery fills in reportSQL: day renders a column as its day, from
+// and to are the bind parameters.
+func reportQuery(day func(col string) string, from, to string) string {
+	r := strings.NewReplacer(
+		"{day:completed_at}", day("completed_at"),
+		"{day:created_at}", day("created_at"),
+		"{day:recorded_at}", day("recorded_at"),
+		"{from}", from,
+		"{to}", to,
+	)
+	return r.Replace(reportSQL)
+}
+
+// reportDays collects metric rows by day.
+type reportDays map[string]*ReportCounts
+
+func (r reportDays) add(day, metric string, n int64) {
+	c := r[day]
+	if c == nil {
+		c = &ReportCounts{}
+		r[day] = c
+	}
+	switch metric {
+	case "active_users":
+		c.ActiveUsers += n
+	case "new_users":
+		c.NewUsers += n
+	case "referred_new_users":
+		c.ReferredNewUsers += n
+	case "tasks_completed":
+		c.TasksCompleted += n
+	case "points_issued":
+		c.PointsIssued += n
+	case "points_revoked":
+		c.PointsRevoked += n
+	case "referrals":
+		c.Referrals += n
+	}
+}
+
+func (r reportDays) scan(rows *sql.Rows) error {
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			metric, day string
+			n           int64
+		)
+		if err := rows.Scan(&metric, &day, &n); err != nil {
+			return err
+		}
+		r.add(day, metric, n)
+	}
+	return rows.Err()
+}
+
+func (r reportDays) sorted() []ReportDay {
+	out := make([]ReportDay, 0, len(r))
+	for day, c := range r {
+		out = append(out, ReportDay{Date: day, ReportCounts: *c})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out
+}
+
+func (r reportDays) total() ReportCounts {
+	if c := r[""]; c != nil {
+		return *c
+	}
+	return ReportCounts{}
+}
+
+func pgReportDay(col string) string { return `to_char(` + col + ` AT TIME ZONE 'UTC', 'YYYY-MM-DD')` }
+
+func reportTotal(string) string { return `''` }
+
+func (p *Postgres) ReportDays(ctx context.Context, from, to time.Time) ([]ReportDay, error) {
+	rows, err := p.q.QueryContext(ctx, reportQuery(pgReportDay, "$1", "$2"), from, to)
+	if err != nil {
+		return nil, err
+	}
+	days := reportDays{}
+	if err := days.scan(rows); err != nil {
+		return nil, err
+	}
+	return days.sorted(), nil
+}
+
+func (p *Postgres) ReportTotals(ctx context.Context, from, to time.Time) (ReportCounts, error) {
+	rows, err := p.q.QueryContext(ctx, reportQuery(reportTotal, "$1", "$2"), from, to)
+	if err != nil {
+		return ReportCounts{}, err
+	}
+	days := reportDays{}
+	if err := days.scan(rows); err != nil {
+		return ReportCounts{}, err
+	}
+	return days.total(), nil
+}
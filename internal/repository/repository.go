@@ -0,0 +1,1495 @@
+// Package repository is the persistence layer: the records stored in the
+// database, the Store interface the service layer depends on, and its
+// Postgres, SQLite and in-memory implementations.
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested row doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write violates a uniqueness constraint.
+	ErrConflict = errors.New("conflict")
+	// ErrNegativeBalance is returned when a debit would take a balance
+	// below zero.
+	ErrNegativeBalance = errors.New("negative balance")
+	// ErrVersionConflict is returned when a user has changed since the
+	// version a write was based on.
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+type User struct {
+	ID         int64     `json:"id"`
+	Username   string    `json:"username"`
+	Points     int64     `json:"points"`
+	ReferrerID *int64    `json:"referrer_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Status is UserActive, UserSuspended or UserBanned and StatusReason
+	// says why. A suspension with StatusUntil set ends then.
+	Status       string     `json:"status"`
+	StatusReason string     `json:"status_reason,omitempty"`
+	StatusUntil  *time.Time `json:"status_until,omitempty"`
+	// Version goes up with every change to the user's profile or balance.
+	Version int64 `json:"version"`
+}
+
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+	UserBanned    = "banned"
+)
+
+// liftExpired reports a suspension whose StatusUntil has passed as active;
+// the stored row is left as it is.
+func (u *User) liftExpired(now time.Time) {
+	if u.Status == UserSuspended && u.StatusUntil != nil && !u.StatusUntil.After(now) {
+		u.Status, u.StatusReason, u.StatusUntil = UserActive, "", nil
+	}
+}
+
+// UserFilter narrows SearchUsers; zero fields match everything. Before is
+// the keyset cursor: only users with a smaller id are returned.
+type UserFilter struct {
+	UsernamePrefix string
+	MinPoints      *int64
+	CreatedAfter   *time.Time
+	Status         string
+	Before         int64
+	Limit          int
+}
+
+// UserQuery is a name search for FindUsers. Users whose username starts
+// with Text, ignoring case, or is similar to it by trigrams match. With
+// PublicOnly, users who aren't listed on leaderboards by name are left
+// out. After is the keyset cursor: only matches after it are returned.
+type UserQuery struct {
+	Text       string
+	PublicOnly bool
+	After      *UserMatchCursor
+	Limit      int
+}
+
+// UserMatch is a user FindUsers matched. Score orders matches: 1000 for a
+// prefix match plus Similarity in thousandths.
+type UserMatch struct {
+	ID         int64
+	Username   string
+	Prefix     bool
+	Similarity float64
+	Score      int
+}
+
+// UserMatchCursor is the last match of a page; the next page starts right
+// after it in (score DESC, id ASC) order.
+type UserMatchCursor struct {
+	Score int
+	ID    int64
+}
+
+// Profile is what a user shows others; empty fields are not set.
+type Profile struct {
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Timezone    string `json:"timezone"`
+	Locale      string `json:"locale"`
+	// Version is the user's Version as the profile was read; Profiles
+	// leaves it zero.
+	Version int64 `json:"version"`
+}
+
+// Settings are the user's privacy choices.
+type Settings struct {
+	// LeaderboardVisibility is VisibilityPublic, VisibilityAnonymous or
+	// VisibilityHidden.
+	LeaderboardVisibility string `json:"leaderboard_visibility"`
+}
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityAnonymous = "anonymous"
+	VisibilityHidden    = "hidden"
+)
+
+// Referral is a referrer/referred pair and the bonus each side gets. Status
+// is ReferralPaid once the bonuses are paid; until then it is
+// ReferralPending, or ReferralExpired if they never will be.
+type Referral struct {
+	ReferrerID    int64      `json:"referrer_id"`
+	ReferredID    int64      `json:"referred_id"`
+	BonusReferrer int64      `json:"bonus_referrer"`
+	BonusReferred int64      `json:"bonus_referred"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+}
+
+const (
+	ReferralPending = "pending"
+	ReferralPaid    = "paid"
+	ReferralExpired = "expired"
+)
+
+// ReferrerBonusCounts are the referral bonuses a referrer has been granted
+// in the current day and month and in all.
+type ReferrerBonusCounts struct {
+	Day   int64
+	Month int64
+	Total int64
+}
+
+// ReferralMilestone is what a referred user must have done for their
+// referral's bonuses to be paid: completed Tasks task completions and
+// earned Points points from tasks, net of revocations.
+type ReferralMilestone struct {
+	Tasks  int
+	Points int64
+}
+
+// ReferralClick is a visit to a referrer's link. ReferredID is the user
+// who signed up with its Token, if one has.
+type ReferralClick struct {
+	ID         int64
+	ReferrerID int64
+	Token      string
+	CreatedAt  time.Time
+	ReferredID *int64
+	SignedUpAt *time.Time
+}
+
+// ReferralFunnel counts the clicks on a referrer's link, the signups they
+// led to and how many of those users have completed a task since.
+type ReferralFunnel struct {
+	ReferrerID int64  `json:"referrer_id,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Clicks     int64  `json:"clicks"`
+	Signups    int64  `json:"signups"`
+	FirstTasks int64  `json:"first_tasks"`
+}
+
+type Task struct {
+	Code        string     `json:"code"`
+	Title       string     `json:"title"`
+	Points      int64      `json:"points"`
+	Description string     `json:"description"`
+	Active      bool       `json:"active"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+	// Requires lists the codes of tasks that must be completed first.
+	Requires []string `json:"requires"`
+	// Verifier names the check that must confirm a completion ("" means
+	// self-reported); VerifierConfig is its setting, e.g. a webhook URL.
+	Verifier       string `json:"verifier,omitempty"`
+	VerifierConfig string `json:"verifier_config,omitempty"`
+	// Category is the code of the category the task is listed under, ""
+	// for none.
+	Category string `json:"category,omitempty"`
+	// Tags are free-form labels, sorted.
+	Tags []string `json:"tags"`
+	// MaxCompletions caps completions across all users, nil for no cap;
+	// MaxCompletionsPerUser is how often one user can complete the task.
+	MaxCompletions        *int64 `json:"max_completions"`
+	MaxCompletionsPerUser int    `json:"max_completions_per_user"`
+	// Completions counts completions toward MaxCompletions and Remaining
+	// is what is left of it, nil without a cap. Only admins see them.
+	Completions int64  `json:"completions,omitempty"`
+	Remaining   *int64 `json:"remaining,omitempty"`
+	// RequiresReview holds completions for an admin to approve, see
+	// TaskSubmission.
+	RequiresReview bool `json:"requires_review"`
+}
+
+func (t *Task) setRemaining() {
+	t.Remaining = nil
+	if t.MaxCompletions != nil {
+		r := max(*t.MaxCompletions-t.Completions, 0)
+		t.Remaining = &r
+	}
+}
+
+// Exhausted reports whether the task has no completions left.
+func (t Task) Exhausted() bool {
+	return t.Remaining != nil && *t.Remaining == 0
+}
+
+// Category groups tasks for display. Categories are listed by Position,
+// then Code.
+type Category struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Position    int    `json:"position"`
+}
+
+// FeatureFlag is a feature's rollout as set at runtime, overriding its
+// configured one: off for everyone unless Enabled, and then on for Percent
+// percent of users.
+type FeatureFlag struct {
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	Percent   int       `json:"percent"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Maintenance is maintenance mode as set at runtime, overriding the
+// configured one. RetryAfter is in seconds.
+type Maintenance struct {
+	Enabled    bool      `json:"enabled"`
+	Message    string    `json:"message"`
+	RetryAfter int       `json:"retry_after"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// AvailableAt reports whether users can complete the task at t.
+func (t Task) AvailableAt(at time.Time) bool {
+	if !t.Active {
+		return false
+	}
+	if t.StartsAt != nil && at.Before(*t.StartsAt) {
+		return false
+	}
+	if t.EndsAt != nil && !at.Before(*t.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// UpcomingAt reports whether the task is active but scheduled to start
+// after t.
+func (t Task) UpcomingAt(at time.Time) bool {
+	return t.Active && t.StartsAt != nil && at.Before(*t.StartsAt)
+}
+
+// ExpiredAt reports whether the task's window closed at or before t.
+func (t Task) ExpiredAt(at time.Time) bool {
+	return t.EndsAt != nil && !at.Before(*t.EndsAt)
+}
+
+// Streak is a user's run of consecutive days with a task completion, or
+// with a check-in. Current is 0 once a day has been missed.
+type Streak struct {
+	Current        int
+	Longest        int
+	LastDay        *time.Time
+	CompletedToday bool
+}
+
+type CompletedTask struct {
+	Code        string    `json:"code"`
+	Title       string    `json:"title"`
+	Points      int64     `json:"points"`
+	CompletedAt time.Time `json:"completed_at"`
+	// Locale is the language Title is in, when it was localized.
+	Locale string `json:"locale,omitempty"`
+	// N numbers the user's completions of the task from 1; with
+	// CompletedAt and Code it places the completion in a page.
+	N int `json:"-"`
+}
+
+// CompletedTaskCursor is the last completion on a page of a user's
+// completed tasks; the next page starts right after it in
+// (completed_at, task code, n) DESC order.
+type CompletedTaskCursor struct {
+	CompletedAt time.Time
+	Code        string
+	N           int
+}
+
+// TaskTranslation is a task's title and description in another locale
+// than the default one.
+type TaskTranslation struct {
+	TaskCode    string    `json:"task_code"`
+	Locale      string    `json:"locale"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Submission statuses.
+const (
+	SubmissionPending  = "pending"
+	SubmissionApproved = "approved"
+	SubmissionRejected = "rejected"
+)
+
+// ExternalIdentity is an account elsewhere that stands for the user: at an
+// OAuth provider they sign in with, on Telegram, or at a partner.
+// ExternalID is the provider's stable id for the account.
+type ExternalIdentity struct {
+	Provider   string    `json:"provider"`
+	ExternalID string    `json:"external_id"`
+	UserID     int64     `json:"user_id"`
+	Email      string    `json:"email"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PartnerCompletion is a task completion a partner reported through
+// /callbacks. Reference is the partner's own id for it, and Awarded is 0
+// when nothing was awarded, such as for a task the user had already
+// completed.
+type PartnerCompletion struct {
+	Partner   string    `json:"partner"`
+	Reference string    `json:"reference"`
+	UserID    int64     `json:"user_id"`
+	TaskCode  string    `json:"task"`
+	Awarded   int64     `json:"awarded"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MergeCounts is what MergeUsers moved to the surviving account.
+type MergeCounts struct {
+	Completions   int64 `json:"completions"`
+	LedgerEntries int64 `json:"ledger_entries"`
+	Points        int64 `json:"points"`
+	Referrals     int64 `json:"referrals"`
+	Identities    int64 `json:"identities"`
+	Submissions   int64 `json:"submissions"`
+}
+
+// DuplicateMatch is another user who has an email address in common with
+// the one looked up, from a linked account or an email channel.
+type DuplicateMatch struct {
+	UserID int64
+	Email  string
+}
+
+// RevokedToken is an access token, by its jti, that is rejected until
+// ExpiresAt, when it would have expired anyway. UserID is its subject when
+// known.
+type RevokedToken struct {
+	JTI       string    `json:"jti"`
+	UserID    int64     `json:"user_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// TokenRevocations are the revoked access tokens still worth checking: the
+// jtis of unexpired ones with their expiry, and per user the time before
+// which all their tokens are revoked.
+type TokenRevocations struct {
+	JTIs  map[string]time.Time
+	Users map[int64]time.Time
+}
+
+// TaskSubmission is a completion of a task that requires review, with the
+// proof the user sent. Awarded is what approval paid; ReviewedBy is the
+// admin who decided it.
+type TaskSubmission struct {
+	ID         int64           `json:"id"`
+	UserID     int64           `json:"user_id"`
+	TaskCode   string          `json:"task"`
+	Proof      json.RawMessage `json:"proof"`
+	Status     string          `json:"status"`
+	Reason     string          `json:"reason,omitempty"`
+	Awarded    int64           `json:"awarded"`
+	ReviewedBy *int64          `json:"reviewed_by,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ReviewedAt *time.Time      `json:"reviewed_at,omitempty"`
+}
+
+// SubmissionFilter selects submissions by id order; zero fields match all.
+type SubmissionFilter struct {
+	UserID   int64
+	TaskCode string
+	Status   string
+	AfterID  int64
+	Limit    int
+}
+
+type LeaderboardEntry struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// DisplayName and AvatarURL come from the user's profile.
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Points      int64  `json:"points"`
+	Rank        int    `json:"rank"`
+	// Anonymous is set for users who asked to be listed without their
+	// name.
+	Anonymous bool `json:"anonymous,omitempty"`
+	// Level is the user's level, when levels are on.
+	Level int `json:"level,omitempty"`
+}
+
+// LeaderboardCursor is the last row of a leaderboard page; the next page
+// starts right after it in (points DESC, id ASC) order.
+type LeaderboardCursor struct {
+	Points int64
+	ID     int64
+}
+
+// RankSnapshot is when a period's leaderboard_ranks were last refreshed,
+// and for which window.
+type RankSnapshot struct {
+	Period      string
+	PeriodStart time.Time
+	RefreshedAt time.Time
+}
+
+type Team struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Points is what members earned while in the team; it stays when they
+	// leave.
+	Points    int64     `json:"points"`
+	Members   int       `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TeamMember struct {
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	JoinedAt time.Time `json:"joined_at"`
+	// Anonymous is set for users who aren't public on leaderboards.
+	Anonymous bool `json:"anonymous,omitempty"`
+}
+
+type TeamEntry struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Points  int64  `json:"points"`
+	Members int    `json:"members"`
+	Rank    int    `json:"rank"`
+}
+
+// Season statuses. Ended seasons are over but their standings aren't
+// archived yet.
+const (
+	SeasonUpcoming = "upcoming"
+	SeasonActive   = "active"
+	SeasonEnded    = "ended"
+	SeasonArchived = "archived"
+)
+
+// Season is a [StartsAt, EndsAt) window with a leaderboard of its own.
+type Season struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// Status is derived from the window and ArchivedAt when read.
+	Status     string     `json:"status"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (s *Season) setStatus(now time.Time) {
+	switch {
+	case s.ArchivedAt != nil:
+		s.Status = SeasonArchived
+	case now.Before(s.StartsAt):
+		s.Status = SeasonUpcoming
+	case now.Before(s.EndsAt):
+		s.Status = SeasonActive
+	default:
+		s.Status = SeasonEnded
+	}
+}
+
+// Campaign statuses, derived from the window when read.
+const (
+	CampaignUpcoming = "upcoming"
+	CampaignActive   = "active"
+	CampaignEnded    = "ended"
+)
+
+// Campaign is a [StartsAt, EndsAt) promotion: completions of the tasks it
+// covers while it runs are scaled by Multiplier and get BonusPoints on
+// top. It covers Tasks and every task in Category, or every task when
+// both are empty.
+type Campaign struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Multiplier  float64   `json:"multiplier"`
+	BonusPoints int64     `json:"bonus_points"`
+	Category    string    `json:"category,omitempty"`
+	Tasks       []string  `json:"tasks"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (c *Campaign) setStatus(now time.Time) {
+	switch {
+	case now.Before(c.StartsAt):
+		c.Status = CampaignUpcoming
+	case now.Before(c.EndsAt):
+		c.Status = CampaignActive
+	default:
+		c.Status = CampaignEnded
+	}
+}
+
+// Covers reports whether completions of t fall under the campaign.
+func (c Campaign) Covers(t Task) bool {
+	if len(c.Tasks) == 0 && c.Category == "" {
+		return true
+	}
+	return slices.Contains(c.Tasks, t.Code) || (c.Category != "" && t.Category == c.Category)
+}
+
+// CampaignAward is what a campaign added to one completion: Awarded is the
+// completion's points once the campaign was applied, Extra the part of
+// them the campaign accounts for.
+type CampaignAward struct {
+	CampaignID int64
+	UserID     int64
+	TaskCode   string
+	Awarded    int64
+	Extra      int64
+}
+
+// CampaignStats totals a campaign's awards, overall and per task.
+type CampaignStats struct {
+	Completions int64               `json:"completions"`
+	Users       int64               `json:"users"`
+	Awarded     int64               `json:"awarded"`
+	Extra       int64               `json:"extra"`
+	Tasks       []CampaignTaskStats `json:"tasks"`
+}
+
+type CampaignTaskStats struct {
+	Task        string `json:"task"`
+	Completions int64  `json:"completions"`
+	Awarded     int64  `json:"awarded"`
+	Extra       int64  `json:"extra"`
+}
+
+// AwardRule is an award modifier: completions that match Conditions, a
+// JSON object the service parses, are scaled by Multiplier and get
+// BonusPoints on top. Enabled rules apply by Position, then id.
+type AwardRule struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Position    int             `json:"position"`
+	Enabled     bool            `json:"enabled"`
+	Conditions  json.RawMessage `json:"conditions"`
+	Multiplier  float64         `json:"multiplier"`
+	BonusPoints int64           `json:"bonus_points"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// LedgerEntry is an event in a user's points stream, the record every
+// balance is built from. Seq is its position in the user's stream, from 1
+// without gaps, and Balance what the balance came to once it was applied.
+type LedgerEntry struct {
+	ID        int64     `json:"id"`
+	Seq       int64     `json:"seq"`
+	Amount    int64     `json:"amount"`
+	Balance   int64     `json:"balance"`
+	Reason    string    `json:"reason"`
+	Region    string    `json:"region"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Transfer struct {
+	ID         int64     `json:"id"`
+	FromUserID int64     `json:"from_user_id"`
+	ToUserID   int64     `json:"to_user_id"`
+	Amount     int64     `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditEvent is one row of the append-only audit log. Before and After are
+// JSON snapshots of the target, null when there is nothing to show.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	At         time.Time       `json:"at"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+}
+
+// AuditFilter narrows ListAuditEvents; zero fields match everything.
+// Before is the keyset cursor: only events with a smaller id are returned.
+type AuditFilter struct {
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	Before     int64
+	Limit      int
+}
+
+// OutboxEvent is a domain event waiting in the outbox to be published.
+type OutboxEvent struct {
+	ID        int64
+	EventID   string
+	Type      string
+	Data      json.RawMessage
+	CreatedAt time.Time
+	Attempts  int
+}
+
+// WebhookEndpoint is an admin-registered receiver of events. Events lists the
+// subscribed event types, or "*" for all.
+type WebhookEndpoint struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event queued for one endpoint. Status is "pending",
+// "delivered" or "failed".
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int64           `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// PendingDelivery is a claimed delivery with what's needed to send it.
+type PendingDelivery struct {
+	ID       int64
+	EventID  string
+	Event    string
+	Payload  json.RawMessage
+	Attempts int
+	URL      string
+	Secret   string
+}
+
+// WebhookAttempt is the outcome of sending a delivery. A failed attempt with
+// RetryIn > 0 is retried then; otherwise the delivery is given up.
+type WebhookAttempt struct {
+	Delivered  bool
+	StatusCode *int
+	Error      string
+	RetryIn    time.Duration
+}
+
+// Notification is an in-app message to a user, made from the outbox event
+// EventID. Kind says what happened; Data holds the event's details.
+type Notification struct {
+	ID        int64           `json:"id"`
+	UserID    int64           `json:"user_id"`
+	EventID   string          `json:"-"`
+	Kind      string          `json:"kind"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at"`
+}
+
+// ChannelSetting is where a user has notifications sent on a channel:
+// an email address, a push token.
+type ChannelSetting struct {
+	Channel   string    `json:"channel"`
+	Address   string    `json:"address"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PendingNotification is a claimed delivery of a notification on a
+// channel; ID is the delivery's.
+type PendingNotification struct {
+	ID           int64
+	Channel      string
+	Address      string
+	Attempts     int
+	Notification Notification
+}
+
+// NotificationAttempt is the outcome of sending a delivery. A failed
+// attempt with RetryIn > 0 is retried then; otherwise it is given up.
+type NotificationAttempt struct {
+	Sent    bool
+	Error   string
+	RetryIn time.Duration
+}
+
+// DataExport is a queued copy of a user's data. Status is "pending", "ready"
+// or "failed"; ExportContent reads the archive of a ready one.
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// ReportExport is a queued CSV of a report too large to stream. Report
+// names it and Params are its query as the service encoded them; Status is
+// as for DataExport.
+type ReportExport struct {
+	ID          int64           `json:"id"`
+	Report      string          `json:"report"`
+	Params      json.RawMessage `json:"params"`
+	RequestedBy int64           `json:"requested_by"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	CompletedAt *time.Time      `json:"completed_at"`
+	ExpiresAt   *time.Time      `json:"expires_at"`
+}
+
+// Accrual is a ledger entry as replicated between regions, identified by the
+// sequence number it was given in its origin region.
+type Accrual struct {
+	Seq int64
+	// UserRegion and UserID identify the user across regions: the region
+	// that created them and their id there. Each region numbers its users
+	// on its own, so an id alone can name someone else in another region.
+	UserRegion string
+	UserID     int64
+	Amount     int64
+	Reason     string
+	RecordedAt time.Time
+}
+
+// UserReplica is what a region copies of a user created elsewhere when it
+// merges their first ledger entry. Region and ID identify them as in
+// Accrual; HomeRegion is where their writes go, their origin region when
+// they have none set.
+type UserReplica struct {
+	Region     string
+	ID         int64
+	Username   string
+	HomeRegion string
+	CreatedAt  time.Time
+}
+
+// Distribution counts users below, above and at any score within one
+// points_distribution period ("all", "day", "week" or "month").
+type Distribution struct {
+	Below   int64
+	Above   int64
+	Present int64
+}
+
+// PointsCount is how many users hold one score in a period.
+type PointsCount struct {
+	Points int64
+	Users  int64
+}
+
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	FamilyID  string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+// IdempotentResponse is what was recorded under an Idempotency-Key. Done is
+// false while the first request is still running.
+type IdempotentResponse struct {
+	RequestHash string
+	Done        bool
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UserStore interface {
+	GetUser(ctx context.Context, id int64) (User, error)
+	CreateUser(ctx context.Context, username, passwordHash, homeRegion string) (User, error)
+	// GetPasswordHash returns "" for users that have no password.
+	GetPasswordHash(ctx context.Context, username string) (int64, string, error)
+	// GetHomeRegion returns "" for users that may be written in any region.
+	GetHomeRegion(ctx context.Context, id int64) (string, error)
+	SetReferrer(ctx context.Context, userID, referrerID int64) error
+	// CreateReferral records r, stamping CreatedAt, and PaidAt too if it
+	// is ReferralPaid.
+	CreateReferral(ctx context.Context, r Referral) error
+	// DueReferrals lists up to limit pending referrals, oldest first, whose
+	// referred user has reached m and is neither deleted nor banned.
+	DueReferrals(ctx context.Context, m ReferralMilestone, limit int) ([]Referral, error)
+	// PayReferral marks the pending referral paid; it returns ErrNotFound
+	// if it isn't pending.
+	PayReferral(ctx context.Context, referrerID, referredID int64) error
+	// ExpireReferrals marks referrals still pending since before cutoff
+	// expired.
+	ExpireReferrals(ctx context.Context, cutoff time.Time) (int64, error)
+	// ListReferrals returns the referrals the user is either side of, oldest
+	// first.
+	ListReferrals(ctx context.Context, userID int64) ([]Referral, error)
+	// ReferrerBonuses counts the referrals that pay or will pay referrerID
+	// a bonus: made since day, since month and ever. Expired ones don't
+	// count.
+	ReferrerBonuses(ctx context.Context, referrerID int64, day, month time.Time) (ReferrerBonusCounts, error)
+	GetProfile(ctx context.Context, id int64) (Profile, error)
+	// UpdateProfile writes p and bumps the user's version if it is still
+	// p.Version, or returns ErrVersionConflict.
+	UpdateProfile(ctx context.Context, id int64, p Profile) error
+	// CheckUserVersion returns ErrVersionConflict unless the user's version
+	// is version, and holds their row until the transaction ends so it
+	// stays so.
+	CheckUserVersion(ctx context.Context, id, version int64) error
+	// Profiles returns the profiles of those of ids that exist.
+	Profiles(ctx context.Context, ids []int64) (map[int64]Profile, error)
+	GetSettings(ctx context.Context, id int64) (Settings, error)
+	UpdateSettings(ctx context.Context, id int64, st Settings) error
+	// DeleteUser soft-deletes a user: it sets deleted_at, moves the username,
+	// password hash and profile to deleted_users, scrubs them from users and
+	// revokes the user's refresh tokens. Deleted users are not found by
+	// GetUser and GetProfile and drop out of leaderboards and counts. It
+	// returns ErrNotFound for unknown or already deleted users.
+	DeleteUser(ctx context.Context, id int64) error
+	// RestoreUser undoes DeleteUser for a user deleted at or after since. It
+	// returns ErrNotFound when there is nothing to restore and ErrConflict
+	// when the username was taken meanwhile.
+	RestoreUser(ctx context.Context, id int64, since time.Time) error
+	// SearchUsers lists users matching f, newest first. Deleted users are
+	// left out.
+	SearchUsers(ctx context.Context, f UserFilter) ([]User, error)
+	// FindUsers lists users matching q by name, best match first. Deleted
+	// users are left out.
+	FindUsers(ctx context.Context, q UserQuery) ([]UserMatch, error)
+	// SetUserStatus changes the user's status, revoking their refresh
+	// tokens when it is UserBanned. It returns ErrNotFound for unknown or
+	// deleted users.
+	SetUserStatus(ctx context.Context, id int64, status, reason string, until *time.Time) error
+	// ClearReferrer unsets the user's referrer and drops the referral, so a
+	// new one can be set. Bonuses already paid stay.
+	ClearReferrer(ctx context.Context, id int64) error
+	// PurgeDeletedUsers drops what DeleteUser kept for users deleted before
+	// cutoff, so they can no longer be restored.
+	PurgeDeletedUsers(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type TaskStore interface {
+	GetTask(ctx context.Context, code string) (Task, error)
+	ListTasks(ctx context.Context, availableOnly bool) ([]Task, error)
+	CreateTask(ctx context.Context, t Task) (Task, error)
+	UpdateTask(ctx context.Context, t Task) (Task, error)
+	ArchiveTask(ctx context.Context, code string) error
+	// AddUserTask records a completion unless the user has perUser of them
+	// already, and reports whether it did.
+	AddUserTask(ctx context.Context, userID int64, code string, perUser int) (bool, error)
+	// ClaimTaskCompletion counts a completion toward the task's
+	// MaxCompletions; it reports false, counting nothing, if none are left.
+	ClaimTaskCompletion(ctx context.Context, code string) (bool, error)
+	// RevokeUserTask deletes the user's latest completion of the task and
+	// takes it off the task's completions. It returns ErrNotFound if the
+	// user hasn't completed the task.
+	RevokeUserTask(ctx context.Context, userID int64, code string) error
+	CountUserTask(ctx context.Context, userID int64, code string) (int, error)
+	ListCompletedTasks(ctx context.Context, userID int64) ([]CompletedTask, error)
+	// CompletedTasksPage lists up to limit of the user's completions,
+	// newest first, after the cursor when there is one.
+	CompletedTasksPage(ctx context.Context, userID int64, limit int, after *CompletedTaskCursor) ([]CompletedTask, error)
+	CountCompletedTasks(ctx context.Context, userID int64) (int64, error)
+	// SetTaskPrerequisites replaces the tasks code requires; it returns
+	// ErrNotFound if one of them doesn't exist.
+	SetTaskPrerequisites(ctx context.Context, code string, requires []string) error
+	// TaskDependsOn reports whether from requires to, directly or through
+	// other tasks.
+	TaskDependsOn(ctx context.Context, from, to string) (bool, error)
+	// MissingPrerequisites lists the tasks code requires that the user
+	// hasn't completed.
+	MissingPrerequisites(ctx context.Context, userID int64, code string) ([]string, error)
+	// SetTaskTags replaces the task's tags.
+	SetTaskTags(ctx context.Context, code string, tags []string) error
+}
+
+type TranslationStore interface {
+	// TaskTranslations lists the task's translations by locale.
+	TaskTranslations(ctx context.Context, code string) ([]TaskTranslation, error)
+	// TranslationsIn lists the translations of every task into locales.
+	TranslationsIn(ctx context.Context, locales []string) ([]TaskTranslation, error)
+	// SetTaskTranslation adds or replaces a translation; it returns
+	// ErrNotFound if the task doesn't exist.
+	SetTaskTranslation(ctx context.Context, t TaskTranslation) (TaskTranslation, error)
+	DeleteTaskTranslation(ctx context.Context, code, locale string) error
+}
+
+type SubmissionStore interface {
+	// CreateSubmission returns ErrConflict if the user already has a
+	// pending submission for the task.
+	CreateSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error)
+	GetSubmission(ctx context.Context, id int64) (TaskSubmission, error)
+	// ListSubmissions lists matching submissions in id order.
+	ListSubmissions(ctx context.Context, f SubmissionFilter) ([]TaskSubmission, error)
+	// ReviewSubmission moves a pending submission to sub.Status with
+	// sub's Reason, Awarded and ReviewedBy. It returns ErrConflict if the
+	// submission is no longer pending.
+	ReviewSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error)
+}
+
+type CategoryStore interface {
+	ListCategories(ctx context.Context) ([]Category, error)
+	GetCategory(ctx context.Context, code string) (Category, error)
+	// CreateCategory returns ErrConflict if the code is taken.
+	CreateCategory(ctx context.Context, c Category) error
+	UpdateCategory(ctx context.Context, c Category) error
+	// DeleteCategory drops the category; its tasks are left without one.
+	DeleteCategory(ctx context.Context, code string) error
+}
+
+type FlagStore interface {
+	// FeatureFlags lists the flags set at runtime by name.
+	FeatureFlags(ctx context.Context) ([]FeatureFlag, error)
+	// SetFeatureFlag adds or replaces a flag, stamping UpdatedAt.
+	SetFeatureFlag(ctx context.Context, f FeatureFlag) (FeatureFlag, error)
+	// DeleteFeatureFlag drops a flag; it returns ErrNotFound if it isn't
+	// set.
+	DeleteFeatureFlag(ctx context.Context, name string) error
+}
+
+type MaintenanceStore interface {
+	// Maintenance returns the maintenance mode set at runtime, or
+	// ErrNotFound if none is.
+	Maintenance(ctx context.Context) (Maintenance, error)
+	// SetMaintenance adds or replaces it, stamping UpdatedAt.
+	SetMaintenance(ctx context.Context, m Maintenance) (Maintenance, error)
+	// ClearMaintenance drops it; it returns ErrNotFound if none is set.
+	ClearMaintenance(ctx context.Context) error
+}
+
+type ReferralLinkStore interface {
+	// ReferralCode returns the user's link code, or ErrNotFound if they
+	// have none yet.
+	ReferralCode(ctx context.Context, userID int64) (string, error)
+	// CreateReferralCode gives the user code. It returns ErrConflict if the
+	// code is taken or the user has one already.
+	CreateReferralCode(ctx context.Context, userID int64, code string) error
+	// ReferrerByCode returns the user whose code it is, or ErrNotFound if
+	// there is none or they are deleted.
+	ReferrerByCode(ctx context.Context, code string) (int64, error)
+	CreateReferralClick(ctx context.Context, referrerID int64, token string) error
+	GetReferralClick(ctx context.Context, token string) (ReferralClick, error)
+	// ClaimReferralClick records that referredID signed up with the click
+	// and returns it. It returns ErrNotFound if the click is unknown, was
+	// made before since or has been claimed.
+	ClaimReferralClick(ctx context.Context, token string, referredID int64, since time.Time) (ReferralClick, error)
+	// ReferralFunnels counts the clicks made in [from, to) per referrer,
+	// most signups first, up to limit.
+	ReferralFunnels(ctx context.Context, from, to time.Time, limit int) ([]ReferralFunnel, error)
+	// ReferralFunnelTotals is ReferralFunnels over all referrers; the
+	// totals have no ReferrerID or Username.
+	ReferralFunnelTotals(ctx context.Context, from, to time.Time) (ReferralFunnel, error)
+}
+
+type PointStore interface {
+	// Accrue appends amount (negative for a debit) to the user's points
+	// stream, tagged with the region, and adds it to their balance. The
+	// user's row is locked first, so the stream takes one entry at a time
+	// and each one's Seq and Balance follow from the last. A debit that
+	// would take the balance below zero fails with ErrNegativeBalance.
+	Accrue(ctx context.Context, userID, amount int64, reason string) error
+	// BalanceAt is the last entry in the user's stream applied at or
+	// before at, whose Balance is what they had then; ErrNotFound if there
+	// is none, when they had 0.
+	BalanceAt(ctx context.Context, userID int64, at time.Time) (LedgerEntry, error)
+	ListTransactions(ctx context.Context, userID, before int64, limit int) ([]LedgerEntry, error)
+	CountTransactions(ctx context.Context, userID int64) (int64, error)
+	// LedgerByReason lists the user's ledger entries with any of reasons,
+	// oldest first.
+	LedgerByReason(ctx context.Context, userID int64, reasons []string) ([]LedgerEntry, error)
+	// Leaderboard returns up to limit users after the cursor (from the top
+	// when nil), with absolute ranks. period is "all" for lifetime points or
+	// a user_period_points period ("day", "week", "month") for the current
+	// window. Hidden users are left out of it and of Rank.
+	Leaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error)
+	// Rank returns the 1-based position a user with the given points holds in
+	// the period's leaderboard and the entry ranked directly above, nil for
+	// first place.
+	Rank(ctx context.Context, period string, userID, points int64) (int, *LeaderboardEntry, error)
+	// FriendsLeaderboard ranks userID, their referrer and the users they
+	// referred by points in period, as Leaderboard does, counting 0 for
+	// those with nothing in the window. Deleted users are left out, and
+	// hidden ones other than userID.
+	FriendsLeaderboard(ctx context.Context, userID int64, period string) ([]LeaderboardEntry, error)
+	TotalUsers(ctx context.Context) (int64, error)
+	// PeriodUsers counts users with points recorded in the current window.
+	PeriodUsers(ctx context.Context, period string) (int64, error)
+	PeriodPoints(ctx context.Context, userID int64, period string) (int64, error)
+	Distribution(ctx context.Context, period string, points int64) (Distribution, error)
+	// PointsHistogram counts the users at each score in a
+	// points_distribution period, lowest first. Users with nothing in a
+	// window aren't counted.
+	PointsHistogram(ctx context.Context, period string) ([]PointsCount, error)
+	// CreateTransfer records a transfer; the caller writes the ledger
+	// entries.
+	CreateTransfer(ctx context.Context, fromID, toID, amount int64) (Transfer, error)
+	// TransferredToday sums what the user sent since midnight in the
+	// database time zone.
+	TransferredToday(ctx context.Context, userID int64) (int64, error)
+}
+
+// RankStore keeps leaderboard_ranks, each period's leaderboard with its
+// ranks worked out in advance, so reads don't count the users above.
+type RankStore interface {
+	// RefreshRanks recomputes the period's ranks from the live board for
+	// the current window, writing only rows whose rank or points changed
+	// and dropping users no longer on it. It returns how many rows it
+	// wrote or dropped.
+	RefreshRanks(ctx context.Context, period string) (int64, error)
+	// RankSnapshot returns the period's last refresh; ErrNotFound if there
+	// was none for the current window.
+	RankSnapshot(ctx context.Context, period string) (RankSnapshot, error)
+	// RankedLeaderboard is Leaderboard as of the last refresh. Users
+	// deleted or hidden since are left out, keeping the ranks of the rest.
+	RankedLeaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error)
+	// RankedPosition returns the user's entry as of the last refresh and the
+	// entry ranked directly above, nil for first place; ErrNotFound if the
+	// user wasn't on the board or has been hidden since.
+	RankedPosition(ctx context.Context, period string, userID int64) (LeaderboardEntry, *LeaderboardEntry, error)
+}
+
+type TokenStore interface {
+	// CreateRefreshToken stores a token in familyID, or in a new family when
+	// familyID is empty, and returns its id.
+	CreateRefreshToken(ctx context.Context, userID int64, familyID, tokenHash string, ttl time.Duration) (int64, error)
+	// GetRefreshToken locks the token row until the transaction ends.
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, id, replacedBy int64) error
+	RevokeRefreshFamily(ctx context.Context, familyID string) error
+	RevokeRefreshFamilyOf(ctx context.Context, tokenHash string) error
+	// PurgeRefreshTokens drops tokens that expired before now.
+	PurgeRefreshTokens(ctx context.Context, now time.Time) (int64, error)
+	// RevokeAccessToken adds a token to the deny-list; revoking it again
+	// changes nothing.
+	RevokeAccessToken(ctx context.Context, t RevokedToken) error
+	// RevokeUserTokens revokes the user's access tokens issued before
+	// before, and their refresh tokens. It returns ErrNotFound for an
+	// unknown user.
+	RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error
+	// TokenRevocations loads the deny-list, leaving out tokens expired by
+	// now.
+	TokenRevocations(ctx context.Context, now time.Time) (TokenRevocations, error)
+	// PurgeRevokedTokens drops deny-listed tokens that expired before now.
+	PurgeRevokedTokens(ctx context.Context, now time.Time) (int64, error)
+}
+
+type PasswordResetStore interface {
+	CreatePasswordReset(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	// CountPasswordResets counts the reset tokens issued to the user since.
+	CountPasswordResets(ctx context.Context, userID int64, since time.Time) (int, error)
+	// UsePasswordReset marks an unused token that is still valid at now
+	// used, along with the user's other unused tokens, and returns the
+	// user. Any other token is ErrNotFound.
+	UsePasswordReset(ctx context.Context, tokenHash string, now time.Time) (int64, error)
+	// SetPasswordHash returns ErrNotFound for unknown and deleted users.
+	SetPasswordHash(ctx context.Context, userID int64, hash string) error
+	// PurgePasswordResets drops tokens that expired before now.
+	PurgePasswordResets(ctx context.Context, now time.Time) (int64, error)
+}
+
+type CallbackStore interface {
+	// ClaimCallbackSignature records a partner's request signature until
+	// expiresAt, first forgetting those expired by now, and reports false
+	// when it was already recorded.
+	ClaimCallbackSignature(ctx context.Context, partner, signature string, expiresAt, now time.Time) (bool, error)
+	// AddPartnerCompletion records a completion a partner reported and
+	// reports false when the partner already reported its reference.
+	AddPartnerCompletion(ctx context.Context, c PartnerCompletion) (bool, error)
+}
+
+type IdentityStore interface {
+	GetIdentity(ctx context.Context, provider, externalID string) (ExternalIdentity, error)
+	// ListIdentities returns the user's identities by provider.
+	ListIdentities(ctx context.Context, userID int64) ([]ExternalIdentity, error)
+	// AddIdentity returns ErrConflict when the provider account is taken
+	// or the user already has one from the provider.
+	AddIdentity(ctx context.Context, id ExternalIdentity) error
+	// DeleteIdentity removes and returns the user's identity from the
+	// provider, or returns ErrNotFound.
+	DeleteIdentity(ctx context.Context, userID int64, provider string) (ExternalIdentity, error)
+	DeleteIdentities(ctx context.Context, userID int64) error
+}
+
+type MergeStore interface {
+	// MergeUsers moves from's history onto into: completions, numbered
+	// after into's own, ledger entries, appended to into's stream, and the
+	// balance they add up to; the referrals from made and the one that
+	// brought from in, unless into has a referrer or either referred the
+	// other; from's referral code unless into has one; linked accounts
+	// from providers into has none from; submissions, less pending ones
+	// for a task into has one pending for; partner completions and
+	// campaign awards. The balance counts toward into's current windows,
+	// season and team like any credit. Completions past a task's per-user
+	// limit must be revoked first. It returns ErrNegativeBalance if from's
+	// balance is negative and more than into has.
+	MergeUsers(ctx context.Context, from, into int64) (MergeCounts, error)
+	// DuplicateMatches lists, by user id, the other users who are not
+	// deleted and share an email address with id, compared case
+	// insensitively.
+	DuplicateMatches(ctx context.Context, id int64) ([]DuplicateMatch, error)
+}
+
+type ReplicationStore interface {
+	// LocalAccruals returns accruals that originated in this store's region
+	// after seq, skipping rows recorded less than lag ago.
+	LocalAccruals(ctx context.Context, after int64, lag time.Duration, limit int) ([]Accrual, error)
+	ReplicationCursor(ctx context.Context, peer string) (int64, error)
+	// MergeAccrual applies a peer's accrual once and returns the local id of
+	// the user it credited, or 0 for rows that were merged before. It
+	// returns ErrNotFound when no local user has the accrual's user region
+	// and id.
+	MergeAccrual(ctx context.Context, peer string, a Accrual) (int64, error)
+	// UserReplica returns the user with the given region and id, created
+	// in this store or copied into it, for another region to copy.
+	UserReplica(ctx context.Context, region string, id int64) (UserReplica, error)
+	// UserOrigin returns the region that created the user and their id
+	// there; for users created in this store that is its region and id.
+	UserOrigin(ctx context.Context, id int64) (region string, originID int64, err error)
+	// AddUserReplica copies a user from another region and returns their
+	// local id, or ErrConflict when the username is taken here.
+	AddUserReplica(ctx context.Context, u UserReplica) (int64, error)
+	// ParkAccrual sets aside a peer's accrual that can't be merged, so that
+	// replication can move past it.
+	ParkAccrual(ctx context.Context, peer string, a Accrual) error
+	SetReplicationCursor(ctx context.Context, peer string, seq int64) error
+}
+
+type IdempotencyStore interface {
+	// ClaimIdempotencyKey records an in-flight request for the key and
+	// returns nil, or returns the existing record when the key is taken.
+	// Records older than ttl, and in-flight claims older than lease, are
+	// taken over.
+	ClaimIdempotencyKey(ctx context.Context, userID int64, key, requestHash string, lease, ttl time.Duration) (*IdempotentResponse, error)
+	SaveIdempotentResponse(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error
+	// ReleaseIdempotencyKey drops an in-flight claim so the request can be
+	// retried.
+	ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error
+}
+
+type StreakStore interface {
+	// BumpStreak records a completion today and returns the updated streak;
+	// a positive max caps Current.
+	BumpStreak(ctx context.Context, userID int64, max int) (Streak, error)
+	// GetStreak returns the zero Streak for users who never completed a
+	// task.
+	GetStreak(ctx context.Context, userID int64) (Streak, error)
+	// CheckIn records a daily check-in on day, the user's local date, and
+	// returns their check-in streak, counted like BumpStreak's. ok is
+	// false, and nothing changes, when they already checked in on day or
+	// later.
+	CheckIn(ctx context.Context, userID int64, day time.Time) (st Streak, ok bool, err error)
+}
+
+type AuditStore interface {
+	AddAuditEvent(ctx context.Context, e AuditEvent) error
+	// ListAuditEvents returns matching events, newest first.
+	ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+}
+
+type OutboxStore interface {
+	AddOutboxEvent(ctx context.Context, e OutboxEvent) error
+	// ClaimOutboxEvents takes up to limit unpublished events, oldest first,
+	// and hides them from other claimers for lease.
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error)
+	MarkOutboxPublished(ctx context.Context, id int64) error
+	MarkOutboxFailed(ctx context.Context, id int64, errMsg string, retryIn time.Duration) error
+}
+
+type WebhookStore interface {
+	CreateWebhookEndpoint(ctx context.Context, e WebhookEndpoint) (WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id int64) (WebhookEndpoint, error)
+	ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error)
+	// DisableWebhookEndpoint stops new deliveries and fails pending ones.
+	DisableWebhookEndpoint(ctx context.Context, id int64) error
+	// EnqueueWebhookEvent queues payload for every active endpoint
+	// subscribed to event; endpoints that already have eventID queued are
+	// skipped.
+	EnqueueWebhookEvent(ctx context.Context, eventID, event string, payload json.RawMessage) error
+	// ClaimWebhookDeliveries takes up to limit due deliveries and hides them
+	// from other claimers for lease, so several instances can dispatch.
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id int64, a WebhookAttempt) error
+	// ListWebhookDeliveries pages an endpoint's deliveries newest first;
+	// status "" matches all and before 0 starts at the newest.
+	ListWebhookDeliveries(ctx context.Context, endpointID int64, status string, before int64, limit int) ([]WebhookDelivery, error)
+	// RetryWebhookDelivery requeues a delivered or failed delivery of an
+	// active endpoint; it returns ErrNotFound otherwise.
+	RetryWebhookDelivery(ctx context.Context, id int64) error
+}
+
+type NotificationStore interface {
+	// AddNotification stores n and queues a delivery on each of the user's
+	// enabled channels. It reports false, doing nothing, if the user
+	// already has a notification of n's kind for the event.
+	AddNotification(ctx context.Context, n Notification) (bool, error)
+	// ListNotifications pages the user's notifications newest first;
+	// before 0 starts at the newest.
+	ListNotifications(ctx context.Context, userID int64, unreadOnly bool, before int64, limit int) ([]Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID int64) (int64, error)
+	// MarkNotificationsRead marks the user's notifications with ids read,
+	// all of them when ids is nil, and returns how many were unread.
+	MarkNotificationsRead(ctx context.Context, userID int64, ids []int64) (int64, error)
+	ListChannelSettings(ctx context.Context, userID int64) ([]ChannelSetting, error)
+	// SetChannelSetting adds or replaces the user's setting for c.Channel.
+	SetChannelSetting(ctx context.Context, userID int64, c ChannelSetting) (ChannelSetting, error)
+	// DeleteChannelSetting removes the user's setting for channel, or all
+	// of them when channel is ""; it returns ErrNotFound if there was none.
+	DeleteChannelSetting(ctx context.Context, userID int64, channel string) error
+	// ClaimNotificationDeliveries takes up to limit due deliveries and
+	// hides them from other claimers for lease.
+	ClaimNotificationDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingNotification, error)
+	RecordNotificationAttempt(ctx context.Context, id int64, a NotificationAttempt) error
+}
+
+type ExportStore interface {
+	CreateExport(ctx context.Context, userID int64, format string) (DataExport, error)
+	// GetExport returns ErrNotFound for another user's export and for
+	// expired ones.
+	GetExport(ctx context.Context, userID, id int64) (DataExport, error)
+	// ExportContent returns the archive of a ready export.
+	ExportContent(ctx context.Context, userID, id int64) ([]byte, error)
+	// ClaimExports takes up to limit pending exports and hides them from
+	// other claimers for lease, so several instances can build them.
+	ClaimExports(ctx context.Context, limit int, lease time.Duration) ([]DataExport, error)
+	CompleteExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error
+	FailExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error
+	DeleteUserExports(ctx context.Context, userID int64) error
+	// PurgeExports drops data and report exports that expired before now.
+	PurgeExports(ctx context.Context, now time.Time) (int64, error)
+
+	CreateReportExport(ctx context.Context, report string, params json.RawMessage, requestedBy int64) (ReportExport, error)
+	// GetReportExport returns ErrNotFound for expired exports.
+	GetReportExport(ctx context.Context, id int64) (ReportExport, error)
+	// ReportExportContent returns the CSV of a ready export.
+	ReportExportContent(ctx context.Context, id int64) ([]byte, error)
+	// ClaimReportExports is ClaimExports for report exports.
+	ClaimReportExports(ctx context.Context, limit int, lease time.Duration) ([]ReportExport, error)
+	CompleteReportExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error
+	FailReportExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error
+}
+
+// Discrepancy is a user whose balance differed from the sum of their
+// ledger when the reconciliation job last ran.
+type Discrepancy struct {
+	UserID       int64     `json:"user_id"`
+	Username     string    `json:"username"`
+	Points       int64     `json:"points"`
+	LedgerPoints int64     `json:"ledger_points"`
+	FoundAt      time.Time `json:"found_at"`
+}
+
+// BalanceStore checks users.points against the ledger.
+type BalanceStore interface {
+	// RecordDiscrepancies replaces the recorded discrepancies with the
+	// users whose balance differs from their ledger sum now, deleted users
+	// aside, and returns how many there are.
+	RecordDiscrepancies(ctx context.Context, at time.Time) (int64, error)
+	// ListDiscrepancies pages through them by user id.
+	ListDiscrepancies(ctx context.Context, afterUserID int64, limit int) ([]Discrepancy, error)
+	DeleteDiscrepancy(ctx context.Context, userID int64) error
+	// ReplayPoints rebuilds the user's balance from their stream: each
+	// entry's Balance is worked out again in Seq order and the balance set
+	// to the last, even below zero, as merged debits may take it. It
+	// returns the balance before and after, or ErrNotFound for unknown or
+	// deleted users.
+	ReplayPoints(ctx context.Context, userID int64) (before, after int64, err error)
+}
+
+// ReportCounts are activity counts over a span of UTC days. ActiveUsers
+// completed a task, sent a transfer or set their referrer, each counted
+// once. PointsIssued and PointsRevoked are ledger credits and debits other
+// than transfers, which only move points. ReferredNewUsers are the NewUsers
+// who have a referrer.
+type ReportCounts struct {
+	ActiveUsers      int64 `json:"active_users"`
+	NewUsers         int64 `json:"new_users"`
+	ReferredNewUsers int64 `json:"referred_new_users"`
+	TasksCompleted   int64 `json:"tasks_completed"`
+	PointsIssued     int64 `json:"points_issued"`
+	PointsRevoked    int64 `json:"points_revoked"`
+	Referrals        int64 `json:"referrals"`
+}
+
+// ReportDay is ReportCounts for one UTC day, dated YYYY-MM-DD.
+type ReportDay struct {
+	Date string `json:"date"`
+	ReportCounts
+}
+
+type ReportStore interface {
+	// ReportDays counts activity per UTC day in [from, to), leaving out
+	// days without any.
+	ReportDays(ctx context.Context, from, to time.Time) ([]ReportDay, error)
+	ReportTotals(ctx context.Context, from, to time.Time) (ReportCounts, error)
+}
+
+type TeamStore interface {
+	// CreateTeam and RenameTeam return ErrConflict when another team has
+	// the name, ignoring case.
+	CreateTeam(ctx context.Context, name string) (Team, error)
+	GetTeam(ctx context.Context, id int64) (Team, error)
+	RenameTeam(ctx context.Context, id int64, name string) error
+	// DeleteTeam drops the team and its memberships.
+	DeleteTeam(ctx context.Context, id int64) error
+	// TeamMembers lists members in the order they joined.
+	TeamMembers(ctx context.Context, id int64) ([]TeamMember, error)
+	// UserTeam returns the id of the user's team, ErrNotFound if they have
+	// none.
+	UserTeam(ctx context.Context, userID int64) (int64, error)
+	// AddTeamMember returns ErrConflict if the user is already in a team.
+	AddTeamMember(ctx context.Context, teamID, userID int64) error
+	// RemoveTeamMember returns ErrNotFound if the user isn't in the team.
+	RemoveTeamMember(ctx context.Context, teamID, userID int64) error
+	// TeamLeaderboard is Leaderboard for teams, by lifetime points.
+	TeamLeaderboard(ctx context.Context, limit int, after *LeaderboardCursor) ([]TeamEntry, error)
+	CountTeams(ctx context.Context) (int64, error)
+}
+
+type SeasonStore interface {
+	// CreateSeason and UpdateSeason return ErrConflict when the window
+	// overlaps another season's.
+	CreateSeason(ctx context.Context, name string, startsAt, endsAt time.Time) (Season, error)
+	GetSeason(ctx context.Context, id int64) (Season, error)
+	// ListSeasons lists every season, latest first.
+	ListSeasons(ctx context.Context) ([]Season, error)
+	UpdateSeason(ctx context.Context, id int64, name string, startsAt, endsAt time.Time) error
+	// DeleteSeason drops the season with its points and results.
+	DeleteSeason(ctx context.Context, id int64) error
+	// EndedSeasons lists seasons that are over but not archived.
+	EndedSeasons(ctx context.Context) ([]Season, error)
+	// ArchiveSeason ranks the season's users into season_results, leaving
+	// out deleted and hidden ones, and drops its season_points. It returns
+	// ErrNotFound if the season is already archived.
+	ArchiveSeason(ctx context.Context, id int64) error
+	// SeasonLeaderboard is Leaderboard for one season: live from
+	// season_points until it is archived, from season_results after. In
+	// archived results, users who have since been deleted or hidden keep
+	// their place as anonymous.
+	SeasonLeaderboard(ctx context.Context, id int64, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error)
+	// SeasonUsers counts the users on the season's leaderboard, hidden ones
+	// included while it runs.
+	SeasonUsers(ctx context.Context, id int64) (int64, error)
+}
+
+type CampaignStore interface {
+	CreateCampaign(ctx context.Context, c Campaign) (Campaign, error)
+	GetCampaign(ctx context.Context, id int64) (Campaign, error)
+	// ListCampaigns lists every campaign, latest first.
+	ListCampaigns(ctx context.Context) ([]Campaign, error)
+	// RunningCampaigns lists the campaigns whose window holds now, oldest
+	// first.
+	RunningCampaigns(ctx context.Context) ([]Campaign, error)
+	// UpdateCampaign replaces the campaign's fields and tasks, all but ID
+	// and CreatedAt.
+	UpdateCampaign(ctx context.Context, c Campaign) error
+	// DeleteCampaign drops the campaign with its tasks and awards.
+	DeleteCampaign(ctx context.Context, id int64) error
+	AddCampaignAward(ctx context.Context, a CampaignAward) error
+	CampaignStats(ctx context.Context, id int64) (CampaignStats, error)
+}
+
+// UserLevel is the highest level a user has reached, 0 before their first
+// level-up was recorded, with their current points.
+type UserLevel struct {
+	Level  int
+	Points int64
+}
+
+type LevelStore interface {
+	// UserLevels returns the level reached and points of each of ids that
+	// exists.
+	UserLevels(ctx context.Context, ids []int64) (map[int64]UserLevel, error)
+	// RaiseUserLevel records level as reached; it never lowers the level.
+	RaiseUserLevel(ctx context.Context, userID int64, level int) error
+}
+
+type AwardRuleStore interface {
+	CreateAwardRule(ctx context.Context, r AwardRule) (AwardRule, error)
+	GetAwardRule(ctx context.Context, id int64) (AwardRule, error)
+	// ListAwardRules lists rules in the order they apply, leaving out
+	// disabled ones when enabledOnly.
+	ListAwardRules(ctx context.Context, enabledOnly bool) ([]AwardRule, error)
+	// UpdateAwardRule replaces every field but ID and CreatedAt.
+	UpdateAwardRule(ctx context.Context, r AwardRule) error
+	DeleteAwardRule(ctx context.Context, id int64) error
+}
+
+type RoleStore interface {
+	Permissions(ctx context.Context, userID int64, extraRoles []string) ([]string, error)
+	ListRoles(ctx context.Context) ([]Role, error)
+	UserRoles(ctx context.Context, userID int64) ([]string, error)
+	AssignRole(ctx context.Context, userID int64, role string) error
+	RevokeRole(ctx context.Context, userID int64, role string) error
+}
+
+// Queries is everything that can run either directly or inside a transaction.
+type Queries interface {
+	UserStore
+	ReferralLinkStore
+	TaskStore
+	CategoryStore
+	FlagStore
+	MaintenanceStore
+	TranslationStore
+	SubmissionStore
+	NotificationStore
+	PointStore
+	RankStore
+	TokenStore
+	IdentityStore
+	MergeStore
+	ReplicationStore
+	IdempotencyStore
+	RoleStore
+	StreakStore
+	PasswordResetStore
+	CallbackStore
+	AuditStore
+	WebhookStore
+	OutboxStore
+	ExportStore
+	TeamStore
+	SeasonStore
+	CampaignStore
+	AwardRuleStore
+	LevelStore
+	ReportStore
+	BalanceStore
+}
+
+// JobStore keeps the scheduler's job locks and the slots jobs last ran
+// for, in job_runs. Postgres locks are advisory locks held on a connection
+// of their own, so they span instances; SQLite and the memory store only
+// lock within the process.
+type JobStore interface {
+	// TryLockJob takes the job's lock unless it is held; ok is false
+	// then. Otherwise unlock must be called.
+	TryLockJob(ctx context.Context, name string) (unlock func(), ok bool, err error)
+	// ClaimJobRun records that the job's run for slot has started. It
+	// reports false if that slot, or a later one, was claimed already.
+	ClaimJobRun(ctx context.Context, name string, slot time.Time) (bool, error)
+	FinishJobRun(ctx context.Context, name string, slot time.Time, errMsg string) error
+}
+
+type Store interface {
+	Queries
+	JobStore
+	// InTx runs fn in a serializable transaction, committing if fn returns nil.
+	// It may run fn again if the transaction loses a serialization conflict.
+	InTx(ctx context.Context, fn func(q Queries) error) error
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+// Permissions returns the permissions granted by the user's roles plus any
+// extra roles (e.g. one carried by the token).
+func (p *Postgres) Permissions(ctx context.Context, userID int64, extraRoles []string) ([]string, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT DISTINCT permission FROM role_permissions
+		WHERE role IN (SELECT role FROM user_roles WHERE user_id=$1)
+		   OR role = ANY($2)
+	`, userID, extraRoles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var perms []string
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	return perms, rows.Err()
+}
+
+func (p *Postgres) ListRoles(ctx context.Context) ([]Role, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT r.name, r.description, COALESCE(string_agg(rp.permission, ',' ORDER BY rp.permission), '')
+		FROM roles r LEFT JOIN role_permissions rp ON rp.role = r.name
+		GROUP BY r.name, r.description
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []Role{}
+	for rows.Next() {
+		var (
+			r     Role
+			perms string
+		)
+		if err := rows.Scan(&r.Name, &r.Description, &perms); err != nil {
+			return nil, err
+		}
+		r.Permissions = []string{}
+		if perms != "" {
+			r.Permissions = strings.Split(perms, ",")
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+func (p *Postgres) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := p.q.QueryContext(ctx, `SELECT role FROM user_roles WHERE user_id=$1 ORDER BY role`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []string{}
+	for rows.Next() {
+		var r string
+		if err := rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// AssignRole is a no-op when the user already holds the role; it returns
+// ErrNotFound when the role or user doesn't exist.
+func (p *Postgres) AssignRole(ctx context.Context, userID int64, role string) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO user_roles (user_id, role) VALUES ($1, $2)
+		ON CONFLICT (user_id, role) DO NOTHING
+	`, userID, role)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (p *Postgres) RevokeRole(ctx context.Context, userID int64, role string) error {
+	_, err := p.q.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id=$1 AND role=$2`, userID, role)
+	return err
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// similarityThreshold is how similar a username must be to match without
+// sharing the prefix: pg_trgm's default for the % operator.
+const similarityThreshold = 0.3
+
+func (p *Postgres) FindUsers(ctx context.Context, q UserQuery) ([]UserMatch, error) {
+	visible := ""
+	if q.PublicOnly {
+		visible = `AND leaderboard_visibility = 'public'`
+	}
+	var after, afterID any
+	if q.After != nil {
+		after, afterID = q.After.Score, q.After.ID
+	}
+	rows, err := p.q.QueryContext(ctx, `
+		WITH m AS (
+			SELECT id, username, username ILIKE $2 AS prefix, similarity(username, $1) AS sim
+			FROM users
+			WHERE deleted_at IS NULL AND (username ILIKE $2 OR username % $1) `+visible+`
+		), scored AS (
+			SELECT *, (CASE WHEN prefix THEN 1000 ELSE 0 END + round(sim * 1000))::int AS score FROM m
+		)
+		SELECT id, username, prefix, sim, score FROM scored
+		WHERE $3::int IS NULL OR score < $3 OR (score = $3 AND id > $4)
+		ORDER BY score DESC, id
+		LIMIT $5
+	`, q.Text, likePrefix(q.Text), after, afterID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []UserMatch{}
+	for rows.Next() {
+		var m UserMatch
+		if err := rows.Scan(&m.ID, &m.Username, &m.Prefix, &m.Similarity, &m.Score); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// likePrefix is a LIKE pattern matching strings that start with s.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// matchUsers scores candidates, id and username pairs, against q as
+// Postgres does, for the stores without pg_trgm.
+func matchUsers(q UserQuery, candidates []UserMatch) []UserMatch {
+	prefix, grams := strings.ToLower(q.Text), trigrams(q.Text)
+	out := []UserMatch{}
+	for _, m := range candidates {
+		m.Prefix = strings.HasPrefix(strings.ToLower(m.Username), prefix)
+		m.Similarity = similarity(grams, trigrams(m.Username))
+		if !m.Prefix && m.Similarity < similarityThreshold {
+			continue
+		}
+		m.Score = int(math.Round(m.Similarity * 1000))
+		if m.Prefix {
+			m.Score += 1000
+		}
+		if a := q.After; a != nil && (m.Score > a.Score || m.Score == a.Score && m.ID <= a.ID) {
+			continue
+		}
+		out = append(out, m)
+	}
+	slices.SortFunc(out, func(a, b UserMatch) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.ID, b.ID))
+	})
+	return out[:min(len(out), q.Limit)]
+}
+
+// trigrams are the distinct trigrams of s as pg_trgm takes them: each run
+// of letters and digits, lowercased and padded with two spaces in front
+// and one behind.
+func trigrams(s string) map[string]bool {
+	grams := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			grams[string(r[i:i+3])] = true
+		}
+	}
+	return grams
+}
+
+// similarity is pg_trgm's: the trigrams a and b share over all they have.
+func similarity(a, b map[string]bool) float64 {
+	shared := 0
+	for g := range a {
+		if b[g] {
+			shared++
+		}
+	}
+	all := len(a) + len(b) - shared
+	if all == 0 {
+		return 0
+	}
+	return float64(shared) / float64(all)
+}
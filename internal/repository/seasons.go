@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const seasonColumns = `id, name, starts_at, ends_at, archived_at, created_at`
+
+func scanSeason(sc interface{ Scan(...any) error }) (Season, error) {
+	var se Season
+	err := sc.Scan(&se.ID, &se.Name, &se.StartsAt, &se.EndsAt, &se.ArchivedAt, &se.CreatedAt)
+	se.setStatus(time.Now())
+	return se, err
+}
+
+func scanSeasons(rows *sql.Rows, err error) ([]Season, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Season{}
+	for rows.Next() {
+		se, err := scanSeason(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, se)
+	}
+	return out, rows.Err()
+}
+
+// scanSeasonResults reads archived standings, which carry their rank.
+func scanSeasonResults(rows *sql.Rows, err error) ([]LeaderboardEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LeaderboardEntry
+	for rows.Next() {
+		var it LeaderboardEntry
+		if err := rows.Scan(&it.ID, &it.Username, &it.Points, &it.Rank, &it.Anonymous); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) CreateSeason(ctx context.Context, name string, startsAt, endsAt time.Time) (Season, error) {
+	se, err := scanSeason(p.q.QueryRowContext(ctx, `
+		INSERT INTO seasons (name, starts_at, ends_at)
+		SELECT $1, $2::timestamptz, $3::timestamptz
+		WHERE NOT EXISTS (SELECT 1 FROM seasons WHERE starts_at < $3::timestamptz AND ends_at > $2::timestamptz)
+		RETURNING `+seasonColumns, name, startsAt, endsAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return se, ErrConflict
+	}
+	return se, err
+}
+
+func (p *Postgres) GetSeason(ctx context.Context, id int64) (Season, error) {
+	se, err := scanSeason(p.q.QueryRowContext(ctx, `SELECT `+seasonColumns+` FROM seasons WHERE id=$1`, id))
+	return se, notFound(err)
+}
+
+func (p *Postgres) ListSeasons(ctx context.Context) ([]Season, error) {
+	return scanSeasons(p.q.QueryContext(ctx, `SELECT `+seasonColumns+` FROM seasons ORDER BY starts_at DESC, id DESC`))
+}
+
+func (p *Postgres) UpdateSeason(ctx context.Context, id int64, name string, startsAt, endsAt time.Time) error {
+	if _, err := p.GetSeason(ctx, id); err != nil {
+		return err
+	}
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE seasons SET name=$2, starts_at=$3, ends_at=$4
+		WHERE id=$1 AND NOT EXISTS (
+			SELECT 1 FROM seasons o WHERE o.id <> $1 AND o.starts_at < $4 AND o.ends_at > $3
+		)
+	`, id, name, startsAt, endsAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteSeason(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM seasons WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) EndedSeasons(ctx context.Context) ([]Season, error) {
+	return scanSeasons(p.q.QueryContext(ctx, `
+		SELECT `+seasonColumns+` FROM seasons
+		WHERE ends_at <= now() AND archived_at IS NULL
+		ORDER BY ends_at
+	`))
+}
+
+func (p *Postgres) ArchiveSeason(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `UPDATE seasons SET archived_at = now() WHERE id=$1 AND archived_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := p.q.ExecContext(ctx, `
+		INSERT INTO season_results (season_id, user_id, rank, points)
+		SELECT $1, sp.user_id, ROW_NUMBER() OVER (ORDER BY sp.points DESC, sp.user_id ASC), sp.points
+		FROM season_points sp JOIN users u ON u.id = sp.user_id
+		WHERE sp.season_id = $1 AND u.deleted_at IS NULL AND u.leaderboard_visibility <> 'hidden'
+	`, id); err != nil {
+		return err
+	}
+	_, err = p.q.ExecContext(ctx, `DELETE FROM season_points WHERE season_id=$1`, id)
+	return err
+}
+
+const seasonRows = `
+	SELECT u.id, u.username, sp.points, u.leaderboard_visibility AS visibility
+	FROM season_points sp JOIN users u ON u.id = sp.user_id
+	WHERE sp.season_id = $1 AND u.deleted_at IS NULL`
+
+func (p *Postgres) SeasonLeaderboard(ctx context.Context, id int64, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	se, err := p.GetSeason(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if se.ArchivedAt == nil {
+		return p.leaderboard(ctx, seasonRows, id, limit, after)
+	}
+	const cols = `u.id, u.username, r.points, r.rank, u.deleted_at IS NOT NULL OR u.leaderboard_visibility <> 'public'`
+	if after == nil {
+		return scanSeasonResults(p.q.QueryContext(ctx, `
+			SELECT `+cols+` FROM season_results r JOIN users u ON u.id = r.user_id
+			WHERE r.season_id = $1
+			ORDER BY r.rank
+			LIMIT $2
+		`, id, limit))
+	}
+	return scanSeasonResults(p.q.QueryContext(ctx, `
+		SELECT `+cols+` FROM season_results r JOIN users u ON u.id = r.user_id
+		WHERE r.season_id = $1 AND (r.points < $2 OR (r.points = $2 AND r.user_id > $3))
+		ORDER BY r.rank
+		LIMIT $4
+	`, id, after.Points, after.ID, limit))
+}
+
+func (p *Postgres) SeasonUsers(ctx context.Context, id int64) (int64, error) {
+	// archiving moves a season's users from one table to the other
+	var n int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM season_results WHERE season_id = $1)
+		     + (SELECT COUNT(*) FROM season_points sp JOIN users u ON u.id = sp.user_id
+		        WHERE sp.season_id = $1 AND u.deleted_at IS NULL)
+	`, id).Scan(&n)
+	return n, err
+}
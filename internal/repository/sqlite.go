@@ -0,0 +1,883 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLite implements Store on a single SQLite database for deployments too
+// small to run Postgres. The schema comes from migrations.ApplySQLite.
+//
+// Times are computed here and written in UTC; the driver must be opened
+// with _time_format=sqlite so they are stored in one text format and
+// compare correctly in SQL. Windows follow periodStart, as in Memory.
+// Queries run as prepared statements (see stmts).
+type SQLite struct {
+	db     *sql.DB
+	q      dbtx
+	stmts  stmts
+	region string
+	jobs   *localLocks
+}
+
+// NewSQLite returns a store that tags ledger writes with region. SQLite has
+// a single writer, so db should be limited to one open connection: requests
+// then queue in database/sql instead of failing with SQLITE_BUSY, and
+// transactions run one at a time without conflicts.
+func NewSQLite(db *sql.DB, region string) *SQLite {
+	st := newStmts(db)
+	return &SQLite{db: db, q: st, stmts: st, region: region, jobs: &localLocks{}}
+}
+
+// InTx runs fn in a transaction, committing if fn returns nil.
+func (s *SQLite) InTx(ctx context.Context, fn func(q Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	st := s.stmts.inTx(tx)
+	if err := fn(&SQLite{db: s.db, q: st, stmts: st, region: s.region}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+// window is the start of the current period window as stored in
+// user_period_points.
+func window(period string) time.Time {
+	return periodStart(period, time.Now()).UTC()
+}
+
+// utc converts an optional time for storage.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func sqliteCode(err error) int {
+	var e *sqlite.Error
+	if errors.As(err, &e) {
+		return e.Code()
+	}
+	return 0
+}
+
+func isSQLiteUnique(err error) bool {
+	code := sqliteCode(err)
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// isSQLiteInterrupt reports a statement the driver interrupted because its
+// context ended.
+func isSQLiteInterrupt(err error) bool {
+	return sqliteCode(err) == sqlite3.SQLITE_INTERRUPT
+}
+
+// isSQLiteUnavailable reports an interrupted statement or a database file
+// that can't be read, written or opened.
+func isSQLiteUnavailable(err error) bool {
+	switch sqliteCode(err) & 0xff {
+	case sqlite3.SQLITE_INTERRUPT, sqlite3.SQLITE_IOERR, sqlite3.SQLITE_FULL, sqlite3.SQLITE_CANTOPEN:
+		return true
+	}
+	return false
+}
+
+func isSQLiteForeignKey(err error) bool {
+	return sqliteCode(err) == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+// sqliteNegativeBalance maps the users_points_nonnegative trigger's error
+// to ErrNegativeBalance.
+func sqliteNegativeBalance(err error) error {
+	if sqliteCode(err) == sqlite3.SQLITE_CONSTRAINT_TRIGGER && strings.Contains(err.Error(), "users_points_nonnegative") {
+		return ErrNegativeBalance
+	}
+	return err
+}
+
+func (s *SQLite) GetUser(ctx context.Context, id int64) (User, error) {
+	u, err := scanUser(s.q.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users WHERE id=?1 AND deleted_at IS NULL
+	`, id))
+	return u, notFound(err)
+}
+
+func (s *SQLite) CreateUser(ctx context.Context, username, passwordHash, homeRegion string) (User, error) {
+	u, err := scanUser(s.q.QueryRowContext(ctx, `
+		INSERT INTO users (username, password_hash, home_region, created_at)
+		VALUES (?1, ?2, ?3, ?4)
+		RETURNING `+userColumns,
+		username, passwordHash, homeRegion, utcNow()))
+	if isSQLiteUnique(err) {
+		return u, ErrConflict
+	}
+	return u, err
+}
+
+func (s *SQLite) GetPasswordHash(ctx context.Context, username string) (int64, string, error) {
+	var id int64
+	var hash sql.NullString
+	err := s.q.QueryRowContext(ctx, `
+		SELECT id, password_hash FROM users WHERE username=?1
+	`, username).Scan(&id, &hash)
+	return id, hash.String, notFound(err)
+}
+
+func (s *SQLite) GetHomeRegion(ctx context.Context, id int64) (string, error) {
+	var home sql.NullString
+	err := s.q.QueryRowContext(ctx, `SELECT home_region FROM users WHERE id=?1`, id).Scan(&home)
+	return home.String, notFound(err)
+}
+
+func (s *SQLite) SetReferrer(ctx context.Context, userID, referrerID int64) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE users SET referrer_id=?1 WHERE id=?2`, referrerID, userID)
+	return err
+}
+
+func (s *SQLite) CreateReferral(ctx context.Context, r Referral) error {
+	now := utcNow()
+	var paidAt *time.Time
+	if r.Status == ReferralPaid {
+		paidAt = &now
+	}
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO referrals (referrer_id, referred_id, bonus_referrer, bonus_referred, status, created_at, paid_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
+	`, r.ReferrerID, r.ReferredID, r.BonusReferrer, r.BonusReferred, r.Status, now, paidAt)
+	return err
+}
+
+func (s *SQLite) DueReferrals(ctx context.Context, m ReferralMilestone, limit int) ([]Referral, error) {
+	rows, err := s.q.QueryContext(ctx, dueReferralsQuery("?1", "?2", "?3"), m.Tasks, m.Points, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanReferrals(rows)
+}
+
+func (s *SQLite) PayReferral(ctx context.Context, referrerID, referredID int64) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE referrals SET status = 'paid', paid_at = ?3
+		WHERE referrer_id = ?1 AND referred_id = ?2 AND status = 'pending'
+	`, referrerID, referredID, utcNow())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) ExpireReferrals(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `UPDATE referrals SET status = 'expired' WHERE status = 'pending' AND created_at < ?1`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLite) ReferrerBonuses(ctx context.Context, referrerID int64, day, month time.Time) (ReferrerBonusCounts, error) {
+	var c ReferrerBonusCounts
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE created_at >= ?2), COUNT(*) FILTER (WHERE created_at >= ?3), COUNT(*)
+		FROM referrals
+		WHERE referrer_id=?1 AND bonus_referrer > 0 AND status <> 'expired'
+	`, referrerID, day.UTC(), month.UTC()).Scan(&c.Day, &c.Month, &c.Total)
+	return c, err
+}
+
+func (s *SQLite) ListReferrals(ctx context.Context, userID int64) ([]Referral, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT referrer_id, referred_id, bonus_referrer, bonus_referred, status, created_at, paid_at
+		FROM referrals
+		WHERE referrer_id=?1 OR referred_id=?1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanReferrals(rows)
+}
+
+func (s *SQLite) GetProfile(ctx context.Context, id int64) (Profile, error) {
+	var pr Profile
+	err := s.q.QueryRowContext(ctx, `
+		SELECT display_name, avatar_url, timezone, locale, version FROM users WHERE id=?1 AND deleted_at IS NULL
+	`, id).Scan(&pr.DisplayName, &pr.AvatarURL, &pr.Timezone, &pr.Locale, &pr.Version)
+	return pr, notFound(err)
+}
+
+func (s *SQLite) UpdateProfile(ctx context.Context, id int64, pr Profile) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE users SET display_name=?2, avatar_url=?3, timezone=?4, locale=?5, version = version + 1
+		WHERE id=?1 AND deleted_at IS NULL AND version=?6
+	`, id, pr.DisplayName, pr.AvatarURL, pr.Timezone, pr.Locale, pr.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return s.CheckUserVersion(ctx, id, pr.Version)
+	}
+	return nil
+}
+
+// CheckUserVersion needs no row lock: the single connection already keeps
+// other writers out until the transaction ends.
+func (s *SQLite) CheckUserVersion(ctx context.Context, id, version int64) error {
+	var v int64
+	err := s.q.QueryRowContext(ctx, `SELECT version FROM users WHERE id=?1 AND deleted_at IS NULL`, id).Scan(&v)
+	if err != nil {
+		return notFound(err)
+	}
+	if v != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (s *SQLite) GetSettings(ctx context.Context, id int64) (Settings, error) {
+	var st Settings
+	err := s.q.QueryRowContext(ctx, `
+		SELECT leaderboard_visibility FROM users WHERE id=?1 AND deleted_at IS NULL
+	`, id).Scan(&st.LeaderboardVisibility)
+	return st, notFound(err)
+}
+
+func (s *SQLite) UpdateSettings(ctx context.Context, id int64, st Settings) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE users SET leaderboard_visibility=?2 WHERE id=?1 AND deleted_at IS NULL
+	`, id, st.LeaderboardVisibility)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) Profiles(ctx context.Context, ids []int64) (map[int64]Profile, error) {
+	out := make(map[int64]Profile, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, display_name, avatar_url, timezone, locale FROM users
+		WHERE id IN (?`+strings.Repeat(`, ?`, len(ids)-1)+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id int64
+			pr Profile
+		)
+		if err := rows.Scan(&id, &pr.DisplayName, &pr.AvatarURL, &pr.Timezone, &pr.Locale); err != nil {
+			return nil, err
+		}
+		out[id] = pr
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) DeleteUser(ctx context.Context, id int64) error {
+	now := utcNow()
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO deleted_users (user_id, username, password_hash, display_name, avatar_url, timezone, locale, deleted_at)
+		SELECT id, username, password_hash, display_name, avatar_url, timezone, locale, ?2
+		FROM users WHERE id=?1 AND deleted_at IS NULL
+	`, id, now)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	// ':' can't appear in a registered username, so this one stays free
+	if _, err := s.q.ExecContext(ctx, `
+		UPDATE users
+		SET deleted_at=?2, username='deleted:' || id, password_hash=NULL,
+		    display_name='', avatar_url='', timezone='', locale=''
+		WHERE id=?1
+	`, id, now); err != nil {
+		return err
+	}
+	_, err = s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?2 WHERE user_id=?1 AND revoked_at IS NULL
+	`, id, now)
+	return err
+}
+
+func (s *SQLite) RestoreUser(ctx context.Context, id int64, since time.Time) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE users
+		SET deleted_at=NULL, username=d.username, password_hash=d.password_hash,
+		    display_name=d.display_name, avatar_url=d.avatar_url, timezone=d.timezone, locale=d.locale
+		FROM deleted_users d
+		WHERE users.id=?1 AND d.user_id=users.id AND d.deleted_at >= ?2
+	`, id, since.UTC())
+	if isSQLiteUnique(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = s.q.ExecContext(ctx, `DELETE FROM deleted_users WHERE user_id=?1`, id)
+	return err
+}
+
+func (s *SQLite) SearchUsers(ctx context.Context, f UserFilter) ([]User, error) {
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, cond)
+	}
+	if f.UsernamePrefix != "" {
+		add("instr(username, ?) = 1", f.UsernamePrefix)
+	}
+	if f.MinPoints != nil {
+		add("points >= ?", *f.MinPoints)
+	}
+	if f.CreatedAfter != nil {
+		add("created_at > ?", f.CreatedAfter.UTC())
+	}
+	if f.Status == UserBanned {
+		where = append(where, statusCond(f.Status))
+	} else if f.Status != "" {
+		add(statusCond(f.Status), utcNow())
+	}
+	if f.Before > 0 {
+		add("id < ?", f.Before)
+	}
+	args = append(args, f.Limit)
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanUsers(rows)
+}
+
+func (s *SQLite) SetUserStatus(ctx context.Context, id int64, status, reason string, until *time.Time) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE users SET status=?2, status_reason=?3, status_until=?4
+		WHERE id=?1 AND deleted_at IS NULL
+	`, id, status, reason, utc(until))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if status != UserBanned {
+		return nil
+	}
+	_, err = s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?2 WHERE user_id=?1 AND revoked_at IS NULL
+	`, id, utcNow())
+	return err
+}
+
+func (s *SQLite) ClearReferrer(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE users SET referrer_id=NULL WHERE id=?1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = s.q.ExecContext(ctx, `DELETE FROM referrals WHERE referred_id=?1`, id)
+	return err
+}
+
+func (s *SQLite) PurgeDeletedUsers(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM deleted_users WHERE deleted_at < ?1`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sqliteTaskAvailable is taskAvailable with the current time as ?1.
+const sqliteTaskAvailable = `(active AND (starts_at IS NULL OR starts_at <= ?1) AND (ends_at IS NULL OR ends_at > ?1))`
+
+const sqliteTaskColumns = `code, title, points, description, active, starts_at, ends_at, verifier, verifier_config,
+	COALESCE((SELECT group_concat(d.requires_code, ',' ORDER BY d.requires_code)
+	          FROM task_dependencies d WHERE d.task_code = tasks.code), ''),
+	COALESCE(category, ''),
+	COALESCE((SELECT group_concat(g.tag, ',' ORDER BY g.tag) FROM task_tags g WHERE g.task_code = tasks.code), ''),
+	max_completions, max_completions_per_user, completions, requires_review`
+
+func (s *SQLite) GetTask(ctx context.Context, code string) (Task, error) {
+	t, err := scanTask(s.q.QueryRowContext(ctx, `SELECT `+sqliteTaskColumns+` FROM tasks WHERE code=?1`, code))
+	return t, notFound(err)
+}
+
+func (s *SQLite) ListTasks(ctx context.Context, availableOnly bool) ([]Task, error) {
+	var (
+		where string
+		args  []any
+	)
+	if availableOnly {
+		where = `WHERE ` + sqliteTaskAvailable
+		args = append(args, utcNow())
+	}
+	rows, err := s.q.QueryContext(ctx, `SELECT `+sqliteTaskColumns+` FROM tasks `+where+` ORDER BY code`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tasks := []Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+func (s *SQLite) CreateTask(ctx context.Context, t Task) (Task, error) {
+	out, err := scanTask(s.q.QueryRowContext(ctx, `
+		INSERT INTO tasks (code, title, points, description, active, starts_at, ends_at, verifier, verifier_config, created_at, category,
+		                   max_completions, max_completions_per_user, requires_review)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, NULLIF(?11, ''), ?12, ?13, ?14)
+		RETURNING `+sqliteTaskColumns,
+		t.Code, t.Title, t.Points, t.Description, t.Active, utc(t.StartsAt), utc(t.EndsAt), t.Verifier, t.VerifierConfig, utcNow(), t.Category,
+		t.MaxCompletions, t.MaxCompletionsPerUser, t.RequiresReview))
+	if isSQLiteUnique(err) {
+		return out, ErrConflict
+	}
+	return out, err
+}
+
+func (s *SQLite) UpdateTask(ctx context.Context, t Task) (Task, error) {
+	out, err := scanTask(s.q.QueryRowContext(ctx, `
+		UPDATE tasks
+		SET title=?2, points=?3, description=?4, active=?5, starts_at=?6, ends_at=?7,
+		    verifier=?8, verifier_config=?9, category=NULLIF(?10, ''),
+		    max_completions=?11, max_completions_per_user=?12, requires_review=?13
+		WHERE code=?1
+		RETURNING `+sqliteTaskColumns,
+		t.Code, t.Title, t.Points, t.Description, t.Active, utc(t.StartsAt), utc(t.EndsAt), t.Verifier, t.VerifierConfig, t.Category,
+		t.MaxCompletions, t.MaxCompletionsPerUser, t.RequiresReview))
+	return out, notFound(err)
+}
+
+func (s *SQLite) ArchiveTask(ctx context.Context, code string) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE tasks SET active=false WHERE code=?1`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) AddUserTask(ctx context.Context, userID int64, code string, perUser int) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO user_tasks (user_id, task_code, n, completed_at)
+		SELECT ?1, ?2, COALESCE(MAX(n), 0) + 1, ?4
+		FROM user_tasks WHERE user_id=?1 AND task_code=?2
+		HAVING COALESCE(MAX(n), 0) < ?3
+		ON CONFLICT (user_id, task_code, n) DO NOTHING
+	`, userID, code, perUser, utcNow())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLite) RevokeUserTask(ctx context.Context, userID int64, code string) error {
+	res, err := s.q.ExecContext(ctx, `
+		DELETE FROM user_tasks
+		WHERE user_id=?1 AND task_code=?2
+		  AND n = (SELECT MAX(n) FROM user_tasks WHERE user_id=?1 AND task_code=?2)
+	`, userID, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = s.q.ExecContext(ctx, `UPDATE tasks SET completions = completions - 1 WHERE code=?1 AND completions > 0`, code)
+	return err
+}
+
+func (s *SQLite) ClaimTaskCompletion(ctx context.Context, code string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE tasks SET completions = completions + 1
+		WHERE code=?1 AND (max_completions IS NULL OR completions < max_completions)
+	`, code)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLite) CountUserTask(ctx context.Context, userID int64, code string) (int, error) {
+	var cnt int
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_tasks WHERE user_id=?1 AND task_code=?2
+	`, userID, code).Scan(&cnt)
+	return cnt, err
+}
+
+func (s *SQLite) ListCompletedTasks(ctx context.Context, userID int64) ([]CompletedTask, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT t.code, t.title, t.points, ut.completed_at
+		FROM user_tasks ut
+		JOIN tasks t ON t.code = ut.task_code
+		WHERE ut.user_id=?1
+		ORDER BY ut.completed_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var completed []CompletedTask
+	for rows.Next() {
+		var tc CompletedTask
+		if err := rows.Scan(&tc.Code, &tc.Title, &tc.Points, &tc.CompletedAt); err != nil {
+			return nil, err
+		}
+		completed = append(completed, tc)
+	}
+	return completed, rows.Err()
+}
+
+func (s *SQLite) CompletedTasksPage(ctx context.Context, userID int64, limit int, after *CompletedTaskCursor) ([]CompletedTask, error) {
+	q, args := `
+		SELECT t.code, t.title, t.points, ut.completed_at, ut.n
+		FROM user_tasks ut
+		JOIN tasks t ON t.code = ut.task_code
+		WHERE ut.user_id=?1`, []any{userID, limit}
+	if after != nil {
+		q += ` AND (ut.completed_at, ut.task_code, ut.n) < (?3, ?4, ?5)`
+		args = append(args, after.CompletedAt.UTC(), after.Code, after.N)
+	}
+	rows, err := s.q.QueryContext(ctx, q+` ORDER BY ut.completed_at DESC, ut.task_code DESC, ut.n DESC LIMIT ?2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var completed []CompletedTask
+	for rows.Next() {
+		var tc CompletedTask
+		if err := rows.Scan(&tc.Code, &tc.Title, &tc.Points, &tc.CompletedAt, &tc.N); err != nil {
+			return nil, err
+		}
+		completed = append(completed, tc)
+	}
+	return completed, rows.Err()
+}
+
+func (s *SQLite) CountCompletedTasks(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := s.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_tasks WHERE user_id=?1`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *SQLite) SetTaskPrerequisites(ctx context.Context, code string, requires []string) error {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM task_dependencies WHERE task_code=?1`, code); err != nil {
+		return err
+	}
+	for _, req := range requires {
+		_, err := s.q.ExecContext(ctx, `
+			INSERT INTO task_dependencies (task_code, requires_code) VALUES (?1, ?2)
+			ON CONFLICT DO NOTHING
+		`, code, req)
+		if isSQLiteForeignKey(err) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) TaskDependsOn(ctx context.Context, from, to string) (bool, error) {
+	var found bool
+	err := s.q.QueryRowContext(ctx, `
+		WITH RECURSIVE reqs AS (
+			SELECT requires_code FROM task_dependencies WHERE task_code = ?1
+			UNION
+			SELECT d.requires_code FROM task_dependencies d JOIN reqs r ON d.task_code = r.requires_code
+		)
+		SELECT EXISTS (SELECT 1 FROM reqs WHERE requires_code = ?2)
+	`, from, to).Scan(&found)
+	return found, err
+}
+
+func (s *SQLite) MissingPrerequisites(ctx context.Context, userID int64, code string) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT d.requires_code FROM task_dependencies d
+		WHERE d.task_code = ?2
+		  AND NOT EXISTS (SELECT 1 FROM user_tasks ut WHERE ut.user_id = ?1 AND ut.task_code = d.requires_code)
+		ORDER BY d.requires_code
+	`, userID, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	missing := []string{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		missing = append(missing, c)
+	}
+	return missing, rows.Err()
+}
+
+func (s *SQLite) SetTaskTags(ctx context.Context, code string, tags []string) error {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM task_tags WHERE task_code=?1`, code); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err := s.q.ExecContext(ctx, `
+			INSERT INTO task_tags (task_code, tag) VALUES (?1, ?2)
+			ON CONFLICT DO NOTHING
+		`, code, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Permissions returns the permissions granted by the user's roles plus any
+// extra roles (e.g. one carried by the token).
+func (s *SQLite) Permissions(ctx context.Context, userID int64, extraRoles []string) ([]string, error) {
+	query := `
+		SELECT DISTINCT permission FROM role_permissions
+		WHERE role IN (SELECT role FROM user_roles WHERE user_id=?)`
+	args := []any{userID}
+	if len(extraRoles) > 0 {
+		query += ` OR role IN (?` + strings.Repeat(`, ?`, len(extraRoles)-1) + `)`
+		for _, r := range extraRoles {
+			args = append(args, r)
+		}
+	}
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var perms []string
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	return perms, rows.Err()
+}
+
+func (s *SQLite) ListRoles(ctx context.Context) ([]Role, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT r.name, r.description, COALESCE(group_concat(rp.permission, ',' ORDER BY rp.permission), '')
+		FROM roles r LEFT JOIN role_permissions rp ON rp.role = r.name
+		GROUP BY r.name, r.description
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []Role{}
+	for rows.Next() {
+		var (
+			r     Role
+			perms string
+		)
+		if err := rows.Scan(&r.Name, &r.Description, &perms); err != nil {
+			return nil, err
+		}
+		r.Permissions = []string{}
+		if perms != "" {
+			r.Permissions = strings.Split(perms, ",")
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+func (s *SQLite) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT role FROM user_roles WHERE user_id=?1 ORDER BY role`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []string{}
+	for rows.Next() {
+		var r string
+		if err := rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// AssignRole is a no-op when the user already holds the role; it returns
+// ErrNotFound when the role or user doesn't exist.
+func (s *SQLite) AssignRole(ctx context.Context, userID int64, role string) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO user_roles (user_id, role) VALUES (?1, ?2)
+		ON CONFLICT (user_id, role) DO NOTHING
+	`, userID, role)
+	if isSQLiteForeignKey(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *SQLite) RevokeRole(ctx context.Context, userID int64, role string) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id=?1 AND role=?2`, userID, role)
+	return err
+}
+
+func (s *SQLite) CreateRefreshToken(ctx context.Context, userID int64, familyID, tokenHash string, ttl time.Duration) (int64, error) {
+	if familyID == "" {
+		familyID = newUUID()
+	}
+	now := utcNow()
+	var id int64
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		RETURNING id
+	`, userID, familyID, tokenHash, now.Add(ttl), now).Scan(&id)
+	return id, err
+}
+
+// GetRefreshToken needs no row lock: transactions already run one at a
+// time.
+func (s *SQLite) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	var t RefreshToken
+	err := s.q.QueryRowContext(ctx, `
+		SELECT id, user_id, family_id, expires_at, revoked_at
+		FROM refresh_tokens WHERE token_hash=?1
+	`, tokenHash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.ExpiresAt, &t.RevokedAt)
+	return t, notFound(err)
+}
+
+func (s *SQLite) RotateRefreshToken(ctx context.Context, id, replacedBy int64) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?3, replaced_by = ?2 WHERE id=?1
+	`, id, replacedBy, utcNow())
+	return err
+}
+
+func (s *SQLite) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?2
+		WHERE family_id=?1 AND revoked_at IS NULL
+	`, familyID, utcNow())
+	return err
+}
+
+func (s *SQLite) RevokeRefreshFamilyOf(ctx context.Context, tokenHash string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?2
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash=?1)
+		  AND revoked_at IS NULL
+	`, tokenHash, utcNow())
+	return err
+}
+
+func (s *SQLite) PurgeRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE expires_at < ?1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLite) ClaimIdempotencyKey(ctx context.Context, userID int64, key, requestHash string, lease, ttl time.Duration) (*IdempotentResponse, error) {
+	now := utcNow()
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, locked_until, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET request_hash = excluded.request_hash, locked_until = excluded.locked_until,
+		    created_at = excluded.created_at, status = NULL, content_type = NULL, body = NULL
+		WHERE idempotency_keys.created_at < ?6
+		   OR (idempotency_keys.status IS NULL AND idempotency_keys.locked_until < ?5)
+	`, userID, key, requestHash, now.Add(lease), now, now.Add(-ttl))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil, nil
+	}
+
+	var (
+		out         IdempotentResponse
+		status      sql.NullInt64
+		contentType sql.NullString
+	)
+	err = s.q.QueryRowContext(ctx, `
+		SELECT request_hash, status, content_type, body FROM idempotency_keys
+		WHERE user_id=?1 AND key=?2
+	`, userID, key).Scan(&out.RequestHash, &status, &contentType, &out.Body)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	out.Done = status.Valid
+	out.Status = int(status.Int64)
+	out.ContentType = contentType.String
+	return &out, nil
+}
+
+func (s *SQLite) SaveIdempotentResponse(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status=?3, content_type=?4, body=?5
+		WHERE user_id=?1 AND key=?2
+	`, userID, key, status, contentType, body)
+	return err
+}
+
+func (s *SQLite) ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error {
+	_, err := s.q.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE user_id=?1 AND key=?2 AND status IS NULL
+	`, userID, key)
+	return err
+}
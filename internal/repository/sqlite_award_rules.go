@@ -0,0 +1,50 @@
+package repository
+
+import "context"
+
+func (s *SQLite) CreateAwardRule(ctx context.Context, r AwardRule) (AwardRule, error) {
+	return scanAwardRule(s.q.QueryRowContext(ctx, `
+		INSERT INTO award_rules (name, position, enabled, conditions, multiplier, bonus_points, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?7)
+		RETURNING `+awardRuleColumns,
+		r.Name, r.Position, r.Enabled, string(r.Conditions), r.Multiplier, r.BonusPoints, utcNow()))
+}
+
+func (s *SQLite) GetAwardRule(ctx context.Context, id int64) (AwardRule, error) {
+	r, err := scanAwardRule(s.q.QueryRowContext(ctx, `SELECT `+awardRuleColumns+` FROM award_rules WHERE id=?1`, id))
+	return r, notFound(err)
+}
+
+func (s *SQLite) ListAwardRules(ctx context.Context, enabledOnly bool) ([]AwardRule, error) {
+	return scanAwardRules(s.q.QueryContext(ctx, `
+		SELECT `+awardRuleColumns+` FROM award_rules
+		WHERE enabled OR NOT ?1
+		ORDER BY position, id
+	`, enabledOnly))
+}
+
+func (s *SQLite) UpdateAwardRule(ctx context.Context, r AwardRule) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE award_rules
+		SET name=?2, position=?3, enabled=?4, conditions=?5, multiplier=?6, bonus_points=?7, updated_at=?8
+		WHERE id=?1
+	`, r.ID, r.Name, r.Position, r.Enabled, string(r.Conditions), r.Multiplier, r.BonusPoints, utcNow())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteAwardRule(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM award_rules WHERE id=?1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
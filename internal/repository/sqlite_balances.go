@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (s *SQLite) RecordDiscrepancies(ctx context.Context, at time.Time) (int64, error) {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM point_discrepancies`); err != nil {
+		return 0, err
+	}
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO point_discrepancies (user_id, points, ledger_points, found_at)
+		SELECT u.id, u.points, COALESCE(l.points, 0), ?1
+		FROM users u
+		LEFT JOIN (
+			SELECT user_id, SUM(amount) AS points FROM point_transactions GROUP BY user_id
+		) l ON l.user_id = u.id
+		WHERE u.deleted_at IS NULL AND u.points <> COALESCE(l.points, 0)
+	`, at.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLite) ListDiscrepancies(ctx context.Context, afterUserID int64, limit int) ([]Discrepancy, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT d.user_id, u.username, d.points, d.ledger_points, d.found_at
+		FROM point_discrepancies d JOIN users u ON u.id = d.user_id
+		WHERE d.user_id > ?1
+		ORDER BY d.user_id
+		LIMIT ?2
+	`, afterUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDiscrepancies(rows)
+}
+
+func (s *SQLite) DeleteDiscrepancy(ctx context.Context, userID int64) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM point_discrepancies WHERE user_id=?1`, userID)
+	return err
+}
+
+func (s *SQLite) ReplayPoints(ctx context.Context, userID int64) (before, after int64, err error) {
+	err = s.q.QueryRowContext(ctx, `SELECT points FROM users WHERE id=?1 AND deleted_at IS NULL`, userID).Scan(&before)
+	if err != nil {
+		return 0, 0, notFound(err)
+	}
+	if _, err := s.q.ExecContext(ctx, `
+		UPDATE point_transactions SET balance = s.balance
+		FROM (
+			SELECT id, SUM(amount) OVER (ORDER BY user_seq) AS balance
+			FROM point_transactions WHERE user_id=?1
+		) AS s
+		WHERE point_transactions.id = s.id AND point_transactions.balance <> s.balance
+	`, userID); err != nil {
+		return 0, 0, err
+	}
+	// as in Postgres, the balance follows the stream even below zero
+	if _, err := s.q.ExecContext(ctx, `INSERT INTO merging_accruals DEFAULT VALUES`); err != nil {
+		return 0, 0, err
+	}
+	err = s.q.QueryRowContext(ctx, `
+		UPDATE users SET
+			points = (SELECT COALESCE(SUM(amount), 0) FROM point_transactions WHERE user_id=?1),
+			points_seq = (SELECT COALESCE(MAX(user_seq), 0) FROM point_transactions WHERE user_id=?1),
+			version = version + (points <> (SELECT COALESCE(SUM(amount), 0) FROM point_transactions WHERE user_id=?1))
+		WHERE id=?1
+		RETURNING points
+	`, userID).Scan(&after)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = s.q.ExecContext(ctx, `DELETE FROM merging_accruals`)
+	return before, after, err
+}
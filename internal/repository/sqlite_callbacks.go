@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (s *SQLite) ClaimCallbackSignature(ctx context.Context, partner, signature string, expiresAt, now time.Time) (bool, error) {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM callback_signatures WHERE expires_at < ?1`, now.UTC()); err != nil {
+		return false, err
+	}
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO callback_signatures (partner, signature, expires_at) VALUES (?1, ?2, ?3)
+		ON CONFLICT DO NOTHING
+	`, partner, signature, expiresAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLite) AddPartnerCompletion(ctx context.Context, c PartnerCompletion) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO partner_completions (partner, reference, user_id, task_code, awarded, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+		ON CONFLICT DO NOTHING
+	`, c.Partner, c.Reference, c.UserID, c.TaskCode, c.Awarded, utcNow())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
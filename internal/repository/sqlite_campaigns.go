@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+func (s *SQLite) setCampaignTasks(ctx context.Context, id int64, tasks []string) error {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM campaign_tasks WHERE campaign_id=?1`, id); err != nil {
+		return err
+	}
+	for _, code := range tasks {
+		_, err := s.q.ExecContext(ctx, `
+			INSERT INTO campaign_tasks (campaign_id, task_code) VALUES (?1, ?2)
+			ON CONFLICT DO NOTHING
+		`, id, code)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) CreateCampaign(ctx context.Context, c Campaign) (Campaign, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO campaigns (name, starts_at, ends_at, multiplier, bonus_points, category, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, NULLIF(?6, ''), ?7)
+		RETURNING id
+	`, c.Name, c.StartsAt.UTC(), c.EndsAt.UTC(), c.Multiplier, c.BonusPoints, c.Category, utcNow()).Scan(&id)
+	if err != nil {
+		return Campaign{}, err
+	}
+	if err := s.setCampaignTasks(ctx, id, c.Tasks); err != nil {
+		return Campaign{}, err
+	}
+	return s.GetCampaign(ctx, id)
+}
+
+func (s *SQLite) GetCampaign(ctx context.Context, id int64) (Campaign, error) {
+	c, err := scanCampaign(s.q.QueryRowContext(ctx, campaignQuery("group_concat", `SELECT COLUMNS FROM campaigns WHERE id=?1`), id))
+	return c, notFound(err)
+}
+
+func (s *SQLite) ListCampaigns(ctx context.Context) ([]Campaign, error) {
+	return scanCampaigns(s.q.QueryContext(ctx, campaignQuery("group_concat", `SELECT COLUMNS FROM campaigns ORDER BY starts_at DESC, id DESC`)))
+}
+
+func (s *SQLite) RunningCampaigns(ctx context.Context) ([]Campaign, error) {
+	return scanCampaigns(s.q.QueryContext(ctx, campaignQuery("group_concat", `
+		SELECT COLUMNS FROM campaigns
+		WHERE starts_at <= ?1 AND ends_at > ?1
+		ORDER BY id
+	`), utcNow()))
+}
+
+func (s *SQLite) UpdateCampaign(ctx context.Context, c Campaign) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE campaigns SET name=?2, starts_at=?3, ends_at=?4, multiplier=?5, bonus_points=?6, category=NULLIF(?7, '')
+		WHERE id=?1
+	`, c.ID, c.Name, c.StartsAt.UTC(), c.EndsAt.UTC(), c.Multiplier, c.BonusPoints, c.Category)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return s.setCampaignTasks(ctx, c.ID, c.Tasks)
+}
+
+func (s *SQLite) DeleteCampaign(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM campaigns WHERE id=?1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) AddCampaignAward(ctx context.Context, a CampaignAward) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO campaign_awards (campaign_id, user_id, task_code, awarded, extra, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+	`, a.CampaignID, a.UserID, a.TaskCode, a.Awarded, a.Extra, utcNow())
+	return err
+}
+
+func (s *SQLite) CampaignStats(ctx context.Context, id int64) (CampaignStats, error) {
+	st, err := scanCampaignStats(s.q.QueryContext(ctx, strings.Replace(campaignTaskStats, "ID", "?1", 1), id))
+	if err != nil {
+		return st, err
+	}
+	err = s.q.QueryRowContext(ctx, `SELECT COUNT(DISTINCT user_id) FROM campaign_awards WHERE campaign_id=?1`, id).Scan(&st.Users)
+	return st, err
+}
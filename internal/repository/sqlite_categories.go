@@ -0,0 +1,48 @@
+package repository
+
+import "context"
+
+func (s *SQLite) ListCategories(ctx context.Context) ([]Category, error) {
+	return scanCategories(s.q.QueryContext(ctx, `SELECT `+categoryColumns+` FROM task_categories ORDER BY position, code`))
+}
+
+func (s *SQLite) GetCategory(ctx context.Context, code string) (Category, error) {
+	var c Category
+	err := s.q.QueryRowContext(ctx, `SELECT `+categoryColumns+` FROM task_categories WHERE code=?1`, code).
+		Scan(&c.Code, &c.Name, &c.Description, &c.Position)
+	return c, notFound(err)
+}
+
+func (s *SQLite) CreateCategory(ctx context.Context, c Category) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO task_categories (code, name, description, position, created_at) VALUES (?1, ?2, ?3, ?4, ?5)
+	`, c.Code, c.Name, c.Description, c.Position, utcNow())
+	if isSQLiteUnique(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *SQLite) UpdateCategory(ctx context.Context, c Category) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE task_categories SET name=?2, description=?3, position=?4 WHERE code=?1
+	`, c.Code, c.Name, c.Description, c.Position)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteCategory(ctx context.Context, code string) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM task_categories WHERE code=?1`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *SQLite) AddAuditEvent(ctx context.Context, e AuditEvent) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO audit_events (at, actor_id, action, target_type, target_id, before, after, ip, request_id)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+	`, utcNow(), e.ActorID, e.Action, e.TargetType, e.TargetID, nullJSON(e.Before), nullJSON(e.After), e.IP, e.RequestID)
+	return err
+}
+
+func (s *SQLite) ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, cond)
+	}
+	if f.ActorID != nil {
+		add("actor_id = ?", *f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = ?", f.TargetID)
+	}
+	if f.Since != nil {
+		add("at >= ?", f.Since.UTC())
+	}
+	if f.Until != nil {
+		add("at < ?", f.Until.UTC())
+	}
+	if f.Before > 0 {
+		add("id < ?", f.Before)
+	}
+	query := `SELECT id, at, actor_id, action, target_type, target_id, before, after, ip, request_id FROM audit_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += ` ORDER BY id DESC LIMIT ?`
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []AuditEvent{}
+	for rows.Next() {
+		var (
+			e             AuditEvent
+			before, after []byte
+		)
+		if err := rows.Scan(&e.ID, &e.At, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID,
+			&before, &after, &e.IP, &e.RequestID); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLite) AddOutboxEvent(ctx context.Context, e OutboxEvent) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO outbox_events (event_id, type, data, created_at, next_attempt_at) VALUES (?1, ?2, ?3, ?4, ?5)
+	`, e.EventID, e.Type, string(e.Data), e.CreatedAt.UTC(), utcNow())
+	return err
+}
+
+// ClaimOutboxEvents needs no SKIP LOCKED: the UPDATE takes the database's
+// write lock, so claimers simply take turns.
+func (s *SQLite) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	now := utcNow()
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE outbox_events
+		SET next_attempt_at = ?2
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE published_at IS NULL AND next_attempt_at <= ?3
+			ORDER BY id
+			LIMIT ?1
+		)
+		RETURNING id, event_id, type, data, created_at, attempts
+	`, limit, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []OutboxEvent{}
+	for rows.Next() {
+		var (
+			e    OutboxEvent
+			data []byte
+		)
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Type, &data, &e.CreatedAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Data = data
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING comes back in no particular order
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *SQLite) MarkOutboxPublished(ctx context.Context, id int64) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE outbox_events SET published_at = ?2 WHERE id = ?1`, id, utcNow())
+	return err
+}
+
+func (s *SQLite) MarkOutboxFailed(ctx context.Context, id int64, errMsg string, retryIn time.Duration) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = ?2, next_attempt_at = ?3
+		WHERE id = ?1
+	`, id, errMsg, utcNow().Add(retryIn))
+	return err
+}
+
+func (s *SQLite) CreateWebhookEndpoint(ctx context.Context, e WebhookEndpoint) (WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints (url, secret, events, created_at) VALUES (?1, ?2, ?3, ?4)
+		RETURNING `+webhookEndpointColumns,
+		e.URL, e.Secret, strings.Join(e.Events, ","), utcNow()))
+}
+
+func (s *SQLite) GetWebhookEndpoint(ctx context.Context, id int64) (WebhookEndpoint, error) {
+	e, err := scanWebhookEndpoint(s.q.QueryRowContext(ctx,
+		`SELECT `+webhookEndpointColumns+` FROM webhook_endpoints WHERE id=?1`, id))
+	return e, notFound(err)
+}
+
+func (s *SQLite) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+webhookEndpointColumns+` FROM webhook_endpoints ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookEndpoint{}
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) DisableWebhookEndpoint(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE webhook_endpoints SET active=false WHERE id=?1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	// nothing left to send to a disabled endpoint
+	_, err = s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status='failed', last_error='endpoint disabled'
+		WHERE endpoint_id=?1 AND status='pending'
+	`, id)
+	return err
+}
+
+func (s *SQLite) EnqueueWebhookEvent(ctx context.Context, eventID, event string, payload json.RawMessage) error {
+	now := utcNow()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event, payload, next_attempt_at, created_at)
+		SELECT id, ?1, ?2, ?3, ?4, ?4 FROM webhook_endpoints
+		WHERE active AND (events = '*' OR instr(',' || events || ',', ',' || ?2 || ',') > 0)
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`, eventID, event, string(payload), now)
+	return err
+}
+
+func (s *SQLite) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingDelivery, error) {
+	now := utcNow()
+	// RETURNING can't name joined tables, so the endpoint is looked up per row
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = ?2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= ?3
+			ORDER BY next_attempt_at
+			LIMIT ?1
+		)
+		RETURNING id, event_id, event, payload, attempts,
+		          (SELECT url FROM webhook_endpoints e WHERE e.id = endpoint_id),
+		          (SELECT secret FROM webhook_endpoints e WHERE e.id = endpoint_id)
+	`, limit, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []PendingDelivery{}
+	for rows.Next() {
+		var (
+			d       PendingDelivery
+			payload []byte
+		)
+		if err := rows.Scan(&d.ID, &d.EventID, &d.Event, &payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) RecordWebhookAttempt(ctx context.Context, id int64, a WebhookAttempt) error {
+	status := "pending"
+	switch {
+	case a.Delivered:
+		status = "delivered"
+	case a.RetryIn <= 0:
+		status = "failed"
+	}
+	now := utcNow()
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?2, attempts = attempts + 1, last_status_code = ?3, last_error = ?4,
+		    next_attempt_at = ?5,
+		    delivered_at = CASE WHEN ?2 = 'delivered' THEN ?6 END
+		WHERE id = ?1
+	`, id, status, a.StatusCode, a.Error, now.Add(a.RetryIn), now)
+	return err
+}
+
+func (s *SQLite) ListWebhookDeliveries(ctx context.Context, endpointID int64, status string, before int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, endpoint_id, event_id, event, payload, status, attempts, next_attempt_at,
+		       last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE endpoint_id = ?1 AND (?2 = '' OR status = ?2) AND (?3 = 0 OR id < ?3)
+		ORDER BY id DESC
+		LIMIT ?4
+	`, endpointID, status, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookDelivery{}
+	for rows.Next() {
+		var (
+			d       WebhookDelivery
+			payload []byte
+		)
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = ?2
+		WHERE id = ?1 AND status <> 'pending'
+		  AND endpoint_id IN (SELECT id FROM webhook_endpoints WHERE active)
+	`, id, utcNow())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+func (s *SQLite) CreateExport(ctx context.Context, userID int64, format string) (DataExport, error) {
+	now := utcNow()
+	return scanDataExport(s.q.QueryRowContext(ctx, `
+		INSERT INTO data_exports (user_id, format, created_at, next_attempt_at) VALUES (?1, ?2, ?3, ?3)
+		RETURNING `+dataExportColumns,
+		userID, format, now))
+}
+
+func (s *SQLite) GetExport(ctx context.Context, userID, id int64) (DataExport, error) {
+	e, err := scanDataExport(s.q.QueryRowContext(ctx, `
+		SELECT `+dataExportColumns+` FROM data_exports
+		WHERE id=?1 AND user_id=?2 AND (expires_at IS NULL OR expires_at > ?3)
+	`, id, userID, utcNow()))
+	return e, notFound(err)
+}
+
+func (s *SQLite) ExportContent(ctx context.Context, userID, id int64) ([]byte, error) {
+	var content []byte
+	err := s.q.QueryRowContext(ctx, `
+		SELECT content FROM data_exports
+		WHERE id=?1 AND user_id=?2 AND status='ready' AND expires_at > ?3
+	`, id, userID, utcNow()).Scan(&content)
+	return content, notFound(err)
+}
+
+func (s *SQLite) ClaimExports(ctx context.Context, limit int, lease time.Duration) ([]DataExport, error) {
+	now := utcNow()
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE data_exports
+		SET next_attempt_at = ?2
+		WHERE id IN (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' AND next_attempt_at <= ?3
+			ORDER BY id
+			LIMIT ?1
+		)
+		RETURNING `+dataExportColumns,
+		limit, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	out, err := scanDataExports(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING comes back in no particular order
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *SQLite) CompleteExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE data_exports SET status='ready', content=?2, completed_at=?3, expires_at=?4
+		WHERE id=?1 AND status='pending'
+	`, id, content, utcNow(), expiresAt.UTC())
+	return err
+}
+
+func (s *SQLite) FailExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE data_exports SET status='failed', error=?2, completed_at=?3, expires_at=?4
+		WHERE id=?1 AND status='pending'
+	`, id, errMsg, utcNow(), expiresAt.UTC())
+	return err
+}
+
+func (s *SQLite) DeleteUserExports(ctx context.Context, userID int64) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM data_exports WHERE user_id=?1`, userID)
+	return err
+}
+
+func (s *SQLite) PurgeExports(ctx context.Context, now time.Time) (int64, error) {
+	var total int64
+	for _, table := range []string{"data_exports", "report_exports"} {
+		res, err := s.q.ExecContext(ctx, `DELETE FROM `+table+` WHERE expires_at < ?1`, now.UTC())
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (s *SQLite) CreateReportExport(ctx context.Context, report string, params json.RawMessage, requestedBy int64) (ReportExport, error) {
+	now := utcNow()
+	return scanReportExport(s.q.QueryRowContext(ctx, `
+		INSERT INTO report_exports (report, params, requested_by, created_at, next_attempt_at) VALUES (?1, ?2, ?3, ?4, ?4)
+		RETURNING `+reportExportColumns,
+		report, string(params), requestedBy, now))
+}
+
+func (s *SQLite) GetReportExport(ctx context.Context, id int64) (ReportExport, error) {
+	e, err := scanReportExport(s.q.QueryRowContext(ctx, `
+		SELECT `+reportExportColumns+` FROM report_exports
+		WHERE id=?1 AND (expires_at IS NULL OR expires_at > ?2)
+	`, id, utcNow()))
+	return e, notFound(err)
+}
+
+func (s *SQLite) ReportExportContent(ctx context.Context, id int64) ([]byte, error) {
+	var content []byte
+	err := s.q.QueryRowContext(ctx, `
+		SELECT content FROM report_exports
+		WHERE id=?1 AND status='ready' AND expires_at > ?2
+	`, id, utcNow()).Scan(&content)
+	return content, notFound(err)
+}
+
+func (s *SQLite) ClaimReportExports(ctx context.Context, limit int, lease time.Duration) ([]ReportExport, error) {
+	now := utcNow()
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE report_exports
+		SET next_attempt_at = ?2
+		WHERE id IN (
+			SELECT id FROM report_exports
+			WHERE status = 'pending' AND next_attempt_at <= ?3
+			ORDER BY id
+			LIMIT ?1
+		)
+		RETURNING `+reportExportColumns,
+		limit, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	out, err := scanReportExports(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *SQLite) CompleteReportExport(ctx context.Context, id int64, content []byte, expiresAt time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE report_exports SET status='ready', content=?2, completed_at=?3, expires_at=?4
+		WHERE id=?1 AND status='pending'
+	`, id, content, utcNow(), expiresAt.UTC())
+	return err
+}
+
+func (s *SQLite) FailReportExport(ctx context.Context, id int64, errMsg string, expiresAt time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE report_exports SET status='failed', error=?2, completed_at=?3, expires_at=?4
+		WHERE id=?1 AND status='pending'
+	`, id, errMsg, utcNow(), expiresAt.UTC())
+	return err
+}
@@ -0,0 +1,27 @@
+package repository
+
+import "context"
+
+func (s *SQLite) FeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	return scanFlags(s.q.QueryContext(ctx, `SELECT name, enabled, percent, updated_at FROM feature_flags ORDER BY name`))
+}
+
+func (s *SQLite) SetFeatureFlag(ctx context.Context, f FeatureFlag) (FeatureFlag, error) {
+	f.UpdatedAt = utcNow()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO feature_flags (name, enabled, percent, updated_at) VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (name) DO UPDATE SET enabled = excluded.enabled, percent = excluded.percent, updated_at = excluded.updated_at
+	`, f.Name, f.Enabled, f.Percent, f.UpdatedAt)
+	return f, err
+}
+
+func (s *SQLite) DeleteFeatureFlag(ctx context.Context, name string) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM feature_flags WHERE name=?1`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
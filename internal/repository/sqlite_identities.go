@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (s *SQLite) GetIdentity(ctx context.Context, provider, externalID string) (ExternalIdentity, error) {
+	id := ExternalIdentity{Provider: provider, ExternalID: externalID}
+	err := s.q.QueryRowContext(ctx, `
+		SELECT user_id, email, created_at FROM external_identities WHERE provider=?1 AND external_id=?2
+	`, provider, externalID).Scan(&id.UserID, &id.Email, &id.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return id, ErrNotFound
+	}
+	return id, err
+}
+
+func (s *SQLite) ListIdentities(ctx context.Context, userID int64) ([]ExternalIdentity, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT provider, external_id, user_id, email, created_at FROM external_identities
+		WHERE user_id=?1 ORDER BY provider
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ExternalIdentity{}
+	for rows.Next() {
+		var id ExternalIdentity
+		if err := rows.Scan(&id.Provider, &id.ExternalID, &id.UserID, &id.Email, &id.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) AddIdentity(ctx context.Context, id ExternalIdentity) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO external_identities (provider, external_id, user_id, email, created_at) VALUES (?1, ?2, ?3, ?4, ?5)
+	`, id.Provider, id.ExternalID, id.UserID, id.Email, utcNow())
+	if isSQLiteUnique(err) {
+		return ErrConflict
+	}
+	if isSQLiteForeignKey(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *SQLite) DeleteIdentity(ctx context.Context, userID int64, provider string) (ExternalIdentity, error) {
+	id := ExternalIdentity{Provider: provider, UserID: userID}
+	err := s.q.QueryRowContext(ctx, `
+		DELETE FROM external_identities WHERE user_id=?1 AND provider=?2
+		RETURNING external_id, email, created_at
+	`, userID, provider).Scan(&id.ExternalID, &id.Email, &id.CreatedAt)
+	return id, notFound(err)
+}
+
+func (s *SQLite) DeleteIdentities(ctx context.Context, userID int64) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM external_identities WHERE user_id=?1`, userID)
+	return err
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// TryLockJob only locks within the process: a SQLite file has one server.
+func (s *SQLite) TryLockJob(ctx context.Context, name string) (func(), bool, error) {
+	unlock, ok := s.jobs.tryLock(name)
+	return unlock, ok, nil
+}
+
+func (s *SQLite) ClaimJobRun(ctx context.Context, name string, slot time.Time) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO job_runs (name, slot, started_at) VALUES (?1, ?2, ?3)
+		ON CONFLICT (name) DO UPDATE
+		SET slot = excluded.slot, started_at = excluded.started_at, finished_at = NULL, last_error = NULL
+		WHERE job_runs.slot < excluded.slot
+	`, name, slot.UTC(), utcNow())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *SQLite) FinishJobRun(ctx context.Context, name string, slot time.Time, errMsg string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE job_runs SET finished_at = ?3, last_error = NULLIF(?4, '')
+		WHERE name = ?1 AND slot = ?2
+	`, name, slot.UTC(), utcNow(), errMsg)
+	return err
+}
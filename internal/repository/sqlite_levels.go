@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+func (s *SQLite) UserLevels(ctx context.Context, ids []int64) (map[int64]UserLevel, error) {
+	if len(ids) == 0 {
+		return map[int64]UserLevel{}, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return scanUserLevels(s.q.QueryContext(ctx, `
+		SELECT u.id, COALESCE(l.level, 0), u.points
+		FROM users u LEFT JOIN user_levels l ON l.user_id = u.id
+		WHERE u.id IN (?`+strings.Repeat(`, ?`, len(ids)-1)+`)
+	`, args...))
+}
+
+func (s *SQLite) RaiseUserLevel(ctx context.Context, userID int64, level int) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO user_levels (user_id, level, reached_at) VALUES (?1, ?2, ?3)
+		ON CONFLICT (user_id) DO UPDATE SET level = excluded.level, reached_at = excluded.reached_at
+		WHERE user_levels.level < excluded.level
+	`, userID, level, utcNow())
+	return err
+}
@@ -0,0 +1,28 @@
+package repository
+
+import "context"
+
+func (s *SQLite) Maintenance(ctx context.Context) (Maintenance, error) {
+	return scanMaintenance(s.q.QueryRowContext(ctx, `SELECT enabled, message, retry_after, updated_at FROM maintenance`))
+}
+
+func (s *SQLite) SetMaintenance(ctx context.Context, m Maintenance) (Maintenance, error) {
+	m.UpdatedAt = utcNow()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO maintenance (id, enabled, message, retry_after, updated_at) VALUES (1, ?1, ?2, ?3, ?4)
+		ON CONFLICT (id) DO UPDATE SET enabled = excluded.enabled, message = excluded.message,
+			retry_after = excluded.retry_after, updated_at = excluded.updated_at
+	`, m.Enabled, m.Message, m.RetryAfter, m.UpdatedAt)
+	return m, err
+}
+
+func (s *SQLite) ClearMaintenance(ctx context.Context) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM maintenance`)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+)
+
+func (s *SQLite) MergeUsers(ctx context.Context, from, into int64) (MergeCounts, error) {
+	var c MergeCounts
+	exec := func(n *int64, query string) error {
+		res, err := s.q.ExecContext(ctx, query, from, into)
+		if err != nil {
+			return err
+		}
+		if n != nil {
+			moved, _ := res.RowsAffected()
+			*n += moved
+		}
+		return nil
+	}
+
+	// renumbered before they move, since SQLite's subquery would see the
+	// rows moved already
+	if err := exec(nil, `
+		UPDATE user_tasks
+		SET n = n + COALESCE((
+			SELECT MAX(ut.n) FROM user_tasks ut WHERE ut.user_id=?2 AND ut.task_code=user_tasks.task_code
+		), 0)
+		WHERE user_id=?1
+	`); err != nil {
+		return c, err
+	}
+	if err := exec(&c.Completions, `UPDATE user_tasks SET user_id=?2 WHERE user_id=?1`); err != nil {
+		return c, err
+	}
+
+	// from's stream goes on where into's ends, so seqs into's readers hold
+	// stay valid
+	var seq int64
+	if err := s.q.QueryRowContext(ctx, `
+		SELECT points, points_seq FROM users WHERE id=?1
+	`, from).Scan(&c.Points, &seq); err != nil {
+		return c, notFound(err)
+	}
+	if err := exec(&c.LedgerEntries, `
+		UPDATE point_transactions
+		SET user_id=?2,
+		    user_seq = user_seq + (SELECT points_seq FROM users WHERE id=?2),
+		    balance = balance + (SELECT points FROM users WHERE id=?2)
+		WHERE user_id=?1
+	`); err != nil {
+		return c, err
+	}
+	if _, err := s.q.ExecContext(ctx, `
+		UPDATE users SET points = 0, points_seq = 0, version = version + 1 WHERE id=?1
+	`, from); err != nil {
+		return c, err
+	}
+	if err := s.spreadPoints(ctx, from, -c.Points); err != nil {
+		return c, err
+	}
+	if _, err := s.q.ExecContext(ctx, `
+		UPDATE users SET points = points + ?2, points_seq = points_seq + ?3, version = version + 1 WHERE id=?1
+	`, into, c.Points, seq); err != nil {
+		return c, sqliteNegativeBalance(err)
+	}
+	if err := s.spreadPoints(ctx, into, c.Points); err != nil {
+		return c, err
+	}
+
+	for _, query := range []string{
+		// neither may end up having referred themselves
+		`DELETE FROM referrals WHERE (referrer_id=?1 AND referred_id=?2) OR (referrer_id=?2 AND referred_id=?1)`,
+		`UPDATE users SET referrer_id=NULL WHERE id=?2 AND referrer_id=?1`,
+		`UPDATE users SET referrer_id=?2 WHERE referrer_id=?1 AND id<>?2`,
+		`UPDATE users SET referrer_id=(SELECT referrer_id FROM users WHERE id=?1)
+		 WHERE id=?2 AND referrer_id IS NULL
+		   AND (SELECT referrer_id FROM users WHERE id=?1) IS NOT ?2`,
+	} {
+		if err := exec(nil, query); err != nil {
+			return c, err
+		}
+	}
+	if err := exec(&c.Referrals, `UPDATE referrals SET referrer_id=?2 WHERE referrer_id=?1`); err != nil {
+		return c, err
+	}
+	if err := exec(&c.Referrals, `
+		UPDATE referrals SET referred_id=?2
+		WHERE referred_id=?1
+		  AND referrer_id = (SELECT referrer_id FROM users WHERE id=?2)
+		  AND NOT EXISTS (SELECT 1 FROM referrals WHERE referred_id=?2)
+	`); err != nil {
+		return c, err
+	}
+	for _, query := range []string{
+		`UPDATE referral_clicks SET referrer_id=?2 WHERE referrer_id=?1`,
+		`UPDATE referral_codes SET user_id=?2
+		 WHERE user_id=?1 AND NOT EXISTS (SELECT 1 FROM referral_codes WHERE user_id=?2)`,
+	} {
+		if err := exec(nil, query); err != nil {
+			return c, err
+		}
+	}
+
+	if err := exec(&c.Identities, `
+		UPDATE external_identities SET user_id=?2
+		WHERE user_id=?1 AND provider NOT IN (SELECT provider FROM external_identities WHERE user_id=?2)
+	`); err != nil {
+		return c, err
+	}
+	if err := exec(nil, `
+		DELETE FROM task_submissions
+		WHERE user_id=?1 AND status='pending'
+		  AND task_code IN (SELECT task_code FROM task_submissions WHERE user_id=?2 AND status='pending')
+	`); err != nil {
+		return c, err
+	}
+	if err := exec(&c.Submissions, `UPDATE task_submissions SET user_id=?2 WHERE user_id=?1`); err != nil {
+		return c, err
+	}
+	if err := exec(nil, `UPDATE partner_completions SET user_id=?2 WHERE user_id=?1`); err != nil {
+		return c, err
+	}
+	return c, exec(nil, `UPDATE campaign_awards SET user_id=?2 WHERE user_id=?1`)
+}
+
+func (s *SQLite) DuplicateMatches(ctx context.Context, id int64) ([]DuplicateMatch, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		WITH emails AS (
+			SELECT user_id, lower(email) AS email FROM external_identities WHERE email <> ''
+			UNION
+			SELECT user_id, lower(address) FROM notification_channels WHERE channel = 'email'
+		)
+		SELECT DISTINCT o.user_id, o.email
+		FROM emails mine
+		JOIN emails o ON o.email = mine.email AND o.user_id <> mine.user_id
+		JOIN users u ON u.id = o.user_id AND u.deleted_at IS NULL
+		WHERE mine.user_id=?1
+		ORDER BY o.user_id, o.email
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []DuplicateMatch{}
+	for rows.Next() {
+		var d DuplicateMatch
+		if err := rows.Scan(&d.UserID, &d.Email); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+func (s *SQLite) AddNotification(ctx context.Context, n Notification) (bool, error) {
+	now := utcNow()
+	var id int64
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO notifications (user_id, event_id, kind, title, body, data, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
+		ON CONFLICT (user_id, event_id, kind) DO NOTHING
+		RETURNING id
+	`, n.UserID, n.EventID, n.Kind, n.Title, n.Body, string(n.Data), now).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if isSQLiteForeignKey(err) {
+		// the user is gone
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO notification_deliveries (notification_id, channel, address, next_attempt_at)
+		SELECT ?1, channel, address, ?3 FROM notification_channels WHERE user_id=?2 AND enabled
+	`, id, n.UserID, now)
+	return err == nil, err
+}
+
+func (s *SQLite) ListNotifications(ctx context.Context, userID int64, unreadOnly bool, before int64, limit int) ([]Notification, error) {
+	return scanNotifications(s.q.QueryContext(ctx, `
+		SELECT `+notificationColumns+` FROM notifications
+		WHERE user_id=?1 AND (NOT ?2 OR read_at IS NULL) AND (?3 = 0 OR id < ?3)
+		ORDER BY id DESC
+		LIMIT ?4
+	`, userID, unreadOnly, before, limit))
+}
+
+func (s *SQLite) CountUnreadNotifications(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT count(*) FROM notifications WHERE user_id=?1 AND read_at IS NULL
+	`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *SQLite) MarkNotificationsRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	query := `UPDATE notifications SET read_at=?2 WHERE user_id=?1 AND read_at IS NULL`
+	args := []any{userID, utcNow()}
+	if ids != nil {
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		query += ` AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	res, err := s.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLite) ListChannelSettings(ctx context.Context, userID int64) ([]ChannelSetting, error) {
+	return scanChannelSettings(s.q.QueryContext(ctx, `
+		SELECT channel, address, enabled, updated_at FROM notification_channels WHERE user_id=?1 ORDER BY channel
+	`, userID))
+}
+
+func (s *SQLite) SetChannelSetting(ctx context.Context, userID int64, c ChannelSetting) (ChannelSetting, error) {
+	c.UpdatedAt = utcNow()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO notification_channels (user_id, channel, address, enabled, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		ON CONFLICT (user_id, channel) DO UPDATE
+		SET address = excluded.address, enabled = excluded.enabled, updated_at = excluded.updated_at
+	`, userID, c.Channel, c.Address, c.Enabled, c.UpdatedAt)
+	return c, err
+}
+
+func (s *SQLite) DeleteChannelSetting(ctx context.Context, userID int64, channel string) error {
+	res, err := s.q.ExecContext(ctx, `
+		DELETE FROM notification_channels WHERE user_id=?1 AND (?2 = '' OR channel = ?2)
+	`, userID, channel)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) ClaimNotificationDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingNotification, error) {
+	now := utcNow()
+	// RETURNING can't name joined tables, so the claimed ids are read back
+	// with their notifications afterwards
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE notification_deliveries
+		SET next_attempt_at = ?2
+		WHERE id IN (
+			SELECT id FROM notification_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= ?3
+			ORDER BY next_attempt_at
+			LIMIT ?1
+		)
+		RETURNING id
+	`, limit, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	var ids []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []PendingNotification{}, nil
+	}
+	return scanPendingNotifications(s.q.QueryContext(ctx, `
+		SELECT d.id, d.channel, d.address, d.attempts, n.id, n.user_id, n.kind, n.title, n.body, n.data, n.created_at
+		FROM notification_deliveries d JOIN notifications n ON n.id = d.notification_id
+		WHERE d.id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY d.id
+	`, ids...))
+}
+
+func (s *SQLite) RecordNotificationAttempt(ctx context.Context, id int64, a NotificationAttempt) error {
+	now := utcNow()
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE notification_deliveries
+		SET status = ?2, attempts = attempts + 1, last_error = ?3,
+		    next_attempt_at = ?4,
+		    sent_at = CASE WHEN ?2 = 'sent' THEN ?5 END
+		WHERE id = ?1
+	`, id, deliveryStatus(a), a.Error, now.Add(a.RetryIn), now)
+	return err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (s *SQLite) CreatePasswordReset(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO password_resets (user_id, token_hash, expires_at, created_at) VALUES (?1, ?2, ?3, ?4)
+	`, userID, tokenHash, expiresAt.UTC(), utcNow())
+	return err
+}
+
+func (s *SQLite) CountPasswordResets(ctx context.Context, userID int64, since time.Time) (int, error) {
+	var n int
+	err := s.q.QueryRowContext(ctx, `
+		SELECT count(*) FROM password_resets WHERE user_id=?1 AND created_at >= ?2
+	`, userID, since.UTC()).Scan(&n)
+	return n, err
+}
+
+func (s *SQLite) UsePasswordReset(ctx context.Context, tokenHash string, now time.Time) (int64, error) {
+	var userID int64
+	err := s.q.QueryRowContext(ctx, `
+		UPDATE password_resets SET used_at = ?2
+		WHERE token_hash=?1 AND used_at IS NULL AND expires_at > ?2
+		RETURNING user_id
+	`, tokenHash, now.UTC()).Scan(&userID)
+	if err != nil {
+		return 0, notFound(err)
+	}
+	_, err = s.q.ExecContext(ctx, `
+		UPDATE password_resets SET used_at = ?2 WHERE user_id=?1 AND used_at IS NULL
+	`, userID, now.UTC())
+	return userID, err
+}
+
+func (s *SQLite) SetPasswordHash(ctx context.Context, userID int64, hash string) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE users SET password_hash=?2 WHERE id=?1 AND deleted_at IS NULL
+	`, userID, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) PurgePasswordResets(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM password_resets WHERE expires_at < ?1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
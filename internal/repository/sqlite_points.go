@@ -0,0 +1,523 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// addPoints changes a balance, counting one more entry in the user's
+// stream, and for a non-zero amount upserts the current day, week and
+// month windows and the running season's points and moves the user's
+// team's points: the work the users triggers do in Postgres. It returns
+// the new balance and seq.
+func (s *SQLite) addPoints(ctx context.Context, userID, amount int64) (balance, seq int64, err error) {
+	err = s.q.QueryRowContext(ctx, `
+		UPDATE users SET points = points + ?1, points_seq = points_seq + 1, version = version + 1 WHERE id=?2
+		RETURNING points, points_seq
+	`, amount, userID).Scan(&balance, &seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, 0, sqliteNegativeBalance(err)
+	}
+	return balance, seq, s.spreadPoints(ctx, userID, amount)
+}
+
+// spreadPoints is the part of addPoints after the balance.
+func (s *SQLite) spreadPoints(ctx context.Context, userID, amount int64) error {
+	if amount == 0 {
+		return nil
+	}
+	if _, err := s.q.ExecContext(ctx, `
+		UPDATE teams SET points = points + ?1
+		WHERE id = (SELECT team_id FROM team_members WHERE user_id = ?2)
+	`, amount, userID); err != nil {
+		return err
+	}
+	now := utcNow()
+	if _, err := s.q.ExecContext(ctx, `
+		INSERT INTO season_points (season_id, user_id, points)
+		SELECT id, ?1, ?2 FROM seasons
+		WHERE starts_at <= ?3 AND ends_at > ?3 AND archived_at IS NULL
+		ON CONFLICT (season_id, user_id) DO UPDATE SET points = points + excluded.points
+	`, userID, amount, now); err != nil {
+		return err
+	}
+	for _, p := range []string{"day", "week", "month"} {
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO user_period_points (user_id, period, period_start, points)
+			VALUES (?1, ?2, ?3, ?4)
+			ON CONFLICT (user_id, period, period_start) DO UPDATE SET points = points + excluded.points
+		`, userID, p, window(p), amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) Accrue(ctx context.Context, userID, amount int64, reason string) error {
+	balance, seq, err := s.addPoints(ctx, userID, amount)
+	if err != nil {
+		return err
+	}
+	// origin_seq numbers this region's rows; writes are serialized, so the
+	// next one is simply the highest so far plus one
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO point_transactions (origin_region, origin_seq, user_id, amount, reason, recorded_at, applied_at, user_seq, balance)
+		VALUES (?1, (SELECT COALESCE(MAX(origin_seq), 0) + 1 FROM point_transactions WHERE origin_region = ?1),
+		        ?2, ?3, ?4, ?5, ?5, ?6, ?7)
+	`, s.region, userID, amount, reason, utcNow(), seq, balance)
+	return err
+}
+
+func (s *SQLite) BalanceAt(ctx context.Context, userID int64, at time.Time) (LedgerEntry, error) {
+	var e LedgerEntry
+	err := s.q.QueryRowContext(ctx, `
+		SELECT id, user_seq, amount, balance, reason, origin_region, applied_at
+		FROM point_transactions
+		WHERE user_id=?1 AND applied_at <= ?2
+		ORDER BY user_seq DESC
+		LIMIT 1
+	`, userID, at.UTC()).Scan(&e.ID, &e.Seq, &e.Amount, &e.Balance, &e.Reason, &e.Region, &e.CreatedAt)
+	return e, notFound(err)
+}
+
+func (s *SQLite) ListTransactions(ctx context.Context, userID, before int64, limit int) ([]LedgerEntry, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, user_seq, amount, balance, reason, origin_region, applied_at
+		FROM point_transactions
+		WHERE user_id=?1 AND id < ?2
+		ORDER BY id DESC
+		LIMIT ?3
+	`, userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.Seq, &e.Amount, &e.Balance, &e.Reason, &e.Region, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLite) LedgerByReason(ctx context.Context, userID int64, reasons []string) ([]LedgerEntry, error) {
+	items := []LedgerEntry{}
+	if len(reasons) == 0 {
+		return items, nil
+	}
+	args := []any{userID}
+	for _, r := range reasons {
+		args = append(args, r)
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, user_seq, amount, balance, reason, origin_region, applied_at
+		FROM point_transactions
+		WHERE user_id=? AND reason IN (?`+strings.Repeat(`, ?`, len(reasons)-1)+`)
+		ORDER BY user_seq
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.Seq, &e.Amount, &e.Balance, &e.Reason, &e.Region, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLite) CountTransactions(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := s.q.QueryRowContext(ctx, `SELECT count(*) FROM point_transactions WHERE user_id=?1`, userID).Scan(&n)
+	return n, err
+}
+
+// sqliteLeaderboardRows selects the (id, username, points, visibility) set
+// for a period, hidden users included. ?1 is the period and ?2 its window start, so callers number the
+// rest from ?3.
+func sqliteLeaderboardRows(period string) string {
+	if period == "all" {
+		return `SELECT id, username, points, leaderboard_visibility AS visibility FROM users WHERE deleted_at IS NULL`
+	}
+	return `
+		SELECT u.id, u.username, pp.points, u.leaderboard_visibility AS visibility
+		FROM user_period_points pp JOIN users u ON u.id = pp.user_id
+		WHERE pp.period = ?1 AND pp.period_start = ?2 AND u.deleted_at IS NULL`
+}
+
+func (s *SQLite) FriendsLeaderboard(ctx context.Context, userID int64, period string) ([]LeaderboardEntry, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT u.id, u.username, CASE WHEN ?2 = 'all' THEN u.points ELSE COALESCE(pp.points, 0) END AS points,
+		       u.leaderboard_visibility = 'anonymous'
+		FROM users u
+		LEFT JOIN user_period_points pp ON pp.user_id = u.id AND pp.period = ?2 AND pp.period_start = ?3
+		WHERE u.deleted_at IS NULL
+		  AND (u.id = ?1 OR u.referrer_id = ?1 OR u.id = (SELECT referrer_id FROM users WHERE id = ?1))
+		  AND (u.leaderboard_visibility <> 'hidden' OR u.id = ?1)
+		ORDER BY points DESC, u.id ASC
+	`, userID, period, window(period))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LeaderboardEntry
+	for rows.Next() {
+		it := LeaderboardEntry{Rank: len(items) + 1}
+		if err := rows.Scan(&it.ID, &it.Username, &it.Points, &it.Anonymous); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLite) Leaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	return s.leaderboard(ctx, sqliteLeaderboardRows(period), period, window(period), limit, after)
+}
+
+// leaderboard pages src, a query for id, username, points and visibility
+// that takes key and start as ?1 and ?2, leaving out hidden users.
+func (s *SQLite) leaderboard(ctx context.Context, src string, key, start any, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	var (
+		rows *sql.Rows
+		err  error
+		rank int
+	)
+	if after == nil {
+		rows, err = s.q.QueryContext(ctx, `
+			SELECT id, username, points, visibility = 'anonymous' FROM (`+src+`) b
+			WHERE visibility <> 'hidden'
+			ORDER BY points DESC, id ASC
+			LIMIT ?3
+		`, key, start, limit)
+	} else {
+		// everyone up to and including the cursor row ranks above this page
+		if err := s.q.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM (`+src+`) b
+			WHERE visibility <> 'hidden' AND (points > ?3 OR (points = ?3 AND id <= ?4))
+		`, key, start, after.Points, after.ID).Scan(&rank); err != nil {
+			return nil, err
+		}
+		rows, err = s.q.QueryContext(ctx, `
+			SELECT id, username, points, visibility = 'anonymous' FROM (`+src+`) b
+			WHERE visibility <> 'hidden' AND (points < ?3 OR (points = ?3 AND id > ?4))
+			ORDER BY points DESC, id ASC
+			LIMIT ?5
+		`, key, start, after.Points, after.ID, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LeaderboardEntry
+	for rows.Next() {
+		var it LeaderboardEntry
+		if err := rows.Scan(&it.ID, &it.Username, &it.Points, &it.Anonymous); err != nil {
+			return nil, err
+		}
+		rank++
+		it.Rank = rank
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLite) Rank(ctx context.Context, period string, userID, points int64) (int, *LeaderboardEntry, error) {
+	src := sqliteLeaderboardRows(period)
+	var above int
+	if err := s.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM (`+src+`) b
+		WHERE visibility <> 'hidden' AND (points > ?3 OR (points = ?3 AND id < ?4))
+	`, period, window(period), points, userID).Scan(&above); err != nil {
+		return 0, nil, err
+	}
+	if above == 0 {
+		return 1, nil, nil
+	}
+
+	next := LeaderboardEntry{Rank: above}
+	err := s.q.QueryRowContext(ctx, `
+		SELECT id, username, points, visibility = 'anonymous' FROM (`+src+`) b
+		WHERE visibility <> 'hidden' AND (points > ?3 OR (points = ?3 AND id < ?4))
+		ORDER BY points ASC, id DESC
+		LIMIT 1
+	`, period, window(period), points, userID).Scan(&next.ID, &next.Username, &next.Points, &next.Anonymous)
+	if err != nil {
+		return 0, nil, err
+	}
+	return above + 1, &next, nil
+}
+
+func (s *SQLite) TotalUsers(ctx context.Context) (int64, error) {
+	var total int64
+	err := s.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE deleted_at IS NULL`).Scan(&total)
+	return total, err
+}
+
+func (s *SQLite) PeriodUsers(ctx context.Context, period string) (int64, error) {
+	var total int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM (`+sqliteLeaderboardRows(period)+`) b
+	`, period, window(period)).Scan(&total)
+	return total, err
+}
+
+// PeriodPoints returns what the user earned in the current period window, 0
+// if nothing.
+func (s *SQLite) PeriodPoints(ctx context.Context, userID int64, period string) (int64, error) {
+	var pts int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT points FROM user_period_points
+		WHERE user_id=?1 AND period=?2 AND period_start=?3
+	`, userID, period, window(period)).Scan(&pts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return pts, err
+}
+
+// Distribution counts over the leaderboard rows directly; there is no
+// points_distribution table to keep in step.
+func (s *SQLite) Distribution(ctx context.Context, period string, points int64) (Distribution, error) {
+	var d Distribution
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(points < ?3), 0), COALESCE(SUM(points > ?3), 0), COUNT(*)
+		FROM (`+sqliteLeaderboardRows(period)+`) b
+	`, period, window(period), points).Scan(&d.Below, &d.Above, &d.Present)
+	return d, err
+}
+
+func (s *SQLite) PointsHistogram(ctx context.Context, period string) ([]PointsCount, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT points, COUNT(*) FROM (`+sqliteLeaderboardRows(period)+`) b
+		GROUP BY points ORDER BY points
+	`, period, window(period))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PointsCount
+	for rows.Next() {
+		var c PointsCount
+		if err := rows.Scan(&c.Points, &c.Users); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) CreateTransfer(ctx context.Context, fromID, toID, amount int64) (Transfer, error) {
+	t := Transfer{FromUserID: fromID, ToUserID: toID, Amount: amount}
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO point_transfers (from_user_id, to_user_id, amount, created_at)
+		VALUES (?1, ?2, ?3, ?4)
+		RETURNING id, created_at
+	`, fromID, toID, amount, utcNow()).Scan(&t.ID, &t.CreatedAt)
+	return t, err
+}
+
+func (s *SQLite) TransferredToday(ctx context.Context, userID int64) (int64, error) {
+	var sum int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM point_transfers
+		WHERE from_user_id=?1 AND created_at >= ?2
+	`, userID, window("day")).Scan(&sum)
+	return sum, err
+}
+
+// sqliteStreakNext is streakNext for SQLite, which is given the day before
+// as well since it has no date arithmetic on stored dates.
+func sqliteStreakNext(table, day, yesterday, max string) string {
+	return `MIN(CASE
+			WHEN ` + table + `.last_day = ` + day + ` THEN ` + table + `.current
+			WHEN ` + table + `.last_day = ` + yesterday + ` THEN ` + table + `.current + 1
+			ELSE 1
+		END, COALESCE(NULLIF(` + max + `, 0), 2147483647))`
+}
+
+func (s *SQLite) BumpStreak(ctx context.Context, userID int64, max int) (Streak, error) {
+	next := sqliteStreakNext("user_streaks", "?2", "?3", "?4")
+	day := today()
+	st := Streak{LastDay: &day, CompletedToday: true}
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO user_streaks (user_id, current, longest, last_day)
+		VALUES (?1, 1, 1, ?2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current = `+next+`, longest = MAX(user_streaks.longest, `+next+`), last_day = ?2
+		RETURNING current, longest
+	`, userID, day, day.AddDate(0, 0, -1), max).Scan(&st.Current, &st.Longest)
+	return st, err
+}
+
+func (s *SQLite) GetStreak(ctx context.Context, userID int64) (Streak, error) {
+	var (
+		st      Streak
+		lastDay time.Time
+	)
+	err := s.q.QueryRowContext(ctx, `
+		SELECT current, longest, last_day FROM user_streaks WHERE user_id=?1
+	`, userID).Scan(&st.Current, &st.Longest, &lastDay)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Streak{}, nil
+	}
+	if err != nil {
+		return Streak{}, err
+	}
+	day := today()
+	st.LastDay = &lastDay
+	st.CompletedToday = lastDay.Equal(day)
+	if lastDay.Before(day.AddDate(0, 0, -1)) {
+		st.Current = 0
+	}
+	return st, nil
+}
+
+func (s *SQLite) CheckIn(ctx context.Context, userID int64, day time.Time) (Streak, bool, error) {
+	next := sqliteStreakNext("user_checkins", "?2", "?3", "0")
+	st := Streak{LastDay: &day, CompletedToday: true}
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO user_checkins (user_id, current, longest, last_day)
+		VALUES (?1, 1, 1, ?2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current = `+next+`, longest = MAX(user_checkins.longest, `+next+`), last_day = ?2
+		WHERE user_checkins.last_day < ?2
+		RETURNING current, longest
+	`, userID, day, day.AddDate(0, 0, -1)).Scan(&st.Current, &st.Longest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Streak{}, false, nil
+	}
+	return st, err == nil, err
+}
+
+func (s *SQLite) LocalAccruals(ctx context.Context, after int64, lag time.Duration, limit int) ([]Accrual, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT t.origin_seq, COALESCE(u.origin_region, ?1), COALESCE(u.origin_id, u.id), t.amount, t.reason, t.recorded_at
+		FROM point_transactions t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.origin_region=?1 AND t.origin_seq > ?2 AND t.recorded_at < ?3
+		ORDER BY t.origin_seq
+		LIMIT ?4
+	`, s.region, after, utcNow().Add(-lag), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var batch []Accrual
+	for rows.Next() {
+		var a Accrual
+		if err := rows.Scan(&a.Seq, &a.UserRegion, &a.UserID, &a.Amount, &a.Reason, &a.RecordedAt); err != nil {
+			return nil, err
+		}
+		batch = append(batch, a)
+	}
+	return batch, rows.Err()
+}
+
+func (s *SQLite) ReplicationCursor(ctx context.Context, peer string) (int64, error) {
+	var cursor int64
+	err := s.q.QueryRowContext(ctx, `SELECT last_seq FROM replication_cursors WHERE peer_region=?1`, peer).Scan(&cursor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return cursor, err
+}
+
+// sqliteByOrigin is byOrigin for SQLite.
+const sqliteByOrigin = `((origin_region = ?1 AND origin_id = ?2) OR (?1 = ?3 AND origin_region IS NULL AND id = ?2))`
+
+func (s *SQLite) MergeAccrual(ctx context.Context, peer string, a Accrual) (int64, error) {
+	var id, balance, seq int64
+	err := s.q.QueryRowContext(ctx, `SELECT id, points, points_seq FROM users WHERE `+sqliteByOrigin,
+		a.UserRegion, a.UserID, s.region).Scan(&id, &balance, &seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO point_transactions (origin_region, origin_seq, user_id, amount, reason, recorded_at, applied_at, user_seq, balance)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+		ON CONFLICT (origin_region, origin_seq) DO NOTHING
+	`, peer, a.Seq, id, a.Amount, a.Reason, a.RecordedAt.UTC(), utcNow(), seq+1, balance+a.Amount)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+	// as in Postgres, merged debits may go below zero; the row tells the
+	// users_points_nonnegative trigger so until the transaction ends
+	if _, err := s.q.ExecContext(ctx, `INSERT INTO merging_accruals DEFAULT VALUES`); err != nil {
+		return 0, err
+	}
+	if _, _, err := s.addPoints(ctx, id, a.Amount); err != nil {
+		return 0, err
+	}
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM merging_accruals`); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *SQLite) UserReplica(ctx context.Context, region string, id int64) (UserReplica, error) {
+	u := UserReplica{Region: region, ID: id}
+	err := s.q.QueryRowContext(ctx, `
+		SELECT username, COALESCE(home_region, ?1), created_at FROM users WHERE `+sqliteByOrigin,
+		region, id, s.region).Scan(&u.Username, &u.HomeRegion, &u.CreatedAt)
+	return u, notFound(err)
+}
+
+func (s *SQLite) UserOrigin(ctx context.Context, id int64) (string, int64, error) {
+	var region string
+	var originID int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COALESCE(origin_region, ?2), COALESCE(origin_id, id) FROM users WHERE id=?1
+	`, id, s.region).Scan(&region, &originID)
+	return region, originID, notFound(err)
+}
+
+func (s *SQLite) AddUserReplica(ctx context.Context, u UserReplica) (int64, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO users (username, home_region, created_at, origin_region, origin_id)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, u.Username, u.HomeRegion, u.CreatedAt.UTC(), u.Region, u.ID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrConflict
+	}
+	return id, err
+}
+
+func (s *SQLite) ParkAccrual(ctx context.Context, peer string, a Accrual) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO parked_accruals (peer_region, origin_seq, user_region, user_id, amount, reason, recorded_at, parked_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		ON CONFLICT (peer_region, origin_seq) DO NOTHING
+	`, peer, a.Seq, a.UserRegion, a.UserID, a.Amount, a.Reason, a.RecordedAt.UTC(), utcNow())
+	return err
+}
+
+func (s *SQLite) SetReplicationCursor(ctx context.Context, peer string, seq int64) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO replication_cursors (peer_region, last_seq, updated_at)
+		VALUES (?1, ?2, ?3)
+		ON CONFLICT (peer_region) DO UPDATE SET last_seq = excluded.last_seq, updated_at = excluded.updated_at
+	`, peer, seq, utcNow())
+	return err
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// rankStart is the window a period's ranks are kept for: the current one,
+// or the epoch for the all-time board.
+func rankStart(period string) time.Time {
+	if period == "all" {
+		return time.Unix(0, 0).UTC()
+	}
+	return window(period)
+}
+
+const sqliteRankedRows = `
+	SELECT r.user_id, u.username, r.points, u.leaderboard_visibility = 'anonymous', r.rank
+	FROM leaderboard_ranks r JOIN users u ON u.id = r.user_id
+	WHERE r.period = ?1 AND u.deleted_at IS NULL AND u.leaderboard_visibility <> 'hidden'`
+
+func (s *SQLite) RefreshRanks(ctx context.Context, period string) (int64, error) {
+	src := sqliteLeaderboardRows(period)
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO leaderboard_ranks (period, user_id, rank, points)
+		SELECT ?1, id, row_number() OVER (ORDER BY points DESC, id ASC), points
+		FROM (`+src+`) b
+		WHERE visibility <> 'hidden'
+		ON CONFLICT (period, user_id) DO UPDATE SET rank = excluded.rank, points = excluded.points
+		WHERE leaderboard_ranks.rank <> excluded.rank OR leaderboard_ranks.points <> excluded.points
+	`, period, window(period))
+	if err != nil {
+		return 0, err
+	}
+	written, _ := res.RowsAffected()
+	res, err = s.q.ExecContext(ctx, `
+		DELETE FROM leaderboard_ranks
+		WHERE period = ?1 AND NOT EXISTS (
+			SELECT 1 FROM (`+src+`) b WHERE b.id = leaderboard_ranks.user_id AND b.visibility <> 'hidden'
+		)
+	`, period, window(period))
+	if err != nil {
+		return 0, err
+	}
+	dropped, _ := res.RowsAffected()
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO leaderboard_refreshes (period, period_start, refreshed_at)
+		VALUES (?1, ?2, ?3)
+		ON CONFLICT (period) DO UPDATE
+		SET period_start = excluded.period_start, refreshed_at = excluded.refreshed_at
+	`, period, rankStart(period), utcNow())
+	return written + dropped, err
+}
+
+func (s *SQLite) RankSnapshot(ctx context.Context, period string) (RankSnapshot, error) {
+	snap := RankSnapshot{Period: period}
+	err := s.q.QueryRowContext(ctx, `
+		SELECT period_start, refreshed_at FROM leaderboard_refreshes
+		WHERE period = ?1 AND period_start = ?2
+	`, period, rankStart(period)).Scan(&snap.PeriodStart, &snap.RefreshedAt)
+	return snap, notFound(err)
+}
+
+func (s *SQLite) RankedLeaderboard(ctx context.Context, period string, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	q, args := sqliteRankedRows, []any{period, limit}
+	if after != nil {
+		q += ` AND (r.points < ?3 OR (r.points = ?3 AND r.user_id > ?4))`
+		args = append(args, after.Points, after.ID)
+	}
+	rows, err := s.q.QueryContext(ctx, q+` ORDER BY r.points DESC, r.user_id ASC LIMIT ?2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LeaderboardEntry
+	for rows.Next() {
+		var it LeaderboardEntry
+		if err := rows.Scan(&it.ID, &it.Username, &it.Points, &it.Anonymous, &it.Rank); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLite) RankedPosition(ctx context.Context, period string, userID int64) (LeaderboardEntry, *LeaderboardEntry, error) {
+	var me LeaderboardEntry
+	err := s.q.QueryRowContext(ctx, sqliteRankedRows+` AND r.user_id = ?2`, period, userID).
+		Scan(&me.ID, &me.Username, &me.Points, &me.Anonymous, &me.Rank)
+	if err != nil {
+		return me, nil, notFound(err)
+	}
+	var above LeaderboardEntry
+	err = s.q.QueryRowContext(ctx, sqliteRankedRows+`
+		AND (r.points > ?2 OR (r.points = ?2 AND r.user_id < ?3))
+		ORDER BY r.points ASC, r.user_id DESC
+		LIMIT 1
+	`, period, me.Points, me.ID).Scan(&above.ID, &above.Username, &above.Points, &above.Anonymous, &above.Rank)
+	if errors.Is(err, sql.ErrNoRows) {
+		return me, nil, nil
+	}
+	if err != nil {
+		return me, nil, err
+	}
+	return me, &above, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (s *SQLite) ReferralCode(ctx context.Context, userID int64) (string, error) {
+	var code string
+	err := s.q.QueryRowContext(ctx, `SELECT code FROM referral_codes WHERE user_id=?1`, userID).Scan(&code)
+	return code, notFound(err)
+}
+
+func (s *SQLite) CreateReferralCode(ctx context.Context, userID int64, code string) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO referral_codes (user_id, code, created_at) VALUES (?1, ?2, ?3)
+	`, userID, code, utcNow())
+	if isSQLiteUnique(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *SQLite) ReferrerByCode(ctx context.Context, code string) (int64, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT c.user_id FROM referral_codes c JOIN users u ON u.id = c.user_id
+		WHERE c.code=?1 AND u.deleted_at IS NULL
+	`, code).Scan(&id)
+	return id, notFound(err)
+}
+
+func (s *SQLite) CreateReferralClick(ctx context.Context, referrerID int64, token string) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO referral_clicks (referrer_id, token, created_at) VALUES (?1, ?2, ?3)
+	`, referrerID, token, utcNow())
+	return err
+}
+
+func (s *SQLite) GetReferralClick(ctx context.Context, token string) (ReferralClick, error) {
+	return scanReferralClick(s.q.QueryRowContext(ctx, `
+		SELECT `+referralClickColumns+` FROM referral_clicks WHERE token=?1
+	`, token))
+}
+
+func (s *SQLite) ClaimReferralClick(ctx context.Context, token string, referredID int64, since time.Time) (ReferralClick, error) {
+	return scanReferralClick(s.q.QueryRowContext(ctx, `
+		UPDATE referral_clicks SET referred_id=?2, signed_up_at=?4
+		WHERE token=?1 AND signed_up_at IS NULL AND created_at >= ?3
+		RETURNING `+referralClickColumns,
+		token, referredID, since.UTC(), utcNow()))
+}
+
+func (s *SQLite) ReferralFunnels(ctx context.Context, from, to time.Time, limit int) ([]ReferralFunnel, error) {
+	rows, err := s.q.QueryContext(ctx, referralFunnelQuery(referralFunnelSQL, "?1", "?2", "?3"), from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanReferralFunnels(rows)
+}
+
+func (s *SQLite) ReferralFunnelTotals(ctx context.Context, from, to time.Time) (ReferralFunnel, error) {
+	var f ReferralFunnel
+	err := s.q.QueryRowContext(ctx, referralFunnelQuery(referralFunnelTotalsSQL, "?1", "?2", ""), from.UTC(), to.UTC()).
+		Scan(&f.Clicks, &f.Signups, &f.FirstTasks)
+	return f, err
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// times are stored in UTC, so a day is the date part of the text
+func sqliteReportDay(col string) string { return `substr(` + col + `, 1, 10)` }
+
+func (s *SQLite) ReportDays(ctx context.Context, from, to time.Time) ([]ReportDay, error) {
+	rows, err := s.q.QueryContext(ctx, reportQuery(sqliteReportDay, "?1", "?2"), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	days := reportDays{}
+	if err := days.scan(rows); err != nil {
+		return nil, err
+	}
+	return days.sorted(), nil
+}
+
+func (s *SQLite) ReportTotals(ctx context.Context, from, to time.Time) (ReportCounts, error) {
+	rows, err := s.q.QueryContext(ctx, reportQuery(reportTotal, "?1", "?2"), from.UTC(), to.UTC())
+	if err != nil {
+		return ReportCounts{}, err
+	}
+	days := reportDays{}
+	if err := days.scan(rows); err != nil {
+		return ReportCounts{}, err
+	}
+	return days.total(), nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (s *SQLite) RevokeAccessToken(ctx context.Context, t RevokedToken) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES (?1, NULLIF(?2, 0), ?3, ?4)
+		ON CONFLICT (jti) DO NOTHING
+	`, t.JTI, t.UserID, t.ExpiresAt.UTC(), utcNow())
+	return err
+}
+
+func (s *SQLite) RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error {
+	// before is the caller's now, so a later revocation never moves it back
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO user_token_cutoffs (user_id, revoked_before) VALUES (?1, ?2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = excluded.revoked_before
+	`, userID, before.UTC())
+	if isSQLiteForeignKey(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?2 WHERE user_id=?1 AND revoked_at IS NULL
+	`, userID, utcNow())
+	return err
+}
+
+func (s *SQLite) TokenRevocations(ctx context.Context, now time.Time) (TokenRevocations, error) {
+	out := TokenRevocations{JTIs: map[string]time.Time{}, Users: map[int64]time.Time{}}
+	rows, err := s.q.QueryContext(ctx, `SELECT jti, expires_at FROM revoked_tokens WHERE expires_at >= ?1`, now.UTC())
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jti string
+		var exp time.Time
+		if err := rows.Scan(&jti, &exp); err != nil {
+			return out, err
+		}
+		out.JTIs[jti] = exp
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+	rows, err = s.q.QueryContext(ctx, `SELECT user_id, revoked_before FROM user_token_cutoffs`)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var before time.Time
+		if err := rows.Scan(&id, &before); err != nil {
+			return out, err
+		}
+		out.Users[id] = before
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) PurgeRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+)
+
+// FindUsers scores every username in Go, as SQLite has no pg_trgm.
+func (s *SQLite) FindUsers(ctx context.Context, q UserQuery) ([]UserMatch, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, username FROM users
+		WHERE deleted_at IS NULL AND (NOT ?1 OR leaderboard_visibility = 'public')
+	`, q.PublicOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var candidates []UserMatch
+	for rows.Next() {
+		var m UserMatch
+		if err := rows.Scan(&m.ID, &m.Username); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return matchUsers(q, candidates), nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (s *SQLite) CreateSeason(ctx context.Context, name string, startsAt, endsAt time.Time) (Season, error) {
+	se, err := scanSeason(s.q.QueryRowContext(ctx, `
+		INSERT INTO seasons (name, starts_at, ends_at, created_at)
+		SELECT ?1, ?2, ?3, ?4
+		WHERE NOT EXISTS (SELECT 1 FROM seasons WHERE starts_at < ?3 AND ends_at > ?2)
+		RETURNING `+seasonColumns, name, startsAt.UTC(), endsAt.UTC(), utcNow()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return se, ErrConflict
+	}
+	return se, err
+}
+
+func (s *SQLite) GetSeason(ctx context.Context, id int64) (Season, error) {
+	se, err := scanSeason(s.q.QueryRowContext(ctx, `SELECT `+seasonColumns+` FROM seasons WHERE id=?1`, id))
+	return se, notFound(err)
+}
+
+func (s *SQLite) ListSeasons(ctx context.Context) ([]Season, error) {
+	return scanSeasons(s.q.QueryContext(ctx, `SELECT `+seasonColumns+` FROM seasons ORDER BY starts_at DESC, id DESC`))
+}
+
+func (s *SQLite) UpdateSeason(ctx context.Context, id int64, name string, startsAt, endsAt time.Time) error {
+	if _, err := s.GetSeason(ctx, id); err != nil {
+		return err
+	}
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE seasons SET name=?2, starts_at=?3, ends_at=?4
+		WHERE id=?1 AND NOT EXISTS (
+			SELECT 1 FROM seasons o WHERE o.id <> ?1 AND o.starts_at < ?4 AND o.ends_at > ?3
+		)
+	`, id, name, startsAt.UTC(), endsAt.UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteSeason(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM seasons WHERE id=?1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) EndedSeasons(ctx context.Context) ([]Season, error) {
+	return scanSeasons(s.q.QueryContext(ctx, `
+		SELECT `+seasonColumns+` FROM seasons
+		WHERE ends_at <= ?1 AND archived_at IS NULL
+		ORDER BY ends_at
+	`, utcNow()))
+}
+
+func (s *SQLite) ArchiveSeason(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE seasons SET archived_at = ?2 WHERE id=?1 AND archived_at IS NULL`, id, utcNow())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := s.q.ExecContext(ctx, `
+		INSERT INTO season_results (season_id, user_id, rank, points)
+		SELECT ?1, sp.user_id, ROW_NUMBER() OVER (ORDER BY sp.points DESC, sp.user_id ASC), sp.points
+		FROM season_points sp JOIN users u ON u.id = sp.user_id
+		WHERE sp.season_id = ?1 AND u.deleted_at IS NULL AND u.leaderboard_visibility <> 'hidden'
+	`, id); err != nil {
+		return err
+	}
+	_, err = s.q.ExecContext(ctx, `DELETE FROM season_points WHERE season_id=?1`, id)
+	return err
+}
+
+func (s *SQLite) SeasonLeaderboard(ctx context.Context, id int64, limit int, after *LeaderboardCursor) ([]LeaderboardEntry, error) {
+	se, err := s.GetSeason(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if se.ArchivedAt == nil {
+		return s.leaderboard(ctx, `
+			SELECT u.id, u.username, sp.points, u.leaderboard_visibility AS visibility
+			FROM season_points sp JOIN users u ON u.id = sp.user_id
+			WHERE sp.season_id = ?1 AND u.deleted_at IS NULL`, id, nil, limit, after)
+	}
+	const cols = `u.id, u.username, r.points, r.rank, u.deleted_at IS NOT NULL OR u.leaderboard_visibility <> 'public'`
+	if after == nil {
+		return scanSeasonResults(s.q.QueryContext(ctx, `
+			SELECT `+cols+` FROM season_results r JOIN users u ON u.id = r.user_id
+			WHERE r.season_id = ?1
+			ORDER BY r.rank
+			LIMIT ?2
+		`, id, limit))
+	}
+	return scanSeasonResults(s.q.QueryContext(ctx, `
+		SELECT `+cols+` FROM season_results r JOIN users u ON u.id = r.user_id
+		WHERE r.season_id = ?1 AND (r.points < ?2 OR (r.points = ?2 AND r.user_id > ?3))
+		ORDER BY r.rank
+		LIMIT ?4
+	`, id, after.Points, after.ID, limit))
+}
+
+func (s *SQLite) SeasonUsers(ctx context.Context, id int64) (int64, error) {
+	var n int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM season_results WHERE season_id = ?1)
+		     + (SELECT COUNT(*) FROM season_points sp JOIN users u ON u.id = sp.user_id
+		        WHERE sp.season_id = ?1 AND u.deleted_at IS NULL)
+	`, id).Scan(&n)
+	return n, err
+}
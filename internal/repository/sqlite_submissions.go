@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+func (s *SQLite) CreateSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error) {
+	out, err := scanSubmission(s.q.QueryRowContext(ctx, `
+		INSERT INTO task_submissions (user_id, task_code, proof, created_at) VALUES (?1, ?2, ?3, ?4)
+		RETURNING `+submissionColumns,
+		sub.UserID, sub.TaskCode, string(sub.Proof), utcNow()))
+	if isSQLiteUnique(err) {
+		return out, ErrConflict
+	}
+	return out, err
+}
+
+func (s *SQLite) GetSubmission(ctx context.Context, id int64) (TaskSubmission, error) {
+	sub, err := scanSubmission(s.q.QueryRowContext(ctx, `SELECT `+submissionColumns+` FROM task_submissions WHERE id=?1`, id))
+	return sub, notFound(err)
+}
+
+func (s *SQLite) ListSubmissions(ctx context.Context, f SubmissionFilter) ([]TaskSubmission, error) {
+	query, args := submissionQuery(f, func(n int) string { return "?" + strconv.Itoa(n) })
+	return scanSubmissions(s.q.QueryContext(ctx, query, args...))
+}
+
+func (s *SQLite) ReviewSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error) {
+	out, err := scanSubmission(s.q.QueryRowContext(ctx, `
+		UPDATE task_submissions
+		SET status=?2, reason=?3, awarded=?4, reviewed_by=?5, reviewed_at=?6
+		WHERE id=?1 AND status='pending'
+		RETURNING `+submissionColumns,
+		sub.ID, sub.Status, sub.Reason, sub.Awarded, sub.ReviewedBy, utcNow()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, ErrConflict
+	}
+	return out, err
+}
@@ -0,0 +1,111 @@
+package repository
+
+import "context"
+
+func (s *SQLite) CreateTeam(ctx context.Context, name string) (Team, error) {
+	t, err := scanTeam(s.q.QueryRowContext(ctx, `
+		INSERT INTO teams (name, created_at) VALUES (?1, ?2) RETURNING `+teamColumns, name, utcNow()))
+	if isSQLiteUnique(err) {
+		return t, ErrConflict
+	}
+	return t, err
+}
+
+func (s *SQLite) GetTeam(ctx context.Context, id int64) (Team, error) {
+	t, err := scanTeam(s.q.QueryRowContext(ctx, `SELECT `+teamColumns+` FROM teams WHERE id=?1`, id))
+	return t, notFound(err)
+}
+
+func (s *SQLite) RenameTeam(ctx context.Context, id int64, name string) error {
+	res, err := s.q.ExecContext(ctx, `UPDATE teams SET name=?2 WHERE id=?1`, id, name)
+	if isSQLiteUnique(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteTeam(ctx context.Context, id int64) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM teams WHERE id=?1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) TeamMembers(ctx context.Context, id int64) ([]TeamMember, error) {
+	return scanTeamMembers(s.q.QueryContext(ctx, `
+		SELECT u.id, u.username, m.joined_at, u.leaderboard_visibility <> 'public'
+		FROM team_members m JOIN users u ON u.id = m.user_id
+		WHERE m.team_id=?1
+		ORDER BY m.joined_at, u.id
+	`, id))
+}
+
+func (s *SQLite) UserTeam(ctx context.Context, userID int64) (int64, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx, `SELECT team_id FROM team_members WHERE user_id=?1`, userID).Scan(&id)
+	return id, notFound(err)
+}
+
+func (s *SQLite) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO team_members (user_id, team_id, joined_at) VALUES (?1, ?2, ?3)
+	`, userID, teamID, utcNow())
+	if isSQLiteUnique(err) {
+		return ErrConflict
+	}
+	if isSQLiteForeignKey(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *SQLite) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM team_members WHERE team_id=?1 AND user_id=?2`, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) TeamLeaderboard(ctx context.Context, limit int, after *LeaderboardCursor) ([]TeamEntry, error) {
+	const cols = `id, name, points, (SELECT COUNT(*) FROM team_members m WHERE m.team_id = teams.id)`
+	if after == nil {
+		rows, err := s.q.QueryContext(ctx, `
+			SELECT `+cols+` FROM teams ORDER BY points DESC, id ASC LIMIT ?1
+		`, limit)
+		return scanTeamEntries(rows, err, 0)
+	}
+	// everyone up to and including the cursor row ranks above this page
+	var rank int
+	if err := s.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM teams WHERE points > ?1 OR (points = ?1 AND id <= ?2)
+	`, after.Points, after.ID).Scan(&rank); err != nil {
+		return nil, err
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+cols+` FROM teams
+		WHERE points < ?1 OR (points = ?1 AND id > ?2)
+		ORDER BY points DESC, id ASC
+		LIMIT ?3
+	`, after.Points, after.ID, limit)
+	return scanTeamEntries(rows, err, rank)
+}
+
+func (s *SQLite) CountTeams(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM teams`).Scan(&n)
+	return n, err
+}
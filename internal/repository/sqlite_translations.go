@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+func (s *SQLite) TaskTranslations(ctx context.Context, code string) ([]TaskTranslation, error) {
+	return scanTranslations(s.q.QueryContext(ctx, `
+		SELECT `+translationColumns+` FROM task_translations WHERE task_code=?1 ORDER BY locale
+	`, code))
+}
+
+func (s *SQLite) TranslationsIn(ctx context.Context, locales []string) ([]TaskTranslation, error) {
+	if len(locales) == 0 {
+		return []TaskTranslation{}, nil
+	}
+	args := make([]any, len(locales))
+	for i, l := range locales {
+		args[i] = l
+	}
+	return scanTranslations(s.q.QueryContext(ctx, `
+		SELECT `+translationColumns+` FROM task_translations
+		WHERE locale IN (?`+strings.Repeat(`, ?`, len(locales)-1)+`)
+	`, args...))
+}
+
+func (s *SQLite) SetTaskTranslation(ctx context.Context, t TaskTranslation) (TaskTranslation, error) {
+	out, err := scanTranslation(s.q.QueryRowContext(ctx, `
+		INSERT INTO task_translations (task_code, locale, title, description, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		ON CONFLICT (task_code, locale) DO UPDATE
+		SET title = excluded.title, description = excluded.description, updated_at = excluded.updated_at
+		RETURNING `+translationColumns,
+		t.TaskCode, t.Locale, t.Title, t.Description, utcNow()))
+	if isSQLiteForeignKey(err) {
+		return out, ErrNotFound
+	}
+	return out, err
+}
+
+func (s *SQLite) DeleteTaskTranslation(ctx context.Context, code, locale string) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM task_translations WHERE task_code=?1 AND locale=?2`, code, locale)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// maxStmts caps the statements a stmts prepares. Queries built at run
+// time, such as those with an IN list, differ from call to call; once the
+// cap is reached, new ones run unprepared instead of growing the cache.
+const maxStmts = 512
+
+// stmts runs the SQL stores' queries as prepared statements. Each query is
+// prepared on db the first time it runs and reused after, and database/sql
+// prepares it again on whichever pooled connection runs it. In a
+// transaction, tx uses the same statements through tx.StmtContext.
+type stmts struct {
+	db    *sql.DB
+	mu    *sync.Mutex
+	cache map[string]*sql.Stmt
+	tx    *sql.Tx
+}
+
+func newStmts(db *sql.DB) stmts {
+	return stmts{db: db, mu: &sync.Mutex{}, cache: map[string]*sql.Stmt{}}
+}
+
+// inTx returns s running its statements in tx.
+func (s stmts) inTx(tx *sql.Tx) stmts {
+	s.tx = tx
+	return s
+}
+
+// conn is where unprepared queries run.
+func (s stmts) conn() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// stmt returns query prepared, or nil when it can't be: the cache is full,
+// or preparing failed, in which case running it unprepared reports why.
+func (s stmts) stmt(ctx context.Context, query string) *sql.Stmt {
+	s.mu.Lock()
+	st, ok := s.cache[query]
+	full := len(s.cache) >= maxStmts
+	s.mu.Unlock()
+	if !ok {
+		if full {
+			return nil
+		}
+		prepared, err := s.db.PrepareContext(ctx, query)
+		if err != nil {
+			return nil
+		}
+		s.mu.Lock()
+		if st, ok = s.cache[query]; ok {
+			// prepared concurrently; keep the first
+			prepared.Close()
+		} else {
+			st = prepared
+			s.cache[query] = st
+		}
+		s.mu.Unlock()
+	}
+	if s.tx != nil {
+		return s.tx.StmtContext(ctx, st)
+	}
+	return st
+}
+
+func (s stmts) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if st := s.stmt(ctx, query); st != nil {
+		return st.ExecContext(ctx, args...)
+	}
+	return s.conn().ExecContext(ctx, query, args...)
+}
+
+func (s stmts) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if st := s.stmt(ctx, query); st != nil {
+		return st.QueryContext(ctx, args...)
+	}
+	return s.conn().QueryContext(ctx, query, args...)
+}
+
+func (s stmts) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if st := s.stmt(ctx, query); st != nil {
+		return st.QueryRowContext(ctx, args...)
+	}
+	return s.conn().QueryRowContext(ctx, query, args...)
+}
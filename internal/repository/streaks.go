@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// streakCurrent is the stored streak, or 0 once a day has been missed.
+const streakCurrent = `CASE WHEN last_day >= current_date - 1 THEN current ELSE 0 END`
+
+// streakNext is what current in table becomes on day: unchanged for a
+// second entry on the same day, +1 after the day before, otherwise a fresh
+// start, capped by a positive max.
+func streakNext(table, day, max string) string {
+	return `LEAST(CASE
+			WHEN ` + table + `.last_day = ` + day + ` THEN ` + table + `.current
+			WHEN ` + table + `.last_day = ` + day + ` - 1 THEN ` + table + `.current + 1
+			ELSE 1
+		END, COALESCE(NULLIF(` + max + `, 0), 2147483647))`
+}
+
+func (p *Postgres) BumpStreak(ctx context.Context, userID int64, max int) (Streak, error) {
+	next := streakNext("user_streaks", "current_date", "$2")
+	var s Streak
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO user_streaks (user_id, current, longest, last_day)
+		VALUES ($1, 1, 1, current_date)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current = `+next+`, longest = GREATEST(user_streaks.longest, `+next+`), last_day = current_date
+		RETURNING current, longest, last_day, true
+	`, userID, max).Scan(&s.Current, &s.Longest, &s.LastDay, &s.CompletedToday)
+	return s, err
+}
+
+func (p *Postgres) GetStreak(ctx context.Context, userID int64) (Streak, error) {
+	var s Streak
+	err := p.q.QueryRowContext(ctx, `
+		SELECT `+streakCurrent+`, longest, last_day, last_day = current_date
+		FROM user_streaks WHERE user_id=$1
+	`, userID).Scan(&s.Current, &s.Longest, &s.LastDay, &s.CompletedToday)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Streak{}, nil
+	}
+	return s, err
+}
+
+func (p *Postgres) CheckIn(ctx context.Context, userID int64, day time.Time) (Streak, bool, error) {
+	next := streakNext("user_checkins", "$2::date", "0")
+	st := Streak{LastDay: &day, CompletedToday: true}
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO user_checkins (user_id, current, longest, last_day)
+		VALUES ($1, 1, 1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current = `+next+`, longest = GREATEST(user_checkins.longest, `+next+`), last_day = $2
+		WHERE user_checkins.last_day < $2
+		RETURNING current, longest
+	`, userID, day).Scan(&st.Current, &st.Longest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Streak{}, false, nil
+	}
+	return st, err == nil, err
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const submissionColumns = `id, user_id, task_code, proof, status, reason, awarded, reviewed_by, created_at, reviewed_at`
+
+func scanSubmission(sc interface{ Scan(...any) error }) (TaskSubmission, error) {
+	var (
+		sub   TaskSubmission
+		proof []byte
+	)
+	err := sc.Scan(&sub.ID, &sub.UserID, &sub.TaskCode, &proof, &sub.Status, &sub.Reason, &sub.Awarded,
+		&sub.ReviewedBy, &sub.CreatedAt, &sub.ReviewedAt)
+	sub.Proof = json.RawMessage(proof)
+	return sub, err
+}
+
+func scanSubmissions(rows *sql.Rows, err error) ([]TaskSubmission, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []TaskSubmission{}
+	for rows.Next() {
+		sub, err := scanSubmission(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sub)
+	}
+	return out, rows.Err()
+}
+
+// submissionQuery builds the ListSubmissions query with placeholders made
+// by param from their 1-based position.
+func submissionQuery(f SubmissionFilter, param func(n int) string) (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", param(len(args))))
+	}
+	if f.UserID != 0 {
+		add("user_id = ?", f.UserID)
+	}
+	if f.TaskCode != "" {
+		add("task_code = ?", f.TaskCode)
+	}
+	if f.Status != "" {
+		add("status = ?", f.Status)
+	}
+	if f.AfterID > 0 {
+		add("id > ?", f.AfterID)
+	}
+	query := `SELECT ` + submissionColumns + ` FROM task_submissions`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	return query + ` ORDER BY id LIMIT ` + param(len(args)), args
+}
+
+func (p *Postgres) CreateSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error) {
+	out, err := scanSubmission(p.q.QueryRowContext(ctx, `
+		INSERT INTO task_submissions (user_id, task_code, proof) VALUES ($1, $2, $3)
+		RETURNING `+submissionColumns,
+		sub.UserID, sub.TaskCode, []byte(sub.Proof)))
+	if isUniqueViolation(err) {
+		return out, ErrConflict
+	}
+	return out, err
+}
+
+func (p *Postgres) GetSubmission(ctx context.Context, id int64) (TaskSubmission, error) {
+	sub, err := scanSubmission(p.q.QueryRowContext(ctx, `SELECT `+submissionColumns+` FROM task_submissions WHERE id=$1`, id))
+	return sub, notFound(err)
+}
+
+func (p *Postgres) ListSubmissions(ctx context.Context, f SubmissionFilter) ([]TaskSubmission, error) {
+	query, args := submissionQuery(f, func(n int) string { return "$" + strconv.Itoa(n) })
+	return scanSubmissions(p.q.QueryContext(ctx, query, args...))
+}
+
+func (p *Postgres) ReviewSubmission(ctx context.Context, sub TaskSubmission) (TaskSubmission, error) {
+	out, err := scanSubmission(p.q.QueryRowContext(ctx, `
+		UPDATE task_submissions
+		SET status=$2, reason=$3, awarded=$4, reviewed_by=$5, reviewed_at=now()
+		WHERE id=$1 AND status='pending'
+		RETURNING `+submissionColumns,
+		sub.ID, sub.Status, sub.Reason, sub.Awarded, sub.ReviewedBy))
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, ErrConflict
+	}
+	return out, err
+}
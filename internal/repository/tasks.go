@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// taskAvailable mirrors Task.AvailableAt for filtering in SQL.
+const taskAvailable = `(active AND (starts_at IS NULL OR starts_at <= now()) AND (ends_at IS NULL OR ends_at > now()))`
+
+const taskColumns = `code, title, points, description, active, starts_at, ends_at, verifier, verifier_config,
+	COALESCE((SELECT string_agg(d.requires_code, ',' ORDER BY d.requires_code)
+	          FROM task_dependencies d WHERE d.task_code = tasks.code), ''),
+	COALESCE(category, ''),
+	COALESCE((SELECT string_agg(g.tag, ',' ORDER BY g.tag) FROM task_tags g WHERE g.task_code = tasks.code), ''),
+	max_completions, max_completions_per_user, completions, requires_review`
+
+func scanTask(sc interface{ Scan(...any) error }) (Task, error) {
+	var (
+		t              Task
+		requires, tags string
+	)
+	err := sc.Scan(&t.Code, &t.Title, &t.Points, &t.Description, &t.Active, &t.StartsAt, &t.EndsAt, &t.Verifier, &t.VerifierConfig,
+		&requires, &t.Category, &tags, &t.MaxCompletions, &t.MaxCompletionsPerUser, &t.Completions, &t.RequiresReview)
+	t.Requires = []string{}
+	if requires != "" {
+		t.Requires = strings.Split(requires, ",")
+	}
+	t.Tags = []string{}
+	if tags != "" {
+		t.Tags = strings.Split(tags, ",")
+	}
+	t.setRemaining()
+	return t, err
+}
+
+func (p *Postgres) GetTask(ctx context.Context, code string) (Task, error) {
+	t, err := scanTask(p.q.QueryRowContext(ctx, `SELECT `+taskColumns+` FROM tasks WHERE code=$1`, code))
+	return t, notFound(err)
+}
+
+func (p *Postgres) ListTasks(ctx context.Context, availableOnly bool) ([]Task, error) {
+	where := ""
+	if availableOnly {
+		where = `WHERE ` + taskAvailable
+	}
+	rows, err := p.q.QueryContext(ctx, `SELECT `+taskColumns+` FROM tasks `+where+` ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tasks := []Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+func (p *Postgres) CreateTask(ctx context.Context, t Task) (Task, error) {
+	out, err := scanTask(p.q.QueryRowContext(ctx, `
+		INSERT INTO tasks (code, title, points, description, active, starts_at, ends_at, verifier, verifier_config, category,
+		                   max_completions, max_completions_per_user, requires_review)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $13)
+		RETURNING `+taskColumns,
+		t.Code, t.Title, t.Points, t.Description, t.Active, t.StartsAt, t.EndsAt, t.Verifier, t.VerifierConfig, t.Category,
+		t.MaxCompletions, t.MaxCompletionsPerUser, t.RequiresReview))
+	if isUniqueViolation(err) {
+		return out, ErrConflict
+	}
+	return out, err
+}
+
+func (p *Postgres) UpdateTask(ctx context.Context, t Task) (Task, error) {
+	out, err := scanTask(p.q.QueryRowContext(ctx, `
+		UPDATE tasks
+		SET title=$2, points=$3, description=$4, active=$5, starts_at=$6, ends_at=$7,
+		    verifier=$8, verifier_config=$9, category=NULLIF($10, ''),
+		    max_completions=$11, max_completions_per_user=$12, requires_review=$13
+		WHERE code=$1
+		RETURNING `+taskColumns,
+		t.Code, t.Title, t.Points, t.Description, t.Active, t.StartsAt, t.EndsAt, t.Verifier, t.VerifierConfig, t.Category,
+		t.MaxCompletions, t.MaxCompletionsPerUser, t.RequiresReview))
+	return out, notFound(err)
+}
+
+func (p *Postgres) ArchiveTask(ctx context.Context, code string) error {
+	res, err := p.q.ExecContext(ctx, `UPDATE tasks SET active=false WHERE code=$1`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddUserTask numbers the user's completions of a task from 1, so of two
+// racing completions only one gets the next number.
+func (p *Postgres) AddUserTask(ctx context.Context, userID int64, code string, perUser int) (bool, error) {
+	var one int
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO user_tasks (user_id, task_code, n, completed_at)
+		SELECT $1, $2, COALESCE(MAX(n), 0) + 1, now()
+		FROM user_tasks WHERE user_id=$1 AND task_code=$2
+		HAVING COALESCE(MAX(n), 0) < $3
+		ON CONFLICT (user_id, task_code, n) DO NOTHING
+		RETURNING 1
+	`, userID, code, perUser).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (p *Postgres) RevokeUserTask(ctx context.Context, userID int64, code string) error {
+	res, err := p.q.ExecContext(ctx, `
+		DELETE FROM user_tasks
+		WHERE user_id=$1 AND task_code=$2
+		  AND n = (SELECT MAX(n) FROM user_tasks WHERE user_id=$1 AND task_code=$2)
+	`, userID, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = p.q.ExecContext(ctx, `UPDATE tasks SET completions = completions - 1 WHERE code=$1 AND completions > 0`, code)
+	return err
+}
+
+func (p *Postgres) ClaimTaskCompletion(ctx context.Context, code string) (bool, error) {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE tasks SET completions = completions + 1
+		WHERE code=$1 AND (max_completions IS NULL OR completions < max_completions)
+	`, code)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *Postgres) CountUserTask(ctx context.Context, userID int64, code string) (int, error) {
+	var cnt int
+	err := p.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_tasks WHERE user_id=$1 AND task_code=$2
+	`, userID, code).Scan(&cnt)
+	return cnt, err
+}
+
+func (p *Postgres) ListCompletedTasks(ctx context.Context, userID int64) ([]CompletedTask, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT t.code, t.title, t.points, ut.completed_at
+		FROM user_tasks ut
+		JOIN tasks t ON t.code = ut.task_code
+		WHERE ut.user_id=$1
+		ORDER BY ut.completed_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var completed []CompletedTask
+	for rows.Next() {
+		var tc CompletedTask
+		if err := rows.Scan(&tc.Code, &tc.Title, &tc.Points, &tc.CompletedAt); err != nil {
+			return nil, err
+		}
+		completed = append(completed, tc)
+	}
+	return completed, rows.Err()
+}
+
+func (p *Postgres) CompletedTasksPage(ctx context.Context, userID int64, limit int, after *CompletedTaskCursor) ([]CompletedTask, error) {
+	q, args := `
+		SELECT t.code, t.title, t.points, ut.completed_at, ut.n
+		FROM user_tasks ut
+		JOIN tasks t ON t.code = ut.task_code
+		WHERE ut.user_id=$1`, []any{userID, limit}
+	if after != nil {
+		q += ` AND (ut.completed_at, ut.task_code, ut.n) < ($3, $4, $5)`
+		args = append(args, after.CompletedAt, after.Code, after.N)
+	}
+	rows, err := p.q.QueryContext(ctx, q+` ORDER BY ut.completed_at DESC, ut.task_code DESC, ut.n DESC LIMIT $2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var completed []CompletedTask
+	for rows.Next() {
+		var tc CompletedTask
+		if err := rows.Scan(&tc.Code, &tc.Title, &tc.Points, &tc.CompletedAt, &tc.N); err != nil {
+			return nil, err
+		}
+		completed = append(completed, tc)
+	}
+	return completed, rows.Err()
+}
+
+func (p *Postgres) CountCompletedTasks(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := p.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_tasks WHERE user_id=$1`, userID).Scan(&n)
+	return n, err
+}
+
+func (p *Postgres) SetTaskPrerequisites(ctx context.Context, code string, requires []string) error {
+	if _, err := p.q.ExecContext(ctx, `DELETE FROM task_dependencies WHERE task_code=$1`, code); err != nil {
+		return err
+	}
+	for _, req := range requires {
+		_, err := p.q.ExecContext(ctx, `
+			INSERT INTO task_dependencies (task_code, requires_code) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, code, req)
+		if isForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) TaskDependsOn(ctx context.Context, from, to string) (bool, error) {
+	var found bool
+	err := p.q.QueryRowContext(ctx, `
+		WITH RECURSIVE reqs AS (
+			SELECT requires_code FROM task_dependencies WHERE task_code = $1
+			UNION
+			SELECT d.requires_code FROM task_dependencies d JOIN reqs r ON d.task_code = r.requires_code
+		)
+		SELECT EXISTS (SELECT 1 FROM reqs WHERE requires_code = $2)
+	`, from, to).Scan(&found)
+	return found, err
+}
+
+func (p *Postgres) MissingPrerequisites(ctx context.Context, userID int64, code string) ([]string, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT d.requires_code FROM task_dependencies d
+		WHERE d.task_code = $2
+		  AND NOT EXISTS (SELECT 1 FROM user_tasks ut WHERE ut.user_id = $1 AND ut.task_code = d.requires_code)
+		ORDER BY d.requires_code
+	`, userID, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	missing := []string{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		missing = append(missing, c)
+	}
+	return missing, rows.Err()
+}
+
+func (p *Postgres) SetTaskTags(ctx context.Context, code string, tags []string) error {
+	if _, err := p.q.ExecContext(ctx, `DELETE FROM task_tags WHERE task_code=$1`, code); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err := p.q.ExecContext(ctx, `
+			INSERT INTO task_tags (task_code, tag) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, code, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+const teamColumns = `id, name, points, (SELECT COUNT(*) FROM team_members m WHERE m.team_id = teams.id), created_at`
+
+func scanTeam(sc interface{ Scan(...any) error }) (Team, error) {
+	var t Team
+	err := sc.Scan(&t.ID, &t.Name, &t.Points, &t.Members, &t.CreatedAt)
+	return t, err
+}
+
+func scanTeamMembers(rows *sql.Rows, err error) ([]TeamMember, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []TeamMember{}
+	for rows.Next() {
+		var m TeamMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.JoinedAt, &m.Anonymous); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// scanTeamEntries numbers the rows from rank+1.
+func scanTeamEntries(rows *sql.Rows, err error, rank int) ([]TeamEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TeamEntry
+	for rows.Next() {
+		var e TeamEntry
+		if err := rows.Scan(&e.ID, &e.Name, &e.Points, &e.Members); err != nil {
+			return nil, err
+		}
+		rank++
+		e.Rank = rank
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) CreateTeam(ctx context.Context, name string) (Team, error) {
+	t, err := scanTeam(p.q.QueryRowContext(ctx, `
+		INSERT INTO teams (name) VALUES ($1) RETURNING `+teamColumns, name))
+	if isUniqueViolation(err) {
+		return t, ErrConflict
+	}
+	return t, err
+}
+
+func (p *Postgres) GetTeam(ctx context.Context, id int64) (Team, error) {
+	t, err := scanTeam(p.q.QueryRowContext(ctx, `SELECT `+teamColumns+` FROM teams WHERE id=$1`, id))
+	return t, notFound(err)
+}
+
+func (p *Postgres) RenameTeam(ctx context.Context, id int64, name string) error {
+	res, err := p.q.ExecContext(ctx, `UPDATE teams SET name=$2 WHERE id=$1`, id, name)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteTeam(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM teams WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) TeamMembers(ctx context.Context, id int64) ([]TeamMember, error) {
+	return scanTeamMembers(p.q.QueryContext(ctx, `
+		SELECT u.id, u.username, m.joined_at, u.leaderboard_visibility <> 'public'
+		FROM team_members m JOIN users u ON u.id = m.user_id
+		WHERE m.team_id=$1
+		ORDER BY m.joined_at, u.id
+	`, id))
+}
+
+func (p *Postgres) UserTeam(ctx context.Context, userID int64) (int64, error) {
+	var id int64
+	err := p.q.QueryRowContext(ctx, `SELECT team_id FROM team_members WHERE user_id=$1`, userID).Scan(&id)
+	return id, notFound(err)
+}
+
+func (p *Postgres) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	_, err := p.q.ExecContext(ctx, `INSERT INTO team_members (user_id, team_id) VALUES ($1, $2)`, userID, teamID)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (p *Postgres) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM team_members WHERE team_id=$1 AND user_id=$2`, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) TeamLeaderboard(ctx context.Context, limit int, after *LeaderboardCursor) ([]TeamEntry, error) {
+	const cols = `id, name, points, (SELECT COUNT(*) FROM team_members m WHERE m.team_id = teams.id)`
+	if after == nil {
+		rows, err := p.q.QueryContext(ctx, `
+			SELECT `+cols+` FROM teams ORDER BY points DESC, id ASC LIMIT $1
+		`, limit)
+		return scanTeamEntries(rows, err, 0)
+	}
+	// everyone up to and including the cursor row ranks above this page
+	var rank int
+	if err := p.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM teams WHERE points > $1 OR (points = $1 AND id <= $2)
+	`, after.Points, after.ID).Scan(&rank); err != nil {
+		return nil, err
+	}
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT `+cols+` FROM teams
+		WHERE points < $1 OR (points = $1 AND id > $2)
+		ORDER BY points DESC, id ASC
+		LIMIT $3
+	`, after.Points, after.ID, limit)
+	return scanTeamEntries(rows, err, rank)
+}
+
+func (p *Postgres) CountTeams(ctx context.Context) (int64, error) {
+	var n int64
+	err := p.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM teams`).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+func (p *Postgres) CreateRefreshToken(ctx context.Context, userID int64, familyID, tokenHash string, ttl time.Duration) (int64, error) {
+	var id int64
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, COALESCE(NULLIF($2, '')::uuid, gen_random_uuid()), $3, now() + make_interval(secs => $4))
+		RETURNING id
+	`, userID, familyID, tokenHash, ttl.Seconds()).Scan(&id)
+	return id, err
+}
+
+func (p *Postgres) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	var t RefreshToken
+	err := p.q.QueryRowContext(ctx, `
+		SELECT id, user_id, family_id, expires_at, revoked_at
+		FROM refresh_tokens WHERE token_hash=$1
+		FOR UPDATE
+	`, tokenHash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.ExpiresAt, &t.RevokedAt)
+	return t, notFound(err)
+}
+
+func (p *Postgres) RotateRefreshToken(ctx context.Context, id, replacedBy int64) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now(), replaced_by = $2 WHERE id=$1
+	`, id, replacedBy)
+	return err
+}
+
+func (p *Postgres) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now()
+		WHERE family_id=$1 AND revoked_at IS NULL
+	`, familyID)
+	return err
+}
+
+func (p *Postgres) RevokeRefreshFamilyOf(ctx context.Context, tokenHash string) error {
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash=$1)
+		  AND revoked_at IS NULL
+	`, tokenHash)
+	return err
+}
+
+func (p *Postgres) PurgeRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *Postgres) RevokeAccessToken(ctx context.Context, t RevokedToken) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, NULLIF($2, 0), $3)
+		ON CONFLICT (jti) DO NOTHING
+	`, t.JTI, t.UserID, t.ExpiresAt)
+	return err
+}
+
+func (p *Postgres) RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO user_token_cutoffs (user_id, revoked_before) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = GREATEST(user_token_cutoffs.revoked_before, EXCLUDED.revoked_before)
+	`, userID, before)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = p.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now() WHERE user_id=$1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
+
+func (p *Postgres) TokenRevocations(ctx context.Context, now time.Time) (TokenRevocations, error) {
+	out := TokenRevocations{JTIs: map[string]time.Time{}, Users: map[int64]time.Time{}}
+	rows, err := p.q.QueryContext(ctx, `SELECT jti, expires_at FROM revoked_tokens WHERE expires_at >= $1`, now)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jti string
+		var exp time.Time
+		if err := rows.Scan(&jti, &exp); err != nil {
+			return out, err
+		}
+		out.JTIs[jti] = exp
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+	rows, err = p.q.QueryContext(ctx, `SELECT user_id, revoked_before FROM user_token_cutoffs`)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var before time.Time
+		if err := rows.Scan(&id, &before); err != nil {
+			return out, err
+		}
+		out.Users[id] = before
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) PurgeRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
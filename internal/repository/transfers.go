@@ -0,0 +1,22 @@
+package repository
+
+import "context"
+
+func (p *Postgres) CreateTransfer(ctx context.Context, fromID, toID, amount int64) (Transfer, error) {
+	t := Transfer{FromUserID: fromID, ToUserID: toID, Amount: amount}
+	err := p.q.QueryRowContext(ctx, `
+		INSERT INTO point_transfers (from_user_id, to_user_id, amount)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, fromID, toID, amount).Scan(&t.ID, &t.CreatedAt)
+	return t, err
+}
+
+func (p *Postgres) TransferredToday(ctx context.Context, userID int64) (int64, error) {
+	var sum int64
+	err := p.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM point_transfers
+		WHERE from_user_id=$1 AND created_at >= current_date
+	`, userID).Scan(&sum)
+	return sum, err
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+const translationColumns = `task_code, locale, title, description, updated_at`
+
+func scanTranslation(sc interface{ Scan(...any) error }) (TaskTranslation, error) {
+	var t TaskTranslation
+	err := sc.Scan(&t.TaskCode, &t.Locale, &t.Title, &t.Description, &t.UpdatedAt)
+	return t, err
+}
+
+func scanTranslations(rows *sql.Rows, err error) ([]TaskTranslation, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []TaskTranslation{}
+	for rows.Next() {
+		t, err := scanTranslation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) TaskTranslations(ctx context.Context, code string) ([]TaskTranslation, error) {
+	return scanTranslations(p.q.QueryContext(ctx, `
+		SELECT `+translationColumns+` FROM task_translations WHERE task_code=$1 ORDER BY locale
+	`, code))
+}
+
+func (p *Postgres) TranslationsIn(ctx context.Context, locales []string) ([]TaskTranslation, error) {
+	return scanTranslations(p.q.QueryContext(ctx, `
+		SELECT `+translationColumns+` FROM task_translations WHERE locale = ANY($1)
+	`, locales))
+}
+
+func (p *Postgres) SetTaskTranslation(ctx context.Context, t TaskTranslation) (TaskTranslation, error) {
+	out, err := scanTranslation(p.q.QueryRowContext(ctx, `
+		INSERT INTO task_translations (task_code, locale, title, description, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (task_code, locale) DO UPDATE
+		SET title = EXCLUDED.title, description = EXCLUDED.description, updated_at = EXCLUDED.updated_at
+		RETURNING `+translationColumns,
+		t.TaskCode, t.Locale, t.Title, t.Description))
+	if isForeignKeyViolation(err) {
+		return out, ErrNotFound
+	}
+	return out, err
+}
+
+func (p *Postgres) DeleteTaskTranslation(ctx context.Context, code, locale string) error {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM task_translations WHERE task_code=$1 AND locale=$2`, code, locale)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
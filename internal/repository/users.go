@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const userColumns = `id, username, points, referrer_id, created_at, status, status_reason, status_until, version`
+
+func scanUser(sc interface{ Scan(...any) error }) (User, error) {
+	var u User
+	err := sc.Scan(&u.ID, &u.Username, &u.Points, &u.ReferrerID, &u.CreatedAt, &u.Status, &u.StatusReason, &u.StatusUntil, &u.Version)
+	u.liftExpired(time.Now())
+	return u, err
+}
+
+func (p *Postgres) GetUser(ctx context.Context, id int64) (User, error) {
+	u, err := scanUser(p.q.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users WHERE id=$1 AND deleted_at IS NULL
+	`, id))
+	return u, notFound(err)
+}
+
+func (p *Postgres) CreateUser(ctx context.Context, username, passwordHash, homeRegion string) (User, error) {
+	u, err := scanUser(p.q.QueryRowContext(ctx, `
+		INSERT INTO users (username, password_hash, home_region)
+		VALUES ($1, $2, $3)
+		RETURNING `+userColumns,
+		username, passwordHash, homeRegion))
+	if isUniqueViolation(err) {
+		return u, ErrConflict
+	}
+	return u, err
+}
+
+func (p *Postgres) GetPasswordHash(ctx context.Context, username string) (int64, string, error) {
+	var id int64
+	var hash sql.NullString
+	err := p.q.QueryRowContext(ctx, `
+		SELECT id, password_hash FROM users WHERE username=$1
+	`, username).Scan(&id, &hash)
+	return id, hash.String, notFound(err)
+}
+
+func (p *Postgres) GetHomeRegion(ctx context.Context, id int64) (string, error) {
+	var home sql.NullString
+	err := p.q.QueryRowContext(ctx, `SELECT home_region FROM users WHERE id=$1`, id).Scan(&home)
+	return home.String, notFound(err)
+}
+
+func (p *Postgres) SetReferrer(ctx context.Context, userID, referrerID int64) error {
+	_, err := p.q.ExecContext(ctx, `UPDATE users SET referrer_id=$1 WHERE id=$2`, referrerID, userID)
+	return err
+}
+
+func (p *Postgres) CreateReferral(ctx context.Context, r Referral) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO referrals (referrer_id, referred_id, bonus_referrer, bonus_referred, status, created_at, paid_at)
+		VALUES ($1, $2, $3, $4, $5, now(), CASE WHEN $5 = 'paid' THEN now() END)
+	`, r.ReferrerID, r.ReferredID, r.BonusReferrer, r.BonusReferred, r.Status)
+	return err
+}
+
+// dueReferralsSQL lists pending referrals whose referred user has made
+// {tasks} completions and earned {points} from tasks, {limit} at a time.
+const dueReferralsSQL = `
+	SELECT r.referrer_id, r.referred_id, r.bonus_referrer, r.bonus_referred, r.status, r.created_at, r.paid_at
+	FROM referrals r JOIN users u ON u.id = r.referred_id
+	WHERE r.status = 'pending' AND u.deleted_at IS NULL AND u.status <> 'banned'
+	  AND (SELECT COUNT(*) FROM user_tasks t WHERE t.user_id = r.referred_id) >= {tasks}
+	  AND (SELECT COALESCE(SUM(pt.amount), 0) FROM point_transactions pt
+	       WHERE pt.user_id = r.referred_id AND (pt.reason LIKE 'task:%' OR pt.reason LIKE 'task_revoked:%')) >= {points}
+	ORDER BY r.id
+	LIMIT {limit}
+`
+
+// dueReferralsQuery fills in dueReferralsSQL's bind parameters.
+func dueReferralsQuery(tasks, points, limit string) string {
+	return strings.NewReplacer("{tasks}", tasks, "{points}", points, "{limit}", limit).Replace(dueReferralsSQL)
+}
+
+func (p *Postgres) DueReferrals(ctx context.Context, m ReferralMilestone, limit int) ([]Referral, error) {
+	rows, err := p.q.QueryContext(ctx, dueReferralsQuery("$1", "$2", "$3"), m.Tasks, m.Points, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanReferrals(rows)
+}
+
+func (p *Postgres) PayReferral(ctx context.Context, referrerID, referredID int64) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE referrals SET status = 'paid', paid_at = now()
+		WHERE referrer_id = $1 AND referred_id = $2 AND status = 'pending'
+	`, referrerID, referredID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) ExpireReferrals(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := p.q.ExecContext(ctx, `UPDATE referrals SET status = 'expired' WHERE status = 'pending' AND created_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *Postgres) ListReferrals(ctx context.Context, userID int64) ([]Referral, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT referrer_id, referred_id, bonus_referrer, bonus_referred, status, created_at, paid_at
+		FROM referrals
+		WHERE referrer_id=$1 OR referred_id=$1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanReferrals(rows)
+}
+
+func (p *Postgres) ReferrerBonuses(ctx context.Context, referrerID int64, day, month time.Time) (ReferrerBonusCounts, error) {
+	var c ReferrerBonusCounts
+	err := p.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE created_at >= $2), COUNT(*) FILTER (WHERE created_at >= $3), COUNT(*)
+		FROM referrals
+		WHERE referrer_id=$1 AND bonus_referrer > 0 AND status <> 'expired'
+	`, referrerID, day, month).Scan(&c.Day, &c.Month, &c.Total)
+	return c, err
+}
+
+func scanReferrals(rows *sql.Rows) ([]Referral, error) {
+	defer rows.Close()
+	out := []Referral{}
+	for rows.Next() {
+		var r Referral
+		if err := rows.Scan(&r.ReferrerID, &r.ReferredID, &r.BonusReferrer, &r.BonusReferred, &r.Status, &r.CreatedAt, &r.PaidAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) GetProfile(ctx context.Context, id int64) (Profile, error) {
+	var pr Profile
+	err := p.q.QueryRowContext(ctx, `
+		SELECT display_name, avatar_url, timezone, locale, version FROM users WHERE id=$1 AND deleted_at IS NULL
+	`, id).Scan(&pr.DisplayName, &pr.AvatarURL, &pr.Timezone, &pr.Locale, &pr.Version)
+	return pr, notFound(err)
+}
+
+func (p *Postgres) UpdateProfile(ctx context.Context, id int64, pr Profile) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE users SET display_name=$2, avatar_url=$3, timezone=$4, locale=$5, version = version + 1
+		WHERE id=$1 AND deleted_at IS NULL AND version=$6
+	`, id, pr.DisplayName, pr.AvatarURL, pr.Timezone, pr.Locale, pr.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return p.CheckUserVersion(ctx, id, pr.Version)
+	}
+	return nil
+}
+
+func (p *Postgres) CheckUserVersion(ctx context.Context, id, version int64) error {
+	var v int64
+	err := p.q.QueryRowContext(ctx, `SELECT version FROM users WHERE id=$1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&v)
+	if err != nil {
+		return notFound(err)
+	}
+	if v != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (p *Postgres) Profiles(ctx context.Context, ids []int64) (map[int64]Profile, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT id, display_name, avatar_url, timezone, locale FROM users WHERE id = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int64]Profile, len(ids))
+	for rows.Next() {
+		var (
+			id int64
+			pr Profile
+		)
+		if err := rows.Scan(&id, &pr.DisplayName, &pr.AvatarURL, &pr.Timezone, &pr.Locale); err != nil {
+			return nil, err
+		}
+		out[id] = pr
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) GetSettings(ctx context.Context, id int64) (Settings, error) {
+	var st Settings
+	err := p.q.QueryRowContext(ctx, `
+		SELECT leaderboard_visibility FROM users WHERE id=$1 AND deleted_at IS NULL
+	`, id).Scan(&st.LeaderboardVisibility)
+	return st, notFound(err)
+}
+
+func (p *Postgres) UpdateSettings(ctx context.Context, id int64, st Settings) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE users SET leaderboard_visibility=$2 WHERE id=$1 AND deleted_at IS NULL
+	`, id, st.LeaderboardVisibility)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteUser(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `
+		INSERT INTO deleted_users (user_id, username, password_hash, display_name, avatar_url, timezone, locale)
+		SELECT id, username, password_hash, display_name, avatar_url, timezone, locale
+		FROM users WHERE id=$1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	// ':' can't appear in a registered username, so this one stays free
+	if _, err := p.q.ExecContext(ctx, `
+		UPDATE users
+		SET deleted_at=now(), username='deleted:' || id, password_hash=NULL,
+		    display_name='', avatar_url='', timezone='', locale=''
+		WHERE id=$1
+	`, id); err != nil {
+		return err
+	}
+	_, err = p.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now() WHERE user_id=$1 AND revoked_at IS NULL
+	`, id)
+	return err
+}
+
+func (p *Postgres) RestoreUser(ctx context.Context, id int64, since time.Time) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE users u
+		SET deleted_at=NULL, username=d.username, password_hash=d.password_hash,
+		    display_name=d.display_name, avatar_url=d.avatar_url, timezone=d.timezone, locale=d.locale
+		FROM deleted_users d
+		WHERE u.id=$1 AND d.user_id=u.id AND d.deleted_at >= $2
+	`, id, since)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = p.q.ExecContext(ctx, `DELETE FROM deleted_users WHERE user_id=$1`, id)
+	return err
+}
+
+func (p *Postgres) SearchUsers(ctx context.Context, f UserFilter) ([]User, error) {
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if f.UsernamePrefix != "" {
+		add("strpos(username, ?) = 1", f.UsernamePrefix)
+	}
+	if f.MinPoints != nil {
+		add("points >= ?", *f.MinPoints)
+	}
+	if f.CreatedAfter != nil {
+		add("created_at > ?", *f.CreatedAfter)
+	}
+	if f.Status != "" {
+		where = append(where, strings.ReplaceAll(statusCond(f.Status), "?", "now()"))
+	}
+	if f.Before > 0 {
+		add("id < ?", f.Before)
+	}
+	args = append(args, f.Limit)
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY id DESC LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanUsers(rows)
+}
+
+// statusCond matches users whose status is status as of ?, the current
+// time, which appears at most once.
+func statusCond(status string) string {
+	switch status {
+	case UserActive:
+		return "(status = 'active' OR (status = 'suspended' AND status_until <= ?))"
+	case UserSuspended:
+		return "(status = 'suspended' AND (status_until IS NULL OR status_until > ?))"
+	}
+	return "status = 'banned'"
+}
+
+func scanUsers(rows *sql.Rows) ([]User, error) {
+	defer rows.Close()
+	out := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) SetUserStatus(ctx context.Context, id int64, status, reason string, until *time.Time) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE users SET status=$2, status_reason=$3, status_until=$4
+		WHERE id=$1 AND deleted_at IS NULL
+	`, id, status, reason, until)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if status != UserBanned {
+		return nil
+	}
+	_, err = p.q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now() WHERE user_id=$1 AND revoked_at IS NULL
+	`, id)
+	return err
+}
+
+func (p *Postgres) ClearReferrer(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `UPDATE users SET referrer_id=NULL WHERE id=$1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = p.q.ExecContext(ctx, `DELETE FROM referrals WHERE referred_id=$1`, id)
+	return err
+}
+
+func (p *Postgres) PurgeDeletedUsers(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := p.q.ExecContext(ctx, `DELETE FROM deleted_users WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const webhookEndpointColumns = `id, url, secret, events, active, created_at`
+
+func scanWebhookEndpoint(sc interface{ Scan(...any) error }) (WebhookEndpoint, error) {
+	var (
+		e      WebhookEndpoint
+		events string
+	)
+	err := sc.Scan(&e.ID, &e.URL, &e.Secret, &events, &e.Active, &e.CreatedAt)
+	e.Events = strings.Split(events, ",")
+	return e, err
+}
+
+func (p *Postgres) CreateWebhookEndpoint(ctx context.Context, e WebhookEndpoint) (WebhookEndpoint, error) {
+	return scanWebhookEndpoint(p.q.QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints (url, secret, events) VALUES ($1, $2, $3)
+		RETURNING `+webhookEndpointColumns,
+		e.URL, e.Secret, strings.Join(e.Events, ",")))
+}
+
+func (p *Postgres) GetWebhookEndpoint(ctx context.Context, id int64) (WebhookEndpoint, error) {
+	e, err := scanWebhookEndpoint(p.q.QueryRowContext(ctx,
+		`SELECT `+webhookEndpointColumns+` FROM webhook_endpoints WHERE id=$1`, id))
+	return e, notFound(err)
+}
+
+func (p *Postgres) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	rows, err := p.q.QueryContext(ctx, `SELECT `+webhookEndpointColumns+` FROM webhook_endpoints ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookEndpoint{}
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) DisableWebhookEndpoint(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `UPDATE webhook_endpoints SET active=false WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	// nothing left to send to a disabled endpoint
+	_, err = p.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status='failed', last_error='endpoint disabled'
+		WHERE endpoint_id=$1 AND status='pending'
+	`, id)
+	return err
+}
+
+func (p *Postgres) EnqueueWebhookEvent(ctx context.Context, eventID, event string, payload json.RawMessage) error {
+	_, err := p.q.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event, payload)
+		SELECT id, $1, $2, $3::jsonb FROM webhook_endpoints
+		WHERE active AND (events = '*' OR $2 = ANY(string_to_array(events, ',')))
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`, eventID, event, string(payload))
+	return err
+}
+
+func (p *Postgres) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingDelivery, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + $2 * interval '1 millisecond'
+		FROM webhook_endpoints e
+		WHERE e.id = d.endpoint_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.event_id, d.event, d.payload, d.attempts, e.url, e.secret
+	`, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []PendingDelivery{}
+	for rows.Next() {
+		var (
+			d       PendingDelivery
+			payload []byte
+		)
+		if err := rows.Scan(&d.ID, &d.EventID, &d.Event, &payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) RecordWebhookAttempt(ctx context.Context, id int64, a WebhookAttempt) error {
+	status := "pending"
+	switch {
+	case a.Delivered:
+		status = "delivered"
+	case a.RetryIn <= 0:
+		status = "failed"
+	}
+	_, err := p.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4,
+		    next_attempt_at = now() + $5 * interval '1 millisecond',
+		    delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+		WHERE id = $1
+	`, id, status, a.StatusCode, a.Error, a.RetryIn.Milliseconds())
+	return err
+}
+
+func (p *Postgres) ListWebhookDeliveries(ctx context.Context, endpointID int64, status string, before int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := p.q.QueryContext(ctx, `
+		SELECT id, endpoint_id, event_id, event, payload, status, attempts, next_attempt_at,
+		       last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1 AND ($2 = '' OR status = $2) AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4
+	`, endpointID, status, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookDelivery{}
+	for rows.Next() {
+		var (
+			d       WebhookDelivery
+			payload []byte
+		)
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	res, err := p.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET status = 'pending', attempts = 0, next_attempt_at = now()
+		FROM webhook_endpoints e
+		WHERE d.id = $1 AND e.id = d.endpoint_id AND e.active AND d.status <> 'pending'
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
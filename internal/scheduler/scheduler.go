@@ -0,0 +1,124 @@
+// Package scheduler runs periodic jobs on a cron-like schedule. Every
+// instance runs the same scheduler against one database; a job's run for a
+// given slot happens on exactly one of them.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Store keeps job locks and the slots jobs last ran for;
+// repository.Store implements it.
+type Store interface {
+	// TryLockJob takes the job's lock unless another run holds it, on
+	// this instance or another; ok is false then. Otherwise unlock must
+	// be called once the run is over.
+	TryLockJob(ctx context.Context, name string) (unlock func(), ok bool, err error)
+	// ClaimJobRun records that the job's run for slot has started. It
+	// reports false if that slot, or a later one, was claimed already.
+	ClaimJobRun(ctx context.Context, name string, slot time.Time) (bool, error)
+	// FinishJobRun records how the run for slot ended; errMsg is empty
+	// on success.
+	FinishJobRun(ctx context.Context, name string, slot time.Time, errMsg string) error
+}
+
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+}
+
+type Scheduler struct {
+	store Store
+	jobs  []Job
+}
+
+func New(store Store) *Scheduler {
+	return &Scheduler{store: store}
+}
+
+// Add registers a job to run on spec, see Parse.
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context) error) error {
+	sched, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.jobs = append(s.jobs, Job{Name: name, Schedule: sched, Run: run})
+	return nil
+}
+
+// Run runs the jobs until ctx is done, then waits for the running ones to
+// return.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func(j Job) {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
+
+// loop waits for each slot in turn and runs the job for it. Slots that
+// pass while a run is still going are skipped rather than caught up on.
+func (s *Scheduler) loop(ctx context.Context, j Job) {
+	var last time.Time
+	for {
+		from := time.Now()
+		if from.Before(last) {
+			// a timer can fire a little early; don't pick the same slot twice
+			from = last
+		}
+		slot := j.Schedule.Next(from)
+		if slot.IsZero() {
+			return
+		}
+		t := time.NewTimer(time.Until(slot))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		s.run(ctx, j, slot)
+		last = slot
+	}
+}
+
+// run takes the job's lock, so runs never overlap, and then claims the
+// slot, so an instance whose timer fires after another's run has finished
+// doesn't repeat it.
+func (s *Scheduler) run(ctx context.Context, j Job, slot time.Time) {
+	unlock, ok, err := s.store.TryLockJob(ctx, j.Name)
+	if err != nil {
+		log.Printf("job %s: lock: %v", j.Name, err)
+		return
+	}
+	if !ok {
+		// still running, here or on another instance
+		return
+	}
+	defer unlock()
+	claimed, err := s.store.ClaimJobRun(ctx, j.Name, slot)
+	if err != nil {
+		log.Printf("job %s: claim: %v", j.Name, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	var errMsg string
+	if err := j.Run(ctx); err != nil {
+		errMsg = err.Error()
+		log.Printf("job %s: %v", j.Name, err)
+	}
+	if err := s.store.FinishJobRun(context.WithoutCancel(ctx), j.Name, slot, errMsg); err != nil {
+		log.Printf("job %s: finish: %v", j.Name, err)
+	}
+}
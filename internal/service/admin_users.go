@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermUsersManage allows searching users, changing their status,
+// resetting their referrer and revoking their task completions through
+// /admin/users.
+const PermUsersManage = "users:manage"
+
+const (
+	AuditUserStatusChanged = "user.status_changed"
+	AuditReferrerReset     = "user.referrer_reset"
+	AuditTaskRevoked       = "task.revoked"
+)
+
+var ErrCompletionNotFound = newError("COMPLETION_NOT_FOUND", "user has not completed the task")
+
+// AccountStatusError means the user's status doesn't allow what they tried:
+// banned users can't sign in, suspended ones can't earn or move points.
+type AccountStatusError struct {
+	Status string
+	Reason string
+	// Until is when a suspension ends; nil if it doesn't.
+	Until *time.Time
+}
+
+func (e *AccountStatusError) Code() string {
+	if e.Status == repository.UserBanned {
+		return CodeUserBanned
+	}
+	return CodeUserSuspended
+}
+
+func (e *AccountStatusError) Error() string {
+	msg := "user is " + e.Status
+	if e.Until != nil {
+		msg += " until " + e.Until.UTC().Format(time.RFC3339)
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+func statusError(u repository.User) error {
+	if u.Status == repository.UserActive {
+		return nil
+	}
+	return &AccountStatusError{Status: u.Status, Reason: u.StatusReason, Until: u.StatusUntil}
+}
+
+// CheckActive returns an *AccountStatusError unless the user is active.
+func (s *Service) CheckActive(ctx context.Context, id int64) error {
+	u, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	return statusError(u)
+}
+
+func (s *Service) SearchUsers(ctx context.Context, f repository.UserFilter) ([]repository.User, error) {
+	return s.store.SearchUsers(ctx, f)
+}
+
+// UserDetails is everything an admin sees about one user.
+type UserDetails struct {
+	User           repository.User    `json:"user"`
+	Profile        repository.Profile `json:"profile"`
+	CompletedCount int64              `json:"completed_count"`
+	// CompletedTasks are the latest completions, as on the user's status.
+	CompletedTasks []repository.CompletedTask `json:"completed_tasks"`
+	Streak         StreakStatus               `json:"streak"`
+	Roles          []string                   `json:"roles"`
+}
+
+func (s *Service) UserDetails(ctx context.Context, id int64) (UserDetails, error) {
+	var d UserDetails
+	st, err := s.UserStatus(ctx, id)
+	if err != nil {
+		return d, err
+	}
+	d.User, d.CompletedCount, d.CompletedTasks = st.User, st.CompletedCount, st.Recent
+	if d.CompletedTasks == nil {
+		d.CompletedTasks = []repository.CompletedTask{}
+	}
+	if d.Profile, err = s.store.GetProfile(ctx, id); err != nil {
+		return d, err
+	}
+	if d.Streak, err = s.Streak(ctx, id); err != nil {
+		return d, err
+	}
+	d.Roles, err = s.store.UserRoles(ctx, id)
+	return d, err
+}
+
+type StatusInput struct {
+	Status string     `json:"status"`
+	Reason string     `json:"reason,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// SetUserStatus changes the user's status. Suspending or banning needs a
+// reason; a suspension may set Until, after which the user is active again
+// without anyone lifting it. A banned user can't sign in and their refresh
+// tokens are revoked; access tokens already issued run out within the
+// access token TTL, but can't be used to earn points meanwhile.
+func (s *Service) SetUserStatus(ctx context.Context, id int64, in StatusInput) (repository.User, error) {
+	in.Reason = strings.TrimSpace(in.Reason)
+	switch in.Status {
+	case repository.UserActive:
+		in.Reason, in.Until = "", nil
+	case repository.UserSuspended, repository.UserBanned:
+		if in.Reason == "" || utf8.RuneCountInString(in.Reason) > 500 {
+			return repository.User{}, invalid("reason is required, at most 500 characters")
+		}
+		if in.Until != nil && in.Status == repository.UserBanned {
+			return repository.User{}, invalid("until is only allowed for suspensions")
+		}
+		if in.Until != nil && !in.Until.After(s.now()) {
+			return repository.User{}, invalid("until must be in the future")
+		}
+	default:
+		return repository.User{}, invalid("status must be active, suspended or banned")
+	}
+	return s.changeUser(ctx, id, AuditUserStatusChanged, func(q repository.Queries) error {
+		return q.SetUserStatus(ctx, id, in.Status, in.Reason, in.Until)
+	})
+}
+
+// ResetReferrer unsets the user's referrer so another can be set. Referral
+// bonuses already paid to either side are kept.
+func (s *Service) ResetReferrer(ctx context.Context, id int64) (repository.User, error) {
+	return s.changeUser(ctx, id, AuditReferrerReset, func(q repository.Queries) error {
+		return q.ClearReferrer(ctx, id)
+	})
+}
+
+// Revocation is the outcome of RevokeTask.
+type Revocation struct {
+	UserID  int64  `json:"user_id"`
+	Task    string `json:"task"`
+	Debited int64  `json:"debited"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RevokeTask undoes the user's latest completion of code, for completions
+// found to be fraudulent: it deletes the completion, frees its slot toward
+// the task's MaxCompletions and debits what it awarded, all in one
+// transaction with a task.revoked event. The amount comes from the ledger,
+// so the streak multiplier is taken back too; a completion from before the
+// ledger is debited the task's current points. Streaks, referral bonuses
+// and tasks completed on the strength of this one are left alone. A user
+// who has spent the points gets ErrInsufficientPoints.
+func (s *Service) RevokeTask(ctx context.Context, userID int64, code, reason string) (Revocation, error) {
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > 500 {
+		return Revocation{}, invalid("reason must be at most 500 characters")
+	}
+	rev := Revocation{UserID: userID, Task: code, Reason: reason}
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		if _, err := q.GetUser(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+		task, err := q.GetTask(ctx, code)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTaskNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.RevokeUserTask(ctx, userID, code); errors.Is(err, repository.ErrNotFound) {
+			return ErrCompletionNotFound
+		} else if err != nil {
+			return err
+		}
+		if rev.Debited, err = lastAward(ctx, q, userID, task); err != nil {
+			return err
+		}
+		if err := s.accrue(ctx, q, AuditTaskRevoked, userID, -rev.Debited, "task_revoked:"+code, map[string]any{
+			"task": code, "reason": reason,
+		}); err != nil {
+			return err
+		}
+		return emit(ctx, q, EventTaskRevoked, rev)
+	})
+	if err != nil {
+		return Revocation{}, err
+	}
+	s.RefreshCachedPoints(ctx, userID)
+	return rev, nil
+}
+
+// lastAward is what the user's latest standing completion of task
+// awarded.
+func lastAward(ctx context.Context, q repository.Queries, userID int64, task repository.Task) (int64, error) {
+	awards, err := standingAwards(ctx, q, userID, task)
+	if err != nil || len(awards) == 0 {
+		return task.Points, err
+	}
+	return awards[len(awards)-1], nil
+}
+
+// standingAwards are what the user's standing completions of task
+// awarded, oldest first, as far as the ledger goes back. Each revocation
+// in the ledger cancels the award before it, so repeated revocations walk
+// back through the awards.
+func standingAwards(ctx context.Context, q repository.Queries, userID int64, task repository.Task) ([]int64, error) {
+	entries, err := q.LedgerByReason(ctx, userID, []string{"task:" + task.Code, "task_revoked:" + task.Code})
+	if err != nil {
+		return nil, err
+	}
+	var awards []int64
+	for _, e := range entries {
+		if e.Reason == "task:"+task.Code {
+			awards = append(awards, e.Amount)
+		} else if len(awards) > 0 {
+			awards = awards[:len(awards)-1]
+		}
+	}
+	return awards, nil
+}
+
+// changeUser applies change and audits the user before and after, unless
+// nothing changed.
+func (s *Service) changeUser(ctx context.Context, id int64, action string, change func(q repository.Queries) error) (repository.User, error) {
+	var after repository.User
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := change(q); err != nil {
+			return err
+		}
+		if after, err = q.GetUser(ctx, id); err != nil {
+			return err
+		}
+		if equalUsers(before, after) {
+			return nil
+		}
+		return audit(ctx, q, action, "user", userTarget(id), before, after)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return after, ErrUserNotFound
+	}
+	return after, err
+}
+
+func equalUsers(a, b repository.User) bool {
+	return a.Status == b.Status && a.StatusReason == b.StatusReason &&
+		(a.StatusUntil == nil) == (b.StatusUntil == nil) &&
+		(a.StatusUntil == nil || a.StatusUntil.Equal(*b.StatusUntil)) &&
+		(a.ReferrerID == nil) == (b.ReferrerID == nil) &&
+		(a.ReferrerID == nil || *a.ReferrerID == *b.ReferrerID)
+}
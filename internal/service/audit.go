@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermAuditRead allows reading the audit log.
+const PermAuditRead = "audit:read"
+
+// Audit actions.
+const (
+	AuditTaskCompleted = "task.completed"
+	AuditReferrerSet   = "referral.set"
+	AuditReferralBonus = "referral.bonus"
+	AuditTransfer      = "points.transfer"
+	AuditTaskCreated   = "task.created"
+	AuditTaskUpdated   = "task.updated"
+	AuditTaskArchived  = "task.archived"
+	AuditRoleAssigned  = "role.assigned"
+	AuditRoleRevoked   = "role.revoked"
+)
+
+// Actor is who a request acts as, recorded on audit events. The HTTP layer
+// attaches it to the request context with WithActor.
+type Actor struct {
+	UserID    int64
+	IP        string
+	RequestID string
+}
+
+type ctxKeyActor struct{}
+
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, ctxKeyActor{}, a)
+}
+
+// audit appends an event to the log in q's transaction, so it is recorded
+// exactly when the change commits. before and after are marshalled to JSON;
+// nil is stored as null.
+func audit(ctx context.Context, q repository.AuditStore, action, targetType, targetID string, before, after any) error {
+	e := repository.AuditEvent{Action: action, TargetType: targetType, TargetID: targetID}
+	if a, ok := ctx.Value(ctxKeyActor{}).(Actor); ok {
+		if a.UserID != 0 {
+			e.ActorID = &a.UserID
+		}
+		e.IP, e.RequestID = a.IP, a.RequestID
+	}
+	var err error
+	if before != nil {
+		if e.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if e.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	return q.AddAuditEvent(ctx, e)
+}
+
+func userTarget(id int64) string { return strconv.FormatInt(id, 10) }
+
+// accrue changes userID's balance by amount and records the change: in the
+// audit log as action, with details added to the after snapshot, and as a
+// points.adjusted webhook event. Credits can level the user up.
+func (s *Service) accrue(ctx context.Context, q repository.Queries, action string, userID, amount int64, reason string, details map[string]any) error {
+	if err := q.Accrue(ctx, userID, amount, reason); errors.Is(err, repository.ErrNegativeBalance) {
+		return ErrInsufficientPoints
+	} else if err != nil {
+		return err
+	}
+	u, err := q.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	after := map[string]any{"points": u.Points}
+	for k, v := range details {
+		after[k] = v
+	}
+	if err := audit(ctx, q, action, "user", userTarget(userID), map[string]any{"points": u.Points - amount}, after); err != nil {
+		return err
+	}
+	if err := pointsChanged(ctx, q, userID, amount, u.Points, reason); err != nil || amount <= 0 {
+		return err
+	}
+	return s.levelUp(ctx, q, userID, u.Points)
+}
+
+func (s *Service) AuditEvents(ctx context.Context, f repository.AuditFilter) ([]repository.AuditEvent, error) {
+	if f.Since != nil && f.Until != nil && !f.Until.After(*f.Since) {
+		return nil, invalid("until must be after since")
+	}
+	return s.store.ListAuditEvents(ctx, f)
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+// dummyHash is compared against when a login names an unknown user, so the
+// response time doesn't reveal which usernames exist.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+type TokenPair struct {
+	Token        string
+	RefreshToken string
+	ExpiresIn    int64
+}
+
+// KeySource resolves an identity provider's public signing key by kid.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (any, error)
+}
+
+// ParseAccessToken validates a bearer token signed with one of the accepted
+// algorithms and returns its claims. HS256 tokens are the ones /auth issues;
+// RS256/384/512 tokens come from an external identity provider, are verified
+// against its JWKS and must carry the configured issuer and audience.
+// Revoked tokens fail with ErrTokenRevoked.
+//
+// A provider token's claims are made this server's: sub becomes the id of
+// the user its subject is linked to, and role is dropped unless JWTRoleMap
+// maps it to a local role.
+func (s *Service) ParseAccessToken(tokenStr string) (jwt.MapClaims, error) {
+	_, claims, err := s.parseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if s.tokenRevoked(claims) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// parseToken is ParseAccessToken without the deny-list.
+func (s *Service) parseToken(tokenStr string) (*jwt.Token, jwt.MapClaims, error) {
+	algs := s.cfg.JWTAlgorithms
+	if len(algs) == 0 {
+		algs = []string{"HS256"}
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, s.verificationKey, jwt.WithValidMethods(algs))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !token.Valid {
+		return nil, nil, errors.New("invalid token")
+	}
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+		if err := s.checkProviderClaims(claims); err != nil {
+			return nil, nil, err
+		}
+		if err := s.localProviderClaims(claims); err != nil {
+			return nil, nil, err
+		}
+	}
+	return token, claims, nil
+}
+
+func (s *Service) verificationKey(t *jwt.Token) (any, error) {
+	switch t.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			secret := s.unkeyedSecret()
+			if secret == nil {
+				return nil, errors.New("token has no kid")
+			}
+			return secret, nil
+		}
+		if key, ok := s.cfg.JWTKeys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	case *jwt.SigningMethodRSA:
+		if s.cfg.JWKS == nil {
+			return nil, errors.New("no JWKS configured")
+		}
+		kid, _ := t.Header["kid"].(string)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return s.cfg.JWKS.Key(ctx, kid)
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
+	}
+}
+
+func (s *Service) checkProviderClaims(claims jwt.MapClaims) error {
+	if s.cfg.JWTIssuer != "" {
+		if iss, _ := claims.GetIssuer(); iss != s.cfg.JWTIssuer {
+			return errors.New("unexpected issuer")
+		}
+	}
+	if s.cfg.JWTAudience != "" {
+		aud, _ := claims.GetAudience()
+		if !slices.Contains(aud, s.cfg.JWTAudience) {
+			return errors.New("unexpected audience")
+		}
+	}
+	return nil
+}
+
+// defaultTokenProvider is where provider tokens' subjects are linked
+// when JWTProvider isn't set.
+const defaultTokenProvider = "idp"
+
+func (s *Service) tokenProvider() string {
+	if s.cfg.JWTProvider == "" {
+		return defaultTokenProvider
+	}
+	return s.cfg.JWTProvider
+}
+
+// IsTokenProvider reports whether provider names the identity provider
+// whose tokens are accepted, whose accounts are linked like partners'.
+func (s *Service) IsTokenProvider(provider string) bool {
+	return s.cfg.JWKS != nil && provider == s.tokenProvider()
+}
+
+// localProviderClaims rewrites a provider token's sub to the local user
+// its subject is linked to, and its role to the mapped local role. A
+// subject no user has linked is refused.
+func (s *Service) localProviderClaims(claims jwt.MapClaims) error {
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return errors.New("token has no subject")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id, err := s.store.GetIdentity(ctx, s.tokenProvider(), sub)
+	if errors.Is(err, repository.ErrNotFound) {
+		return errors.New("token subject isn't linked to a user")
+	}
+	if err != nil {
+		return err
+	}
+	claims["sub"] = strconv.FormatInt(id.UserID, 10)
+	role, _ := claims["role"].(string)
+	delete(claims, "role")
+	if local := s.cfg.JWTRoleMap[role]; role != "" && local != "" {
+		claims["role"] = local
+	}
+	return nil
+}
+
+func (s *Service) issueAccessToken(userID int64) (string, error) {
+	return s.signAccessToken(userID, s.now().Add(s.cfg.AccessTokenTTL), nil)
+}
+
+// forwardTokenTTL bounds the tokens ForwardToken issues without an expiry:
+// they only have to outlive the forwarded request.
+const forwardTokenTTL = time.Minute
+
+// ForwardToken issues the access token a request forwarded to another region
+// carries there. userID is the user's id in that region (see UserIDIn), and
+// the token expires at exp, or shortly when exp is zero. It is marked as
+// forwarded from this region.
+func (s *Service) ForwardToken(userID int64, exp time.Time) (string, error) {
+	if exp.IsZero() {
+		exp = s.now().Add(forwardTokenTTL)
+	}
+	return s.signAccessToken(userID, exp, jwt.MapClaims{"fwd": s.cfg.Region})
+}
+
+// ParseForwardToken returns the subject of a token ForwardToken issued in
+// another region.
+func (s *Service) ParseForwardToken(tokenStr string) (int64, error) {
+	claims, err := s.ParseAccessToken(tokenStr)
+	if err != nil {
+		return 0, err
+	}
+	if fwd, _ := claims["fwd"].(string); fwd == "" {
+		return 0, errors.New("not a forwarded token")
+	}
+	sub, _ := claims.GetSubject()
+	return strconv.ParseInt(sub, 10, 64)
+}
+
+// signAccessToken signs a token for userID expiring at exp, with extra
+// claims added.
+func (s *Service) signAccessToken(userID int64, exp time.Time, extra jwt.MapClaims) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"sub": strconv.FormatInt(userID, 10),
+		"iat": s.now().Unix(),
+		"exp": exp.Unix(),
+		// jti names the token on the deny-list
+		"jti": hex.EncodeToString(jti),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	kid, key := s.signingKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(key)
+}
+
+// signingKey is the secret new tokens are signed with and its kid, empty
+// for JWTSecret.
+func (s *Service) signingKey() (kid string, key []byte) {
+	if s.cfg.JWTKeyID != "" {
+		return s.cfg.JWTKeyID, s.cfg.JWTKeys[s.cfg.JWTKeyID]
+	}
+	return "", s.cfg.JWTSecret
+}
+
+// unkeyedSecret verifies tokens without a kid: JWTSecret until JWTKeyID is
+// set, and after that only while JWTAcceptUnkeyed is. It is nil when none
+// are accepted.
+func (s *Service) unkeyedSecret() []byte {
+	if len(s.cfg.JWTSecret) == 0 || s.cfg.JWTKeyID != "" && !s.cfg.JWTAcceptUnkeyed {
+		return nil
+	}
+	return s.cfg.JWTSecret
+}
+
+// verificationKeys are all the secrets tokens are accepted with.
+func (s *Service) verificationKeys() [][]byte {
+	keys := make([][]byte, 0, len(s.cfg.JWTKeys)+1)
+	if secret := s.unkeyedSecret(); secret != nil {
+		keys = append(keys, secret)
+	}
+	for _, k := range s.cfg.JWTKeys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func hashRefreshToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens mints an access token and a refresh token in familyID, or in a
+// new family when familyID is empty. It returns the refresh token's row id.
+func (s *Service) issueTokens(ctx context.Context, q repository.TokenStore, userID int64, familyID string) (TokenPair, int64, error) {
+	access, err := s.issueAccessToken(userID)
+	if err != nil {
+		return TokenPair{}, 0, err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return TokenPair{}, 0, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(buf)
+
+	id, err := q.CreateRefreshToken(ctx, userID, familyID, hashRefreshToken(refresh), s.cfg.RefreshTokenTTL)
+	if err != nil {
+		return TokenPair{}, 0, err
+	}
+	return TokenPair{Token: access, RefreshToken: refresh, ExpiresIn: int64(s.cfg.AccessTokenTTL.Seconds())}, id, nil
+}
+
+func (s *Service) Register(ctx context.Context, username, password string) (repository.User, TokenPair, error) {
+	if password == "" {
+		return repository.User{}, TokenPair{}, invalid("password must be 8-72 bytes")
+	}
+	u, err := s.createUser(ctx, username, password)
+	if err != nil {
+		return u, TokenPair{}, err
+	}
+	pair, _, err := s.issueTokens(ctx, s.store, u.ID, "")
+	return u, pair, err
+}
+
+// createUser creates a user in this region. With no password they can't
+// log in.
+func (s *Service) createUser(ctx context.Context, username, password string) (repository.User, error) {
+	if !usernameRe.MatchString(username) {
+		return repository.User{}, invalid("username must be 3-32 letters, digits, '_', '.' or '-'")
+	}
+	var hash []byte
+	if password != "" {
+		// bcrypt ignores anything past 72 bytes
+		if len(password) < 8 || len(password) > 72 {
+			return repository.User{}, invalid("password must be 8-72 bytes")
+		}
+		var err error
+		if hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err != nil {
+			return repository.User{}, err
+		}
+	}
+	var u repository.User
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		u, err = q.CreateUser(ctx, username, string(hash), s.cfg.Region)
+		if err != nil {
+			return err
+		}
+		return emit(ctx, q, EventUserCreated, map[string]any{
+			"user_id": u.ID, "username": u.Username, "region": s.cfg.Region,
+		})
+	})
+	if errors.Is(err, repository.ErrConflict) {
+		return u, ErrUsernameTaken
+	}
+	return u, err
+}
+
+func (s *Service) Login(ctx context.Context, username, password string) (int64, TokenPair, error) {
+	id, hash, err := s.store.GetPasswordHash(ctx, username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return 0, TokenPair{}, err
+	}
+	if err != nil || hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return 0, TokenPair{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return 0, TokenPair{}, ErrInvalidCredentials
+	}
+	u, err := s.getUser(ctx, id)
+	if err != nil {
+		return 0, TokenPair{}, err
+	}
+	if u.Status == repository.UserBanned {
+		return 0, TokenPair{}, statusError(u)
+	}
+
+	pair, _, err := s.issueTokens(ctx, s.store, id, "")
+	return id, pair, err
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token works
+// once; replaying a rotated token revokes its whole family, since it means
+// the token leaked.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	var pair TokenPair
+	reused := false
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		t, err := q.GetRefreshToken(ctx, hashRefreshToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if t.RevokedAt != nil {
+			// commit the revocation, then report the token as invalid
+			reused = true
+			return q.RevokeRefreshFamily(ctx, t.FamilyID)
+		}
+		if s.now().After(t.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		var newID int64
+		pair, newID, err = s.issueTokens(ctx, q, t.UserID, t.FamilyID)
+		if err != nil {
+			return err
+		}
+		return q.RotateRefreshToken(ctx, t.ID, newID)
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if reused {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	return pair, nil
+}
+
+// Logout revokes every refresh token of the session the given token belongs
+// to. Unknown tokens are ignored so logout is idempotent.
+func (s *Service) Logout(ctx context.Context, refreshToken string) error {
+	return s.store.RevokeRefreshFamilyOf(ctx, hashRefreshToken(refreshToken))
+}
+
+// PurgeRefreshTokens drops expired refresh tokens, which can't be
+// exchanged anymore, revoked access tokens that have expired since and
+// expired password reset tokens. It is a scheduled job.
+func (s *Service) PurgeRefreshTokens(ctx context.Context) error {
+	n, err := s.store.PurgeRefreshTokens(ctx, s.now())
+	if n > 0 {
+		log.Printf("purged %d expired refresh tokens", n)
+	}
+	if err != nil {
+		return err
+	}
+	n, err = s.store.PurgeRevokedTokens(ctx, s.now())
+	if n > 0 {
+		log.Printf("purged %d expired revoked access tokens", n)
+	}
+	if err != nil {
+		return err
+	}
+	n, err = s.store.PurgePasswordResets(ctx, s.now())
+	if n > 0 {
+		log.Printf("purged %d expired password reset tokens", n)
+	}
+	return err
+}
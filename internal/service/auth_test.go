@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+func signHS256(t *testing.T, kid string, key []byte) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Once tokens are signed with a kid, those without one only verify with
+// the old secret while JWTAcceptUnkeyed is set.
+func TestParseAccessTokenUnkeyed(t *testing.T) {
+	old, key := []byte("old-secret"), []byte("new-secret")
+	for _, c := range []struct {
+		name  string
+		cfg   Config
+		token string
+		ok    bool
+	}{
+		{"secret only", Config{JWTSecret: old}, signHS256(t, "", old), true},
+		{"keyed", Config{JWTSecret: old, JWTKeys: map[string][]byte{"k1": key}, JWTKeyID: "k1"}, signHS256(t, "k1", key), true},
+		{"unkeyed after rotation", Config{JWTSecret: old, JWTKeys: map[string][]byte{"k1": key}, JWTKeyID: "k1"}, signHS256(t, "", old), false},
+		{"unkeyed while rotating", Config{JWTSecret: old, JWTKeys: map[string][]byte{"k1": key}, JWTKeyID: "k1", JWTAcceptUnkeyed: true}, signHS256(t, "", old), true},
+		{"wrong secret", Config{JWTSecret: old}, signHS256(t, "", []byte("dev-secret")), false},
+	} {
+		s := New(repository.NewMemory("local"), c.cfg)
+		if _, err := s.ParseAccessToken(c.token); (err == nil) != c.ok {
+			t.Errorf("%s: err = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
+
+// staticKey is a KeySource with one key for every kid.
+type staticKey struct{ key *rsa.PublicKey }
+
+func (k staticKey) Key(ctx context.Context, kid string) (any, error) { return k.key, nil }
+
+// A provider token acts as the user its sub is linked to, never as the
+// user whose id the sub happens to be, and its role only counts mapped.
+func TestParseAccessTokenFromProvider(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := repository.NewMemory("local")
+	alice, bob := mustCreateUser(t, store, "alice"), mustCreateUser(t, store, "bob")
+	s := New(store, Config{
+		JWTAlgorithms: []string{"RS256"},
+		JWKS:          staticKey{&key.PublicKey},
+		JWTRoleMap:    map[string]string{"idp-admins": "admin"},
+	})
+	if _, err := s.LinkIdentity(ctx, bob.ID, "idp", "auth0|bob", nil); err != nil {
+		t.Fatal(err)
+	}
+	sign := func(sub, role string) string {
+		claims := jwt.MapClaims{"sub": sub, "exp": time.Now().Add(time.Hour).Unix()}
+		if role != "" {
+			claims["role"] = role
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	bobSub := strconv.FormatInt(bob.ID, 10)
+	for _, c := range []struct {
+		name     string
+		token    string
+		wantSub  string
+		wantRole any
+	}{
+		{"linked", sign("auth0|bob", ""), bobSub, nil},
+		{"mapped role", sign("auth0|bob", "idp-admins"), bobSub, "admin"},
+		{"unmapped role", sign("auth0|bob", "admin"), bobSub, nil},
+		{"local id", sign(strconv.FormatInt(alice.ID, 10), "admin"), "", nil},
+	} {
+		claims, err := s.ParseAccessToken(c.token)
+		if c.wantSub == "" {
+			if err == nil {
+				t.Errorf("%s: took a token for alice's id %d", c.name, alice.ID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if sub, _ := claims.GetSubject(); sub != c.wantSub || claims["role"] != c.wantRole {
+			t.Errorf("%s: sub %q, role %v; want %q, %v", c.name, sub, claims["role"], c.wantSub, c.wantRole)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermRulesManage allows defining, changing and deleting award rules
+// through /admin/award-rules.
+const PermRulesManage = "rules:manage"
+
+var ErrAwardRuleNotFound = newError("AWARD_RULE_NOT_FOUND", "award rule not found")
+
+const (
+	AuditAwardRuleCreated = "award_rule.created"
+	AuditAwardRuleUpdated = "award_rule.updated"
+	AuditAwardRuleDeleted = "award_rule.deleted"
+)
+
+// Kinds of Modifier, in the order they apply.
+const (
+	ModifierStreak   = "streak"
+	ModifierRule     = "rule"
+	ModifierCampaign = "campaign"
+)
+
+// Modifier is one step from a task's points to what a completion is
+// awarded: the points so far are multiplied by Multiplier, rounded down,
+// and Bonus is added, leaving Points. ID and Name identify the rule or
+// campaign.
+type Modifier struct {
+	Kind       string  `json:"kind"`
+	ID         int64   `json:"id,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	Multiplier float64 `json:"multiplier"`
+	Bonus      int64   `json:"bonus"`
+	Points     int64   `json:"points"`
+}
+
+// Explain is how a completion's award was reached from the task's Base
+// points, one modifier at a time.
+type Explain struct {
+	Base      int64      `json:"base"`
+	Modifiers []Modifier `json:"modifiers"`
+}
+
+// points is the award so far.
+func (e *Explain) points() int64 {
+	if n := len(e.Modifiers); n > 0 {
+		return e.Modifiers[n-1].Points
+	}
+	return e.Base
+}
+
+// apply adds m as the next step and returns the points it added.
+func (e *Explain) apply(m Modifier) int64 {
+	prev := e.points()
+	m.Points = applyMultiplier(prev, m.Multiplier) + m.Bonus
+	e.Modifiers = append(e.Modifiers, m)
+	return m.Points - prev
+}
+
+// User segments an award rule can be limited to; a segment can also be
+// "role:" followed by a role name.
+const (
+	SegmentNew      = "new"
+	SegmentReferred = "referred"
+	segmentRole     = "role:"
+)
+
+// newUserAge is how long after signing up a user is in SegmentNew.
+const newUserAge = 7 * 24 * time.Hour
+
+// HourRange is [From, To) in hours of the day, UTC. It wraps past midnight
+// when From is after To.
+type HourRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (h HourRange) contains(hour int) bool {
+	if h.From < h.To {
+		return hour >= h.From && hour < h.To
+	}
+	return hour >= h.From || hour < h.To
+}
+
+// AwardConditions select the completions an award rule applies to; empty
+// fields match every completion.
+type AwardConditions struct {
+	Segment    string     `json:"segment,omitempty"`
+	Categories []string   `json:"categories,omitempty"`
+	Hours      *HourRange `json:"hours,omitempty"`
+	// MinStreak is the streak, counting the completion's day, the user
+	// must have reached.
+	MinStreak int `json:"min_streak,omitempty"`
+}
+
+// AwardRuleInput is an award rule as admins define it. Enabled defaults to
+// true and Multiplier to 1.
+type AwardRuleInput struct {
+	Name        string          `json:"name"`
+	Position    int             `json:"position"`
+	Enabled     *bool           `json:"enabled,omitempty"`
+	Conditions  AwardConditions `json:"conditions"`
+	Multiplier  *float64        `json:"multiplier,omitempty"`
+	BonusPoints int64           `json:"bonus_points"`
+}
+
+func (in *AwardRuleInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || utf8.RuneCountInString(in.Name) > 64 {
+		return invalid("name is required, at most 64 characters")
+	}
+	if in.Enabled == nil {
+		enabled := true
+		in.Enabled = &enabled
+	}
+	if in.Multiplier == nil {
+		one := 1.0
+		in.Multiplier = &one
+	}
+	if m := *in.Multiplier; !(m > 0 && m <= 10) {
+		return invalid("multiplier must be above 0 and at most 10")
+	}
+	if in.BonusPoints < 0 {
+		return invalid("bonus_points must be >= 0")
+	}
+	if *in.Multiplier == 1 && in.BonusPoints == 0 {
+		return invalid("a rule needs a multiplier other than 1 or bonus_points")
+	}
+	c := &in.Conditions
+	if h := c.Hours; h != nil && (h.From < 0 || h.From > 23 || h.To < 0 || h.To > 23 || h.From == h.To) {
+		return invalid("conditions.hours from and to must be different hours, 0-23")
+	}
+	if c.MinStreak < 0 {
+		return invalid("conditions.min_streak must be >= 0")
+	}
+	slices.Sort(c.Categories)
+	c.Categories = slices.Compact(c.Categories)
+	return nil
+}
+
+// checkAwardConditions rejects segments, roles and categories that don't
+// exist.
+func checkAwardConditions(ctx context.Context, q repository.Queries, c AwardConditions) error {
+	switch {
+	case c.Segment == "", c.Segment == SegmentNew, c.Segment == SegmentReferred:
+	case strings.HasPrefix(c.Segment, segmentRole):
+		roles, err := q.ListRoles(ctx)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(c.Segment, segmentRole)
+		if !slices.ContainsFunc(roles, func(r repository.Role) bool { return r.Name == name }) {
+			return invalid("conditions.segment names an unknown role")
+		}
+	default:
+		return invalid(`conditions.segment must be "new", "referred" or "role:<name>"`)
+	}
+	for _, code := range c.Categories {
+		if _, err := q.GetCategory(ctx, code); errors.Is(err, repository.ErrNotFound) {
+			return invalid("conditions.categories names an unknown category")
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in AwardRuleInput) rule(id int64) (repository.AwardRule, error) {
+	conditions, err := json.Marshal(in.Conditions)
+	return repository.AwardRule{
+		ID: id, Name: in.Name, Position: in.Position, Enabled: *in.Enabled, Conditions: conditions,
+		Multiplier: *in.Multiplier, BonusPoints: in.BonusPoints,
+	}, err
+}
+
+func (s *Service) AwardRules(ctx context.Context) ([]repository.AwardRule, error) {
+	return s.store.ListAwardRules(ctx, false)
+}
+
+func (s *Service) AwardRule(ctx context.Context, id int64) (repository.AwardRule, error) {
+	r, err := s.store.GetAwardRule(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return r, ErrAwardRuleNotFound
+	}
+	return r, err
+}
+
+func (s *Service) CreateAwardRule(ctx context.Context, in AwardRuleInput) (repository.AwardRule, error) {
+	if err := in.validate(); err != nil {
+		return repository.AwardRule{}, err
+	}
+	r, err := in.rule(0)
+	if err != nil {
+		return r, err
+	}
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		if err := checkAwardConditions(ctx, q, in.Conditions); err != nil {
+			return err
+		}
+		var err error
+		if r, err = q.CreateAwardRule(ctx, r); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditAwardRuleCreated, "award_rule", userTarget(r.ID), nil, r)
+	})
+	return r, err
+}
+
+// UpdateAwardRule replaces a rule. Unlike campaigns, rules can change at
+// any time; completions already awarded keep what they got.
+func (s *Service) UpdateAwardRule(ctx context.Context, id int64, in AwardRuleInput) (repository.AwardRule, error) {
+	if err := in.validate(); err != nil {
+		return repository.AwardRule{}, err
+	}
+	r, err := in.rule(id)
+	if err != nil {
+		return r, err
+	}
+	var after repository.AwardRule
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetAwardRule(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrAwardRuleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkAwardConditions(ctx, q, in.Conditions); err != nil {
+			return err
+		}
+		if err := q.UpdateAwardRule(ctx, r); err != nil {
+			return err
+		}
+		if after, err = q.GetAwardRule(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditAwardRuleUpdated, "award_rule", userTarget(id), before, after)
+	})
+	return after, err
+}
+
+func (s *Service) DeleteAwardRule(ctx context.Context, id int64) error {
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetAwardRule(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrAwardRuleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteAwardRule(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditAwardRuleDeleted, "award_rule", userTarget(id), before, nil)
+	})
+}
+
+// ruleSubject is the completion award rules are matched against. The user
+// and their roles are loaded the first time a rule needs them.
+type ruleSubject struct {
+	userID int64
+	task   repository.Task
+	streak int
+	at     time.Time
+	user   *repository.User
+	roles  []string
+}
+
+func (sub *ruleSubject) loadUser(ctx context.Context, q repository.Queries) (*repository.User, error) {
+	if sub.user == nil {
+		u, err := q.GetUser(ctx, sub.userID)
+		if err != nil {
+			return nil, err
+		}
+		sub.user = &u
+	}
+	return sub.user, nil
+}
+
+func (sub *ruleSubject) inSegment(ctx context.Context, q repository.Queries, segment string) (bool, error) {
+	switch {
+	case segment == "":
+		return true, nil
+	case segment == SegmentNew:
+		u, err := sub.loadUser(ctx, q)
+		if err != nil {
+			return false, err
+		}
+		return sub.at.Sub(u.CreatedAt) < newUserAge, nil
+	case segment == SegmentReferred:
+		u, err := sub.loadUser(ctx, q)
+		if err != nil {
+			return false, err
+		}
+		return u.ReferrerID != nil, nil
+	case strings.HasPrefix(segment, segmentRole):
+		if sub.roles == nil {
+			roles, err := q.UserRoles(ctx, sub.userID)
+			if err != nil {
+				return false, err
+			}
+			sub.roles = append([]string{}, roles...)
+		}
+		return slices.Contains(sub.roles, strings.TrimPrefix(segment, segmentRole)), nil
+	}
+	return false, nil
+}
+
+func (sub *ruleSubject) matches(ctx context.Context, q repository.Queries, c AwardConditions) (bool, error) {
+	if len(c.Categories) > 0 && !slices.Contains(c.Categories, sub.task.Category) {
+		return false, nil
+	}
+	if c.Hours != nil && !c.Hours.contains(sub.at.UTC().Hour()) {
+		return false, nil
+	}
+	if sub.streak < c.MinStreak {
+		return false, nil
+	}
+	return sub.inSegment(ctx, q, c.Segment)
+}
+
+// applyAwardRules applies the enabled rules that match the completion to
+// ex, in order. A rule whose conditions no longer parse is skipped.
+func (s *Service) applyAwardRules(ctx context.Context, q repository.Queries, sub *ruleSubject, ex *Explain) error {
+	rules, err := q.ListAwardRules(ctx, true)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		var c AwardConditions
+		if err := json.Unmarshal(r.Conditions, &c); err != nil {
+			log.Printf("award rule %d: bad conditions: %v", r.ID, err)
+			continue
+		}
+		ok, err := sub.matches(ctx, q, c)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ex.apply(Modifier{Kind: ModifierRule, ID: r.ID, Name: r.Name, Multiplier: r.Multiplier, Bonus: r.BonusPoints})
+		}
+	}
+	return nil
+}
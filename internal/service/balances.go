@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermPointsManage allows listing and fixing balances that drifted from
+// the ledger through /admin/points, and adjusting balances by hand.
+const PermPointsManage = "points:manage"
+
+var ErrNegativeBalance = newError("NEGATIVE_BALANCE", "balance would go below zero")
+
+const (
+	AuditPointsReconciled = "points.reconciled"
+	AuditPointsAdjusted   = "points.adjusted"
+)
+
+// PointsAdjustment is a change an admin made to a balance, and the balance
+// after it.
+type PointsAdjustment struct {
+	UserID int64  `json:"user_id"`
+	Delta  int64  `json:"delta"`
+	Points int64  `json:"points"`
+	Reason string `json:"reason"`
+	// Version is the user's after the adjustment.
+	Version int64 `json:"version"`
+}
+
+// AdjustPoints credits or, with a negative delta, debits the user's balance
+// through the ledger, for corrections and goodwill grants. reason is
+// required and kept in the audit log; the ledger records
+// "admin_adjustment". A non-nil version is the user's version the
+// adjustment was decided on: if the user has changed since, it is
+// ErrVersionConflict, so two admins correcting the same balance don't
+// both apply.
+func (s *Service) AdjustPoints(ctx context.Context, userID, delta int64, reason string, version *int64) (PointsAdjustment, error) {
+	reason = strings.TrimSpace(reason)
+	if delta == 0 || delta > 1_000_000_000 || delta < -1_000_000_000 {
+		return PointsAdjustment{}, invalid("delta must be non-zero, at most 1000000000 either way")
+	}
+	if reason == "" || utf8.RuneCountInString(reason) > 500 {
+		return PointsAdjustment{}, invalid("reason is required, at most 500 characters")
+	}
+	adj := PointsAdjustment{UserID: userID, Delta: delta, Reason: reason}
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		u, err := q.GetUser(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+		if version != nil {
+			if err := q.CheckUserVersion(ctx, userID, *version); errors.Is(err, repository.ErrVersionConflict) {
+				return ErrVersionConflict
+			} else if err != nil {
+				return err
+			}
+		}
+		if err := s.accrue(ctx, q, AuditPointsAdjusted, userID, delta, "admin_adjustment", map[string]any{
+			"delta": delta, "reason": reason,
+		}); err != nil {
+			return err
+		}
+		if u, err = q.GetUser(ctx, userID); err != nil {
+			return err
+		}
+		adj.Points, adj.Version = u.Points, u.Version
+		return emit(ctx, q, EventPointsAdjusted, map[string]any{
+			"user_id": userID, "delta": delta, "balance": u.Points, "reason": reason,
+		})
+	})
+	if err != nil {
+		return PointsAdjustment{}, err
+	}
+	s.RefreshCachedPoints(ctx, userID)
+	return adj, nil
+}
+
+// BalanceFix is a balance before and after FixBalance.
+type BalanceFix struct {
+	UserID       int64 `json:"user_id"`
+	PointsBefore int64 `json:"points_before"`
+	Points       int64 `json:"points"`
+}
+
+// ReconcilePoints records every user whose balance differs from the sum of
+// their ledger, replacing what the previous run found. It is a scheduled
+// job.
+func (s *Service) ReconcilePoints(ctx context.Context) error {
+	var n int64
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		n, err = q.RecordDiscrepancies(ctx, s.now())
+		return err
+	})
+	if n > 0 {
+		log.Printf("reconcile points: %d balances differ from the ledger", n)
+	}
+	return err
+}
+
+// Discrepancies pages through what ReconcilePoints last found, by user id.
+func (s *Service) Discrepancies(ctx context.Context, afterUserID int64, limit int) ([]repository.Discrepancy, error) {
+	return s.store.ListDiscrepancies(ctx, afterUserID, limit)
+}
+
+// FixBalance replays the user's points stream into their balance: the
+// stream is the record of every change to it, and the balance only a
+// running total. It drops their discrepancy too, and is a no-op for a
+// balance that has caught up since it was found.
+func (s *Service) FixBalance(ctx context.Context, userID int64) (BalanceFix, error) {
+	var fix BalanceFix
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, after, err := q.ReplayPoints(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		fix = BalanceFix{UserID: userID, PointsBefore: before, Points: after}
+		if err := q.DeleteDiscrepancy(ctx, userID); err != nil {
+			return err
+		}
+		if before == after {
+			return nil
+		}
+		if err := pointsChanged(ctx, q, userID, after-before, after, "reconciled"); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditPointsReconciled, "user", userTarget(userID),
+			map[string]any{"points": before}, map[string]any{"points": after})
+	})
+	if err != nil {
+		return BalanceFix{}, err
+	}
+	s.RefreshCachedPoints(ctx, userID)
+	return fix, nil
+}
+
+// PointsReplay counts the balances ReplayPoints rebuilt, and those that
+// changed.
+type PointsReplay struct {
+	Users   int64 `json:"users"`
+	Changed int64 `json:"changed"`
+}
+
+// ReplayPoints rebuilds every user's balance from their points stream, a
+// user per transaction, as FixBalance does for one.
+func (s *Service) ReplayPoints(ctx context.Context) (PointsReplay, error) {
+	var out PointsReplay
+	f := repository.UserFilter{Limit: 500}
+	for {
+		users, err := s.store.SearchUsers(ctx, f)
+		if err != nil {
+			return out, err
+		}
+		for _, u := range users {
+			fix, err := s.FixBalance(ctx, u.ID)
+			if errors.Is(err, ErrUserNotFound) {
+				// deleted since the page was read
+				continue
+			}
+			if err != nil {
+				return out, fmt.Errorf("user %d: %w", u.ID, err)
+			}
+			out.Users++
+			if fix.Points != fix.PointsBefore {
+				out.Changed++
+			}
+		}
+		if len(users) < f.Limit {
+			return out, nil
+		}
+		f.Before = users[len(users)-1].ID
+	}
+}
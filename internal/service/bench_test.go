@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// The benchmarks measure the service calls behind the busiest endpoints,
+// in-process and with no HTTP in between, against each of the memory store
+// and a temporary SQLite file seeded with -bench-users users:
+//
+//	go test -run '^$' -bench . -count 6 ./internal/service > old.txt
+//	go test -run '^$' -bench . -count 6 ./internal/service > new.txt
+//	benchstat old.txt new.txt
+var benchUsers = flag.Int("bench-users", 1000, "users the benchmarks seed")
+
+var benchSecret = []byte("bench-secret")
+
+// benchEnv is a service over a freshly seeded store.
+type benchEnv struct {
+	svc *Service
+	ids []int64
+	// i is shared, so every iteration of every run picks the next user
+	i atomic.Int64
+}
+
+func (e *benchEnv) next() int64 { return e.ids[int(e.i.Add(1))%len(e.ids)] }
+
+// benchStores runs fn as a sub-benchmark per store. Seeding happens before
+// and isn't timed.
+func benchStores(b *testing.B, fn func(b *testing.B, e *benchEnv)) {
+	for _, driver := range []string{"memory", "sqlite"} {
+		var store repository.Store = repository.NewMemory("local")
+		if driver == "sqlite" {
+			store = newSQLiteStore(b)
+		}
+		e := newBenchEnv(b, store)
+		b.Run(driver, func(b *testing.B) {
+			b.ReportAllocs()
+			fn(b, e)
+		})
+	}
+}
+
+// newBenchEnv creates the benchmark tasks and users, with a spread of
+// balances with ties like a real board, and completes bench_once for each
+// so CompleteTaskAlreadyDone measures the repeat path.
+func newBenchEnv(b *testing.B, store repository.Store) *benchEnv {
+	b.Helper()
+	ctx := context.Background()
+	svc := New(store, Config{
+		JWTSecret:         benchSecret,
+		AccessTokenTTL:    time.Hour,
+		RefreshTokenTTL:   time.Hour,
+		ReceiptSecret:     benchSecret,
+		Region:            "local",
+		TeamMaxMembers:    50,
+		StatusRecentTasks: 10,
+		DefaultLocale:     "en",
+	})
+	unlimited := 1 << 30
+	f := Fixture{Tasks: []TaskInput{
+		{Code: "bench_repeat", Title: "Repeatable", Points: 1, MaxCompletionsPerUser: &unlimited},
+		{Code: "bench_once", Title: "Once", Points: 1},
+	}}
+	for i := 0; i < *benchUsers; i++ {
+		f.Users = append(f.Users, FixtureUser{Username: "bench" + strconv.Itoa(i), Points: int64((i * 7919) % 5000)})
+	}
+	if _, err := svc.Seed(ctx, f); err != nil {
+		b.Fatalf("seed: %v", err)
+	}
+	e := &benchEnv{svc: svc, ids: make([]int64, *benchUsers)}
+	for i := range e.ids {
+		id, _, err := store.GetPasswordHash(ctx, "bench"+strconv.Itoa(i))
+		if err != nil {
+			b.Fatalf("seed: %v", err)
+		}
+		e.ids[i] = id
+		if _, err := svc.CompleteTask(ctx, id, "bench_once", nil); err != nil {
+			b.Fatalf("seed: %v", err)
+		}
+	}
+	return e
+}
+
+func benchComplete(code string) func(b *testing.B, e *benchEnv) {
+	return func(b *testing.B, e *benchEnv) {
+		ctx := context.Background()
+		for n := 0; n < b.N; n++ {
+			if _, err := e.svc.CompleteTask(ctx, e.next(), code, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkCompleteTask(b *testing.B) {
+	benchStores(b, benchComplete("bench_repeat"))
+}
+
+func BenchmarkCompleteTaskAlreadyDone(b *testing.B) {
+	benchStores(b, benchComplete("bench_once"))
+}
+
+func BenchmarkCompleteTaskParallel(b *testing.B) {
+	benchStores(b, func(b *testing.B, e *benchEnv) {
+		ctx := context.Background()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := e.svc.CompleteTask(ctx, e.next(), "bench_repeat", nil); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+func benchLeaderboard(period string) func(b *testing.B, e *benchEnv) {
+	return func(b *testing.B, e *benchEnv) {
+		ctx := context.Background()
+		for n := 0; n < b.N; n++ {
+			if _, err := e.svc.Leaderboard(ctx, period, 50, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkLeaderboard(b *testing.B) {
+	benchStores(b, benchLeaderboard("all"))
+}
+
+func BenchmarkLeaderboardWeekly(b *testing.B) {
+	benchStores(b, benchLeaderboard("weekly"))
+}
+
+func BenchmarkLeaderboardParallel(b *testing.B) {
+	benchStores(b, func(b *testing.B, e *benchEnv) {
+		ctx := context.Background()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := e.svc.Leaderboard(ctx, "all", 50, nil); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkUserRank(b *testing.B) {
+	benchStores(b, func(b *testing.B, e *benchEnv) {
+		ctx := context.Background()
+		for n := 0; n < b.N; n++ {
+			if _, err := e.svc.UserRank(ctx, e.next(), "all"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkUserStatus(b *testing.B) {
+	benchStores(b, func(b *testing.B, e *benchEnv) {
+		ctx := context.Background()
+		for n := 0; n < b.N; n++ {
+			if _, err := e.svc.UserStatus(ctx, e.next()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkParseAccessToken doesn't touch the store.
+func BenchmarkParseAccessToken(b *testing.B) {
+	svc := New(repository.NewMemory("local"), Config{JWTSecret: benchSecret, Region: "local"})
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "1",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}).SignedString(benchSecret)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := svc.ParseAccessToken(token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
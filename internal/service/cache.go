@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+const cacheRebuildBatch = 1000
+
+// LeaderboardCache serves the lifetime leaderboard's first page without
+// touching Postgres. It is optional and never authoritative: write failures
+// are logged and reads fall back to the store.
+type LeaderboardCache interface {
+	// Top returns the first limit entries and the ranked user count; ok is
+	// false while the cache is not populated.
+	Top(ctx context.Context, limit int) (items []repository.LeaderboardEntry, total int64, ok bool, err error)
+	Set(ctx context.Context, entries ...repository.LeaderboardEntry) error
+	Remove(ctx context.Context, userIDs ...int64) error
+	Replace(ctx context.Context, entries []repository.LeaderboardEntry) error
+}
+
+// cachedTop serves a first lifetime page from the cache if it can.
+func (s *Service) cachedTop(ctx context.Context, limit int) (LeaderboardPage, bool) {
+	if s.cfg.Cache == nil {
+		return LeaderboardPage{}, false
+	}
+	items, total, ok, err := s.cfg.Cache.Top(ctx, limit)
+	if err != nil {
+		log.Printf("leaderboard cache read: %v", err)
+		return LeaderboardPage{}, false
+	}
+	if !ok {
+		return LeaderboardPage{}, false
+	}
+	return LeaderboardPage{Items: items, Total: total}, true
+}
+
+// RefreshCachedPoints writes the users' committed points through to the
+// cache. Call it after a transaction that changed them commits.
+func (s *Service) RefreshCachedPoints(ctx context.Context, userIDs ...int64) {
+	if s.cfg.Cache == nil || len(userIDs) == 0 {
+		return
+	}
+	entries := make([]repository.LeaderboardEntry, 0, len(userIDs))
+	var hidden []int64
+	for _, id := range userIDs {
+		u, err := s.store.GetUser(ctx, id)
+		if err != nil {
+			log.Printf("leaderboard cache: load user %d: %v", id, err)
+			continue
+		}
+		st, err := s.store.GetSettings(ctx, id)
+		if err != nil {
+			log.Printf("leaderboard cache: load settings of user %d: %v", id, err)
+			continue
+		}
+		if st.LeaderboardVisibility == repository.VisibilityHidden {
+			hidden = append(hidden, id)
+			continue
+		}
+		entries = append(entries, repository.LeaderboardEntry{ID: u.ID, Username: u.Username, Points: u.Points,
+			Anonymous: st.LeaderboardVisibility == repository.VisibilityAnonymous})
+	}
+	if len(hidden) > 0 {
+		s.dropCachedUsers(ctx, hidden...)
+	}
+	if err := s.cfg.Cache.Set(ctx, entries...); err != nil {
+		log.Printf("leaderboard cache write: %v", err)
+	}
+}
+
+// dropCachedUsers takes users off the cached leaderboard, e.g. once they
+// are deleted.
+func (s *Service) dropCachedUsers(ctx context.Context, userIDs ...int64) {
+	if s.cfg.Cache == nil {
+		return
+	}
+	if err := s.cfg.Cache.Remove(ctx, userIDs...); err != nil {
+		log.Printf("leaderboard cache remove: %v", err)
+	}
+}
+
+// RebuildLeaderboardCache reloads the whole lifetime ranking from Postgres.
+func (s *Service) RebuildLeaderboardCache(ctx context.Context) error {
+	var (
+		all   []repository.LeaderboardEntry
+		after *repository.LeaderboardCursor
+	)
+	for {
+		batch, err := s.store.Leaderboard(ctx, "all", cacheRebuildBatch, after)
+		if err != nil {
+			return err
+		}
+		all = append(all, batch...)
+		if len(batch) < cacheRebuildBatch {
+			break
+		}
+		last := batch[len(batch)-1]
+		after = &repository.LeaderboardCursor{Points: last.Points, ID: last.ID}
+	}
+	return s.cfg.Cache.Replace(ctx, all)
+}
+
+// RunLeaderboardCache rebuilds the cache now and then every interval, which
+// also repairs any write-through that was lost.
+func (s *Service) RunLeaderboardCache(ctx context.Context, interval time.Duration) {
+	if s.cfg.Cache == nil {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := s.RebuildLeaderboardCache(ctx); err != nil {
+			log.Printf("leaderboard cache rebuild: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
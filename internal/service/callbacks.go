@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// maxPartnerReference is how long a partner's reference for a completion
+// can be.
+const maxPartnerReference = 128
+
+var ErrUnknownPartnerUser = newError("UNKNOWN_PARTNER_USER", "no user is linked to that partner account")
+
+// errPartnerReferenceUsed rolls back a completion whose reference the
+// partner already reported.
+var errPartnerReferenceUsed = errors.New("partner reference already recorded")
+
+// ClaimCallbackSignature records the signature of a partner's callback
+// until expiresAt and reports whether it is new; a replayed request's
+// isn't.
+func (s *Service) ClaimCallbackSignature(ctx context.Context, partner, signature string, expiresAt time.Time) (bool, error) {
+	return s.store.ClaimCallbackSignature(ctx, partner, signature, expiresAt, s.now())
+}
+
+// PartnerUser returns the user linked to the partner's account
+// externalID: the external identity whose provider is the partner's name.
+func (s *Service) PartnerUser(ctx context.Context, partner, externalID string) (int64, error) {
+	id, err := s.store.GetIdentity(ctx, partner, externalID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, ErrUnknownPartnerUser
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id.UserID, nil
+}
+
+// CompletePartnerTask completes the task for userID as partner reported
+// it, under its reference. It runs CompleteTask's checks and awards, but
+// the partner's signed report stands in for the task's verifier, and for
+// tasks that require review the report is the submitted proof. The
+// partner and reference are added to the task.completed audit entry and
+// event, and recorded with what was awarded; a reference the partner
+// already reported answers AlreadyCompleted and changes nothing, so the
+// partner can retry.
+func (s *Service) CompletePartnerTask(ctx context.Context, partner, reference string, userID int64, code string) (res Completion, err error) {
+	ctx, span := tracer.Start(ctx, "CompletePartnerTask", trace.WithAttributes(attribute.String("partner", partner),
+		attribute.Int64("user.id", userID), attribute.String("task.code", code)))
+	defer func() { endSpan(span, err) }()
+
+	if reference == "" || len(reference) > maxPartnerReference {
+		return res, invalid("reference must be 1-128 bytes")
+	}
+	provenance := map[string]any{"partner": partner, "reference": reference}
+	proof, err := json.Marshal(provenance)
+	if err != nil {
+		return res, err
+	}
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		res, err = s.completeTask(ctx, q, userID, code, proof, provenance)
+		if err != nil {
+			return err
+		}
+		added, err := q.AddPartnerCompletion(ctx, repository.PartnerCompletion{
+			Partner:   partner,
+			Reference: reference,
+			UserID:    userID,
+			TaskCode:  code,
+			Awarded:   res.Awarded,
+		})
+		if err != nil {
+			return err
+		}
+		if !added {
+			return errPartnerReferenceUsed
+		}
+		return nil
+	})
+	if errors.Is(err, errPartnerReferenceUsed) {
+		return Completion{AlreadyCompleted: true}, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	return s.completed(ctx, userID, code, res), nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermCampaignsManage allows scheduling, changing and deleting campaigns
+// and reading their reports through /admin/campaigns.
+const PermCampaignsManage = "campaigns:manage"
+
+var (
+	ErrCampaignNotFound = newError("CAMPAIGN_NOT_FOUND", "campaign not found")
+	ErrCampaignLocked   = newError("CAMPAIGN_LOCKED", "campaign has already started or ended")
+)
+
+const (
+	AuditCampaignCreated = "campaign.created"
+	AuditCampaignUpdated = "campaign.updated"
+	AuditCampaignDeleted = "campaign.deleted"
+)
+
+// maxCampaignMultiplier bounds a single campaign's multiplier; campaigns
+// stack, so a few of them can still go well past it.
+const maxCampaignMultiplier = 10
+
+// CampaignInput is a campaign as admins schedule it. StartsAt defaults to
+// now and Multiplier to 1. Tasks and Category narrow the tasks it covers;
+// with neither it covers every task.
+type CampaignInput struct {
+	Name        string     `json:"name"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"`
+	EndsAt      time.Time  `json:"ends_at"`
+	Multiplier  *float64   `json:"multiplier,omitempty"`
+	BonusPoints int64      `json:"bonus_points"`
+	Category    string     `json:"category,omitempty"`
+	Tasks       []string   `json:"tasks,omitempty"`
+}
+
+func (in *CampaignInput) validate(now time.Time) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || utf8.RuneCountInString(in.Name) > 64 {
+		return invalid("name is required, at most 64 characters")
+	}
+	if in.StartsAt == nil {
+		in.StartsAt = &now
+	}
+	if !in.EndsAt.After(*in.StartsAt) {
+		return invalid("ends_at must be after starts_at")
+	}
+	if !in.EndsAt.After(now) {
+		return invalid("ends_at must be in the future")
+	}
+	if in.Multiplier == nil {
+		one := 1.0
+		in.Multiplier = &one
+	}
+	if m := *in.Multiplier; !(m > 0 && m <= maxCampaignMultiplier) {
+		return invalid("multiplier must be above 0 and at most 10")
+	}
+	if in.BonusPoints < 0 {
+		return invalid("bonus_points must be >= 0")
+	}
+	if *in.Multiplier == 1 && in.BonusPoints == 0 {
+		return invalid("a campaign needs a multiplier other than 1 or bonus_points")
+	}
+	if len(in.Tasks) > 100 {
+		return invalid("at most 100 tasks")
+	}
+	slices.Sort(in.Tasks)
+	in.Tasks = slices.Compact(in.Tasks)
+	return nil
+}
+
+func (in CampaignInput) campaign(id int64) repository.Campaign {
+	return repository.Campaign{
+		ID: id, Name: in.Name, StartsAt: *in.StartsAt, EndsAt: in.EndsAt,
+		Multiplier: *in.Multiplier, BonusPoints: in.BonusPoints, Category: in.Category, Tasks: in.Tasks,
+	}
+}
+
+// checkCampaignScope rejects tasks and categories that don't exist.
+func checkCampaignScope(ctx context.Context, q repository.Queries, in CampaignInput) error {
+	for _, code := range in.Tasks {
+		if _, err := q.GetTask(ctx, code); errors.Is(err, repository.ErrNotFound) {
+			return invalid("tasks names an unknown task")
+		} else if err != nil {
+			return err
+		}
+	}
+	if in.Category != "" {
+		if _, err := q.GetCategory(ctx, in.Category); errors.Is(err, repository.ErrNotFound) {
+			return invalid("category names an unknown category")
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) Campaigns(ctx context.Context) ([]repository.Campaign, error) {
+	return s.store.ListCampaigns(ctx)
+}
+
+// CurrentCampaigns lists the campaigns that are running or yet to start,
+// soonest to end first, for users to see what is on offer.
+func (s *Service) CurrentCampaigns(ctx context.Context) ([]repository.Campaign, error) {
+	var all []repository.Campaign
+	err := s.read(ctx, func(q repository.Queries) error {
+		var err error
+		all, err = q.ListCampaigns(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := []repository.Campaign{}
+	for _, c := range all {
+		if c.Status != repository.CampaignEnded {
+			out = append(out, c)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b repository.Campaign) int { return a.EndsAt.Compare(b.EndsAt) })
+	return out, nil
+}
+
+func (s *Service) Campaign(ctx context.Context, id int64) (repository.Campaign, error) {
+	c, err := s.store.GetCampaign(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c, ErrCampaignNotFound
+	}
+	return c, err
+}
+
+// CreateCampaign schedules a campaign. Campaigns can't start in the past:
+// they only apply to points awarded while they run.
+func (s *Service) CreateCampaign(ctx context.Context, in CampaignInput) (repository.Campaign, error) {
+	now := s.now()
+	if in.StartsAt != nil && in.StartsAt.Before(now) {
+		return repository.Campaign{}, invalid("starts_at must not be in the past")
+	}
+	if err := in.validate(now); err != nil {
+		return repository.Campaign{}, err
+	}
+	var c repository.Campaign
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		if err := checkCampaignScope(ctx, q, in); err != nil {
+			return err
+		}
+		var err error
+		if c, err = q.CreateCampaign(ctx, in.campaign(0)); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditCampaignCreated, "campaign", userTarget(c.ID), nil, c)
+	})
+	return c, err
+}
+
+// UpdateCampaign replaces a campaign. Once a campaign has started only its
+// name and end can change, so its report covers one set of terms, and the
+// end can't be moved into the past; ended campaigns can't change at all.
+func (s *Service) UpdateCampaign(ctx context.Context, id int64, in CampaignInput) (repository.Campaign, error) {
+	now := s.now()
+	var after repository.Campaign
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetCampaign(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrCampaignNotFound
+		}
+		if err != nil {
+			return err
+		}
+		switch before.Status {
+		case repository.CampaignUpcoming:
+			if in.StartsAt != nil && in.StartsAt.Before(now) {
+				return invalid("starts_at must not be in the past")
+			}
+		case repository.CampaignActive:
+			if in.StartsAt == nil {
+				in.StartsAt = &before.StartsAt
+			}
+			if in.Multiplier == nil {
+				in.Multiplier = &before.Multiplier
+			}
+		default:
+			return ErrCampaignLocked
+		}
+		if err := in.validate(now); err != nil {
+			return err
+		}
+		if before.Status == repository.CampaignActive {
+			if !in.StartsAt.Equal(before.StartsAt) || *in.Multiplier != before.Multiplier ||
+				in.BonusPoints != before.BonusPoints || in.Category != before.Category || !slices.Equal(in.Tasks, before.Tasks) {
+				return ErrCampaignLocked
+			}
+		}
+		if err := checkCampaignScope(ctx, q, in); err != nil {
+			return err
+		}
+		if err := q.UpdateCampaign(ctx, in.campaign(id)); err != nil {
+			return err
+		}
+		if after, err = q.GetCampaign(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditCampaignUpdated, "campaign", userTarget(id), before, after)
+	})
+	return after, err
+}
+
+// DeleteCampaign drops a campaign that hasn't started yet.
+func (s *Service) DeleteCampaign(ctx context.Context, id int64) error {
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetCampaign(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrCampaignNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if before.Status != repository.CampaignUpcoming {
+			return ErrCampaignLocked
+		}
+		if err := q.DeleteCampaign(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditCampaignDeleted, "campaign", userTarget(id), before, nil)
+	})
+}
+
+// AppliedCampaign is a campaign's share of one completion's points.
+type AppliedCampaign struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Points int64  `json:"points"`
+}
+
+// applyCampaigns applies the running campaigns that cover task to ex,
+// oldest first, each scaling what the ones before it left and adding its
+// bonus, and records what each added.
+func (s *Service) applyCampaigns(ctx context.Context, q repository.Queries, userID int64, task repository.Task, ex *Explain) ([]AppliedCampaign, error) {
+	running, err := q.RunningCampaigns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var applied []AppliedCampaign
+	for _, c := range running {
+		if !c.Covers(task) {
+			continue
+		}
+		extra := ex.apply(Modifier{Kind: ModifierCampaign, ID: c.ID, Name: c.Name, Multiplier: c.Multiplier, Bonus: c.BonusPoints})
+		err := q.AddCampaignAward(ctx, repository.CampaignAward{
+			CampaignID: c.ID, UserID: userID, TaskCode: task.Code, Awarded: ex.points(), Extra: extra,
+		})
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, AppliedCampaign{ID: c.ID, Name: c.Name, Points: extra})
+	}
+	return applied, nil
+}
+
+// CampaignReport is a campaign with what it has added so far.
+type CampaignReport struct {
+	Campaign repository.Campaign `json:"campaign"`
+	repository.CampaignStats
+}
+
+func (s *Service) CampaignReport(ctx context.Context, id int64) (CampaignReport, error) {
+	var r CampaignReport
+	err := s.read(ctx, func(q repository.Queries) error {
+		var err error
+		if r.Campaign, err = q.GetCampaign(ctx, id); err != nil {
+			return err
+		}
+		r.CampaignStats, err = q.CampaignStats(ctx, id)
+		return err
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return r, ErrCampaignNotFound
+	}
+	return r, err
+}
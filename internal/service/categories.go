@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var (
+	ErrCategoryNotFound = newError("CATEGORY_NOT_FOUND", "category not found")
+	ErrCategoryExists   = newError("CATEGORY_EXISTS", "category already exists")
+)
+
+const (
+	AuditCategoryCreated = "category.created"
+	AuditCategoryUpdated = "category.updated"
+	AuditCategoryDeleted = "category.deleted"
+)
+
+// CategoryInput is a category as admins define it. Code is only read on
+// creation; it is what tasks refer to, so it can't change.
+type CategoryInput struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Position    int    `json:"position"`
+}
+
+func (in CategoryInput) category() (repository.Category, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return repository.Category{}, invalid("name is required, at most 64 characters")
+	}
+	if utf8.RuneCountInString(in.Description) > 500 {
+		return repository.Category{}, invalid("description must be at most 500 characters")
+	}
+	return repository.Category{Code: in.Code, Name: name, Description: in.Description, Position: in.Position}, nil
+}
+
+// Categories lists categories in display order.
+func (s *Service) Categories(ctx context.Context) ([]repository.Category, error) {
+	return s.store.ListCategories(ctx)
+}
+
+func (s *Service) CreateCategory(ctx context.Context, in CategoryInput) (repository.Category, error) {
+	c, err := in.category()
+	if err != nil {
+		return c, err
+	}
+	if !taskCodeRe.MatchString(c.Code) {
+		return c, invalid("code must be 1-64 lowercase letters, digits or '_'")
+	}
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		if err := q.CreateCategory(ctx, c); errors.Is(err, repository.ErrConflict) {
+			return ErrCategoryExists
+		} else if err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditCategoryCreated, "category", c.Code, nil, c)
+	})
+	return c, err
+}
+
+func (s *Service) UpdateCategory(ctx context.Context, code string, in CategoryInput) (repository.Category, error) {
+	c, err := in.category()
+	if err != nil {
+		return c, err
+	}
+	c.Code = code
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetCategory(ctx, code)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrCategoryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.UpdateCategory(ctx, c); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditCategoryUpdated, "category", code, before, c)
+	})
+	return c, err
+}
+
+// DeleteCategory drops a category. Its tasks stay, without a category.
+func (s *Service) DeleteCategory(ctx context.Context, code string) error {
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetCategory(ctx, code)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrCategoryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteCategory(ctx, code); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditCategoryDeleted, "category", code, before, nil)
+	})
+}
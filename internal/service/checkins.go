@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// EventCheckedIn is a user's daily check-in.
+const EventCheckedIn = "user.checked_in"
+
+// AuditCheckin is the points paid for a daily check-in.
+const AuditCheckin = "checkin.rewarded"
+
+var ErrAlreadyCheckedIn = newError("ALREADY_CHECKED_IN", "user has already checked in today")
+
+// Checkin is the outcome of a daily check-in. Day is the user's local date
+// and Streak the consecutive days they have checked in, this one included;
+// NextReward is what checking in tomorrow pays.
+type Checkin struct {
+	Day        string `json:"day"`
+	Streak     int    `json:"streak"`
+	Longest    int    `json:"longest"`
+	Awarded    int64  `json:"awarded"`
+	NextReward int64  `json:"next_reward"`
+}
+
+// checkinReward is what day n of a run of check-ins pays.
+func (s *Service) checkinReward(n int) int64 {
+	if len(s.cfg.CheckinRewards) == 0 {
+		return 0
+	}
+	return curveAt(s.cfg.CheckinRewards, n)
+}
+
+// localDay is the date at now in the IANA zone tz, or in UTC when tz is
+// empty or doesn't load, as midnight UTC like the store's dates.
+func localDay(tz string, now time.Time) time.Time {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// CheckIn records the user's check-in for the day in their profile's time
+// zone and pays the reward for the run of days it extends. A second
+// check-in on the same day, or on an earlier one after moving time zones
+// west, is ErrAlreadyCheckedIn.
+func (s *Service) CheckIn(ctx context.Context, userID int64) (res Checkin, err error) {
+	ctx, span := tracer.Start(ctx, "CheckIn", trace.WithAttributes(attribute.Int64("user.id", userID)))
+	defer func() { endSpan(span, err) }()
+
+	if !s.featureOn(ctx, s.store, FlagCheckins, userID) {
+		return res, ErrFeatureDisabled
+	}
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		p, err := q.GetProfile(ctx, userID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		day := localDay(p.Timezone, s.now())
+		st, ok, err := q.CheckIn(ctx, userID, day)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrAlreadyCheckedIn
+		}
+		res = Checkin{
+			Day: day.Format(time.DateOnly), Streak: st.Current, Longest: st.Longest,
+			Awarded: s.checkinReward(st.Current), NextReward: s.checkinReward(st.Current + 1),
+		}
+		if res.Awarded > 0 {
+			details := map[string]any{"day": res.Day, "streak": res.Streak}
+			if err := s.accrue(ctx, q, AuditCheckin, userID, res.Awarded, "checkin:"+res.Day, details); err != nil {
+				return err
+			}
+		}
+		return emit(ctx, q, EventCheckedIn, map[string]any{
+			"user_id": userID, "day": res.Day, "streak": res.Streak, "awarded": res.Awarded,
+		})
+	})
+	if err != nil {
+		return Checkin{}, err
+	}
+	s.RefreshCachedPoints(ctx, userID)
+	return res, nil
+}
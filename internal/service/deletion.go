@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var ErrDeletedUserNotFound = newError("DELETED_USER_NOT_FOUND", "no deleted user to restore, or its grace period has ended")
+
+const (
+	AuditUserDeleted  = "user.deleted"
+	AuditUserRestored = "user.restored"
+)
+
+// DeleteUser soft-deletes the user and scrubs their username, password and
+// profile. Their ledger, transfers and referrals stay; they just stop
+// showing up. RestoreUser can undo it within Config.DeletionGrace.
+func (s *Service) DeleteUser(ctx context.Context, userID int64) error {
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		if err := deleteUser(ctx, q, userID); err != nil {
+			return err
+		}
+		if err := audit(ctx, q, AuditUserDeleted, "user", userTarget(userID), nil, nil); err != nil {
+			return err
+		}
+		return emit(ctx, q, EventUserDeleted, map[string]any{"user_id": userID})
+	})
+	if err != nil {
+		return err
+	}
+	s.dropCachedUsers(ctx, userID)
+	return nil
+}
+
+// deleteUser is DeleteUser without the audit entry and event.
+func deleteUser(ctx context.Context, q repository.Queries, userID int64) error {
+	err := q.DeleteUser(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// exports are full of what was just scrubbed
+	if err := q.DeleteUserExports(ctx, userID); err != nil {
+		return err
+	}
+	if err := leaveTeamOnDelete(ctx, q, userID); err != nil {
+		return err
+	}
+	// email addresses and push tokens are personal data too
+	if err := q.DeleteChannelSetting(ctx, userID, ""); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	// so the provider account can sign up afresh
+	return q.DeleteIdentities(ctx, userID)
+}
+
+// RestoreUser brings back a user deleted less than Config.DeletionGrace ago,
+// with the username, password and profile they had.
+func (s *Service) RestoreUser(ctx context.Context, userID int64) (repository.User, error) {
+	var u repository.User
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		err := q.RestoreUser(ctx, userID, s.now().Add(-s.cfg.DeletionGrace))
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			return ErrDeletedUserNotFound
+		case errors.Is(err, repository.ErrConflict):
+			return ErrUsernameTaken
+		case err != nil:
+			return err
+		}
+		if u, err = q.GetUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := audit(ctx, q, AuditUserRestored, "user", userTarget(userID), nil, nil); err != nil {
+			return err
+		}
+		return emit(ctx, q, EventUserRestored, map[string]any{"user_id": userID})
+	})
+	if err != nil {
+		return u, err
+	}
+	s.RefreshCachedPoints(ctx, userID)
+	return u, nil
+}
+
+// PurgeDeletedUsers forgets what deleted users can be restored from once
+// their grace period is over. It is a scheduled job.
+func (s *Service) PurgeDeletedUsers(ctx context.Context) error {
+	n, err := s.store.PurgeDeletedUsers(ctx, s.now().Add(-s.cfg.DeletionGrace))
+	if n > 0 {
+		log.Printf("purged %d deleted users", n)
+	}
+	return err
+}
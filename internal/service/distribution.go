@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// distributionPercentiles are the percentiles PointsDistribution reports.
+var distributionPercentiles = []int{10, 25, 50, 75, 90, 99}
+
+// distributionCache holds each period's points distribution as last
+// counted, so the stats endpoint and every status read don't scan all
+// users. Each instance counts a period again once it is
+// Config.DistributionRefresh old.
+type distributionCache struct {
+	mu      sync.Mutex
+	periods map[string]distribution
+}
+
+type distribution struct {
+	total int64
+	// counts are lowest first, with users who earned nothing in a window
+	// counted at 0
+	counts   []repository.PointsCount
+	loadedAt time.Time
+}
+
+// distribution returns the period's cached distribution, counting it again
+// when stale. If that fails a stale one is served rather than an error.
+func (s *Service) distribution(ctx context.Context, period string) (distribution, error) {
+	c := &s.distributions
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.periods[period]
+	if ok && s.now().Sub(d.loadedAt) < s.cfg.DistributionRefresh {
+		return d, nil
+	}
+	err := s.read(ctx, func(q repository.Queries) error {
+		total, err := q.TotalUsers(ctx)
+		if err != nil {
+			return err
+		}
+		counts, err := q.PointsHistogram(ctx, period)
+		if err != nil {
+			return err
+		}
+		d = distribution{total: total, counts: withAbsent(counts, total), loadedAt: s.now()}
+		return nil
+	})
+	if err != nil {
+		if ok {
+			log.Printf("count %s points distribution: %v", period, err)
+			return c.periods[period], nil
+		}
+		return distribution{}, err
+	}
+	if c.periods == nil {
+		c.periods = map[string]distribution{}
+	}
+	c.periods[period] = d
+	return d, nil
+}
+
+// withAbsent adds the users missing from counts, who earned nothing in the
+// window, at 0 points.
+func withAbsent(counts []repository.PointsCount, total int64) []repository.PointsCount {
+	absent := total
+	for _, c := range counts {
+		absent -= c.Users
+	}
+	if absent <= 0 {
+		return counts
+	}
+	i := 0
+	for i < len(counts) && counts[i].Points < 0 {
+		i++
+	}
+	if i < len(counts) && counts[i].Points == 0 {
+		counts[i].Users += absent
+		return counts
+	}
+	out := make([]repository.PointsCount, 0, len(counts)+1)
+	out = append(out, counts[:i]...)
+	out = append(out, repository.PointsCount{Points: 0, Users: absent})
+	return append(out, counts[i:]...)
+}
+
+// standing places points in the distribution; the user is counted at
+// whatever score they had when it was counted.
+func (d distribution) standing(points int64) Standing {
+	var dist repository.Distribution
+	for _, c := range d.counts {
+		switch {
+		case c.Points < points:
+			dist.Below += c.Users
+		case c.Points > points:
+			dist.Above += c.Users
+		}
+		dist.Present += c.Users
+	}
+	st := standing(points, d.total, dist)
+	st.OutranksPercent, st.TopPercent = min(st.OutranksPercent, 100), min(st.TopPercent, 100)
+	return st
+}
+
+// HistogramBucket counts the users with Min to Max points, both inclusive.
+type HistogramBucket struct {
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max"`
+	Users int64 `json:"users"`
+}
+
+type PointsDistribution struct {
+	Period     string `json:"period"`
+	TotalUsers int64  `json:"total_users"`
+	// Percentiles are the points of the user at each percentile, by
+	// nearest rank, keyed "p10" to "p99".
+	Percentiles map[string]int64  `json:"percentiles"`
+	Histogram   []HistogramBucket `json:"histogram"`
+	// AsOf is when the distribution was counted.
+	AsOf time.Time `json:"as_of"`
+}
+
+// PointsDistribution summarizes how points are spread across users, by
+// lifetime points for period "all" or by points earned in the current
+// window for "daily", "weekly" and "monthly", counting users who earned
+// nothing at 0. The histogram splits the range from the lowest score to the
+// highest into at most buckets buckets of equal width.
+func (s *Service) PointsDistribution(ctx context.Context, period string, buckets int) (PointsDistribution, error) {
+	key, ok := periodKey(period)
+	if !ok {
+		return PointsDistribution{}, invalid("unknown period")
+	}
+	if buckets < 1 {
+		return PointsDistribution{}, invalid("buckets must be positive")
+	}
+	d, err := s.distribution(ctx, key)
+	if err != nil {
+		return PointsDistribution{}, err
+	}
+	var users int64
+	for _, c := range d.counts {
+		users += c.Users
+	}
+	out := PointsDistribution{
+		Period:      period,
+		TotalUsers:  users,
+		Percentiles: make(map[string]int64, len(distributionPercentiles)),
+		Histogram:   []HistogramBucket{},
+		AsOf:        d.loadedAt,
+	}
+	if users == 0 {
+		return out, nil
+	}
+
+	i, seen := 0, d.counts[0].Users
+	for _, p := range distributionPercentiles {
+		rank := max((int64(p)*users+99)/100, 1)
+		for seen < rank {
+			i++
+			seen += d.counts[i].Users
+		}
+		out.Percentiles["p"+strconv.Itoa(p)] = d.counts[i].Points
+	}
+
+	lo, hi := d.counts[0].Points, d.counts[len(d.counts)-1].Points
+	width := (hi-lo)/int64(buckets) + 1
+	// empty buckets are listed too, so the histogram has no gaps
+	for b := lo; b <= hi; b += width {
+		out.Histogram = append(out.Histogram, HistogramBucket{Min: b, Max: b + width - 1})
+	}
+	for _, c := range d.counts {
+		out.Histogram[(c.Points-lo)/width].Users += c.Users
+	}
+	return out, nil
+}
@@ -0,0 +1,20 @@
+package service
+
+// Error is a domain error. Code is a stable identifier clients can switch on;
+// Msg is safe to show them.
+type Error struct {
+	Code string
+	Msg  string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func newError(code, msg string) error { return &Error{Code: code, Msg: msg} }
+
+// Codes for the errors that carry their own message.
+const (
+	CodeValidation    = "VALIDATION_FAILED"
+	CodeVerification  = "VERIFICATION_FAILED"
+	CodeUserSuspended = "USER_SUSPENDED"
+	CodeUserBanned    = "USER_BANNED"
+)
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Event types.
+const (
+	EventUserCreated     = "user.created"
+	EventTaskCompleted   = "task.completed"
+	EventReferralCreated = "referral.created"
+	// EventReferralPaid is a pending referral's bonuses paid.
+	EventReferralPaid = "referral.paid"
+	// EventReferralCapReached is a referral made past one of the
+	// referrer's caps, which pays them no bonus.
+	EventReferralCapReached = "referral.cap_reached"
+	// EventPointsChanged is any change to a balance: every accrual, merged
+	// accounts, replicated entries and reconciled balances.
+	EventPointsChanged = "points.changed"
+	// EventPointsAdjusted is an admin's adjustment; it comes with a
+	// points.changed like any other change.
+	EventPointsAdjusted  = "points.adjusted"
+	EventUserDeleted     = "user.deleted"
+	EventUserRestored    = "user.restored"
+	EventSettingsUpdated = "user.settings_updated"
+	EventSeasonEnded     = "season.ended"
+	EventTaskRevoked     = "task.revoked"
+	// EventSubmissionReviewed is an approved or rejected task submission.
+	EventSubmissionReviewed = "task.submission_reviewed"
+)
+
+var eventTypes = []string{
+	EventUserCreated, EventTaskCompleted, EventReferralCreated, EventPointsChanged, EventPointsAdjusted,
+	EventUserDeleted, EventUserRestored, EventSettingsUpdated, EventSeasonEnded,
+	EventTaskRevoked, EventSubmissionReviewed, EventReferralPaid, EventReferralCapReached,
+	EventLevelUp, EventCheckedIn, EventUserMerged,
+}
+
+// Event is a domain event as handed to publishers. ID is unique per event
+// and stable across republishing, so consumers can dedupe on it.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// JSON is the wire form shared by every publisher.
+func (ev Event) JSON() ([]byte, error) { return json.Marshal(ev) }
+
+// emit writes an event to the outbox in q's transaction, so it is published
+// only if the change commits, and at least once if it does.
+func emit(ctx context.Context, q repository.OutboxStore, event string, data any) error {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return q.AddOutboxEvent(ctx, repository.OutboxEvent{
+		EventID:   "evt_" + hex.EncodeToString(buf),
+		Type:      event,
+		Data:      raw,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// pointsChanged emits EventPointsChanged for a change of delta to the user's
+// balance, which it left at balance.
+func pointsChanged(ctx context.Context, q repository.OutboxStore, userID, delta, balance int64, reason string) error {
+	return emit(ctx, q, EventPointsChanged, map[string]any{
+		"user_id": userID, "delta": delta, "balance": balance, "reason": reason,
+	})
+}
+
+// Publisher delivers events somewhere outside the database. Publish may be
+// called more than once for the same event.
+type Publisher interface {
+	Publish(ctx context.Context, ev Event) error
+}
+
+const (
+	outboxBatch = 100
+	outboxLease = time.Minute
+)
+
+// OutboxWorker publishes outbox events to every publisher. An event is
+// marked published once all of them accept it; otherwise it is retried for
+// all of them with backoff.
+type OutboxWorker struct {
+	store      repository.OutboxStore
+	publishers []Publisher
+	interval   time.Duration
+}
+
+func NewOutboxWorker(store repository.OutboxStore, interval time.Duration, publishers ...Publisher) *OutboxWorker {
+	return &OutboxWorker{store: store, publishers: publishers, interval: interval}
+}
+
+func (w *OutboxWorker) Run(ctx context.Context) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		for {
+			batch, err := w.store.ClaimOutboxEvents(ctx, outboxBatch, outboxLease)
+			if err != nil {
+				log.Printf("outbox: claim events: %v", err)
+				break
+			}
+			for _, e := range batch {
+				w.publish(ctx, e)
+			}
+			if len(batch) < outboxBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (w *OutboxWorker) publish(ctx context.Context, e repository.OutboxEvent) {
+	ev := Event{ID: e.EventID, Type: e.Type, CreatedAt: e.CreatedAt, Data: e.Data}
+	var errs []error
+	for _, p := range w.publishers {
+		if err := p.Publish(ctx, ev); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", p, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		retryIn := min(w.interval<<min(e.Attempts, 16), 5*time.Minute)
+		log.Printf("outbox: publish %s: %v (retry in %s)", e.EventID, err, retryIn)
+		if err := w.store.MarkOutboxFailed(ctx, e.ID, err.Error(), retryIn); err != nil {
+			log.Printf("outbox: record failure of %s: %v", e.EventID, err)
+		}
+		return
+	}
+	if err := w.store.MarkOutboxPublished(ctx, e.ID); err != nil {
+		log.Printf("outbox: mark %s published: %v", e.EventID, err)
+	}
+}
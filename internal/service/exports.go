@@ -0,0 +1,350 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var (
+	ErrExportNotFound = newError("EXPORT_NOT_FOUND", "export not found or expired")
+	ErrExportNotReady = newError("EXPORT_NOT_READY", "export is still pending or has failed")
+)
+
+const AuditUserExported = "user.exported"
+
+const (
+	// exportPage is how many ledger entries an export reads at a time.
+	exportPage = 500
+	// exportBatch and exportLease bound what one instance claims at once
+	// and how long before another may retry it.
+	exportBatch = 5
+	exportLease = 10 * time.Minute
+)
+
+// ExportDocument is the JSON export of a user's data.
+type ExportDocument struct {
+	ExportedAt     time.Time                  `json:"exported_at"`
+	User           repository.User            `json:"user"`
+	Profile        repository.Profile         `json:"profile"`
+	CompletedTasks []repository.CompletedTask `json:"completed_tasks"`
+	Referrals      []repository.Referral      `json:"referrals"`
+	// PointsHistory is the whole ledger, newest first.
+	PointsHistory []repository.LedgerEntry `json:"points_history"`
+}
+
+// Export is a user's data ready to be written. Everything but the ledger is
+// loaded up front; the ledger is read page by page while writing, so it
+// never has to fit in memory.
+type Export struct {
+	Format string
+	doc    ExportDocument
+	store  repository.Store
+}
+
+func (e *Export) ContentType() string { return ExportContentType(e.Format) }
+
+// Filename is what the export should be saved as.
+func (e *Export) Filename() string { return ExportFilename(e.doc.User.ID, e.Format) }
+
+// ExportContentType is "application/json" for JSON exports and
+// "application/zip" for CSV ones, which are a zip of one CSV file per
+// section.
+func ExportContentType(format string) string {
+	if format == "csv" {
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+// ExportFilename names the archive of a user's export in format.
+func ExportFilename(userID int64, format string) string {
+	ext := "json"
+	if format == "csv" {
+		ext = "zip"
+	}
+	return fmt.Sprintf("user-%d-export.%s", userID, ext)
+}
+
+// ExportUser starts an export of the user's data in format ("json", the
+// default, or "csv"). Users with at most Config.ExportAsyncThreshold ledger
+// entries get an Export to write right away; larger accounts, or any with
+// async set, get a queued DataExport that RunExports builds.
+func (s *Service) ExportUser(ctx context.Context, userID int64, format string, async bool) (*Export, *repository.DataExport, error) {
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		return nil, nil, invalid("format must be json or csv")
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return nil, nil, err
+	}
+	if !async {
+		n, err := s.store.CountTransactions(ctx, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		async = n > s.cfg.ExportAsyncThreshold
+	}
+
+	var job *repository.DataExport
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		job = nil
+		after := map[string]any{"format": format}
+		if async {
+			j, err := q.CreateExport(ctx, userID, format)
+			if err != nil {
+				return err
+			}
+			job = &j
+			after["export_id"] = j.ID
+		}
+		return audit(ctx, q, AuditUserExported, "user", userTarget(userID), nil, after)
+	})
+	if err != nil || job != nil {
+		return nil, job, err
+	}
+	exp, err := s.loadExport(ctx, userID, format)
+	return exp, nil, err
+}
+
+func (s *Service) loadExport(ctx context.Context, userID int64, format string) (*Export, error) {
+	e := &Export{Format: format, store: s.store, doc: ExportDocument{ExportedAt: s.now().UTC()}}
+	var err error
+	if e.doc.User, err = s.getUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if e.doc.Profile, err = s.store.GetProfile(ctx, userID); err != nil {
+		return nil, err
+	}
+	if e.doc.CompletedTasks, err = s.store.ListCompletedTasks(ctx, userID); err != nil {
+		return nil, err
+	}
+	if e.doc.CompletedTasks == nil {
+		e.doc.CompletedTasks = []repository.CompletedTask{}
+	}
+	if e.doc.Referrals, err = s.store.ListReferrals(ctx, userID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// eachLedgerEntry calls fn for every entry of the user's ledger, newest
+// first.
+func (e *Export) eachLedgerEntry(ctx context.Context, fn func(repository.LedgerEntry) error) error {
+	before := int64(math.MaxInt64)
+	for {
+		page, err := e.store.ListTransactions(ctx, e.doc.User.ID, before, exportPage)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPage {
+			return nil
+		}
+		before = page[len(page)-1].ID
+	}
+}
+
+// Write writes the export to w. An error means w got a truncated export.
+func (e *Export) Write(ctx context.Context, w io.Writer) error {
+	if e.Format == "csv" {
+		return e.writeCSV(ctx, w)
+	}
+	return e.writeJSON(ctx, w)
+}
+
+func (e *Export) writeJSON(ctx context.Context, w io.Writer) error {
+	// everything up to the ledger, which ends the document, is marshalled
+	// in one go; the ledger entries are appended inside its brackets
+	doc := e.doc
+	doc.PointsHistory = []repository.LedgerEntry{}
+	head, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(bytes.TrimSuffix(head, []byte("]}"))); err != nil {
+		return err
+	}
+	sep := ""
+	err = e.eachLedgerEntry(ctx, func(entry repository.LedgerEntry) error {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		sep = ","
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+func (e *Export) writeCSV(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	file := func(name string, header []string) (*csv.Writer, error) {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: e.doc.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		cw := csv.NewWriter(f)
+		return cw, cw.Write(header)
+	}
+	ts := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	id := func(n int64) string { return strconv.FormatInt(n, 10) }
+
+	u, p := e.doc.User, e.doc.Profile
+	referrer := ""
+	if u.ReferrerID != nil {
+		referrer = id(*u.ReferrerID)
+	}
+	cw, err := file("user.csv", []string{"id", "username", "points", "referrer_id", "created_at", "display_name", "avatar_url", "timezone", "locale"})
+	if err != nil {
+		return err
+	}
+	cw.Write([]string{id(u.ID), u.Username, id(u.Points), referrer, ts(u.CreatedAt), p.DisplayName, p.AvatarURL, p.Timezone, p.Locale})
+	if cw.Flush(); cw.Error() != nil {
+		return cw.Error()
+	}
+
+	if cw, err = file("completed_tasks.csv", []string{"code", "title", "points", "completed_at"}); err != nil {
+		return err
+	}
+	for _, t := range e.doc.CompletedTasks {
+		cw.Write([]string{t.Code, t.Title, id(t.Points), ts(t.CompletedAt)})
+	}
+	if cw.Flush(); cw.Error() != nil {
+		return cw.Error()
+	}
+
+	if cw, err = file("referrals.csv", []string{"referrer_id", "referred_id", "bonus_referrer", "bonus_referred", "status", "created_at", "paid_at"}); err != nil {
+		return err
+	}
+	for _, r := range e.doc.Referrals {
+		paidAt := ""
+		if r.PaidAt != nil {
+			paidAt = ts(*r.PaidAt)
+		}
+		cw.Write([]string{id(r.ReferrerID), id(r.ReferredID), id(r.BonusReferrer), id(r.BonusReferred), r.Status, ts(r.CreatedAt), paidAt})
+	}
+	if cw.Flush(); cw.Error() != nil {
+		return cw.Error()
+	}
+
+	if cw, err = file("points_history.csv", []string{"id", "amount", "reason", "region", "created_at"}); err != nil {
+		return err
+	}
+	err = e.eachLedgerEntry(ctx, func(entry repository.LedgerEntry) error {
+		return cw.Write([]string{id(entry.ID), id(entry.Amount), entry.Reason, entry.Region, ts(entry.CreatedAt)})
+	})
+	if err != nil {
+		return err
+	}
+	if cw.Flush(); cw.Error() != nil {
+		return cw.Error()
+	}
+	return zw.Close()
+}
+
+// DataExport returns one of the user's queued exports.
+func (s *Service) DataExport(ctx context.Context, userID, id int64) (repository.DataExport, error) {
+	e, err := s.store.GetExport(ctx, userID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return e, ErrExportNotFound
+	}
+	return e, err
+}
+
+// ExportArchive returns a ready export and its archive.
+func (s *Service) ExportArchive(ctx context.Context, userID, id int64) (repository.DataExport, []byte, error) {
+	e, err := s.DataExport(ctx, userID, id)
+	if err != nil {
+		return e, nil, err
+	}
+	if e.Status != "ready" {
+		return e, nil, ErrExportNotReady
+	}
+	content, err := s.store.ExportContent(ctx, userID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return e, nil, ErrExportNotFound
+	}
+	return e, content, err
+}
+
+// RunExports builds queued data and report exports every interval. Several
+// instances can run it against one database; each export is claimed by one
+// of them.
+func (s *Service) RunExports(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		s.buildExports(ctx)
+		s.buildReportExports(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// PurgeExports drops exports whose Config.ExportTTL is over. It is a
+// scheduled job.
+func (s *Service) PurgeExports(ctx context.Context) error {
+	n, err := s.store.PurgeExports(ctx, s.now())
+	if n > 0 {
+		log.Printf("purged %d expired exports", n)
+	}
+	return err
+}
+
+func (s *Service) buildExports(ctx context.Context) {
+	jobs, err := s.store.ClaimExports(ctx, exportBatch, exportLease)
+	if err != nil {
+		log.Printf("claim exports: %v", err)
+		return
+	}
+	for _, j := range jobs {
+		var buf bytes.Buffer
+		e, err := s.loadExport(ctx, j.UserID, j.Format)
+		if err == nil {
+			err = e.Write(ctx, &buf)
+		}
+		if ctx.Err() != nil {
+			// shutting down: the lease runs out and the export is retried
+			return
+		}
+		expires := s.now().Add(s.cfg.ExportTTL)
+		if err != nil {
+			log.Printf("export %d: %v", j.ID, err)
+			err = s.store.FailExport(ctx, j.ID, "could not build the export", expires)
+		} else {
+			err = s.store.CompleteExport(ctx, j.ID, buf.Bytes(), expires)
+		}
+		if err != nil {
+			log.Printf("export %d: %v", j.ID, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermFlagsManage allows reading and setting feature flags at runtime.
+const PermFlagsManage = "flags:manage"
+
+// Features that can be rolled out gradually. A feature that is off for a
+// user behaves as before it existed: task points are not multiplied by the
+// streak, and transfers and check-ins are refused.
+const (
+	FlagStreaks   = "streaks"
+	FlagTransfers = "transfers"
+	FlagCheckins  = "checkins"
+)
+
+// flagDescriptions lists the flags there are.
+var flagDescriptions = map[string]string{
+	FlagStreaks:   "streak multipliers on task points",
+	FlagTransfers: "point transfers between users",
+	FlagCheckins:  "daily check-in rewards",
+}
+
+// ValidFlag reports whether name is a feature flag.
+func ValidFlag(name string) bool {
+	_, ok := flagDescriptions[name]
+	return ok
+}
+
+var (
+	ErrFlagNotFound    = newError("FLAG_NOT_FOUND", "feature flag not found")
+	ErrFeatureDisabled = newError("FEATURE_DISABLED", "this feature is not available to you yet")
+)
+
+const (
+	AuditFlagSet     = "flag.set"
+	AuditFlagCleared = "flag.cleared"
+)
+
+// Flag is a feature's rollout as it applies now: on for Percent percent of
+// users if Enabled. Source is "config" for the rollout in
+// Config.FlagDefaults, on for everyone when that doesn't name the flag,
+// and "override" for one set at runtime.
+type Flag struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Enabled     bool       `json:"enabled"`
+	Percent     int        `json:"percent"`
+	Source      string     `json:"source"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// FlagInput overrides a flag's rollout; Percent defaults to 100.
+type FlagInput struct {
+	Enabled bool `json:"enabled"`
+	Percent *int `json:"percent"`
+}
+
+// flagCache holds the overrides as last loaded, so checking a flag doesn't
+// cost a query per request. Each instance reloads them once they are
+// Config.FlagsRefresh old.
+type flagCache struct {
+	mu       sync.Mutex
+	loadedAt time.Time
+	flags    map[string]repository.FeatureFlag
+}
+
+// flag is name's rollout as configured and overridden.
+func (s *Service) flag(name string, overrides map[string]repository.FeatureFlag) Flag {
+	f := Flag{Name: name, Description: flagDescriptions[name], Enabled: true, Percent: 100, Source: "config"}
+	if pct, ok := s.cfg.FlagDefaults[name]; ok {
+		f.Enabled, f.Percent = pct > 0, pct
+	}
+	if o, ok := overrides[name]; ok {
+		at := o.UpdatedAt
+		f.Enabled, f.Percent, f.Source, f.UpdatedAt = o.Enabled, o.Percent, "override", &at
+	}
+	return f
+}
+
+// overrides returns the cached overrides, loading them through q when they
+// are stale. If that fails the stale ones are kept, so a database hiccup
+// doesn't flip features.
+func (s *Service) overrides(ctx context.Context, q repository.FlagStore) map[string]repository.FeatureFlag {
+	s.flagCache.mu.Lock()
+	defer s.flagCache.mu.Unlock()
+	if s.flagCache.flags != nil && s.now().Sub(s.flagCache.loadedAt) < s.cfg.FlagsRefresh {
+		return s.flagCache.flags
+	}
+	list, err := q.FeatureFlags(ctx)
+	if err != nil {
+		log.Printf("load feature flags: %v", err)
+		return s.flagCache.flags
+	}
+	flags := make(map[string]repository.FeatureFlag, len(list))
+	for _, f := range list {
+		flags[f.Name] = f
+	}
+	s.flagCache.flags, s.flagCache.loadedAt = flags, s.now()
+	return flags
+}
+
+// featureOn reports whether the feature is rolled out to the user. q is
+// the store or, inside a transaction, its Queries.
+func (s *Service) featureOn(ctx context.Context, q repository.FlagStore, name string, userID int64) bool {
+	f := s.flag(name, s.overrides(ctx, q))
+	return f.Enabled && rolledOut(name, userID, f.Percent)
+}
+
+// rolledOut puts the user in one of 100 buckets per flag, so raising the
+// percentage adds users without dropping any and each flag picks its own.
+func rolledOut(name string, userID int64, percent int) bool {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", name, userID)
+	return int(h.Sum32()%100) < percent
+}
+
+// Flags lists every flag with its current rollout, read fresh.
+func (s *Service) Flags(ctx context.Context) ([]Flag, error) {
+	list, err := s.store.FeatureFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]repository.FeatureFlag, len(list))
+	for _, f := range list {
+		overrides[f.Name] = f
+	}
+	out := make([]Flag, 0, len(flagDescriptions))
+	for name := range flagDescriptions {
+		out = append(out, s.flag(name, overrides))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Features reports which flags are on for the user.
+func (s *Service) Features(ctx context.Context, userID int64) (map[string]bool, error) {
+	if _, err := s.store.GetUser(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(flagDescriptions))
+	for name := range flagDescriptions {
+		out[name] = s.featureOn(ctx, s.store, name, userID)
+	}
+	return out, nil
+}
+
+// SetFlag overrides the flag's rollout on every instance within
+// Config.FlagsRefresh, and on this one right away.
+func (s *Service) SetFlag(ctx context.Context, name string, in FlagInput) (Flag, error) {
+	if !ValidFlag(name) {
+		return Flag{}, ErrFlagNotFound
+	}
+	pct := 100
+	if in.Percent != nil {
+		pct = *in.Percent
+	}
+	if pct < 0 || pct > 100 {
+		return Flag{}, invalid("percent must be between 0 and 100")
+	}
+	var after Flag
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := s.currentFlag(ctx, q, name)
+		if err != nil {
+			return err
+		}
+		o, err := q.SetFeatureFlag(ctx, repository.FeatureFlag{Name: name, Enabled: in.Enabled, Percent: pct})
+		if err != nil {
+			return err
+		}
+		after = s.flag(name, map[string]repository.FeatureFlag{name: o})
+		return audit(ctx, q, AuditFlagSet, "flag", name, before, after)
+	})
+	if err == nil {
+		s.expireFlags()
+	}
+	return after, err
+}
+
+// ClearFlag drops the flag's override, putting it back to its configured
+// rollout.
+func (s *Service) ClearFlag(ctx context.Context, name string) (Flag, error) {
+	if !ValidFlag(name) {
+		return Flag{}, ErrFlagNotFound
+	}
+	after := s.flag(name, nil)
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := s.currentFlag(ctx, q, name)
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteFeatureFlag(ctx, name); errors.Is(err, repository.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditFlagCleared, "flag", name, before, after)
+	})
+	if err == nil {
+		s.expireFlags()
+	}
+	return after, err
+}
+
+func (s *Service) currentFlag(ctx context.Context, q repository.FlagStore, name string) (Flag, error) {
+	list, err := q.FeatureFlags(ctx)
+	if err != nil {
+		return Flag{}, err
+	}
+	for _, f := range list {
+		if f.Name == name {
+			return s.flag(name, map[string]repository.FeatureFlag{name: f}), nil
+		}
+	}
+	return s.flag(name, nil), nil
+}
+
+// expireFlags has the next check reload the overrides.
+func (s *Service) expireFlags() {
+	s.flagCache.mu.Lock()
+	s.flagCache.flags = nil
+	s.flagCache.mu.Unlock()
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var (
+	ErrIdempotencyKeyReused     = newError("IDEMPOTENCY_KEY_REUSED", "idempotency key reused with a different request")
+	ErrIdempotencyKeyInProgress = newError("IDEMPOTENCY_KEY_IN_PROGRESS", "request with this idempotency key is in progress")
+)
+
+// BeginIdempotent claims key for the user's request. It returns the stored
+// response when the same request already completed, and nil when the caller
+// should execute it and then call FinishIdempotent or ReleaseIdempotent.
+func (s *Service) BeginIdempotent(ctx context.Context, userID int64, key, requestHash string) (*repository.IdempotentResponse, error) {
+	if key == "" || len(key) > 255 {
+		return nil, invalid("Idempotency-Key must be 1-255 characters")
+	}
+	prev, err := s.store.ClaimIdempotencyKey(ctx, userID, key, requestHash, s.cfg.IdempotencyLease, s.cfg.IdempotencyTTL)
+	if err != nil || prev == nil {
+		return nil, err
+	}
+	if prev.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !prev.Done {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return prev, nil
+}
+
+func (s *Service) FinishIdempotent(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error {
+	return s.store.SaveIdempotentResponse(ctx, userID, key, status, contentType, body)
+}
+
+func (s *Service) ReleaseIdempotent(ctx context.Context, userID int64, key string) error {
+	return s.store.ReleaseIdempotencyKey(ctx, userID, key)
+}
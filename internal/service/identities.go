@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// ProviderTelegram is the provider of Telegram accounts, by their numeric
+// Telegram user id. The telegram verifier checks tasks against the
+// account the user has linked.
+const ProviderTelegram = "telegram"
+
+// maxExternalID is how long a partner's account id can be.
+const maxExternalID = 128
+
+const AuditIdentityUnlinked = "user.identity_unlinked"
+
+var (
+	ErrIdentityNotFound = newError("IDENTITY_NOT_FOUND", "no account from that provider is linked")
+	ErrLastSignIn       = newError("LAST_SIGN_IN", "that account is the user's only way to sign in")
+	// ErrTelegramUnavailable is returned for Telegram links without a bot to
+	// check the login against.
+	ErrTelegramUnavailable = newError("TELEGRAM_UNAVAILABLE", "linking Telegram accounts isn't available")
+)
+
+// ListIdentities returns the outside accounts linked to the user: those
+// they sign in with, their Telegram account and their partner accounts.
+func (s *Service) ListIdentities(ctx context.Context, userID int64) ([]repository.ExternalIdentity, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.store.ListIdentities(ctx, userID)
+}
+
+// IsPartner reports whether provider names a partner.
+func (s *Service) IsPartner(provider string) bool {
+	return slices.Contains(s.cfg.Partners, provider)
+}
+
+// LinkIdentity links the user's account externalID at provider, which is
+// telegram, a partner or the identity provider whose tokens are accepted.
+// A Telegram account is only linked with proof, the Telegram Login
+// Widget's data for it, which shows the user owns it; externalID may then
+// be left empty. Partner and identity provider accounts take the caller's
+// word, so the caller must hold PermUsersManage. Accounts users sign in
+// with are linked through StartOAuth instead, which proves the user owns
+// them. An account linked to another user is ErrIdentityTaken, and a user
+// has one per provider (ErrProviderLinked).
+func (s *Service) LinkIdentity(ctx context.Context, userID int64, provider, externalID string, proof json.RawMessage) (repository.ExternalIdentity, error) {
+	if provider == ProviderTelegram {
+		v, ok := s.cfg.Verifiers[ProviderTelegram].(AccountVerifier)
+		if !ok {
+			return repository.ExternalIdentity{}, ErrTelegramUnavailable
+		}
+		account, err := v.VerifyAccount(proof)
+		if err != nil {
+			return repository.ExternalIdentity{}, invalid(err.Error())
+		}
+		if externalID != "" && externalID != account {
+			return repository.ExternalIdentity{}, invalid("external_id isn't the account proof is for")
+		}
+		externalID = account
+	}
+	return s.addIdentity(ctx, userID, provider, externalID)
+}
+
+// addIdentity is LinkIdentity once the account is known to be the user's.
+func (s *Service) addIdentity(ctx context.Context, userID int64, provider, externalID string) (repository.ExternalIdentity, error) {
+	switch {
+	case provider == ProviderTelegram:
+		if n, err := strconv.ParseInt(externalID, 10, 64); err != nil || n <= 0 {
+			return repository.ExternalIdentity{}, invalid("external_id must be a Telegram user id")
+		}
+	case s.IsPartner(provider), s.IsTokenProvider(provider):
+		if externalID == "" || len(externalID) > maxExternalID {
+			return repository.ExternalIdentity{}, invalid("external_id must be 1-128 bytes")
+		}
+	default:
+		return repository.ExternalIdentity{}, invalid("provider must be telegram, a partner or the token provider; link google and github with /users/{id}/oauth/{provider}/link")
+	}
+	id := repository.ExternalIdentity{Provider: provider, ExternalID: externalID, UserID: userID}
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		if _, err := q.GetUser(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+		err := q.AddIdentity(ctx, id)
+		if errors.Is(err, repository.ErrConflict) {
+			if other, err := q.GetIdentity(ctx, provider, externalID); err == nil && other.UserID != userID {
+				return ErrIdentityTaken
+			}
+			return ErrProviderLinked
+		}
+		if err != nil {
+			return err
+		}
+		if id, err = q.GetIdentity(ctx, provider, externalID); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditIdentityLinked, "user", userTarget(userID), nil,
+			map[string]any{"provider": provider, "external_id": externalID})
+	})
+	return id, err
+}
+
+// UnlinkIdentity removes the user's account from provider. The last way
+// a user without a password signs in can't be removed (ErrLastSignIn).
+func (s *Service) UnlinkIdentity(ctx context.Context, userID int64, provider string) error {
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, hash, err := s.store.GetPasswordHash(ctx, u.Username)
+	if err != nil {
+		return err
+	}
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		id, err := q.DeleteIdentity(ctx, userID, provider)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrIdentityNotFound
+		} else if err != nil {
+			return err
+		}
+		if _, signIn := s.cfg.OAuthProviders[provider]; signIn && hash == "" {
+			rest, err := q.ListIdentities(ctx, userID)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(rest, func(id repository.ExternalIdentity) bool {
+				_, ok := s.cfg.OAuthProviders[id.Provider]
+				return ok
+			}) {
+				return ErrLastSignIn
+			}
+		}
+		return audit(ctx, q, AuditIdentityUnlinked, "user", userTarget(userID), id, nil)
+	})
+}
+
+// linkedAccount returns the user's account at provider, "" when they have
+// none linked.
+func (s *Service) linkedAccount(ctx context.Context, userID int64, provider string) (string, error) {
+	ids, err := s.store.ListIdentities(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		if id.Provider == provider {
+			return id.ExternalID, nil
+		}
+	}
+	return "", nil
+}
+
+// linkTelegram links the Telegram account a verified proof showed the user
+// owns, so no other user can complete tasks with it. An account linked to
+// another user is ErrIdentityTaken, and the completion is refused.
+func (s *Service) linkTelegram(ctx context.Context, userID int64, account string) error {
+	_, err := s.addIdentity(ctx, userID, ProviderTelegram, account)
+	switch {
+	case err == nil || errors.Is(err, ErrProviderLinked):
+		return nil
+	case errors.Is(err, ErrIdentityTaken):
+		return err
+	default:
+		log.Printf("link telegram account of user %d: %v", userID, err)
+		return nil
+	}
+}
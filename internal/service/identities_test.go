@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// stubTelegram proves ownership of the account in proof {"ok":"<id>"} and of
+// nothing else.
+type stubTelegram struct{}
+
+func (stubTelegram) CheckConfig(string) error { return nil }
+
+func (stubTelegram) Verify(ctx context.Context, req VerificationRequest) (Verdict, error) {
+	return Verdict{}, errors.New("not used")
+}
+
+func (stubTelegram) VerifyAccount(proof json.RawMessage) (string, error) {
+	var p struct{ OK string }
+	if json.Unmarshal(proof, &p) != nil || p.OK == "" {
+		return "", errors.New("proof isn't signed by Telegram")
+	}
+	return p.OK, nil
+}
+
+func TestLinkTelegramNeedsProof(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemory("local")
+	alice, bob := mustCreateUser(t, store, "alice"), mustCreateUser(t, store, "bob")
+	signed := json.RawMessage(`{"ok":"42"}`)
+
+	noBot := New(store, Config{Region: "local"})
+	if _, err := noBot.LinkIdentity(ctx, alice.ID, ProviderTelegram, "42", signed); !errors.Is(err, ErrTelegramUnavailable) {
+		t.Errorf("without a bot: err = %v, want ErrTelegramUnavailable", err)
+	}
+
+	s := New(store, Config{Region: "local", Verifiers: map[string]Verifier{ProviderTelegram: stubTelegram{}}})
+	var ve *ValidationError
+	if _, err := s.LinkIdentity(ctx, alice.ID, ProviderTelegram, "42", nil); !errors.As(err, &ve) {
+		t.Errorf("bare id: err = %v, want a validation error", err)
+	}
+	if _, err := s.LinkIdentity(ctx, alice.ID, ProviderTelegram, "43", signed); !errors.As(err, &ve) {
+		t.Errorf("id other than the proof's: err = %v, want a validation error", err)
+	}
+	id, err := s.LinkIdentity(ctx, alice.ID, ProviderTelegram, "", signed)
+	if err != nil || id.ExternalID != "42" || id.UserID != alice.ID {
+		t.Fatalf("signed: %+v, %v; want 42 linked to alice", id, err)
+	}
+	if _, err := s.LinkIdentity(ctx, bob.ID, ProviderTelegram, "", signed); !errors.Is(err, ErrIdentityTaken) {
+		t.Errorf("alice's account for bob: err = %v, want ErrIdentityTaken", err)
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// EventLevelUp is a user reaching a level for the first time.
+const EventLevelUp = "user.level_up"
+
+// AuditLevelBonus is the points paid for reaching a level.
+const AuditLevelBonus = "level.bonus"
+
+// levelFor is the level points put a user at, 0 with levels off.
+func (s *Service) levelFor(points int64) int {
+	if !s.cfg.LevelsEnabled {
+		return 0
+	}
+	// thresholds are increasing from 0; count those points has reached
+	return sort.Search(len(s.cfg.LevelThresholds), func(i int) bool { return s.cfg.LevelThresholds[i] > points })
+}
+
+// level is the user's level: the one their points put them at, or the
+// highest they have reached if that is higher, so spending points doesn't
+// cost a level.
+func (s *Service) level(l repository.UserLevel) int {
+	if !s.cfg.LevelsEnabled {
+		return 0
+	}
+	return max(l.Level, s.levelFor(l.Points))
+}
+
+// LevelStatus is where a user stands in the levels. Next is the points the
+// next level starts at, nil at the top level.
+type LevelStatus struct {
+	Level     int    `json:"level"`
+	Points    int64  `json:"points"`
+	Threshold int64  `json:"threshold"`
+	Next      *int64 `json:"next_threshold"`
+	// NextBonus is what reaching the next level pays.
+	NextBonus int64 `json:"next_bonus"`
+}
+
+func (s *Service) levelStatus(l repository.UserLevel) *LevelStatus {
+	n := s.level(l)
+	if n == 0 {
+		return nil
+	}
+	st := &LevelStatus{Level: n, Points: l.Points, Threshold: s.cfg.LevelThresholds[n-1]}
+	if n < len(s.cfg.LevelThresholds) {
+		next := s.cfg.LevelThresholds[n]
+		st.Next, st.NextBonus = &next, s.levelBonus(n+1)
+	}
+	return st
+}
+
+func (s *Service) levelBonus(level int) int64 {
+	if level-1 < len(s.cfg.LevelBonuses) {
+		return s.cfg.LevelBonuses[level-1]
+	}
+	return 0
+}
+
+// levelUp records the levels a balance of points takes userID to past the
+// highest they had reached: a user.level_up event for each, then its
+// bonus. A bonus can take them further, which is handled in turn. Level 1
+// is where everyone starts and is recorded without an event.
+func (s *Service) levelUp(ctx context.Context, q repository.Queries, userID, points int64) error {
+	level := s.levelFor(points)
+	if level == 0 {
+		return nil
+	}
+	levels, err := q.UserLevels(ctx, []int64{userID})
+	if err != nil {
+		return err
+	}
+	reached := levels[userID].Level
+	if level <= reached {
+		return nil
+	}
+	if err := q.RaiseUserLevel(ctx, userID, level); err != nil {
+		return err
+	}
+	for l := max(reached+1, 2); l <= level; l++ {
+		err := emit(ctx, q, EventLevelUp, map[string]any{
+			"user_id": userID, "level": l, "points": points, "bonus": s.levelBonus(l),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for l := max(reached+1, 2); l <= level; l++ {
+		if bonus := s.levelBonus(l); bonus > 0 {
+			err := s.accrue(ctx, q, AuditLevelBonus, userID, bonus, "level:"+strconv.Itoa(l), map[string]any{"level": l})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// withLevels sets the level of each user in items.
+func (s *Service) withLevels(ctx context.Context, q repository.Queries, items []repository.LeaderboardEntry) error {
+	if !s.cfg.LevelsEnabled || len(items) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(items))
+	for i, it := range items {
+		ids[i] = it.ID
+	}
+	levels, err := q.UserLevels(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if l, ok := levels[items[i].ID]; ok {
+			items[i].Level = s.level(l)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Live message types, in the order a stream sees them: one snapshot, then
+// leaderboard deltas and rank notifications as points change.
+const (
+	LiveSnapshot    = "snapshot"
+	LiveLeaderboard = "leaderboard"
+	LiveRank        = "rank"
+)
+
+type LiveMessage struct {
+	Type string
+	Data any
+}
+
+type LiveSnapshotData struct {
+	Leaderboard []repository.LeaderboardEntry `json:"leaderboard"`
+	Total       int64                         `json:"total"`
+	Rank        Rank                          `json:"rank"`
+}
+
+// LeaderboardDelta lists top entries that are new or whose rank or points
+// changed, and users who dropped out of the top.
+type LeaderboardDelta struct {
+	Changed []repository.LeaderboardEntry `json:"changed"`
+	Removed []int64                       `json:"removed"`
+	Total   int64                         `json:"total"`
+}
+
+// RankChange tells a subscriber they moved up the lifetime leaderboard.
+type RankChange struct {
+	Rank     int    `json:"rank"`
+	Previous int    `json:"previous"`
+	Points   int64  `json:"points"`
+	Message  string `json:"message"`
+}
+
+// liveBuffer is how many messages a subscriber may fall behind before it is
+// dropped; it reconnects and starts over from a snapshot.
+const liveBuffer = 16
+
+type Subscription struct {
+	UserID int64
+	C      <-chan LiveMessage
+	c      chan LiveMessage
+	rank   int
+}
+
+// LeaderboardHub feeds live leaderboard streams. It is a Publisher: every
+// points.adjusted, user.deleted, user.restored and user.settings_updated
+// event marks the board dirty, and Run recomputes it at
+// most once per interval, so a burst of completions costs one refresh.
+type LeaderboardHub struct {
+	svc      *Service
+	top      int
+	interval time.Duration
+	dirty    chan struct{}
+
+	mu    sync.Mutex
+	subs  map[*Subscription]struct{}
+	board []repository.LeaderboardEntry
+}
+
+func NewLeaderboardHub(svc *Service, top int, interval time.Duration) *LeaderboardHub {
+	return &LeaderboardHub{
+		svc:      svc,
+		top:      top,
+		interval: interval,
+		dirty:    make(chan struct{}, 1),
+		subs:     map[*Subscription]struct{}{},
+	}
+}
+
+func (h *LeaderboardHub) Publish(ctx context.Context, ev Event) error {
+	switch ev.Type {
+	case EventPointsChanged, EventUserDeleted, EventUserRestored, EventSettingsUpdated, EventUserMerged:
+	default:
+		return nil
+	}
+	select {
+	case h.dirty <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Subscribe registers a stream for userID and returns its first message.
+func (h *LeaderboardHub) Subscribe(ctx context.Context, userID int64) (*Subscription, LiveMessage, error) {
+	rank, err := h.svc.UserRank(ctx, userID, "all")
+	if err != nil {
+		return nil, LiveMessage{}, err
+	}
+	page, err := h.svc.Leaderboard(ctx, "all", h.top, nil)
+	if err != nil {
+		return nil, LiveMessage{}, err
+	}
+	c := make(chan LiveMessage, liveBuffer)
+	sub := &Subscription{UserID: userID, C: c, c: c, rank: rank.Rank}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	snap := LiveSnapshotData{Leaderboard: page.Items, Total: page.Total, Rank: rank}
+	return sub, LiveMessage{Type: LiveSnapshot, Data: snap}, nil
+}
+
+// Unsubscribe closes sub.C unless the hub already has.
+func (h *LeaderboardHub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(sub)
+}
+
+func (h *LeaderboardHub) drop(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Run refreshes subscribers until ctx is cancelled, then closes every
+// stream so the server can drain.
+func (h *LeaderboardHub) Run(ctx context.Context) {
+	defer func() {
+		h.mu.Lock()
+		for sub := range h.subs {
+			h.drop(sub)
+		}
+		h.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.dirty:
+		}
+		if err := h.refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("leaderboard stream: refresh: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.interval):
+		}
+	}
+}
+
+func (h *LeaderboardHub) refresh(ctx context.Context) error {
+	page, err := h.svc.Leaderboard(ctx, "all", h.top, nil)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	delta := diffBoard(h.board, page.Items)
+	h.board = page.Items
+	subs := make([]*Subscription, 0, len(h.subs))
+	for sub := range h.subs {
+		subs = append(subs, sub)
+	}
+	if len(delta.Changed) > 0 || len(delta.Removed) > 0 {
+		delta.Total = page.Total
+		for _, sub := range subs {
+			h.send(sub, LiveMessage{Type: LiveLeaderboard, Data: delta})
+		}
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		rank, err := h.svc.UserRank(ctx, sub.UserID, "all")
+		if err != nil {
+			return err
+		}
+		h.mu.Lock()
+		if _, ok := h.subs[sub]; ok {
+			if rank.Rank < sub.rank {
+				h.send(sub, LiveMessage{Type: LiveRank, Data: RankChange{
+					Rank:     rank.Rank,
+					Previous: sub.rank,
+					Points:   rank.Points,
+					Message:  fmt.Sprintf("you moved up to rank %d", rank.Rank),
+				}})
+			}
+			sub.rank = rank.Rank
+		}
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+// send must be called with h.mu held. A subscriber that isn't keeping up
+// is dropped rather than allowed to stall the others.
+func (h *LeaderboardHub) send(sub *Subscription, msg LiveMessage) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	select {
+	case sub.c <- msg:
+	default:
+		h.drop(sub)
+	}
+}
+
+func diffBoard(prev, cur []repository.LeaderboardEntry) LeaderboardDelta {
+	old := make(map[int64]repository.LeaderboardEntry, len(prev))
+	for _, e := range prev {
+		old[e.ID] = e
+	}
+	d := LeaderboardDelta{Changed: []repository.LeaderboardEntry{}, Removed: []int64{}}
+	for _, e := range cur {
+		if o, ok := old[e.ID]; !ok || o != e {
+			d.Changed = append(d.Changed, e)
+		}
+		delete(old, e.ID)
+	}
+	for _, e := range prev {
+		if _, ok := old[e.ID]; ok {
+			d.Removed = append(d.Removed, e.ID)
+		}
+	}
+	return d
+}
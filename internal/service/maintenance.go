@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermMaintenanceManage allows reading and setting maintenance mode.
+const PermMaintenanceManage = "maintenance:manage"
+
+const (
+	AuditMaintenanceSet     = "maintenance.set"
+	AuditMaintenanceCleared = "maintenance.cleared"
+)
+
+// MaxMaintenanceMessage caps the message shown to refused clients.
+const MaxMaintenanceMessage = 500
+
+// Maintenance is whether the API refuses writes, as it applies now. Source
+// is "config" for Config.Maintenance and "override" for a mode set at
+// runtime. RetryAfter is in seconds.
+type Maintenance struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message"`
+	RetryAfter int        `json:"retry_after"`
+	Source     string     `json:"source"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// MaintenanceInput sets maintenance mode at runtime; Message and
+// RetryAfter default to the configured ones.
+type MaintenanceInput struct {
+	Enabled    bool    `json:"enabled"`
+	Message    *string `json:"message"`
+	RetryAfter *int    `json:"retry_after"`
+}
+
+// maintenanceCache holds the override as last loaded, so the check in
+// front of every write doesn't cost a query. It is reloaded like the flag
+// overrides, once Config.FlagsRefresh old.
+type maintenanceCache struct {
+	mu       sync.Mutex
+	loadedAt time.Time
+	loaded   bool
+	override *repository.Maintenance
+}
+
+// maintenance is the configured mode, replaced by o when one is set.
+func (s *Service) maintenance(o *repository.Maintenance) Maintenance {
+	m := s.cfg.Maintenance
+	m.Source = "config"
+	if o != nil {
+		at := o.UpdatedAt
+		m.Enabled, m.Message, m.RetryAfter, m.Source, m.UpdatedAt = o.Enabled, o.Message, o.RetryAfter, "override", &at
+	}
+	return m
+}
+
+func loadMaintenance(ctx context.Context, q repository.MaintenanceStore) (*repository.Maintenance, error) {
+	o, err := q.Maintenance(ctx)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// MaintenanceMode is the mode writes are checked against, from the cached
+// override. If reloading it fails the stale one is kept, so a database
+// hiccup doesn't toggle maintenance.
+func (s *Service) MaintenanceMode(ctx context.Context) Maintenance {
+	c := &s.maintenanceCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded || s.now().Sub(c.loadedAt) >= s.cfg.FlagsRefresh {
+		o, err := loadMaintenance(ctx, s.store)
+		if err != nil {
+			log.Printf("load maintenance mode: %v", err)
+		} else {
+			c.override, c.loaded, c.loadedAt = o, true, s.now()
+		}
+	}
+	return s.maintenance(c.override)
+}
+
+// GetMaintenance is the current mode, read fresh.
+func (s *Service) GetMaintenance(ctx context.Context) (Maintenance, error) {
+	o, err := loadMaintenance(ctx, s.store)
+	if err != nil {
+		return Maintenance{}, err
+	}
+	return s.maintenance(o), nil
+}
+
+// SetMaintenance turns maintenance mode on or off on every instance within
+// Config.FlagsRefresh, and on this one right away.
+func (s *Service) SetMaintenance(ctx context.Context, in MaintenanceInput) (Maintenance, error) {
+	o := repository.Maintenance{Enabled: in.Enabled, Message: s.cfg.Maintenance.Message, RetryAfter: s.cfg.Maintenance.RetryAfter}
+	if in.Message != nil {
+		o.Message = *in.Message
+	}
+	if in.RetryAfter != nil {
+		o.RetryAfter = *in.RetryAfter
+	}
+	if len(o.Message) > MaxMaintenanceMessage {
+		return Maintenance{}, invalid("message must be at most 500 bytes")
+	}
+	if o.RetryAfter < 0 {
+		return Maintenance{}, invalid("retry_after must be >= 0")
+	}
+	var after Maintenance
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := loadMaintenance(ctx, q)
+		if err != nil {
+			return err
+		}
+		set, err := q.SetMaintenance(ctx, o)
+		if err != nil {
+			return err
+		}
+		after = s.maintenance(&set)
+		return audit(ctx, q, AuditMaintenanceSet, "maintenance", "", s.maintenance(before), after)
+	})
+	if err == nil {
+		s.expireMaintenance()
+	}
+	return after, err
+}
+
+// ClearMaintenance drops the override, putting maintenance mode back to
+// the configured one.
+func (s *Service) ClearMaintenance(ctx context.Context) (Maintenance, error) {
+	after := s.maintenance(nil)
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := loadMaintenance(ctx, q)
+		if err != nil || before == nil {
+			return err
+		}
+		if err := q.ClearMaintenance(ctx); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditMaintenanceCleared, "maintenance", "", s.maintenance(before), after)
+	})
+	if err == nil {
+		s.expireMaintenance()
+	}
+	return after, err
+}
+
+// expireMaintenance has the next check reload the override.
+func (s *Service) expireMaintenance() {
+	s.maintenanceCache.mu.Lock()
+	s.maintenanceCache.loaded = false
+	s.maintenanceCache.mu.Unlock()
+}
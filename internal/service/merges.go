@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// AuditUserMerged is a duplicate account merged into the one audited.
+const AuditUserMerged = "user.merged"
+
+// EventUserMerged is a duplicate account merged into another.
+const EventUserMerged = "user.merged"
+
+// DuplicateUser is another account that may belong to the same person:
+// Emails are the addresses it has in common with the one looked up.
+type DuplicateUser struct {
+	User   repository.User `json:"user"`
+	Emails []string        `json:"emails"`
+}
+
+// DuplicateUsers lists the users who share an email address with id,
+// through a linked account or an email channel, by id.
+func (s *Service) DuplicateUsers(ctx context.Context, id int64) ([]DuplicateUser, error) {
+	if _, err := s.getUser(ctx, id); err != nil {
+		return nil, err
+	}
+	matches, err := s.store.DuplicateMatches(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	out := []DuplicateUser{}
+	for _, m := range matches {
+		if n := len(out); n > 0 && out[n-1].User.ID == m.UserID {
+			out[n-1].Emails = append(out[n-1].Emails, m.Email)
+			continue
+		}
+		u, err := s.store.GetUser(ctx, m.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, DuplicateUser{User: u, Emails: []string{m.Email}})
+	}
+	return out, nil
+}
+
+// Merge is the outcome of MergeUsers.
+type Merge struct {
+	User         repository.User        `json:"user"`
+	MergedUserID int64                  `json:"merged_user_id"`
+	Moved        repository.MergeCounts `json:"moved"`
+	// Revoked are the duplicate's completions that would have taken the
+	// user past a task's per-user limit.
+	Revoked []Revocation `json:"revoked"`
+}
+
+// MergeUsers folds the duplicate account from into into and deletes it,
+// in one transaction: see repository.MergeStore for what moves. Where
+// both completed a task more often between them than it allows, the
+// duplicate's latest completions are revoked and what they awarded is
+// debited after the balances are added up, as RevokeTask would. into
+// keeps the higher level either reached without a second bonus, and its
+// own streak. The duplicate is deleted as by DeleteUser, so an admin can
+// restore it, empty, within Config.DeletionGrace.
+func (s *Service) MergeUsers(ctx context.Context, into, from int64) (Merge, error) {
+	if into == from {
+		return Merge{}, invalid("a user can't be merged into themselves")
+	}
+	m := Merge{MergedUserID: from, Revoked: []Revocation{}}
+	reason := "merged from user " + strconv.FormatInt(from, 10)
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		m.Revoked = m.Revoked[:0]
+		before, err := q.GetUser(ctx, into)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := q.GetUser(ctx, from); errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+
+		completed, err := q.ListCompletedTasks(ctx, from)
+		if err != nil {
+			return err
+		}
+		codes := make([]string, len(completed))
+		for i, c := range completed {
+			codes[i] = c.Code
+		}
+		slices.Sort(codes)
+		for _, code := range slices.Compact(codes) {
+			revoked, err := revokeOverLimit(ctx, q, into, from, code)
+			if err != nil {
+				return err
+			}
+			m.Revoked = append(m.Revoked, revoked...)
+		}
+
+		levels, err := q.UserLevels(ctx, []int64{from})
+		if err != nil {
+			return err
+		}
+		m.Moved, err = q.MergeUsers(ctx, from, into)
+		if errors.Is(err, repository.ErrNegativeBalance) {
+			return ErrInsufficientPoints
+		}
+		if err != nil {
+			return err
+		}
+		if m.Moved.Points != 0 {
+			for _, c := range []struct {
+				id    int64
+				delta int64
+			}{{from, -m.Moved.Points}, {into, m.Moved.Points}} {
+				u, err := q.GetUser(ctx, c.id)
+				if err != nil {
+					return err
+				}
+				if err := pointsChanged(ctx, q, c.id, c.delta, u.Points, reason); err != nil {
+					return err
+				}
+			}
+		}
+		for i := range m.Revoked {
+			rev := &m.Revoked[i]
+			rev.UserID, rev.Reason = into, reason
+			if err := s.accrue(ctx, q, AuditTaskRevoked, into, -rev.Debited, "task_revoked:"+rev.Task, map[string]any{
+				"task": rev.Task, "reason": reason,
+			}); err != nil {
+				return err
+			}
+			if err := emit(ctx, q, EventTaskRevoked, *rev); err != nil {
+				return err
+			}
+		}
+		if l := levels[from].Level; l > 0 {
+			if err := q.RaiseUserLevel(ctx, into, l); err != nil {
+				return err
+			}
+		}
+		if m.User, err = q.GetUser(ctx, into); err != nil {
+			return err
+		}
+		if err := s.levelUp(ctx, q, into, m.User.Points); err != nil {
+			return err
+		}
+		if err := deleteUser(ctx, q, from); err != nil {
+			return err
+		}
+		if m.User, err = q.GetUser(ctx, into); err != nil {
+			return err
+		}
+		err = audit(ctx, q, AuditUserMerged, "user", userTarget(into), map[string]any{"points": before.Points}, map[string]any{
+			"points": m.User.Points, "merged_user_id": from, "moved": m.Moved, "revoked": len(m.Revoked),
+		})
+		if err != nil {
+			return err
+		}
+		return emit(ctx, q, EventUserMerged, map[string]any{
+			"user_id": into, "merged_user_id": from, "points": m.Moved.Points,
+		})
+	})
+	if err != nil {
+		return Merge{}, err
+	}
+	s.dropCachedUsers(ctx, from)
+	s.RefreshCachedPoints(ctx, into)
+	return m, nil
+}
+
+// revokeOverLimit revokes from's latest completions of code that into's
+// would leave over the task's per-user limit, and returns what each
+// awarded, newest first.
+func revokeOverLimit(ctx context.Context, q repository.Queries, into, from int64, code string) ([]Revocation, error) {
+	task, err := q.GetTask(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := q.CountUserTask(ctx, from, code)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := q.CountUserTask(ctx, into, code)
+	if err != nil {
+		return nil, err
+	}
+	over := min(ours+theirs-task.MaxCompletionsPerUser, theirs)
+	if over <= 0 {
+		return nil, nil
+	}
+	awards, err := standingAwards(ctx, q, from, task)
+	if err != nil {
+		return nil, err
+	}
+	var out []Revocation
+	for range over {
+		if err := q.RevokeUserTask(ctx, from, code); err != nil {
+			return nil, err
+		}
+		debit := task.Points
+		if n := len(awards); n > 0 {
+			debit, awards = awards[n-1], awards[:n-1]
+		}
+		out = append(out, Revocation{Task: code, Debited: debit})
+	}
+	return out, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Merging bob, a duplicate of alice who alice referred, into her: the task
+// both completed is revoked once, bob's ledger continues alice's stream,
+// and neither ends up having referred herself.
+func TestMergeUsers(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := New(store, Config{Region: "local"})
+			alice, bob, carol := mustCreateUser(t, store, "alice"), mustCreateUser(t, store, "bob"), mustCreateUser(t, store, "carol")
+
+			for _, c := range []struct {
+				user int64
+				task string
+			}{{alice.ID, "subscribe_telegram"}, {bob.ID, "subscribe_telegram"}, {bob.ID, "subscribe_twitter"}} {
+				if _, err := s.CompleteTask(ctx, c.user, c.task, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Accrue(ctx, alice.ID, 5, "bonus"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.SetReferrer(ctx, bob.ID, alice.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.SetReferrer(ctx, carol.ID, bob.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := s.MergeUsers(ctx, alice.ID, bob.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Revoked) != 1 || m.Revoked[0].Task != "subscribe_telegram" || m.Revoked[0].Debited != 20 {
+				t.Errorf("revoked %+v, want bob's subscribe_telegram for 20", m.Revoked)
+			}
+			if m.Moved.Points != 40 || m.Moved.LedgerEntries != 2 {
+				t.Errorf("moved %+v, want 40 points in 2 entries", m.Moved)
+			}
+			// 20 + 5 of her own, 40 of bob's, less the 20 revoked
+			if m.User.Points != 45 || points(t, store, alice.ID) != 45 {
+				t.Errorf("alice has %d points, want 45", m.User.Points)
+			}
+			if n, err := store.CountUserTask(ctx, alice.ID, "subscribe_telegram"); err != nil || n != 1 {
+				t.Errorf("alice completed subscribe_telegram %d times, want 1 (%v)", n, err)
+			}
+
+			// bob's entries keep their ids, so the stream is in seq order: it
+			// is numbered from 1 without gaps, and every balance is the one
+			// before plus the amount
+			entries, err := s.PointsHistory(ctx, alice.ID, 0, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 5 {
+				t.Fatalf("alice has %d ledger entries, want 5: %+v", len(entries), entries)
+			}
+			slices.SortFunc(entries, func(a, b repository.LedgerEntry) int { return cmp.Compare(a.Seq, b.Seq) })
+			var balance int64
+			for i, e := range entries {
+				if want := int64(i + 1); e.Seq != want {
+					t.Errorf("entry %q has seq %d, want %d", e.Reason, e.Seq, want)
+				}
+				balance += e.Amount
+				if e.Balance != balance {
+					t.Errorf("entry %d (%q) left %d, want %d", e.Seq, e.Reason, e.Balance, balance)
+				}
+			}
+			if balance != 45 {
+				t.Errorf("ledger adds up to %d, want 45", balance)
+			}
+
+			a, err := store.GetUser(ctx, alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.ReferrerID != nil {
+				t.Errorf("alice's referrer is %d, want none", *a.ReferrerID)
+			}
+			refs, err := store.ListReferrals(ctx, alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range refs {
+				if r.ReferrerID == r.ReferredID {
+					t.Errorf("alice has a referral of herself: %+v", r)
+				}
+			}
+			c, err := store.GetUser(ctx, carol.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.ReferrerID == nil || *c.ReferrerID != alice.ID {
+				t.Errorf("carol's referrer is %v, want alice", c.ReferrerID)
+			}
+		})
+	}
+}
+
+// Every change to a balance, whether accrued, adjusted or merged, is a
+// points.changed that continues the user's previous one; only the admin's
+// adjustment is also a points.adjusted.
+func TestPointsChangedOnEveryBalanceChange(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := New(store, Config{Region: "local"})
+			alice, bob := mustCreateUser(t, store, "alice"), mustCreateUser(t, store, "bob")
+
+			for _, c := range []struct {
+				user int64
+				task string
+			}{{alice.ID, "subscribe_telegram"}, {bob.ID, "subscribe_telegram"}, {bob.ID, "subscribe_twitter"}} {
+				if _, err := s.CompleteTask(ctx, c.user, c.task, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.AdjustPoints(ctx, alice.ID, 5, "goodwill", nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.MergeUsers(ctx, alice.ID, bob.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			events, err := store.ClaimOutboxEvents(ctx, 100, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			type change struct {
+				UserID  int64 `json:"user_id"`
+				Delta   int64 `json:"delta"`
+				Balance int64 `json:"balance"`
+			}
+			balances, changes, adjusted := map[int64]int64{}, map[int64]int{}, 0
+			for _, e := range events {
+				switch e.Type {
+				case EventPointsAdjusted:
+					adjusted++
+				case EventPointsChanged:
+					var c change
+					if err := json.Unmarshal(e.Data, &c); err != nil {
+						t.Fatal(err)
+					}
+					if c.Balance != balances[c.UserID]+c.Delta {
+						t.Errorf("user %d: balance %d after %+d, want %d", c.UserID, c.Balance, c.Delta, balances[c.UserID]+c.Delta)
+					}
+					balances[c.UserID] = c.Balance
+					changes[c.UserID]++
+				}
+			}
+			if adjusted != 1 {
+				t.Errorf("%d points.adjusted, want 1", adjusted)
+			}
+			// alice: her task, the adjustment, bob's points and the revocation;
+			// bob: his two tasks and the move
+			if changes[alice.ID] != 4 || changes[bob.ID] != 3 {
+				t.Errorf("points.changed: %d for alice and %d for bob, want 4 and 3", changes[alice.ID], changes[bob.ID])
+			}
+			if balances[alice.ID] != 45 || balances[bob.ID] != 0 {
+				t.Errorf("last balances: alice %d, bob %d; want 45 and 0", balances[alice.ID], balances[bob.ID])
+			}
+		})
+	}
+}
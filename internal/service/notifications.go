@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Notification kinds.
+const (
+	NotifyPointsAwarded      = "points_awarded"
+	NotifyRankChanged        = "rank_changed"
+	NotifyTaskRevoked        = "task_revoked"
+	NotifySubmissionReviewed = "submission_reviewed"
+)
+
+var ErrChannelNotFound = newError("CHANNEL_NOT_FOUND", "notification channel not found")
+
+const (
+	// maxNotificationsPage is the most notifications listed at once.
+	maxNotificationsPage = 200
+	notificationBatch    = 50
+	// notificationTimeout bounds a single send on any channel.
+	notificationTimeout = 30 * time.Second
+)
+
+// NotificationChannel delivers notifications outside the app, to an
+// address the user gave: an email address, a push token. Send returns an
+// error when the notification should be retried.
+type NotificationChannel interface {
+	CheckAddress(address string) error
+	Send(ctx context.Context, address string, n repository.Notification) error
+}
+
+// NotificationPage is a page of a user's notifications with the count of
+// all their unread ones.
+type NotificationPage struct {
+	Notifications []repository.Notification `json:"notifications"`
+	Unread        int64                     `json:"unread"`
+}
+
+// Notifications pages through the user's notifications, newest first.
+func (s *Service) Notifications(ctx context.Context, userID int64, unreadOnly bool, before int64, limit int) (NotificationPage, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return NotificationPage{}, err
+	}
+	if limit <= 0 || limit > maxNotificationsPage {
+		limit = maxNotificationsPage
+	}
+	items, err := s.store.ListNotifications(ctx, userID, unreadOnly, before, limit)
+	if err != nil {
+		return NotificationPage{}, err
+	}
+	unread, err := s.store.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return NotificationPage{}, err
+	}
+	return NotificationPage{Notifications: items, Unread: unread}, nil
+}
+
+// MarkNotificationsRead marks the user's notifications with ids read, or
+// all of them when ids is nil, and returns how many were unread.
+func (s *Service) MarkNotificationsRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	if len(ids) > maxNotificationsPage {
+		return 0, invalid("ids must list at most 200 notifications")
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return 0, err
+	}
+	return s.store.MarkNotificationsRead(ctx, userID, ids)
+}
+
+// ChannelSettings are where a user has notifications sent, and the
+// channels this server can send on.
+type ChannelSettings struct {
+	Channels  []repository.ChannelSetting `json:"channels"`
+	Available []string                    `json:"available"`
+}
+
+func (s *Service) ChannelSettings(ctx context.Context, userID int64) (ChannelSettings, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return ChannelSettings{}, err
+	}
+	settings, err := s.store.ListChannelSettings(ctx, userID)
+	if err != nil {
+		return ChannelSettings{}, err
+	}
+	available := []string{}
+	for name := range s.cfg.Channels {
+		available = append(available, name)
+	}
+	slices.Sort(available)
+	return ChannelSettings{Channels: settings, Available: available}, nil
+}
+
+// ChannelInput sets where a channel sends. Enabled defaults to true; a
+// disabled channel keeps its address but gets nothing new.
+type ChannelInput struct {
+	Address string `json:"address"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// SetChannelSetting points the user's notifications on channel at
+// in.Address. Notifications already made are not sent there.
+func (s *Service) SetChannelSetting(ctx context.Context, userID int64, channel string, in ChannelInput) (repository.ChannelSetting, error) {
+	ch, ok := s.cfg.Channels[channel]
+	if !ok {
+		return repository.ChannelSetting{}, ErrChannelNotFound
+	}
+	in.Address = strings.TrimSpace(in.Address)
+	if in.Address == "" || len(in.Address) > 512 {
+		return repository.ChannelSetting{}, invalid("address must be 1 to 512 characters")
+	}
+	if err := ch.CheckAddress(in.Address); err != nil {
+		return repository.ChannelSetting{}, invalid(err.Error())
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return repository.ChannelSetting{}, err
+	}
+	c := repository.ChannelSetting{Channel: channel, Address: in.Address, Enabled: in.Enabled == nil || *in.Enabled}
+	return s.store.SetChannelSetting(ctx, userID, c)
+}
+
+// DeleteChannelSetting stops the user's notifications on channel and
+// forgets the address.
+func (s *Service) DeleteChannelSetting(ctx context.Context, userID int64, channel string) error {
+	if channel == "" {
+		return ErrChannelNotFound
+	}
+	err := s.store.DeleteChannelSetting(ctx, userID, channel)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrChannelNotFound
+	}
+	return err
+}
+
+// Notifier is a Publisher that turns outbox events into notifications:
+// points awarded, a climb into the top Config.NotifyRankTop of the lifetime
+// leaderboard, a revoked completion and a reviewed submission. Each event
+// makes a notification of a kind at most once, so republishing is safe.
+type Notifier struct {
+	svc *Service
+}
+
+func NewNotifier(svc *Service) *Notifier {
+	return &Notifier{svc: svc}
+}
+
+func (n *Notifier) Publish(ctx context.Context, ev Event) error {
+	var data struct {
+		UserID int64 `json:"user_id"`
+	}
+	switch ev.Type {
+	case EventPointsChanged, EventTaskRevoked, EventSubmissionReviewed:
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	// deleted users get nothing
+	if _, err := n.svc.store.GetUser(ctx, data.UserID); errors.Is(err, repository.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	notes, err := n.svc.notificationsFor(ctx, ev)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		note.UserID, note.EventID = data.UserID, ev.ID
+		if note.Data == nil {
+			note.Data = ev.Data
+		}
+		if _, err := n.svc.store.AddNotification(ctx, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) notificationsFor(ctx context.Context, ev Event) ([]repository.Notification, error) {
+	switch ev.Type {
+	case EventPointsChanged:
+		var d struct {
+			UserID  int64  `json:"user_id"`
+			Delta   int64  `json:"delta"`
+			Balance int64  `json:"balance"`
+			Reason  string `json:"reason"`
+		}
+		if err := json.Unmarshal(ev.Data, &d); err != nil {
+			return nil, err
+		}
+		if d.Delta <= 0 {
+			return nil, nil
+		}
+		notes := []repository.Notification{{
+			Kind:  NotifyPointsAwarded,
+			Title: fmt.Sprintf("You earned %d points", d.Delta),
+			Body:  s.awardBody(ctx, d.Reason),
+		}}
+		rank, err := s.rankChange(ctx, d.UserID, d.Balance-d.Delta, d.Balance)
+		if err != nil || rank == nil {
+			return notes, err
+		}
+		return append(notes, *rank), nil
+
+	case EventTaskRevoked:
+		var rev Revocation
+		if err := json.Unmarshal(ev.Data, &rev); err != nil {
+			return nil, err
+		}
+		body := fmt.Sprintf("Your completion of %s was revoked and %d points were taken back.", s.taskTitle(ctx, rev.Task), rev.Debited)
+		if rev.Reason != "" {
+			body += " Reason: " + rev.Reason
+		}
+		return []repository.Notification{{Kind: NotifyTaskRevoked, Title: "Task completion revoked", Body: body}}, nil
+
+	case EventSubmissionReviewed:
+		var sub struct {
+			Task   string `json:"task"`
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		}
+		if err := json.Unmarshal(ev.Data, &sub); err != nil {
+			return nil, err
+		}
+		title := s.taskTitle(ctx, sub.Task)
+		if sub.Status == repository.SubmissionApproved {
+			return []repository.Notification{{Kind: NotifySubmissionReviewed, Title: "Submission approved",
+				Body: fmt.Sprintf("Your proof for %s was approved.", title)}}, nil
+		}
+		body := fmt.Sprintf("Your proof for %s was rejected.", title)
+		if sub.Reason != "" {
+			body += " Reason: " + sub.Reason
+		}
+		return []repository.Notification{{Kind: NotifySubmissionReviewed, Title: "Submission rejected", Body: body}}, nil
+	}
+	return nil, nil
+}
+
+// awardBody says what a ledger reason awarded points for.
+func (s *Service) awardBody(ctx context.Context, reason string) string {
+	switch kind, rest, _ := strings.Cut(reason, ":"); {
+	case kind == "task":
+		return "For completing " + s.taskTitle(ctx, rest) + "."
+	case reason == "referral:referrer":
+		return "For inviting a new user."
+	case reason == "referral:referred":
+		return "For joining with an invite."
+	case kind == "checkin":
+		return "For checking in today."
+	case reason == "admin_adjustment":
+		return "Added by an admin."
+	case reason == "seed":
+		return "Your starting balance."
+	case strings.HasPrefix(reason, "transfer:from:"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(reason, "transfer:from:"), 10, 64)
+		if u, err := s.store.GetUser(ctx, id); err == nil {
+			return "Sent to you by " + u.Username + "."
+		}
+		return "Sent to you by another user."
+	}
+	return ""
+}
+
+// taskTitle is the task's untranslated title, or its code when it is gone.
+func (s *Service) taskTitle(ctx context.Context, code string) string {
+	if t, err := s.store.GetTask(ctx, code); err == nil && t.Title != "" {
+		return t.Title
+	}
+	return code
+}
+
+// rankChange is a rank_changed notification when going from before to
+// after points took the user into the top NotifyRankTop of the lifetime
+// leaderboard, or up within it. Users hidden from leaderboards have no
+// rank to tell them about.
+func (s *Service) rankChange(ctx context.Context, userID, before, after int64) (*repository.Notification, error) {
+	if s.cfg.NotifyRankTop <= 0 {
+		return nil, nil
+	}
+	st, err := s.store.GetSettings(ctx, userID)
+	if err != nil || st.LeaderboardVisibility == repository.VisibilityHidden {
+		return nil, err
+	}
+	u, err := s.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Rank counts the user's own row when their current points beat the
+	// ones asked about
+	rankAt := func(points int64) (int, error) {
+		pos, _, err := s.store.Rank(ctx, "all", userID, points)
+		if u.Points > points {
+			pos--
+		}
+		return pos, err
+	}
+	prev, err := rankAt(before)
+	if err != nil {
+		return nil, err
+	}
+	rank, err := rankAt(after)
+	if err != nil || rank >= prev || rank > s.cfg.NotifyRankTop {
+		return nil, err
+	}
+	data, err := json.Marshal(RankChange{Rank: rank, Previous: prev, Points: after})
+	if err != nil {
+		return nil, err
+	}
+	return &repository.Notification{
+		Kind:  NotifyRankChanged,
+		Title: fmt.Sprintf("You moved up to rank %d", rank),
+		Body:  fmt.Sprintf("You were rank %d on the all-time leaderboard.", prev),
+		Data:  data,
+	}, nil
+}
+
+// NotificationDispatcher sends queued notification deliveries on their
+// channels. Several instances can run against one database; each delivery
+// is claimed by one of them.
+type NotificationDispatcher struct {
+	store       repository.NotificationStore
+	channels    map[string]NotificationChannel
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewNotificationDispatcher polls every interval. A failed send is retried
+// after backoff, doubling each time up to an hour, until maxAttempts.
+func NewNotificationDispatcher(store repository.NotificationStore, channels map[string]NotificationChannel, interval, backoff time.Duration, maxAttempts int) *NotificationDispatcher {
+	return &NotificationDispatcher{store: store, channels: channels, interval: interval, backoff: backoff, maxAttempts: maxAttempts}
+}
+
+func (d *NotificationDispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		for {
+			// the lease outlasts a batch of timed-out sends
+			batch, err := d.store.ClaimNotificationDeliveries(ctx, notificationBatch, notificationBatch*notificationTimeout+time.Minute)
+			if err != nil {
+				log.Printf("notifications: claim deliveries: %v", err)
+				break
+			}
+			for _, p := range batch {
+				if err := d.store.RecordNotificationAttempt(ctx, p.ID, d.send(ctx, p)); err != nil {
+					log.Printf("notifications: record delivery %d: %v", p.ID, err)
+				}
+			}
+			if len(batch) < notificationBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// send gives up at once on a channel this server no longer has.
+func (d *NotificationDispatcher) send(ctx context.Context, p repository.PendingNotification) repository.NotificationAttempt {
+	ch, ok := d.channels[p.Channel]
+	if !ok {
+		return repository.NotificationAttempt{Error: "channel not configured"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, notificationTimeout)
+	defer cancel()
+	err := ch.Send(ctx, p.Address, p.Notification)
+	if err == nil {
+		return repository.NotificationAttempt{Sent: true}
+	}
+	a := repository.NotificationAttempt{Error: err.Error()}
+	if attempt := p.Attempts + 1; attempt < d.maxAttempts {
+		a.RetryIn = min(d.backoff<<(attempt-1), time.Hour)
+	}
+	return a
+}
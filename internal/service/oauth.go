@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var (
+	ErrProviderNotFound = newError("PROVIDER_NOT_FOUND", "login provider not found")
+	ErrOAuthState       = newError("OAUTH_STATE_INVALID", "login expired or was started elsewhere; start it again")
+	ErrOAuthFailed      = newError("OAUTH_FAILED", "login provider rejected the sign-in")
+	ErrIdentityTaken    = newError("IDENTITY_TAKEN", "that account is linked to another user")
+	ErrProviderLinked   = newError("PROVIDER_LINKED", "user already has an account from this provider linked")
+)
+
+const AuditIdentityLinked = "user.identity_linked"
+
+// oauthStateTTL is how long a user has to finish signing in at the
+// provider.
+const oauthStateTTL = 10 * time.Minute
+
+// OAuthIdentity is who a provider says signed in. Subject is its stable id
+// for the account; Username is a suggestion for new users.
+type OAuthIdentity struct {
+	Subject  string
+	Email    string
+	Username string
+}
+
+// OAuthProvider runs the authorization code flow with one provider.
+// Exchange trades the code the provider redirected back with for the
+// account it belongs to; it returns ErrOAuthFailed when the provider
+// refuses the code.
+type OAuthProvider interface {
+	AuthURL(state, redirectURI string) string
+	Exchange(ctx context.Context, code, redirectURI string) (OAuthIdentity, error)
+}
+
+// OAuthResult is the outcome of a callback: a sign-in, with tokens and
+// Created set for a new user, or a link to the user who started it.
+type OAuthResult struct {
+	UserID  int64
+	Created bool
+	Linked  bool
+	Tokens  TokenPair
+}
+
+type oauthState struct {
+	Provider string `json:"p"`
+	Nonce    string `json:"n"`
+	UserID   int64  `json:"u,omitempty"`
+	Expires  int64  `json:"e"`
+}
+
+func (s *Service) oauthRedirectURI(provider string) string {
+	return strings.TrimRight(s.cfg.OAuthRedirectBaseURL, "/") + "/auth/" + provider + "/callback"
+}
+
+func signState(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("oauth-state." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// StartOAuth begins signing in with provider, or linking it to linkUserID
+// when that is set. It returns the provider URL to send the browser to and
+// a nonce the callback must be handed back, so a login started in one
+// browser can't be finished in another.
+func (s *Service) StartOAuth(provider string, linkUserID int64) (authURL, nonce string, err error) {
+	p, ok := s.cfg.OAuthProviders[provider]
+	if !ok {
+		return "", "", ErrProviderNotFound
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	nonce = hex.EncodeToString(buf)
+	raw, err := json.Marshal(oauthState{
+		Provider: provider, Nonce: nonce, UserID: linkUserID, Expires: s.now().Add(oauthStateTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	_, key := s.signingKey()
+	return p.AuthURL(payload+"."+signState(key, payload), s.oauthRedirectURI(provider)), nonce, nil
+}
+
+func (s *Service) checkState(provider, state, nonce string) (oauthState, error) {
+	var st oauthState
+	payload, sig, ok := strings.Cut(state, ".")
+	if !ok {
+		return st, ErrOAuthState
+	}
+	// any accepted key, so a rotation doesn't break logins in flight
+	valid := false
+	for _, key := range s.verificationKeys() {
+		valid = valid || hmac.Equal([]byte(sig), []byte(signState(key, payload)))
+	}
+	if !valid {
+		return st, ErrOAuthState
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(raw, &st) != nil {
+		return st, ErrOAuthState
+	}
+	if st.Provider != provider || nonce == "" || !hmac.Equal([]byte(st.Nonce), []byte(nonce)) ||
+		s.now().Unix() > st.Expires {
+		return st, ErrOAuthState
+	}
+	return st, nil
+}
+
+// FinishOAuth completes a flow StartOAuth began. A provider account
+// already linked signs in as its user. Otherwise it is linked to the user
+// who started a link, or gets a new user named after the account, with no
+// password.
+func (s *Service) FinishOAuth(ctx context.Context, provider, code, state, nonce string) (OAuthResult, error) {
+	p, ok := s.cfg.OAuthProviders[provider]
+	if !ok {
+		return OAuthResult{}, ErrProviderNotFound
+	}
+	st, err := s.checkState(provider, state, nonce)
+	if err != nil {
+		return OAuthResult{}, err
+	}
+	if code == "" {
+		return OAuthResult{}, ErrOAuthFailed
+	}
+	who, err := p.Exchange(ctx, code, s.oauthRedirectURI(provider))
+	if err != nil {
+		return OAuthResult{}, err
+	}
+	if who.Subject == "" {
+		return OAuthResult{}, ErrOAuthFailed
+	}
+
+	ident, err := s.store.GetIdentity(ctx, provider, who.Subject)
+	switch {
+	case err == nil && st.UserID != 0:
+		if ident.UserID != st.UserID {
+			return OAuthResult{}, ErrIdentityTaken
+		}
+		return OAuthResult{UserID: st.UserID, Linked: true}, nil
+	case err == nil:
+		return s.oauthSignIn(ctx, ident.UserID, false)
+	case !errors.Is(err, repository.ErrNotFound):
+		return OAuthResult{}, err
+	case st.UserID != 0:
+		return s.linkIdentity(ctx, st.UserID, provider, who)
+	}
+	return s.oauthSignUp(ctx, provider, who)
+}
+
+func (s *Service) oauthSignIn(ctx context.Context, userID int64, created bool) (OAuthResult, error) {
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		return OAuthResult{}, err
+	}
+	if u.Status == repository.UserBanned {
+		return OAuthResult{}, statusError(u)
+	}
+	pair, _, err := s.issueTokens(ctx, s.store, userID, "")
+	return OAuthResult{UserID: userID, Created: created, Tokens: pair}, err
+}
+
+func (s *Service) linkIdentity(ctx context.Context, userID int64, provider string, who OAuthIdentity) (OAuthResult, error) {
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		if _, err := q.GetUser(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+		err := q.AddIdentity(ctx, repository.ExternalIdentity{
+			Provider: provider, ExternalID: who.Subject, UserID: userID, Email: who.Email,
+		})
+		if errors.Is(err, repository.ErrConflict) {
+			// the account was linked meanwhile, or the user has another
+			if other, err := q.GetIdentity(ctx, provider, who.Subject); err == nil && other.UserID != userID {
+				return ErrIdentityTaken
+			}
+			return ErrProviderLinked
+		}
+		if err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditIdentityLinked, "user", userTarget(userID), nil,
+			map[string]any{"provider": provider, "external_id": who.Subject, "email": who.Email})
+	})
+	if err != nil {
+		return OAuthResult{}, err
+	}
+	return OAuthResult{UserID: userID, Linked: true}, nil
+}
+
+func (s *Service) oauthSignUp(ctx context.Context, provider string, who OAuthIdentity) (OAuthResult, error) {
+	username, err := s.freeUsername(ctx, who.Username)
+	if err != nil {
+		return OAuthResult{}, err
+	}
+	var u repository.User
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		// an empty hash never matches a password
+		if u, err = q.CreateUser(ctx, username, "", s.cfg.Region); err != nil {
+			return err
+		}
+		if err := q.AddIdentity(ctx, repository.ExternalIdentity{
+			Provider: provider, ExternalID: who.Subject, UserID: u.ID, Email: who.Email,
+		}); err != nil {
+			return err
+		}
+		return emit(ctx, q, EventUserCreated, map[string]any{
+			"user_id": u.ID, "username": u.Username, "region": s.cfg.Region, "provider": provider,
+		})
+	})
+	if errors.Is(err, repository.ErrConflict) {
+		// a concurrent callback for the same account won
+		if ident, err := s.store.GetIdentity(ctx, provider, who.Subject); err == nil {
+			return s.oauthSignIn(ctx, ident.UserID, false)
+		}
+		return OAuthResult{}, ErrUsernameTaken
+	}
+	if err != nil {
+		return OAuthResult{}, err
+	}
+	return s.oauthSignIn(ctx, u.ID, true)
+}
+
+// freeUsername turns a provider's suggestion into a valid username that
+// isn't taken, adding a number when it is.
+func (s *Service) freeUsername(ctx context.Context, suggested string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if r < 128 && usernameRe.MatchString(strings.Repeat(string(r), 3)) {
+			return r
+		}
+		return -1
+	}, suggested)
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	name := base
+	for i := 0; i < 20; i++ {
+		if i > 0 {
+			buf := make([]byte, 3)
+			if _, err := rand.Read(buf); err != nil {
+				return "", err
+			}
+			name = fmt.Sprintf("%s_%d", base, int(buf[0])<<16|int(buf[1])<<8|int(buf[2]))
+		}
+		_, _, err := s.store.GetPasswordHash(ctx, name)
+		if errors.Is(err, repository.ErrNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", ErrUsernameTaken
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// passwordResetChannel is the notification channel reset tokens are sent
+// on, to the address the user set for it.
+const passwordResetChannel = "email"
+
+const (
+	AuditPasswordResetRequested = "user.password_reset_requested"
+	AuditPasswordReset          = "user.password_reset"
+)
+
+var (
+	ErrPasswordResetUnavailable = newError("PASSWORD_RESET_UNAVAILABLE", "password reset needs email notifications, which this server doesn't send")
+	ErrInvalidResetToken        = newError("INVALID_RESET_TOKEN", "reset token is invalid, used or expired")
+)
+
+// ForgotPassword emails a one-time reset token to the address on the
+// user's email channel. Unknown users, users without a password or an
+// email address, and users already sent PasswordResetMaxPerHour tokens in
+// the last hour get nothing, with no error, so the response doesn't tell
+// who has an account. The email is sent in the background for the same
+// reason; a failed send is only logged.
+func (s *Service) ForgotPassword(ctx context.Context, username string) error {
+	ch, ok := s.cfg.Channels[passwordResetChannel]
+	if !ok {
+		return ErrPasswordResetUnavailable
+	}
+	id, hash, err := s.store.GetPasswordHash(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) || err == nil && hash == "" {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	settings, err := s.store.ListChannelSettings(ctx, id)
+	if err != nil {
+		return err
+	}
+	address := ""
+	for _, c := range settings {
+		if c.Channel == passwordResetChannel {
+			address = c.Address
+		}
+	}
+	if address == "" {
+		return nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	now := s.now()
+	expires := now.Add(s.cfg.PasswordResetTTL)
+	limited := false
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		n, err := q.CountPasswordResets(ctx, id, now.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if limited = n >= s.cfg.PasswordResetMaxPerHour; limited {
+			return nil
+		}
+		if err := q.CreatePasswordReset(ctx, id, hashRefreshToken(token), expires); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditPasswordResetRequested, "user", userTarget(id), nil,
+			map[string]any{"expires_at": expires})
+	})
+	if err != nil {
+		return err
+	}
+	if limited {
+		log.Printf("password reset for user %d: hourly limit reached, nothing sent", id)
+		return nil
+	}
+	n := s.passwordResetEmail(id, username, token, now, expires)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notificationTimeout)
+		defer cancel()
+		if err := ch.Send(ctx, address, n); err != nil {
+			log.Printf("password reset for user %d: send: %v", id, err)
+		}
+	}()
+	return nil
+}
+
+// passwordResetEmail is the message carrying a reset token: a link to
+// PasswordResetURL when set, the bare token otherwise.
+func (s *Service) passwordResetEmail(userID int64, username, token string, now, expires time.Time) repository.Notification {
+	how := "use this code to choose a new one:\n\n" + token
+	if s.cfg.PasswordResetURL != "" {
+		how = "open this link to choose a new one:\n\n" + s.cfg.PasswordResetURL + token
+	}
+	return repository.Notification{
+		UserID: userID,
+		Kind:   "password_reset",
+		Title:  "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of %s. If that was you, %s\n\n"+
+			"It works once, until %s. If it wasn't you, ignore this email; your password stays as it is.",
+			username, how, expires.UTC().Format(time.RFC1123)),
+		Data:      json.RawMessage("{}"),
+		CreatedAt: now,
+	}
+}
+
+// ResetPassword sets the password of the user a reset token was sent to
+// and uses up the token, with any others they were sent. Every session the
+// user has is ended, since whoever else knew the old password may be
+// signed in.
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	// bcrypt ignores anything past 72 bytes
+	if len(password) < 8 || len(password) > 72 {
+		return invalid("password must be 8-72 bytes")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		id, err := q.UsePasswordReset(ctx, hashRefreshToken(token), now)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if err := q.SetPasswordHash(ctx, id, string(hash)); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if err := q.RevokeUserTokens(ctx, id, now); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditPasswordReset, "user", userTarget(id), nil,
+			map[string]any{"revoked_before": now})
+	})
+	if err != nil {
+		return err
+	}
+	s.reloadRevocations(ctx)
+	return nil
+}
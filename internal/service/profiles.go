@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+const AuditProfileUpdated = "user.profile_updated"
+
+var ErrVersionConflict = newError("VERSION_CONFLICT", "the user was changed since that version; reload and try again")
+
+// checkVersion is ErrVersionConflict when the caller named a version and
+// it isn't the current one.
+func checkVersion(want *int64, current int64) error {
+	if want != nil && *want != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// localeRe accepts BCP 47 style tags such as "en", "pt-BR" or "zh-Hant-TW".
+var localeRe = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8}){0,3}$`)
+
+// ProfileInput is a partial profile update: nil fields are left as they
+// are, "" clears one.
+type ProfileInput struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	// Timezone is an IANA name such as "Europe/Berlin".
+	Timezone *string `json:"timezone"`
+	Locale   *string `json:"locale"`
+	// Version, if set, is the profile's version the update was made
+	// against; the update is refused if the user has changed since.
+	Version *int64 `json:"version"`
+}
+
+func (in ProfileInput) apply(p repository.Profile) (repository.Profile, error) {
+	if in.DisplayName != nil {
+		name := strings.TrimSpace(*in.DisplayName)
+		if utf8.RuneCountInString(name) > 64 || strings.ContainsFunc(name, unicode.IsControl) {
+			return p, invalid("display_name must be at most 64 printable characters")
+		}
+		p.DisplayName = name
+	}
+	if in.AvatarURL != nil {
+		if v := *in.AvatarURL; v != "" {
+			u, err := url.Parse(v)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(v) > 2048 {
+				return p, invalid("avatar_url must be an http(s) URL")
+			}
+		}
+		p.AvatarURL = *in.AvatarURL
+	}
+	if in.Timezone != nil {
+		if v := *in.Timezone; v != "" {
+			if _, err := time.LoadLocation(v); err != nil || v == "Local" {
+				return p, invalid("timezone must be an IANA time zone such as Europe/Berlin")
+			}
+		}
+		p.Timezone = *in.Timezone
+	}
+	if in.Locale != nil {
+		if v := *in.Locale; v != "" && !localeRe.MatchString(v) {
+			return p, invalid("locale must be a language tag such as en or pt-BR")
+		}
+		p.Locale = *in.Locale
+	}
+	return p, nil
+}
+
+func (s *Service) Profile(ctx context.Context, userID int64) (repository.Profile, error) {
+	p, err := s.store.GetProfile(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return p, ErrUserNotFound
+	}
+	return p, err
+}
+
+// UpdateProfile applies in to the user's profile and returns the result.
+// The write only goes through over the version read, so a concurrent
+// change to the user is ErrVersionConflict rather than lost.
+func (s *Service) UpdateProfile(ctx context.Context, userID int64, in ProfileInput) (repository.Profile, error) {
+	// validate before opening a transaction
+	if _, err := in.apply(repository.Profile{}); err != nil {
+		return repository.Profile{}, err
+	}
+	var out repository.Profile
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetProfile(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(in.Version, before.Version); err != nil {
+			return err
+		}
+		if out, err = in.apply(before); err != nil {
+			return err
+		}
+		if out == before {
+			return nil
+		}
+		if err := q.UpdateProfile(ctx, userID, out); errors.Is(err, repository.ErrVersionConflict) {
+			return ErrVersionConflict
+		} else if err != nil {
+			return err
+		}
+		out.Version++
+		return audit(ctx, q, AuditProfileUpdated, "user", userTarget(userID), before, out)
+	})
+	return out, err
+}
+
+// withProfiles fills in the display name, avatar and level of each entry.
+func (s *Service) withProfiles(ctx context.Context, q repository.Queries, items []repository.LeaderboardEntry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(items))
+	for i, it := range items {
+		ids[i] = it.ID
+	}
+	profiles, err := q.Profiles(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		p := profiles[items[i].ID]
+		items[i].DisplayName, items[i].AvatarURL = p.DisplayName, p.AvatarURL
+	}
+	return s.withLevels(ctx, q, items)
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// PublicEntry is a leaderboard entry as anyone may see it: no id, username
+// or avatar, and the display name only of users who set one and didn't ask
+// to be anonymous.
+type PublicEntry struct {
+	Rank        int    `json:"rank"`
+	DisplayName string `json:"display_name"`
+	Points      int64  `json:"points"`
+}
+
+type PublicBoard struct {
+	Period string        `json:"period"`
+	Items  []PublicEntry `json:"leaderboard"`
+	Total  int64         `json:"total"`
+	// AsOf is set as on Leaderboard.
+	AsOf *time.Time `json:"as_of,omitempty"`
+}
+
+// PublicLeaderboard is the first limit entries of Leaderboard, stripped to
+// what can be shown without a token.
+func (s *Service) PublicLeaderboard(ctx context.Context, period string, limit int) (PublicBoard, error) {
+	page, err := s.Leaderboard(ctx, period, limit, nil)
+	if err != nil {
+		return PublicBoard{}, err
+	}
+	board := PublicBoard{Period: period, Items: make([]PublicEntry, len(page.Items)), Total: page.Total, AsOf: page.AsOf}
+	for i, e := range page.Items {
+		name := e.DisplayName
+		if e.Anonymous || name == "" {
+			name = anonymousName
+		}
+		board.Items[i] = PublicEntry{Rank: e.Rank, DisplayName: name, Points: e.Points}
+	}
+	return board, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const receiptIssuer = "go-user-tasks"
+
+// ReceiptClaims is the payload of a completion receipt. Receipts are signed
+// with the receipt secret, never with the auth secret, so a receipt can't be
+// replayed as a bearer token.
+type ReceiptClaims struct {
+	UserID int64  `json:"uid"`
+	Task   string `json:"task"`
+	Amount int64  `json:"amount"`
+	jwt.RegisteredClaims
+}
+
+func (s *Service) signReceipt(userID int64, task string, amount int64, at time.Time) (string, error) {
+	claims := ReceiptClaims{
+		UserID: userID,
+		Task:   task,
+		Amount: amount,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   receiptIssuer,
+			IssuedAt: jwt.NewNumericDate(at),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.cfg.ReceiptSecret)
+}
+
+// VerifyReceipt checks a receipt's signature and returns its claims.
+func (s *Service) VerifyReceipt(receipt string) (*ReceiptClaims, error) {
+	claims := &ReceiptClaims{}
+	_, err := jwt.ParseWithClaims(receipt, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.cfg.ReceiptSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuer(receiptIssuer), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// referralCodeAlphabet leaves out letters and digits easily mistaken for
+// one another.
+const referralCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// ReferralLink is a user's referral link. URL is set when
+// Config.RefLinkBaseURL is.
+type ReferralLink struct {
+	Code string `json:"code"`
+	URL  string `json:"url,omitempty"`
+}
+
+// ReferralLink returns the user's referral link, making its code the first
+// time it is asked for.
+func (s *Service) ReferralLink(ctx context.Context, userID int64) (ReferralLink, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return ReferralLink{}, err
+	}
+	code, err := s.store.ReferralCode(ctx, userID)
+	for i := 0; errors.Is(err, repository.ErrNotFound) && i < 5; i++ {
+		if code, err = newReferralCode(); err != nil {
+			break
+		}
+		err = s.store.CreateReferralCode(ctx, userID, code)
+		if errors.Is(err, repository.ErrConflict) {
+			// made meanwhile, or the code is taken and another is tried
+			code, err = s.store.ReferralCode(ctx, userID)
+		}
+	}
+	if err != nil {
+		return ReferralLink{}, err
+	}
+	link := ReferralLink{Code: code}
+	if s.cfg.RefLinkBaseURL != "" {
+		link.URL = strings.TrimSuffix(s.cfg.RefLinkBaseURL, "/") + "/r/" + code
+	}
+	return link, nil
+}
+
+func newReferralCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = referralCodeAlphabet[int(b)%len(referralCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// ReferralVisit is where to send a visitor of a referral link. Token
+// attributes their signup to the referrer until it expires at Expires; it
+// is empty when the link's code is unknown.
+type ReferralVisit struct {
+	Redirect string
+	Token    string
+	Expires  time.Time
+}
+
+// VisitReferralLink records a click on the referral link with code. prev
+// is the token the visitor already holds, if any: one still open for the
+// same referrer is handed back rather than counting the click again.
+// Unknown codes still land, without a token.
+func (s *Service) VisitReferralLink(ctx context.Context, code, prev string) (ReferralVisit, error) {
+	referrerID, err := s.store.ReferrerByCode(ctx, code)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ReferralVisit{Redirect: s.cfg.RefLandingURL}, nil
+	}
+	if err != nil {
+		return ReferralVisit{}, err
+	}
+	since := s.now().Add(-s.cfg.RefAttribution)
+	if prev != "" {
+		c, err := s.store.GetReferralClick(ctx, prev)
+		if err == nil && c.ReferrerID == referrerID && c.SignedUpAt == nil && !c.CreatedAt.Before(since) {
+			return s.referralVisit(c.Token, c.CreatedAt), nil
+		}
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ReferralVisit{}, err
+	}
+	token := hex.EncodeToString(buf)
+	if err := s.store.CreateReferralClick(ctx, referrerID, token); err != nil {
+		return ReferralVisit{}, err
+	}
+	return s.referralVisit(token, s.now()), nil
+}
+
+func (s *Service) referralVisit(token string, clicked time.Time) ReferralVisit {
+	v := ReferralVisit{Redirect: s.cfg.RefLandingURL, Token: token, Expires: clicked.Add(s.cfg.RefAttribution)}
+	// the landing URL is checked when the config is loaded
+	if u, err := url.Parse(s.cfg.RefLandingURL); err == nil {
+		q := u.Query()
+		q.Set("ref", token)
+		u.RawQuery = q.Encode()
+		v.Redirect = u.String()
+	}
+	return v
+}
+
+// AttributeSignup sets the referrer of a user who has just signed up from
+// the referral token they were handed at /r/{code}, paying the usual
+// bonuses. Tokens that are unknown, used or older than
+// Config.RefAttribution are ignored, and so is anything that goes wrong:
+// the signup stands either way. It returns the referrer's id, 0 when none
+// was set.
+func (s *Service) AttributeSignup(ctx context.Context, userID int64, token string) int64 {
+	if token == "" {
+		return 0
+	}
+	var (
+		click repository.ReferralClick
+		bonus ReferralBonus
+	)
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		if click, err = q.ClaimReferralClick(ctx, token, userID, s.now().Add(-s.cfg.RefAttribution)); err != nil {
+			return err
+		}
+		bonus, err = s.linkReferrer(ctx, q, userID, click.ReferrerID)
+		return err
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return 0
+	case err != nil:
+		log.Printf("referral attribution for user %d: %v", userID, err)
+		return 0
+	}
+	if !bonus.Pending {
+		s.RefreshCachedPoints(ctx, userID, click.ReferrerID)
+	}
+	return click.ReferrerID
+}
+
+// ReferralFunnelStats is a ReferralFunnel with its conversion rates:
+// signups per click and first tasks per signup.
+type ReferralFunnelStats struct {
+	repository.ReferralFunnel
+	SignupRate    float64 `json:"signup_rate"`
+	FirstTaskRate float64 `json:"first_task_rate"`
+}
+
+func referralFunnelStats(f repository.ReferralFunnel) ReferralFunnelStats {
+	s := ReferralFunnelStats{ReferralFunnel: f}
+	if f.Clicks > 0 {
+		s.SignupRate = float64(f.Signups) / float64(f.Clicks)
+	}
+	if f.Signups > 0 {
+		s.FirstTaskRate = float64(f.FirstTasks) / float64(f.Signups)
+	}
+	return s
+}
+
+// ReferralReport is the click to signup to first task funnel of the
+// referral links clicked in the UTC days From through To.
+type ReferralReport struct {
+	From      string                `json:"from"`
+	To        string                `json:"to"`
+	Referrers []ReferralFunnelStats `json:"referrers"`
+	Totals    ReferralFunnelStats   `json:"totals"`
+}
+
+// ReferralReport lists the limit referrers whose links led to the most
+// signups among the clicks from from through to, defaulting as
+// ActivityReport does. A signup is counted against its click's day.
+func (s *Service) ReferralReport(ctx context.Context, from, to *time.Time, limit int) (ReferralReport, error) {
+	start, end, err := s.reportRange(from, to)
+	if err != nil {
+		return ReferralReport{}, err
+	}
+	until := end.AddDate(0, 0, 1)
+
+	var (
+		funnels []repository.ReferralFunnel
+		totals  repository.ReferralFunnel
+	)
+	err = s.read(ctx, func(q repository.Queries) error {
+		var err error
+		if funnels, err = q.ReferralFunnels(ctx, start, until, limit); err != nil {
+			return err
+		}
+		totals, err = q.ReferralFunnelTotals(ctx, start, until)
+		return err
+	})
+	if err != nil {
+		return ReferralReport{}, err
+	}
+	rep := ReferralReport{
+		From:      start.Format(time.DateOnly),
+		To:        end.Format(time.DateOnly),
+		Referrers: make([]ReferralFunnelStats, 0, len(funnels)),
+		Totals:    referralFunnelStats(totals),
+	}
+	for _, f := range funnels {
+		rep.Referrers = append(rep.Referrers, referralFunnelStats(f))
+	}
+	return rep, nil
+}
+
+// ReferralLinksEnabled reports whether /r/{code} has somewhere to send
+// visitors.
+func (s *Service) ReferralLinksEnabled() bool { return s.cfg.RefLandingURL != "" }
+
+// ReferralLanding is the landing page, for visitors who get no token.
+func (s *Service) ReferralLanding() string { return s.cfg.RefLandingURL }
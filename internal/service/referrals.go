@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+type ReferralBonus struct {
+	Referred int64
+	Referrer int64
+	// Pending is set when the bonuses wait for the referred user to reach
+	// Config.RefPayout.
+	Pending bool
+	// Capped names the cap in Config.RefCaps that left the referrer
+	// without a bonus, if one did.
+	Capped string
+}
+
+// ReferralCaps limit the referrals a referrer is paid a bonus for per UTC
+// day, per UTC month and in all; 0 is no limit. Referrals past a cap are
+// still made, and the referred user still gets their bonus.
+type ReferralCaps struct {
+	Daily    int64
+	Monthly  int64
+	Lifetime int64
+}
+
+// ReferralAllowance is what is left of one of the caps: Period is daily,
+// monthly or lifetime, and ResetsAt is when Used goes back to 0.
+type ReferralAllowance struct {
+	Period    string     `json:"period"`
+	Limit     int64      `json:"limit"`
+	Used      int64      `json:"used"`
+	Remaining int64      `json:"remaining"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+// referralAllowance lists the configured caps with what the referrer has
+// used of them.
+func (s *Service) referralAllowance(ctx context.Context, q repository.Queries, referrerID int64) ([]ReferralAllowance, error) {
+	caps := s.cfg.RefCaps
+	out := []ReferralAllowance{}
+	if caps == (ReferralCaps{}) {
+		return out, nil
+	}
+	now := s.now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	used, err := q.ReferrerBonuses(ctx, referrerID, day, month)
+	if err != nil {
+		return nil, err
+	}
+	nextDay, nextMonth := day.AddDate(0, 0, 1), month.AddDate(0, 1, 0)
+	for _, c := range []struct {
+		period string
+		limit  int64
+		used   int64
+		resets *time.Time
+	}{
+		{"daily", caps.Daily, used.Day, &nextDay},
+		{"monthly", caps.Monthly, used.Month, &nextMonth},
+		{"lifetime", caps.Lifetime, used.Total, nil},
+	} {
+		if c.limit == 0 {
+			continue
+		}
+		out = append(out, ReferralAllowance{
+			Period: c.period, Limit: c.limit, Used: c.used,
+			Remaining: max(c.limit-c.used, 0), ResetsAt: c.resets,
+		})
+	}
+	return out, nil
+}
+
+// SetReferrer links userID to referrerID once and pays both referral
+// bonuses, or leaves them pending for PayReferrals when Config.RefPayout is
+// set.
+func (s *Service) SetReferrer(ctx context.Context, userID, referrerID int64) (_ ReferralBonus, err error) {
+	ctx, span := tracer.Start(ctx, "SetReferrer", trace.WithAttributes(
+		attribute.Int64("user.id", userID), attribute.Int64("referrer.id", referrerID)))
+	defer func() { endSpan(span, err) }()
+
+	if referrerID == userID {
+		return ReferralBonus{}, ErrSelfReferral
+	}
+	var bonus ReferralBonus
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		bonus, err = s.linkReferrer(ctx, q, userID, referrerID)
+		return err
+	})
+	if err != nil {
+		return ReferralBonus{}, err
+	}
+	if !bonus.Pending {
+		s.RefreshCachedPoints(ctx, userID, referrerID)
+	}
+	return bonus, nil
+}
+
+// linkReferrer is SetReferrer within q.
+func (s *Service) linkReferrer(ctx context.Context, q repository.Queries, userID, referrerID int64) (ReferralBonus, error) {
+	bonus := ReferralBonus{
+		Referred: s.cfg.RefBonusToReferred,
+		Referrer: s.cfg.RefBonusToReferrer,
+		Pending:  s.cfg.RefPayout != repository.ReferralMilestone{},
+	}
+	status := repository.ReferralPaid
+	if bonus.Pending {
+		status = repository.ReferralPending
+	}
+
+	// Ensure user exists and has no referrer yet
+	u, err := q.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return bonus, ErrUserNotFound
+		}
+		return bonus, err
+	}
+	if u.ReferrerID != nil {
+		return bonus, ErrReferrerAlreadySet
+	}
+
+	if _, err := q.GetUser(ctx, referrerID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return bonus, ErrReferrerNotFound
+		}
+		return bonus, err
+	}
+	if bonus.Referrer > 0 {
+		allowance, err := s.referralAllowance(ctx, q, referrerID)
+		if err != nil {
+			return bonus, err
+		}
+		for _, a := range allowance {
+			if a.Remaining > 0 {
+				continue
+			}
+			bonus.Referrer, bonus.Capped = 0, a.Period
+			if err := emit(ctx, q, EventReferralCapReached, map[string]any{
+				"referrer_id": referrerID, "referred_id": userID, "cap": a.Period, "limit": a.Limit,
+			}); err != nil {
+				return bonus, err
+			}
+			break
+		}
+	}
+
+	if err := q.SetReferrer(ctx, userID, referrerID); err != nil {
+		return bonus, err
+	}
+	if err := q.CreateReferral(ctx, repository.Referral{
+		ReferrerID: referrerID, ReferredID: userID,
+		BonusReferrer: bonus.Referrer, BonusReferred: bonus.Referred,
+		Status: status,
+	}); err != nil {
+		return bonus, err
+	}
+	if err := audit(ctx, q, AuditReferrerSet, "user", userTarget(userID),
+		map[string]any{"referrer_id": nil}, map[string]any{"referrer_id": referrerID}); err != nil {
+		return bonus, err
+	}
+	if !bonus.Pending {
+		if err := s.payBonuses(ctx, q, referrerID, userID, bonus.Referrer, bonus.Referred); err != nil {
+			return bonus, err
+		}
+	}
+	return bonus, emit(ctx, q, EventReferralCreated, map[string]any{
+		"referrer_id": referrerID, "referred_id": userID,
+		"bonus_referrer": bonus.Referrer, "bonus_referred": bonus.Referred,
+		"bonus_pending": bonus.Pending, "referrer_capped": bonus.Capped,
+	})
+}
+
+// payBonuses enters the referral bonuses in the ledger, leaving out those of
+// 0 points.
+func (s *Service) payBonuses(ctx context.Context, q repository.Queries, referrerID, referredID, toReferrer, toReferred int64) error {
+	if toReferred != 0 {
+		if err := s.accrue(ctx, q, AuditReferralBonus, referredID, toReferred, "referral:referred",
+			map[string]any{"referrer_id": referrerID}); err != nil {
+			return err
+		}
+	}
+	if toReferrer == 0 {
+		return nil
+	}
+	return s.accrue(ctx, q, AuditReferralBonus, referrerID, toReferrer, "referral:referrer",
+		map[string]any{"referred_id": referredID})
+}
+
+// UserReferrals is a user's side of referrals: those they made, oldest
+// first, the one that brought them and what is left of the caps on their
+// referrer bonuses.
+type UserReferrals struct {
+	Referrals  []repository.Referral `json:"referrals"`
+	ReferredBy *repository.Referral  `json:"referred_by"`
+	Allowance  []ReferralAllowance   `json:"allowance"`
+}
+
+func (s *Service) UserReferrals(ctx context.Context, userID int64) (UserReferrals, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return UserReferrals{}, err
+	}
+	out := UserReferrals{Referrals: []repository.Referral{}}
+	all, err := s.store.ListReferrals(ctx, userID)
+	if err != nil {
+		return UserReferrals{}, err
+	}
+	for _, r := range all {
+		if r.ReferrerID == userID {
+			out.Referrals = append(out.Referrals, r)
+		} else {
+			out.ReferredBy = &r
+		}
+	}
+	out.Allowance, err = s.referralAllowance(ctx, s.store, userID)
+	return out, err
+}
+
+// PayReferrals is the pay_referrals job: it pays the bonuses of pending
+// referrals whose referred user has reached Config.RefPayout, then expires
+// those pending for longer than Config.RefPayoutExpiry. Bonuses are paid
+// as they were when the referral was made.
+func (s *Service) PayReferrals(ctx context.Context) error {
+	const batch = 100
+	paid := 0
+	for {
+		due, err := s.store.DueReferrals(ctx, s.cfg.RefPayout, batch)
+		if err != nil {
+			return err
+		}
+		for _, r := range due {
+			err := s.store.InTx(ctx, func(q repository.Queries) error {
+				if err := q.PayReferral(ctx, r.ReferrerID, r.ReferredID); err != nil {
+					return err
+				}
+				if err := s.payBonuses(ctx, q, r.ReferrerID, r.ReferredID, r.BonusReferrer, r.BonusReferred); err != nil {
+					return err
+				}
+				return emit(ctx, q, EventReferralPaid, map[string]any{
+					"referrer_id": r.ReferrerID, "referred_id": r.ReferredID,
+					"bonus_referrer": r.BonusReferrer, "bonus_referred": r.BonusReferred,
+				})
+			})
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				// reset or paid meanwhile
+				continue
+			case err != nil:
+				return fmt.Errorf("pay referral of user %d: %w", r.ReferredID, err)
+			}
+			paid++
+			s.RefreshCachedPoints(ctx, r.ReferredID, r.ReferrerID)
+		}
+		if len(due) < batch {
+			break
+		}
+	}
+	var expired int64
+	if s.cfg.RefPayoutExpiry > 0 {
+		var err error
+		if expired, err = s.store.ExpireReferrals(ctx, s.now().Add(-s.cfg.RefPayoutExpiry)); err != nil {
+			return err
+		}
+	}
+	if paid > 0 || expired > 0 {
+		log.Printf("pay referrals: %d paid, %d expired", paid, expired)
+	}
+	return nil
+}
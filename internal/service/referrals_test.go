@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+func referralConfig() Config {
+	return Config{Region: "local", RefBonusToReferred: 10, RefBonusToReferrer: 20}
+}
+
+func TestSetReferrerPaysBothBonusesOnce(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemory("local")
+	s := New(store, referralConfig())
+	alice, bob, carol := mustCreateUser(t, store, "alice"), mustCreateUser(t, store, "bob"), mustCreateUser(t, store, "carol")
+
+	if _, err := s.SetReferrer(ctx, bob.ID, bob.ID); !errors.Is(err, ErrSelfReferral) {
+		t.Fatalf("self-referral: err = %v, want ErrSelfReferral", err)
+	}
+	bonus, err := s.SetReferrer(ctx, bob.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bonus.Referred != 10 || bonus.Referrer != 20 || bonus.Pending {
+		t.Errorf("bonus = %+v, want 10 and 20 paid", bonus)
+	}
+	// a second referrer is refused and pays nothing
+	if _, err := s.SetReferrer(ctx, bob.ID, carol.ID); !errors.Is(err, ErrReferrerAlreadySet) {
+		t.Fatalf("second referrer: err = %v, want ErrReferrerAlreadySet", err)
+	}
+	for _, c := range []struct {
+		user repository.User
+		want int64
+	}{{alice, 20}, {bob, 10}, {carol, 0}} {
+		if got := points(t, store, c.user.ID); got != c.want {
+			t.Errorf("%s has %d points, want %d", c.user.Username, got, c.want)
+		}
+	}
+}
+
+// failingStore is a Store whose transactions fail the accrual with the
+// given reason, to check what SetReferrer leaves behind when the store
+// fails partway.
+type failingStore struct {
+	repository.Store
+	reason string
+}
+
+var errStore = errors.New("store failed")
+
+func (f failingStore) InTx(ctx context.Context, fn func(q repository.Queries) error) error {
+	return f.Store.InTx(ctx, func(q repository.Queries) error {
+		return fn(failingQueries{Queries: q, reason: f.reason})
+	})
+}
+
+type failingQueries struct {
+	repository.Queries
+	reason string
+}
+
+func (f failingQueries) Accrue(ctx context.Context, userID, amount int64, reason string) error {
+	if reason == f.reason {
+		return errStore
+	}
+	return f.Queries.Accrue(ctx, userID, amount, reason)
+}
+
+// The referred user's bonus is paid before the referrer's; when the
+// second fails, the link and the first bonus are rolled back with it.
+func TestSetReferrerRollsBackWhenABonusFails(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemory("local")
+	s := New(failingStore{Store: store, reason: "referral:referrer"}, referralConfig())
+	alice, bob := mustCreateUser(t, store, "alice"), mustCreateUser(t, store, "bob")
+
+	if _, err := s.SetReferrer(ctx, bob.ID, alice.ID); !errors.Is(err, errStore) {
+		t.Fatalf("err = %v, want the store's", err)
+	}
+	u, err := store.GetUser(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ReferrerID != nil || u.Points != 0 {
+		t.Errorf("bob = referrer %v, %d points; want neither", u.ReferrerID, u.Points)
+	}
+	if got := points(t, store, alice.ID); got != 0 {
+		t.Errorf("alice has %d points, want 0", got)
+	}
+}
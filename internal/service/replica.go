@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// read runs fn against Config.Replica when there is one and it is up, and
+// against the primary otherwise, so fn must not keep state from an earlier
+// run. ErrNotFound from the replica reruns fn on the primary, since the row
+// may not have replicated yet; any other error but a domain one does too,
+// and keeps reads off the replica for Config.ReplicaRetry.
+func (s *Service) read(ctx context.Context, fn func(q repository.Queries) error) error {
+	if s.cfg.Replica == nil || s.now().UnixNano() < s.replicaDown.Load() {
+		return fn(s.store)
+	}
+	err := fn(s.cfg.Replica)
+	var domain *Error
+	switch {
+	case err == nil, ctx.Err() != nil, errors.As(err, &domain):
+		return err
+	case errors.Is(err, repository.ErrNotFound):
+		return fn(s.store)
+	}
+	if prev := s.replicaDown.Swap(s.now().Add(s.cfg.ReplicaRetry).UnixNano()); prev < s.now().UnixNano() {
+		log.Printf("read replica: %v; reading from the primary for %s", err, s.cfg.ReplicaRetry)
+	}
+	return fn(s.store)
+}
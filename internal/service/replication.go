@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+const replicationBatch = 500
+
+// Peer is another region whose ledger is merged into the local one.
+type Peer struct {
+	Name  string
+	Store repository.ReplicationStore
+}
+
+// Replicator pulls accruals originated by each peer and applies them locally.
+// Accruals are signed deltas keyed by (origin region, origin seq), so merging
+// is idempotent and order-independent.
+type Replicator struct {
+	local    repository.Store
+	peers    []Peer
+	interval time.Duration
+	lag      time.Duration
+
+	// OnMerge, if set, is called after a batch commits with the users whose
+	// points changed.
+	OnMerge func(ctx context.Context, userIDs ...int64)
+}
+
+// NewReplicator merges every interval. Only peer rows recorded more than lag
+// ago are pulled, so no transaction holding a lower origin_seq can still be
+// in flight when the cursor moves past it.
+func NewReplicator(local repository.Store, peers []Peer, interval, lag time.Duration) *Replicator {
+	return &Replicator{local: local, peers: peers, interval: interval, lag: lag}
+}
+
+func (r *Replicator) Run(ctx context.Context) {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		for _, p := range r.peers {
+			for {
+				n, err := r.pull(ctx, p)
+				if err != nil {
+					log.Printf("replicate from %s: %v", p.Name, err)
+					break
+				}
+				if n < replicationBatch {
+					break
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (r *Replicator) pull(ctx context.Context, p Peer) (int, error) {
+	cursor, err := r.local.ReplicationCursor(ctx, p.Name)
+	if err != nil {
+		return 0, err
+	}
+	batch, err := p.Store.LocalAccruals(ctx, cursor, r.lag, replicationBatch)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	var merged map[int64]bool
+	err = r.local.InTx(ctx, func(q repository.Queries) error {
+		merged = map[int64]bool{}
+		for _, a := range batch {
+			// already merged rows are skipped, so a replay never double-credits
+			userID, err := q.MergeAccrual(ctx, p.Name, a)
+			if errors.Is(err, repository.ErrNotFound) {
+				userID, err = r.mergeNewUser(ctx, q, p, a)
+			}
+			if err != nil {
+				return err
+			}
+			if userID == 0 {
+				continue
+			}
+			merged[userID] = true
+			u, err := q.GetUser(ctx, userID)
+			if err != nil {
+				return err
+			}
+			if err := pointsChanged(ctx, q, userID, a.Amount, u.Points, a.Reason); err != nil {
+				return err
+			}
+		}
+		return q.SetReplicationCursor(ctx, p.Name, batch[len(batch)-1].Seq)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if r.OnMerge != nil && len(merged) > 0 {
+		ids := make([]int64, 0, len(merged))
+		for id := range merged {
+			ids = append(ids, id)
+		}
+		r.OnMerge(ctx, ids...)
+	}
+	return len(batch), nil
+}
+
+// mergeNewUser merges an accrual for a user the local region doesn't have
+// yet, copying them from the peer first. When they can't be copied, because
+// the peer no longer has them or their username is taken here, the accrual
+// is parked rather than holding up every later one.
+func (r *Replicator) mergeNewUser(ctx context.Context, q repository.Queries, p Peer, a repository.Accrual) (int64, error) {
+	u, err := p.Store.UserReplica(ctx, a.UserRegion, a.UserID)
+	if err == nil {
+		_, err = q.AddUserReplica(ctx, u)
+	}
+	if err == nil || errors.Is(err, repository.ErrConflict) {
+		// a conflict may also be another instance copying them first
+		userID, err := q.MergeAccrual(ctx, p.Name, a)
+		if !errors.Is(err, repository.ErrNotFound) {
+			return userID, err
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return 0, err
+	}
+	log.Printf("replicate from %s: parking entry %d, user %s/%d can't be copied", p.Name, a.Seq, a.UserRegion, a.UserID)
+	return 0, q.ParkAccrual(ctx, p.Name, a)
+}
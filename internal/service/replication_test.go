@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// A peer's user is a different person from the local user with the same id:
+// their entries go to a copy of them, never to the local user.
+func TestReplicatorCopiesPeerUsers(t *testing.T) {
+	ctx := context.Background()
+	local, eu := repository.NewMemory("us"), repository.NewMemory("eu")
+	alice := mustCreateUser(t, local, "alice")
+	bob := mustCreateUser(t, eu, "bob")
+	if alice.ID != bob.ID {
+		t.Fatalf("want clashing ids, got alice %d and bob %d", alice.ID, bob.ID)
+	}
+	if err := eu.Accrue(ctx, bob.ID, 30, "task:subscribe_telegram"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReplicator(local, []Peer{{Name: "eu", Store: eu}}, 0, 0)
+	var onMerge []int64
+	r.OnMerge = func(ctx context.Context, ids ...int64) { onMerge = append(onMerge, ids...) }
+	if n, err := r.pull(ctx, Peer{Name: "eu", Store: eu}); err != nil || n != 1 {
+		t.Fatalf("pull = %d, %v; want 1, nil", n, err)
+	}
+
+	if got := points(t, local, alice.ID); got != 0 {
+		t.Errorf("alice has %d points, want 0", got)
+	}
+	copyID, _, err := local.GetPasswordHash(ctx, "bob")
+	if err != nil {
+		t.Fatalf("bob wasn't copied: %v", err)
+	}
+	if got := points(t, local, copyID); got != 30 {
+		t.Errorf("bob's copy has %d points, want 30", got)
+	}
+	if home, _ := local.GetHomeRegion(ctx, copyID); home != "eu" {
+		t.Errorf("bob's copy is homed in %q, want eu", home)
+	}
+	if len(onMerge) != 1 || onMerge[0] != copyID {
+		t.Errorf("OnMerge got %v, want [%d]", onMerge, copyID)
+	}
+
+	// a second pull finds nothing new and doesn't copy bob again
+	if n, err := r.pull(ctx, Peer{Name: "eu", Store: eu}); err != nil || n != 0 {
+		t.Fatalf("second pull = %d, %v; want 0, nil", n, err)
+	}
+	if got := points(t, local, copyID); got != 30 {
+		t.Errorf("bob's copy has %d points after a replay, want 30", got)
+	}
+}
+
+// An entry for a user who can't be copied is parked, and replication moves
+// on past it instead of failing the batch.
+func TestReplicatorParksEntriesForUnknownUsers(t *testing.T) {
+	ctx := context.Background()
+	local, eu := repository.NewMemory("us"), repository.NewMemory("eu")
+	localCarol := mustCreateUser(t, local, "carol")
+	// eu's carol is someone else, and the username is taken here
+	carol := mustCreateUser(t, eu, "carol")
+	dave := mustCreateUser(t, eu, "dave")
+	if err := eu.Accrue(ctx, carol.ID, 50, "task:subscribe_twitter"); err != nil {
+		t.Fatal(err)
+	}
+	if err := eu.Accrue(ctx, dave.ID, 20, "task:subscribe_twitter"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReplicator(local, []Peer{{Name: "eu", Store: eu}}, 0, 0)
+	if n, err := r.pull(ctx, Peer{Name: "eu", Store: eu}); err != nil || n != 2 {
+		t.Fatalf("pull = %d, %v; want 2, nil", n, err)
+	}
+
+	if got := points(t, local, localCarol.ID); got != 0 {
+		t.Errorf("local carol has %d points, want 0", got)
+	}
+	daveID, _, err := local.GetPasswordHash(ctx, "dave")
+	if err != nil {
+		t.Fatalf("dave wasn't copied: %v", err)
+	}
+	if got := points(t, local, daveID); got != 20 {
+		t.Errorf("dave's copy has %d points, want 20", got)
+	}
+	sent, err := eu.LocalAccruals(ctx, 0, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := local.ReplicationCursor(ctx, "eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := sent[len(sent)-1].Seq; cursor != last {
+		t.Errorf("cursor = %d, want %d", cursor, last)
+	}
+}
+
+// A copied user is named by their origin id in the region that created them,
+// which is where their writes are forwarded.
+func TestUserIDIn(t *testing.T) {
+	ctx := context.Background()
+	local, eu := repository.NewMemory("us"), repository.NewMemory("eu")
+	mustCreateUser(t, eu, "padding")
+	bob := mustCreateUser(t, eu, "bob")
+	if err := eu.Accrue(ctx, bob.ID, 30, "task:subscribe_telegram"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplicator(local, []Peer{{Name: "eu", Store: eu}}, 0, 0).pull(ctx, Peer{Name: "eu", Store: eu}); err != nil {
+		t.Fatal(err)
+	}
+	copyID, _, err := local.GetPasswordHash(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := mustCreateUser(t, local, "alice")
+
+	s := New(local, Config{Region: "us", JWTSecret: []byte("secret"), AccessTokenTTL: time.Hour})
+	for _, c := range []struct {
+		name    string
+		id      int64
+		region  string
+		want    int64
+		wantErr error
+	}{
+		{"copy in its origin", copyID, "eu", bob.ID, nil},
+		{"copy here", copyID, "us", copyID, nil},
+		{"local user here", alice.ID, "us", alice.ID, nil},
+		{"local user elsewhere", alice.ID, "eu", 0, ErrNoRegionID},
+		{"copy in a third region", copyID, "asia", 0, ErrNoRegionID},
+		{"unknown user", 999, "eu", 0, ErrUserNotFound},
+	} {
+		got, err := s.UserIDIn(ctx, c.id, c.region)
+		if got != c.want || !errors.Is(err, c.wantErr) {
+			t.Errorf("%s: UserIDIn = %d, %v; want %d, %v", c.name, got, err, c.want, c.wantErr)
+		}
+	}
+
+	// eu takes us's forwarded token for bob's id there, and no other token
+	euSvc := New(eu, Config{Region: "eu", JWTSecret: []byte("secret"), AccessTokenTTL: time.Hour})
+	token, err := s.ForwardToken(bob.ID, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := euSvc.ParseForwardToken(token); err != nil || id != bob.ID {
+		t.Errorf("ParseForwardToken = %d, %v; want %d", id, err, bob.ID)
+	}
+	access, err := s.issueAccessToken(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := euSvc.ParseForwardToken(access); err == nil {
+		t.Error("ParseForwardToken took an access token that wasn't forwarded")
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var ErrReportExportNotFound = newError("REPORT_EXPORT_NOT_FOUND", "report export not found or expired")
+
+const AuditReportExported = "report.exported"
+
+// Reports that can be exported as CSV.
+const (
+	ReportLeaderboard = "leaderboard"
+	ReportActivity    = "activity"
+)
+
+// csvPage is how many leaderboard rows a CSV reads at a time.
+const csvPage = 500
+
+// CSVReport is a report ready to be written as CSV. What it needs to fail
+// early on is loaded up front; leaderboards are read page by page while
+// writing.
+type CSVReport struct {
+	// Filename is what the CSV should be saved as.
+	Filename string
+	write    func(ctx context.Context, cw *csv.Writer) error
+}
+
+// Write writes the CSV to w. An error means w got a truncated file.
+func (r *CSVReport) Write(ctx context.Context, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := r.write(ctx, cw); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText guards a text cell against spreadsheets reading it as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// LeaderboardCSV is Leaderboard as CSV: up to limit rows from after on,
+// where limit is capped at, and defaults to, Config.ExportCSVMaxRows.
+// Larger leaderboards can be exported with QueueReportExport.
+func (s *Service) LeaderboardCSV(ctx context.Context, period string, limit int, after *repository.LeaderboardCursor) (*CSVReport, error) {
+	if _, ok := periodKey(period); !ok {
+		return nil, invalid("unknown period")
+	}
+	if limit <= 0 || limit > s.cfg.ExportCSVMaxRows {
+		limit = s.cfg.ExportCSVMaxRows
+	}
+	return s.leaderboardCSV(period, limit, after), nil
+}
+
+// leaderboardCSV writes up to limit rows of the leaderboard, all of them
+// when limit is 0.
+func (s *Service) leaderboardCSV(period string, limit int, after *repository.LeaderboardCursor) *CSVReport {
+	return &CSVReport{
+		Filename: "leaderboard-" + period + ".csv",
+		write: func(ctx context.Context, cw *csv.Writer) error {
+			if err := cw.Write([]string{"rank", "user_id", "username", "display_name", "points"}); err != nil {
+				return err
+			}
+			for n := 0; limit == 0 || n < limit; {
+				size := csvPage
+				if limit > 0 {
+					size = min(size, limit-n)
+				}
+				page, err := s.Leaderboard(ctx, period, size, after)
+				if err != nil {
+					return err
+				}
+				for _, e := range page.Items {
+					cw.Write([]string{strconv.Itoa(e.Rank), strconv.FormatInt(e.ID, 10), csvText(e.Username),
+						csvText(e.DisplayName), strconv.FormatInt(e.Points, 10)})
+				}
+				if cw.Flush(); cw.Error() != nil {
+					return cw.Error()
+				}
+				if page.Next == nil {
+					return nil
+				}
+				n, after = n+len(page.Items), page.Next
+			}
+			return nil
+		},
+	}
+}
+
+// ActivityReportCSV is ActivityReport as CSV: a row per day, then one
+// dated "total" for the range.
+func (s *Service) ActivityReportCSV(ctx context.Context, from, to *time.Time) (*CSVReport, error) {
+	rep, err := s.ActivityReport(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &CSVReport{
+		Filename: "activity-" + rep.From + "-" + rep.To + ".csv",
+		write: func(ctx context.Context, cw *csv.Writer) error {
+			cw.Write([]string{"date", "active_users", "new_users", "referred_new_users", "referral_conversion_rate",
+				"tasks_completed", "referrals", "points_issued", "points_revoked"})
+			row := func(date string, st ActivityStats) {
+				n := func(v int64) string { return strconv.FormatInt(v, 10) }
+				cw.Write([]string{date, n(st.ActiveUsers), n(st.NewUsers), n(st.ReferredNewUsers),
+					strconv.FormatFloat(st.ReferralConversionRate, 'f', 4, 64),
+					n(st.TasksCompleted), n(st.Referrals), n(st.PointsIssued), n(st.PointsRevoked)})
+			}
+			for _, d := range rep.Days {
+				row(d.Date, d.ActivityStats)
+			}
+			row("total", rep.Totals)
+			return nil
+		},
+	}, nil
+}
+
+// ReportExportInput is a report to export in the background. Period is the
+// leaderboard's, "all" by default; From and To (YYYY-MM-DD) bound the
+// activity report as for ActivityReport.
+type ReportExportInput struct {
+	Report string `json:"report"`
+	Period string `json:"period,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// normalize validates in and resolves its defaults, so the export covers
+// what was asked for however long it waits in the queue.
+func (s *Service) normalize(in ReportExportInput) (ReportExportInput, error) {
+	switch in.Report {
+	case ReportLeaderboard:
+		if in.Period == "" {
+			in.Period = "all"
+		}
+		if _, ok := periodKey(in.Period); !ok {
+			return in, invalid("unknown period")
+		}
+		return ReportExportInput{Report: in.Report, Period: in.Period}, nil
+	case ReportActivity:
+		var from, to *time.Time
+		for _, p := range []struct {
+			name, v string
+			dst     **time.Time
+		}{{"from", in.From, &from}, {"to", in.To, &to}} {
+			if p.v == "" {
+				continue
+			}
+			t, err := time.Parse(time.DateOnly, p.v)
+			if err != nil {
+				return in, invalid(p.name + " must be a date, YYYY-MM-DD")
+			}
+			*p.dst = &t
+		}
+		start, end, err := s.reportRange(from, to)
+		if err != nil {
+			return in, err
+		}
+		return ReportExportInput{Report: in.Report, From: start.Format(time.DateOnly), To: end.Format(time.DateOnly)}, nil
+	}
+	return in, invalid("report must be leaderboard or activity")
+}
+
+// QueueReportExport queues a CSV of the whole report, built by RunExports
+// and kept for Config.ExportTTL.
+func (s *Service) QueueReportExport(ctx context.Context, in ReportExportInput) (repository.ReportExport, error) {
+	in, err := s.normalize(in)
+	if err != nil {
+		return repository.ReportExport{}, err
+	}
+	params, err := json.Marshal(in)
+	if err != nil {
+		return repository.ReportExport{}, err
+	}
+	var requestedBy int64
+	if a, ok := ctx.Value(ctxKeyActor{}).(Actor); ok {
+		requestedBy = a.UserID
+	}
+	var e repository.ReportExport
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		if e, err = q.CreateReportExport(ctx, in.Report, params, requestedBy); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditReportExported, "report_export", userTarget(e.ID), nil, in)
+	})
+	return e, err
+}
+
+func (s *Service) ReportExport(ctx context.Context, id int64) (repository.ReportExport, error) {
+	e, err := s.store.GetReportExport(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return e, ErrReportExportNotFound
+	}
+	return e, err
+}
+
+// ReportExportCSV returns a ready report export, its file name and CSV.
+func (s *Service) ReportExportCSV(ctx context.Context, id int64) (repository.ReportExport, string, []byte, error) {
+	e, err := s.ReportExport(ctx, id)
+	if err != nil {
+		return e, "", nil, err
+	}
+	if e.Status != "ready" {
+		return e, "", nil, ErrExportNotReady
+	}
+	content, err := s.store.ReportExportContent(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return e, "", nil, ErrReportExportNotFound
+	}
+	return e, reportExportFilename(e), content, err
+}
+
+func reportExportFilename(e repository.ReportExport) string {
+	return fmt.Sprintf("%s-export-%d.csv", e.Report, e.ID)
+}
+
+// reportCSV is the CSVReport a queued export asked for.
+func (s *Service) reportCSV(ctx context.Context, e repository.ReportExport) (*CSVReport, error) {
+	var in ReportExportInput
+	if err := json.Unmarshal(e.Params, &in); err != nil {
+		return nil, err
+	}
+	if in.Report == ReportLeaderboard {
+		return s.leaderboardCSV(in.Period, 0, nil), nil
+	}
+	from, err := time.Parse(time.DateOnly, in.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := time.Parse(time.DateOnly, in.To)
+	if err != nil {
+		return nil, err
+	}
+	return s.ActivityReportCSV(ctx, &from, &to)
+}
+
+func (s *Service) buildReportExports(ctx context.Context) {
+	jobs, err := s.store.ClaimReportExports(ctx, exportBatch, exportLease)
+	if err != nil {
+		log.Printf("claim report exports: %v", err)
+		return
+	}
+	for _, j := range jobs {
+		var buf bytes.Buffer
+		r, err := s.reportCSV(ctx, j)
+		if err == nil {
+			err = r.Write(ctx, &buf)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		expires := s.now().Add(s.cfg.ExportTTL)
+		if err != nil {
+			log.Printf("report export %d: %v", j.ID, err)
+			err = s.store.FailReportExport(ctx, j.ID, "could not build the export", expires)
+		} else {
+			err = s.store.CompleteReportExport(ctx, j.ID, buf.Bytes(), expires)
+		}
+		if err != nil {
+			log.Printf("report export %d: %v", j.ID, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermReportsRead allows reading aggregated stats through /admin/reports.
+const PermReportsRead = "reports:read"
+
+const (
+	// reportDefaultDays is the range when a report doesn't ask for one.
+	reportDefaultDays = 30
+	// reportMaxDays caps a report's range.
+	reportMaxDays = 366
+)
+
+// ActivityStats are the counts for a day or a whole report, with the share
+// of new users who signed up with a referrer.
+type ActivityStats struct {
+	repository.ReportCounts
+	ReferralConversionRate float64 `json:"referral_conversion_rate"`
+}
+
+func activityStats(c repository.ReportCounts) ActivityStats {
+	s := ActivityStats{ReportCounts: c}
+	if c.NewUsers > 0 {
+		s.ReferralConversionRate = float64(c.ReferredNewUsers) / float64(c.NewUsers)
+	}
+	return s
+}
+
+type ActivityDay struct {
+	Date string `json:"date"`
+	ActivityStats
+}
+
+// ActivityReport covers the UTC days From through To. Totals count a user
+// active in the range once, however many of its days they were active on.
+type ActivityReport struct {
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+	Days   []ActivityDay `json:"days"`
+	Totals ActivityStats `json:"totals"`
+}
+
+// ActivityReport aggregates activity per UTC day from from through to,
+// both inclusive. to defaults to today and from to the 30 days up to to;
+// days without activity are listed with zeros.
+func (s *Service) ActivityReport(ctx context.Context, from, to *time.Time) (ActivityReport, error) {
+	start, end, err := s.reportRange(from, to)
+	if err != nil {
+		return ActivityReport{}, err
+	}
+	until := end.AddDate(0, 0, 1)
+
+	var (
+		days   []repository.ReportDay
+		totals repository.ReportCounts
+	)
+	err = s.read(ctx, func(q repository.Queries) error {
+		var err error
+		if days, err = q.ReportDays(ctx, start, until); err != nil {
+			return err
+		}
+		totals, err = q.ReportTotals(ctx, start, until)
+		return err
+	})
+	if err != nil {
+		return ActivityReport{}, err
+	}
+	byDate := make(map[string]repository.ReportCounts, len(days))
+	for _, d := range days {
+		byDate[d.Date] = d.ReportCounts
+	}
+	rep := ActivityReport{
+		From:   start.Format(time.DateOnly),
+		To:     end.Format(time.DateOnly),
+		Totals: activityStats(totals),
+	}
+	for d := start; d.Before(until); d = d.AddDate(0, 0, 1) {
+		date := d.Format(time.DateOnly)
+		rep.Days = append(rep.Days, ActivityDay{Date: date, ActivityStats: activityStats(byDate[date])})
+	}
+	return rep, nil
+}
+
+// reportRange resolves ActivityReport's defaults to the first and last day
+// of the report.
+func (s *Service) reportRange(from, to *time.Time) (start, end time.Time, err error) {
+	end = s.now().UTC().Truncate(24 * time.Hour)
+	if to != nil {
+		end = to.UTC().Truncate(24 * time.Hour)
+	}
+	start = end.AddDate(0, 0, 1-reportDefaultDays)
+	if from != nil {
+		start = from.UTC().Truncate(24 * time.Hour)
+	}
+	if start.After(end) {
+		return start, end, invalid("from must not be after to")
+	}
+	if end.Sub(start) >= reportMaxDays*24*time.Hour {
+		return start, end, invalid("a report covers at most 366 days")
+	}
+	return start, end, nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// ErrTokenRevoked is returned by ParseAccessToken for a token on the
+// deny-list.
+var ErrTokenRevoked = errors.New("token revoked")
+
+const AuditTokenRevoked = "token.revoked"
+
+// RevokeTokenInput names what to revoke: a token itself, a jti, or every
+// token of a user. ExpiresAt goes with JTI, for tokens that outlive
+// AccessTokenTTL.
+type RevokeTokenInput struct {
+	Token     string     `json:"token,omitempty"`
+	JTI       string     `json:"jti,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UserID    int64      `json:"user_id,omitempty"`
+}
+
+// TokenRevocation is what RevokeToken revoked: one token by JTI, listed
+// until ExpiresAt, or the user's tokens issued up to RevokedBefore.
+type TokenRevocation struct {
+	JTI           string     `json:"jti,omitempty"`
+	UserID        int64      `json:"user_id,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	RevokedBefore *time.Time `json:"revoked_before,omitempty"`
+}
+
+// TokenInfo describes an access token. Active means it would be accepted
+// now; the other fields are left empty for tokens that don't verify.
+type TokenInfo struct {
+	Active    bool       `json:"active"`
+	Revoked   bool       `json:"revoked"`
+	Subject   string     `json:"sub,omitempty"`
+	JTI       string     `json:"jti,omitempty"`
+	KeyID     string     `json:"kid,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	IssuedAt  *time.Time `json:"iat,omitempty"`
+	ExpiresAt *time.Time `json:"exp,omitempty"`
+}
+
+// RevokeToken puts a token on the deny-list, or revokes all of a user's
+// access and refresh tokens. This instance stops accepting them at once;
+// others do within their refresh interval.
+func (s *Service) RevokeToken(ctx context.Context, in RevokeTokenInput) (TokenRevocation, error) {
+	given := 0
+	for _, set := range []bool{in.Token != "", in.JTI != "", in.UserID != 0} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return TokenRevocation{}, invalid("give one of token, jti or user_id")
+	}
+	now := s.now()
+
+	if in.UserID != 0 {
+		err := s.store.InTx(ctx, func(q repository.Queries) error {
+			if err := q.RevokeUserTokens(ctx, in.UserID, now); errors.Is(err, repository.ErrNotFound) {
+				return ErrUserNotFound
+			} else if err != nil {
+				return err
+			}
+			return audit(ctx, q, AuditTokenRevoked, "user", userTarget(in.UserID), nil,
+				map[string]any{"revoked_before": now})
+		})
+		if err != nil {
+			return TokenRevocation{}, err
+		}
+		s.reloadRevocations(ctx)
+		return TokenRevocation{UserID: in.UserID, RevokedBefore: &now}, nil
+	}
+
+	t := repository.RevokedToken{JTI: in.JTI, ExpiresAt: now.Add(s.cfg.AccessTokenTTL)}
+	if in.Token != "" {
+		_, claims, err := s.parseToken(in.Token)
+		if err != nil {
+			return TokenRevocation{}, invalid("token: not a valid access token, or expired")
+		}
+		t.JTI, _ = claims["jti"].(string)
+		if t.JTI == "" {
+			return TokenRevocation{}, invalid("token: has no jti; revoke its user_id instead")
+		}
+		if exp, _ := claims.GetExpirationTime(); exp != nil {
+			t.ExpiresAt = exp.Time
+		}
+		t.UserID = claimsUserID(claims)
+	} else if in.ExpiresAt != nil {
+		if !in.ExpiresAt.After(now) {
+			return TokenRevocation{}, invalid("expires_at: must be in the future")
+		}
+		t.ExpiresAt = *in.ExpiresAt
+	}
+	if len(t.JTI) > 256 {
+		return TokenRevocation{}, invalid("jti: at most 256 characters")
+	}
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		if err := q.RevokeAccessToken(ctx, t); err != nil {
+			return err
+		}
+		after := map[string]any{"jti": t.JTI, "expires_at": t.ExpiresAt}
+		if t.UserID != 0 {
+			after["user_id"] = t.UserID
+		}
+		return audit(ctx, q, AuditTokenRevoked, "token", t.JTI, nil, after)
+	})
+	if err != nil {
+		return TokenRevocation{}, err
+	}
+	s.reloadRevocations(ctx)
+	return TokenRevocation{JTI: t.JTI, UserID: t.UserID, ExpiresAt: &t.ExpiresAt}, nil
+}
+
+// IntrospectToken reports whether token would be accepted and what it
+// claims.
+func (s *Service) IntrospectToken(token string) TokenInfo {
+	var info TokenInfo
+	t, claims, err := s.parseToken(token)
+	if err != nil {
+		return info
+	}
+	info.KeyID, _ = t.Header["kid"].(string)
+	info.Revoked = s.tokenRevoked(claims)
+	info.Active = !info.Revoked
+	info.Subject, _ = claims.GetSubject()
+	info.JTI, _ = claims["jti"].(string)
+	info.Role, _ = claims["role"].(string)
+	if iat, _ := claims.GetIssuedAt(); iat != nil {
+		info.IssuedAt = &iat.Time
+	}
+	if exp, _ := claims.GetExpirationTime(); exp != nil {
+		info.ExpiresAt = &exp.Time
+	}
+	return info
+}
+
+func claimsUserID(claims jwt.MapClaims) int64 {
+	sub, _ := claims.GetSubject()
+	id, _ := strconv.ParseInt(sub, 10, 64)
+	return id
+}
+
+// tokenRevoked checks claims against the last loaded deny-list: the token's
+// jti, and its user's cutoff against when it was issued. A token without
+// iat is revoked by any cutoff.
+func (s *Service) tokenRevoked(claims jwt.MapClaims) bool {
+	r := s.revocations.Load()
+	if r == nil {
+		return false
+	}
+	if jti, _ := claims["jti"].(string); jti != "" {
+		if _, ok := r.JTIs[jti]; ok {
+			return true
+		}
+	}
+	before, ok := r.Users[claimsUserID(claims)]
+	if !ok {
+		return false
+	}
+	// iat has whole seconds, so tokens from the second of the cutoff count
+	iat, _ := claims.GetIssuedAt()
+	return iat == nil || !iat.Time.After(before)
+}
+
+// LoadTokenRevocations replaces this instance's copy of the deny-list.
+func (s *Service) LoadTokenRevocations(ctx context.Context) error {
+	r, err := s.store.TokenRevocations(ctx, s.now())
+	if err != nil {
+		return err
+	}
+	s.revocations.Store(&r)
+	return nil
+}
+
+func (s *Service) reloadRevocations(ctx context.Context) {
+	if err := s.LoadTokenRevocations(ctx); err != nil {
+		log.Printf("token revocations: %v", err)
+	}
+}
+
+// RunTokenRevocations reloads the deny-list every interval, picking up
+// revocations made on other instances.
+func (s *Service) RunTokenRevocations(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.reloadRevocations(ctx)
+		}
+	}
+}
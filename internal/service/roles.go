@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Permissions checked by the HTTP layer. Roles map to them in the
+// role_permissions table.
+const (
+	// PermUsersRead allows reading any user's data, not just one's own.
+	PermUsersRead = "users:read"
+	// PermUsersWrite allows acting on behalf of any user.
+	PermUsersWrite  = "users:write"
+	PermTasksManage = "tasks:manage"
+	PermRolesManage = "roles:manage"
+)
+
+var ErrRoleNotFound = newError("ROLE_NOT_FOUND", "role not found")
+
+// Permissions is the set granted to the user by their roles and by tokenRole,
+// the role claim of the presented token (empty if none).
+func (s *Service) Permissions(ctx context.Context, userID int64, tokenRole string) (map[string]bool, error) {
+	var extra []string
+	if tokenRole != "" {
+		extra = []string{tokenRole}
+	}
+	perms, err := s.store.Permissions(ctx, userID, extra)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set, nil
+}
+
+func (s *Service) ListRoles(ctx context.Context) ([]repository.Role, error) {
+	return s.store.ListRoles(ctx)
+}
+
+func (s *Service) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.store.UserRoles(ctx, userID)
+}
+
+func (s *Service) AssignRole(ctx context.Context, userID int64, role string) error {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return err
+	}
+	err := s.changeRoles(ctx, userID, AuditRoleAssigned, func(q repository.Queries) error {
+		return q.AssignRole(ctx, userID, role)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrRoleNotFound
+	}
+	return err
+}
+
+func (s *Service) RevokeRole(ctx context.Context, userID int64, role string) error {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.changeRoles(ctx, userID, AuditRoleRevoked, func(q repository.Queries) error {
+		return q.RevokeRole(ctx, userID, role)
+	})
+}
+
+// changeRoles applies change and audits the user's roles before and after.
+func (s *Service) changeRoles(ctx context.Context, userID int64, action string, change func(q repository.Queries) error) error {
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.UserRoles(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := change(q); err != nil {
+			return err
+		}
+		after, err := q.UserRoles(ctx, userID)
+		if err != nil {
+			return err
+		}
+		return audit(ctx, q, action, "user", userTarget(userID),
+			map[string]any{"roles": before}, map[string]any{"roles": after})
+	})
+}
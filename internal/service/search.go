@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// FoundUser is a user FindUsers matched. Similarity is how alike the
+// username and the query are by trigrams, from 0 to 1; Prefix is set when
+// the username starts with the query.
+type FoundUser struct {
+	ID          int64   `json:"id"`
+	Username    string  `json:"username"`
+	DisplayName string  `json:"display_name,omitempty"`
+	AvatarURL   string  `json:"avatar_url,omitempty"`
+	Prefix      bool    `json:"prefix"`
+	Similarity  float64 `json:"similarity"`
+}
+
+type UserSearchPage struct {
+	Items []FoundUser
+	// Next is nil on the last page.
+	Next *repository.UserMatchCursor
+}
+
+// FindUsers looks users up by username: those whose name starts with text,
+// ignoring case, come first, then those with a similar name, each closest
+// first. With publicOnly, users who chose to be anonymous or hidden on
+// leaderboards can't be found.
+func (s *Service) FindUsers(ctx context.Context, text string, publicOnly bool, limit int, after *repository.UserMatchCursor) (UserSearchPage, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > 32 {
+		return UserSearchPage{}, invalid("q must be 1-32 characters")
+	}
+	page := UserSearchPage{Items: []FoundUser{}}
+	var matches []repository.UserMatch
+	err := s.read(ctx, func(q repository.Queries) error {
+		var err error
+		matches, err = q.FindUsers(ctx, repository.UserQuery{Text: text, PublicOnly: publicOnly, After: after, Limit: limit})
+		if err != nil || len(matches) == 0 {
+			return err
+		}
+		ids := make([]int64, len(matches))
+		for i, m := range matches {
+			ids[i] = m.ID
+		}
+		profiles, err := q.Profiles(ctx, ids)
+		if err != nil {
+			return err
+		}
+		page.Items = page.Items[:0]
+		for _, m := range matches {
+			p := profiles[m.ID]
+			page.Items = append(page.Items, FoundUser{
+				ID: m.ID, Username: m.Username, DisplayName: p.DisplayName, AvatarURL: p.AvatarURL,
+				Prefix: m.Prefix, Similarity: math.Round(m.Similarity*1000) / 1000,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return UserSearchPage{}, err
+	}
+	if n := len(matches); n == limit && n > 0 {
+		last := matches[n-1]
+		page.Next = &repository.UserMatchCursor{Score: last.Score, ID: last.ID}
+	}
+	return page, nil
+}
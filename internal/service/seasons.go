@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermSeasonsManage allows scheduling, changing and deleting seasons
+// through /admin/seasons.
+const PermSeasonsManage = "seasons:manage"
+
+var (
+	ErrSeasonNotFound = newError("SEASON_NOT_FOUND", "season not found")
+	ErrSeasonOverlap  = newError("SEASON_OVERLAP", "season overlaps another season")
+	ErrSeasonLocked   = newError("SEASON_LOCKED", "season has already started or ended")
+)
+
+const (
+	AuditSeasonCreated  = "season.created"
+	AuditSeasonUpdated  = "season.updated"
+	AuditSeasonDeleted  = "season.deleted"
+	AuditSeasonArchived = "season.archived"
+)
+
+// SeasonInput is a season as admins schedule it. StartsAt defaults to now.
+type SeasonInput struct {
+	Name     string     `json:"name"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   time.Time  `json:"ends_at"`
+}
+
+func (in *SeasonInput) validate(now time.Time) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || utf8.RuneCountInString(in.Name) > 64 {
+		return invalid("name is required, at most 64 characters")
+	}
+	if in.StartsAt == nil {
+		in.StartsAt = &now
+	}
+	if !in.EndsAt.After(*in.StartsAt) {
+		return invalid("ends_at must be after starts_at")
+	}
+	if !in.EndsAt.After(now) {
+		return invalid("ends_at must be in the future")
+	}
+	return nil
+}
+
+func (s *Service) Seasons(ctx context.Context) ([]repository.Season, error) {
+	return s.store.ListSeasons(ctx)
+}
+
+func (s *Service) Season(ctx context.Context, id int64) (repository.Season, error) {
+	se, err := s.store.GetSeason(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return se, ErrSeasonNotFound
+	}
+	return se, err
+}
+
+// CreateSeason schedules a season. Seasons can't overlap, and one can't
+// start in the past: only points earned while a season runs count for it.
+func (s *Service) CreateSeason(ctx context.Context, in SeasonInput) (repository.Season, error) {
+	now := s.now()
+	if in.StartsAt != nil && in.StartsAt.Before(now) {
+		return repository.Season{}, invalid("starts_at must not be in the past")
+	}
+	if err := in.validate(now); err != nil {
+		return repository.Season{}, err
+	}
+	var se repository.Season
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		se, err = q.CreateSeason(ctx, in.Name, *in.StartsAt, in.EndsAt)
+		if errors.Is(err, repository.ErrConflict) {
+			return ErrSeasonOverlap
+		}
+		if err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditSeasonCreated, "season", userTarget(se.ID), nil, se)
+	})
+	return se, err
+}
+
+// UpdateSeason replaces a season's name and window. Once a season has
+// started only its name and end can change, and the end can't be moved
+// into the past; ended seasons can't change at all.
+func (s *Service) UpdateSeason(ctx context.Context, id int64, in SeasonInput) (repository.Season, error) {
+	now := s.now()
+	var after repository.Season
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetSeason(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrSeasonNotFound
+		}
+		if err != nil {
+			return err
+		}
+		switch before.Status {
+		case repository.SeasonUpcoming:
+			if in.StartsAt != nil && in.StartsAt.Before(now) {
+				return invalid("starts_at must not be in the past")
+			}
+		case repository.SeasonActive:
+			if in.StartsAt != nil && !in.StartsAt.Equal(before.StartsAt) {
+				return ErrSeasonLocked
+			}
+			in.StartsAt = &before.StartsAt
+		default:
+			return ErrSeasonLocked
+		}
+		if err := in.validate(now); err != nil {
+			return err
+		}
+		err = q.UpdateSeason(ctx, id, in.Name, *in.StartsAt, in.EndsAt)
+		if errors.Is(err, repository.ErrConflict) {
+			return ErrSeasonOverlap
+		}
+		if err != nil {
+			return err
+		}
+		if after, err = q.GetSeason(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditSeasonUpdated, "season", userTarget(id), before, after)
+	})
+	return after, err
+}
+
+// DeleteSeason drops a season that hasn't started yet.
+func (s *Service) DeleteSeason(ctx context.Context, id int64) error {
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetSeason(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrSeasonNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if before.Status != repository.SeasonUpcoming {
+			return ErrSeasonLocked
+		}
+		if err := q.DeleteSeason(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditSeasonDeleted, "season", userTarget(id), before, nil)
+	})
+}
+
+// SeasonLeaderboard ranks users by the points they earned in the season:
+// live while it runs, the archived final standings once it is over.
+func (s *Service) SeasonLeaderboard(ctx context.Context, id int64, limit int, after *repository.LeaderboardCursor) (LeaderboardPage, error) {
+	var (
+		items []repository.LeaderboardEntry
+		total int64
+	)
+	err := s.read(ctx, func(q repository.Queries) error {
+		var err error
+		if items, err = q.SeasonLeaderboard(ctx, id, limit, after); err != nil {
+			return err
+		}
+		if total, err = q.SeasonUsers(ctx, id); err != nil {
+			return err
+		}
+		return s.withProfiles(ctx, q, items)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return LeaderboardPage{}, ErrSeasonNotFound
+	}
+	if err != nil {
+		return LeaderboardPage{}, err
+	}
+	anonymize(items)
+	return LeaderboardPage{Items: items, Total: total, Next: nextCursor(items, limit)}, nil
+}
+
+// ArchiveSeasons archives the final standings of seasons that are over.
+// It is a scheduled job; each season is archived once.
+func (s *Service) ArchiveSeasons(ctx context.Context) error {
+	_, err := s.ArchiveEndedSeasons(ctx)
+	return err
+}
+
+// ArchiveEndedSeasons is ArchiveSeasons run now, for admins rolling over
+// to the next season without waiting for the job. It returns the seasons
+// it archived.
+func (s *Service) ArchiveEndedSeasons(ctx context.Context) ([]repository.Season, error) {
+	ended, err := s.store.EndedSeasons(ctx)
+	if err != nil {
+		return nil, err
+	}
+	archived := []repository.Season{}
+	var errs []error
+	for _, se := range ended {
+		err := s.store.InTx(ctx, func(q repository.Queries) error {
+			if err := q.ArchiveSeason(ctx, se.ID); err != nil {
+				return err
+			}
+			n, err := q.SeasonUsers(ctx, se.ID)
+			if err != nil {
+				return err
+			}
+			if err := audit(ctx, q, AuditSeasonArchived, "season", userTarget(se.ID), nil, map[string]any{"users": n}); err != nil {
+				return err
+			}
+			return emit(ctx, q, EventSeasonEnded, map[string]any{"season_id": se.ID, "name": se.Name, "users": n})
+		})
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			// another instance got to it first
+		case err != nil:
+			errs = append(errs, fmt.Errorf("season %d: %w", se.ID, err))
+		default:
+			log.Printf("archived season %d", se.ID)
+			se.Status = repository.SeasonArchived
+			archived = append(archived, se)
+		}
+	}
+	return archived, errors.Join(errs...)
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Fixture is what Seed loads into the store for local development and
+// demos.
+type Fixture struct {
+	Categories []CategoryInput `json:"categories"`
+	Tasks      []TaskInput     `json:"tasks"`
+	Users      []FixtureUser   `json:"users"`
+}
+
+// FixtureUser is a user to create. Without a password they can only use
+// minted tokens. Points is a starting balance, granted when the user is
+// created. ReferredBy names their referrer by username.
+type FixtureUser struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	Points     int64    `json:"points,omitempty"`
+	ReferredBy string   `json:"referred_by,omitempty"`
+}
+
+// SeedCounts is how many of one kind of thing Seed created, and how many
+// it found already there.
+type SeedCounts struct {
+	Created  int `json:"created"`
+	Existing int `json:"existing"`
+}
+
+type SeedResult struct {
+	Categories SeedCounts `json:"categories"`
+	Tasks      SeedCounts `json:"tasks"`
+	Users      SeedCounts `json:"users"`
+	Roles      SeedCounts `json:"roles"`
+	Referrals  SeedCounts `json:"referrals"`
+}
+
+// Seed creates whatever in f doesn't exist yet: categories and tasks by
+// code, users by username, their roles, and referrals of users without a
+// referrer. What exists is left as it is, so loading the same fixture again
+// changes nothing. Everything goes through the same paths as the API, so it
+// is audited and referral bonuses are paid, or left pending as for any
+// referral.
+func (s *Service) Seed(ctx context.Context, f Fixture) (SeedResult, error) {
+	var res SeedResult
+	seen := map[string]bool{}
+	for _, u := range f.Users {
+		switch {
+		case seen[u.Username]:
+			return res, invalid(fmt.Sprintf("users: %q is listed twice", u.Username))
+		case u.Points < 0:
+			return res, invalid(fmt.Sprintf("users: %q: points can't be negative", u.Username))
+		case u.ReferredBy == u.Username:
+			return res, invalid(fmt.Sprintf("users: %q: referred_by is the user itself", u.Username))
+		}
+		seen[u.Username] = true
+	}
+
+	for _, in := range f.Categories {
+		_, err := s.CreateCategory(ctx, in)
+		if err := tally(&res.Categories, err, ErrCategoryExists); err != nil {
+			return res, fmt.Errorf("category %q: %w", in.Code, err)
+		}
+	}
+	// in order, so requires can name tasks listed before
+	for _, in := range f.Tasks {
+		_, err := s.CreateTask(ctx, in)
+		if err := tally(&res.Tasks, err, ErrTaskExists); err != nil {
+			return res, fmt.Errorf("task %q: %w", in.Code, err)
+		}
+	}
+
+	ids := map[string]int64{}
+	for _, fu := range f.Users {
+		id, err := s.userID(ctx, fu.Username)
+		if err == nil {
+			ids[fu.Username] = id
+			res.Users.Existing++
+			continue
+		}
+		if !errors.Is(err, ErrUserNotFound) {
+			return res, err
+		}
+		u, err := s.createUser(ctx, fu.Username, fu.Password)
+		if err != nil {
+			return res, fmt.Errorf("user %q: %w", fu.Username, err)
+		}
+		ids[fu.Username] = u.ID
+		res.Users.Created++
+		if fu.Points > 0 {
+			err := s.store.InTx(ctx, func(q repository.Queries) error {
+				return s.accrue(ctx, q, AuditPointsAdjusted, u.ID, fu.Points, "seed", nil)
+			})
+			if err != nil {
+				return res, fmt.Errorf("user %q: %w", fu.Username, err)
+			}
+			s.RefreshCachedPoints(ctx, u.ID)
+		}
+	}
+
+	// referrers may come later in the file, or be users already there
+	for _, fu := range f.Users {
+		id := ids[fu.Username]
+		if len(fu.Roles) > 0 {
+			have, err := s.store.UserRoles(ctx, id)
+			if err != nil {
+				return res, err
+			}
+			for _, role := range fu.Roles {
+				if slices.Contains(have, role) {
+					res.Roles.Existing++
+					continue
+				}
+				if err := s.AssignRole(ctx, id, role); err != nil {
+					return res, fmt.Errorf("user %q: role %q: %w", fu.Username, role, err)
+				}
+				res.Roles.Created++
+			}
+		}
+		if fu.ReferredBy == "" {
+			continue
+		}
+		referrer, ok := ids[fu.ReferredBy]
+		if !ok {
+			var err error
+			if referrer, err = s.userID(ctx, fu.ReferredBy); err != nil {
+				return res, fmt.Errorf("user %q: referred_by %q: %w", fu.Username, fu.ReferredBy, err)
+			}
+		}
+		_, err := s.SetReferrer(ctx, id, referrer)
+		if err := tally(&res.Referrals, err, ErrReferrerAlreadySet); err != nil {
+			return res, fmt.Errorf("user %q: referred_by %q: %w", fu.Username, fu.ReferredBy, err)
+		}
+	}
+	return res, nil
+}
+
+// tally adds a creation to c, or an existing one when err is exists, and
+// returns any other error.
+func tally(c *SeedCounts, err, exists error) error {
+	switch {
+	case errors.Is(err, exists):
+		c.Existing++
+	case err != nil:
+		return err
+	default:
+		c.Created++
+	}
+	return nil
+}
+
+func (s *Service) userID(ctx context.Context, username string) (int64, error) {
+	id, _, err := s.store.GetPasswordHash(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, ErrUserNotFound
+	}
+	return id, err
+}
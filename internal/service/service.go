@@ -0,0 +1,200 @@
+// Package service holds the business rules (idempotent task completion,
+// referral bonuses, token rotation, standings) on top of repository.Store.
+package service
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// tracer wraps the multi-query operations so their SQL spans share a parent.
+var tracer = otel.Tracer("github.com/example/go-user-tasks/internal/service")
+
+var (
+	ErrUserNotFound        = newError("USER_NOT_FOUND", "user not found")
+	ErrUnknownTask         = newError("UNKNOWN_TASK", "unknown task")
+	ErrTaskUnavailable     = newError("TASK_UNAVAILABLE", "task not available")
+	ErrTaskExpired         = newError("TASK_EXPIRED", "task has ended")
+	ErrTaskExhausted       = newError("TASK_EXHAUSTED", "task has no completions left")
+	ErrTaskLocked          = newError("TASK_LOCKED", "task locked: complete its prerequisites first")
+	ErrTaskNotFound        = newError("TASK_NOT_FOUND", "task not found")
+	ErrTaskExists          = newError("TASK_EXISTS", "task already exists")
+	ErrSelfReferral        = newError("SELF_REFERRAL", "cannot refer yourself")
+	ErrReferrerAlreadySet  = newError("REFERRER_ALREADY_SET", "referrer already set")
+	ErrReferrerNotFound    = newError("REFERRER_NOT_FOUND", "referrer not found")
+	ErrSelfTransfer        = newError("SELF_TRANSFER", "cannot transfer to yourself")
+	ErrRecipientNotFound   = newError("RECIPIENT_NOT_FOUND", "recipient not found")
+	ErrInsufficientPoints  = newError("INSUFFICIENT_POINTS", "insufficient points")
+	ErrTransferCapExceeded = newError("TRANSFER_CAP_EXCEEDED", "daily transfer cap exceeded")
+	ErrUsernameTaken       = newError("USERNAME_TAKEN", "username taken")
+	ErrInvalidCredentials  = newError("INVALID_CREDENTIALS", "invalid credentials")
+	ErrInvalidRefreshToken = newError("INVALID_REFRESH_TOKEN", "invalid refresh token")
+	ErrRefreshTokenExpired = newError("REFRESH_TOKEN_EXPIRED", "refresh token expired")
+)
+
+// ValidationError reports a malformed input; its message is safe to show to
+// clients.
+type ValidationError struct {
+	Msg string
+}
+
+func (e *ValidationError) Error() string { return e.Msg }
+
+func invalid(msg string) error { return &ValidationError{Msg: msg} }
+
+type Config struct {
+	// JWTSecret signs access tokens without a kid header. JWTKeys are
+	// further HS256 secrets by kid; tokens are signed with JWTKeys[JWTKeyID]
+	// when JWTKeyID is set, and verified with whichever key their kid names.
+	// Once JWTKeyID is set, JWTSecret only verifies tokens without a kid
+	// while JWTAcceptUnkeyed is set.
+	JWTSecret        []byte
+	JWTKeys          map[string][]byte
+	JWTKeyID         string
+	JWTAcceptUnkeyed bool
+	// JWTAlgorithms lists accepted signing algorithms (default HS256). RS*
+	// tokens are verified with JWKS and checked against JWTIssuer and
+	// JWTAudience when those are set. Their sub is an account at
+	// JWTProvider (default idp), which stands for the user it is linked to;
+	// their role claim only counts as the local role JWTRoleMap maps it to.
+	JWTAlgorithms   []string
+	JWKS            KeySource
+	JWTIssuer       string
+	JWTAudience     string
+	JWTProvider     string
+	JWTRoleMap      map[string]string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// OAuthProviders are the providers users can sign in with, by name.
+	// Their callbacks are OAuthRedirectBaseURL/auth/{name}/callback.
+	OAuthProviders       map[string]OAuthProvider
+	OAuthRedirectBaseURL string
+	// Partners are the partners whose accounts can be linked to users.
+	Partners []string
+	// Password reset tokens last PasswordResetTTL, at most
+	// PasswordResetMaxPerHour are sent to a user, and the email links to
+	// PasswordResetURL followed by the token.
+	PasswordResetTTL        time.Duration
+	PasswordResetMaxPerHour int
+	PasswordResetURL        string
+	ReceiptSecret           []byte
+	Region                  string
+	RefBonusToReferrer      int64
+	RefBonusToReferred      int64
+	// RefPayout holds referral bonuses back until the referred user reaches
+	// it, unless it is zero; PayReferrals pays them. Those still pending
+	// after RefPayoutExpiry are dropped; 0 keeps them forever.
+	RefPayout       repository.ReferralMilestone
+	RefPayoutExpiry time.Duration
+	RefCaps         ReferralCaps
+	// RefLandingURL is where /r/{code} sends visitors, with the referral
+	// token added as ?ref=. Signing up within RefAttribution of the click
+	// with that token sets the referrer. RefLinkBaseURL is the public URL
+	// referral links are made with; without it they are only codes.
+	RefLandingURL  string
+	RefLinkBaseURL string
+	RefAttribution time.Duration
+	// TransferDailyCap limits the points a user can send per day; 0 means
+	// no cap.
+	TransferDailyCap int64
+	// IdempotencyTTL is how long Idempotency-Key responses are replayed;
+	// IdempotencyLease is how long an in-flight claim blocks retries.
+	IdempotencyTTL   time.Duration
+	IdempotencyLease time.Duration
+	// Cache is optional; when set it serves the top of the lifetime
+	// leaderboard.
+	Cache LeaderboardCache
+	// StreakMultipliers[n-1] scales task points on day n of a streak; days
+	// past the end use the last entry. StreakMax, when positive, caps the
+	// streak.
+	StreakMultipliers []float64
+	StreakMax         int
+	// LevelThresholds[n-1] is the points level n starts at and
+	// LevelBonuses[n-1] what reaching it pays.
+	LevelsEnabled   bool
+	LevelThresholds []int64
+	LevelBonuses    []int64
+	// CheckinRewards[n-1] is paid for day n of a run of daily check-ins;
+	// days past the end use the last entry.
+	CheckinRewards []int64
+	// Verifiers are the checks tasks can name in their verifier field.
+	Verifiers map[string]Verifier
+	// DeletionGrace is how long a deleted user can be restored.
+	DeletionGrace time.Duration
+	// StatusRecentTasks is how many of the user's latest completions
+	// UserStatus lists; the rest are paged with CompletedTasks.
+	StatusRecentTasks int
+	// ExportAsyncThreshold is the most ledger entries a user can have and
+	// still get their export in the response; larger exports are queued
+	// and kept for ExportTTL.
+	ExportAsyncThreshold int64
+	ExportTTL            time.Duration
+	// ExportCSVMaxRows caps the rows of a leaderboard CSV in a response.
+	ExportCSVMaxRows int
+	// TeamMaxMembers is how many users a team can hold.
+	TeamMaxMembers int
+	// DefaultLocale is the language of tasks' own titles and descriptions.
+	DefaultLocale string
+	// Channels are where users can have notifications sent, by name.
+	Channels map[string]NotificationChannel
+	// NotifyRankTop is how high on the lifetime leaderboard a user must
+	// climb to be notified of their new rank; 0 turns rank notifications
+	// off.
+	NotifyRankTop int
+	// PrecomputedLeaderboards serves leaderboards and ranks from the
+	// ranks RefreshLeaderboards last worked out, when it has run for the
+	// current window, instead of ranking users on every read.
+	PrecomputedLeaderboards bool
+	// DistributionRefresh is how long each instance serves a period's
+	// points distribution before counting it again.
+	DistributionRefresh time.Duration
+	// Replica is optional; when set it serves the status, leaderboard, rank
+	// and report reads, falling back to the primary for ReplicaRetry after
+	// an error.
+	Replica      repository.Queries
+	ReplicaRetry time.Duration
+	// FlagDefaults is each feature flag's rollout percentage until one is
+	// set at runtime; a flag it doesn't name is on for everyone. Runtime
+	// settings are reloaded every FlagsRefresh.
+	FlagDefaults map[string]int
+	FlagsRefresh time.Duration
+	// Maintenance is the maintenance mode until one is set at runtime,
+	// reloaded every FlagsRefresh too; its Source and UpdatedAt are
+	// ignored.
+	Maintenance Maintenance
+}
+
+type Service struct {
+	store repository.Store
+	cfg   Config
+	now   func() time.Time
+	// revocations is the access token deny-list as last loaded
+	revocations atomic.Pointer[repository.TokenRevocations]
+	// replicaDown is when, in Unix nanoseconds, reads may go back to the
+	// replica
+	replicaDown      atomic.Int64
+	flagCache        flagCache
+	maintenanceCache maintenanceCache
+	distributions    distributionCache
+}
+
+func New(store repository.Store, cfg Config) *Service {
+	return &Service{store: store, cfg: cfg, now: time.Now}
+}
+
+// Region is the region this instance writes ledger entries as.
+func (s *Service) Region() string { return s.cfg.Region }
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/example/go-user-tasks/internal/migrations"
+	"github.com/example/go-user-tasks/internal/repository"
+	_ "modernc.org/sqlite"
+)
+
+// testStores are the stores service tests run against: the memory store
+// and a migrated SQLite database in a temporary file.
+func testStores(t *testing.T) map[string]repository.Store {
+	return map[string]repository.Store{
+		"memory": repository.NewMemory("local"),
+		"sqlite": newSQLiteStore(t),
+	}
+}
+
+// newSQLiteStore opens a fresh database as cmd/server does.
+func newSQLiteStore(t testing.TB) *repository.SQLite {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") +
+		"?_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.ApplySQLite(context.Background(), db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return repository.NewSQLite(db, "local")
+}
+
+func mustCreateUser(t testing.TB, store repository.Store, username string) repository.User {
+	t.Helper()
+	u, err := store.CreateUser(context.Background(), username, "", "")
+	if err != nil {
+		t.Fatalf("create %s: %v", username, err)
+	}
+	return u
+}
+
+func points(t testing.TB, store repository.Store, id int64) int64 {
+	t.Helper()
+	u, err := store.GetUser(context.Background(), id)
+	if err != nil {
+		t.Fatalf("get user %d: %v", id, err)
+	}
+	return u.Points
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+const AuditSettingsUpdated = "user.settings_updated"
+
+// anonymousName is what leaderboards show for anonymous users.
+const anonymousName = "Anonymous"
+
+// SettingsInput is a partial settings update: nil fields are left as they
+// are.
+type SettingsInput struct {
+	// LeaderboardVisibility is "public", "anonymous" (listed without name,
+	// display name or avatar) or "hidden" (not listed at all).
+	LeaderboardVisibility *string `json:"leaderboard_visibility"`
+}
+
+func (in SettingsInput) apply(st repository.Settings) (repository.Settings, error) {
+	if v := in.LeaderboardVisibility; v != nil {
+		switch *v {
+		case repository.VisibilityPublic, repository.VisibilityAnonymous, repository.VisibilityHidden:
+			st.LeaderboardVisibility = *v
+		default:
+			return st, invalid("leaderboard_visibility must be public, anonymous or hidden")
+		}
+	}
+	return st, nil
+}
+
+func (s *Service) Settings(ctx context.Context, userID int64) (repository.Settings, error) {
+	st, err := s.store.GetSettings(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return st, ErrUserNotFound
+	}
+	return st, err
+}
+
+// UpdateSettings applies in to the user's settings and returns the result.
+// Leaderboards, including the cached and live ones, follow right away.
+func (s *Service) UpdateSettings(ctx context.Context, userID int64, in SettingsInput) (repository.Settings, error) {
+	if _, err := in.apply(repository.Settings{}); err != nil {
+		return repository.Settings{}, err
+	}
+	var (
+		out     repository.Settings
+		changed bool
+	)
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		changed = false
+		before, err := q.GetSettings(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if out, err = in.apply(before); err != nil {
+			return err
+		}
+		if out == before {
+			return nil
+		}
+		changed = true
+		if err := q.UpdateSettings(ctx, userID, out); err != nil {
+			return err
+		}
+		if err := audit(ctx, q, AuditSettingsUpdated, "user", userTarget(userID), before, out); err != nil {
+			return err
+		}
+		return emit(ctx, q, EventSettingsUpdated, map[string]any{
+			"user_id":                userID,
+			"leaderboard_visibility": out.LeaderboardVisibility,
+		})
+	})
+	if err != nil || !changed {
+		return out, err
+	}
+	if out.LeaderboardVisibility == repository.VisibilityHidden {
+		s.dropCachedUsers(ctx, userID)
+	} else {
+		s.RefreshCachedPoints(ctx, userID)
+	}
+	return out, nil
+}
+
+// anonymize blanks the name, display name and avatar of anonymous entries,
+// after withProfiles has filled them in. Ids stay so cursors and live deltas
+// still line up.
+func anonymize(items []repository.LeaderboardEntry) {
+	for i := range items {
+		if items[i].Anonymous {
+			items[i].Username, items[i].DisplayName, items[i].AvatarURL = anonymousName, "", ""
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+func (s *Service) getUser(ctx context.Context, id int64) (repository.User, error) {
+	u, err := s.store.GetUser(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+// HomeRegion returns the region that owns writes for the user, "" for any.
+func (s *Service) HomeRegion(ctx context.Context, userID int64) (string, error) {
+	home, err := s.store.GetHomeRegion(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", nil
+	}
+	return home, err
+}
+
+// ErrNoRegionID is UserIDIn's error for a region whose id for the user isn't
+// known here.
+var ErrNoRegionID = newError("WRONG_REGION", "the user's id in their home region isn't known here")
+
+// UserIDIn returns the user's id in region. Each region numbers its users on
+// its own, so this region only knows its own id for them and the one in the
+// region that created them.
+func (s *Service) UserIDIn(ctx context.Context, userID int64, region string) (int64, error) {
+	if region == s.cfg.Region {
+		return userID, nil
+	}
+	origin, originID, err := s.store.UserOrigin(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, ErrUserNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if origin != region {
+		return 0, ErrNoRegionID
+	}
+	return originID, nil
+}
+
+// UserStatus is a user with how many tasks they have completed and the
+// latest of those completions.
+type UserStatus struct {
+	User           repository.User
+	CompletedCount int64
+	// Recent are the latest Config.StatusRecentTasks completions, newest
+	// first.
+	Recent []repository.CompletedTask
+	// Level is nil with levels off.
+	Level *LevelStatus
+	// TopPercent places the user's lifetime points in the distribution
+	// last counted by PointsDistribution.
+	TopPercent float64
+}
+
+// UserStatus returns the user, their completion count and latest
+// completions, with titles localized for the locales in ctx.
+func (s *Service) UserStatus(ctx context.Context, id int64) (UserStatus, error) {
+	var st UserStatus
+	err := s.read(ctx, func(q repository.Queries) error {
+		var err error
+		if st.User, err = q.GetUser(ctx, id); err != nil {
+			return err
+		}
+		if st.CompletedCount, err = q.CountCompletedTasks(ctx, id); err != nil {
+			return err
+		}
+		levels, err := q.UserLevels(ctx, []int64{id})
+		if err != nil {
+			return err
+		}
+		st.Level = s.levelStatus(levels[id])
+		st.Recent = nil
+		if s.cfg.StatusRecentTasks > 0 {
+			st.Recent, err = q.CompletedTasksPage(ctx, id, s.cfg.StatusRecentTasks, nil)
+		}
+		return err
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return st, ErrUserNotFound
+	}
+	if err != nil {
+		return st, err
+	}
+	d, err := s.distribution(ctx, "all")
+	if err != nil {
+		return st, err
+	}
+	st.TopPercent = d.standing(st.User.Points).TopPercent
+	return st, s.localizeCompleted(ctx, st.Recent)
+}
+
+type CompletedTasksPage struct {
+	Items []repository.CompletedTask
+	// Next is nil on the last page.
+	Next *repository.CompletedTaskCursor
+}
+
+// CompletedTasks pages the user's completions newest first, after the last
+// one of the previous page, localized like UserStatus.
+func (s *Service) CompletedTasks(ctx context.Context, id int64, limit int, after *repository.CompletedTaskCursor) (CompletedTasksPage, error) {
+	var page CompletedTasksPage
+	err := s.read(ctx, func(q repository.Queries) error {
+		if _, err := q.GetUser(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		page.Items, err = q.CompletedTasksPage(ctx, id, limit, after)
+		return err
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return page, ErrUserNotFound
+	}
+	if err != nil {
+		return page, err
+	}
+	if n := len(page.Items); n == limit && n > 0 {
+		last := page.Items[n-1]
+		page.Next = &repository.CompletedTaskCursor{CompletedAt: last.CompletedAt, Code: last.Code, N: last.N}
+	}
+	return page, s.localizeCompleted(ctx, page.Items)
+}
+
+type LeaderboardPage struct {
+	Items []repository.LeaderboardEntry
+	Total int64
+	// Next is nil on the last page.
+	Next *repository.LeaderboardCursor
+	// AsOf is when the ranks were worked out, for a page served from the
+	// precomputed leaderboard; nil for a live one.
+	AsOf *time.Time
+}
+
+// Leaderboard ranks users by lifetime points for period "all", or by points
+// earned in the current window for "daily", "weekly" and "monthly". Windowed
+// boards only list users who earned something in the window. With
+// PrecomputedLeaderboards, pages come from the last RefreshLeaderboards run.
+func (s *Service) Leaderboard(ctx context.Context, period string, limit int, after *repository.LeaderboardCursor) (LeaderboardPage, error) {
+	key, ok := periodKey(period)
+	if !ok {
+		return LeaderboardPage{}, invalid("unknown period")
+	}
+	if key == "all" && after == nil {
+		if page, ok := s.cachedTop(ctx, limit); ok {
+			err := s.read(ctx, func(q repository.Queries) error { return s.withProfiles(ctx, q, page.Items) })
+			if err != nil {
+				return LeaderboardPage{}, err
+			}
+			anonymize(page.Items)
+			page.Next = nextCursor(page.Items, limit)
+			return page, nil
+		}
+	}
+	var page LeaderboardPage
+	err := s.read(ctx, func(q repository.Queries) error {
+		var err error
+		page, err = s.leaderboard(ctx, q, key, limit, after)
+		return err
+	})
+	return page, err
+}
+
+func (s *Service) leaderboard(ctx context.Context, q repository.Queries, key string, limit int, after *repository.LeaderboardCursor) (LeaderboardPage, error) {
+	page, ok, err := s.rankedPage(ctx, q, key, limit, after)
+	if err != nil || ok {
+		return page, err
+	}
+	items, err := q.Leaderboard(ctx, key, limit, after)
+	if err != nil {
+		return LeaderboardPage{}, err
+	}
+	total, err := boardTotal(ctx, q, key)
+	if err != nil {
+		return LeaderboardPage{}, err
+	}
+	if err := s.withProfiles(ctx, q, items); err != nil {
+		return LeaderboardPage{}, err
+	}
+	anonymize(items)
+	return LeaderboardPage{Items: items, Total: total, Next: nextCursor(items, limit)}, nil
+}
+
+// rankedPage is the page from the precomputed leaderboard; ok is false when
+// it is off or hasn't been refreshed for the current window.
+func (s *Service) rankedPage(ctx context.Context, q repository.Queries, key string, limit int, after *repository.LeaderboardCursor) (LeaderboardPage, bool, error) {
+	if !s.cfg.PrecomputedLeaderboards {
+		return LeaderboardPage{}, false, nil
+	}
+	snap, err := q.RankSnapshot(ctx, key)
+	if errors.Is(err, repository.ErrNotFound) {
+		return LeaderboardPage{}, false, nil
+	}
+	if err != nil {
+		return LeaderboardPage{}, false, err
+	}
+	items, err := q.RankedLeaderboard(ctx, key, limit, after)
+	if err != nil {
+		return LeaderboardPage{}, false, err
+	}
+	total, err := boardTotal(ctx, q, key)
+	if err != nil {
+		return LeaderboardPage{}, false, err
+	}
+	if err := s.withProfiles(ctx, q, items); err != nil {
+		return LeaderboardPage{}, false, err
+	}
+	anonymize(items)
+	return LeaderboardPage{Items: items, Total: total, Next: nextCursor(items, limit), AsOf: &snap.RefreshedAt}, true, nil
+}
+
+func boardTotal(ctx context.Context, q repository.Queries, key string) (int64, error) {
+	if key == "all" {
+		return q.TotalUsers(ctx)
+	}
+	return q.PeriodUsers(ctx, key)
+}
+
+// RefreshLeaderboards works out the ranks of every leaderboard period for
+// PrecomputedLeaderboards, rewriting only the rows that moved. It is a
+// scheduled job.
+func (s *Service) RefreshLeaderboards(ctx context.Context) error {
+	for _, p := range percentilePeriods {
+		var n int64
+		err := s.store.InTx(ctx, func(q repository.Queries) error {
+			var err error
+			n, err = q.RefreshRanks(ctx, p.key)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("refresh %s leaderboard: %w", p.name, err)
+		}
+		if n > 0 {
+			log.Printf("refresh leaderboards: %s: %d ranks changed", p.name, n)
+		}
+	}
+	return nil
+}
+
+func nextCursor(items []repository.LeaderboardEntry, limit int) *repository.LeaderboardCursor {
+	if len(items) < limit || len(items) == 0 {
+		return nil
+	}
+	last := items[len(items)-1]
+	return &repository.LeaderboardCursor{Points: last.Points, ID: last.ID}
+}
+
+// PointsHistory pages the ledger newest first; before is the id of the last
+// entry on the previous page.
+func (s *Service) PointsHistory(ctx context.Context, userID, before int64, limit int) ([]repository.LedgerEntry, error) {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	return s.store.ListTransactions(ctx, userID, before, limit)
+}
+
+// PointsBalance is a user's balance as of At, worked out from their points
+// stream. Seq is the last entry it includes, 0 when there is none yet.
+type PointsBalance struct {
+	UserID int64     `json:"user_id"`
+	At     time.Time `json:"at"`
+	Points int64     `json:"points"`
+	Seq    int64     `json:"seq"`
+}
+
+// BalanceAt is the user's balance as of at.
+func (s *Service) BalanceAt(ctx context.Context, userID int64, at time.Time) (PointsBalance, error) {
+	var out PointsBalance
+	err := s.read(ctx, func(q repository.Queries) error {
+		out = PointsBalance{UserID: userID, At: at}
+		if _, err := q.GetUser(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+		e, err := q.BalanceAt(ctx, userID, at)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		out.Points, out.Seq = e.Balance, e.Seq
+		return nil
+	})
+	return out, err
+}
+
+// NextRank is the user one place up and what it takes to pass them. Ties
+// go to the lower user id, so PointsNeeded includes the point that breaks
+// the tie.
+type NextRank struct {
+	Rank         int    `json:"rank"`
+	UserID       int64  `json:"user_id"`
+	Username     string `json:"username"`
+	Points       int64  `json:"points"`
+	PointsNeeded int64  `json:"points_needed"`
+}
+
+type Rank struct {
+	UserID int64     `json:"user_id"`
+	Period string    `json:"period"`
+	Rank   int       `json:"rank"`
+	Points int64     `json:"points"`
+	Next   *NextRank `json:"next"`
+	// AsOf is set when the rank comes from the precomputed leaderboard.
+	AsOf *time.Time `json:"as_of,omitempty"`
+}
+
+// UserRank places the user on the period's leaderboard (see Leaderboard).
+func (s *Service) UserRank(ctx context.Context, userID int64, period string) (Rank, error) {
+	key, ok := periodKey(period)
+	if !ok {
+		return Rank{}, invalid("unknown period")
+	}
+	var out Rank
+	err := s.read(ctx, func(q repository.Queries) error {
+		var err error
+		out, err = s.userRank(ctx, q, userID, period, key)
+		return err
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return out, ErrUserNotFound
+	}
+	return out, err
+}
+
+// FriendsBoard is the leaderboard of a user's referral network.
+type FriendsBoard struct {
+	Period string                        `json:"period"`
+	Items  []repository.LeaderboardEntry `json:"leaderboard"`
+	Total  int                           `json:"total"`
+	// User is the user's own entry, which may rank below Items.
+	User repository.LeaderboardEntry `json:"user"`
+}
+
+// FriendsLeaderboard ranks the user among their referrer and the users
+// they referred, up to limit of them, by points in period as Leaderboard
+// does. The user is always ranked, whatever their visibility; the others
+// show as they chose. It never comes from the precomputed leaderboard.
+func (s *Service) FriendsLeaderboard(ctx context.Context, userID int64, period string, limit int) (FriendsBoard, error) {
+	key, ok := periodKey(period)
+	if !ok {
+		return FriendsBoard{}, invalid("unknown period")
+	}
+	b := FriendsBoard{Period: period}
+	err := s.read(ctx, func(q repository.Queries) error {
+		if _, err := q.GetUser(ctx, userID); err != nil {
+			return err
+		}
+		items, err := q.FriendsLeaderboard(ctx, userID, key)
+		if err != nil {
+			return err
+		}
+		show := items[:min(limit, len(items))]
+		own := slices.IndexFunc(items, func(e repository.LeaderboardEntry) bool { return e.ID == userID })
+		if own < 0 {
+			return repository.ErrNotFound
+		}
+		if own >= len(show) {
+			show = append(slices.Clip(show), items[own])
+		}
+		if err := s.withProfiles(ctx, q, show); err != nil {
+			return err
+		}
+		anonymize(show)
+		b.Items, b.Total = show[:min(limit, len(items))], len(items)
+		b.User = show[min(own, len(show)-1)]
+		return nil
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return b, ErrUserNotFound
+	}
+	return b, err
+}
+
+func (s *Service) userRank(ctx context.Context, q repository.Queries, userID int64, period, key string) (Rank, error) {
+	u, err := q.GetUser(ctx, userID)
+	if err != nil {
+		return Rank{}, err
+	}
+	if out, ok, err := s.rankedRank(ctx, q, userID, period, key); err != nil || ok {
+		return out, err
+	}
+	mine := u.Points
+	if key != "all" {
+		if mine, err = q.PeriodPoints(ctx, userID, key); err != nil {
+			return Rank{}, err
+		}
+	}
+
+	pos, above, err := q.Rank(ctx, key, userID, mine)
+	if err != nil {
+		return Rank{}, err
+	}
+	out := Rank{UserID: userID, Period: period, Rank: pos, Points: mine}
+	out.Next = nextRank(above, mine)
+	return out, nil
+}
+
+// rankedRank is UserRank from the precomputed leaderboard; ok is false when
+// it is off, hasn't been refreshed for the current window, or doesn't have
+// the user, who may have joined the board since.
+func (s *Service) rankedRank(ctx context.Context, q repository.Queries, userID int64, period, key string) (Rank, bool, error) {
+	if !s.cfg.PrecomputedLeaderboards {
+		return Rank{}, false, nil
+	}
+	snap, err := q.RankSnapshot(ctx, key)
+	if errors.Is(err, repository.ErrNotFound) {
+		return Rank{}, false, nil
+	}
+	if err != nil {
+		return Rank{}, false, err
+	}
+	me, above, err := q.RankedPosition(ctx, key, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return Rank{}, false, nil
+	}
+	if err != nil {
+		return Rank{}, false, err
+	}
+	return Rank{
+		UserID: userID, Period: period, Rank: me.Rank, Points: me.Points,
+		Next: nextRank(above, me.Points), AsOf: &snap.RefreshedAt,
+	}, true, nil
+}
+
+func nextRank(above *repository.LeaderboardEntry, mine int64) *NextRank {
+	if above == nil {
+		return nil
+	}
+	if above.Anonymous {
+		above.Username = anonymousName
+	}
+	return &NextRank{
+		Rank:         above.Rank,
+		UserID:       above.ID,
+		Username:     above.Username,
+		Points:       above.Points,
+		PointsNeeded: above.Points - mine + 1,
+	}
+}
+
+// percentilePeriods maps API period names to the period keys used in
+// points_distribution (see internal/migrations/sql/0002_points_distribution.sql).
+var percentilePeriods = []struct{ name, key string }{
+	{"all", "all"},
+	{"daily", "day"},
+	{"weekly", "week"},
+	{"monthly", "month"},
+}
+
+func periodKey(name string) (string, bool) {
+	for _, p := range percentilePeriods {
+		if p.name == name {
+			return p.key, true
+		}
+	}
+	return "", false
+}
+
+type Standing struct {
+	Points          int64   `json:"points"`
+	OutranksPercent float64 `json:"outranks_percent"`
+	TopPercent      float64 `json:"top_percent"`
+}
+
+type Percentile struct {
+	UserID     int64               `json:"user_id"`
+	TotalUsers int64               `json:"total_users"`
+	Standings  map[string]Standing `json:"standings"`
+}
+
+func (s *Service) Percentile(ctx context.Context, userID int64) (Percentile, error) {
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		return Percentile{}, err
+	}
+	total, err := s.store.TotalUsers(ctx)
+	if err != nil {
+		return Percentile{}, err
+	}
+
+	out := Percentile{UserID: userID, TotalUsers: total, Standings: make(map[string]Standing, len(percentilePeriods))}
+	for _, p := range percentilePeriods {
+		mine := u.Points
+		if p.key != "all" {
+			if mine, err = s.store.PeriodPoints(ctx, userID, p.key); err != nil {
+				return Percentile{}, err
+			}
+		}
+		d, err := s.store.Distribution(ctx, p.key, mine)
+		if err != nil {
+			return Percentile{}, err
+		}
+		out.Standings[p.name] = standing(mine, total, d)
+	}
+	return out, nil
+}
+
+// standing turns distribution counts into percentages. Users absent from a
+// period's distribution earned 0 points in it.
+func standing(mine, total int64, d repository.Distribution) Standing {
+	below, above := d.Below, d.Above
+	if absent := total - d.Present; absent > 0 {
+		if mine > 0 {
+			below += absent
+		} else if mine < 0 {
+			above += absent
+		}
+	}
+
+	st := Standing{Points: mine, OutranksPercent: 100, TopPercent: 100}
+	if total > 1 {
+		st.OutranksPercent = roundPercent(float64(below) / float64(total-1))
+	}
+	if total > 0 {
+		st.TopPercent = roundPercent(float64(above+1) / float64(total))
+	}
+	return st
+}
+
+func roundPercent(f float64) float64 {
+	return math.Round(f*10000) / 100
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"math"
+)
+
+// StreakStatus is a user's streak as shown in their status. Multiplier is
+// what their next task completion earns: today's rate if they already
+// completed something today, otherwise the rate for extending the streak.
+type StreakStatus struct {
+	Current    int     `json:"current"`
+	Longest    int     `json:"longest"`
+	LastDay    string  `json:"last_day,omitempty"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// streakMultiplier looks up the multiplier for a streak of n days; streaks
+// longer than the curve keep its last value.
+func (s *Service) streakMultiplier(n int) float64 {
+	if len(s.cfg.StreakMultipliers) == 0 {
+		return 1
+	}
+	return curveAt(s.cfg.StreakMultipliers, n)
+}
+
+// curveAt is curve's entry for day n, counting from 1; days past the end
+// keep its last value. curve must not be empty.
+func curveAt[T any](curve []T, n int) T {
+	return curve[max(min(n, len(curve)), 1)-1]
+}
+
+// applyMultiplier scales points, rounding down so a multiplier never awards
+// a fraction.
+func applyMultiplier(points int64, m float64) int64 {
+	return int64(math.Floor(float64(points) * m))
+}
+
+func (s *Service) Streak(ctx context.Context, userID int64) (StreakStatus, error) {
+	st, err := s.store.GetStreak(ctx, userID)
+	if err != nil {
+		return StreakStatus{}, err
+	}
+	next := st.Current
+	if !st.CompletedToday {
+		next++
+		if s.cfg.StreakMax > 0 {
+			next = min(next, s.cfg.StreakMax)
+		}
+	}
+	out := StreakStatus{Current: st.Current, Longest: st.Longest, Multiplier: 1}
+	if s.featureOn(ctx, s.store, FlagStreaks, userID) {
+		out.Multiplier = s.streakMultiplier(next)
+	}
+	if st.LastDay != nil {
+		out.LastDay = st.LastDay.Format("2006-01-02")
+	}
+	return out, nil
+}
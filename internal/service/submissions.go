@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var (
+	ErrSubmissionNotFound = newError("SUBMISSION_NOT_FOUND", "submission not found")
+	ErrSubmissionReviewed = newError("SUBMISSION_REVIEWED", "submission has already been reviewed")
+	ErrAlreadyCompleted   = newError("ALREADY_COMPLETED", "user has completed the task as often as allowed")
+)
+
+const (
+	AuditSubmissionApproved = "task.submission_approved"
+	AuditSubmissionRejected = "task.submission_rejected"
+)
+
+const (
+	// maxProofSize is the largest proof, in bytes of JSON, a submission
+	// keeps.
+	maxProofSize = 4096
+	// maxSubmissionsPage is the most submissions listed at once.
+	maxSubmissionsPage = 200
+)
+
+// submitProof records proof as the user's submission for task, which
+// requires review. A user who already has a pending submission gets that
+// one back; one who has completed the task as often as allowed gets
+// already set instead.
+func submitProof(ctx context.Context, q repository.Queries, userID int64, task repository.Task, proof json.RawMessage) (sub *repository.TaskSubmission, already bool, err error) {
+	done, err := q.CountUserTask(ctx, userID, task.Code)
+	if err != nil {
+		return nil, false, err
+	}
+	if done >= task.MaxCompletionsPerUser {
+		return nil, true, nil
+	}
+	if task.Exhausted() {
+		return nil, false, ErrTaskExhausted
+	}
+	var fields map[string]json.RawMessage
+	if len(proof) == 0 || json.Unmarshal(proof, &fields) != nil || len(fields) == 0 {
+		return nil, false, invalid("proof is required for this task, as a non-empty JSON object")
+	}
+	if len(proof) > maxProofSize {
+		return nil, false, invalid("proof must be at most 4096 bytes")
+	}
+
+	created, err := q.CreateSubmission(ctx, repository.TaskSubmission{UserID: userID, TaskCode: task.Code, Proof: proof})
+	if errors.Is(err, repository.ErrConflict) {
+		pending, err := q.ListSubmissions(ctx, repository.SubmissionFilter{
+			UserID: userID, TaskCode: task.Code, Status: repository.SubmissionPending, Limit: 1})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(pending) == 0 {
+			// reviewed between the insert and the lookup
+			return nil, false, ErrSubmissionReviewed
+		}
+		return &pending[0], false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &created, false, nil
+}
+
+// Submissions pages through submissions matching f by id, oldest first, so
+// the pending ones come out in the order they were made.
+func (s *Service) Submissions(ctx context.Context, f repository.SubmissionFilter) ([]repository.TaskSubmission, error) {
+	switch f.Status {
+	case "", repository.SubmissionPending, repository.SubmissionApproved, repository.SubmissionRejected:
+	default:
+		return nil, invalid("status must be pending, approved or rejected")
+	}
+	if f.Limit <= 0 || f.Limit > maxSubmissionsPage {
+		f.Limit = maxSubmissionsPage
+	}
+	return s.store.ListSubmissions(ctx, f)
+}
+
+// reviewSubmission loads a pending submission in q's transaction and
+// records the decision decide makes on it.
+func reviewSubmission(ctx context.Context, q repository.Queries, id int64, action string, decide func(sub *repository.TaskSubmission) error) (repository.TaskSubmission, error) {
+	sub, err := q.GetSubmission(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return sub, ErrSubmissionNotFound
+	}
+	if err != nil {
+		return sub, err
+	}
+	if sub.Status != repository.SubmissionPending {
+		return sub, ErrSubmissionReviewed
+	}
+	before := sub
+	if a, ok := ctx.Value(ctxKeyActor{}).(Actor); ok && a.UserID != 0 {
+		sub.ReviewedBy = &a.UserID
+	}
+	if err := decide(&sub); err != nil {
+		return sub, err
+	}
+	out, err := q.ReviewSubmission(ctx, sub)
+	if errors.Is(err, repository.ErrConflict) {
+		return out, ErrSubmissionReviewed
+	}
+	if err != nil {
+		return out, err
+	}
+	if err := audit(ctx, q, action, "submission", strconv.FormatInt(id, 10),
+		map[string]any{"status": before.Status},
+		map[string]any{"status": out.Status, "reason": out.Reason, "awarded": out.Awarded}); err != nil {
+		return out, err
+	}
+	return out, emit(ctx, q, EventSubmissionReviewed, map[string]any{
+		"submission_id": out.ID, "user_id": out.UserID, "task": out.TaskCode,
+		"status": out.Status, "reason": out.Reason, "awarded": out.Awarded,
+	})
+}
+
+// ApproveSubmission completes the task for the submitting user and awards
+// its points as CompleteTask would have, scaled by their streak at
+// approval. The task's window is not checked again, but its caps are: a
+// task with no completions left is ErrTaskExhausted and a user who has
+// completed it as often as allowed meanwhile is ErrAlreadyCompleted. The
+// submission stays pending then, to be rejected.
+func (s *Service) ApproveSubmission(ctx context.Context, id int64) (repository.TaskSubmission, error) {
+	var out repository.TaskSubmission
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		out, err = reviewSubmission(ctx, q, id, AuditSubmissionApproved, func(sub *repository.TaskSubmission) error {
+			task, err := q.GetTask(ctx, sub.TaskCode)
+			if err != nil {
+				return err
+			}
+			res, err := s.awardTask(ctx, q, sub.UserID, task, map[string]any{"submission_id": sub.ID})
+			if err != nil {
+				return err
+			}
+			if res.AlreadyCompleted {
+				return ErrAlreadyCompleted
+			}
+			sub.Status, sub.Awarded = repository.SubmissionApproved, res.Awarded
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return out, err
+	}
+	s.RefreshCachedPoints(ctx, out.UserID)
+	return out, nil
+}
+
+// RejectSubmission turns a submission down with reason, which the user
+// sees. Nothing was awarded for it, so nothing is taken back, and the user
+// can submit again.
+func (s *Service) RejectSubmission(ctx context.Context, id int64, reason string) (repository.TaskSubmission, error) {
+	if utf8.RuneCountInString(reason) > 500 {
+		return repository.TaskSubmission{}, invalid("reason must be at most 500 characters")
+	}
+	var out repository.TaskSubmission
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		out, err = reviewSubmission(ctx, q, id, AuditSubmissionRejected, func(sub *repository.TaskSubmission) error {
+			sub.Status, sub.Reason = repository.SubmissionRejected, reason
+			return nil
+		})
+		return err
+	})
+	return out, err
+}
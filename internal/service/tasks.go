@@ -0,0 +1,512 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var (
+	taskCodeRe = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+	taskTagRe  = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+)
+
+// maxTaskTags is how many tags a task can have.
+const maxTaskTags = 10
+
+// Completion is the outcome of CompleteTask. Receipt is empty when the task
+// was already completed or the receipt couldn't be signed. Awarded includes
+// the streak Multiplier. Submission is set instead for tasks that require
+// review.
+type Completion struct {
+	AlreadyCompleted bool
+	Awarded          int64
+	Streak           int
+	Multiplier       float64
+	Receipt          string
+	Submission       *repository.TaskSubmission
+	// Campaigns are the campaigns that added to Awarded, in the order
+	// they were applied.
+	Campaigns []AppliedCampaign
+	// Explain is how Awarded was reached.
+	Explain Explain
+}
+
+// CompleteTask records the completion and awards the task's points, scaled
+// by the user's streak, matching award rules and running campaigns, up to
+// the task's MaxCompletionsPerUser times per user and MaxCompletions times
+// in all. Tasks with a verifier are checked
+// against proof first. For tasks that require review it only submits proof,
+// and the points wait for ApproveSubmission.
+func (s *Service) CompleteTask(ctx context.Context, userID int64, code string, proof json.RawMessage) (res Completion, err error) {
+	ctx, span := tracer.Start(ctx, "CompleteTask", trace.WithAttributes(
+		attribute.Int64("user.id", userID), attribute.String("task.code", code)))
+	defer func() { endSpan(span, err) }()
+
+	if err := s.verifyTask(ctx, userID, code, proof); err != nil {
+		return res, err
+	}
+
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		res, err = s.completeTask(ctx, q, userID, code, proof, nil)
+		return err
+	})
+	if err != nil {
+		return res, err
+	}
+	return s.completed(ctx, userID, code, res), nil
+}
+
+// completeTask is CompleteTask's work in q's transaction, after the
+// verifier. details are passed on to awardTask.
+func (s *Service) completeTask(ctx context.Context, q repository.Queries, userID int64, code string, proof json.RawMessage, details map[string]any) (Completion, error) {
+	var res Completion
+	task, err := q.GetTask(ctx, code)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return res, ErrUnknownTask
+		}
+		return res, err
+	}
+	if now := s.now(); !task.AvailableAt(now) {
+		if task.ExpiredAt(now) {
+			return res, ErrTaskExpired
+		}
+		return res, ErrTaskUnavailable
+	}
+	missing, err := q.MissingPrerequisites(ctx, userID, code)
+	if err != nil {
+		return res, err
+	}
+	if len(missing) > 0 {
+		return res, ErrTaskLocked
+	}
+	if task.RequiresReview {
+		res.Submission, res.AlreadyCompleted, err = submitProof(ctx, q, userID, task, proof)
+		return res, err
+	}
+	return s.awardTask(ctx, q, userID, task, details)
+}
+
+// completed follows up a committed completion that awarded points: it
+// refreshes the cached points and adds the receipt.
+func (s *Service) completed(ctx context.Context, userID int64, code string, res Completion) Completion {
+	if res.AlreadyCompleted || res.Submission != nil {
+		return res
+	}
+	s.RefreshCachedPoints(ctx, userID)
+
+	receipt, err := s.signReceipt(userID, code, res.Awarded, s.now())
+	if err != nil {
+		// points are already committed; report success without a receipt
+		log.Printf("sign receipt for user %d task %s: %v", userID, code, err)
+		return res
+	}
+	res.Receipt = receipt
+	return res
+}
+
+// awardTask records a completion of task by userID and awards its points,
+// scaled by the user's streak. details are added to the task.completed
+// audit entry and event. AlreadyCompleted is set, and nothing awarded, if
+// the user has reached the task's MaxCompletionsPerUser.
+func (s *Service) awardTask(ctx context.Context, q repository.Queries, userID int64, task repository.Task, details map[string]any) (Completion, error) {
+	var res Completion
+	// award only if this call inserted the completion
+	inserted, err := q.AddUserTask(ctx, userID, task.Code, task.MaxCompletionsPerUser)
+	if err != nil {
+		return res, err
+	}
+	if !inserted {
+		res.AlreadyCompleted = true
+		return res, nil
+	}
+	if ok, err := q.ClaimTaskCompletion(ctx, task.Code); err != nil {
+		return res, err
+	} else if !ok {
+		return res, ErrTaskExhausted
+	}
+
+	streak, err := q.BumpStreak(ctx, userID, s.cfg.StreakMax)
+	if err != nil {
+		return res, err
+	}
+	res.Streak = streak.Current
+	res.Multiplier = 1
+	if s.featureOn(ctx, q, FlagStreaks, userID) {
+		res.Multiplier = s.streakMultiplier(streak.Current)
+	}
+	res.Explain = Explain{Base: task.Points, Modifiers: []Modifier{}}
+	if res.Multiplier != 1 {
+		res.Explain.apply(Modifier{Kind: ModifierStreak, Multiplier: res.Multiplier})
+	}
+	sub := &ruleSubject{userID: userID, task: task, streak: res.Streak, at: s.now()}
+	if err := s.applyAwardRules(ctx, q, sub, &res.Explain); err != nil {
+		return res, err
+	}
+	if res.Campaigns, err = s.applyCampaigns(ctx, q, userID, task, &res.Explain); err != nil {
+		return res, err
+	}
+	res.Awarded = res.Explain.points()
+	auditDetails := map[string]any{"task": task.Code, "multiplier": res.Multiplier}
+	event := map[string]any{
+		"user_id": userID, "task": task.Code, "awarded": res.Awarded,
+		"streak": res.Streak, "multiplier": res.Multiplier,
+	}
+	for _, kind := range []string{ModifierRule, ModifierCampaign} {
+		var ids []int64
+		for _, m := range res.Explain.Modifiers {
+			if m.Kind == kind {
+				ids = append(ids, m.ID)
+			}
+		}
+		if len(ids) > 0 {
+			auditDetails[kind+"s"], event[kind+"s"] = ids, ids
+		}
+	}
+	for k, v := range details {
+		auditDetails[k], event[k] = v, v
+	}
+	if err := s.accrue(ctx, q, AuditTaskCompleted, userID, res.Awarded, "task:"+task.Code, auditDetails); err != nil {
+		return res, err
+	}
+	return res, emit(ctx, q, EventTaskCompleted, event)
+}
+
+func (s *Service) ListTasks(ctx context.Context, availableOnly bool) ([]repository.Task, error) {
+	return s.store.ListTasks(ctx, availableOnly)
+}
+
+// UserTask is an available task as seen by one user. A task is locked while
+// any of its prerequisites (Missing) is not completed. Status is "active",
+// "exhausted" once MaxCompletions is reached, or "upcoming" for tasks listed
+// by a preview. Completed means the user can't complete it again, and
+// PendingReview that they have submitted proof that awaits review.
+type UserTask struct {
+	repository.Task
+	Status         string   `json:"status"`
+	Completed      bool     `json:"completed"`
+	TimesCompleted int      `json:"times_completed"`
+	PendingReview  bool     `json:"pending_review"`
+	Locked         bool     `json:"locked"`
+	Missing        []string `json:"missing"`
+	// Locale is the language Title and Description are in.
+	Locale string `json:"locale"`
+}
+
+// Task states TaskFilter.Status can select.
+const (
+	TaskAvailable = "available"
+	TaskLocked    = "locked"
+	TaskCompleted = "completed"
+	TaskUpcoming  = "upcoming"
+)
+
+// TaskFilter narrows TasksForUser; empty fields match every task. Status
+// is TaskAvailable for tasks the user can complete now, TaskLocked for
+// ones waiting on prerequisites, TaskCompleted or TaskUpcoming.
+type TaskFilter struct {
+	Category string
+	Tag      string
+	Status   string
+}
+
+func (f TaskFilter) match(ut UserTask) bool {
+	if f.Category != "" && ut.Category != f.Category {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(ut.Tags, f.Tag) {
+		return false
+	}
+	switch f.Status {
+	case TaskAvailable:
+		return ut.Status == "active" && !ut.Completed && !ut.Locked && !ut.PendingReview
+	case TaskLocked:
+		return ut.Locked && !ut.Completed
+	case TaskCompleted:
+		return ut.Completed
+	case TaskUpcoming:
+		return ut.Status == "upcoming"
+	}
+	return true
+}
+
+func (f TaskFilter) validate(ctx context.Context, q repository.Queries) error {
+	switch f.Status {
+	case "", TaskAvailable, TaskLocked, TaskCompleted, TaskUpcoming:
+	default:
+		return invalid("status must be available, locked, completed or upcoming")
+	}
+	if f.Category == "" {
+		return nil
+	}
+	if _, err := q.GetCategory(ctx, f.Category); errors.Is(err, repository.ErrNotFound) {
+		return ErrCategoryNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// TasksForUser lists the currently available tasks matching filter with the
+// user's progress, localized for the locales in ctx. With preview it also
+// lists active tasks whose window hasn't opened yet, so admins can check
+// seasonal tasks before they go live.
+func (s *Service) TasksForUser(ctx context.Context, userID int64, preview bool, filter TaskFilter) ([]UserTask, error) {
+	if err := filter.validate(ctx, s.store); err != nil {
+		return nil, err
+	}
+	tasks, err := s.store.ListTasks(ctx, !preview)
+	if err != nil {
+		return nil, err
+	}
+	if preview {
+		now := s.now()
+		tasks = slices.DeleteFunc(tasks, func(t repository.Task) bool {
+			return !t.AvailableAt(now) && !t.UpcomingAt(now)
+		})
+	}
+	completed, err := s.store.ListCompletedTasks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]int, len(completed))
+	for _, c := range completed {
+		done[c.Code]++
+	}
+	// a user has at most one pending submission per task
+	pending, err := s.store.ListSubmissions(ctx, repository.SubmissionFilter{
+		UserID: userID, Status: repository.SubmissionPending, Limit: maxSubmissionsPage})
+	if err != nil {
+		return nil, err
+	}
+	inReview := make(map[string]bool, len(pending))
+	for _, sub := range pending {
+		inReview[sub.TaskCode] = true
+	}
+
+	now := s.now()
+	out := make([]UserTask, 0, len(tasks))
+	for _, t := range tasks {
+		t.VerifierConfig = "" // may hold an internal URL
+		ut := UserTask{Task: t, Status: "active", TimesCompleted: done[t.Code], PendingReview: inReview[t.Code], Missing: []string{}}
+		ut.Completed = ut.TimesCompleted >= t.MaxCompletionsPerUser
+		switch {
+		case t.UpcomingAt(now):
+			ut.Status = "upcoming"
+		case t.Exhausted():
+			ut.Status = "exhausted"
+		}
+		// slot counts are for admins
+		ut.Completions, ut.Remaining = 0, nil
+		for _, req := range t.Requires {
+			if done[req] == 0 {
+				ut.Missing = append(ut.Missing, req)
+			}
+		}
+		ut.Locked = len(ut.Missing) > 0
+		if filter.match(ut) {
+			out = append(out, ut)
+		}
+	}
+	if err := s.localizeTasks(ctx, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TaskInput is an admin's task definition; a nil Active means active.
+type TaskInput struct {
+	Code        string     `json:"code"`
+	Title       string     `json:"title"`
+	Points      int64      `json:"points"`
+	Description string     `json:"description"`
+	Active      *bool      `json:"active"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	Requires    []string   `json:"requires"`
+	// Verifier is a name from Config.Verifiers, or empty for self-reported
+	// tasks.
+	Verifier       string `json:"verifier"`
+	VerifierConfig string `json:"verifier_config"`
+	// Category is a category code, or empty for none.
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+	// MaxCompletions caps completions across all users, nil for no cap;
+	// MaxCompletionsPerUser defaults to 1.
+	MaxCompletions        *int64 `json:"max_completions"`
+	MaxCompletionsPerUser *int   `json:"max_completions_per_user"`
+	// RequiresReview makes completions submissions for an admin to
+	// approve.
+	RequiresReview bool `json:"requires_review"`
+}
+
+func (in TaskInput) task() (repository.Task, error) {
+	if strings.TrimSpace(in.Title) == "" {
+		return repository.Task{}, invalid("title is required")
+	}
+	if in.Points < 0 {
+		return repository.Task{}, invalid("points must be >= 0")
+	}
+	if in.StartsAt != nil && in.EndsAt != nil && !in.EndsAt.After(*in.StartsAt) {
+		return repository.Task{}, invalid("ends_at must be after starts_at")
+	}
+	if in.MaxCompletions != nil && *in.MaxCompletions < 1 {
+		return repository.Task{}, invalid("max_completions must be >= 1, or null for no cap")
+	}
+	perUser := 1
+	if in.MaxCompletionsPerUser != nil {
+		perUser = *in.MaxCompletionsPerUser
+	}
+	if perUser < 1 {
+		return repository.Task{}, invalid("max_completions_per_user must be >= 1")
+	}
+	if len(in.Tags) > maxTaskTags {
+		return repository.Task{}, invalid("at most 10 tags")
+	}
+	tags := make([]string, 0, len(in.Tags))
+	for _, tag := range in.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !taskTagRe.MatchString(tag) {
+			return repository.Task{}, invalid("tags must be 1-32 letters, digits, '_' or '-', starting with a letter or digit")
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	active := in.Active == nil || *in.Active
+	return repository.Task{
+		Code:                  in.Code,
+		Title:                 in.Title,
+		Points:                in.Points,
+		Description:           in.Description,
+		Active:                active,
+		StartsAt:              in.StartsAt,
+		EndsAt:                in.EndsAt,
+		Requires:              in.Requires,
+		Verifier:              in.Verifier,
+		VerifierConfig:        in.VerifierConfig,
+		Category:              in.Category,
+		Tags:                  tags,
+		MaxCompletions:        in.MaxCompletions,
+		MaxCompletionsPerUser: perUser,
+		RequiresReview:        in.RequiresReview,
+	}, nil
+}
+
+// saveTask writes t with upsert and then its prerequisites, rejecting
+// unknown codes and cycles, and audits the change as action.
+func (s *Service) saveTask(ctx context.Context, t repository.Task, action string, upsert func(q repository.Queries) (repository.Task, error)) (repository.Task, error) {
+	if slices.Contains(t.Requires, t.Code) {
+		return t, invalid("a task cannot require itself")
+	}
+	if err := s.checkVerifier(t); err != nil {
+		return t, err
+	}
+	var out repository.Task
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		var before any
+		if old, err := q.GetTask(ctx, t.Code); err == nil {
+			before = old
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if t.Category != "" {
+			if _, err := q.GetCategory(ctx, t.Category); errors.Is(err, repository.ErrNotFound) {
+				return invalid("category names an unknown category")
+			} else if err != nil {
+				return err
+			}
+		}
+		if _, err := upsert(q); err != nil {
+			return err
+		}
+		if err := q.SetTaskTags(ctx, t.Code, t.Tags); err != nil {
+			return err
+		}
+		err := q.SetTaskPrerequisites(ctx, t.Code, t.Requires)
+		if errors.Is(err, repository.ErrNotFound) {
+			return invalid("requires names an unknown task")
+		}
+		if err != nil {
+			return err
+		}
+		cyclic, err := q.TaskDependsOn(ctx, t.Code, t.Code)
+		if err != nil {
+			return err
+		}
+		if cyclic {
+			return invalid("requires would create a cycle")
+		}
+		out, err = q.GetTask(ctx, t.Code)
+		if err != nil {
+			return err
+		}
+		return audit(ctx, q, action, "task", t.Code, before, out)
+	})
+	return out, err
+}
+
+func (s *Service) CreateTask(ctx context.Context, in TaskInput) (repository.Task, error) {
+	t, err := in.task()
+	if err != nil {
+		return t, err
+	}
+	if !taskCodeRe.MatchString(t.Code) {
+		return t, invalid("code must be 1-64 lowercase letters, digits or '_'")
+	}
+	out, err := s.saveTask(ctx, t, AuditTaskCreated, func(q repository.Queries) (repository.Task, error) {
+		return q.CreateTask(ctx, t)
+	})
+	if errors.Is(err, repository.ErrConflict) {
+		return out, ErrTaskExists
+	}
+	return out, err
+}
+
+func (s *Service) UpdateTask(ctx context.Context, code string, in TaskInput) (repository.Task, error) {
+	t, err := in.task()
+	if err != nil {
+		return t, err
+	}
+	t.Code = code
+	out, err := s.saveTask(ctx, t, AuditTaskUpdated, func(q repository.Queries) (repository.Task, error) {
+		return q.UpdateTask(ctx, t)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return out, ErrTaskNotFound
+	}
+	return out, err
+}
+
+// ArchiveTask deactivates a task rather than deleting it, so existing
+// completions and ledger entries keep pointing at a real task.
+func (s *Service) ArchiveTask(ctx context.Context, code string) error {
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetTask(ctx, code)
+		if err != nil {
+			return err
+		}
+		if err := q.ArchiveTask(ctx, code); err != nil {
+			return err
+		}
+		after := before
+		after.Active = false
+		return audit(ctx, q, AuditTaskArchived, "task", code, before, after)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrTaskNotFound
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Completing a one-time task again must not award it twice: the second
+// completion's insert finds the row taken and reports already completed.
+func TestCompleteTaskTwiceAwardsOnce(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := New(store, Config{Region: "local"})
+			u := mustCreateUser(t, store, "alice")
+
+			first, err := s.CompleteTask(ctx, u.ID, "subscribe_telegram", nil)
+			if err != nil {
+				t.Fatalf("first completion: %v", err)
+			}
+			if first.AlreadyCompleted || first.Awarded != 20 {
+				t.Fatalf("first completion = %+v, want 20 awarded", first)
+			}
+			second, err := s.CompleteTask(ctx, u.ID, "subscribe_telegram", nil)
+			if err != nil {
+				t.Fatalf("second completion: %v", err)
+			}
+			if !second.AlreadyCompleted || second.Awarded != 0 {
+				t.Errorf("second completion = %+v, want already completed", second)
+			}
+			assertAwardedOnce(t, store, u.ID, 20)
+		})
+	}
+}
+
+// Two completions racing for the same task: exactly one wins.
+func TestCompleteTaskConcurrentlyAwardsOnce(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := New(store, Config{Region: "local"})
+			u := mustCreateUser(t, store, "alice")
+
+			const n = 8
+			results := make([]Completion, n)
+			errs := make([]error, n)
+			var wg sync.WaitGroup
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results[i], errs[i] = s.CompleteTask(ctx, u.ID, "subscribe_telegram", nil)
+				}()
+			}
+			wg.Wait()
+
+			awarded := 0
+			for i, res := range results {
+				if errs[i] != nil {
+					t.Fatalf("completion %d: %v", i, errs[i])
+				}
+				if !res.AlreadyCompleted {
+					awarded++
+				}
+			}
+			if awarded != 1 {
+				t.Errorf("%d completions awarded, want 1", awarded)
+			}
+			assertAwardedOnce(t, store, u.ID, 20)
+		})
+	}
+}
+
+// assertAwardedOnce checks that the user's balance and ledger hold exactly
+// one award of amount.
+func assertAwardedOnce(t *testing.T, store repository.Store, userID, amount int64) {
+	t.Helper()
+	if got := points(t, store, userID); got != amount {
+		t.Errorf("balance = %d, want %d", got, amount)
+	}
+	entries, err := store.ListTransactions(context.Background(), userID, math.MaxInt64, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Amount != amount {
+		t.Errorf("ledger = %+v, want one entry of %d", entries, amount)
+	}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermTeamsManage allows renaming and disbanding teams and removing their
+// members through /admin/teams.
+const PermTeamsManage = "teams:manage"
+
+var (
+	ErrTeamNotFound  = newError("TEAM_NOT_FOUND", "team not found")
+	ErrTeamNameTaken = newError("TEAM_NAME_TAKEN", "team name already taken")
+	ErrTeamFull      = newError("TEAM_FULL", "team has no room for more members")
+	ErrAlreadyInTeam = newError("ALREADY_IN_TEAM", "user is already in a team")
+	ErrNotTeamMember = newError("NOT_TEAM_MEMBER", "user is not in a team")
+)
+
+const (
+	AuditTeamCreated       = "team.created"
+	AuditTeamJoined        = "team.joined"
+	AuditTeamLeft          = "team.left"
+	AuditTeamRenamed       = "team.renamed"
+	AuditTeamDeleted       = "team.deleted"
+	AuditTeamMemberRemoved = "team.member_removed"
+)
+
+var teamNameRe = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9 _-]{1,30}[A-Za-z0-9])$`)
+
+func teamName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !teamNameRe.MatchString(name) {
+		return "", invalid("name must be 3-32 letters, digits, spaces, _ or -, starting and ending with a letter or digit")
+	}
+	return name, nil
+}
+
+// TeamDetails is a team and its members, in the order they joined. Members
+// who aren't public on leaderboards are listed as "Anonymous".
+type TeamDetails struct {
+	Team    repository.Team         `json:"team"`
+	Members []repository.TeamMember `json:"members"`
+}
+
+type TeamPage struct {
+	Items []repository.TeamEntry
+	Total int64
+	// Next is nil on the last page.
+	Next *repository.LeaderboardCursor
+}
+
+func teamTarget(id int64) string { return userTarget(id) }
+
+func (s *Service) Team(ctx context.Context, id int64) (TeamDetails, error) {
+	return teamDetails(ctx, s.store, id)
+}
+
+func teamDetails(ctx context.Context, q repository.Queries, id int64) (TeamDetails, error) {
+	var (
+		d   TeamDetails
+		err error
+	)
+	d.Team, err = q.GetTeam(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return d, ErrTeamNotFound
+	}
+	if err != nil {
+		return d, err
+	}
+	if d.Members, err = q.TeamMembers(ctx, id); err != nil {
+		return d, err
+	}
+	for i, m := range d.Members {
+		if m.Anonymous {
+			d.Members[i].Username = anonymousName
+		}
+	}
+	return d, nil
+}
+
+// UserTeam returns the user's team, ErrNotTeamMember if they have none.
+func (s *Service) UserTeam(ctx context.Context, userID int64) (TeamDetails, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return TeamDetails{}, err
+	}
+	id, err := s.store.UserTeam(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return TeamDetails{}, ErrNotTeamMember
+	}
+	if err != nil {
+		return TeamDetails{}, err
+	}
+	return s.Team(ctx, id)
+}
+
+// CreateTeam creates a team with the user as its first member. Users are in
+// at most one team, so they have to leave theirs first.
+func (s *Service) CreateTeam(ctx context.Context, userID int64, name string) (TeamDetails, error) {
+	name, err := teamName(name)
+	if err != nil {
+		return TeamDetails{}, err
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return TeamDetails{}, err
+	}
+	var d TeamDetails
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		t, err := q.CreateTeam(ctx, name)
+		if errors.Is(err, repository.ErrConflict) {
+			return ErrTeamNameTaken
+		}
+		if err != nil {
+			return err
+		}
+		if err := addTeamMember(ctx, q, t.ID, userID); err != nil {
+			return err
+		}
+		if err := audit(ctx, q, AuditTeamCreated, "team", teamTarget(t.ID), nil, map[string]any{"name": name, "user_id": userID}); err != nil {
+			return err
+		}
+		d, err = teamDetails(ctx, q, t.ID)
+		return err
+	})
+	return d, err
+}
+
+func addTeamMember(ctx context.Context, q repository.Queries, teamID, userID int64) error {
+	err := q.AddTeamMember(ctx, teamID, userID)
+	switch {
+	case errors.Is(err, repository.ErrConflict):
+		return ErrAlreadyInTeam
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrTeamNotFound
+	}
+	return err
+}
+
+// JoinTeam adds the user to the team, unless it already has
+// Config.TeamMaxMembers members. Points the user earns from then on count
+// for the team too.
+func (s *Service) JoinTeam(ctx context.Context, userID, teamID int64) (TeamDetails, error) {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return TeamDetails{}, err
+	}
+	var d TeamDetails
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		t, err := q.GetTeam(ctx, teamID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTeamNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if t.Members >= s.cfg.TeamMaxMembers {
+			return ErrTeamFull
+		}
+		if err := addTeamMember(ctx, q, teamID, userID); err != nil {
+			return err
+		}
+		if err := audit(ctx, q, AuditTeamJoined, "team", teamTarget(teamID), nil, map[string]any{"user_id": userID}); err != nil {
+			return err
+		}
+		d, err = teamDetails(ctx, q, teamID)
+		return err
+	})
+	return d, err
+}
+
+// LeaveTeam takes the user out of their team. The points they earned for it
+// stay with the team; a team whose last member leaves is disbanded.
+func (s *Service) LeaveTeam(ctx context.Context, userID int64) error {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		teamID, err := q.UserTeam(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNotTeamMember
+		}
+		if err != nil {
+			return err
+		}
+		return removeTeamMember(ctx, q, teamID, userID, AuditTeamLeft)
+	})
+}
+
+// removeTeamMember takes userID out of the team, records it as action and
+// disbands the team if that left it empty.
+func removeTeamMember(ctx context.Context, q repository.Queries, teamID, userID int64, action string) error {
+	err := q.RemoveTeamMember(ctx, teamID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNotTeamMember
+	}
+	if err != nil {
+		return err
+	}
+	if err := audit(ctx, q, action, "team", teamTarget(teamID), nil, map[string]any{"user_id": userID}); err != nil {
+		return err
+	}
+	t, err := q.GetTeam(ctx, teamID)
+	if err != nil || t.Members > 0 {
+		return err
+	}
+	if err := q.DeleteTeam(ctx, teamID); err != nil {
+		return err
+	}
+	return audit(ctx, q, AuditTeamDeleted, "team", teamTarget(teamID), t, nil)
+}
+
+// leaveTeamOnDelete drops a deleted user's membership, if they had one.
+func leaveTeamOnDelete(ctx context.Context, q repository.Queries, userID int64) error {
+	teamID, err := q.UserTeam(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return removeTeamMember(ctx, q, teamID, userID, AuditTeamLeft)
+}
+
+// RenameTeam is for moderators; members can't rename their team.
+func (s *Service) RenameTeam(ctx context.Context, id int64, name string) (TeamDetails, error) {
+	name, err := teamName(name)
+	if err != nil {
+		return TeamDetails{}, err
+	}
+	var d TeamDetails
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetTeam(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTeamNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.RenameTeam(ctx, id, name); errors.Is(err, repository.ErrConflict) {
+			return ErrTeamNameTaken
+		} else if err != nil {
+			return err
+		}
+		if d, err = teamDetails(ctx, q, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditTeamRenamed, "team", teamTarget(id), map[string]any{"name": before.Name}, map[string]any{"name": name})
+	})
+	return d, err
+}
+
+// DeleteTeam disbands the team. Its members are free to join or create
+// another.
+func (s *Service) DeleteTeam(ctx context.Context, id int64) error {
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetTeam(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTeamNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteTeam(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditTeamDeleted, "team", teamTarget(id), before, nil)
+	})
+}
+
+// RemoveTeamMember takes a user out of a team on a moderator's behalf.
+func (s *Service) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		if _, err := q.GetTeam(ctx, teamID); errors.Is(err, repository.ErrNotFound) {
+			return ErrTeamNotFound
+		} else if err != nil {
+			return err
+		}
+		return removeTeamMember(ctx, q, teamID, userID, AuditTeamMemberRemoved)
+	})
+}
+
+// TeamLeaderboard ranks teams by the points their members earned for them.
+func (s *Service) TeamLeaderboard(ctx context.Context, limit int, after *repository.LeaderboardCursor) (TeamPage, error) {
+	items, err := s.store.TeamLeaderboard(ctx, limit, after)
+	if err != nil {
+		return TeamPage{}, err
+	}
+	total, err := s.store.CountTeams(ctx)
+	if err != nil {
+		return TeamPage{}, err
+	}
+	page := TeamPage{Items: items, Total: total}
+	if len(items) == limit && limit > 0 {
+		last := items[len(items)-1]
+		page.Next = &repository.LeaderboardCursor{Points: last.Points, ID: last.ID}
+	}
+	return page, nil
+}
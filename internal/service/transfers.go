@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// Transfer moves amount points from fromID to toID. The balance and daily
+// cap checks and both ledger entries share one transaction.
+func (s *Service) Transfer(ctx context.Context, fromID, toID, amount int64) (_ repository.Transfer, err error) {
+	ctx, span := tracer.Start(ctx, "Transfer", trace.WithAttributes(
+		attribute.Int64("user.id", fromID), attribute.Int64("recipient.id", toID),
+		attribute.Int64("amount", amount)))
+	defer func() { endSpan(span, err) }()
+
+	if amount <= 0 {
+		return repository.Transfer{}, invalid("amount must be positive")
+	}
+	if fromID == toID {
+		return repository.Transfer{}, ErrSelfTransfer
+	}
+	if !s.featureOn(ctx, s.store, FlagTransfers, fromID) {
+		return repository.Transfer{}, ErrFeatureDisabled
+	}
+
+	var t repository.Transfer
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		from, err := q.GetUser(ctx, fromID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		if _, err := q.GetUser(ctx, toID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrRecipientNotFound
+			}
+			return err
+		}
+		if from.Points < amount {
+			return ErrInsufficientPoints
+		}
+		if s.cfg.TransferDailyCap > 0 {
+			sent, err := q.TransferredToday(ctx, fromID)
+			if err != nil {
+				return err
+			}
+			if sent+amount > s.cfg.TransferDailyCap {
+				return ErrTransferCapExceeded
+			}
+		}
+
+		t, err = q.CreateTransfer(ctx, fromID, toID, amount)
+		if err != nil {
+			return err
+		}
+		if err := s.accrue(ctx, q, AuditTransfer, fromID, -amount, "transfer:to:"+strconv.FormatInt(toID, 10),
+			map[string]any{"transfer_id": t.ID, "to_user_id": toID}); err != nil {
+			return err
+		}
+		return s.accrue(ctx, q, AuditTransfer, toID, amount, "transfer:from:"+strconv.FormatInt(fromID, 10),
+			map[string]any{"transfer_id": t.ID, "from_user_id": fromID})
+	})
+	if err != nil {
+		return repository.Transfer{}, err
+	}
+	s.RefreshCachedPoints(ctx, fromID, toID)
+	return t, nil
+}
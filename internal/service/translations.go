@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var ErrTranslationNotFound = newError("TRANSLATION_NOT_FOUND", "translation not found")
+
+const (
+	AuditTaskTranslated         = "task.translated"
+	AuditTaskTranslationDeleted = "task.translation_deleted"
+)
+
+// maxLocales bounds how many preferred locales a request can list.
+const maxLocales = 10
+
+// canonicalLocale validates a language tag and writes it the way BCP 47
+// recommends: "pt-BR", "zh-Hant-TW". Tags compare equal once canonical.
+func canonicalLocale(tag string) (string, bool) {
+	if !localeRe.MatchString(tag) {
+		return "", false
+	}
+	parts := strings.Split(tag, "-")
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		case len(p) == 2:
+			parts[i] = strings.ToUpper(p)
+		default:
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, "-"), true
+}
+
+type ctxKeyLocales struct{}
+
+// WithLocales records the caller's preferred locales, most preferred
+// first, for localizing tasks. Tags that aren't valid are skipped.
+func WithLocales(ctx context.Context, tags []string) context.Context {
+	var locales []string
+	for _, tag := range tags {
+		if l, ok := canonicalLocale(tag); ok && !slices.Contains(locales, l) {
+			locales = append(locales, l)
+		}
+		if len(locales) == maxLocales {
+			break
+		}
+	}
+	return context.WithValue(ctx, ctxKeyLocales{}, locales)
+}
+
+// localePrefs is the order translations are looked up in: each preferred
+// locale followed by its less specific forms ("pt-BR", then "pt"), up to
+// the default locale, which the tasks themselves are in.
+func (s *Service) localePrefs(ctx context.Context) []string {
+	def, _ := canonicalLocale(s.cfg.DefaultLocale)
+	tags, _ := ctx.Value(ctxKeyLocales{}).([]string)
+	var prefs []string
+	for _, tag := range tags {
+		for l := tag; l != ""; {
+			if l == def {
+				return prefs
+			}
+			if !slices.Contains(prefs, l) {
+				prefs = append(prefs, l)
+			}
+			i := strings.LastIndexByte(l, '-')
+			if i < 0 {
+				break
+			}
+			l = l[:i]
+		}
+	}
+	return prefs
+}
+
+// translator returns the best translation of each task for the locales in
+// ctx; ok is false when the task should be shown in the default locale.
+func (s *Service) translator(ctx context.Context) (func(code string) (t repository.TaskTranslation, ok bool), error) {
+	prefs := s.localePrefs(ctx)
+	if len(prefs) == 0 {
+		return func(string) (repository.TaskTranslation, bool) { return repository.TaskTranslation{}, false }, nil
+	}
+	all, err := s.store.TranslationsIn(ctx, prefs)
+	if err != nil {
+		return nil, err
+	}
+	byTask := map[string]map[string]repository.TaskTranslation{}
+	for _, t := range all {
+		if byTask[t.TaskCode] == nil {
+			byTask[t.TaskCode] = map[string]repository.TaskTranslation{}
+		}
+		byTask[t.TaskCode][t.Locale] = t
+	}
+	return func(code string) (repository.TaskTranslation, bool) {
+		for _, l := range prefs {
+			if t, ok := byTask[code][l]; ok {
+				return t, true
+			}
+		}
+		return repository.TaskTranslation{}, false
+	}, nil
+}
+
+func (s *Service) localizeTasks(ctx context.Context, tasks []UserTask) error {
+	tr, err := s.translator(ctx)
+	if err != nil {
+		return err
+	}
+	def, _ := canonicalLocale(s.cfg.DefaultLocale)
+	for i := range tasks {
+		tasks[i].Locale = def
+		if t, ok := tr(tasks[i].Code); ok {
+			tasks[i].Title, tasks[i].Description, tasks[i].Locale = t.Title, t.Description, t.Locale
+		}
+	}
+	return nil
+}
+
+func (s *Service) localizeCompleted(ctx context.Context, tasks []repository.CompletedTask) error {
+	tr, err := s.translator(ctx)
+	if err != nil {
+		return err
+	}
+	def, _ := canonicalLocale(s.cfg.DefaultLocale)
+	for i := range tasks {
+		tasks[i].Locale = def
+		if t, ok := tr(tasks[i].Code); ok {
+			tasks[i].Title, tasks[i].Locale = t.Title, t.Locale
+		}
+	}
+	return nil
+}
+
+// TranslationInput is a task's title and description in one locale.
+type TranslationInput struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+func (s *Service) TaskTranslations(ctx context.Context, code string) ([]repository.TaskTranslation, error) {
+	if _, err := s.store.GetTask(ctx, code); errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrTaskNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return s.store.TaskTranslations(ctx, code)
+}
+
+// translationLocale validates a locale a translation can be written for:
+// any but the default one, which is the task's own title and description.
+func (s *Service) translationLocale(locale string) (string, error) {
+	l, ok := canonicalLocale(locale)
+	if !ok {
+		return "", invalid("locale must be a language tag such as en or pt-BR")
+	}
+	if def, _ := canonicalLocale(s.cfg.DefaultLocale); l == def {
+		return "", invalid("the default locale is the task's own title and description")
+	}
+	return l, nil
+}
+
+// SetTaskTranslation adds or replaces the task's translation into locale.
+func (s *Service) SetTaskTranslation(ctx context.Context, code, locale string, in TranslationInput) (repository.TaskTranslation, error) {
+	l, err := s.translationLocale(locale)
+	if err != nil {
+		return repository.TaskTranslation{}, err
+	}
+	title := strings.TrimSpace(in.Title)
+	if title == "" || utf8.RuneCountInString(title) > 200 {
+		return repository.TaskTranslation{}, invalid("title is required, at most 200 characters")
+	}
+	if utf8.RuneCountInString(in.Description) > 2000 {
+		return repository.TaskTranslation{}, invalid("description must be at most 2000 characters")
+	}
+	var out repository.TaskTranslation
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		var before any
+		existing, err := q.TaskTranslations(ctx, code)
+		if err != nil {
+			return err
+		}
+		if i := slices.IndexFunc(existing, func(t repository.TaskTranslation) bool { return t.Locale == l }); i >= 0 {
+			before = existing[i]
+		}
+		out, err = q.SetTaskTranslation(ctx, repository.TaskTranslation{TaskCode: code, Locale: l, Title: title, Description: in.Description})
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTaskNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditTaskTranslated, "task", code, before, out)
+	})
+	return out, err
+}
+
+func (s *Service) DeleteTaskTranslation(ctx context.Context, code, locale string) error {
+	l, ok := canonicalLocale(locale)
+	if !ok {
+		return ErrTranslationNotFound
+	}
+	return s.store.InTx(ctx, func(q repository.Queries) error {
+		existing, err := q.TaskTranslations(ctx, code)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(existing, func(t repository.TaskTranslation) bool { return t.Locale == l })
+		if i < 0 {
+			return ErrTranslationNotFound
+		}
+		if err := q.DeleteTaskTranslation(ctx, code, l); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditTaskTranslationDeleted, "task", code, existing[i], nil)
+	})
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+var ErrVerifierUnavailable = newError("VERIFIER_UNAVAILABLE", "task verification unavailable, try again later")
+
+// VerificationError means the verifier looked at the completion and said no;
+// Reason is safe to show to the user.
+type VerificationError struct {
+	Reason string
+}
+
+func (e *VerificationError) Error() string {
+	if e.Reason == "" {
+		return "task completion could not be verified"
+	}
+	return "task completion could not be verified: " + e.Reason
+}
+
+type VerificationRequest struct {
+	UserID   int64
+	Username string
+	Task     string
+	// Config is the task's verifier_config.
+	Config string
+	// Proof is whatever the client sent along with the completion.
+	Proof json.RawMessage
+	// Account is the user's account at the verifier's provider when they
+	// have linked one, which proved they own it; "" otherwise, and the
+	// verifier wants that proof in Proof.
+	Account string
+}
+
+type Verdict struct {
+	Verified bool
+	Reason   string
+	// Account is the account Proof showed the user owns, which is linked
+	// to them.
+	Account string
+}
+
+// Verifier confirms task completions that can't be self-reported. Verify
+// returns an error only when it couldn't reach a verdict.
+type Verifier interface {
+	CheckConfig(config string) error
+	Verify(ctx context.Context, req VerificationRequest) (Verdict, error)
+}
+
+// AccountVerifier is a Verifier that can also prove, for linking, that a user
+// owns an account at its provider. VerifyAccount returns the account proof
+// is for; its errors are safe to show the user.
+type AccountVerifier interface {
+	Verifier
+	VerifyAccount(proof json.RawMessage) (string, error)
+}
+
+// checkVerifier validates an admin's verifier settings for a task.
+func (s *Service) checkVerifier(t repository.Task) error {
+	if t.Verifier == "" {
+		if t.VerifierConfig != "" {
+			return invalid("verifier_config needs a verifier")
+		}
+		return nil
+	}
+	v, ok := s.cfg.Verifiers[t.Verifier]
+	if !ok {
+		return invalid(fmt.Sprintf("unknown verifier %q", t.Verifier))
+	}
+	if err := v.CheckConfig(t.VerifierConfig); err != nil {
+		return invalid(err.Error())
+	}
+	return nil
+}
+
+// verifyTask runs the task's verifier, if any. It is called before the
+// completion transaction so no locks are held during the network call; tasks
+// that are unknown, unavailable, exhausted or already completed are left for
+// the transaction to report. Telegram tasks are checked against the user's
+// linked Telegram account; the first verified completion links the account
+// its proof showed they own.
+func (s *Service) verifyTask(ctx context.Context, userID int64, code string, proof json.RawMessage) error {
+	task, err := s.store.GetTask(ctx, code)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if task.Verifier == "" || !task.AvailableAt(s.now()) || task.Exhausted() {
+		return nil
+	}
+	done, err := s.store.CountUserTask(ctx, userID, code)
+	if err != nil || done >= task.MaxCompletionsPerUser {
+		return err
+	}
+
+	v, ok := s.cfg.Verifiers[task.Verifier]
+	if !ok {
+		log.Printf("task %s: verifier %q is not configured", task.Code, task.Verifier)
+		return ErrVerifierUnavailable
+	}
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	req := VerificationRequest{
+		UserID:   userID,
+		Username: u.Username,
+		Task:     task.Code,
+		Config:   task.VerifierConfig,
+		Proof:    proof,
+	}
+	if task.Verifier == ProviderTelegram {
+		if req.Account, err = s.linkedAccount(ctx, userID, ProviderTelegram); err != nil {
+			return err
+		}
+	}
+	verdict, err := v.Verify(ctx, req)
+	if err != nil {
+		log.Printf("verify task %s for user %d: %v", task.Code, userID, err)
+		return ErrVerifierUnavailable
+	}
+	if !verdict.Verified {
+		return &VerificationError{Reason: verdict.Reason}
+	}
+	if task.Verifier == ProviderTelegram && req.Account == "" {
+		return s.linkTelegram(ctx, userID, verdict.Account)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/repository"
+)
+
+// PermWebhooksManage allows registering webhook endpoints and reading their
+// delivery log.
+const PermWebhooksManage = "webhooks:manage"
+
+var (
+	ErrWebhookNotFound  = newError("WEBHOOK_NOT_FOUND", "webhook not found")
+	ErrDeliveryNotFound = newError("DELIVERY_NOT_FOUND", "delivery not found or not retryable")
+)
+
+const (
+	AuditWebhookCreated  = "webhook.created"
+	AuditWebhookDisabled = "webhook.disabled"
+	AuditWebhookRetried  = "webhook.retried"
+)
+
+// WebhookInput registers an endpoint. Events defaults to all; Secret is
+// generated when empty.
+type WebhookInput struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// CreateWebhook registers an endpoint and returns it with its signing
+// secret, which is not shown again.
+func (s *Service) CreateWebhook(ctx context.Context, in WebhookInput) (repository.WebhookEndpoint, string, error) {
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return repository.WebhookEndpoint{}, "", invalid("url must be an http(s) URL")
+	}
+	events := in.Events
+	if len(events) == 0 {
+		events = []string{"*"}
+	}
+	for _, e := range events {
+		if e != "*" && !slices.Contains(eventTypes, e) {
+			return repository.WebhookEndpoint{}, "", invalid(fmt.Sprintf("unknown event %q", e))
+		}
+	}
+	secret := in.Secret
+	if secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return repository.WebhookEndpoint{}, "", err
+		}
+		secret = "whsec_" + hex.EncodeToString(buf)
+	}
+
+	var out repository.WebhookEndpoint
+	err = s.store.InTx(ctx, func(q repository.Queries) error {
+		var err error
+		out, err = q.CreateWebhookEndpoint(ctx, repository.WebhookEndpoint{URL: in.URL, Secret: secret, Events: events})
+		if err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditWebhookCreated, "webhook", strconv.FormatInt(out.ID, 10), nil, out)
+	})
+	return out, secret, err
+}
+
+func (s *Service) ListWebhooks(ctx context.Context) ([]repository.WebhookEndpoint, error) {
+	return s.store.ListWebhookEndpoints(ctx)
+}
+
+// DisableWebhook stops deliveries to an endpoint; its log is kept.
+func (s *Service) DisableWebhook(ctx context.Context, id int64) error {
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		before, err := q.GetWebhookEndpoint(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := q.DisableWebhookEndpoint(ctx, id); err != nil {
+			return err
+		}
+		after := before
+		after.Active = false
+		return audit(ctx, q, AuditWebhookDisabled, "webhook", strconv.FormatInt(id, 10), before, after)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func (s *Service) WebhookDeliveries(ctx context.Context, endpointID int64, status string, before int64, limit int) ([]repository.WebhookDelivery, error) {
+	switch status {
+	case "", "pending", "delivered", "failed":
+	default:
+		return nil, invalid("status must be pending, delivered or failed")
+	}
+	if _, err := s.store.GetWebhookEndpoint(ctx, endpointID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return s.store.ListWebhookDeliveries(ctx, endpointID, status, before, limit)
+}
+
+// RetryWebhookDelivery sends a delivered or failed delivery again, with a
+// fresh set of attempts.
+func (s *Service) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	err := s.store.InTx(ctx, func(q repository.Queries) error {
+		if err := q.RetryWebhookDelivery(ctx, id); err != nil {
+			return err
+		}
+		return audit(ctx, q, AuditWebhookRetried, "webhook_delivery", strconv.FormatInt(id, 10), nil, nil)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrDeliveryNotFound
+	}
+	return err
+}
+
+const webhookBatch = 50
+
+// WebhookDispatcher sends queued webhook deliveries. Several instances can
+// run against one database; each delivery is claimed by one of them.
+type WebhookDispatcher struct {
+	store       repository.WebhookStore
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewWebhookDispatcher polls every interval. A failed delivery is retried
+// after backoff, doubling each time up to an hour, until maxAttempts.
+func NewWebhookDispatcher(store repository.WebhookStore, client *http.Client, interval, backoff time.Duration, maxAttempts int) *WebhookDispatcher {
+	return &WebhookDispatcher{store: store, client: client, interval: interval, backoff: backoff, maxAttempts: maxAttempts}
+}
+
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		for {
+			// the lease outlasts a batch of timed-out requests
+			batch, err := d.store.ClaimWebhookDeliveries(ctx, webhookBatch, webhookBatch*d.client.Timeout+time.Minute)
+			if err != nil {
+				log.Printf("webhooks: claim deliveries: %v", err)
+				break
+			}
+			for _, p := range batch {
+				if err := d.store.RecordWebhookAttempt(ctx, p.ID, d.send(ctx, p)); err != nil {
+					log.Printf("webhooks: record delivery %d: %v", p.ID, err)
+				}
+			}
+			if len(batch) < webhookBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// send POSTs the payload signed as
+//
+//	X-Webhook-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of "t.body">
+//
+// and treats any 2xx as delivered.
+func (d *WebhookDispatcher) send(ctx context.Context, p repository.PendingDelivery) repository.WebhookAttempt {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(p.Payload)
+
+	var a repository.WebhookAttempt
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(p.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Event", p.Event)
+		req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(p.ID, 10))
+		req.Header.Set("X-Webhook-Signature", "t="+ts+",v1="+hex.EncodeToString(mac.Sum(nil)))
+		var resp *http.Response
+		resp, err = d.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			a.StatusCode = &resp.StatusCode
+			if resp.StatusCode/100 == 2 {
+				a.Delivered = true
+				return a
+			}
+			err = fmt.Errorf("endpoint returned %s", resp.Status)
+		}
+	}
+	a.Error = err.Error()
+	if attempt := p.Attempts + 1; attempt < d.maxAttempts {
+		a.RetryIn = min(d.backoff<<(attempt-1), time.Hour)
+	}
+	return a
+}
+
+// WebhookFanout publishes outbox events by queueing a delivery for every
+// subscribed endpoint; the dispatcher sends them.
+type WebhookFanout struct {
+	store repository.WebhookStore
+}
+
+func NewWebhookFanout(store repository.WebhookStore) *WebhookFanout {
+	return &WebhookFanout{store: store}
+}
+
+func (f *WebhookFanout) Publish(ctx context.Context, ev Event) error {
+	payload, err := ev.JSON()
+	if err != nil {
+		return err
+	}
+	return f.store.EnqueueWebhookEvent(ctx, ev.ID, ev.Type, payload)
+}
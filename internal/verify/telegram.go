@@ -0,0 +1,155 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// loginMaxAge is how old a Telegram login can be to prove an account.
+const loginMaxAge = 24 * time.Hour
+
+// Telegram checks that the user has joined the chat in the task's
+// verifier_config (e.g. "@our_channel") using the Bot API; the bot must be
+// an admin there. The account checked is the one the user has linked, or
+// else the one in proof: the user's data from the Telegram Login Widget for
+// the same bot, whose hash proves they own it.
+type Telegram struct {
+	client  *http.Client
+	token   string
+	baseURL string
+	now     func() time.Time
+}
+
+func NewTelegram(client *http.Client, botToken string) *Telegram {
+	return &Telegram{client: client, token: botToken, baseURL: "https://api.telegram.org", now: time.Now}
+}
+
+func (t *Telegram) CheckConfig(config string) error {
+	if config == "" {
+		return fmt.Errorf("telegram verifier needs a chat id or @channel")
+	}
+	return nil
+}
+
+func (t *Telegram) Verify(ctx context.Context, req service.VerificationRequest) (service.Verdict, error) {
+	account := req.Account
+	if account == "" {
+		var err error
+		if account, err = t.VerifyAccount(req.Proof); err != nil {
+			return service.Verdict{Reason: err.Error()}, nil
+		}
+	}
+
+	q := url.Values{"chat_id": {req.Config}, "user_id": {account}}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"/bot"+t.token+"/getChatMember?"+q.Encode(), nil)
+	if err != nil {
+		return service.Verdict{}, t.redact(err)
+	}
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return service.Verdict{}, t.redact(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		OK     bool `json:"ok"`
+		Result struct {
+			Status string `json:"status"`
+		} `json:"result"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err != nil {
+		return service.Verdict{}, fmt.Errorf("telegram response: %w", err)
+	}
+	if !body.OK {
+		// 400 "user not found" and similar mean the user isn't a member
+		if resp.StatusCode == http.StatusBadRequest {
+			return service.Verdict{Reason: "not a member of " + req.Config}, nil
+		}
+		return service.Verdict{}, fmt.Errorf("telegram: %s", body.Description)
+	}
+	switch body.Result.Status {
+	case "creator", "administrator", "member", "restricted":
+		return service.Verdict{Verified: true, Account: account}, nil
+	default:
+		return service.Verdict{Reason: "not a member of " + req.Config}, nil
+	}
+}
+
+// VerifyAccount returns the Telegram user id in login, the fields the
+// Telegram Login Widget hands the page ({"id":123,"auth_date":...,
+// "hash":"..."} and the optional names), when its hash is the bot's
+// signature and auth_date is recent. Its errors are safe to show the user.
+func (t *Telegram) VerifyAccount(login json.RawMessage) (string, error) {
+	var fields map[string]any
+	d := json.NewDecoder(bytes.NewReader(login))
+	d.UseNumber()
+	if len(login) == 0 || d.Decode(&fields) != nil {
+		return "", errors.New("proof must be the Telegram login widget's data")
+	}
+	hash, _ := fields["hash"].(string)
+	got, err := hex.DecodeString(hash)
+	if err != nil || hash == "" {
+		return "", errors.New("proof.hash is required")
+	}
+	// the data-check-string is every other field as key=value, sorted
+	var lines []string
+	for k, v := range fields {
+		if k == "hash" {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			lines = append(lines, k+"="+v)
+		case json.Number:
+			lines = append(lines, k+"="+v.String())
+		default:
+			return "", fmt.Errorf("proof.%s must be a string or number", k)
+		}
+	}
+	slices.Sort(lines)
+	key := sha256.Sum256([]byte(t.token))
+	mac := hmac.New(sha256.New, key[:])
+	for i, line := range lines {
+		if i > 0 {
+			mac.Write([]byte("\n"))
+		}
+		mac.Write([]byte(line))
+	}
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return "", errors.New("proof isn't signed by Telegram")
+	}
+	id, _ := fields["id"].(json.Number)
+	if n, err := strconv.ParseInt(id.String(), 10, 64); err != nil || n <= 0 {
+		return "", errors.New("proof.id must be a Telegram user id")
+	}
+	authDate, _ := fields["auth_date"].(json.Number)
+	at, err := authDate.Int64()
+	if err != nil || t.now().Sub(time.Unix(at, 0)) > loginMaxAge {
+		return "", errors.New("the Telegram login has expired, log in again")
+	}
+	return id.String(), nil
+}
+
+// redact takes the bot token out of the request URL in err, so it isn't
+// logged.
+func (t *Telegram) redact(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return &url.Error{Op: ue.Op, URL: t.baseURL + "/bot<token>/getChatMember", Err: ue.Err}
+	}
+	return err
+}
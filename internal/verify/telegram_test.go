@@ -0,0 +1,114 @@
+package verify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+const testBotToken = "123:bot-secret"
+
+// login signs fields the way the Telegram Login Widget does for the bot.
+func login(t *testing.T, token string, fields map[string]any) json.RawMessage {
+	t.Helper()
+	var lines []string
+	for k, v := range fields {
+		lines = append(lines, fmt.Sprintf("%s=%v", k, v))
+	}
+	slices.Sort(lines)
+	key := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	signed := map[string]any{"hash": hex.EncodeToString(mac.Sum(nil))}
+	for k, v := range fields {
+		signed[k] = v
+	}
+	out, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestTelegramVerifyAccount(t *testing.T) {
+	now := time.Now()
+	tg := NewTelegram(http.DefaultClient, testBotToken)
+	fresh := map[string]any{"id": 42, "first_name": "Ann", "username": "ann", "auth_date": now.Unix()}
+	for _, c := range []struct {
+		name    string
+		proof   json.RawMessage
+		want    string
+		wantErr string
+	}{
+		{"signed", login(t, testBotToken, fresh), "42", ""},
+		{"bare id", json.RawMessage(`{"telegram_user_id":42}`), "", "proof.hash is required"},
+		{"other bot", login(t, "456:other", fresh), "", "isn't signed"},
+		{"tampered", json.RawMessage(strings.Replace(string(login(t, testBotToken, fresh)), `"id":42`, `"id":43`, 1)), "", "isn't signed"},
+		{"expired", login(t, testBotToken, map[string]any{"id": 42, "auth_date": now.Add(-48 * time.Hour).Unix()}), "", "expired"},
+		{"no proof", nil, "", "login widget"},
+	} {
+		got, err := tg.VerifyAccount(c.proof)
+		switch {
+		case c.wantErr == "" && (err != nil || got != c.want):
+			t.Errorf("%s: VerifyAccount = %q, %v; want %q", c.name, got, err, c.want)
+		case c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)):
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestTelegramVerify(t *testing.T) {
+	var asked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked = append(asked, r.URL.Query().Get("user_id"))
+		fmt.Fprint(w, `{"ok":true,"result":{"status":"member"}}`)
+	}))
+	defer srv.Close()
+	tg := NewTelegram(srv.Client(), testBotToken)
+	tg.baseURL = srv.URL
+	ctx := context.Background()
+
+	// an unsigned id is refused without asking Telegram
+	v, err := tg.Verify(ctx, service.VerificationRequest{Config: "@chan", Proof: json.RawMessage(`{"telegram_user_id":42}`)})
+	if err != nil || v.Verified || len(asked) != 0 {
+		t.Fatalf("unsigned proof: verdict %+v, %v, asked %v", v, err, asked)
+	}
+	proof := login(t, testBotToken, map[string]any{"id": 42, "auth_date": time.Now().Unix()})
+	if v, err := tg.Verify(ctx, service.VerificationRequest{Config: "@chan", Proof: proof}); err != nil || !v.Verified || v.Account != "42" {
+		t.Errorf("signed proof: verdict %+v, %v; want account 42 verified", v, err)
+	}
+	// a linked account is checked whatever the proof says
+	if v, err := tg.Verify(ctx, service.VerificationRequest{Config: "@chan", Account: "7", Proof: proof}); err != nil || !v.Verified || v.Account != "7" {
+		t.Errorf("linked account: verdict %+v, %v; want account 7 verified", v, err)
+	}
+	if want := []string{"42", "7"}; !slices.Equal(asked, want) {
+		t.Errorf("asked for %v, want %v", asked, want)
+	}
+}
+
+// The bot token is part of the request URL, and must not end up in errors
+// that get logged.
+func TestTelegramVerifyErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	tg := NewTelegram(http.DefaultClient, testBotToken)
+	tg.baseURL = srv.URL
+	_, err := tg.Verify(context.Background(), service.VerificationRequest{Config: "@chan", Account: "42"})
+	if err == nil {
+		t.Fatal("want an error from a closed server")
+	}
+	if strings.Contains(err.Error(), testBotToken) {
+		t.Errorf("error has the bot token: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Package verify holds the verifiers a task can name to confirm a completion
+// before points are awarded.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// Webhook asks the URL in the task's verifier_config. It POSTs
+//
+//	{"user_id":1,"username":"alice","task":"join_discord","proof":{...}}
+//
+// signed with X-Signature: sha256=<hex hmac of the body>, and expects a 200
+// with {"verified":true} or {"verified":false,"reason":"..."}.
+type Webhook struct {
+	client *http.Client
+	secret []byte
+}
+
+func NewWebhook(client *http.Client, secret []byte) *Webhook {
+	return &Webhook{client: client, secret: secret}
+}
+
+func (wh *Webhook) CheckConfig(config string) error {
+	u, err := url.Parse(config)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("webhook verifier needs an http(s) URL")
+	}
+	return nil
+}
+
+func (wh *Webhook) Verify(ctx context.Context, req service.VerificationRequest) (service.Verdict, error) {
+	body, err := json.Marshal(map[string]any{
+		"user_id":  req.UserID,
+		"username": req.Username,
+		"task":     req.Task,
+		"proof":    req.Proof,
+	})
+	if err != nil {
+		return service.Verdict{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.Config, bytes.NewReader(body))
+	if err != nil {
+		return service.Verdict{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	mac := hmac.New(sha256.New, wh.secret)
+	mac.Write(body)
+	httpReq.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := wh.client.Do(httpReq)
+	if err != nil {
+		return service.Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return service.Verdict{}, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	var v struct {
+		Verified bool   `json:"verified"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&v); err != nil {
+		return service.Verdict{}, fmt.Errorf("webhook response: %w", err)
+	}
+	return service.Verdict{Verified: v.Verified, Reason: v.Reason}, nil
+}
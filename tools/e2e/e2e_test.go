@@ -0,0 +1,75 @@
+//go:build e2e
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/example/go-user-tasks/internal/app"
+	"github.com/example/go-user-tasks/internal/config"
+	"github.com/example/go-user-tasks/internal/httpapi"
+	"github.com/example/go-user-tasks/internal/migrations"
+	"github.com/example/go-user-tasks/internal/repository"
+	"github.com/example/go-user-tasks/internal/service"
+)
+
+// TestE2E runs the checks against the API served in-process, wired from the
+// default config like cmd/server does, with no rate limits: over the memory
+// store, and over Postgres when E2E_POSTGRES_DSN names a database, which is
+// migrated first.
+func TestE2E(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		runChecks(t, repository.NewMemory(config.Default().Region.Name))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("E2E_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("E2E_POSTGRES_DSN is not set")
+		}
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if _, err := migrations.Apply(context.Background(), db); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		cfg := config.Default()
+		runChecks(t, repository.NewPostgres(db, cfg.Region.Name, cfg.DB.LockTimeout))
+	})
+}
+
+func runChecks(t *testing.T, store repository.Store) {
+	cfg := config.Default()
+	cfg.JWT.Secret = "e2e-secret"
+	cfg.Receipts.Secret = "e2e-receipt-secret"
+	svc := service.New(store, app.ServiceConfig(cfg, app.ServiceDeps{}))
+	h, err := httpapi.New(svc, app.HTTPConfig(cfg, app.HTTPDeps{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	c := &client{base: srv.URL, http: srv.Client()}
+	c.http.Timeout = 10 * time.Second
+	if err := c.waitReady(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	run := fmt.Sprintf("e2e%d", time.Now().UnixNano())
+	for _, s := range checks {
+		t.Run(s.name, func(t *testing.T) {
+			if err := s.fn(c, run); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,504 @@
+// Command e2e exercises a running server over HTTP: auth, task completion
+// and its idempotency, referral bonuses, leaderboard ordering and API
+// versioning. It creates
+// fresh users on every run, so it can be pointed at a database that already
+// has data, and exits non-zero if any check fails.
+//
+//	docker compose --profile e2e run --rm e2e
+//	go run ./tools/e2e -url http://localhost:8080
+//
+// The same checks run under go test, with the e2e build tag, against an
+// in-process server over the memory store:
+//
+//	go test -tags e2e ./tools/e2e
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+func main() {
+	base := flag.String("url", "http://localhost:8080", "server base URL")
+	wait := flag.Duration("wait", time.Minute, "how long to wait for the server to come up")
+	flag.Parse()
+
+	c := &client{base: *base, http: &http.Client{Timeout: 10 * time.Second}}
+	if err := c.waitReady(*wait); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	run := fmt.Sprintf("e2e%d", time.Now().UnixNano())
+	failed := 0
+	for _, s := range checks {
+		if err := s.fn(c, run); err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", s.name, err)
+			continue
+		}
+		fmt.Printf("ok   %s\n", s.name)
+	}
+	if failed > 0 {
+		fmt.Printf("%d failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+// checks each take the client and a prefix for the usernames they
+// register.
+var checks = []struct {
+	name string
+	fn   func(*client, string) error
+}{
+	{"auth", testAuth},
+	{"task completion", testCompletion},
+	{"idempotency key", testIdempotencyKey},
+	{"referral bonuses", testReferral},
+	{"leaderboard ordering", testLeaderboard},
+	{"api versioning", testVersioning},
+}
+
+// api is the prefix of the API version the checks are written against.
+const api = "/v1"
+
+type client struct {
+	base string
+	http *http.Client
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (r response) decode(v any) error {
+	if err := json.Unmarshal(r.body, v); err != nil {
+		return fmt.Errorf("decode %q: %w", r.body, err)
+	}
+	return nil
+}
+
+// do sends a request, waiting out 429s so repeated runs don't trip the auth
+// rate limit.
+func (c *client) do(method, path, token string, body any, header map[string]string) (response, error) {
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			return response{}, err
+		}
+	}
+	for {
+		req, err := http.NewRequest(method, c.base+api+path, bytes.NewReader(raw))
+		if err != nil {
+			return response{}, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return response{}, err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return response{}, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			time.Sleep(time.Duration(max(secs, 1)) * time.Second)
+			continue
+		}
+		return response{status: resp.StatusCode, header: resp.Header, body: data}, nil
+	}
+}
+
+// expect is do that fails unless the response has the given status.
+func (c *client) expect(status int, method, path, token string, body any) (response, error) {
+	resp, err := c.do(method, path, token, body, nil)
+	if err != nil {
+		return resp, err
+	}
+	if resp.status != status {
+		return resp, fmt.Errorf("%s %s: got %d, want %d: %s", method, path, resp.status, status, bytes.TrimSpace(resp.body))
+	}
+	return resp, nil
+}
+
+func (c *client) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := c.http.Get(c.base + "/openapi.json")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server at %s not ready after %s (last error: %v)", c.base, timeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+type user struct {
+	ID      int64
+	Token   string
+	Refresh string
+}
+
+func (c *client) register(name string) (user, error) {
+	resp, err := c.expect(http.StatusCreated, "POST", "/auth/register", "", map[string]string{"username": name, "password": "e2e-password"})
+	if err != nil {
+		return user{}, err
+	}
+	var out struct {
+		User         struct{ ID int64 }
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := resp.decode(&out); err != nil {
+		return user{}, err
+	}
+	return user{ID: out.User.ID, Token: out.Token, Refresh: out.RefreshToken}, nil
+}
+
+func (c *client) points(u user) (int64, error) {
+	resp, err := c.expect(http.StatusOK, "GET", fmt.Sprintf("/users/%d/status", u.ID), u.Token, nil)
+	if err != nil {
+		return 0, err
+	}
+	var out struct{ User struct{ Points int64 } }
+	if err := resp.decode(&out); err != nil {
+		return 0, err
+	}
+	return out.User.Points, nil
+}
+
+type completion struct {
+	Status  string `json:"status"`
+	Awarded int64  `json:"awarded"`
+	Receipt string `json:"receipt"`
+}
+
+func (c *client) complete(u user, task string) (completion, error) {
+	var out completion
+	resp, err := c.expect(http.StatusOK, "POST", fmt.Sprintf("/users/%d/task/complete", u.ID), u.Token, map[string]string{"task": task})
+	if err != nil {
+		return out, err
+	}
+	return out, resp.decode(&out)
+}
+
+func testAuth(c *client, run string) error {
+	name := run + "_auth"
+	u, err := c.register(name)
+	if err != nil {
+		return err
+	}
+	if _, err := c.expect(http.StatusConflict, "POST", "/auth/register", "", map[string]string{"username": name, "password": "e2e-password"}); err != nil {
+		return fmt.Errorf("duplicate username: %w", err)
+	}
+	if _, err := c.expect(http.StatusUnauthorized, "POST", "/auth/login", "", map[string]string{"username": name, "password": "wrong"}); err != nil {
+		return fmt.Errorf("wrong password: %w", err)
+	}
+	resp, err := c.expect(http.StatusOK, "POST", "/auth/login", "", map[string]string{"username": name, "password": "e2e-password"})
+	if err != nil {
+		return err
+	}
+	var login struct {
+		UserID int64 `json:"user_id"`
+		Token  string
+	}
+	if err := resp.decode(&login); err != nil {
+		return err
+	}
+	if login.UserID != u.ID {
+		return fmt.Errorf("login returned user %d, registered %d", login.UserID, u.ID)
+	}
+	if _, err := c.expect(http.StatusUnauthorized, "GET", fmt.Sprintf("/users/%d/status", u.ID), "", nil); err != nil {
+		return fmt.Errorf("no token: %w", err)
+	}
+	if _, err := c.expect(http.StatusOK, "GET", fmt.Sprintf("/users/%d/status", u.ID), login.Token, nil); err != nil {
+		return err
+	}
+
+	resp, err = c.expect(http.StatusOK, "POST", "/auth/refresh", "", map[string]string{"refresh_token": u.Refresh})
+	if err != nil {
+		return err
+	}
+	var pair struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := resp.decode(&pair); err != nil {
+		return err
+	}
+	if _, err := c.expect(http.StatusUnauthorized, "POST", "/auth/refresh", "", map[string]string{"refresh_token": u.Refresh}); err != nil {
+		return fmt.Errorf("reused refresh token: %w", err)
+	}
+	// reuse revoked the family, so the rotated token is dead too
+	if _, err := c.expect(http.StatusUnauthorized, "POST", "/auth/refresh", "", map[string]string{"refresh_token": pair.RefreshToken}); err != nil {
+		return fmt.Errorf("refresh after reuse: %w", err)
+	}
+	return nil
+}
+
+func testCompletion(c *client, run string) error {
+	u, err := c.register(run + "_tasks")
+	if err != nil {
+		return err
+	}
+	first, err := c.complete(u, "subscribe_twitter")
+	if err != nil {
+		return err
+	}
+	if first.Status != "ok" || first.Awarded <= 0 || first.Receipt == "" {
+		return fmt.Errorf("first completion: %+v", first)
+	}
+	again, err := c.complete(u, "subscribe_twitter")
+	if err != nil {
+		return err
+	}
+	if again.Status != "already_completed" || again.Awarded != 0 {
+		return fmt.Errorf("repeat completion: %+v", again)
+	}
+	pts, err := c.points(u)
+	if err != nil {
+		return err
+	}
+	if pts != first.Awarded {
+		return fmt.Errorf("balance %d after repeat completion, want %d", pts, first.Awarded)
+	}
+
+	resp, err := c.expect(http.StatusOK, "POST", "/receipts/verify", u.Token, map[string]string{"receipt": first.Receipt})
+	if err != nil {
+		return err
+	}
+	var rc struct {
+		Valid  bool
+		UserID int64 `json:"user_id"`
+	}
+	if err := resp.decode(&rc); err != nil {
+		return err
+	}
+	if !rc.Valid || rc.UserID != u.ID {
+		return fmt.Errorf("receipt check: %s", resp.body)
+	}
+
+	if _, err := c.expect(http.StatusBadRequest, "POST", fmt.Sprintf("/users/%d/task/complete", u.ID), u.Token, map[string]string{"task": "no_such_task"}); err != nil {
+		return fmt.Errorf("unknown task: %w", err)
+	}
+	other, err := c.register(run + "_other")
+	if err != nil {
+		return err
+	}
+	if _, err := c.expect(http.StatusForbidden, "POST", fmt.Sprintf("/users/%d/task/complete", other.ID), u.Token, map[string]string{"task": "subscribe_twitter"}); err != nil {
+		return fmt.Errorf("completing for another user: %w", err)
+	}
+	return nil
+}
+
+func testIdempotencyKey(c *client, run string) error {
+	u, err := c.register(run + "_idem")
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/users/%d/task/complete", u.ID)
+	key := map[string]string{"Idempotency-Key": run}
+	first, err := c.do("POST", path, u.Token, map[string]string{"task": "complete_profile"}, key)
+	if err != nil {
+		return err
+	}
+	replay, err := c.do("POST", path, u.Token, map[string]string{"task": "complete_profile"}, key)
+	if err != nil {
+		return err
+	}
+	if first.status != http.StatusOK || replay.status != first.status || !bytes.Equal(replay.body, first.body) {
+		return fmt.Errorf("replay: got %d %q, first was %d %q", replay.status, replay.body, first.status, first.body)
+	}
+	if replay.header.Get("Idempotent-Replayed") != "true" {
+		return errors.New("replay is missing Idempotent-Replayed: true")
+	}
+	mismatch, err := c.do("POST", path, u.Token, map[string]string{"task": "daily_checkin"}, key)
+	if err != nil {
+		return err
+	}
+	if mismatch.status != http.StatusUnprocessableEntity {
+		return fmt.Errorf("key reused for another body: got %d, want 422", mismatch.status)
+	}
+	return nil
+}
+
+func testReferral(c *client, run string) error {
+	referrer, err := c.register(run + "_referrer")
+	if err != nil {
+		return err
+	}
+	referred, err := c.register(run + "_referred")
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/users/%d/referrer", referred.ID)
+	resp, err := c.expect(http.StatusOK, "POST", path, referred.Token, map[string]int64{"referrer_id": referrer.ID})
+	if err != nil {
+		return err
+	}
+	var bonus struct {
+		Referred int64 `json:"bonus_referred"`
+		Referrer int64 `json:"bonus_to_referrer"`
+	}
+	if err := resp.decode(&bonus); err != nil {
+		return err
+	}
+	for _, want := range []struct {
+		u   user
+		pts int64
+	}{{referred, bonus.Referred}, {referrer, bonus.Referrer}} {
+		pts, err := c.points(want.u)
+		if err != nil {
+			return err
+		}
+		if pts != want.pts {
+			return fmt.Errorf("user %d has %d points, want %d", want.u.ID, pts, want.pts)
+		}
+	}
+	if _, err := c.expect(http.StatusConflict, "POST", path, referred.Token, map[string]int64{"referrer_id": referrer.ID}); err != nil {
+		return fmt.Errorf("second referrer: %w", err)
+	}
+	if _, err := c.expect(http.StatusBadRequest, "POST", fmt.Sprintf("/users/%d/referrer", referrer.ID), referrer.Token, map[string]int64{"referrer_id": referrer.ID}); err != nil {
+		return fmt.Errorf("self referral: %w", err)
+	}
+	return nil
+}
+
+type entry struct {
+	ID     int64 `json:"id"`
+	Points int64 `json:"points"`
+	Rank   int   `json:"rank"`
+}
+
+func testLeaderboard(c *client, run string) error {
+	low, err := c.register(run + "_low")
+	if err != nil {
+		return err
+	}
+	high, err := c.register(run + "_high")
+	if err != nil {
+		return err
+	}
+	for _, task := range []string{"subscribe_telegram", "subscribe_twitter"} {
+		if _, err := c.complete(high, task); err != nil {
+			return err
+		}
+	}
+	if _, err := c.complete(low, "daily_checkin"); err != nil {
+		return err
+	}
+
+	var board []entry
+	rank := map[int64]int{}
+	for cursor := ""; ; {
+		resp, err := c.expect(http.StatusOK, "GET", "/users/leaderboard?limit=100"+cursor, high.Token, nil)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Leaderboard []entry
+			NextCursor  *string `json:"next_cursor"`
+		}
+		if err := resp.decode(&page); err != nil {
+			return err
+		}
+		board = append(board, page.Leaderboard...)
+		if page.NextCursor == nil {
+			break
+		}
+		cursor = "&cursor=" + *page.NextCursor
+	}
+	for i, e := range board {
+		rank[e.ID] = e.Rank
+		if e.Rank != i+1 {
+			return fmt.Errorf("entry %d has rank %d", i+1, e.Rank)
+		}
+		if i > 0 {
+			prev := board[i-1]
+			if prev.Points < e.Points || prev.Points == e.Points && prev.ID > e.ID {
+				return fmt.Errorf("rank %d (user %d, %d points) is above rank %d (user %d, %d points)",
+					prev.Rank, prev.ID, prev.Points, e.Rank, e.ID, e.Points)
+			}
+		}
+	}
+	if rank[high.ID] == 0 || rank[low.ID] == 0 || rank[high.ID] > rank[low.ID] {
+		return fmt.Errorf("high at rank %d, low at rank %d", rank[high.ID], rank[low.ID])
+	}
+
+	resp, err := c.expect(http.StatusOK, "GET", fmt.Sprintf("/users/%d/rank", high.ID), high.Token, nil)
+	if err != nil {
+		return err
+	}
+	var r struct{ Rank int }
+	if err := resp.decode(&r); err != nil {
+		return err
+	}
+	if r.Rank != rank[high.ID] {
+		return fmt.Errorf("/rank says %d, leaderboard says %d", r.Rank, rank[high.ID])
+	}
+	return nil
+}
+
+// testVersioning checks that a version the server doesn't speak is refused
+// and that the unversioned paths, when served, are marked deprecated.
+func testVersioning(c *client, run string) error {
+	u, err := c.register(run + "_ver")
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/users/%d/status", u.ID)
+	resp, err := c.do("GET", path, u.Token, nil, map[string]string{"API-Version": "99"})
+	if err != nil {
+		return err
+	}
+	if resp.status != http.StatusBadRequest {
+		return fmt.Errorf("API-Version 99: got %d, want 400", resp.status)
+	}
+
+	req, err := http.NewRequest("GET", c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+u.Token)
+	legacy, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, legacy.Body)
+	legacy.Body.Close()
+	switch {
+	case legacy.StatusCode == http.StatusNotFound:
+		// LEGACY_ROUTES=false
+		return nil
+	case legacy.StatusCode != http.StatusOK:
+		return fmt.Errorf("GET %s: got %d, want 200", path, legacy.StatusCode)
+	case legacy.Header.Get("Deprecation") == "":
+		return fmt.Errorf("GET %s: no Deprecation header", path)
+	}
+	return nil
+}
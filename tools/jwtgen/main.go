@@ -1,33 +1,208 @@
+// Command jwtgen signs HS256 access tokens the server accepts, for manual
+// testing and load-test fixtures. It prints one token, or one per user with
+// -ids:
+//
+//	jwtgen -sub 1
+//	jwtgen -ids 1-1000,2001 -format csv -secret-file ./jwt.secret > tokens.csv
+//	jwtgen -sub 99 -role admin -claim tenant=acme -claim beta=true
+//
+// The secret comes from -secret-file or the environment variable named by
+// -secret-env, in that order, and is dev-secret otherwise. It is never taken
+// on the command line, where shell history and ps would show it.
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// claimFlags collects repeated -claim key=value flags. Values that parse as
+// JSON (numbers, booleans, arrays, quoted strings) keep their type; anything
+// else is a string.
+type claimFlags map[string]any
+
+func (c claimFlags) String() string { return "" }
+
+func (c claimFlags) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return errors.New("want key=value")
+	}
+	var parsed any
+	if err := json.Unmarshal([]byte(v), &parsed); err != nil {
+		parsed = v
+	}
+	c[k] = parsed
+	return nil
+}
+
 func main() {
 	sub := flag.Int64("sub", 0, "subject user id")
-	secret := flag.String("secret", "dev-secret", "HS256 secret")
+	ids := flag.String("ids", "", "user ids to sign a token each for, as a list of ids and ranges (e.g. 1-100,250)")
+	// kept only to explain itself to old scripts
+	secret := flag.String("secret", "", "no longer accepted: use $JWT_SECRET (see -secret-env) or -secret-file")
+	secretEnv := flag.String("secret-env", "JWT_SECRET", "environment variable to read the secret from")
+	secretFile := flag.String("secret-file", "", "file to read the secret from")
+	kid := flag.String("kid", "", "optional kid header, naming the secret among JWT_KEYS")
+	jti := flag.String("jti", "", "token id for the revocation list (default random; single token only)")
 	role := flag.String("role", "", "optional role claim (e.g. admin)")
 	ttl := flag.Duration("ttl", time.Hour*24, "token ttl")
+	format := flag.String("format", "text", "text (one token per line), json ([{\"id\":1,\"token\":\"...\"}]) or csv (id,token)")
+	claims := claimFlags{}
+	flag.Var(claims, "claim", "extra claim as key=value, e.g. aud=go-user-tasks; repeatable, and can't replace sub, iat, exp or jti")
 	flag.Parse()
 
-	claims := jwt.MapClaims{
-		"sub": fmt.Sprintf("%d", *sub),
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Add(*ttl).Unix(),
+	if *format != "text" && *format != "json" && *format != "csv" {
+		fail("-format: %q is not text, json or csv", *format)
 	}
-	if *role != "" {
-		claims["role"] = *role
+	users := []int64{*sub}
+	if *ids != "" {
+		var err error
+		if users, err = parseIDs(*ids); err != nil {
+			fail("-ids: %v", err)
+		}
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	s, err := token.SignedString([]byte(*secret))
+	if *jti != "" && len(users) > 1 {
+		fail("-jti: only with a single token")
+	}
+	if *secret != "" {
+		fail("-secret is no longer accepted, as command lines show up in shell history and ps: set $%s or use -secret-file", cmp.Or(*secretEnv, "JWT_SECRET"))
+	}
+	key, err := loadSecret(*secretEnv, *secretFile)
 	if err != nil {
+		fail("secret: %v", err)
+	}
+
+	now := time.Now()
+	tokens := make([]string, len(users))
+	for i, id := range users {
+		c := jwt.MapClaims{}
+		for k, v := range claims {
+			c[k] = v
+		}
+		c["sub"] = strconv.FormatInt(id, 10)
+		c["iat"] = now.Unix()
+		c["exp"] = now.Add(*ttl).Unix()
+		c["jti"] = *jti
+		if *jti == "" {
+			c["jti"] = randomID()
+		}
+		if *role != "" {
+			c["role"] = *role
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+		if *kid != "" {
+			token.Header["kid"] = *kid
+		}
+		if tokens[i], err = token.SignedString(key); err != nil {
+			fail("sign: %v", err)
+		}
+	}
+
+	if err := write(*format, users, tokens); err != nil {
+		fail("%v", err)
+	}
+}
+
+// parseIDs parses "1-3,7" as 1, 2, 3, 7.
+func parseIDs(s string) ([]int64, error) {
+	var out []int64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad id %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.ParseInt(hi, 10, 64); err != nil || to < from {
+				return nil, fmt.Errorf("bad range %q", part)
+			}
+		}
+		if to-from >= 1_000_000 {
+			return nil, fmt.Errorf("range %q is over a million ids", part)
+		}
+		for id := from; id <= to; id++ {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func loadSecret(env, file string) ([]byte, error) {
+	switch {
+	case file != "":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		// editors and echo leave a trailing newline
+		b = []byte(strings.TrimRight(string(b), "\r\n"))
+		if len(b) == 0 {
+			return nil, fmt.Errorf("%s is empty", file)
+		}
+		return b, nil
+	case env != "" && os.Getenv(env) != "":
+		return []byte(os.Getenv(env)), nil
+	}
+	return []byte("dev-secret"), nil
+}
+
+func write(format string, users []int64, tokens []string) error {
+	switch format {
+	case "text":
+		w := bufio.NewWriter(os.Stdout)
+		for _, t := range tokens {
+			fmt.Fprintln(w, t)
+		}
+		return w.Flush()
+	case "json":
+		type entry struct {
+			ID    int64  `json:"id"`
+			Token string `json:"token"`
+		}
+		out := make([]entry, len(users))
+		for i := range users {
+			out[i] = entry{users[i], tokens[i]}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"id", "token"})
+		for i := range users {
+			w.Write([]string{strconv.FormatInt(users[i], 10), tokens[i]})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return fmt.Errorf("-format: %q is not text, json or csv", format)
+}
+
+func randomID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
 		panic(err)
 	}
-	fmt.Println(s)
+	return hex.EncodeToString(buf)
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "jwtgen: "+format+"\n", args...)
+	os.Exit(2)
 }
@@ -0,0 +1,37 @@
+// Command openapigen writes the OpenAPI spec served at /openapi.json. It runs
+// from go generate in internal/httpapi; -check instead fails if the file is
+// out of date, for CI.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/example/go-user-tasks/internal/httpapi"
+)
+
+func main() {
+	out := flag.String("o", "openapi.json", "output file")
+	check := flag.Bool("check", false, "fail if the output file is stale instead of writing it")
+	flag.Parse()
+
+	spec, err := httpapi.OpenAPI()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *check {
+		cur, err := os.ReadFile(*out)
+		if err != nil || !bytes.Equal(cur, spec) {
+			fmt.Fprintf(os.Stderr, "%s is stale; run go generate ./internal/httpapi\n", *out)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, spec, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}